@@ -1,10 +1,13 @@
 package badger_adaptor
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/dgraph-io/badger/v4"
 	"github.com/lunfardo314/unitrie/common"
 	"github.com/stretchr/testify/require"
 )
@@ -63,3 +66,330 @@ func TestClose(t *testing.T) {
 	})
 	require.True(t, errors.Is(common.ErrDBUnavailable, err))
 }
+
+func TestMetrics(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(dbPath)
+	defer db.Close()
+
+	a := New(db)
+	metrics := common.NewInMemoryMetrics()
+	a.SetMetrics(metrics)
+	a.Set([]byte("a"), []byte("a"))
+	a.Get([]byte("a"))
+	a.Has([]byte("b"))
+	w := a.BatchedWriter()
+	w.Set([]byte("b"), []byte("b"))
+	w.Set([]byte("a"), nil)
+	require.NoError(t, w.Commit())
+
+	require.EqualValues(t, 2, metrics.Counter(common.MetricStoreGets))
+	require.EqualValues(t, 3, metrics.Counter(common.MetricStoreSets))
+	h, ok := metrics.Histogram(common.MetricStoreBatchCommitDuration)
+	require.True(t, ok)
+	require.EqualValues(t, 1, h.Count)
+}
+
+func TestGetFunc(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(dbPath)
+	defer db.Close()
+
+	a := New(db)
+	a.Set([]byte("zc"), []byte("value"))
+	var got string
+	require.True(t, common.GetFunc(a, []byte("zc"), func(v []byte) {
+		got = string(v)
+	}))
+	require.EqualValues(t, "value", got)
+	require.False(t, a.GetFunc([]byte("zc-absent"), func(_ []byte) {
+		t.FailNow()
+	}))
+
+	p := common.MakeReaderPartition(a, 'z')
+	defer p.Dispose()
+	require.True(t, p.GetFunc([]byte("c"), func(v []byte) {
+		got = string(v) + "!"
+	}))
+	require.EqualValues(t, "value!", got)
+}
+
+func TestClearPartition(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(t.TempDir())
+	defer db.Close()
+	a := New(db)
+
+	for i := 0; i < 100; i++ {
+		a.Set([]byte(fmt.Sprintf("a%d", i)), []byte("value"))
+		a.Set([]byte(fmt.Sprintf("b%d", i)), []byte("value"))
+	}
+	var _ common.KVPrefixDropper = a
+	require.NoError(t, common.ClearPartition(a, []byte("a")))
+	for i := 0; i < 100; i++ {
+		require.False(t, a.Has([]byte(fmt.Sprintf("a%d", i))))
+		require.True(t, a.Has([]byte(fmt.Sprintf("b%d", i))))
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(t.TempDir(), badger.DefaultOptions("").WithInMemory(true).WithMemTableSize(4<<20).WithValueThreshold(1<<10))
+	defer db.Close()
+	a := New(db)
+
+	value := make([]byte, 1000)
+	fill := func() common.KVBatchedWriter {
+		b := a.BatchedWriter()
+		for i := 0; i < 10000; i++ {
+			b.Set([]byte(fmt.Sprintf("key%d", i)), value)
+		}
+		return b
+	}
+	require.True(t, errors.Is(fill().Commit(), badger.ErrTxnTooBig))
+
+	a.EnableWriteBatch(true)
+	require.NoError(t, fill().Commit())
+	for i := 0; i < 10000; i++ {
+		require.True(t, a.Has([]byte(fmt.Sprintf("key%d", i))))
+	}
+	b := a.BatchedWriter()
+	b.Set([]byte("key0"), nil)
+	require.NoError(t, b.Commit())
+	require.False(t, a.Has([]byte("key0")))
+}
+
+func TestReaderAt(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(t.TempDir())
+	defer db.Close()
+	a := New(db)
+
+	for i := 0; i < 10; i++ {
+		a.Set([]byte(fmt.Sprintf("key%d", i)), []byte("old"))
+	}
+	snap := a.ReaderAt()
+	defer snap.Discard()
+
+	b := a.BatchedWriter()
+	for i := 0; i < 10; i++ {
+		b.Set([]byte(fmt.Sprintf("key%d", i)), []byte("new"))
+	}
+	b.Set([]byte("key10"), []byte("new"))
+	b.Set([]byte("key0"), nil)
+	require.NoError(t, b.Commit())
+
+	require.False(t, a.Has([]byte("key0")))
+	require.EqualValues(t, "new", string(a.Get([]byte("key1"))))
+
+	require.True(t, snap.Has([]byte("key0")))
+	require.False(t, snap.Has([]byte("key10")))
+	require.EqualValues(t, "old", string(snap.Get([]byte("key1"))))
+	require.True(t, snap.GetFunc([]byte("key2"), func(v []byte) {
+		require.EqualValues(t, "old", string(v))
+	}))
+	n := 0
+	snap.Iterator([]byte("key")).Iterate(func(k, v []byte) bool {
+		require.EqualValues(t, "old", string(v))
+		n++
+		return true
+	})
+	require.EqualValues(t, 10, n)
+}
+
+func TestIteratorOpts(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(t.TempDir())
+	defer db.Close()
+	a := New(db)
+
+	keys := []string{"\x00", "a", "a\x00", "ab", "a\xff", "a\xff\xff", "b", "\xff", "\xff\x01"}
+	for _, k := range keys {
+		a.Set([]byte(k), []byte("v"+k))
+	}
+	collect := func(prefix string, opts IteratorOpts, keysOnly bool) []string {
+		ret := make([]string, 0)
+		it := a.IteratorWithOpts([]byte(prefix), opts)
+		if keysOnly {
+			it.IterateKeys(func(k []byte) bool {
+				ret = append(ret, string(k))
+				return true
+			})
+		} else {
+			it.Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, "v"+string(k), string(v))
+				ret = append(ret, string(k))
+				return true
+			})
+		}
+		return ret
+	}
+	reversed := func(s []string) []string {
+		ret := make([]string, len(s))
+		for i := range s {
+			ret[len(s)-1-i] = s[i]
+		}
+		return ret
+	}
+	for _, keysOnly := range []bool{false, true} {
+		require.EqualValues(t, keys, collect("", IteratorOpts{}, keysOnly))
+		require.EqualValues(t, reversed(keys), collect("", IteratorOpts{Reverse: true}, keysOnly))
+		require.EqualValues(t, keys[1:6], collect("a", IteratorOpts{PrefetchSize: 1}, keysOnly))
+		require.EqualValues(t, reversed(keys[1:6]), collect("a", IteratorOpts{Reverse: true}, keysOnly))
+		require.EqualValues(t, []string{"a\xff\xff", "a\xff"}, collect("a\xff", IteratorOpts{Reverse: true}, keysOnly))
+		require.EqualValues(t, []string{"\xff\x01", "\xff"}, collect("\xff", IteratorOpts{Reverse: true}, keysOnly))
+		require.EqualValues(t, []string{"b"}, collect("b", IteratorOpts{Reverse: true}, keysOnly))
+		require.EqualValues(t, []string{}, collect("c", IteratorOpts{Reverse: true}, keysOnly))
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(t.TempDir())
+	defer db.Close()
+	a := New(db)
+
+	b := a.BatchedWriter()
+	for i := 0; i < 10000; i++ {
+		b.Set([]byte(fmt.Sprintf("a%d", i)), []byte(fmt.Sprintf("value%d", i)))
+		b.Set([]byte(fmt.Sprintf("b%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	require.NoError(t, b.Commit())
+	// old versions and deleted keys are not backed up
+	a.Set([]byte("a0"), []byte("new"))
+	a.Set([]byte("a1"), nil)
+
+	var buf bytes.Buffer
+	w := common.NewBinaryStreamWriter(&buf)
+	require.NoError(t, a.Backup(nil, w))
+	n, _ := w.Stats()
+	require.EqualValues(t, 19999, n)
+
+	dbRestored := MustCreateOrOpenBadgerDB(t.TempDir())
+	defer dbRestored.Close()
+	restored := New(dbRestored)
+	require.NoError(t, restored.Restore(common.NewBinaryStreamIterator(bytes.NewReader(buf.Bytes()))))
+	require.EqualValues(t, "new", string(restored.Get([]byte("a0"))))
+	require.False(t, restored.Has([]byte("a1")))
+	for i := 2; i < 10000; i++ {
+		require.EqualValues(t, fmt.Sprintf("value%d", i), string(restored.Get([]byte(fmt.Sprintf("a%d", i)))))
+		require.EqualValues(t, fmt.Sprintf("value%d", i), string(restored.Get([]byte(fmt.Sprintf("b%d", i)))))
+	}
+
+	// prefix
+	buf.Reset()
+	w = common.NewBinaryStreamWriter(&buf)
+	require.NoError(t, a.Backup([]byte("b"), w))
+	n, _ = w.Stats()
+	require.EqualValues(t, 10000, n)
+
+	// stop
+	n = 0
+	require.NoError(t, a.StreamIterator(nil).Iterate(func(k, v []byte) bool {
+		n++
+		return n < 10
+	}))
+	require.EqualValues(t, 10, n)
+}
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	opts := badger.DefaultOptions(dir).
+		WithValueThreshold(64).
+		WithValueLogFileSize(1 << 20).
+		WithNumVersionsToKeep(1).
+		WithNumLevelZeroTables(2)
+
+	value := make([]byte, 1000)
+	// each round is flushed to the separate table of the LSM tree on close
+	for round := 0; round < 5; round++ {
+		db := MustCreateOrOpenBadgerDB(dir, opts)
+		a := New(db)
+		a.EnableWriteBatch(true)
+		b := a.BatchedWriter()
+		for i := 0; i < 1000; i++ {
+			b.Set([]byte(fmt.Sprintf("key%d", i)), value)
+		}
+		require.NoError(t, b.Commit())
+		require.NoError(t, db.Close())
+	}
+	db := MustCreateOrOpenBadgerDB(dir, opts)
+	defer db.Close()
+	a := New(db)
+	metrics := common.NewInMemoryMetrics()
+	a.SetMetrics(metrics)
+
+	usage, err := a.DiskUsage()
+	require.NoError(t, err)
+	require.True(t, usage.ValueLog > 4<<20)
+	require.True(t, usage.LSM > 0)
+
+	// compaction drops old versions and collects statistics of discarded values for the GC
+	require.NoError(t, a.Compact(2))
+	rewritten, err := a.RunGC(0.5)
+	require.NoError(t, err)
+	require.True(t, rewritten > 0)
+	require.EqualValues(t, rewritten, metrics.Counter(common.MetricStoreGCRewrites))
+
+	usageAfter, err := a.DiskUsage()
+	require.NoError(t, err)
+	require.True(t, usageAfter.ValueLog < usage.ValueLog)
+
+	stop := a.StartGC(10*time.Millisecond, 0.5)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	stop()
+}
+
+func TestSetWithTTL(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(t.TempDir())
+	defer db.Close()
+	a := New(db)
+
+	var w common.KVTTLWriter = a
+	w.SetWithTTL([]byte("ephemeral"), []byte("value"), time.Second)
+	a.Set([]byte("permanent"), []byte("value"))
+	require.EqualValues(t, []byte("value"), a.Get([]byte("ephemeral")))
+
+	time.Sleep(2 * time.Second)
+	require.False(t, a.Has([]byte("ephemeral")))
+	require.Nil(t, a.Get([]byte("ephemeral")))
+	require.True(t, a.Has([]byte("permanent")))
+}
+
+func TestPrunePartition(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(t.TempDir())
+	defer db.Close()
+	a := New(db)
+
+	for i := 0; i < 100; i++ {
+		a.Set([]byte(fmt.Sprintf("a%d", i)), []byte("value"))
+		a.Set([]byte(fmt.Sprintf("b%d", i)), []byte("value"))
+	}
+	var _ common.KVPartitionPruner = a
+	require.NoError(t, a.PrunePartition([]byte("a")))
+	for i := 0; i < 100; i++ {
+		require.False(t, a.Has([]byte(fmt.Sprintf("a%d", i))))
+		require.True(t, a.Has([]byte(fmt.Sprintf("b%d", i))))
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	db := MustCreateOrOpenBadgerDB(t.TempDir())
+	defer db.Close()
+	a := New(db)
+
+	keys := make([][]byte, 0)
+	for i := 0; i < 10; i++ {
+		a.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+	}
+	keys = append(keys, []byte("absent"))
+	snapshot := a.ReaderAt()
+	defer snapshot.Discard()
+	a.Set([]byte("key0"), []byte("changed"))
+
+	for _, r := range []common.KVBatchedReader{a, snapshot} {
+		values := r.GetMany(keys)
+		require.EqualValues(t, len(keys), len(values))
+		for i := 1; i < 10; i++ {
+			require.EqualValues(t, fmt.Sprintf("value%d", i), string(values[i]))
+		}
+		require.Nil(t, values[10])
+	}
+	require.EqualValues(t, "changed", string(a.GetMany(keys)[0]))
+	require.EqualValues(t, "value0", string(snapshot.GetMany(keys)[0]))
+}
@@ -1,7 +1,9 @@
 package badger_adaptor
 
 import (
+	"bytes"
 	"errors"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/lunfardo314/unitrie/common"
@@ -10,6 +12,9 @@ import (
 type (
 	DB struct {
 		*badger.DB
+		metrics common.Metrics
+		// if true, batches are committed with badger.WriteBatch. See EnableWriteBatch
+		useWriteBatch bool
 	}
 
 	badgerAdaptorBatch struct {
@@ -18,17 +23,43 @@ type (
 	}
 
 	badgerAdaptorIterator struct {
-		db     *DB
+		// view runs the function in the read transaction
+		view   func(fn func(txn *badger.Txn) error) error
 		prefix []byte
+		opts   IteratorOpts
 	}
 )
 
 // KVReader
 
 func (a *DB) Get(key []byte) []byte {
+	a.metrics.AddCounter(common.MetricStoreGets, 1)
+	return getValue(a.View, key)
+}
+
+// GetFunc passes the value to f directly from badger, without copying. The value is valid only during the call
+func (a *DB) GetFunc(key []byte, f func(value []byte)) bool {
+	a.metrics.AddCounter(common.MetricStoreGets, 1)
+	return getValueFunc(a.View, key, f)
+}
+
+func (a *DB) Has(key []byte) bool {
+	a.metrics.AddCounter(common.MetricStoreGets, 1)
+	return hasKey(a.View, key)
+}
+
+// GetMany reads values of all keys in one read transaction
+func (a *DB) GetMany(keys [][]byte) [][]byte {
+	a.metrics.AddCounter(common.MetricStoreGets, uint64(len(keys)))
+	return getValues(a.View, keys)
+}
+
+// getValue, getValues, getValueFunc and hasKey read in the read transaction provided by view
+
+func getValue(view func(fn func(txn *badger.Txn) error) error, key []byte) []byte {
 	var ret []byte
 	err := common.CatchPanicOrError(func() error {
-		return a.DB.View(func(txn *badger.Txn) error {
+		return view(func(txn *badger.Txn) error {
 			item, err := txn.Get(key)
 			if err != nil {
 				return err
@@ -48,9 +79,59 @@ func (a *DB) Get(key []byte) []byte {
 	return ret
 }
 
-func (a *DB) Has(key []byte) bool {
+func getValues(view func(fn func(txn *badger.Txn) error) error, keys [][]byte) [][]byte {
+	ret := make([][]byte, len(keys))
+	err := common.CatchPanicOrError(func() error {
+		return view(func(txn *badger.Txn) error {
+			for i, key := range keys {
+				item, err := txn.Get(key)
+				if errors.Is(err, badger.ErrKeyNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if ret[i], err = item.ValueCopy(nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if errors.Is(err, badger.ErrDBClosed) {
+		panic(common.ErrDBUnavailable)
+	}
+	common.AssertNoError(err)
+	return ret
+}
+
+func getValueFunc(view func(fn func(txn *badger.Txn) error) error, key []byte, f func(value []byte)) bool {
+	err := common.CatchPanicOrError(func() error {
+		return view(func(txn *badger.Txn) error {
+			item, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			return item.Value(func(val []byte) error {
+				f(val)
+				return nil
+			})
+		})
+	})
+	switch {
+	case errors.Is(err, badger.ErrKeyNotFound):
+		return false
+	case errors.Is(err, badger.ErrDBClosed):
+		panic(common.ErrDBUnavailable)
+	default:
+		common.AssertNoError(err)
+	}
+	return true
+}
+
+func hasKey(view func(fn func(txn *badger.Txn) error) error, key []byte) bool {
 	err := common.CatchPanicOrError(func() error {
-		return a.DB.View(func(txn *badger.Txn) error {
+		return view(func(txn *badger.Txn) error {
 			_, err := txn.Get(key)
 			return err
 		})
@@ -69,7 +150,11 @@ func (a *DB) Has(key []byte) bool {
 // KVWriter
 
 func (a *DB) Set(key, value []byte) {
+	a.metrics.AddCounter(common.MetricStoreSets, 1)
 	err := a.DB.Update(func(txn *badger.Txn) error {
+		if len(value) == 0 {
+			return txn.Delete(key)
+		}
 		return txn.Set(key, value)
 	})
 	if errors.Is(err, badger.ErrDBClosed) {
@@ -78,6 +163,38 @@ func (a *DB) Set(key, value []byte) {
 	common.AssertNoError(err)
 }
 
+// KVTTLWriter
+
+// SetWithTTL sets the key which expires after ttl. Badger expires keys with the precision of a second.
+// Empty value deletes the key, as with Set
+func (a *DB) SetWithTTL(key, value []byte, ttl time.Duration) {
+	common.Assertf(ttl > 0, "SetWithTTL: ttl must be positive")
+	a.metrics.AddCounter(common.MetricStoreSets, 1)
+	err := a.DB.Update(func(txn *badger.Txn) error {
+		if len(value) == 0 {
+			return txn.Delete(key)
+		}
+		return txn.SetEntry(badger.NewEntry(key, value).WithTTL(ttl))
+	})
+	if errors.Is(err, badger.ErrDBClosed) {
+		panic(common.ErrDBUnavailable)
+	}
+	common.AssertNoError(err)
+}
+
+// KVPartitionPruner
+
+// PrunePartition deletes all keys with the prefix with badger DropPrefix, which drops the data in the LSM tree
+// without iterating keys. Writes to the DB are blocked while it runs. Space of the value log is reclaimed by the GC
+func (a *DB) PrunePartition(prefix []byte) error {
+	common.Assertf(len(prefix) > 0, "PrunePartition: prefix can't be empty")
+	err := a.DB.DropPrefix(prefix)
+	if errors.Is(err, badger.ErrDBClosed) {
+		err = common.ErrDBUnavailable
+	}
+	return err
+}
+
 // BatchedUpdatable
 
 func (a *DB) BatchedWriter() common.KVBatchedWriter {
@@ -94,6 +211,14 @@ func (b *badgerAdaptorBatch) Set(key, value []byte) {
 }
 
 func (b *badgerAdaptorBatch) Commit() error {
+	start := time.Now()
+	defer func() {
+		b.db.metrics.AddCounter(common.MetricStoreSets, uint64(b.mut.LenSet()+b.mut.LenDel()))
+		b.db.metrics.Observe(common.MetricStoreBatchCommitDuration, time.Since(start).Seconds())
+	}()
+	if b.db.useWriteBatch {
+		return b.commitWriteBatch()
+	}
 	err := common.CatchPanicOrError(func() error {
 		return b.db.Update(func(txn *badger.Txn) error {
 			var err error
@@ -114,12 +239,47 @@ func (b *badgerAdaptorBatch) Commit() error {
 	return err
 }
 
+// commitWriteBatch writes the batch with badger.WriteBatch, which splits it into as many transactions as needed
+func (b *badgerAdaptorBatch) commitWriteBatch() error {
+	wb := b.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	err := common.CatchPanicOrError(func() error {
+		var err error
+		b.mut.Iterate(func(k []byte, v []byte, _ bool) bool {
+			if err != nil {
+				return false
+			}
+			if len(v) > 0 {
+				err = wb.Set(k, v)
+			} else {
+				err = wb.Delete(k)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		return wb.Flush()
+	})
+	if errors.Is(err, badger.ErrDBClosed) {
+		err = common.ErrDBUnavailable
+	}
+	return err
+}
+
 // Traversable
 
 func (a *DB) Iterator(prefix []byte) common.KVIterator {
+	return a.IteratorWithOpts(prefix, IteratorOpts{})
+}
+
+// IteratorWithOpts returns the iterator with options
+func (a *DB) IteratorWithOpts(prefix []byte, opts IteratorOpts) common.KVIterator {
 	return &badgerAdaptorIterator{
-		db:     a,
+		view:   a.View,
 		prefix: prefix,
+		opts:   opts,
 	}
 }
 
@@ -127,45 +287,54 @@ func (a *DB) Iterator(prefix []byte) common.KVIterator {
 
 const iteratorPrefetchSize = 10
 
-func (it *badgerAdaptorIterator) Iterate(fun func(k []byte, v []byte) bool) {
-	err := common.CatchPanicOrError(func() error {
-		return it.db.View(func(txn *badger.Txn) error {
-			opts := badger.DefaultIteratorOptions
-			opts.PrefetchSize = iteratorPrefetchSize
-
-			dbIt := txn.NewIterator(opts)
-			defer dbIt.Close()
+// IteratorOpts options of the iterator. Zero value is the default forward iteration
+type IteratorOpts struct {
+	// Reverse iterates keys in descending order
+	Reverse bool
+	// PrefetchSize number of values prefetched by Iterate. iteratorPrefetchSize if 0.
+	// IterateKeys never fetches values
+	PrefetchSize int
+}
 
-			exit := false
-			for dbIt.Seek(it.prefix); !exit && dbIt.ValidForPrefix(it.prefix); dbIt.Next() {
-				err := dbIt.Item().Value(func(val []byte) error {
-					exit = !fun(dbIt.Item().Key(), val)
-					return nil
-				})
-				if err != nil {
-					return err
-				}
-			}
+func (it *badgerAdaptorIterator) Iterate(fun func(k []byte, v []byte) bool) {
+	it.iterate(true, func(item *badger.Item) (bool, error) {
+		exit := false
+		err := item.Value(func(val []byte) error {
+			exit = !fun(item.Key(), val)
 			return nil
 		})
+		return !exit, err
 	})
-	if errors.Is(err, badger.ErrDBClosed) {
-		panic(common.ErrDBUnavailable)
-	}
 }
 
 func (it *badgerAdaptorIterator) IterateKeys(fun func(k []byte) bool) {
+	it.iterate(false, func(item *badger.Item) (bool, error) {
+		return fun(item.Key()), nil
+	})
+}
+
+func (it *badgerAdaptorIterator) iterate(fetchValues bool, fun func(item *badger.Item) (bool, error)) {
 	err := common.CatchPanicOrError(func() error {
-		return it.db.View(func(txn *badger.Txn) error {
+		return it.view(func(txn *badger.Txn) error {
 			opts := badger.DefaultIteratorOptions
+			opts.PrefetchValues = fetchValues
 			opts.PrefetchSize = iteratorPrefetchSize
+			if it.opts.PrefetchSize > 0 {
+				opts.PrefetchSize = it.opts.PrefetchSize
+			}
+			opts.Reverse = it.opts.Reverse
+			if !opts.Reverse {
+				// with the prefix option badger skips tables without the prefix. Not used in the reverse
+				// iteration, because badger treats the iterator positioned at the upper bound as not valid
+				opts.Prefix = it.prefix
+			}
 
 			dbIt := txn.NewIterator(opts)
 			defer dbIt.Close()
 
-			for dbIt.Rewind(); dbIt.ValidForPrefix(it.prefix); dbIt.Next() {
-				if !fun(dbIt.Item().Key()) {
-					return nil
+			for it.seek(dbIt); dbIt.ValidForPrefix(it.prefix); dbIt.Next() {
+				if cont, err := fun(dbIt.Item()); err != nil || !cont {
+					return err
 				}
 			}
 			return nil
@@ -175,3 +344,34 @@ func (it *badgerAdaptorIterator) IterateKeys(fun func(k []byte) bool) {
 		panic(common.ErrDBUnavailable)
 	}
 }
+
+// seek positions the iterator at the first key with the prefix in the order of iteration.
+// The reverse iterator is positioned at the largest key not greater than the upper bound of the prefix
+func (it *badgerAdaptorIterator) seek(dbIt *badger.Iterator) {
+	if !it.opts.Reverse {
+		dbIt.Seek(it.prefix)
+		return
+	}
+	upper := prefixUpperBound(it.prefix)
+	if upper == nil {
+		// empty prefix or prefix of 0xff bytes: keys with the prefix are at the end
+		dbIt.Rewind()
+		return
+	}
+	dbIt.Seek(upper)
+	if dbIt.Valid() && bytes.Equal(dbIt.Item().Key(), upper) {
+		dbIt.Next()
+	}
+}
+
+// prefixUpperBound returns the smallest key greater than all keys with the prefix, nil if it does not exist
+func prefixUpperBound(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] < 0xff {
+			ret := common.Concat(prefix[:i+1])
+			ret[i]++
+			return ret
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package badger_adaptor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Badger never reclaims space of the value log by itself: stale values, left after the trie is pruned,
+// remain on disk until the value log GC rewrites the files. RunGC and StartGC run the GC, Compact merges
+// the LSM tree, DiskUsage reports the size of the files
+
+// DiskUsage size of the DB files in bytes
+type DiskUsage struct {
+	LSM      int64
+	ValueLog int64
+}
+
+func (u DiskUsage) Total() int64 {
+	return u.LSM + u.ValueLog
+}
+
+// RunGC runs the value log GC with the discard ratio until no more value log files can be rewritten.
+// The file is rewritten if at least discardRatio of its space can be reclaimed, 0.5 is recommended.
+// Returns number of rewritten files
+func (a *DB) RunGC(discardRatio float64) (int, error) {
+	ret := 0
+	for {
+		err := a.RunValueLogGC(discardRatio)
+		switch {
+		case err == nil:
+			ret++
+			a.metrics.AddCounter(common.MetricStoreGCRewrites, 1)
+		case errors.Is(err, badger.ErrNoRewrite), errors.Is(err, badger.ErrRejected):
+			// nothing to rewrite or GC is already running
+			return ret, nil
+		case errors.Is(err, badger.ErrDBClosed):
+			return ret, common.ErrDBUnavailable
+		default:
+			return ret, err
+		}
+	}
+}
+
+// StartGC runs RunGC periodically in the background. Errors are passed to onError, if it is not nil.
+// Returns function which stops the GC and waits until it is stopped. The GC must be stopped before the DB is closed
+func (a *DB) StartGC(interval time.Duration, discardRatio float64, onError ...func(err error)) (stop func()) {
+	common.Assertf(interval > 0, "StartGC: interval must be positive")
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				if _, err := a.RunGC(discardRatio); err != nil && len(onError) > 0 && onError[0] != nil {
+					onError[0](err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			wg.Wait()
+		})
+	}
+}
+
+// Compact forces compactions of the LSM tree with Flatten until all tables are in one level. Compactions drop
+// deleted and overwritten keys and collect statistics of stale values, which the value log GC needs to pick files.
+// It is a heavy operation intended for maintenance, for example after pruning of the trie followed by RunGC
+func (a *DB) Compact(workers int) error {
+	if workers <= 0 {
+		workers = 1
+	}
+	err := a.Flatten(workers)
+	if errors.Is(err, badger.ErrDBClosed) {
+		err = common.ErrDBUnavailable
+	}
+	return err
+}
+
+// DiskUsage returns size of the LSM tree and of the value log files on disk. Unlike badger's Size,
+// which is updated once per minute, sizes are read from the files. In-memory DB returns zero usage
+func (a *DB) DiskUsage() (DiskUsage, error) {
+	var ret DiskUsage
+	opts := a.Opts()
+	if opts.InMemory {
+		return ret, nil
+	}
+	dirs := []string{opts.Dir}
+	if opts.ValueDir != opts.Dir {
+		dirs = append(dirs, opts.ValueDir)
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return ret, err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			info, err := e.Info()
+			if errors.Is(err, os.ErrNotExist) {
+				// removed by the compaction or by the GC meanwhile
+				continue
+			}
+			if err != nil {
+				return ret, err
+			}
+			switch filepath.Ext(e.Name()) {
+			case ".sst":
+				ret.LSM += info.Size()
+			case ".vlog":
+				ret.ValueLog += info.Size()
+			}
+		}
+	}
+	return ret, nil
+}
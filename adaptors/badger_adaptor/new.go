@@ -33,7 +33,24 @@ func MustCreateOrOpenBadgerDB(dir string, opt ...badger.Options) *badger.DB {
 }
 
 func New(db *badger.DB) *DB {
-	return &DB{DB: db}
+	return &DB{DB: db, metrics: common.NoMetrics{}}
+}
+
+// SetMetrics sets the sink of metrics of the adaptor: number of gets, sets and duration of batch commits.
+// nil disables metrics
+func (a *DB) SetMetrics(m common.Metrics) {
+	if m == nil {
+		m = common.NoMetrics{}
+	}
+	a.metrics = m
+}
+
+// EnableWriteBatch makes batches to be committed with badger.WriteBatch instead of one transaction.
+// Batches of any size can be committed and large batches are written faster, however the batch is not atomic
+// anymore: if the commit fails or the process crashes, the batch may be written partially.
+// By default, the batch is committed in one transaction and fails with badger.ErrTxnTooBig if it is too large
+func (a *DB) EnableWriteBatch(enable bool) {
+	a.useWriteBatch = enable
 }
 
 // OpenBadgerDB opens existing Badger DB
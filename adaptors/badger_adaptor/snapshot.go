@@ -0,0 +1,77 @@
+package badger_adaptor
+
+import (
+	"github.com/dgraph-io/badger/v4"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// SnapshotReader reads the DB in one read-only badger transaction. It sees the consistent view of the DB as of
+// the moment it was created, regardless of the writes made after. The TrieReader created on it reads
+// the consistent state even while the DB is being written concurrently.
+// The snapshot pins old versions of the data in badger, so it must be released with Discard after use.
+// Like the badger transaction, SnapshotReader is not safe for concurrent use
+type SnapshotReader struct {
+	txn     *badger.Txn
+	metrics common.Metrics
+}
+
+var (
+	_ common.KVTraversableReader = &SnapshotReader{}
+	_ common.KVZeroCopyReader    = &SnapshotReader{}
+	_ common.KVBatchedReader     = &SnapshotReader{}
+)
+
+// ReaderAt returns the reader pinned to the current state of the DB
+func (a *DB) ReaderAt() *SnapshotReader {
+	return &SnapshotReader{
+		txn:     a.NewTransaction(false),
+		metrics: a.metrics,
+	}
+}
+
+// ReadTs returns the read timestamp of the snapshot
+func (s *SnapshotReader) ReadTs() uint64 {
+	return s.txn.ReadTs()
+}
+
+// Discard releases the snapshot. The reader can't be used after
+func (s *SnapshotReader) Discard() {
+	s.txn.Discard()
+}
+
+func (s *SnapshotReader) view(fn func(txn *badger.Txn) error) error {
+	return fn(s.txn)
+}
+
+func (s *SnapshotReader) Get(key []byte) []byte {
+	s.metrics.AddCounter(common.MetricStoreGets, 1)
+	return getValue(s.view, key)
+}
+
+func (s *SnapshotReader) GetMany(keys [][]byte) [][]byte {
+	s.metrics.AddCounter(common.MetricStoreGets, uint64(len(keys)))
+	return getValues(s.view, keys)
+}
+
+func (s *SnapshotReader) GetFunc(key []byte, f func(value []byte)) bool {
+	s.metrics.AddCounter(common.MetricStoreGets, 1)
+	return getValueFunc(s.view, key, f)
+}
+
+func (s *SnapshotReader) Has(key []byte) bool {
+	s.metrics.AddCounter(common.MetricStoreGets, 1)
+	return hasKey(s.view, key)
+}
+
+func (s *SnapshotReader) Iterator(prefix []byte) common.KVIterator {
+	return s.IteratorWithOpts(prefix, IteratorOpts{})
+}
+
+// IteratorWithOpts returns the iterator of the snapshot with options
+func (s *SnapshotReader) IteratorWithOpts(prefix []byte, opts IteratorOpts) common.KVIterator {
+	return &badgerAdaptorIterator{
+		view:   s.view,
+		prefix: prefix,
+		opts:   opts,
+	}
+}
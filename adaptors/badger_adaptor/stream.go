@@ -0,0 +1,132 @@
+package badger_adaptor
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/z"
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Backup and restore with the badger Stream framework. The Stream reads the consistent snapshot of the DB
+// concurrently by key ranges, which is much faster than the iteration key by key. The order of keys is
+// non-deterministic, as expected from common.KVStreamIterator
+
+type badgerStreamIterator struct {
+	db     *DB
+	prefix []byte
+}
+
+var (
+	_ common.KVStreamIterator = &badgerStreamIterator{}
+
+	errStreamStopped = errors.New("stream stopped")
+)
+
+// StreamIterator returns the iterator of all key/value pairs with the prefix, which reads the DB with
+// the badger Stream framework. Only the latest version of each key is read
+func (a *DB) StreamIterator(prefix []byte) common.KVStreamIterator {
+	return &badgerStreamIterator{
+		db:     a,
+		prefix: prefix,
+	}
+}
+
+// Backup writes all key/value pairs with the prefix to the stream writer. Nil prefix means the whole DB
+func (a *DB) Backup(prefix []byte, w common.KVStreamWriter) error {
+	var err error
+	errIter := a.StreamIterator(prefix).Iterate(func(k, v []byte) bool {
+		err = w.Write(k, v)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return errIter
+}
+
+// Restore writes all key/value pairs of the stream into the DB with badger.WriteBatch.
+// Like the batch written with WriteBatch, the restore is not atomic
+func (a *DB) Restore(iter common.KVStreamIterator) error {
+	wb := a.NewWriteBatch()
+	defer wb.Cancel()
+
+	var err error
+	errIter := iter.Iterate(func(k, v []byte) bool {
+		if len(v) == 0 {
+			return true
+		}
+		// the stream may reuse buffers after the call
+		err = wb.Set(common.Concat(k), common.Concat(v))
+		return err == nil
+	})
+	if err == nil {
+		err = errIter
+	}
+	if err == nil {
+		err = wb.Flush()
+	}
+	if errors.Is(err, badger.ErrDBClosed) {
+		err = common.ErrDBUnavailable
+	}
+	return err
+}
+
+// Iterate calls fun for each key/value pair. Calls of fun are serialized
+func (it *badgerStreamIterator) Iterate(fun func(k, v []byte) bool) error {
+	st := it.db.NewStream()
+	st.Prefix = it.prefix
+	st.LogPrefix = "unitrie.StreamIterator"
+
+	// KeyToList is called concurrently. The Stream framework only logs its errors, so the first one is kept
+	var mutex sync.Mutex
+	var readErr error
+	st.KeyToList = func(key []byte, itr *badger.Iterator) (*pb.KVList, error) {
+		item := itr.Item()
+		if item.IsDeletedOrExpired() {
+			return nil, nil
+		}
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			mutex.Lock()
+			if readErr == nil {
+				readErr = err
+			}
+			mutex.Unlock()
+			return nil, err
+		}
+		return &pb.KVList{Kv: []*pb.KV{{Key: key, Value: value}}}, nil
+	}
+	stopped := false
+	st.Send = func(buf *z.Buffer) error {
+		list, err := badger.BufferToKVList(buf)
+		if err != nil {
+			return err
+		}
+		for _, kv := range list.Kv {
+			if kv.StreamDone {
+				continue
+			}
+			if !fun(kv.Key, kv.Value) {
+				stopped = true
+				return errStreamStopped
+			}
+		}
+		return nil
+	}
+	err := st.Orchestrate(context.Background())
+	if stopped {
+		// depending on the timing, Orchestrate returns errStreamStopped or the error of the cancelled producers
+		return nil
+	}
+	if err == nil {
+		err = readErr
+	}
+	if errors.Is(err, badger.ErrDBClosed) {
+		err = common.ErrDBUnavailable
+	}
+	return err
+}
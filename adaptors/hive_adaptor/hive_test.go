@@ -0,0 +1,118 @@
+package hive_adaptor
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+// types with the same shape as in hive.go kvstore package
+type (
+	Key                          []byte
+	Value                        []byte
+	KeyPrefix                    []byte
+	IteratorKeyValueConsumerFunc func(key Key, value Value) bool
+	IteratorKeyConsumerFunc      func(key Key) bool
+	IterDirection                byte
+
+	HiveBatchedMutations interface {
+		Set(key Key, value Value) error
+		Delete(key Key) error
+		Cancel()
+		Commit() error
+	}
+)
+
+var errKeyNotFound = errors.New("key not found")
+
+// fakeHiveStore is a hive.go-like store, built from the Store view of the in-memory store
+type fakeHiveStore struct {
+	*Store[Key, Value, KeyPrefix, IteratorKeyValueConsumerFunc, IteratorKeyConsumerFunc, IterDirection]
+	mem *common.InMemoryKVStore
+}
+
+type fakeBatch struct {
+	mem *common.InMemoryKVStore
+	mut *common.Mutations
+}
+
+func (f *fakeHiveStore) Batched() (HiveBatchedMutations, error) {
+	return &fakeBatch{mem: f.mem, mut: common.NewMutations()}, nil
+}
+
+func (b *fakeBatch) Set(key Key, value Value) error {
+	b.mut.Set(key, value)
+	return nil
+}
+
+func (b *fakeBatch) Delete(key Key) error {
+	b.mut.Set(key, nil)
+	return nil
+}
+
+func (b *fakeBatch) Cancel() {}
+
+func (b *fakeBatch) Commit() error {
+	b.mut.WriteTo(b.mem)
+	return nil
+}
+
+func newFakeHiveStore() *fakeHiveStore {
+	mem := common.NewInMemoryKVStore()
+	return &fakeHiveStore{
+		Store: NewStore[Key, Value, KeyPrefix, IteratorKeyValueConsumerFunc, IteratorKeyConsumerFunc, IterDirection](mem, errKeyNotFound),
+		mem:   mem,
+	}
+}
+
+func TestHiveAdaptor(t *testing.T) {
+	hive := newFakeHiveStore()
+	db := New[Key, Value, KeyPrefix, IteratorKeyValueConsumerFunc, IteratorKeyConsumerFunc, IterDirection, HiveBatchedMutations](hive)
+
+	var _ common.KVStore = db
+	var _ common.Traversable = db
+	var _ common.BatchedUpdatable = db
+
+	_, err := hive.Get(Key("a"))
+	require.True(t, errors.Is(err, errKeyNotFound))
+	require.Nil(t, db.Get([]byte("a")))
+
+	db.Set([]byte("a"), []byte("1"))
+	require.EqualValues(t, "1", string(db.Get([]byte("a"))))
+	v, err := hive.Get(Key("a"))
+	require.NoError(t, err)
+	require.EqualValues(t, "1", string(v))
+	db.Set([]byte("a"), nil)
+	require.False(t, db.Has([]byte("a")))
+
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	root := immutable.MustInitRoot(db, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, db, root)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		tr.UpdateStr(fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+	batch := db.BatchedWriter()
+	root = tr.Commit(batch)
+	require.NoError(t, batch.Commit())
+
+	trr, err := immutable.NewTrieReader(m, db, root)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.EqualValues(t, fmt.Sprintf("v%d", i), trr.GetStr(fmt.Sprintf("k%d", i)))
+	}
+	count := 0
+	db.Iterator([]byte{immutable.PartitionTrieNodes}).IterateKeys(func(_ []byte) bool {
+		count++
+		return true
+	})
+	require.True(t, count > 100)
+
+	require.NoError(t, hive.DeletePrefix(KeyPrefix{immutable.PartitionTrieNodes}))
+	require.EqualValues(t, 0, hive.mem.Len())
+}
@@ -0,0 +1,150 @@
+// Package hive_adaptor bridges unitrie key/value interfaces and the hive.go kvstore.KVStore interface.
+//
+// The package does not depend on hive.go. Instead, it mirrors the subset of the hive.go interface it uses,
+// parametrized by the hive.go types. Any hive.go kvstore.KVStore satisfies KVStore instantiated with
+// kvstore.Key, kvstore.Value, kvstore.KeyPrefix, kvstore.IteratorKeyValueConsumerFunc,
+// kvstore.IteratorKeyConsumerFunc, kvstore.IterDirection and kvstore.BatchedMutations. For example:
+//
+//	type HiveDB = hive_adaptor.DB[kvstore.Key, kvstore.Value, kvstore.KeyPrefix,
+//		kvstore.IteratorKeyValueConsumerFunc, kvstore.IteratorKeyConsumerFunc,
+//		kvstore.IterDirection, kvstore.BatchedMutations]
+//
+//	db := hive_adaptor.New[kvstore.Key, kvstore.Value, kvstore.KeyPrefix,
+//		kvstore.IteratorKeyValueConsumerFunc, kvstore.IteratorKeyConsumerFunc,
+//		kvstore.IterDirection, kvstore.BatchedMutations](hiveStore)
+package hive_adaptor
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+type (
+	// BatchedMutations mirrors hive.go kvstore.BatchedMutations
+	BatchedMutations[K ~[]byte, V ~[]byte] interface {
+		Set(key K, value V) error
+		Delete(key K) error
+		Cancel()
+		Commit() error
+	}
+
+	// KVStore mirrors the subset of hive.go kvstore.KVStore used by the adaptor
+	KVStore[K ~[]byte, V ~[]byte, P ~[]byte, KVF ~func(K, V) bool, KF ~func(K) bool, D any, B BatchedMutations[K, V]] interface {
+		Get(key K) (V, error)
+		Set(key K, value V) error
+		Has(key K) (bool, error)
+		Delete(key K) error
+		Iterate(prefix P, kvConsumerFunc KVF, direction ...D) error
+		IterateKeys(prefix P, consumerFunc KF, direction ...D) error
+		Batched() (B, error)
+	}
+
+	// DB implements unitrie common.KVStore, common.Traversable and common.BatchedUpdatable on top of hive.go store
+	DB[K ~[]byte, V ~[]byte, P ~[]byte, KVF ~func(K, V) bool, KF ~func(K) bool, D any, B BatchedMutations[K, V]] struct {
+		store KVStore[K, V, P, KVF, KF, D, B]
+	}
+
+	hiveBatch[K ~[]byte, V ~[]byte] struct {
+		batch BatchedMutations[K, V]
+		err   error
+	}
+
+	hiveIterator[K ~[]byte, V ~[]byte, P ~[]byte, KVF ~func(K, V) bool, KF ~func(K) bool, D any, B BatchedMutations[K, V]] struct {
+		store  KVStore[K, V, P, KVF, KF, D, B]
+		prefix []byte
+	}
+)
+
+func New[K ~[]byte, V ~[]byte, P ~[]byte, KVF ~func(K, V) bool, KF ~func(K) bool, D any, B BatchedMutations[K, V]](store KVStore[K, V, P, KVF, KF, D, B]) *DB[K, V, P, KVF, KF, D, B] {
+	return &DB[K, V, P, KVF, KF, D, B]{store: store}
+}
+
+// KVReader
+
+// Get returns nil if key is absent. hive.go returns an error for the absent key, so presence of the key
+// is checked when Get returns an error
+func (a *DB[K, V, P, KVF, KF, D, B]) Get(key []byte) []byte {
+	ret, err := a.store.Get(K(key))
+	if err != nil {
+		if !a.Has(key) {
+			return nil
+		}
+		common.AssertNoError(err)
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return []byte(ret)
+}
+
+func (a *DB[K, V, P, KVF, KF, D, B]) Has(key []byte) bool {
+	ret, err := a.store.Has(K(key))
+	common.AssertNoError(err)
+	return ret
+}
+
+// KVWriter
+
+func (a *DB[K, V, P, KVF, KF, D, B]) Set(key, value []byte) {
+	var err error
+	if len(value) == 0 {
+		err = a.store.Delete(K(key))
+	} else {
+		err = a.store.Set(K(key), V(value))
+	}
+	common.AssertNoError(err)
+}
+
+// BatchedUpdatable
+
+func (a *DB[K, V, P, KVF, KF, D, B]) BatchedWriter() common.KVBatchedWriter {
+	batch, err := a.store.Batched()
+	common.AssertNoError(err)
+	return &hiveBatch[K, V]{batch: batch}
+}
+
+// KVBatchedWriter
+
+func (b *hiveBatch[K, V]) Set(key, value []byte) {
+	if b.err != nil {
+		return
+	}
+	if len(value) == 0 {
+		b.err = b.batch.Delete(K(key))
+	} else {
+		b.err = b.batch.Set(K(key), V(value))
+	}
+}
+
+// Commit commits the batch. If any of Set-s failed, the batch is cancelled and the error is returned
+func (b *hiveBatch[K, V]) Commit() error {
+	if b.err != nil {
+		b.batch.Cancel()
+		return b.err
+	}
+	return b.batch.Commit()
+}
+
+// Traversable
+
+func (a *DB[K, V, P, KVF, KF, D, B]) Iterator(prefix []byte) common.KVIterator {
+	return &hiveIterator[K, V, P, KVF, KF, D, B]{
+		store:  a.store,
+		prefix: prefix,
+	}
+}
+
+// KVIterator
+
+func (it *hiveIterator[K, V, P, KVF, KF, D, B]) Iterate(fun func(k []byte, v []byte) bool) {
+	err := it.store.Iterate(P(it.prefix), KVF(func(k K, v V) bool {
+		return fun([]byte(k), []byte(v))
+	}))
+	common.AssertNoError(err)
+}
+
+func (it *hiveIterator[K, V, P, KVF, KF, D, B]) IterateKeys(fun func(k []byte) bool) {
+	err := it.store.IterateKeys(P(it.prefix), KF(func(k K) bool {
+		return fun([]byte(k))
+	}))
+	common.AssertNoError(err)
+}
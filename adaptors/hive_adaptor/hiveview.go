@@ -0,0 +1,103 @@
+package hive_adaptor
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Store exposes unitrie store with the method signatures of the hive.go kvstore.KVStore data methods.
+// The realm and batched mutations methods of hive.go interface are not provided, because they refer to hive.go
+// types. To get full kvstore.KVStore, embed Store into the type which implements them.
+// Direction of iteration is ignored: the order of iteration is the order of the underlying store
+type Store[K ~[]byte, V ~[]byte, P ~[]byte, KVF ~func(K, V) bool, KF ~func(K) bool, D any] struct {
+	store          common.KVTraversableStore
+	errKeyNotFound error
+}
+
+// NewStore creates hive.go-like view of the unitrie store. Parameter errKeyNotFound is returned by Get for
+// absent keys, normally it is kvstore.ErrKeyNotFound
+func NewStore[K ~[]byte, V ~[]byte, P ~[]byte, KVF ~func(K, V) bool, KF ~func(K) bool, D any](store common.KVTraversableStore, errKeyNotFound error) *Store[K, V, P, KVF, KF, D] {
+	return &Store[K, V, P, KVF, KF, D]{
+		store:          store,
+		errKeyNotFound: errKeyNotFound,
+	}
+}
+
+func (s *Store[K, V, P, KVF, KF, D]) Get(key K) (V, error) {
+	var ret []byte
+	err := common.CatchPanicOrError(func() error {
+		ret = s.store.Get([]byte(key))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, s.errKeyNotFound
+	}
+	return V(ret), nil
+}
+
+func (s *Store[K, V, P, KVF, KF, D]) Set(key K, value V) error {
+	return common.CatchPanicOrError(func() error {
+		s.store.Set([]byte(key), []byte(value))
+		return nil
+	})
+}
+
+func (s *Store[K, V, P, KVF, KF, D]) Has(key K) (bool, error) {
+	var ret bool
+	err := common.CatchPanicOrError(func() error {
+		ret = s.store.Has([]byte(key))
+		return nil
+	})
+	return ret, err
+}
+
+func (s *Store[K, V, P, KVF, KF, D]) Delete(key K) error {
+	return common.CatchPanicOrError(func() error {
+		s.store.Set([]byte(key), nil)
+		return nil
+	})
+}
+
+func (s *Store[K, V, P, KVF, KF, D]) DeletePrefix(prefix P) error {
+	return common.CatchPanicOrError(func() error {
+		keys := make([][]byte, 0)
+		s.store.Iterator([]byte(prefix)).IterateKeys(func(k []byte) bool {
+			keys = append(keys, common.Concat(k))
+			return true
+		})
+		for _, k := range keys {
+			s.store.Set(k, nil)
+		}
+		return nil
+	})
+}
+
+func (s *Store[K, V, P, KVF, KF, D]) Iterate(prefix P, kvConsumerFunc KVF, _ ...D) error {
+	return common.CatchPanicOrError(func() error {
+		s.store.Iterator([]byte(prefix)).Iterate(func(k, v []byte) bool {
+			return kvConsumerFunc(K(k), V(v))
+		})
+		return nil
+	})
+}
+
+func (s *Store[K, V, P, KVF, KF, D]) IterateKeys(prefix P, consumerFunc KF, _ ...D) error {
+	return common.CatchPanicOrError(func() error {
+		s.store.Iterator([]byte(prefix)).IterateKeys(func(k []byte) bool {
+			return consumerFunc(K(k))
+		})
+		return nil
+	})
+}
+
+// Flush does nothing: the unitrie store is written synchronously
+func (s *Store[K, V, P, KVF, KF, D]) Flush() error {
+	return nil
+}
+
+// Close does nothing: the unitrie store is owned by the caller
+func (s *Store[K, V, P, KVF, KF, D]) Close() error {
+	return nil
+}
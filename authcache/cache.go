@@ -0,0 +1,248 @@
+// Package authcache implements bounded key/value cache with LRU eviction policy on top of the trie.
+// All the cache state, including the LRU metadata, is kept in the trie, so every operation of the cache is
+// a transition between two roots and each eviction can be proven to the third party: the evicted entry
+// was the least recently used one and the cache was full.
+//
+// The LRU order is kept in the trie as a doubly linked list of cache keys.
+// Each operation which changes the state of the cache (Put, Get of the existing key) is committed immediately
+package authcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+)
+
+// trie keys of the cache state
+const (
+	prefixEntry = byte('e') // 'e' + key -> value
+	prefixPrev  = byte('p') // 'p' + key -> key of the previous (less recently used) entry
+	prefixNext  = byte('x') // 'x' + key -> key of the next (more recently used) entry
+	keyHead     = "h"       // the least recently used key
+	keyTail     = "t"       // the most recently used key
+	keyCapacity = "m"       // maximum number of entries
+	keySize     = "n"       // current number of entries
+)
+
+const identity = "authenticated LRU cache"
+
+var (
+	ErrEmptyKey        = errors.New("authcache: key can't be empty")
+	ErrEmptyValue      = errors.New("authcache: value can't be empty")
+	ErrNotCacheRoot    = errors.New("authcache: root does not contain cache state")
+	ErrWrongCapacity   = errors.New("authcache: capacity must be positive")
+	ErrWrongCacheState = errors.New("authcache: inconsistent cache state")
+)
+
+// Cache is the authenticated LRU cache. It is not thread safe
+type Cache struct {
+	model    *trie_blake2b.CommitmentModel
+	trie     *immutable.TrieChained
+	capacity uint64
+}
+
+// InitRoot creates an empty cache with the capacity in the store and returns its root
+func InitRoot(store common.KVStore, model *trie_blake2b.CommitmentModel, capacity int) (common.VCommitment, error) {
+	if capacity <= 0 {
+		return nil, ErrWrongCapacity
+	}
+	root := immutable.MustInitRoot(store, model, []byte(identity))
+	tr, err := immutable.NewTrieUpdatable(model, store, root)
+	if err != nil {
+		return nil, err
+	}
+	tr.Update([]byte(keyCapacity), uint64Bytes(uint64(capacity)))
+	tr.Update([]byte(keySize), uint64Bytes(0))
+	return tr.Commit(store), nil
+}
+
+// Open opens the cache at the root
+func Open(store common.KVStore, model *trie_blake2b.CommitmentModel, root common.VCommitment) (*Cache, error) {
+	tr, err := immutable.NewTrieChained(model, store, root)
+	if err != nil {
+		return nil, err
+	}
+	capacity, ok := readUint64(tr.TrieReader, keyCapacity)
+	if !ok || capacity == 0 {
+		return nil, ErrNotCacheRoot
+	}
+	return &Cache{
+		model:    model,
+		trie:     tr,
+		capacity: capacity,
+	}, nil
+}
+
+// Root current root of the cache
+func (c *Cache) Root() common.VCommitment {
+	return c.trie.Root()
+}
+
+// Capacity maximum number of entries in the cache
+func (c *Cache) Capacity() int {
+	return int(c.capacity)
+}
+
+// Len current number of entries in the cache
+func (c *Cache) Len() int {
+	ret, _ := readUint64(c.trie.TrieReader, keySize)
+	return int(ret)
+}
+
+// Peek returns the value without changing the LRU order
+func (c *Cache) Peek(key []byte) ([]byte, bool) {
+	if len(key) == 0 {
+		return nil, false
+	}
+	ret := c.trie.Get(common.Concat(prefixEntry, key))
+	return ret, len(ret) > 0
+}
+
+// Get returns the value and makes the entry the most recently used one. The change of the order is committed
+func (c *Cache) Get(key []byte) ([]byte, bool) {
+	ret, found := c.Peek(key)
+	if !found {
+		return nil, false
+	}
+	tx := c.newTx()
+	tx.unlink(key)
+	tx.appendTail(key)
+	tx.commit()
+	return ret, true
+}
+
+// Put puts the entry to the cache and makes it the most recently used one. If cache is full and the key is new,
+// the least recently used entry is evicted. The proof of the eviction is returned. It is valid against the root
+// before the Put. The change is committed
+func (c *Cache) Put(key, value []byte) (*EvictionProof, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	if len(value) == 0 {
+		return nil, ErrEmptyValue
+	}
+	var proof *EvictionProof
+	tx := c.newTx()
+	if _, exists := c.Peek(key); exists {
+		tx.unlink(key)
+	} else {
+		size, _ := tx.getUint64(keySize)
+		if size >= c.capacity {
+			head := tx.get([]byte(keyHead))
+			if len(head) == 0 {
+				return nil, ErrWrongCacheState
+			}
+			proof = c.proveEviction(head)
+			tx.unlink(head)
+			tx.set(common.Concat(prefixEntry, head), nil)
+			size--
+		}
+		tx.set([]byte(keySize), uint64Bytes(size+1))
+	}
+	tx.set(common.Concat(prefixEntry, key), value)
+	tx.appendTail(key)
+	tx.commit()
+	return proof, nil
+}
+
+// Iterate iterates entries from the least recently used to the most recently used
+func (c *Cache) Iterate(fun func(key, value []byte) bool) {
+	for key := c.trie.Get([]byte(keyHead)); len(key) > 0; key = c.trie.Get(common.Concat(prefixNext, key)) {
+		if !fun(key, c.trie.Get(common.Concat(prefixEntry, key))) {
+			return
+		}
+	}
+}
+
+// tx collects changes of one operation. The trie is read at the persistent root,
+// so the reads must see changes made by the same operation
+type tx struct {
+	c       *Cache
+	changes map[string][]byte
+}
+
+func (c *Cache) newTx() *tx {
+	return &tx{
+		c:       c,
+		changes: make(map[string][]byte),
+	}
+}
+
+func (t *tx) get(key []byte) []byte {
+	if v, ok := t.changes[string(key)]; ok {
+		return v
+	}
+	return t.c.trie.Get(key)
+}
+
+func (t *tx) getUint64(key string) (uint64, bool) {
+	data := t.get([]byte(key))
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+func (t *tx) set(key, value []byte) {
+	t.changes[string(key)] = value
+}
+
+// unlink removes key from the linked list
+func (t *tx) unlink(key []byte) {
+	prev := t.get(common.Concat(prefixPrev, key))
+	next := t.get(common.Concat(prefixNext, key))
+	if len(prev) > 0 {
+		t.set(common.Concat(prefixNext, prev), next)
+	} else {
+		t.set([]byte(keyHead), next)
+	}
+	if len(next) > 0 {
+		t.set(common.Concat(prefixPrev, next), prev)
+	} else {
+		t.set([]byte(keyTail), prev)
+	}
+	t.set(common.Concat(prefixPrev, key), nil)
+	t.set(common.Concat(prefixNext, key), nil)
+}
+
+// appendTail makes the key the most recently used
+func (t *tx) appendTail(key []byte) {
+	tail := t.get([]byte(keyTail))
+	if len(tail) > 0 {
+		t.set(common.Concat(prefixNext, tail), key)
+		t.set(common.Concat(prefixPrev, key), tail)
+	} else {
+		t.set([]byte(keyHead), key)
+	}
+	t.set([]byte(keyTail), key)
+}
+
+func (t *tx) commit() {
+	// the root does not depend on the order of updates
+	for k, v := range t.changes {
+		t.c.trie.Update([]byte(k), v)
+	}
+	t.c.trie.CommitChained()
+}
+
+func uint64Bytes(v uint64) []byte {
+	var ret [8]byte
+	binary.BigEndian.PutUint64(ret[:], v)
+	return ret[:]
+}
+
+func readUint64(tr *immutable.TrieReader, key string) (uint64, bool) {
+	data := tr.Get([]byte(key))
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+func (c *Cache) String() string {
+	return fmt.Sprintf("authcache(capacity: %d, len: %d, root: %s)", c.capacity, c.Len(), c.Root())
+}
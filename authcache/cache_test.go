@@ -0,0 +1,71 @@
+package authcache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root, err := InitRoot(store, m, 3)
+			require.NoError(t, err)
+			c, err := Open(store, m, root)
+			require.NoError(t, err)
+			require.EqualValues(t, 3, c.Capacity())
+			require.EqualValues(t, 0, c.Len())
+
+			for i := 0; i < 3; i++ {
+				p, err := c.Put([]byte(fmt.Sprintf("k%d", i)), []byte(fmt.Sprintf("v%d", i)))
+				require.NoError(t, err)
+				require.Nil(t, p)
+			}
+			require.EqualValues(t, 3, c.Len())
+			// k0 becomes the most recently used, k1 is the least recently used
+			v, found := c.Get([]byte("k0"))
+			require.True(t, found)
+			require.EqualValues(t, "v0", string(v))
+
+			before := c.Root()
+			p, err := c.Put([]byte("k3"), []byte("v3"))
+			require.NoError(t, err)
+			require.NotNil(t, p)
+			require.EqualValues(t, "k1", string(p.Key))
+			require.NoError(t, VerifyEviction(m, before.Bytes(), p))
+			require.Error(t, VerifyEviction(m, c.Root().Bytes(), p))
+			p.Key = []byte("k2")
+			require.Error(t, VerifyEviction(m, before.Bytes(), p))
+
+			require.EqualValues(t, 3, c.Len())
+			_, found = c.Peek([]byte("k1"))
+			require.False(t, found)
+
+			order := make([]string, 0)
+			c.Iterate(func(k, v []byte) bool {
+				order = append(order, string(k)+"="+string(v))
+				return true
+			})
+			require.EqualValues(t, []string{"k2=v2", "k0=v0", "k3=v3"}, order)
+
+			// update of existing key does not evict
+			p, err = c.Put([]byte("k2"), []byte("v22"))
+			require.NoError(t, err)
+			require.Nil(t, p)
+
+			c1, err := Open(store, m, c.Root())
+			require.NoError(t, err)
+			order = order[:0]
+			c1.Iterate(func(k, v []byte) bool {
+				order = append(order, string(k)+"="+string(v))
+				return true
+			})
+			require.EqualValues(t, []string{"k0=v0", "k3=v3", "k2=v22"}, order)
+		})
+	}
+}
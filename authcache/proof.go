@@ -0,0 +1,71 @@
+package authcache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b/trie_blake2b_verify"
+)
+
+// EvictionProof proves that the evicted key was the least recently used entry of the full cache
+// in the state before the eviction
+type EvictionProof struct {
+	// Key evicted key
+	Key []byte
+	// Head proof of the head of the LRU list. It must commit to the Key
+	Head *trie_blake2b.MerkleProof
+	// Size and Capacity current number of entries and capacity of the cache. Size must be equal to capacity
+	Size     []byte
+	Capacity []byte
+	// SizeProof and CapacityProof proofs of Size and Capacity
+	SizeProof     *trie_blake2b.MerkleProof
+	CapacityProof *trie_blake2b.MerkleProof
+}
+
+func (c *Cache) proveEviction(head []byte) *EvictionProof {
+	size, _ := readUint64(c.trie.TrieReader, keySize)
+	return &EvictionProof{
+		Key:           common.Concat(head),
+		Head:          c.model.ProofImmutable([]byte(keyHead), c.trie.TrieReader),
+		Size:          uint64Bytes(size),
+		Capacity:      uint64Bytes(c.capacity),
+		SizeProof:     c.model.ProofImmutable([]byte(keySize), c.trie.TrieReader),
+		CapacityProof: c.model.ProofImmutable([]byte(keyCapacity), c.trie.TrieReader),
+	}
+}
+
+// VerifyEviction verifies the eviction proof against the root of the cache before the eviction
+func VerifyEviction(model *trie_blake2b.CommitmentModel, rootBytes []byte, p *EvictionProof) error {
+	if len(p.Key) == 0 {
+		return fmt.Errorf("%w: evicted key is empty", ErrWrongCacheState)
+	}
+	if len(p.Size) != 8 || !bytes.Equal(p.Size, p.Capacity) {
+		return fmt.Errorf("%w: cache was not full", ErrWrongCacheState)
+	}
+	if binary.BigEndian.Uint64(p.Capacity) == 0 {
+		return fmt.Errorf("%w: zero capacity", ErrWrongCacheState)
+	}
+	if err := verifyKeyValue(model, rootBytes, p.Head, keyHead, p.Key); err != nil {
+		return fmt.Errorf("head: %w", err)
+	}
+	if err := verifyKeyValue(model, rootBytes, p.SizeProof, keySize, p.Size); err != nil {
+		return fmt.Errorf("size: %w", err)
+	}
+	if err := verifyKeyValue(model, rootBytes, p.CapacityProof, keyCapacity, p.Capacity); err != nil {
+		return fmt.Errorf("capacity: %w", err)
+	}
+	return nil
+}
+
+func verifyKeyValue(model *trie_blake2b.CommitmentModel, rootBytes []byte, p *trie_blake2b.MerkleProof, key string, value []byte) error {
+	if p == nil {
+		return fmt.Errorf("proof is missing")
+	}
+	if !bytes.Equal(p.Key, common.UnpackBytes([]byte(key), model.PathArity())) {
+		return fmt.Errorf("proof is about the wrong key")
+	}
+	return trie_blake2b_verify.ValidateWithTerminal(p, rootBytes, model.CommitToData(value).Bytes())
+}
@@ -0,0 +1,136 @@
+// the program kzgsetup generates, updates and verifies trusted setups for the KZG commitment model
+// Usage: kzgsetup <command> [flags]
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lunfardo314/unitrie/models/trie_kzg_bn256"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"golang.org/x/crypto/blake2b"
+)
+
+const usage = `Usage: kzgsetup <command> [flags]
+Commands:
+    gen       generate new trusted setup from the random secret
+    update    add random secret on top of the existing trusted setup (multi-party setup)
+    verify    verify consistency of the trusted setup file
+Run 'kzgsetup <command> -h' for the flags of the command
+`
+
+// defaultD is the degree of the trusted setup used by the KZG commitment model
+const defaultD = 258
+
+var suite = bn256.NewSuite()
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "gen":
+		err = runGen(os.Args[2:])
+	case "update":
+		err = runUpdate(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runGen(args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	d := fs.Uint("d", defaultD, "degree of the trusted setup")
+	natural := fs.Bool("natural", false, "use domain 0, 1, ..., d-1 instead of powers of the root of unity")
+	out := fs.String("o", "", "output file (required)")
+	_ = fs.Parse(args)
+	if *out == "" || *d < 2 || *d > trie_kzg_bn256.FACTOR {
+		fs.Usage()
+		return fmt.Errorf("wrong flags")
+	}
+	ts, err := trie_kzg_bn256.GenerateTrustedSetup(suite, uint16(*d), *natural)
+	if err != nil {
+		return err
+	}
+	return writeSetup(ts, *out)
+}
+
+func runUpdate(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	in := fs.String("i", "", "input file with the trusted setup (required)")
+	out := fs.String("o", "", "output file (required)")
+	_ = fs.Parse(args)
+	if *in == "" || *out == "" {
+		fs.Usage()
+		return fmt.Errorf("wrong flags")
+	}
+	ts, err := readSetup(*in)
+	if err != nil {
+		return err
+	}
+	ts, err = trie_kzg_bn256.UpdateTrustedSetupRandom(ts)
+	if err != nil {
+		return err
+	}
+	return writeSetup(ts, *out)
+}
+
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	in := fs.String("i", "", "input file with the trusted setup (required)")
+	_ = fs.Parse(args)
+	if *in == "" {
+		fs.Usage()
+		return fmt.Errorf("wrong flags")
+	}
+	ts, err := readSetup(*in)
+	if err != nil {
+		return err
+	}
+	printSetup(ts, *in)
+	return nil
+}
+
+func readSetup(fname string) (*trie_kzg_bn256.TrustedSetup, error) {
+	ts, err := trie_kzg_bn256.TrustedSetupFromFile(suite, fname)
+	if err != nil {
+		return nil, fmt.Errorf("reading trusted setup from '%s': %w", fname, err)
+	}
+	if err = ts.Verify(); err != nil {
+		return nil, fmt.Errorf("verifying trusted setup from '%s': %w", fname, err)
+	}
+	return ts, nil
+}
+
+func writeSetup(ts *trie_kzg_bn256.TrustedSetup, fname string) error {
+	if err := os.WriteFile(fname, ts.Bytes(), 0600); err != nil {
+		return err
+	}
+	// read back and verify
+	ts, err := readSetup(fname)
+	if err != nil {
+		return err
+	}
+	printSetup(ts, fname)
+	return nil
+}
+
+func printSetup(ts *trie_kzg_bn256.TrustedSetup, fname string) {
+	domain := "powers of omega"
+	if ts.Omega.Equal(ts.ZeroG1) {
+		domain = "natural"
+	}
+	h := blake2b.Sum256(ts.Bytes())
+	fmt.Printf("trusted setup '%s': OK\n    D = %d\n    domain: %s\n    hash: %s\n", fname, ts.D, domain, hex.EncodeToString(h[:]))
+}
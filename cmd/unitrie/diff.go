@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/lunfardo314/unitrie/adaptors/badger_adaptor"
+	"github.com/lunfardo314/unitrie/immutable"
+)
+
+type (
+	diffValue struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+
+	diffChange struct {
+		Key      string `json:"key"`
+		OldValue string `json:"old"`
+		NewValue string `json:"new"`
+	}
+
+	diffReport struct {
+		RootA     string       `json:"rootA"`
+		RootB     string       `json:"rootB"`
+		Prefix    string       `json:"prefix,omitempty"`
+		Added     []diffValue  `json:"added"`
+		Removed   []diffValue  `json:"removed"`
+		Changed   []diffChange `json:"changed"`
+		Truncated bool         `json:"truncated"`
+	}
+)
+
+// runDiff: unitrie diff -db <dir> [-prefix <hex>] [-limit <n>] [-keys-only] <rootA> <rootB>
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	var mf modelFlags
+	mf.register(fs)
+	dbDir := fs.String("db", "", "directory of the Badger database")
+	prefixHex := fs.String("prefix", "", "compare only keys with the prefix (hex)")
+	limit := fs.Int("limit", 1000, "maximum number of differences to report. 0 means unlimited")
+	keysOnly := fs.Bool("keys-only", false, "do not report values")
+	_ = fs.Parse(args)
+
+	if *dbDir == "" || fs.NArg() != 2 {
+		return errors.New("usage: unitrie diff -db <dir> [flags] <rootA> <rootB>")
+	}
+	m, err := mf.commitmentModel()
+	if err != nil {
+		return err
+	}
+	rootA, err := parseRoot(m, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	rootB, err := parseRoot(m, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	prefix, err := hex.DecodeString(strings.TrimPrefix(*prefixHex, "0x"))
+	if err != nil {
+		return err
+	}
+	db, err := badger_adaptor.OpenBadgerDB(*dbDir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+	store := badger_adaptor.New(db)
+
+	trA, err := immutable.NewTrieReader(m, store, rootA)
+	if err != nil {
+		return err
+	}
+	trB, err := immutable.NewTrieReader(m, store, rootB)
+	if err != nil {
+		return err
+	}
+	report := diffReport{
+		RootA:   rootA.String(),
+		RootB:   rootB.String(),
+		Prefix:  hex.EncodeToString(prefix),
+		Added:   make([]diffValue, 0),
+		Removed: make([]diffValue, 0),
+		Changed: make([]diffChange, 0),
+	}
+	encodeValue := func(v []byte) string {
+		if *keysOnly {
+			return ""
+		}
+		return hex.EncodeToString(v)
+	}
+	count := 0
+	immutable.DiffPrefix(trA, trB, prefix, func(key, valueA, valueB []byte) bool {
+		if *limit > 0 && count >= *limit {
+			report.Truncated = true
+			return false
+		}
+		count++
+		switch {
+		case len(valueA) == 0:
+			report.Added = append(report.Added, diffValue{Key: hex.EncodeToString(key), Value: encodeValue(valueB)})
+		case len(valueB) == 0:
+			report.Removed = append(report.Removed, diffValue{Key: hex.EncodeToString(key), Value: encodeValue(valueA)})
+		default:
+			report.Changed = append(report.Changed, diffChange{
+				Key:      hex.EncodeToString(key),
+				OldValue: encodeValue(valueA),
+				NewValue: encodeValue(valueB),
+			})
+		}
+		return true
+	})
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
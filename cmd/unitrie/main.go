@@ -0,0 +1,33 @@
+// the program unitrie is a command line tool for inspecting tries, committed in the Badger database
+// Usage: unitrie <command> [flags] [arguments]
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: unitrie <command> [flags] [arguments]
+Commands:
+    diff    compare two roots and report added, removed and changed keys as JSON
+Run 'unitrie <command> -h' for the flags of the command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "diff":
+		err = runDiff(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
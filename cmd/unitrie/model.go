@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_kzg_bn256"
+	"github.com/lunfardo314/unitrie/models/trie_mpt"
+)
+
+// modelFlags are flags common to all commands, which select the commitment model
+type modelFlags struct {
+	model string
+	arity int
+	hash  int
+}
+
+func (f *modelFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.model, "model", "blake2b", "commitment model: 'blake2b', 'keccak', 'kzg', 'kzg-v2' or 'mpt'")
+	fs.IntVar(&f.arity, "arity", 16, "path arity of the blake2b and keccak models: 2, 4, 16 or 256")
+	fs.IntVar(&f.hash, "hash", 160, "hash size in bits of the blake2b model: 160, 192, 224 or 256")
+}
+
+func (f *modelFlags) commitmentModel() (common.CommitmentModel, error) {
+	switch f.model {
+	case "kzg":
+		return trie_kzg_bn256.New(), nil
+	case "kzg-v2":
+		return trie_kzg_bn256.NewV2(), nil
+	case "mpt":
+		return trie_mpt.New(), nil
+	case "blake2b", "keccak":
+	default:
+		return nil, fmt.Errorf("unknown commitment model '%s'", f.model)
+	}
+	var arity common.PathArity
+	switch f.arity {
+	case 2:
+		arity = common.PathArity2
+	case 4:
+		arity = common.PathArity4
+	case 16:
+		arity = common.PathArity16
+	case 256:
+		arity = common.PathArity256
+	default:
+		return nil, fmt.Errorf("wrong path arity %d", f.arity)
+	}
+	if f.model == "keccak" {
+		return trie_blake2b.NewKeccak256(arity), nil
+	}
+	var hashSize trie_blake2b.HashSize
+	switch f.hash {
+	case 160:
+		hashSize = trie_blake2b.HashSize160
+	case 192:
+		hashSize = trie_blake2b.HashSize192
+	case 224:
+		hashSize = trie_blake2b.HashSize224
+	case 256:
+		hashSize = trie_blake2b.HashSize256
+	default:
+		return nil, fmt.Errorf("wrong hash size %d", f.hash)
+	}
+	return trie_blake2b.New(arity, hashSize), nil
+}
+
+func parseRoot(m common.CommitmentModel, s string) (common.VCommitment, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("wrong root '%s': %w", s, err)
+	}
+	return common.VectorCommitmentFromBytes(m, data)
+}
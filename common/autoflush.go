@@ -0,0 +1,81 @@
+package common
+
+// AutoFlushWriter is a KVBatchedWriter which flushes the accumulated batch to the store when it exceeds
+// the limit of the size in bytes or of the number of mutations, and continues with the new batch transparently.
+// It allows writing of unlimited amounts of data, for example snapshot import, into the stores which limit size
+// of the transaction (like badger, which returns ErrTxnTooBig).
+// The whole sequence of writes is not atomic: only each flushed batch is. The first error of flush is kept,
+// the following writes are ignored and the error is returned by Commit
+type AutoFlushWriter struct {
+	store        BatchedUpdatable
+	maxBytes     int
+	maxMutations int
+	batch        KVBatchedWriter
+	bytes        int
+	mutations    int
+	flushes      int
+	err          error
+}
+
+var _ KVBatchedWriter = &AutoFlushWriter{}
+
+// NewAutoFlushWriter creates the writer with the limits of the batch. Limit 0 means no limit
+func NewAutoFlushWriter(store BatchedUpdatable, maxBytes, maxMutations int) *AutoFlushWriter {
+	Assertf(maxBytes >= 0 && maxMutations >= 0, "NewAutoFlushWriter: limits must be non-negative")
+	return &AutoFlushWriter{
+		store:        store,
+		maxBytes:     maxBytes,
+		maxMutations: maxMutations,
+	}
+}
+
+func (w *AutoFlushWriter) Set(key, value []byte) {
+	if w.err != nil {
+		return
+	}
+	size := len(key) + len(value)
+	if w.batch != nil && w.exceeds(size) {
+		w.err = w.flush()
+		if w.err != nil {
+			return
+		}
+	}
+	if w.batch == nil {
+		w.batch = w.store.BatchedWriter()
+	}
+	w.batch.Set(key, value)
+	w.bytes += size
+	w.mutations++
+}
+
+// Commit flushes the last batch. Returns the first error of flushes
+func (w *AutoFlushWriter) Commit() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.batch != nil {
+		w.err = w.flush()
+	}
+	return w.err
+}
+
+// Flushes returns number of batches flushed to the store
+func (w *AutoFlushWriter) Flushes() int {
+	return w.flushes
+}
+
+// exceeds checks if the batch exceeds the limits after adding the mutation of the size
+func (w *AutoFlushWriter) exceeds(size int) bool {
+	return (w.maxBytes > 0 && w.bytes+size > w.maxBytes) || (w.maxMutations > 0 && w.mutations+1 > w.maxMutations)
+}
+
+func (w *AutoFlushWriter) flush() error {
+	err := w.batch.Commit()
+	w.batch = nil
+	w.bytes = 0
+	w.mutations = 0
+	if err == nil {
+		w.flushes++
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failingBatchedStore struct {
+	*InMemoryKVStore
+	maxMutations int
+}
+
+type failingBatch struct {
+	store *failingBatchedStore
+	mut   *Mutations
+}
+
+var errTooBig = errors.New("transaction too big")
+
+func (s *failingBatchedStore) BatchedWriter() KVBatchedWriter {
+	return &failingBatch{store: s, mut: NewMutations()}
+}
+
+func (b *failingBatch) Set(key, value []byte) {
+	b.mut.Set(key, value)
+}
+
+func (b *failingBatch) Commit() error {
+	if b.mut.LenSet()+b.mut.LenDel() > b.store.maxMutations {
+		return errTooBig
+	}
+	b.mut.WriteTo(b.store.InMemoryKVStore)
+	return nil
+}
+
+func TestAutoFlushWriter(t *testing.T) {
+	store := &failingBatchedStore{InMemoryKVStore: NewInMemoryKVStore(), maxMutations: 100}
+
+	w := store.BatchedWriter()
+	for i := 0; i < 1000; i++ {
+		w.Set([]byte(fmt.Sprintf("key%d", i)), []byte("value"))
+	}
+	require.True(t, errors.Is(w.Commit(), errTooBig))
+
+	af := NewAutoFlushWriter(store, 0, 100)
+	for i := 0; i < 1000; i++ {
+		af.Set([]byte(fmt.Sprintf("key%d", i)), []byte("value"))
+	}
+	require.NoError(t, af.Commit())
+	require.EqualValues(t, 10, af.Flushes())
+	require.EqualValues(t, 1000, store.Len())
+
+	// limit by bytes: each mutation is 10 bytes, 10 fit into 100 bytes
+	store = &failingBatchedStore{InMemoryKVStore: NewInMemoryKVStore(), maxMutations: 10}
+	af = NewAutoFlushWriter(store, 100, 0)
+	for i := 0; i < 90; i++ {
+		af.Set([]byte(fmt.Sprintf("key%02d", i)), []byte("value"))
+	}
+	require.NoError(t, af.Commit())
+	require.EqualValues(t, 9, af.Flushes())
+	require.EqualValues(t, 90, store.Len())
+
+	// the error of flush is returned by Commit
+	store = &failingBatchedStore{InMemoryKVStore: NewInMemoryKVStore(), maxMutations: 5}
+	af = NewAutoFlushWriter(store, 0, 10)
+	for i := 0; i < 30; i++ {
+		af.Set([]byte(fmt.Sprintf("key%d", i)), []byte("value"))
+	}
+	require.True(t, errors.Is(af.Commit(), errTooBig))
+	require.EqualValues(t, 0, store.Len())
+}
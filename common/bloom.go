@@ -0,0 +1,129 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// BloomFilter is a compact probabilistic set of keys. MayContain never returns false for the added key,
+// but may return true for the key which was never added, with the configured false positive rate.
+// The bit positions are derived from the blake2b hash of the key with double hashing,
+// so the serialized filter can be interpreted by any party independently of this implementation
+type BloomFilter struct {
+	numHashes byte
+	numBits   uint32
+	bits      []byte
+}
+
+var errWrongBloomFilter = errors.New("wrong bloom filter data")
+
+// NewBloomFilter creates empty filter sized for the expected number of keys and the false positive rate
+func NewBloomFilter(expectedNumKeys int, falsePositiveRate float64) *BloomFilter {
+	Assertf(falsePositiveRate > 0 && falsePositiveRate < 1, "NewBloomFilter: false positive rate must be between 0 and 1")
+	if expectedNumKeys < 1 {
+		expectedNumKeys = 1
+	}
+	numBits := math.Ceil(-float64(expectedNumKeys) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	if numBits < 8 {
+		numBits = 8
+	}
+	Assertf(numBits <= math.MaxUint32, "NewBloomFilter: too many keys")
+	numHashes := math.Round(numBits / float64(expectedNumKeys) * math.Ln2)
+	switch {
+	case numHashes < 1:
+		numHashes = 1
+	case numHashes > 32:
+		numHashes = 32
+	}
+	return &BloomFilter{
+		numHashes: byte(numHashes),
+		numBits:   uint32(numBits),
+		bits:      make([]byte, (uint32(numBits)+7)/8),
+	}
+}
+
+func (b *BloomFilter) positions(key []byte, fun func(pos uint32)) {
+	h := blake2b.Sum256(key)
+	h1 := binary.LittleEndian.Uint64(h[0:8])
+	h2 := binary.LittleEndian.Uint64(h[8:16])
+	for i := uint64(0); i < uint64(b.numHashes); i++ {
+		fun(uint32((h1 + i*h2) % uint64(b.numBits)))
+	}
+}
+
+// Add adds key to the filter
+func (b *BloomFilter) Add(key []byte) {
+	b.positions(key, func(pos uint32) {
+		b.bits[pos/8] |= 0x1 << (pos % 8)
+	})
+}
+
+// MayContain returns false if key was never added to the filter. True means the key probably was added
+func (b *BloomFilter) MayContain(key []byte) bool {
+	ret := true
+	b.positions(key, func(pos uint32) {
+		if b.bits[pos/8]&(0x1<<(pos%8)) == 0 {
+			ret = false
+		}
+	})
+	return ret
+}
+
+// NumHashes return number of hash functions
+func (b *BloomFilter) NumHashes() int {
+	return int(b.numHashes)
+}
+
+// NumBits return size of the filter in bits
+func (b *BloomFilter) NumBits() int {
+	return int(b.numBits)
+}
+
+// Write serializes the filter: 1 byte number of hashes, 4 bytes number of bits and the bit array of (numBits+7)/8 bytes
+func (b *BloomFilter) Write(w io.Writer) error {
+	if err := WriteByte(w, b.numHashes); err != nil {
+		return err
+	}
+	if err := WriteUint32(w, b.numBits); err != nil {
+		return err
+	}
+	_, err := w.Write(b.bits)
+	return err
+}
+
+func (b *BloomFilter) Read(r io.Reader) error {
+	var err error
+	if b.numHashes, err = ReadByte(r); err != nil {
+		return err
+	}
+	if err = ReadUint32(r, &b.numBits); err != nil {
+		return err
+	}
+	if b.numHashes == 0 || b.numBits == 0 {
+		return errWrongBloomFilter
+	}
+	b.bits = make([]byte, (b.numBits+7)/8)
+	_, err = io.ReadFull(r, b.bits)
+	return err
+}
+
+func (b *BloomFilter) Bytes() []byte {
+	return MustBytes(b)
+}
+
+func BloomFilterFromBytes(data []byte) (*BloomFilter, error) {
+	ret := &BloomFilter{}
+	rdr := bytes.NewReader(data)
+	if err := ret.Read(rdr); err != nil {
+		return nil, err
+	}
+	if rdr.Len() != 0 {
+		return nil, ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
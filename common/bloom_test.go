@@ -0,0 +1,36 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilter(t *testing.T) {
+	const numKeys = 10000
+	const rate = 0.01
+	f := NewBloomFilter(numKeys, rate)
+	t.Logf("num bits: %d, num hashes: %d", f.NumBits(), f.NumHashes())
+	for i := 0; i < numKeys; i++ {
+		f.Add([]byte(fmt.Sprintf("key%d", i)))
+	}
+	f1, err := BloomFilterFromBytes(f.Bytes())
+	require.NoError(t, err)
+	require.EqualValues(t, f.Bytes(), f1.Bytes())
+
+	for i := 0; i < numKeys; i++ {
+		require.True(t, f1.MayContain([]byte(fmt.Sprintf("key%d", i))))
+	}
+	falsePositives := 0
+	for i := 0; i < numKeys; i++ {
+		if f1.MayContain([]byte(fmt.Sprintf("absent%d", i))) {
+			falsePositives++
+		}
+	}
+	t.Logf("false positives: %d out of %d", falsePositives, numKeys)
+	require.True(t, falsePositives < 3*numKeys*rate)
+
+	_, err = BloomFilterFromBytes(f.Bytes()[:10])
+	require.Error(t, err)
+}
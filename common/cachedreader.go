@@ -0,0 +1,167 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CachedReader is a read-through cache of the KVReader with LRU eviction. Size of the cache is limited by the
+// total size of keys and values in bytes. Present values are cached: it assumes that values in the underlying
+// reader do not change or that the changes are reported with Invalidate. Absence is never cached.
+// It can be used in front of slow readers (network, object storage) independently of the node cache of the trie.
+// CachedReader is safe for concurrent use
+type CachedReader struct {
+	r        KVReader
+	maxBytes int
+
+	mutex   sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	bytes   int
+	hits    int
+	misses  int
+}
+
+type cachedReaderEntry struct {
+	key   string
+	value []byte
+}
+
+// CachedReaderStats statistics of the CachedReader
+type CachedReaderStats struct {
+	Hits    int
+	Misses  int
+	Entries int
+	Bytes   int
+}
+
+var (
+	_ KVReader        = &CachedReader{}
+	_ KVBatchedReader = &CachedReader{}
+)
+
+// NewCachedReader creates the cache of the reader r with the maximum size in bytes of keys and values in the cache
+func NewCachedReader(r KVReader, maxBytes int) *CachedReader {
+	Assertf(maxBytes > 0, "NewCachedReader: maxBytes must be positive")
+	return &CachedReader{
+		r:        r,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *CachedReader) Get(key []byte) []byte {
+	if v, ok := c.getCached(key); ok {
+		return v
+	}
+	ret := c.r.Get(key)
+	if len(ret) > 0 {
+		c.putCached(key, ret)
+	}
+	return ret
+}
+
+// Has checks presence of the key in the cache or in the underlying reader. The value is not fetched
+func (c *CachedReader) Has(key []byte) bool {
+	if _, ok := c.getCached(key); ok {
+		return true
+	}
+	return c.r.Has(key)
+}
+
+// GetMany reads values which are not in the cache with one GetMany call to the underlying reader
+func (c *CachedReader) GetMany(keys [][]byte) [][]byte {
+	ret := make([][]byte, len(keys))
+	missing := make([]int, 0)
+	missingKeys := make([][]byte, 0)
+	for i, k := range keys {
+		if v, ok := c.getCached(k); ok {
+			ret[i] = v
+		} else {
+			missing = append(missing, i)
+			missingKeys = append(missingKeys, k)
+		}
+	}
+	if len(missing) == 0 {
+		return ret
+	}
+	for i, v := range GetMany(c.r, missingKeys) {
+		ret[missing[i]] = v
+		if len(v) > 0 {
+			c.putCached(missingKeys[i], v)
+		}
+	}
+	return ret
+}
+
+// Invalidate removes the key from the cache
+func (c *CachedReader) Invalidate(key []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.entries[string(key)]; ok {
+		c.remove(e)
+	}
+}
+
+// Reset removes all entries from the cache. Counters are not reset
+func (c *CachedReader) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+func (c *CachedReader) Stats() CachedReaderStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CachedReaderStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: c.lru.Len(),
+		Bytes:   c.bytes,
+	}
+}
+
+func (c *CachedReader) getCached(key []byte) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[string(key)]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(e)
+	return Concat(e.Value.(*cachedReaderEntry).value), true
+}
+
+func (c *CachedReader) putCached(key, value []byte) {
+	size := len(key) + len(value)
+	if size > c.maxBytes {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.entries[string(key)]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[string(key)] = c.lru.PushFront(&cachedReaderEntry{key: string(key), value: Concat(value)})
+	c.bytes += size
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *CachedReader) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*cachedReaderEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= len(entry.key) + len(entry.value)
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedReader(t *testing.T) {
+	store := NewInMemoryKVStore()
+	for i := 0; i < 100; i++ {
+		store.Set([]byte(fmt.Sprintf("key%02d", i)), []byte(fmt.Sprintf("value%02d", i)))
+	}
+	// each entry is 5 + 7 bytes, 10 entries fit
+	c := NewCachedReader(store, 120)
+	for i := 0; i < 10; i++ {
+		require.EqualValues(t, fmt.Sprintf("value%02d", i), string(c.Get([]byte(fmt.Sprintf("key%02d", i)))))
+	}
+	require.EqualValues(t, CachedReaderStats{Misses: 10, Entries: 10, Bytes: 120}, c.Stats())
+
+	// hits do not read from the store
+	store.Set([]byte("key05"), []byte("changed"))
+	require.EqualValues(t, "value05", string(c.Get([]byte("key05"))))
+	require.True(t, c.Has([]byte("key05")))
+	require.EqualValues(t, 2, c.Stats().Hits)
+
+	// absence is not cached
+	require.Nil(t, c.Get([]byte("absent")))
+	store.Set([]byte("absent"), []byte("present"))
+	require.EqualValues(t, "present", string(c.Get([]byte("absent"))))
+
+	// 13 bytes of the new entry evicted key00 and key01, the least recently used
+	st := c.Stats()
+	require.EqualValues(t, 9, st.Entries)
+	require.True(t, st.Bytes <= 120)
+	c.Get([]byte("key00"))
+	require.EqualValues(t, st.Misses+1, c.Stats().Misses)
+
+	c.Invalidate([]byte("key05"))
+	require.EqualValues(t, "changed", string(c.Get([]byte("key05"))))
+
+	values := c.GetMany([][]byte{[]byte("key05"), []byte("key50"), []byte("nokey")})
+	require.EqualValues(t, []string{"changed", "value50", ""}, []string{string(values[0]), string(values[1]), string(values[2])})
+
+	c.Reset()
+	require.EqualValues(t, 0, c.Stats().Entries)
+	require.EqualValues(t, 0, c.Stats().Bytes)
+}
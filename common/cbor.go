@@ -0,0 +1,235 @@
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+// Subset of the Concise Binary Object Representation (CBOR, RFC 8949): unsigned integers, byte strings, arrays,
+// maps and null. Encoding is always deterministic (RFC 8949, section 4.2.1): integers and lengths in the shortest
+// form, definite lengths only, keys of the map sorted by their encoding. The decoder only accepts
+// the deterministic encoding, so each value has exactly one valid encoding
+
+var (
+	ErrWrongCBOR       = errors.New("wrong or not deterministic CBOR encoding")
+	ErrUnsupportedCBOR = errors.New("unsupported CBOR data item")
+)
+
+type CBORKind byte
+
+const (
+	CBORUint = CBORKind(iota)
+	CBORBytes
+	CBORArray
+	CBORMap
+	CBORNull
+)
+
+const (
+	cborMajorUint  = 0
+	cborMajorBytes = 2
+	cborMajorArray = 4
+	cborMajorMap   = 5
+
+	// simple value null, major type 7
+	cborNull = 0xf6
+)
+
+// CBORItem is the decoded CBOR data item
+type CBORItem struct {
+	Kind  CBORKind
+	Uint  uint64
+	Bytes []byte
+	// Items of the array. For the map, keys and values interleaved
+	Items []*CBORItem
+}
+
+// CBOREncodeUint encodes unsigned integer
+func CBOREncodeUint(v uint64) []byte {
+	return cborHead(cborMajorUint, v)
+}
+
+// CBOREncodeBytes encodes byte string
+func CBOREncodeBytes(data []byte) []byte {
+	return append(cborHead(cborMajorBytes, uint64(len(data))), data...)
+}
+
+// CBOREncodeArray encodes array of already encoded items
+func CBOREncodeArray(items ...[]byte) []byte {
+	return append(cborHead(cborMajorArray, uint64(len(items))), bytes.Join(items, nil)...)
+}
+
+// CBOREncodeMap encodes map of already encoded keys and values. Pairs are sorted by the encoded keys.
+// Keys must be unique
+func CBOREncodeMap(pairs ...[2][]byte) []byte {
+	sorted := make([][2][]byte, len(pairs))
+	copy(sorted, pairs)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][0], sorted[j][0]) < 0 })
+	ret := cborHead(cborMajorMap, uint64(len(sorted)))
+	for _, p := range sorted {
+		ret = append(ret, p[0]...)
+		ret = append(ret, p[1]...)
+	}
+	return ret
+}
+
+// CBOREncodeNull encodes null
+func CBOREncodeNull() []byte {
+	return []byte{cborNull}
+}
+
+// cborHead encodes major type with the argument in the shortest form
+func cborHead(major byte, arg uint64) []byte {
+	m := major << 5
+	switch {
+	case arg < 24:
+		return []byte{m | byte(arg)}
+	case arg <= 0xFF:
+		return []byte{m | 24, byte(arg)}
+	case arg <= 0xFFFF:
+		ret := []byte{m | 25, 0, 0}
+		binary.BigEndian.PutUint16(ret[1:], uint16(arg))
+		return ret
+	case arg <= 0xFFFFFFFF:
+		ret := []byte{m | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(ret[1:], uint32(arg))
+		return ret
+	}
+	ret := make([]byte, 9)
+	ret[0] = m | 27
+	binary.BigEndian.PutUint64(ret[1:], arg)
+	return ret
+}
+
+// CBORDecode decodes one data item, which must take the whole data
+func CBORDecode(data []byte) (*CBORItem, error) {
+	ret, rest, err := cborDecodeItem(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+func cborDecodeItem(data []byte) (*CBORItem, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, ErrWrongCBOR
+	}
+	if data[0] == cborNull {
+		return &CBORItem{Kind: CBORNull}, data[1:], nil
+	}
+	major := data[0] >> 5
+	arg, rest, err := cborDecodeHead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch major {
+	case cborMajorUint:
+		return &CBORItem{Kind: CBORUint, Uint: arg}, rest, nil
+	case cborMajorBytes:
+		if arg > uint64(len(rest)) {
+			return nil, nil, ErrWrongCBOR
+		}
+		return &CBORItem{Kind: CBORBytes, Bytes: rest[:arg]}, rest[arg:], nil
+	case cborMajorArray, cborMajorMap:
+		ret := &CBORItem{Kind: CBORArray}
+		n := arg
+		if major == cborMajorMap {
+			ret.Kind = CBORMap
+			n = 2 * arg
+		}
+		// each item takes at least one byte
+		if n > uint64(len(rest)) {
+			return nil, nil, ErrWrongCBOR
+		}
+		ret.Items = make([]*CBORItem, n)
+		var prevKey []byte
+		for i := range ret.Items {
+			start := rest
+			if ret.Items[i], rest, err = cborDecodeItem(rest); err != nil {
+				return nil, nil, err
+			}
+			if ret.Kind == CBORMap && i%2 == 0 {
+				key := start[:len(start)-len(rest)]
+				if prevKey != nil && bytes.Compare(prevKey, key) >= 0 {
+					return nil, nil, ErrWrongCBOR
+				}
+				prevKey = key
+			}
+		}
+		return ret, rest, nil
+	}
+	return nil, nil, ErrUnsupportedCBOR
+}
+
+// cborDecodeHead decodes the argument of the head. Only the shortest form is accepted
+func cborDecodeHead(data []byte) (uint64, []byte, error) {
+	info := data[0] & 0x1F
+	data = data[1:]
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		// indefinite lengths and reserved values
+		return 0, nil, ErrUnsupportedCBOR
+	}
+	if len(data) < size {
+		return 0, nil, ErrWrongCBOR
+	}
+	arg := uint64(0)
+	for _, c := range data[:size] {
+		arg = arg<<8 | uint64(c)
+	}
+	var minArg uint64
+	switch size {
+	case 1:
+		minArg = 24
+	case 2:
+		minArg = 0x100
+	case 4:
+		minArg = 0x10000
+	case 8:
+		minArg = 0x100000000
+	}
+	if arg < minArg {
+		return 0, nil, ErrWrongCBOR
+	}
+	return arg, data[size:], nil
+}
+
+// ArrayOf returns items of the array, which must be of the expected length
+func (it *CBORItem) ArrayOf(n int) ([]*CBORItem, error) {
+	if it.Kind != CBORArray || len(it.Items) != n {
+		return nil, ErrWrongCBOR
+	}
+	return it.Items, nil
+}
+
+// ByteString returns the byte string of the item
+func (it *CBORItem) ByteString() ([]byte, error) {
+	if it.Kind != CBORBytes {
+		return nil, ErrWrongCBOR
+	}
+	return it.Bytes, nil
+}
+
+// Unsigned returns the unsigned integer of the item
+func (it *CBORItem) Unsigned() (uint64, error) {
+	if it.Kind != CBORUint {
+		return 0, ErrWrongCBOR
+	}
+	return it.Uint, nil
+}
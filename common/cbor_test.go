@@ -0,0 +1,82 @@
+package common
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCBOR(t *testing.T) {
+	// examples of RFC 8949, appendix A
+	require.EqualValues(t, "00", hex.EncodeToString(CBOREncodeUint(0)))
+	require.EqualValues(t, "17", hex.EncodeToString(CBOREncodeUint(23)))
+	require.EqualValues(t, "1818", hex.EncodeToString(CBOREncodeUint(24)))
+	require.EqualValues(t, "1864", hex.EncodeToString(CBOREncodeUint(100)))
+	require.EqualValues(t, "1903e8", hex.EncodeToString(CBOREncodeUint(1000)))
+	require.EqualValues(t, "1a000f4240", hex.EncodeToString(CBOREncodeUint(1000000)))
+	require.EqualValues(t, "1b000000e8d4a51000", hex.EncodeToString(CBOREncodeUint(1000000000000)))
+	require.EqualValues(t, "1bffffffffffffffff", hex.EncodeToString(CBOREncodeUint(18446744073709551615)))
+	require.EqualValues(t, "40", hex.EncodeToString(CBOREncodeBytes(nil)))
+	require.EqualValues(t, "4401020304", hex.EncodeToString(CBOREncodeBytes([]byte{1, 2, 3, 4})))
+	require.EqualValues(t, "f6", hex.EncodeToString(CBOREncodeNull()))
+	require.EqualValues(t, "80", hex.EncodeToString(CBOREncodeArray()))
+	require.EqualValues(t, "83010203", hex.EncodeToString(CBOREncodeArray(CBOREncodeUint(1), CBOREncodeUint(2), CBOREncodeUint(3))))
+	require.EqualValues(t, "8301820203820405", hex.EncodeToString(CBOREncodeArray(
+		CBOREncodeUint(1),
+		CBOREncodeArray(CBOREncodeUint(2), CBOREncodeUint(3)),
+		CBOREncodeArray(CBOREncodeUint(4), CBOREncodeUint(5)),
+	)))
+	require.EqualValues(t, "a0", hex.EncodeToString(CBOREncodeMap()))
+	// keys are sorted regardless of the order of the arguments
+	require.EqualValues(t, "a201020304", hex.EncodeToString(CBOREncodeMap(
+		[2][]byte{CBOREncodeUint(3), CBOREncodeUint(4)},
+		[2][]byte{CBOREncodeUint(1), CBOREncodeUint(2)},
+	)))
+	require.EqualValues(t, "5819", hex.EncodeToString(CBOREncodeBytes([]byte(strings.Repeat("x", 25))))[:4])
+}
+
+func TestCBORDecode(t *testing.T) {
+	data := CBOREncodeArray(
+		CBOREncodeUint(1000),
+		CBOREncodeBytes([]byte(strings.Repeat("x", 300))),
+		CBOREncodeNull(),
+		CBOREncodeMap([2][]byte{CBOREncodeUint(24), CBOREncodeBytes(nil)}, [2][]byte{CBOREncodeUint(1), CBOREncodeBytes([]byte{1})}),
+	)
+	item, err := CBORDecode(data)
+	require.NoError(t, err)
+	fields, err := item.ArrayOf(4)
+	require.NoError(t, err)
+	v, err := fields[0].Unsigned()
+	require.NoError(t, err)
+	require.EqualValues(t, 1000, v)
+	b, err := fields[1].ByteString()
+	require.NoError(t, err)
+	require.EqualValues(t, strings.Repeat("x", 300), string(b))
+	require.EqualValues(t, CBORNull, fields[2].Kind)
+	require.EqualValues(t, CBORMap, fields[3].Kind)
+	require.EqualValues(t, 4, len(fields[3].Items))
+	require.EqualValues(t, 1, fields[3].Items[0].Uint)
+	require.EqualValues(t, 24, fields[3].Items[2].Uint)
+
+	for _, wrong := range []string{
+		"",
+		"1817",       // not the shortest form
+		"190017",     // not the shortest form
+		"5f4101ff",   // indefinite length
+		"9f01ff",     // indefinite length
+		"20",         // negative integer
+		"f5",         // true
+		"44010203",   // truncated
+		"83010203ff", // extra bytes
+		"a203040102", // keys not sorted
+		"a201020103", // duplicate keys
+		"9bffffffffffffffff",
+	} {
+		data, err := hex.DecodeString(wrong)
+		require.NoError(t, err)
+		_, err = CBORDecode(data)
+		require.Error(t, err, wrong)
+	}
+}
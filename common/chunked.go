@@ -0,0 +1,251 @@
+package common
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ----------------------------------------------------------------------------
+// Chunked key/value streams: the binary stream of BinaryStreamWriter split into numbered chunk files of
+// limited size, described by the manifest file. Chunks can be uploaded and downloaded in parallel and
+// each can be verified against the manifest independently, so the interrupted transfer is resumed
+// from the missing or broken chunks. Each chunk is the valid binary stream: key/value pairs are never split.
+// Files in the directory are <name>.<6-digit chunk number> and the manifest <name>.manifest.json
+var (
+	_ KVStreamWriter   = &ChunkedStreamWriter{}
+	_ KVStreamIterator = &ChunkedStreamIterator{}
+)
+
+var ErrChunkCorrupted = errors.New("chunk of the stream is missing or corrupted")
+
+type (
+	// ChunkManifest describes the chunks of the stream in the order of the stream
+	ChunkManifest struct {
+		Chunks []ChunkInfo `json:"chunks"`
+		// Pairs and Bytes totals of the stream
+		Pairs int `json:"pairs"`
+		Bytes int `json:"bytes"`
+	}
+
+	ChunkInfo struct {
+		// File name of the chunk file, relative to the directory of the manifest
+		File  string `json:"file"`
+		Size  int64  `json:"size"`
+		Pairs int    `json:"pairs"`
+		// Hash is the hex-encoded blake2b-256 hash of the chunk file
+		Hash string `json:"hash"`
+	}
+
+	ChunkedStreamWriter struct {
+		dir      string
+		name     string
+		maxBytes int
+		manifest ChunkManifest
+		// current chunk. nil if there's no open chunk
+		file  *os.File
+		buf   *bufio.Writer
+		hash  hash.Hash
+		chunk *BinaryStreamWriter
+	}
+
+	ChunkedStreamIterator struct {
+		dir      string
+		manifest ChunkManifest
+	}
+)
+
+// NewChunkedStreamWriter creates the writer of the chunks of at most maxBytes each in the directory.
+// The key/value pair bigger than maxBytes is written to the chunk of its own.
+// Close must be called at the end to write the last chunk and the manifest
+func NewChunkedStreamWriter(dir, name string, maxBytes int) (*ChunkedStreamWriter, error) {
+	Assertf(maxBytes > 0, "NewChunkedStreamWriter: maxBytes must be positive")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &ChunkedStreamWriter{
+		dir:      dir,
+		name:     name,
+		maxBytes: maxBytes,
+		manifest: ChunkManifest{Chunks: make([]ChunkInfo, 0)},
+	}, nil
+}
+
+func chunkFileName(name string, i int) string {
+	return fmt.Sprintf("%s.%06d", name, i)
+}
+
+func chunkManifestFileName(name string) string {
+	return name + ".manifest.json"
+}
+
+func (w *ChunkedStreamWriter) Write(key, value []byte) error {
+	size := len(key) + 2 + len(value) + 4
+	if w.chunk != nil {
+		if _, chunkBytes := w.chunk.Stats(); chunkBytes+size > w.maxBytes {
+			if err := w.closeChunk(); err != nil {
+				return err
+			}
+		}
+	}
+	if w.chunk == nil {
+		if err := w.openChunk(); err != nil {
+			return err
+		}
+	}
+	if err := w.chunk.Write(key, value); err != nil {
+		return err
+	}
+	w.manifest.Pairs++
+	w.manifest.Bytes += size
+	return nil
+}
+
+func (w *ChunkedStreamWriter) Stats() (int, int) {
+	return w.manifest.Pairs, w.manifest.Bytes
+}
+
+// Close writes the last chunk and the manifest. The manifest is written last, so its presence means
+// the chunk set is complete. Returns the manifest
+func (w *ChunkedStreamWriter) Close() (*ChunkManifest, error) {
+	if w.chunk != nil {
+		if err := w.closeChunk(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.MarshalIndent(&w.manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	fname := filepath.Join(w.dir, chunkManifestFileName(w.name))
+	if err = os.WriteFile(fname+".tmp", data, 0o644); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(fname+".tmp", fname); err != nil {
+		return nil, err
+	}
+	return &w.manifest, nil
+}
+
+func (w *ChunkedStreamWriter) openChunk() error {
+	var err error
+	if w.file, err = os.Create(filepath.Join(w.dir, chunkFileName(w.name, len(w.manifest.Chunks)))); err != nil {
+		return err
+	}
+	w.buf = bufio.NewWriter(w.file)
+	w.hash, _ = blake2b.New256(nil)
+	w.chunk = NewBinaryStreamWriter(io.MultiWriter(w.buf, w.hash))
+	return nil
+}
+
+func (w *ChunkedStreamWriter) closeChunk() error {
+	err := w.buf.Flush()
+	if err == nil {
+		err = w.file.Sync()
+	}
+	if errClose := w.file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return err
+	}
+	pairs, size := w.chunk.Stats()
+	w.manifest.Chunks = append(w.manifest.Chunks, ChunkInfo{
+		File:  chunkFileName(w.name, len(w.manifest.Chunks)),
+		Size:  int64(size),
+		Pairs: pairs,
+		Hash:  hex.EncodeToString(w.hash.Sum(nil)),
+	})
+	w.file, w.buf, w.hash, w.chunk = nil, nil, nil, nil
+	return nil
+}
+
+// OpenChunkedStream reads the manifest of the chunk set in the directory
+func OpenChunkedStream(dir, name string) (*ChunkedStreamIterator, error) {
+	data, err := os.ReadFile(filepath.Join(dir, chunkManifestFileName(name)))
+	if err != nil {
+		return nil, err
+	}
+	ret := &ChunkedStreamIterator{dir: dir}
+	if err = json.Unmarshal(data, &ret.manifest); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (it *ChunkedStreamIterator) Manifest() *ChunkManifest {
+	return &it.manifest
+}
+
+// VerifyChunk checks the size and the hash of the chunk file against the manifest.
+// Returns ErrChunkCorrupted if the chunk is missing or does not match
+func (it *ChunkedStreamIterator) VerifyChunk(i int) error {
+	Assertf(i >= 0 && i < len(it.manifest.Chunks), "VerifyChunk: wrong chunk index %d", i)
+	return it.iterateChunk(i, func(_, _ []byte) bool { return true })
+}
+
+// Iterate reads chunks in order. Each chunk read to the end is verified against the manifest
+func (it *ChunkedStreamIterator) Iterate(fun func(k []byte, v []byte) bool) error {
+	for i := range it.manifest.Chunks {
+		stop := false
+		err := it.iterateChunk(i, func(k, v []byte) bool {
+			stop = !fun(k, v)
+			return !stop
+		})
+		if err != nil || stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// IterateChunk reads the chunk i. The chunk read to the end is verified against the manifest.
+// It allows receivers to process chunks in any order, for example, as their downloads complete
+func (it *ChunkedStreamIterator) IterateChunk(i int, fun func(k []byte, v []byte) bool) error {
+	Assertf(i >= 0 && i < len(it.manifest.Chunks), "IterateChunk: wrong chunk index %d", i)
+	return it.iterateChunk(i, fun)
+}
+
+func (it *ChunkedStreamIterator) iterateChunk(i int, fun func(k []byte, v []byte) bool) error {
+	info := &it.manifest.Chunks[i]
+	file, err := os.Open(filepath.Join(it.dir, info.File))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s doesn't exist", ErrChunkCorrupted, info.File)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() != info.Size {
+		return fmt.Errorf("%w: size of %s is %d, expected %d", ErrChunkCorrupted, info.File, stat.Size(), info.Size)
+	}
+	h, _ := blake2b.New256(nil)
+	stop := false
+	err = NewBinaryStreamIterator(io.TeeReader(bufio.NewReader(file), h)).Iterate(func(k, v []byte) bool {
+		stop = !fun(k, v)
+		return !stop
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrChunkCorrupted, info.File, err)
+	}
+	if stop {
+		return nil
+	}
+	if hex.EncodeToString(h.Sum(nil)) != info.Hash {
+		return fmt.Errorf("%w: hash of %s doesn't match", ErrChunkCorrupted, info.File)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkedStream(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewChunkedStreamWriter(dir, "snapshot", 1000)
+	require.NoError(t, err)
+	expected := make([]string, 0)
+	for i := 0; i < 500; i++ {
+		k := fmt.Sprintf("key%d", i)
+		require.NoError(t, w.Write([]byte(k), []byte("value"+k)))
+		expected = append(expected, k)
+	}
+	// pair bigger than the chunk
+	big := make([]byte, 2000)
+	require.NoError(t, w.Write([]byte("big"), big))
+	expected = append(expected, "big")
+	manifest, err := w.Close()
+	require.NoError(t, err)
+	require.EqualValues(t, 501, manifest.Pairs)
+	require.True(t, len(manifest.Chunks) > 10)
+	for i, c := range manifest.Chunks {
+		if i < len(manifest.Chunks)-1 {
+			require.True(t, c.Size <= 1000)
+		}
+	}
+
+	it, err := OpenChunkedStream(dir, "snapshot")
+	require.NoError(t, err)
+	require.EqualValues(t, manifest, it.Manifest())
+	keys := make([]string, 0)
+	err = it.Iterate(func(k, v []byte) bool {
+		keys = append(keys, string(k))
+		if string(k) != "big" {
+			require.EqualValues(t, "value"+string(k), string(v))
+		}
+		return true
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, expected, keys)
+
+	// early stop
+	count := 0
+	require.NoError(t, it.Iterate(func(_, _ []byte) bool {
+		count++
+		return count < 10
+	}))
+	require.EqualValues(t, 10, count)
+
+	// corrupted and missing chunks
+	for i := range manifest.Chunks {
+		require.NoError(t, it.VerifyChunk(i))
+	}
+	fname := filepath.Join(dir, manifest.Chunks[1].File)
+	data, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(fname, data, 0o644))
+	require.ErrorIs(t, it.VerifyChunk(1), ErrChunkCorrupted)
+	require.ErrorIs(t, it.Iterate(func(_, _ []byte) bool { return true }), ErrChunkCorrupted)
+	require.NoError(t, os.Remove(filepath.Join(dir, manifest.Chunks[2].File)))
+	require.ErrorIs(t, it.VerifyChunk(2), ErrChunkCorrupted)
+	require.NoError(t, it.VerifyChunk(3))
+
+	_, err = OpenChunkedStream(dir, "other")
+	require.Error(t, err)
+}
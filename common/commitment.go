@@ -45,7 +45,14 @@ func ReadTerminalCommitment(m CommitmentModel, r io.Reader) (TCommitment, error)
 	return ret, nil
 }
 
+// VectorCommitmentFromBytes parses the vector commitment of the model.
+// If m == nil, data must be self-describing (see SelfDescribingBytes): the model is taken from the registry by the
+// ModelID prefix. Use VectorCommitmentOfModel to parse self-describing data and check the model
 func VectorCommitmentFromBytes(m CommitmentModel, data []byte) (VCommitment, error) {
+	if m == nil {
+		_, ret, err := VectorCommitmentFromSelfDescribingBytes(data)
+		return ret, err
+	}
 	rdr := bytes.NewReader(data)
 	ret, err := ReadVectorCommitment(m, rdr)
 	if err != nil {
@@ -0,0 +1,130 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ----------------------------------------------------------------------------
+// Compressed key/value streams: the binary stream of BinaryStreamWriter in the zstd, gzip or framed snappy
+// format. The reader detects the format by the magic bytes at the beginning, so compressed and uncompressed
+// streams are read the same way. The uncompressed stream is recognized as such unless it starts
+// with the key which length and bytes happen to match one of the magic numbers
+var (
+	_ KVStreamWriter   = &CompressedStreamWriter{}
+	_ KVStreamIterator = &CompressedStreamIterator{}
+)
+
+var (
+	zstdMagic   = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic   = []byte{0x1f, 0x8b}
+	snappyMagic = []byte{0xff, 0x06, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y'}
+)
+
+type (
+	// CompressedStreamWriter writes the compressed binary stream. Stats returns number of uncompressed bytes
+	CompressedStreamWriter struct {
+		*BinaryStreamWriter
+		cw io.WriteCloser
+	}
+
+	// CompressedStreamIterator reads the binary stream, compressed or not
+	CompressedStreamIterator struct {
+		r io.Reader
+	}
+
+	nopWriteCloser struct {
+		io.Writer
+	}
+)
+
+// NewCompressedStreamWriter creates the writer of the stream compressed with the algorithm.
+// Close must be called at the end to flush the compressor. It does not close w
+func NewCompressedStreamWriter(w io.Writer, c Compression) (*CompressedStreamWriter, error) {
+	var cw io.WriteCloser
+	switch c {
+	case CompressionNone:
+		cw = nopWriteCloser{w}
+	case CompressionSnappy:
+		cw = snappy.NewBufferedWriter(w)
+	case CompressionZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, err
+		}
+		cw = zw
+	case CompressionGzip:
+		cw = gzip.NewWriter(w)
+	default:
+		return nil, ErrUnknownCompression
+	}
+	return &CompressedStreamWriter{
+		BinaryStreamWriter: NewBinaryStreamWriter(cw),
+		cw:                 cw,
+	}, nil
+}
+
+// Close flushes the compressor and writes the end of the compressed stream
+func (w *CompressedStreamWriter) Close() error {
+	return w.cw.Close()
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func NewCompressedStreamIterator(r io.Reader) *CompressedStreamIterator {
+	return &CompressedStreamIterator{r: r}
+}
+
+// Iterate detects compression of the stream and iterates key/value pairs
+func (it *CompressedStreamIterator) Iterate(fun func(k []byte, v []byte) bool) error {
+	rdr := bufio.NewReader(it.r)
+	c, err := detectStreamCompression(rdr)
+	if err != nil {
+		return err
+	}
+	var r io.Reader
+	switch c {
+	case CompressionNone:
+		r = rdr
+	case CompressionSnappy:
+		r = snappy.NewReader(rdr)
+	case CompressionZstd:
+		zr, err := zstd.NewReader(rdr)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	case CompressionGzip:
+		gr, err := gzip.NewReader(rdr)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	return NewBinaryStreamIterator(r).Iterate(fun)
+}
+
+func detectStreamCompression(r *bufio.Reader) (Compression, error) {
+	for _, m := range []struct {
+		magic []byte
+		c     Compression
+	}{{snappyMagic, CompressionSnappy}, {zstdMagic, CompressionZstd}, {gzipMagic, CompressionGzip}} {
+		prefix, err := r.Peek(len(m.magic))
+		if err != nil && err != io.EOF {
+			return CompressionNone, err
+		}
+		if bytes.Equal(prefix, m.magic) {
+			return m.c, nil
+		}
+	}
+	return CompressionNone, nil
+}
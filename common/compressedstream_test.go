@@ -0,0 +1,61 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressedStream(t *testing.T) {
+	var plain bytes.Buffer
+	for _, c := range []Compression{CompressionNone, CompressionSnappy, CompressionZstd, CompressionGzip} {
+		t.Run(c.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewCompressedStreamWriter(&buf, c)
+			require.NoError(t, err)
+			expected := make(map[string]string)
+			for i := 0; i < 1000; i++ {
+				k := fmt.Sprintf("key%d", i)
+				expected[k] = strings.Repeat("value", i%20+1)
+				require.NoError(t, w.Write([]byte(k), []byte(expected[k])))
+			}
+			require.NoError(t, w.Close())
+			n, size := w.Stats()
+			require.EqualValues(t, 1000, n)
+			if c == CompressionNone {
+				plain.Write(buf.Bytes())
+				require.EqualValues(t, size, buf.Len())
+			} else {
+				require.True(t, buf.Len() < size/2)
+			}
+
+			read := make(map[string]string)
+			err = NewCompressedStreamIterator(&buf).Iterate(func(k, v []byte) bool {
+				read[string(k)] = string(v)
+				return true
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, expected, read)
+		})
+	}
+	// uncompressed stream is readable by the BinaryStreamIterator
+	count := 0
+	err := NewBinaryStreamIterator(&plain).Iterate(func(_, _ []byte) bool {
+		count++
+		return true
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 1000, count)
+
+	err = NewCompressedStreamIterator(bytes.NewReader(nil)).Iterate(func(_, _ []byte) bool {
+		t.FailNow()
+		return true
+	})
+	require.NoError(t, err)
+
+	_, err = NewCompressedStreamWriter(&plain, Compression(100))
+	require.ErrorIs(t, err, ErrUnknownCompression)
+}
@@ -0,0 +1,216 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ----------------------------------------------------------------------------
+// CompressedKVStore is a transparent compressing wrapper of the KVStore.
+// Each stored value is prefixed with 1 byte of the compression algorithm. The value is stored uncompressed,
+// with the CompressionNone header, if compression does not make it smaller, so reading does not need any
+// configuration and the algorithm can be changed at any time. Keys are not compressed, so the order of keys
+// and prefix iteration are the same as in the underlying store.
+// The store must only be written through the wrapper: values without the header are not readable
+var (
+	_ KVStore          = &CompressedKVStore{}
+	_ KVBatchedReader  = &CompressedKVStore{}
+	_ BatchedUpdatable = &CompressedKVStore{}
+	_ Traversable      = &CompressedKVStore{}
+)
+
+// Compression is the compression algorithm
+type Compression byte
+
+const (
+	CompressionNone = Compression(iota)
+	CompressionSnappy
+	CompressionZstd
+	// CompressionGzip is intended for streams. Its header makes it inefficient for values of the store
+	CompressionGzip
+)
+
+var ErrUnknownCompression = errors.New("unknown compression")
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	case CompressionGzip:
+		return "gzip"
+	default:
+		return fmt.Sprintf("Compression(%d)", byte(c))
+	}
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// zstd encoder and decoder are safe for concurrent use with EncodeAll/DecodeAll
+func initZstd() {
+	zstdOnce.Do(func() {
+		var err error
+		zstdEncoder, err = zstd.NewWriter(nil)
+		AssertNoError(err)
+		zstdDecoder, err = zstd.NewReader(nil)
+		AssertNoError(err)
+	})
+}
+
+// Compress compresses data with the algorithm. Panics with ErrUnknownCompression if the algorithm is not known
+func (c Compression) Compress(data []byte) []byte {
+	switch c {
+	case CompressionNone:
+		return Concat(data)
+	case CompressionSnappy:
+		return snappy.Encode(nil, data)
+	case CompressionZstd:
+		initZstd()
+		return zstdEncoder.EncodeAll(data, nil)
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(data)
+		AssertNoError(err)
+		AssertNoError(w.Close())
+		return buf.Bytes()
+	}
+	panic(ErrUnknownCompression)
+}
+
+// Decompress decompresses data compressed with the algorithm
+func (c Compression) Decompress(data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return Concat(data), nil
+	case CompressionSnappy:
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		initZstd()
+		return zstdDecoder.DecodeAll(data, nil)
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+	return nil, ErrUnknownCompression
+}
+
+type (
+	CompressedKVStore struct {
+		store KVStore
+		c     Compression
+	}
+
+	compressedBatchedWriter struct {
+		w KVBatchedWriter
+		c Compression
+	}
+
+	compressedIterator struct {
+		it KVIterator
+	}
+)
+
+// NewCompressedKVStore wraps the store with the compression of values.
+// Iterator requires the store to be Traversable, BatchedWriter requires it to be BatchedUpdatable
+func NewCompressedKVStore(store KVStore, c Compression) *CompressedKVStore {
+	Assertf(c <= CompressionZstd, "NewCompressedKVStore: %s", c)
+	return &CompressedKVStore{
+		store: store,
+		c:     c,
+	}
+}
+
+func (s *CompressedKVStore) Get(key []byte) []byte {
+	return mustDecompressValue(s.store.Get(key))
+}
+
+func (s *CompressedKVStore) Has(key []byte) bool {
+	return s.store.Has(key)
+}
+
+// GetMany reads values in one round trip if the underlying store supports it
+func (s *CompressedKVStore) GetMany(keys [][]byte) [][]byte {
+	ret := GetMany(s.store, keys)
+	for i := range ret {
+		ret[i] = mustDecompressValue(ret[i])
+	}
+	return ret
+}
+
+func (s *CompressedKVStore) Set(key, value []byte) {
+	s.store.Set(key, compressValue(s.c, value))
+}
+
+func (s *CompressedKVStore) BatchedWriter() KVBatchedWriter {
+	b, ok := s.store.(BatchedUpdatable)
+	Assertf(ok, "CompressedKVStore: underlying store is not BatchedUpdatable")
+	return &compressedBatchedWriter{
+		w: b.BatchedWriter(),
+		c: s.c,
+	}
+}
+
+func (s *CompressedKVStore) Iterator(prefix []byte) KVIterator {
+	t, ok := s.store.(Traversable)
+	Assertf(ok, "CompressedKVStore: underlying store is not Traversable")
+	return &compressedIterator{it: t.Iterator(prefix)}
+}
+
+func (w *compressedBatchedWriter) Set(key, value []byte) {
+	w.w.Set(key, compressValue(w.c, value))
+}
+
+func (w *compressedBatchedWriter) Commit() error {
+	return w.w.Commit()
+}
+
+func (it *compressedIterator) Iterate(f func(k []byte, v []byte) bool) {
+	it.it.Iterate(func(k, v []byte) bool {
+		return f(k, mustDecompressValue(v))
+	})
+}
+
+func (it *compressedIterator) IterateKeys(f func(k []byte) bool) {
+	it.it.IterateKeys(f)
+}
+
+// compressValue compresses the value and prefixes it with the algorithm, if it makes the value smaller.
+// Otherwise, the value is prefixed with CompressionNone
+func compressValue(c Compression, value []byte) []byte {
+	if len(value) == 0 {
+		return nil
+	}
+	if c != CompressionNone {
+		if data := c.Compress(value); len(data) < len(value) {
+			return Concat(byte(c), data)
+		}
+	}
+	return Concat(byte(CompressionNone), value)
+}
+
+func mustDecompressValue(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	ret, err := Compression(data[0]).Decompress(data[1:])
+	AssertNoError(err, "CompressedKVStore")
+	return ret
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressedKVStore(t *testing.T) {
+	for _, c := range []Compression{CompressionNone, CompressionSnappy, CompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			store := NewInMemoryKVStore()
+			cs := NewCompressedKVStore(store, c)
+			values := make(map[string]string)
+			for i := 0; i < 100; i++ {
+				k := fmt.Sprintf("key%d", i)
+				values[k] = strings.Repeat(fmt.Sprintf("value%d", i), i%10+1)
+				cs.Set([]byte(k), []byte(values[k]))
+			}
+			cs.Set([]byte("key0"), nil)
+			delete(values, "key0")
+			b := cs.BatchedWriter()
+			b.Set([]byte("batched"), []byte(strings.Repeat("b", 100)))
+			values["batched"] = strings.Repeat("b", 100)
+			require.NoError(t, b.Commit())
+
+			for k, v := range values {
+				require.EqualValues(t, v, string(cs.Get([]byte(k))))
+				require.True(t, cs.Has([]byte(k)))
+				stored := store.Get([]byte(k))
+				if c == CompressionNone || len(v) < 20 {
+					require.EqualValues(t, CompressionNone, stored[0])
+				}
+				if len(v) >= 50 && c != CompressionNone {
+					require.EqualValues(t, c, stored[0])
+					require.True(t, len(stored) < len(v))
+				}
+			}
+			require.Nil(t, cs.Get([]byte("key0")))
+			got := cs.GetMany([][]byte{[]byte("key1"), []byte("key0")})
+			require.EqualValues(t, values["key1"], string(got[0]))
+			require.Nil(t, got[1])
+
+			n := 0
+			cs.Iterator([]byte("key")).Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, values[string(k)], string(v))
+				n++
+				return true
+			})
+			require.EqualValues(t, 99, n)
+
+			// another algorithm reads the same store
+			other := NewCompressedKVStore(store, CompressionSnappy)
+			require.EqualValues(t, values["batched"], string(other.Get([]byte("batched"))))
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"context"
+)
+
+// DefaultContextCheckEvery is the default number of steps between checks of the context
+const DefaultContextCheckEvery = 100
+
+// ContextChecker checks cancellation of the context periodically, every N steps of the long-running loop,
+// to avoid overhead of checking the context on each step
+type ContextChecker struct {
+	ctx   context.Context
+	every int
+	count int
+	err   error
+}
+
+func NewContextChecker(ctx context.Context, every ...int) *ContextChecker {
+	ret := &ContextChecker{
+		ctx:   ctx,
+		every: DefaultContextCheckEvery,
+	}
+	if len(every) > 0 && every[0] > 0 {
+		ret.every = every[0]
+	}
+	return ret
+}
+
+// Cancelled counts the step and returns true if the context was found cancelled.
+// Once cancelled, it always returns true
+func (c *ContextChecker) Cancelled() bool {
+	if c.err != nil {
+		return true
+	}
+	c.count++
+	if (c.count-1)%c.every != 0 {
+		// checking on the first step and then every N steps
+		return false
+	}
+	select {
+	case <-c.ctx.Done():
+		c.err = c.ctx.Err()
+		return true
+	default:
+		return false
+	}
+}
+
+// Err returns error of the context if it was found cancelled, otherwise nil
+func (c *ContextChecker) Err() error {
+	return c.err
+}
+
+// IterateCtx iterates the iterator until the callback returns false or the context is cancelled.
+// Returns the error of the context if cancelled
+func IterateCtx(ctx context.Context, it KVIteratorBase, fun func(k, v []byte) bool) error {
+	c := NewContextChecker(ctx)
+	it.Iterate(func(k, v []byte) bool {
+		if c.Cancelled() {
+			return false
+		}
+		return fun(k, v)
+	})
+	return c.Err()
+}
+
+// IterateKeysCtx iterates keys until the callback returns false or the context is cancelled.
+// Returns the error of the context if cancelled
+func IterateKeysCtx(ctx context.Context, it KVIterator, fun func(k []byte) bool) error {
+	c := NewContextChecker(ctx)
+	it.IterateKeys(func(k []byte) bool {
+		if c.Cancelled() {
+			return false
+		}
+		return fun(k)
+	})
+	return c.Err()
+}
@@ -10,7 +10,8 @@ var (
 	ErrEmpty            = errors.New("encoded key16 can't be empty")
 	ErrWrongFormat      = errors.New("encoded key16 wrong format")
 	ErrWrongBinaryValue = errors.New("key2 byte must be 1 or 0")
-	ErrWrongArity       = errors.New("arity value must be 1, 15 or 255")
+	ErrWrongQuaternary  = errors.New("key4 byte must be less than 4")
+	ErrWrongArity       = errors.New("arity value must be 1, 3, 15 or 255")
 )
 
 // unpack16 src places each 4 bit nibble into separate byte
@@ -52,7 +53,7 @@ func decode16(data []byte) ([]byte, error) {
 	}
 	ret := make([]byte, 0, len(data)*2)
 	ret = unpack16(ret, data[1:])
-	if data[0] == 1 && ret[len(ret)-1] != 0 {
+	if data[0] == 1 && (len(ret) == 0 || ret[len(ret)-1] != 0) {
 		// enforce padding with 0
 		return nil, ErrWrongFormat
 	}
@@ -117,8 +118,65 @@ func decode2(data []byte) ([]byte, error) {
 	}
 	ret := make([]byte, 0, len(data)*8)
 	ret = unpack2(ret, data[1:])
-	Assertf(len(ret) >= int(data[0]), "trie::decode2:: assert failed: len(ret) >= int(data[0]), data: %s",
-		func() string { return hex.EncodeToString(data) })
+	if len(ret) < int(data[0]) {
+		return nil, ErrWrongFormat
+	}
+	// enforce the last data[0] elements are 0
+	for j := len(ret) - int(data[0]); j < len(ret); j++ {
+		if ret[j] != 0 {
+			return nil, ErrWrongFormat
+		}
+	}
+	ret = ret[:len(ret)-int(data[0])]
+	return ret, nil
+}
+
+// unpack4 src places each 2 bit symbol into separate byte. Bigendian
+func unpack4(dst, src []byte) []byte {
+	for _, c := range src {
+		dst = append(dst, c>>6, (c>>4)&0x03, (c>>2)&0x03, c&0x03)
+	}
+	return dst
+}
+
+// pack4 places each 4 bytes with values 0..3 into byte (bigendian). The last are padded with 0 if necessary
+func pack4(dst, src []byte) ([]byte, error) {
+	for i := 0; i < len(src); i += 4 {
+		c := byte(0)
+		for j := 0; j < 4 && i+j < len(src); j++ {
+			if src[i+j] > 0x03 {
+				return nil, ErrWrongQuaternary
+			}
+			c |= src[i+j] << (6 - 2*j)
+		}
+		dst = append(dst, c)
+	}
+	return dst, nil
+}
+
+// encode4 packs 2 bit symbols and prefixes it with number of padded symbols
+func encode4(k4 []byte) ([]byte, error) {
+	padded := byte(len(k4) % 4)
+	if padded != 0 {
+		padded = 4 - padded
+	}
+	ret := append(make([]byte, 0, len(k4)/4+2), padded)
+	return pack4(ret, k4)
+}
+
+// decode4 decodes to the array of 2 bit symbols
+func decode4(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	if data[0] > 3 {
+		return nil, ErrWrongFormat
+	}
+	ret := make([]byte, 0, len(data)*4)
+	ret = unpack4(ret, data[1:])
+	if len(ret) < int(data[0]) {
+		return nil, ErrWrongFormat
+	}
 	// enforce the last data[0] elements are 0
 	for j := len(ret) - int(data[0]); j < len(ret); j++ {
 		if ret[j] != 0 {
@@ -136,6 +194,8 @@ func UnpackBytes(src []byte, arity PathArity) []byte {
 	case PathArity16:
 		return unpack16(make([]byte, 0, 2*len(src)), src)
 		//return unpack16(AllocSmallBuf(2*len(src)), src)
+	case PathArity4:
+		return unpack4(make([]byte, 0, 4*len(src)), src)
 	case PathArity2:
 		return unpack2(make([]byte, 0, 8*len(src)), src)
 		//return unpack2(AllocSmallBuf(8*len(src)), src)
@@ -152,6 +212,8 @@ func EncodeUnpackedBytes(unpacked []byte, arity PathArity) ([]byte, error) {
 		return unpacked, nil
 	case PathArity16:
 		return encode16(unpacked)
+	case PathArity4:
+		return encode4(unpacked)
 	case PathArity2:
 		return encode2(unpacked)
 	}
@@ -171,6 +233,12 @@ func PackUnpackedBytes(unpacked []byte, arity PathArity) ([]byte, error) {
 			return nil, err
 		}
 		return ret[1:], nil
+	case PathArity4:
+		ret, err := encode4(unpacked)
+		if err != nil {
+			return nil, err
+		}
+		return ret[1:], nil
 	case PathArity2:
 		ret, err := encode2(unpacked)
 		if err != nil {
@@ -197,6 +265,8 @@ func DecodeToUnpackedBytes(encoded []byte, arity PathArity) ([]byte, error) {
 		return encoded, nil
 	case PathArity16:
 		return decode16(encoded)
+	case PathArity4:
+		return decode4(encoded)
 	case PathArity2:
 		return decode2(encoded)
 	}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"bytes"
 	"encoding/hex"
 	"testing"
 
@@ -148,3 +149,26 @@ func TestCheckingKey(t *testing.T) {
 	require.NoError(t, err)
 	require.EqualValues(t, unpackedBinBack, unpackedBin)
 }
+
+func Test4Keys(t *testing.T) {
+	for _, key := range [][]byte{nil, {0x00}, {0xe4}, {0x31, 0x32, 0x33, 0x34, 0x35}} {
+		k4 := UnpackBytes(key, PathArity4)
+		require.EqualValues(t, 4*len(key), len(k4))
+		for i := 0; i <= len(k4); i++ {
+			enc, err := EncodeUnpackedBytes(k4[:i], PathArity4)
+			require.NoError(t, err)
+			dec, err := DecodeToUnpackedBytes(enc, PathArity4)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(k4[:i], dec))
+		}
+		packed, err := PackUnpackedBytes(k4, PathArity4)
+		require.NoError(t, err)
+		require.EqualValues(t, key, packed)
+	}
+	require.EqualValues(t, []byte{3, 2, 1, 0}, UnpackBytes([]byte{0xe4}, PathArity4))
+	_, err := EncodeUnpackedBytes([]byte{4}, PathArity4)
+	require.ErrorIs(t, err, ErrWrongQuaternary)
+	// padding must be zero
+	_, err = DecodeToUnpackedBytes([]byte{1, 0x01}, PathArity4)
+	require.ErrorIs(t, err, ErrWrongFormat)
+}
@@ -10,4 +10,7 @@ var (
 	// ErrDBUnavailable implementations of KV storage may choose to panic with this error in case the
 	// underlying storage is closed or unavailable
 	ErrDBUnavailable = errors.New("database is closed or unavailable")
+
+	// ErrReadOnly is returned or panicked with by the store wrapped with ReadOnly on attempt to write
+	ErrReadOnly = errors.New("attempt to write to the read-only store")
 )
@@ -0,0 +1,216 @@
+package common
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------------------
+// ExpiringInMemoryKVStore is a thread-safe in-memory KVStore with optional time-to-live of keys.
+// Keys written with Set never expire, keys written with SetWithTTL expire after the TTL.
+// Expired keys are invisible immediately and are deleted from memory by EvictExpired, which can be run
+// periodically in the background with StartEviction.
+// It is intended as the backing store for short-lived scratch tries, like mempool or simulation state.
+// The order of iteration is unspecified
+var (
+	_ KVStore          = &ExpiringInMemoryKVStore{}
+	_ KVTTLWriter      = &ExpiringInMemoryKVStore{}
+	_ BatchedUpdatable = &ExpiringInMemoryKVStore{}
+	_ Traversable      = &ExpiringInMemoryKVStore{}
+)
+
+type (
+	ExpiringInMemoryKVStore struct {
+		mutex sync.RWMutex
+		m     map[string]expiringValue
+	}
+
+	expiringValue struct {
+		value []byte
+		// zero means never expires
+		expires time.Time
+	}
+
+	expiringBatchedWriter struct {
+		store     *ExpiringInMemoryKVStore
+		mutations *Mutations
+	}
+
+	expiringIterator struct {
+		store  *ExpiringInMemoryKVStore
+		prefix []byte
+	}
+)
+
+func NewExpiringInMemoryKVStore() *ExpiringInMemoryKVStore {
+	return &ExpiringInMemoryKVStore{
+		m: make(map[string]expiringValue),
+	}
+}
+
+func (v *expiringValue) isExpired(now time.Time) bool {
+	return !v.expires.IsZero() && !now.Before(v.expires)
+}
+
+func (s *ExpiringInMemoryKVStore) Get(k []byte) []byte {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	v, ok := s.m[string(k)]
+	if !ok || v.isExpired(time.Now()) {
+		return nil
+	}
+	return Concat(v.value)
+}
+
+func (s *ExpiringInMemoryKVStore) Has(k []byte) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	v, ok := s.m[string(k)]
+	return ok && !v.isExpired(time.Now())
+}
+
+// Set sets the key which never expires. Empty value deletes the key
+func (s *ExpiringInMemoryKVStore) Set(k, v []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.set(k, v, time.Time{})
+}
+
+// SetWithTTL sets the key which expires after ttl. Empty value deletes the key
+func (s *ExpiringInMemoryKVStore) SetWithTTL(k, v []byte, ttl time.Duration) {
+	Assertf(ttl > 0, "SetWithTTL: ttl must be positive")
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.set(k, v, time.Now().Add(ttl))
+}
+
+func (s *ExpiringInMemoryKVStore) set(k, v []byte, expires time.Time) {
+	if len(v) == 0 {
+		delete(s.m, string(k))
+		return
+	}
+	s.m[string(k)] = expiringValue{
+		value:   Concat(v),
+		expires: expires,
+	}
+}
+
+// Len returns number of keys which are not expired
+func (s *ExpiringInMemoryKVStore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	ret := 0
+	for _, v := range s.m {
+		if !v.isExpired(now) {
+			ret++
+		}
+	}
+	return ret
+}
+
+// EvictExpired deletes expired keys from memory. Returns number of deleted keys
+func (s *ExpiringInMemoryKVStore) EvictExpired() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	ret := 0
+	for k, v := range s.m {
+		if v.isExpired(now) {
+			delete(s.m, k)
+			ret++
+		}
+	}
+	return ret
+}
+
+// StartEviction runs EvictExpired periodically in the background.
+// Returns function which stops the eviction and waits until it is stopped
+func (s *ExpiringInMemoryKVStore) StartEviction(interval time.Duration) (stop func()) {
+	Assertf(interval > 0, "StartEviction: interval must be positive")
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				s.EvictExpired()
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			wg.Wait()
+		})
+	}
+}
+
+// BatchedWriter returns the writer which applies the batch atomically. Keys of the batch never expire
+func (s *ExpiringInMemoryKVStore) BatchedWriter() KVBatchedWriter {
+	return &expiringBatchedWriter{
+		store:     s,
+		mutations: NewMutations(),
+	}
+}
+
+func (s *ExpiringInMemoryKVStore) Iterator(prefix []byte) KVIterator {
+	return &expiringIterator{
+		store:  s,
+		prefix: prefix,
+	}
+}
+
+func (bw *expiringBatchedWriter) Set(key, value []byte) {
+	bw.mutations.Set(key, value)
+}
+
+func (bw *expiringBatchedWriter) Commit() error {
+	bw.store.mutex.Lock()
+	defer bw.store.mutex.Unlock()
+
+	bw.mutations.Iterate(func(k []byte, v []byte, _ bool) bool {
+		bw.store.set(k, v, time.Time{})
+		return true
+	})
+	bw.mutations = nil // invalidate
+	return nil
+}
+
+// Iterate visits keys which are not expired. The store is read-locked during the iteration
+func (si *expiringIterator) Iterate(f func(k []byte, v []byte) bool) {
+	si.store.mutex.RLock()
+	defer si.store.mutex.RUnlock()
+
+	now := time.Now()
+	var key []byte
+	for k, v := range si.store.m {
+		key = []byte(k)
+		if !bytes.HasPrefix(key, si.prefix) || v.isExpired(now) {
+			continue
+		}
+		if !f(key, v.value) {
+			return
+		}
+	}
+}
+
+func (si *expiringIterator) IterateKeys(f func(k []byte) bool) {
+	si.Iterate(func(k []byte, _ []byte) bool {
+		return f(k)
+	})
+}
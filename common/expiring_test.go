@@ -0,0 +1,53 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiringInMemoryKVStore(t *testing.T) {
+	store := NewExpiringInMemoryKVStore()
+	store.Set([]byte("permanent"), []byte("value"))
+	store.SetWithTTL([]byte("ephemeral1"), []byte("value"), 50*time.Millisecond)
+	store.SetWithTTL([]byte("ephemeral2"), []byte("value"), time.Hour)
+	b := store.BatchedWriter()
+	b.Set([]byte("batch"), []byte("value"))
+	require.NoError(t, b.Commit())
+
+	require.EqualValues(t, 4, store.Len())
+	require.EqualValues(t, "value", string(store.Get([]byte("ephemeral1"))))
+
+	time.Sleep(100 * time.Millisecond)
+	require.False(t, store.Has([]byte("ephemeral1")))
+	require.Nil(t, store.Get([]byte("ephemeral1")))
+	require.True(t, store.Has([]byte("ephemeral2")))
+	require.True(t, store.Has([]byte("permanent")))
+	require.True(t, store.Has([]byte("batch")))
+	require.EqualValues(t, 3, store.Len())
+
+	keys := make(map[string]bool)
+	store.Iterator([]byte("e")).IterateKeys(func(k []byte) bool {
+		keys[string(k)] = true
+		return true
+	})
+	require.EqualValues(t, map[string]bool{"ephemeral2": true}, keys)
+
+	require.EqualValues(t, 1, store.EvictExpired())
+	require.EqualValues(t, 0, store.EvictExpired())
+
+	// overwriting with Set removes the TTL
+	store.SetWithTTL([]byte("k"), []byte("value"), 50*time.Millisecond)
+	store.Set([]byte("k"), []byte("value"))
+	store.SetWithTTL([]byte("evicted"), []byte("value"), 10*time.Millisecond)
+	stop := store.StartEviction(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	stop()
+	require.True(t, store.Has([]byte("k")))
+	store.mutex.RLock()
+	_, inMemory := store.m["evicted"]
+	store.mutex.RUnlock()
+	require.False(t, inMemory)
+}
@@ -0,0 +1,205 @@
+package common
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ----------------------------------------------------------------------------
+// FaultyKVStore is a KVStore wrapper which injects faults with the given probabilities: corrupted values on read,
+// dropped writes, panics with ErrDBUnavailable and latency. It is used for testing of error handling
+// around the trie. Faults are drawn from the random source with the seed, so the sequence of faults is
+// deterministic for the same sequence of calls
+var (
+	_ KVStore          = &FaultyKVStore{}
+	_ BatchedUpdatable = &FaultyKVStore{}
+	_ Traversable      = &FaultyKVStore{}
+)
+
+type (
+	FaultyKVStore struct {
+		store KVStore
+
+		mutex sync.Mutex
+		par   FaultParams
+		rnd   *rand.Rand
+		stats FaultStats
+	}
+
+	// FaultParams probabilities of faults in the range [0,1]. 0 means fault is never injected, 1 means always
+	FaultParams struct {
+		// Seed for deterministic randomization
+		Seed int64
+		// CorruptRead probability that Get returns the value with one bit flipped
+		CorruptRead float64
+		// DropWrite probability that Set or Commit of the batch is silently ignored
+		DropWrite float64
+		// Unavailable probability that the call panics with ErrDBUnavailable. Commit of the batch returns the error
+		Unavailable float64
+		// Latency probability that the call is delayed by LatencyDuration
+		Latency         float64
+		LatencyDuration time.Duration
+	}
+
+	// FaultStats number of injected faults
+	FaultStats struct {
+		Corrupted   int
+		Dropped     int
+		Unavailable int
+		Delayed     int
+	}
+
+	faultyBatchedWriter struct {
+		store *FaultyKVStore
+		batch KVBatchedWriter
+	}
+
+	faultyIterator struct {
+		store *FaultyKVStore
+		it    KVIterator
+	}
+
+	faultKind int
+)
+
+const (
+	faultCorruptRead = faultKind(iota)
+	faultDropWrite
+	faultUnavailable
+	faultLatency
+)
+
+func NewFaultyKVStore(store KVStore, par FaultParams) *FaultyKVStore {
+	return &FaultyKVStore{
+		store: store,
+		par:   par,
+		rnd:   rand.New(rand.NewSource(par.Seed)),
+	}
+}
+
+// SetParams changes probabilities of faults. The random source is not re-seeded
+func (s *FaultyKVStore) SetParams(par FaultParams) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.par = par
+}
+
+func (s *FaultyKVStore) Stats() FaultStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stats
+}
+
+func (s *FaultyKVStore) Get(key []byte) []byte {
+	s.injectCommon()
+	ret := s.store.Get(key)
+	if len(ret) == 0 || !s.draw(faultCorruptRead) {
+		return ret
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ret = Concat(ret)
+	ret[s.rnd.Intn(len(ret))] ^= 1 << uint(s.rnd.Intn(8))
+	return ret
+}
+
+func (s *FaultyKVStore) Has(key []byte) bool {
+	s.injectCommon()
+	return s.store.Has(key)
+}
+
+func (s *FaultyKVStore) Set(key, value []byte) {
+	s.injectCommon()
+	if s.draw(faultDropWrite) {
+		return
+	}
+	s.store.Set(key, value)
+}
+
+// BatchedWriter asserts that the underlying store is BatchedUpdatable
+func (s *FaultyKVStore) BatchedWriter() KVBatchedWriter {
+	b, ok := s.store.(BatchedUpdatable)
+	Assertf(ok, "FaultyKVStore: underlying store is not BatchedUpdatable")
+	return &faultyBatchedWriter{
+		store: s,
+		batch: b.BatchedWriter(),
+	}
+}
+
+// Iterator asserts that the underlying store is Traversable. Faults are injected when the iteration starts
+func (s *FaultyKVStore) Iterator(prefix []byte) KVIterator {
+	t, ok := s.store.(Traversable)
+	Assertf(ok, "FaultyKVStore: underlying store is not Traversable")
+	return &faultyIterator{
+		store: s,
+		it:    t.Iterator(prefix),
+	}
+}
+
+// injectCommon injects latency and unavailability
+func (s *FaultyKVStore) injectCommon() {
+	if s.draw(faultLatency) {
+		s.mutex.Lock()
+		d := s.par.LatencyDuration
+		s.mutex.Unlock()
+		time.Sleep(d)
+	}
+	if s.draw(faultUnavailable) {
+		panic(ErrDBUnavailable)
+	}
+}
+
+// draw returns true with the probability of the fault and counts the fault if it does
+func (s *FaultyKVStore) draw(kind faultKind) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var p float64
+	var counter *int
+	switch kind {
+	case faultCorruptRead:
+		p, counter = s.par.CorruptRead, &s.stats.Corrupted
+	case faultDropWrite:
+		p, counter = s.par.DropWrite, &s.stats.Dropped
+	case faultUnavailable:
+		p, counter = s.par.Unavailable, &s.stats.Unavailable
+	case faultLatency:
+		p, counter = s.par.Latency, &s.stats.Delayed
+	}
+	if p <= 0 || s.rnd.Float64() >= p {
+		return false
+	}
+	*counter++
+	return true
+}
+
+func (b *faultyBatchedWriter) Set(key, value []byte) {
+	b.batch.Set(key, value)
+}
+
+func (b *faultyBatchedWriter) Commit() error {
+	if err := CatchPanicOrError(func() error {
+		b.store.injectCommon()
+		return nil
+	}); err != nil {
+		return err
+	}
+	if b.store.draw(faultDropWrite) {
+		return nil
+	}
+	return b.batch.Commit()
+}
+
+func (it *faultyIterator) Iterate(fun func(k []byte, v []byte) bool) {
+	it.store.injectCommon()
+	it.it.Iterate(fun)
+}
+
+func (it *faultyIterator) IterateKeys(fun func(k []byte) bool) {
+	it.store.injectCommon()
+	it.it.IterateKeys(fun)
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultyKVStore(t *testing.T) {
+	t.Run("no faults", func(t *testing.T) {
+		s := NewFaultyKVStore(NewInMemoryKVStore(), FaultParams{})
+		s.Set([]byte("a"), []byte("value"))
+		require.EqualValues(t, "value", string(s.Get([]byte("a"))))
+		require.True(t, s.Has([]byte("a")))
+		require.EqualValues(t, FaultStats{}, s.Stats())
+	})
+	t.Run("corrupt", func(t *testing.T) {
+		s := NewFaultyKVStore(NewInMemoryKVStore(), FaultParams{CorruptRead: 1})
+		s.Set([]byte("a"), []byte("value"))
+		v := s.Get([]byte("a"))
+		require.EqualValues(t, 5, len(v))
+		require.NotEqualValues(t, "value", string(v))
+		require.Nil(t, s.Get([]byte("b")))
+		require.EqualValues(t, 1, s.Stats().Corrupted)
+	})
+	t.Run("drop", func(t *testing.T) {
+		s := NewFaultyKVStore(NewInMemoryKVStore(), FaultParams{DropWrite: 1})
+		s.Set([]byte("a"), []byte("value"))
+		require.False(t, s.Has([]byte("a")))
+		b := s.BatchedWriter()
+		b.Set([]byte("b"), []byte("value"))
+		require.NoError(t, b.Commit())
+		require.False(t, s.Has([]byte("b")))
+		require.EqualValues(t, 2, s.Stats().Dropped)
+	})
+	t.Run("unavailable", func(t *testing.T) {
+		store := NewInMemoryKVStore()
+		s := NewFaultyKVStore(store, FaultParams{Unavailable: 1})
+		err := CatchPanicOrError(func() error {
+			s.Set([]byte("a"), []byte("value"))
+			return nil
+		})
+		require.ErrorIs(t, err, ErrDBUnavailable)
+		require.False(t, store.Has([]byte("a")))
+		b := s.BatchedWriter()
+		b.Set([]byte("b"), []byte("value"))
+		require.ErrorIs(t, b.Commit(), ErrDBUnavailable)
+
+		s.SetParams(FaultParams{})
+		s.Set([]byte("a"), []byte("value"))
+		require.True(t, store.Has([]byte("a")))
+		require.EqualValues(t, 2, s.Stats().Unavailable)
+	})
+	t.Run("latency", func(t *testing.T) {
+		s := NewFaultyKVStore(NewInMemoryKVStore(), FaultParams{Latency: 1, LatencyDuration: 10 * time.Millisecond})
+		start := time.Now()
+		s.Has([]byte("a"))
+		require.True(t, time.Since(start) >= 10*time.Millisecond)
+		require.EqualValues(t, 1, s.Stats().Delayed)
+	})
+	t.Run("deterministic", func(t *testing.T) {
+		run := func() ([]string, FaultStats) {
+			s := NewFaultyKVStore(NewInMemoryKVStore(), FaultParams{Seed: 42, CorruptRead: 0.3, DropWrite: 0.3})
+			for i := 0; i < 100; i++ {
+				s.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+			}
+			ret := make([]string, 0)
+			for i := 0; i < 100; i++ {
+				ret = append(ret, string(s.Get([]byte(fmt.Sprintf("key%d", i)))))
+			}
+			return ret, s.Stats()
+		}
+		values1, stats1 := run()
+		values2, stats2 := run()
+		require.EqualValues(t, values1, values2)
+		require.EqualValues(t, stats1, stats2)
+		require.True(t, stats1.Dropped > 0 && stats1.Dropped < 100)
+		require.True(t, stats1.Corrupted > 0 && stats1.Corrupted < 100)
+	})
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Fuzz targets of the parsers of the package. Run with, for example:
+//
+//	go test ./common -run XXX -fuzz FuzzRLPDecode
+
+func FuzzRLPDecode(f *testing.F) {
+	f.Add(RLPEncodeList(RLPEncodeUint(1024), RLPEncodeBytes([]byte("dog")), RLPEncodeList()))
+	f.Add(RLPEncodeBytes(bytes.Repeat([]byte{1}, 100)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		item, err := RLPDecode(data)
+		if err != nil {
+			return
+		}
+		// only canonical encoding is accepted, so it must be encoded back to the same bytes
+		if !bytes.Equal(rlpEncodeItem(item), data) {
+			t.Fatalf("RLP item is not encoded back to the same bytes")
+		}
+	})
+}
+
+func rlpEncodeItem(item *RLPItem) []byte {
+	if !item.IsList {
+		return RLPEncodeBytes(item.Bytes)
+	}
+	items := make([][]byte, len(item.List))
+	for i, it := range item.List {
+		items[i] = rlpEncodeItem(it)
+	}
+	return RLPEncodeList(items...)
+}
+
+func FuzzCBORDecode(f *testing.F) {
+	f.Add(CBOREncodeArray(CBOREncodeUint(1000), CBOREncodeBytes([]byte("dog")), CBOREncodeNull()))
+	f.Add(CBOREncodeMap([2][]byte{CBOREncodeUint(1), CBOREncodeBytes(nil)}, [2][]byte{CBOREncodeUint(24), CBOREncodeArray()}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		item, err := CBORDecode(data)
+		if err != nil {
+			return
+		}
+		// only deterministic encoding is accepted, so it must be encoded back to the same bytes
+		if !bytes.Equal(cborEncodeItem(item), data) {
+			t.Fatalf("CBOR item is not encoded back to the same bytes")
+		}
+	})
+}
+
+func cborEncodeItem(item *CBORItem) []byte {
+	switch item.Kind {
+	case CBORUint:
+		return CBOREncodeUint(item.Uint)
+	case CBORBytes:
+		return CBOREncodeBytes(item.Bytes)
+	case CBORNull:
+		return CBOREncodeNull()
+	case CBORArray:
+		items := make([][]byte, len(item.Items))
+		for i, it := range item.Items {
+			items[i] = cborEncodeItem(it)
+		}
+		return CBOREncodeArray(items...)
+	}
+	pairs := make([][2][]byte, len(item.Items)/2)
+	for i := range pairs {
+		pairs[i] = [2][]byte{cborEncodeItem(item.Items[2*i]), cborEncodeItem(item.Items[2*i+1])}
+	}
+	return CBOREncodeMap(pairs...)
+}
+
+func FuzzProtobufDecode(f *testing.F) {
+	f.Add(ProtobufEncodeChild(150, []byte{1, 2, 3}))
+	f.Add((&SnapshotHeader{Model: "model", PathArity: PathArity16, HashSize: 20, Root: []byte{1, 2, 3}}).Protobuf())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _, _ = ProtobufDecodeChild(data)
+		h, err := SnapshotHeaderFromProtobuf(data)
+		if err != nil {
+			return
+		}
+		hBack, err := SnapshotHeaderFromProtobuf(h.Protobuf())
+		if err != nil || hBack.Model != h.Model || hBack.PathArity != h.PathArity || hBack.HashSize != h.HashSize || !bytes.Equal(hBack.Root, h.Root) {
+			t.Fatalf("snapshot header does not survive re-encoding")
+		}
+	})
+}
+
+func FuzzDecodeToUnpackedBytes(f *testing.F) {
+	for _, arity := range AllPathArity {
+		encoded, err := EncodeUnpackedBytes(UnpackBytes([]byte("abc"), arity), arity)
+		AssertNoError(err)
+		f.Add(encoded, byte(arity))
+	}
+	f.Fuzz(func(t *testing.T, data []byte, a byte) {
+		arity := PathArity(a)
+		unpacked, err := DecodeToUnpackedBytes(data, arity)
+		if err != nil {
+			return
+		}
+		encoded, err := EncodeUnpackedBytes(unpacked, arity)
+		if err != nil {
+			t.Fatalf("decoded bytes can't be encoded: %v", err)
+		}
+		unpackedBack, err := DecodeToUnpackedBytes(encoded, arity)
+		if err != nil || !bytes.Equal(unpacked, unpackedBack) {
+			t.Fatalf("unpacked bytes do not survive re-encoding")
+		}
+	})
+}
@@ -1,5 +1,10 @@
 package common
 
+import (
+	"bytes"
+	"time"
+)
+
 //----------------------------------------------------------------------------
 // generic abstraction interfaces of key/value storage
 
@@ -12,6 +17,21 @@ type (
 		Has(key []byte) bool // for performance
 	}
 
+	// KVBatchedReader is an optional interface of the KVReader. It is implemented by the stores which
+	// can read many keys in one round trip. Use GetMany and HasMany functions to read from any KVReader
+	KVBatchedReader interface {
+		// GetMany retrieves values of all keys. Returns slice of the same length as keys, nil means absence of the key
+		GetMany(keys [][]byte) [][]byte
+	}
+
+	// KVZeroCopyReader is an optional interface of the KVReader. It is implemented by the stores which can pass
+	// the value to the caller without copying it. Use GetFunc function to read from any KVReader
+	KVZeroCopyReader interface {
+		// GetFunc calls f with the value of the key and returns true. Returns false if the key is absent.
+		// The value is only valid during the call and must not be modified or retained by f
+		GetFunc(key []byte, f func(value []byte)) bool
+	}
+
 	// KVWriter is a key/value writer
 	KVWriter interface {
 		// Set writes new or updates existing key with the value.
@@ -31,6 +51,27 @@ type (
 		IterateKeys(func(k []byte) bool)
 	}
 
+	// KVPrefixDropper is an optional interface of the KVStore. It is implemented by the stores which can delete
+	// all keys with the prefix without iterating them, like badger. Use ClearPartition to delete keys with
+	// the prefix from any store
+	KVPrefixDropper interface {
+		DropPrefix(prefixes ...[]byte) error
+	}
+
+	// KVPartitionPruner is an optional interface of the KVStore. It is implemented by the stores which can
+	// delete the whole partition (all keys with the prefix) almost instantly, without iterating the keys.
+	// ClearPartition uses it when available
+	KVPartitionPruner interface {
+		PrunePartition(prefix []byte) error
+	}
+
+	// KVTTLWriter is an optional interface of the KVStore. It is implemented by the stores which can expire
+	// the key automatically after the time-to-live, like badger. It is intended for ephemeral data
+	// stored alongside the trie, such as caches and proof blobs. The trie itself never writes with TTL
+	KVTTLWriter interface {
+		SetWithTTL(key, value []byte, ttl time.Duration)
+	}
+
 	// KVBatchedWriter collects Mutations in the buffer via Set-s to KVWriter and then flushes (applies) it atomically to DB with Commit
 	// KVBatchedWriter implementation should be deterministic: the sequence of Set-s to KWWriter exactly determines
 	// the sequence, how key/value pairs in the database are updated or deleted (with value == nil)
@@ -50,6 +91,12 @@ type (
 		Traversable
 	}
 
+	// KVTraversableStore is a KVStore which can be traversed
+	KVTraversableStore interface {
+		KVStore
+		Traversable
+	}
+
 	// BatchedUpdatable is a KVStore equipped with the batched update capability. You can only update
 	// BatchedUpdatable in atomic batches
 	BatchedUpdatable interface {
@@ -70,6 +117,95 @@ func CopyAll(dst KVWriter, src KVIterator) {
 	})
 }
 
+// GetMany reads many keys in one round trip if the reader implements KVBatchedReader, otherwise key by key
+func GetMany(r KVReader, keys [][]byte) [][]byte {
+	if br, ok := r.(KVBatchedReader); ok {
+		return br.GetMany(keys)
+	}
+	ret := make([][]byte, len(keys))
+	for i, k := range keys {
+		ret[i] = r.Get(k)
+	}
+	return ret
+}
+
+// HasMany checks presence of many keys in one round trip if the reader implements KVBatchedReader,
+// otherwise key by key
+func HasMany(r KVReader, keys [][]byte) []bool {
+	ret := make([]bool, len(keys))
+	if br, ok := r.(KVBatchedReader); ok {
+		for i, v := range br.GetMany(keys) {
+			ret[i] = len(v) > 0
+		}
+		return ret
+	}
+	for i, k := range keys {
+		ret[i] = r.Has(k)
+	}
+	return ret
+}
+
+// GetFunc reads value without copying if the reader implements KVZeroCopyReader, otherwise with Get.
+// The value is only valid during the call of f
+func GetFunc(r KVReader, key []byte, f func(value []byte)) bool {
+	if zr, ok := r.(KVZeroCopyReader); ok {
+		return zr.GetFunc(key, f)
+	}
+	v := r.Get(key)
+	if len(v) == 0 {
+		return false
+	}
+	f(v)
+	return true
+}
+
+// clearPartitionChunk maximum number of keys deleted in one batch by ClearPartition
+const clearPartitionChunk = 10000
+
+// ClearPartition deletes all keys with the prefix using the most efficient mechanism of the store:
+// PrunePartition if the store implements KVPartitionPruner, DropPrefix if it implements KVPrefixDropper,
+// otherwise keys are iterated and deleted in batches (if the store is BatchedUpdatable) of limited size,
+// so the memory is bounded
+func ClearPartition(store KVTraversableStore, prefix []byte) error {
+	Assertf(len(prefix) > 0, "ClearPartition: prefix can't be empty")
+	if p, ok := store.(KVPartitionPruner); ok {
+		return p.PrunePartition(prefix)
+	}
+	if d, ok := store.(KVPrefixDropper); ok {
+		return d.DropPrefix(prefix)
+	}
+	keys := make([][]byte, 0)
+	for {
+		keys = keys[:0]
+		store.Iterator(prefix).IterateKeys(func(k []byte) bool {
+			if bytes.HasPrefix(k, prefix) {
+				keys = append(keys, Concat(k))
+			}
+			return len(keys) < clearPartitionChunk
+		})
+		if len(keys) == 0 {
+			return nil
+		}
+		var w KVWriter = store
+		var batch KVBatchedWriter
+		if b, ok := store.(BatchedUpdatable); ok {
+			batch = b.BatchedWriter()
+			w = batch
+		}
+		for _, k := range keys {
+			w.Set(k, nil)
+		}
+		if batch != nil {
+			if err := batch.Commit(); err != nil {
+				return err
+			}
+		}
+		if len(keys) < clearPartitionChunk {
+			return nil
+		}
+	}
+}
+
 func HasWithPrefix(r Traversable, prefix []byte) bool {
 	ret := false
 	r.Iterator(prefix).IterateKeys(func(_ []byte) bool {
@@ -0,0 +1,27 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearPartition(t *testing.T) {
+	for _, store := range []KVTraversableStore{NewInMemoryKVStore(), NewCOWKVStore()} {
+		for i := 0; i < 2*clearPartitionChunk+10; i++ {
+			store.Set([]byte(fmt.Sprintf("a%d", i)), []byte("value"))
+		}
+		for i := 0; i < 10; i++ {
+			store.Set([]byte(fmt.Sprintf("b%d", i)), []byte("value"))
+		}
+		require.NoError(t, ClearPartition(store, []byte("a")))
+		require.False(t, HasWithPrefix(store, []byte("a")))
+		n := 0
+		store.Iterator(nil).IterateKeys(func(k []byte) bool {
+			n++
+			return true
+		})
+		require.EqualValues(t, 10, n)
+	}
+}
@@ -0,0 +1,322 @@
+package common
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ----------------------------------------------------------------------------
+// COWKVStore is an in-memory KVStore based on the persistent (immutable) balanced search tree.
+// Each write creates the new version of the tree by copying the path to the changed key (copy-on-write),
+// so the previous versions remain untouched:
+// - readers never lock and are never blocked by writers
+// - Snapshot is O(1) and is not affected by later writes
+// - iteration is in lexicographic order of keys
+// Writers are serialized by the mutex. The batch is applied atomically: readers see either all or none of its changes.
+// The tree is a treap with priorities derived from the hash of the key, so its shape is deterministic
+var (
+	_ KVStore             = &COWKVStore{}
+	_ BatchedUpdatable    = &COWKVStore{}
+	_ Traversable         = &COWKVStore{}
+	_ KVZeroCopyReader    = &COWKVStore{}
+	_ KVTraversableReader = &COWSnapshot{}
+	_ KVZeroCopyReader    = &COWSnapshot{}
+)
+
+type (
+	COWKVStore struct {
+		writeMutex sync.Mutex
+		// always contains COWSnapshot
+		current atomic.Value
+	}
+
+	// COWSnapshot is the immutable version of the COWKVStore
+	COWSnapshot struct {
+		root *cowNode
+		size int
+	}
+
+	cowNode struct {
+		key         string
+		value       []byte
+		priority    uint32
+		left, right *cowNode
+	}
+
+	cowBatchedWriter struct {
+		store     *COWKVStore
+		mutations *Mutations
+	}
+
+	cowIterator struct {
+		snapshot COWSnapshot
+		prefix   []byte
+	}
+)
+
+func NewCOWKVStore() *COWKVStore {
+	ret := &COWKVStore{}
+	ret.current.Store(COWSnapshot{})
+	return ret
+}
+
+// Snapshot returns the current version of the store. O(1)
+func (s *COWKVStore) Snapshot() *COWSnapshot {
+	ret := s.current.Load().(COWSnapshot)
+	return &ret
+}
+
+func (s *COWKVStore) Get(key []byte) []byte {
+	return s.Snapshot().Get(key)
+}
+
+func (s *COWKVStore) GetFunc(key []byte, f func(value []byte)) bool {
+	return s.Snapshot().GetFunc(key, f)
+}
+
+func (s *COWKVStore) Has(key []byte) bool {
+	return s.Snapshot().Has(key)
+}
+
+func (s *COWKVStore) Len() int {
+	return s.Snapshot().Len()
+}
+
+func (s *COWKVStore) Iterator(prefix []byte) KVIterator {
+	return s.Snapshot().Iterator(prefix)
+}
+
+func (s *COWKVStore) Set(key, value []byte) {
+	s.update(func(snap *COWSnapshot) {
+		snap.set(key, value)
+	})
+}
+
+func (s *COWKVStore) BatchedWriter() KVBatchedWriter {
+	return &cowBatchedWriter{
+		store:     s,
+		mutations: NewMutations(),
+	}
+}
+
+// update applies changes to the copy of the current version and makes the result current
+func (s *COWKVStore) update(fun func(snap *COWSnapshot)) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	snap := s.current.Load().(COWSnapshot)
+	fun(&snap)
+	s.current.Store(snap)
+}
+
+func (w *cowBatchedWriter) Set(key, value []byte) {
+	w.mutations.Set(key, value)
+}
+
+func (w *cowBatchedWriter) Commit() error {
+	w.store.update(func(snap *COWSnapshot) {
+		w.mutations.Iterate(func(k []byte, v []byte, _ bool) bool {
+			snap.set(k, v)
+			return true
+		})
+	})
+	w.mutations = nil // invalidate
+	return nil
+}
+
+func (s *COWSnapshot) Get(key []byte) []byte {
+	n := s.root.find(string(key))
+	if n == nil {
+		return nil
+	}
+	return Concat(n.value)
+}
+
+// GetFunc passes stored value to f without copying
+func (s *COWSnapshot) GetFunc(key []byte, f func(value []byte)) bool {
+	n := s.root.find(string(key))
+	if n == nil {
+		return false
+	}
+	f(n.value)
+	return true
+}
+
+func (s *COWSnapshot) Has(key []byte) bool {
+	return s.root.find(string(key)) != nil
+}
+
+func (s *COWSnapshot) Len() int {
+	return s.size
+}
+
+func (s *COWSnapshot) Iterator(prefix []byte) KVIterator {
+	return &cowIterator{
+		snapshot: *s,
+		prefix:   prefix,
+	}
+}
+
+// set changes the snapshot in place by replacing its root. Shared nodes are never modified
+func (s *COWSnapshot) set(key, value []byte) {
+	var existed bool
+	if len(value) == 0 {
+		s.root, existed = s.root.delete(string(key))
+		if existed {
+			s.size--
+		}
+		return
+	}
+	s.root, existed = s.root.insert(string(key), Concat(value), cowPriority(key))
+	if !existed {
+		s.size++
+	}
+}
+
+func (it *cowIterator) Iterate(f func(k []byte, v []byte) bool) {
+	it.snapshot.root.iterate(string(it.prefix), f)
+}
+
+func (it *cowIterator) IterateKeys(f func(k []byte) bool) {
+	it.snapshot.root.iterate(string(it.prefix), func(k, _ []byte) bool {
+		return f(k)
+	})
+}
+
+func cowPriority(key []byte) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return h.Sum32()
+}
+
+func (n *cowNode) find(key string) *cowNode {
+	for n != nil {
+		switch {
+		case key < n.key:
+			n = n.left
+		case key > n.key:
+			n = n.right
+		default:
+			return n
+		}
+	}
+	return nil
+}
+
+func (n *cowNode) clone() *cowNode {
+	ret := *n
+	return &ret
+}
+
+// insert returns new version of the subtree and flag if the key existed before
+func (n *cowNode) insert(key string, value []byte, priority uint32) (*cowNode, bool) {
+	if n == nil {
+		return &cowNode{key: key, value: value, priority: priority}, false
+	}
+	ret := n.clone()
+	var existed bool
+	switch {
+	case key < n.key:
+		ret.left, existed = n.left.insert(key, value, priority)
+		if ret.left.priority > ret.priority {
+			ret = ret.rotateRight()
+		}
+	case key > n.key:
+		ret.right, existed = n.right.insert(key, value, priority)
+		if ret.right.priority > ret.priority {
+			ret = ret.rotateLeft()
+		}
+	default:
+		ret.value = value
+		existed = true
+	}
+	return ret, existed
+}
+
+// rotateRight and rotateLeft are only called on the nodes and children which were just copied
+
+func (n *cowNode) rotateRight() *cowNode {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	return l
+}
+
+func (n *cowNode) rotateLeft() *cowNode {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	return r
+}
+
+// delete returns new version of the subtree and flag if the key existed
+func (n *cowNode) delete(key string) (*cowNode, bool) {
+	if n == nil {
+		return nil, false
+	}
+	var existed bool
+	var ret *cowNode
+	switch {
+	case key < n.key:
+		var left *cowNode
+		if left, existed = n.left.delete(key); !existed {
+			return n, false
+		}
+		ret = n.clone()
+		ret.left = left
+	case key > n.key:
+		var right *cowNode
+		if right, existed = n.right.delete(key); !existed {
+			return n, false
+		}
+		ret = n.clone()
+		ret.right = right
+	default:
+		return cowMerge(n.left, n.right), true
+	}
+	return ret, true
+}
+
+// cowMerge merges two subtrees, all keys of a are less than keys of b
+func cowMerge(a, b *cowNode) *cowNode {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.priority > b.priority:
+		ret := a.clone()
+		ret.right = cowMerge(a.right, b)
+		return ret
+	default:
+		ret := b.clone()
+		ret.left = cowMerge(a, b.left)
+		return ret
+	}
+}
+
+// iterate visits keys with the prefix in lexicographic order. Returns false if stopped by f
+func (n *cowNode) iterate(prefix string, f func(k, v []byte) bool) bool {
+	if n == nil {
+		return true
+	}
+	// keys of the left subtree are less than n.key. If n.key < prefix, none of them can have the prefix
+	if n.key >= prefix {
+		if !n.left.iterate(prefix, f) {
+			return false
+		}
+	}
+	hasPrefix := strings.HasPrefix(n.key, prefix)
+	if hasPrefix {
+		if !f([]byte(n.key), n.value) {
+			return false
+		}
+	}
+	// keys of the right subtree are greater than n.key. If n.key is beyond the prefix range, so are they
+	if hasPrefix || n.key < prefix {
+		return n.right.iterate(prefix, f)
+	}
+	return true
+}
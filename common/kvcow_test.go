@@ -0,0 +1,116 @@
+package common
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCOWKVStore(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	store := NewCOWKVStore()
+	shadow := make(map[string]string)
+	for i := 0; i < 5000; i++ {
+		k := fmt.Sprintf("%x", rnd.Intn(1000))
+		if rnd.Intn(3) == 0 {
+			store.Set([]byte(k), nil)
+			delete(shadow, k)
+		} else {
+			v := fmt.Sprintf("v%d", i)
+			store.Set([]byte(k), []byte(v))
+			shadow[k] = v
+		}
+	}
+	require.EqualValues(t, len(shadow), store.Len())
+	keys := make([]string, 0, len(shadow))
+	for k, v := range shadow {
+		require.EqualValues(t, v, string(store.Get([]byte(k))))
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	iterated := make([]string, 0)
+	store.Iterator(nil).Iterate(func(k, v []byte) bool {
+		require.EqualValues(t, shadow[string(k)], string(v))
+		iterated = append(iterated, string(k))
+		return true
+	})
+	require.EqualValues(t, keys, iterated)
+
+	for _, prefix := range []string{"1", "a", "3e", "ff", "zz"} {
+		expected := make([]string, 0)
+		for _, k := range keys {
+			if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+				expected = append(expected, k)
+			}
+		}
+		iterated = iterated[:0]
+		store.Iterator([]byte(prefix)).IterateKeys(func(k []byte) bool {
+			iterated = append(iterated, string(k))
+			return true
+		})
+		require.EqualValues(t, expected, iterated)
+	}
+}
+
+func TestCOWSnapshot(t *testing.T) {
+	store := NewCOWKVStore()
+	store.Set([]byte("a"), []byte("1"))
+	store.Set([]byte("b"), []byte("2"))
+	snap := store.Snapshot()
+
+	w := store.BatchedWriter()
+	w.Set([]byte("a"), nil)
+	w.Set([]byte("c"), []byte("3"))
+	require.EqualValues(t, "1", string(store.Get([]byte("a"))))
+	require.NoError(t, w.Commit())
+
+	require.False(t, store.Has([]byte("a")))
+	require.EqualValues(t, "3", string(store.Get([]byte("c"))))
+	require.EqualValues(t, 2, store.Len())
+
+	require.EqualValues(t, "1", string(snap.Get([]byte("a"))))
+	require.False(t, snap.Has([]byte("c")))
+	require.EqualValues(t, 2, snap.Len())
+}
+
+func TestCOWConcurrentReaders(t *testing.T) {
+	store := NewCOWKVStore()
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// every batch writes all keys with the same value, so each snapshot must be consistent
+				var first string
+				store.Snapshot().Iterator(nil).Iterate(func(_, v []byte) bool {
+					if first == "" {
+						first = string(v)
+					}
+					require.EqualValues(t, first, string(v))
+					return true
+				})
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		w := store.BatchedWriter()
+		for k := 0; k < 100; k++ {
+			w.Set([]byte(fmt.Sprintf("k%d", k)), []byte(fmt.Sprintf("v%d", i)))
+		}
+		require.NoError(t, w.Commit())
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -8,6 +8,8 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,6 +18,8 @@ import (
 // InMemoryKVStore is a KVStore implementation. Mostly used for testing
 var (
 	_ KVStore          = &InMemoryKVStore{}
+	_ KVZeroCopyReader = &InMemoryKVStore{}
+	_ KVBatchedReader  = &InMemoryKVStore{}
 	_ BatchedUpdatable = &InMemoryKVStore{}
 	_ Traversable      = &InMemoryKVStore{}
 	_ KVBatchedWriter  = &simpleBatchedMemoryWriter{}
@@ -27,6 +31,8 @@ type (
 	InMemoryKVStore struct {
 		mutex sync.RWMutex
 		m     map[string][]byte
+		// if true, iterators visit keys in lexicographic order. See NewSortedInMemoryKVStore
+		sorted bool
 	}
 
 	mutation struct {
@@ -52,6 +58,14 @@ func NewInMemoryKVStore() *InMemoryKVStore {
 	}
 }
 
+// NewSortedInMemoryKVStore creates InMemoryKVStore which iterates keys in lexicographic order, so iterations
+// and snapshots are reproducible. Sorting costs O(N*log(N)) on each iteration
+func NewSortedInMemoryKVStore() *InMemoryKVStore {
+	ret := NewInMemoryKVStore()
+	ret.sorted = true
+	return ret
+}
+
 func (im *InMemoryKVStore) IsClosed() bool {
 	return false
 }
@@ -69,6 +83,33 @@ func (im *InMemoryKVStore) Get(k []byte) []byte {
 	return ret
 }
 
+// GetMany reads all keys under one read lock
+func (im *InMemoryKVStore) GetMany(keys [][]byte) [][]byte {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	ret := make([][]byte, len(keys))
+	for i, k := range keys {
+		if r := im.m[string(k)]; len(r) > 0 {
+			ret[i] = Concat(r)
+		}
+	}
+	return ret
+}
+
+// GetFunc calls f with the stored value, without copying it. The store is read-locked during the call
+func (im *InMemoryKVStore) GetFunc(k []byte, f func(value []byte)) bool {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	r := im.m[string(k)]
+	if len(r) == 0 {
+		return false
+	}
+	f(r)
+	return true
+}
+
 func (im *InMemoryKVStore) Has(k []byte) bool {
 	im.mutex.RLock()
 	defer im.mutex.RUnlock()
@@ -81,19 +122,41 @@ func (im *InMemoryKVStore) Iterate(f func(k []byte, v []byte) bool) {
 	im.mutex.RLock()
 	defer im.mutex.RUnlock()
 
-	for k, v := range im.m {
-		if !f([]byte(k), v) {
-			return
-		}
-	}
+	im.iterate(nil, f)
 }
 
 func (im *InMemoryKVStore) IterateKeys(f func(k []byte) bool) {
 	im.mutex.RLock()
 	defer im.mutex.RUnlock()
 
+	im.iterate(nil, func(k, _ []byte) bool {
+		return f(k)
+	})
+}
+
+// iterate iterates keys with prefix, in lexicographic order if the store is sorted. Must be called under the lock
+func (im *InMemoryKVStore) iterate(prefix []byte, f func(k []byte, v []byte) bool) {
+	if !im.sorted {
+		var key []byte
+		for k, v := range im.m {
+			key = []byte(k)
+			if bytes.HasPrefix(key, prefix) {
+				if !f(key, v) {
+					return
+				}
+			}
+		}
+		return
+	}
+	keys := make([]string, 0)
 	for k := range im.m {
-		if !f([]byte(k)) {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !f([]byte(k), im.m[k]) {
 			return
 		}
 	}
@@ -159,30 +222,16 @@ func (si *simpleInMemoryIterator) Iterate(f func(k []byte, v []byte) bool) {
 	si.store.mutex.RLock()
 	defer si.store.mutex.RUnlock()
 
-	var key []byte
-	for k, v := range si.store.m {
-		key = []byte(k)
-		if bytes.HasPrefix(key, si.prefix) {
-			if !f(key, v) {
-				return
-			}
-		}
-	}
+	si.store.iterate(si.prefix, f)
 }
 
 func (si *simpleInMemoryIterator) IterateKeys(f func(k []byte) bool) {
 	si.store.mutex.RLock()
 	defer si.store.mutex.RUnlock()
 
-	var key []byte
-	for k := range si.store.m {
-		key = []byte(k)
-		if bytes.HasPrefix(key, si.prefix) {
-			if !f(key) {
-				return
-			}
-		}
-	}
+	si.store.iterate(si.prefix, func(k, _ []byte) bool {
+		return f(k)
+	})
 }
 
 //----------------------------------------------------------------------------
@@ -214,32 +263,61 @@ func (p *KVPairOrError) IsNil() bool {
 	return len(p.Key) == 0 && len(p.Value) == 0
 }
 
-// KVStreamIteratorToChan makes channel out of KVStreamIterator
-func KVStreamIteratorToChan(iter KVStreamIterator, ctx context.Context) chan KVPairOrError {
-	ret := make(chan KVPairOrError)
+// KVStreamIteratorToChan makes channel out of KVStreamIterator. The channel is buffered with bufSize (default 0).
+// Pairs are copied, so the source may reuse slices. The channel is closed at the end of the stream.
+// If the iteration fails or is stopped by the cancellation of ctx, the error (ctx.Err() in case of cancellation)
+// is always delivered as the last element before the channel is closed. The consumer which stops early must
+// cancel ctx and drain the channel: no pairs are sent after the cancellation is noticed, only the terminal error
+func KVStreamIteratorToChan(iter KVStreamIterator, ctx context.Context, bufSize ...int) chan KVPairOrError {
+	size := 0
+	if len(bufSize) > 0 {
+		size = bufSize[0]
+	}
+	ret := make(chan KVPairOrError, size)
 	go func() {
+		defer close(ret)
+
+		cancelled := false
 		err := iter.Iterate(func(k, v []byte) bool {
+			if ctx.Err() != nil {
+				cancelled = true
+				return false
+			}
 			select {
 			case <-ctx.Done():
+				cancelled = true
 				return false
-			default:
-				ret <- KVPairOrError{
-					Key:   k,
-					Value: v,
-				}
+			case ret <- KVPairOrError{Key: Concat(k), Value: Concat(v)}:
+				return true
 			}
-			return true
 		})
+		if err == nil && cancelled {
+			err = ctx.Err()
+		}
 		if err != nil {
 			ret <- KVPairOrError{
 				Err: err,
 			}
 		}
-		close(ret)
 	}()
 	return ret
 }
 
+// KVStreamFromChan writes pairs arriving on the channel to the writer until the channel is closed.
+// Returns the first error arriving on the channel or returned by the writer. In case of error the
+// channel is not drained: the producer must be stopped by the caller, e.g. by cancelling its context
+func KVStreamFromChan(ch <-chan KVPairOrError, w KVStreamWriter) error {
+	for p := range ch {
+		if p.Err != nil {
+			return p.Err
+		}
+		if err := w.Write(p.Key, p.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //----------------------------------------------------------------------------
 // implementations of writing/reading persistent streams of key/value pairs
 
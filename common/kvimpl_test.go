@@ -0,0 +1,104 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortedInMemoryKVStore(t *testing.T) {
+	store := NewSortedInMemoryKVStore()
+	expected := make([]string, 0)
+	for i := 0; i < 200; i++ {
+		k := fmt.Sprintf("%x", i*7919)
+		store.Set([]byte(k), []byte("v"+k))
+		expected = append(expected, k)
+	}
+	sort.Strings(expected)
+
+	keys := make([]string, 0)
+	store.Iterate(func(k, v []byte) bool {
+		require.EqualValues(t, "v"+string(k), string(v))
+		keys = append(keys, string(k))
+		return true
+	})
+	require.EqualValues(t, expected, keys)
+
+	keys = keys[:0]
+	store.IterateKeys(func(k []byte) bool {
+		keys = append(keys, string(k))
+		return true
+	})
+	require.EqualValues(t, expected, keys)
+
+	expectedWithPrefix := make([]string, 0)
+	for _, k := range expected {
+		if k[0] == 'a' {
+			expectedWithPrefix = append(expectedWithPrefix, k)
+		}
+	}
+	keys = keys[:0]
+	store.Iterator([]byte("a")).Iterate(func(k, _ []byte) bool {
+		keys = append(keys, string(k))
+		return true
+	})
+	require.EqualValues(t, expectedWithPrefix, keys)
+
+	keys = keys[:0]
+	store.Iterator([]byte("a")).IterateKeys(func(k []byte) bool {
+		keys = append(keys, string(k))
+		return len(keys) < 3
+	})
+	require.EqualValues(t, expectedWithPrefix[:3], keys)
+}
+
+func TestKVStreamIteratorToChan(t *testing.T) {
+	const n = 1000
+	t.Run("complete", func(t *testing.T) {
+		ch := KVStreamIteratorToChan(NewRandStreamIterator(RandStreamParams{Seed: 1, NumKVPairs: n, MaxKey: 10, MaxValue: 10}), context.Background(), 10)
+		var buf bytes.Buffer
+		w := NewBinaryStreamWriter(&buf)
+		require.NoError(t, KVStreamFromChan(ch, w))
+		count, _ := w.Stats()
+		require.EqualValues(t, n, count)
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := KVStreamIteratorToChan(NewRandStreamIterator(RandStreamParams{Seed: 1, MaxKey: 10, MaxValue: 10}), ctx, 10)
+		for i := 0; i < 5; i++ {
+			p := <-ch
+			require.NoError(t, p.Err)
+		}
+		cancel()
+		var lastErr error
+		for p := range ch {
+			lastErr = p.Err
+		}
+		require.ErrorIs(t, lastErr, context.Canceled)
+	})
+	t.Run("iteration error", func(t *testing.T) {
+		var buf bytes.Buffer
+		w := NewBinaryStreamWriter(&buf)
+		require.NoError(t, w.Write([]byte("a"), []byte("b")))
+		buf.Write([]byte{5})
+		ch := KVStreamIteratorToChan(NewBinaryStreamIterator(&buf), context.Background())
+		var out bytes.Buffer
+		require.Error(t, KVStreamFromChan(ch, NewBinaryStreamWriter(&out)))
+	})
+}
+
+func TestInMemoryGetMany(t *testing.T) {
+	s := NewInMemoryKVStore()
+	s.Set([]byte("a"), []byte("1"))
+	s.Set([]byte("b"), []byte("2"))
+
+	values := s.GetMany([][]byte{[]byte("b"), []byte("c"), []byte("a")})
+	require.EqualValues(t, [][]byte{[]byte("2"), nil, []byte("1")}, values)
+
+	values[0][0] = 'x'
+	require.EqualValues(t, "2", string(s.Get([]byte("b"))))
+}
@@ -0,0 +1,167 @@
+package common
+
+import (
+	"sort"
+	"sync"
+)
+
+// Metrics is an optional sink of metrics of the trie and of the key/value store adaptors.
+// The names of metrics follow Prometheus conventions: counters end with '_total', histograms are in base units
+type Metrics interface {
+	// AddCounter adds delta to the counter
+	AddCounter(name string, delta uint64)
+	// Observe adds the observation to the histogram
+	Observe(name string, value float64)
+}
+
+const (
+	// MetricNodeGets number of trie nodes requested from the node store, including cache hits
+	MetricNodeGets = "unitrie_node_gets_total"
+	// MetricNodeCacheHits number of trie nodes found in the node cache
+	MetricNodeCacheHits = "unitrie_node_cache_hits_total"
+	// MetricValueGets number of values read from the value partitions
+	MetricValueGets = "unitrie_value_gets_total"
+	// MetricNodesWritten number of trie nodes written by commits
+	MetricNodesWritten = "unitrie_nodes_written_total"
+	// MetricCommitDuration duration of the trie commit in seconds
+	MetricCommitDuration = "unitrie_commit_duration_seconds"
+	// MetricStoreGets number of Get and Has calls to the store
+	MetricStoreGets = "unitrie_store_gets_total"
+	// MetricStoreSets number of keys written or deleted in the store, including batches
+	MetricStoreSets = "unitrie_store_sets_total"
+	// MetricStoreBatchCommitDuration duration of the batch commit in the store in seconds
+	MetricStoreBatchCommitDuration = "unitrie_store_batch_commit_duration_seconds"
+	// MetricStoreGCRewrites number of files rewritten by the garbage collection of the store
+	MetricStoreGCRewrites = "unitrie_store_gc_rewrites_total"
+)
+
+// NoMetrics is the default no-op Metrics
+type NoMetrics struct{}
+
+var _ Metrics = NoMetrics{}
+
+func (NoMetrics) AddCounter(_ string, _ uint64) {}
+func (NoMetrics) Observe(_ string, _ float64)   {}
+
+// DefaultHistogramBuckets upper bounds of histogram buckets, in seconds
+var DefaultHistogramBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type (
+	// InMemoryMetrics is a thread-safe Metrics which keeps counters and histograms in memory.
+	// It is ready to be exported to Prometheus without any conversion: Collect provides counters and
+	// histograms with cumulative buckets, as expected by the Prometheus constant metrics
+	InMemoryMetrics struct {
+		mutex      sync.RWMutex
+		buckets    []float64
+		counters   map[string]uint64
+		histograms map[string]*HistogramSnapshot
+	}
+
+	// HistogramSnapshot is the state of the histogram
+	HistogramSnapshot struct {
+		Count uint64
+		Sum   float64
+		// Buckets number of observations less or equal to the upper bound. Cumulative
+		Buckets map[float64]uint64
+	}
+)
+
+var _ Metrics = &InMemoryMetrics{}
+
+// NewInMemoryMetrics creates InMemoryMetrics with the upper bounds of histogram buckets.
+// If buckets are not specified, DefaultHistogramBuckets are used
+func NewInMemoryMetrics(buckets ...float64) *InMemoryMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	return &InMemoryMetrics{
+		buckets:    b,
+		counters:   make(map[string]uint64),
+		histograms: make(map[string]*HistogramSnapshot),
+	}
+}
+
+func (m *InMemoryMetrics) AddCounter(name string, delta uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.counters[name] += delta
+}
+
+func (m *InMemoryMetrics) Observe(name string, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	h, ok := m.histograms[name]
+	if !ok {
+		h = &HistogramSnapshot{Buckets: make(map[float64]uint64)}
+		for _, b := range m.buckets {
+			h.Buckets[b] = 0
+		}
+		m.histograms[name] = h
+	}
+	h.Count++
+	h.Sum += value
+	for _, b := range m.buckets {
+		if value <= b {
+			h.Buckets[b]++
+		}
+	}
+}
+
+// Counter returns value of the counter, 0 if it does not exist
+func (m *InMemoryMetrics) Counter(name string) uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.counters[name]
+}
+
+// Histogram returns copy of the histogram. Returns false if it does not exist
+func (m *InMemoryMetrics) Histogram(name string) (HistogramSnapshot, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	h, ok := m.histograms[name]
+	if !ok {
+		return HistogramSnapshot{}, false
+	}
+	return h.clone(), true
+}
+
+// Collect calls functions for all counters and histograms in the order of names. Intended to be called from
+// the Collect method of the Prometheus collector
+func (m *InMemoryMetrics) Collect(counterFun func(name string, value uint64), histogramFun func(name string, h HistogramSnapshot)) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, name := range sortedKeys(m.counters) {
+		counterFun(name, m.counters[name])
+	}
+	for _, name := range sortedKeys(m.histograms) {
+		histogramFun(name, m.histograms[name].clone())
+	}
+}
+
+func (h *HistogramSnapshot) clone() HistogramSnapshot {
+	ret := HistogramSnapshot{
+		Count:   h.Count,
+		Sum:     h.Sum,
+		Buckets: make(map[float64]uint64, len(h.Buckets)),
+	}
+	for b, c := range h.Buckets {
+		ret.Buckets[b] = c
+	}
+	return ret
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
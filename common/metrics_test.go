@@ -0,0 +1,33 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryMetrics(t *testing.T) {
+	m := NewInMemoryMetrics(1, 10, 0.1)
+	m.AddCounter("b_total", 2)
+	m.AddCounter("a_total", 1)
+	m.AddCounter("b_total", 3)
+	require.EqualValues(t, 5, m.Counter("b_total"))
+	require.EqualValues(t, 0, m.Counter("c_total"))
+
+	for _, v := range []float64{0.05, 0.5, 5, 50} {
+		m.Observe("h_seconds", v)
+	}
+	h, ok := m.Histogram("h_seconds")
+	require.True(t, ok)
+	require.EqualValues(t, 4, h.Count)
+	require.InDelta(t, 55.55, h.Sum, 1e-9)
+	require.EqualValues(t, map[float64]uint64{0.1: 1, 1: 2, 10: 3}, h.Buckets)
+
+	names := make([]string, 0)
+	m.Collect(func(name string, _ uint64) {
+		names = append(names, name)
+	}, func(name string, h HistogramSnapshot) {
+		names = append(names, name)
+	})
+	require.EqualValues(t, []string{"a_total", "b_total", "h_seconds"}, names)
+}
@@ -37,6 +37,22 @@ type CommitmentModel interface {
 	ShortName() string
 }
 
+// PositionDependentModel is the optional property of the CommitmentModel
+type PositionDependentModel interface {
+	// CommitmentsDependOnPosition returns false if the commitment of the node does not commit to the position of the
+	// node in the trie. Then equal subtrees at different positions have equal commitments and share records in the store
+	CommitmentsDependOnPosition() bool
+}
+
+// CommitmentsDependOnPosition returns true if commitments of the model commit to the positions of nodes.
+// Models which do not implement PositionDependentModel are assumed to commit to positions
+func CommitmentsDependOnPosition(m CommitmentModel) bool {
+	if p, ok := m.(PositionDependentModel); ok {
+		return p.CommitmentsDependOnPosition()
+	}
+	return true
+}
+
 // NodeData contains all data trie node needs to compute commitment
 type NodeData struct {
 	PathFragment     []byte
@@ -52,26 +68,38 @@ type PathArity byte
 const (
 	PathArity256 = PathArity(255)
 	PathArity16  = PathArity(15)
+	PathArity4   = PathArity(3)
 	PathArity2   = PathArity(1)
 )
 
-var AllPathArity = []PathArity{PathArity256, PathArity16, PathArity2}
+var AllPathArity = []PathArity{PathArity256, PathArity16, PathArity4, PathArity2}
 
 func (a PathArity) String() string {
 	switch a {
-	case PathArity256, PathArity16, PathArity2:
+	case PathArity256, PathArity16, PathArity4, PathArity2:
 		return fmt.Sprintf("PathArity%d", int(a)+1)
 	default:
 		return "PathArity(wrong)"
 	}
 }
 
+// IsValid checks if the value is one of the supported path arities
+func (a PathArity) IsValid() bool {
+	switch a {
+	case PathArity256, PathArity16, PathArity4, PathArity2:
+		return true
+	}
+	return false
+}
+
 func (a PathArity) TerminalCommitmentIndex() int {
 	switch a {
 	case PathArity256:
 		return 256
 	case PathArity16:
 		return 16
+	case PathArity4:
+		return 4
 	case PathArity2:
 		return 2
 	}
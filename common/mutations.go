@@ -1,6 +1,8 @@
 package common
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -9,8 +11,17 @@ type Mutations struct {
 	set                 map[string][]byte
 	del                 map[string]struct{}
 	mustNoDoubleBooking func(error) // is called on double setting and double deleting
+	// size is total size of mutated keys and of set values in bytes
+	size int
+	// if maxSize > 0, onMaxSize is called when size exceeds maxSize. See SetMaxSize
+	maxSize   int
+	onMaxSize func(error)
+	// previous staged values of overwritten keys. Nil if not in overwrite mode. See NewMutationsOverwrite
+	previous map[string][]byte
 }
 
+var ErrMutationsTooLarge = errors.New("size of mutations exceeds the limit")
+
 func NewMutations(doubleBookingCallback ...func(error)) *Mutations {
 	ret := &Mutations{
 		set: make(map[string][]byte),
@@ -28,8 +39,25 @@ func NewMutationsMustNoDoubleBooking() *Mutations {
 	})
 }
 
+// NewMutationsOverwrite creates mutations in the overwrite mode: repeated Set of the same key is allowed and
+// the previous staged value of the key is recorded, see Previous. It is intended for interactive editing,
+// which legitimately touches keys many times before the commit
+func NewMutationsOverwrite() *Mutations {
+	ret := NewMutations()
+	ret.previous = make(map[string][]byte)
+	return ret
+}
+
 func (m *Mutations) Set(k, v []byte) {
 	ks := string(k)
+	if m.previous != nil {
+		if prev, staged := m.Lookup(k); staged {
+			m.previous[ks] = prev
+		}
+	}
+	sizeBefore := m.size
+	m.account(ks, v)
+	defer m.checkMaxSize(sizeBefore)
 	if m.mustNoDoubleBooking != nil {
 		if len(v) > 0 {
 			// set
@@ -56,6 +84,141 @@ func (m *Mutations) Set(k, v []byte) {
 	}
 }
 
+// account updates size of the mutations before the key is set to v
+func (m *Mutations) account(ks string, v []byte) {
+	prev, inSet := m.set[ks]
+	_, inDel := m.del[ks]
+	if !inSet && !inDel {
+		m.size += len(ks)
+	}
+	m.size += len(v) - len(prev)
+}
+
+// checkMaxSize calls the callback if the size crossed the limit
+func (m *Mutations) checkMaxSize(sizeBefore int) {
+	if m.maxSize > 0 && m.size > m.maxSize && sizeBefore <= m.maxSize {
+		m.onMaxSize(fmt.Errorf("%w: %d bytes, the limit is %d", ErrMutationsTooLarge, m.size, m.maxSize))
+	}
+}
+
+// Size returns total size in bytes of mutated keys and of set values
+func (m *Mutations) Size() int {
+	return m.size
+}
+
+// SetMaxSize sets the limit of Size in bytes. When the size exceeds the limit, onExceeded is called with
+// ErrMutationsTooLarge. It is called once each time the limit is crossed. By default, it panics with the error.
+// Limit 0 means no limit
+func (m *Mutations) SetMaxSize(maxBytes int, onExceeded ...func(error)) {
+	m.maxSize = maxBytes
+	m.onMaxSize = func(err error) {
+		panic(err)
+	}
+	if len(onExceeded) > 0 {
+		m.onMaxSize = onExceeded[0]
+	}
+}
+
+// Swap sets the key and returns its previously staged mutation: value or nil for deletion.
+// Returns false if the key was not staged
+func (m *Mutations) Swap(k, v []byte) (prev []byte, staged bool) {
+	prev, staged = m.Lookup(k)
+	m.Set(k, v)
+	return
+}
+
+// Previous returns the value staged for the key before the last Set, nil if it was staged as deleted.
+// Returns false if the key was staged only once or the mutations are not in the overwrite mode
+func (m *Mutations) Previous(k []byte) ([]byte, bool) {
+	prev, ok := m.previous[string(k)]
+	return prev, ok
+}
+
+// Lookup returns the mutation of the key. Returns false if the key is not mutated.
+// Returns nil and true if the key is deleted
+func (m *Mutations) Lookup(k []byte) ([]byte, bool) {
+	ks := string(k)
+	if _, deleted := m.del[ks]; deleted {
+		return nil, true
+	}
+	v, ok := m.set[ks]
+	return v, ok
+}
+
+// Inverse returns mutations which roll back the mutations m applied to the state of the reader. It must be called
+// before m is applied: previous values of all mutated keys are read from the reader (with one GetMany if the reader
+// implements KVBatchedReader). Keys which are not changed by m are not included
+func (m *Mutations) Inverse(reader KVReader) *Mutations {
+	keys := make([][]byte, 0, len(m.set)+len(m.del))
+	newValues := make([][]byte, 0, len(m.set)+len(m.del))
+	m.Iterate(func(k []byte, v []byte, _ bool) bool {
+		keys = append(keys, k)
+		newValues = append(newValues, v)
+		return true
+	})
+	ret := NewMutations()
+	for i, prev := range GetMany(reader, keys) {
+		if !bytes.Equal(prev, newValues[i]) {
+			ret.Set(keys[i], prev)
+		}
+	}
+	return ret
+}
+
+// Filtered returns mutations with keys under the prefix. Keys are not changed. Values are shared with m
+func (m *Mutations) Filtered(prefix []byte) *Mutations {
+	return m.filtered(func(ks string) bool {
+		return strings.HasPrefix(ks, string(prefix))
+	})
+}
+
+// Partitioned splits mutations by the first byte of the key, e.g. by the partition of the store.
+// Keys are not changed. Values are shared with m. The empty key can't be partitioned
+func (m *Mutations) Partitioned() map[byte]*Mutations {
+	ret := make(map[byte]*Mutations)
+	add := func(ks string) *Mutations {
+		Assertf(len(ks) > 0, "Partitioned: empty key can't be partitioned")
+		p, ok := ret[ks[0]]
+		if !ok {
+			p = NewMutations()
+			ret[ks[0]] = p
+		}
+		return p
+	}
+	for ks, v := range m.set {
+		p := add(ks)
+		p.set[ks] = v
+		p.size += len(ks) + len(v)
+	}
+	for ks := range m.del {
+		p := add(ks)
+		if _, inSet := p.set[ks]; !inSet {
+			p.size += len(ks)
+		}
+		p.del[ks] = struct{}{}
+	}
+	return ret
+}
+
+func (m *Mutations) filtered(pred func(ks string) bool) *Mutations {
+	ret := NewMutations()
+	for ks, v := range m.set {
+		if pred(ks) {
+			ret.set[ks] = v
+			ret.size += len(ks) + len(v)
+		}
+	}
+	for ks := range m.del {
+		if pred(ks) {
+			if _, inSet := ret.set[ks]; !inSet {
+				ret.size += len(ks)
+			}
+			ret.del[ks] = struct{}{}
+		}
+	}
+	return ret
+}
+
 // TODO correctly manage DEL mutations
 
 func (m *Mutations) Apply(mut *Mutations) {
@@ -0,0 +1,193 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+)
+
+// NodeDataCodec is the serialization of the node data. The native binary serialization (see NodeData.Write)
+// is used by the trie store, alternative codecs are for interoperability with other tooling.
+// The terminal commitment is always serialized with the node
+type NodeDataCodec interface {
+	EncodeNodeData(n *NodeData, arity PathArity) ([]byte, error)
+	DecodeNodeData(data []byte, model CommitmentModel, arity PathArity) (*NodeData, error)
+}
+
+var (
+	NodeDataCodecBinary   NodeDataCodec = nodeDataCodecBinary{}
+	NodeDataCodecRLP      NodeDataCodec = nodeDataCodecRLP{}
+	NodeDataCodecProtobuf NodeDataCodec = nodeDataCodecProtobuf{}
+)
+
+var errTerminalNotInNode = errors.New("terminal commitment is not serialized with the node")
+
+type (
+	nodeDataCodecBinary   struct{}
+	nodeDataCodecRLP      struct{}
+	nodeDataCodecProtobuf struct{}
+)
+
+func (nodeDataCodecBinary) EncodeNodeData(n *NodeData, arity PathArity) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := n.Write(&buf, arity, false); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (nodeDataCodecBinary) DecodeNodeData(data []byte, model CommitmentModel, arity PathArity) (*NodeData, error) {
+	return NodeDataFromBytes(model, data, arity, func(_ []byte) ([]byte, error) {
+		return nil, errTerminalNotInNode
+	})
+}
+
+// EncodeNodeData encodes node as RLP list of the encoded path fragment, the list of zero or one
+// terminal commitment and the list of children. Each child is the list of the child index and the commitment
+func (nodeDataCodecRLP) EncodeNodeData(n *NodeData, arity PathArity) ([]byte, error) {
+	pathFragment, err := EncodeUnpackedBytes(n.PathFragment, arity)
+	if err != nil {
+		return nil, err
+	}
+	terminal := make([][]byte, 0, 1)
+	if !IsNil(n.Terminal) {
+		terminal = append(terminal, RLPEncodeBytes(n.Terminal.Bytes()))
+	}
+	children := make([][]byte, 0, len(n.ChildCommitments))
+	for i := 0; i <= int(arity); i++ {
+		c, ok := n.ChildCommitments[byte(i)]
+		if !ok {
+			continue
+		}
+		children = append(children, RLPEncodeList(RLPEncodeUint(uint64(i)), RLPEncodeBytes(c.Bytes())))
+	}
+	return RLPEncodeList(RLPEncodeBytes(pathFragment), RLPEncodeList(terminal...), RLPEncodeList(children...)), nil
+}
+
+func (nodeDataCodecRLP) DecodeNodeData(data []byte, model CommitmentModel, arity PathArity) (*NodeData, error) {
+	item, err := RLPDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := item.ListOf(3)
+	if err != nil {
+		return nil, err
+	}
+	ret := NewNodeData()
+	pathFragment, err := fields[0].ByteString()
+	if err != nil {
+		return nil, err
+	}
+	if ret.PathFragment, err = DecodeToUnpackedBytes(pathFragment, arity); err != nil {
+		return nil, err
+	}
+	if !fields[1].IsList || len(fields[1].List) > 1 {
+		return nil, ErrWrongRLP
+	}
+	if len(fields[1].List) == 1 {
+		terminal, err := fields[1].List[0].ByteString()
+		if err != nil {
+			return nil, err
+		}
+		if ret.Terminal, err = TerminalCommitmentFromBytes(model, terminal); err != nil {
+			return nil, err
+		}
+	}
+	if !fields[2].IsList {
+		return nil, ErrWrongRLP
+	}
+	for _, child := range fields[2].List {
+		pair, err := child.ListOf(2)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := pair[0].Uint()
+		if err != nil {
+			return nil, err
+		}
+		if idx > uint64(arity) {
+			return nil, ErrWrongRLP
+		}
+		if _, already := ret.ChildCommitments[byte(idx)]; already {
+			return nil, ErrWrongRLP
+		}
+		c, err := pair[1].ByteString()
+		if err != nil {
+			return nil, err
+		}
+		if ret.ChildCommitments[byte(idx)], err = VectorCommitmentFromBytes(model, c); err != nil {
+			return nil, err
+		}
+	}
+	if IsNil(ret.Terminal) && len(ret.ChildCommitments) == 0 {
+		return nil, ErrWrongRLP
+	}
+	return ret, nil
+}
+
+// EncodeNodeData encodes node as NodeData protobuf message, see proto/unitrie.proto
+func (nodeDataCodecProtobuf) EncodeNodeData(n *NodeData, arity PathArity) ([]byte, error) {
+	pathFragment, err := EncodeUnpackedBytes(n.PathFragment, arity)
+	if err != nil {
+		return nil, err
+	}
+	ret := ProtobufAppendBytes(nil, 1, pathFragment)
+	if !IsNil(n.Terminal) {
+		ret = ProtobufAppendField(ret, 2, n.Terminal.Bytes())
+	}
+	for i := 0; i <= int(arity); i++ {
+		if c, ok := n.ChildCommitments[byte(i)]; ok {
+			ret = ProtobufAppendField(ret, 3, ProtobufEncodeChild(byte(i), c.Bytes()))
+		}
+	}
+	return ret, nil
+}
+
+func (nodeDataCodecProtobuf) DecodeNodeData(data []byte, model CommitmentModel, arity PathArity) (*NodeData, error) {
+	fields, err := ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := NewNodeData()
+	var pathFragment []byte
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			if pathFragment, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+		case 2:
+			terminal, err := f.ByteString()
+			if err != nil {
+				return nil, err
+			}
+			if ret.Terminal, err = TerminalCommitmentFromBytes(model, terminal); err != nil {
+				return nil, err
+			}
+		case 3:
+			child, err := f.ByteString()
+			if err != nil {
+				return nil, err
+			}
+			idx, c, err := ProtobufDecodeChild(child)
+			if err != nil {
+				return nil, err
+			}
+			if idx > byte(arity) {
+				return nil, ErrWrongProtobuf
+			}
+			if _, already := ret.ChildCommitments[idx]; already {
+				return nil, ErrWrongProtobuf
+			}
+			if ret.ChildCommitments[idx], err = VectorCommitmentFromBytes(model, c); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if ret.PathFragment, err = DecodeToUnpackedBytes(pathFragment, arity); err != nil {
+		return nil, err
+	}
+	if IsNil(ret.Terminal) && len(ret.ChildCommitments) == 0 {
+		return nil, ErrWrongProtobuf
+	}
+	return ret, nil
+}
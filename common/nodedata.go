@@ -103,7 +103,7 @@ func newCflags(arity PathArity) cflags {
 
 func readCflags(r io.Reader, arity PathArity) (cflags, error) {
 	ret := newCflags(arity)
-	n, err := r.Read(ret)
+	n, err := io.ReadFull(r, ret)
 	if err != nil {
 		return nil, err
 	}
@@ -239,6 +239,9 @@ func (n *NodeData) Read(r io.Reader, model CommitmentModel, arity PathArity, get
 			}
 		}
 	}
+	if n.Terminal == nil && len(n.ChildCommitments) == 0 {
+		return errors.New("non-committing node")
+	}
 	return nil
 }
 
@@ -0,0 +1,104 @@
+package common
+
+import (
+	"sort"
+	"strings"
+)
+
+// OverlayReader reflects the pending mutations over the base reader, so that speculative reads see the
+// uncommitted changes without writing them to the database. Neither the base nor the mutations are modified.
+// Mutations can be changed between reads, but not during the iteration. Not thread-safe
+type OverlayReader struct {
+	base KVReader
+	m    *Mutations
+}
+
+type overlayIterator struct {
+	o      *OverlayReader
+	prefix []byte
+}
+
+var (
+	_ KVReader    = &OverlayReader{}
+	_ Traversable = &OverlayReader{}
+)
+
+func NewOverlayReader(base KVReader, m *Mutations) *OverlayReader {
+	return &OverlayReader{
+		base: base,
+		m:    m,
+	}
+}
+
+func (o *OverlayReader) Get(key []byte) []byte {
+	if v, mutated := o.m.Lookup(key); mutated {
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	}
+	return o.base.Get(key)
+}
+
+func (o *OverlayReader) Has(key []byte) bool {
+	if v, mutated := o.m.Lookup(key); mutated {
+		return len(v) > 0
+	}
+	return o.base.Has(key)
+}
+
+// Iterator requires the base to be Traversable. It first iterates keys of the base, which are not mutated,
+// in the order of the base iterator, then keys set by the mutations in lexicographical order
+func (o *OverlayReader) Iterator(prefix []byte) KVIterator {
+	_, ok := o.base.(Traversable)
+	Assertf(ok, "OverlayReader: base is not Traversable")
+	return &overlayIterator{
+		o:      o,
+		prefix: prefix,
+	}
+}
+
+func (it *overlayIterator) Iterate(f func(k []byte, v []byte) bool) {
+	stopped := false
+	it.o.base.(Traversable).Iterator(it.prefix).Iterate(func(k, v []byte) bool {
+		if _, mutated := it.o.m.Lookup(k); mutated {
+			return true
+		}
+		stopped = !f(k, v)
+		return !stopped
+	})
+	if !stopped {
+		it.iterateSet(f)
+	}
+}
+
+func (it *overlayIterator) IterateKeys(f func(k []byte) bool) {
+	stopped := false
+	it.o.base.(Traversable).Iterator(it.prefix).IterateKeys(func(k []byte) bool {
+		if _, mutated := it.o.m.Lookup(k); mutated {
+			return true
+		}
+		stopped = !f(k)
+		return !stopped
+	})
+	if !stopped {
+		it.iterateSet(func(k, _ []byte) bool {
+			return f(k)
+		})
+	}
+}
+
+func (it *overlayIterator) iterateSet(f func(k, v []byte) bool) {
+	keys := make([]string, 0)
+	for k, v := range it.o.m.set {
+		if len(v) > 0 && strings.HasPrefix(k, string(it.prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !f([]byte(k), it.o.m.set[k]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayReader(t *testing.T) {
+	base := NewInMemoryKVStore()
+	for i := 0; i < 10; i++ {
+		base.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	m := NewMutations()
+	m.Set([]byte("key1"), []byte("changed"))
+	m.Set([]byte("key2"), nil)
+	m.Set([]byte("new"), []byte("new value"))
+	m.Set([]byte("key3"), []byte("set then deleted"))
+	m.Set([]byte("key3"), nil)
+	o := NewOverlayReader(base, m)
+
+	require.EqualValues(t, "value0", string(o.Get([]byte("key0"))))
+	require.EqualValues(t, "changed", string(o.Get([]byte("key1"))))
+	require.Nil(t, o.Get([]byte("key2")))
+	require.False(t, o.Has([]byte("key2")))
+	require.False(t, o.Has([]byte("key3")))
+	require.True(t, o.Has([]byte("new")))
+	require.EqualValues(t, "value2", string(base.Get([]byte("key2"))))
+
+	expected := map[string]string{"key1": "changed"}
+	for i := 0; i < 10; i++ {
+		if i != 1 && i != 2 && i != 3 {
+			expected[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+		}
+	}
+	iterated := make(map[string]string)
+	o.Iterator([]byte("key")).Iterate(func(k, v []byte) bool {
+		iterated[string(k)] = string(v)
+		return true
+	})
+	require.EqualValues(t, expected, iterated)
+
+	n := 0
+	o.Iterator(nil).IterateKeys(func(k []byte) bool {
+		n++
+		return true
+	})
+	require.EqualValues(t, 9, n)
+
+	n = 0
+	o.Iterator(nil).IterateKeys(func(k []byte) bool {
+		n++
+		return n < 3
+	})
+	require.EqualValues(t, 3, n)
+}
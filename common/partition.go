@@ -28,6 +28,19 @@ func (p *ReaderPartition) Has(key []byte) (ret bool) {
 	return
 }
 
+// GetMany reads keys of the partition in one round trip if the underlying reader supports it
+func (p *ReaderPartition) GetMany(keys [][]byte) [][]byte {
+	return GetMany(p.r, prefixedKeys(p.prefix, keys))
+}
+
+// GetFunc reads value of the partition without copying if the underlying reader supports it
+func (p *ReaderPartition) GetFunc(key []byte, f func(value []byte)) (ret bool) {
+	UseConcatBytes(func(cat []byte) {
+		ret = GetFunc(p.r, cat, f)
+	}, []byte{p.prefix}, key)
+	return
+}
+
 func MakeReaderPartition(r KVReader, prefix byte) *ReaderPartition {
 	var ret *ReaderPartition
 	s := readerPartitionPool.Get()
@@ -74,6 +87,27 @@ func (p *TraversableReaderPartition) Has(key []byte) (ret bool) {
 	return
 }
 
+// GetMany reads keys of the partition in one round trip if the underlying reader supports it
+func (p *TraversableReaderPartition) GetMany(keys [][]byte) [][]byte {
+	return GetMany(p.r, prefixedKeys(p.prefix, keys))
+}
+
+// GetFunc reads value of the partition without copying if the underlying reader supports it
+func (p *TraversableReaderPartition) GetFunc(key []byte, f func(value []byte)) (ret bool) {
+	UseConcatBytes(func(cat []byte) {
+		ret = GetFunc(p.r, cat, f)
+	}, []byte{p.prefix}, key)
+	return
+}
+
+func prefixedKeys(prefix byte, keys [][]byte) [][]byte {
+	ret := make([][]byte, len(keys))
+	for i, k := range keys {
+		ret[i] = Concat(prefix, k)
+	}
+	return ret
+}
+
 func (p *TraversableReaderPartition) Iterator(iterPrefix []byte) KVIterator {
 	return p.r.Iterator(Concat(p.prefix, iterPrefix))
 }
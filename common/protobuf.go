@@ -0,0 +1,123 @@
+package common
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Minimal support of the protobuf wire format for the messages of proto/unitrie.proto and ICS-23 proofs.
+// As in proto3, scalar fields with zero values are not encoded. Unknown fields are skipped by the decoder
+
+var ErrWrongProtobuf = errors.New("wrong protobuf encoding")
+
+// ProtobufField is the decoded field of the message with the varint or length-delimited wire type
+type ProtobufField struct {
+	Num  protowire.Number
+	Type protowire.Type
+	// Uint is the value of the varint field
+	Uint uint64
+	// Bytes is the value of the length-delimited field
+	Bytes []byte
+}
+
+// ProtobufDecodeFields decodes the fields of the message in the order of appearance.
+// Fields of other wire types are skipped
+func ProtobufDecodeFields(data []byte) ([]ProtobufField, error) {
+	ret := make([]ProtobufField, 0)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, ErrWrongProtobuf
+		}
+		data = data[n:]
+		f := ProtobufField{Num: num, Type: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.Uint, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			f.Bytes, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return nil, ErrWrongProtobuf
+		}
+		data = data[n:]
+		if typ == protowire.VarintType || typ == protowire.BytesType {
+			ret = append(ret, f)
+		}
+	}
+	return ret, nil
+}
+
+// ProtobufAppendUint appends varint field, unless zero
+func ProtobufAppendUint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	return protowire.AppendVarint(protowire.AppendTag(b, num, protowire.VarintType), v)
+}
+
+// ProtobufAppendBytes appends length-delimited field, unless empty
+func ProtobufAppendBytes(b []byte, num protowire.Number, data []byte) []byte {
+	if len(data) == 0 {
+		return b
+	}
+	return ProtobufAppendField(b, num, data)
+}
+
+// ProtobufAppendField appends length-delimited field. Used for optional and repeated fields and embedded messages
+func ProtobufAppendField(b []byte, num protowire.Number, data []byte) []byte {
+	return protowire.AppendBytes(protowire.AppendTag(b, num, protowire.BytesType), data)
+}
+
+// ProtobufEncodeChild encodes the Child message
+func ProtobufEncodeChild(index byte, commitment []byte) []byte {
+	return ProtobufAppendBytes(ProtobufAppendUint(nil, 1, uint64(index)), 2, commitment)
+}
+
+// ProtobufDecodeChild decodes the Child message
+func ProtobufDecodeChild(data []byte) (byte, []byte, error) {
+	fields, err := ProtobufDecodeFields(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	var index uint64
+	var commitment []byte
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			if index, err = f.Unsigned(); err != nil {
+				return 0, nil, err
+			}
+		case 2:
+			if commitment, err = f.ByteString(); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	if index > 0xFF {
+		return 0, nil, ErrWrongProtobuf
+	}
+	return byte(index), commitment, nil
+}
+
+// Unsigned returns value of the varint field
+func (f *ProtobufField) Unsigned() (uint64, error) {
+	if f.Type != protowire.VarintType {
+		return 0, ErrWrongProtobuf
+	}
+	return f.Uint, nil
+}
+
+// ByteString returns value of the length-delimited field. Never returns nil on success
+func (f *ProtobufField) ByteString() ([]byte, error) {
+	if f.Type != protowire.BytesType {
+		return nil, ErrWrongProtobuf
+	}
+	if f.Bytes == nil {
+		return []byte{}, nil
+	}
+	return f.Bytes, nil
+}
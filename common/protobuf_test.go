@@ -0,0 +1,58 @@
+package common
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtobuf(t *testing.T) {
+	// Child{index: 150, commitment: 0xab}
+	require.EqualValues(t, "0896011201ab", hex.EncodeToString(ProtobufEncodeChild(150, []byte{0xab})))
+	// zero index is not encoded
+	require.EqualValues(t, "12020102", hex.EncodeToString(ProtobufEncodeChild(0, []byte{1, 2})))
+
+	idx, c, err := ProtobufDecodeChild(ProtobufEncodeChild(150, []byte{1, 2}))
+	require.NoError(t, err)
+	require.EqualValues(t, 150, idx)
+	require.EqualValues(t, []byte{1, 2}, c)
+
+	// unknown fields of any wire type are skipped
+	data, err := hex.DecodeString("0801" + "2d01020304" + "1a0100" + "1202ffff")
+	require.NoError(t, err)
+	idx, c, err = ProtobufDecodeChild(data)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, idx)
+	require.EqualValues(t, []byte{0xff, 0xff}, c)
+
+	for _, wrong := range []string{
+		"08",       // truncated varint
+		"1203ffff", // truncated bytes
+		"0a00",     // index is not varint
+		"088002",   // index too big
+		"00",       // wrong field number
+	} {
+		data, err := hex.DecodeString(wrong)
+		require.NoError(t, err)
+		_, _, err = ProtobufDecodeChild(data)
+		require.Error(t, err, wrong)
+	}
+}
+
+func TestSnapshotHeader(t *testing.T) {
+	h := &SnapshotHeader{
+		Model:     "model",
+		PathArity: PathArity16,
+		HashSize:  20,
+		Root:      []byte{1, 2, 3},
+	}
+	data := h.Protobuf()
+	require.EqualValues(t, "0a056d6f64656c100f18142203010203", hex.EncodeToString(data))
+	hBack, err := SnapshotHeaderFromProtobuf(data)
+	require.NoError(t, err)
+	require.EqualValues(t, h, hBack)
+
+	_, err = SnapshotHeaderFromProtobuf(data[:len(data)-1])
+	require.Error(t, err)
+}
@@ -0,0 +1,61 @@
+package common
+
+// ----------------------------------------------------------------------------
+// ReadOnlyKVStore is a KVStore wrapper which enforces at runtime that the underlying store is never mutated,
+// for example by code paths which must only read the historical state. Set panics with ErrReadOnly,
+// Commit of the batch and PrunePartition return ErrReadOnly
+var (
+	_ KVStore           = &ReadOnlyKVStore{}
+	_ BatchedUpdatable  = &ReadOnlyKVStore{}
+	_ Traversable       = &ReadOnlyKVStore{}
+	_ KVPartitionPruner = &ReadOnlyKVStore{}
+)
+
+type (
+	ReadOnlyKVStore struct {
+		r KVReader
+	}
+
+	readOnlyBatchedWriter struct{}
+)
+
+// ReadOnly wraps the reader into the KVStore which can't be written
+func ReadOnly(r KVReader) *ReadOnlyKVStore {
+	return &ReadOnlyKVStore{r: r}
+}
+
+func (s *ReadOnlyKVStore) Get(key []byte) []byte {
+	return s.r.Get(key)
+}
+
+func (s *ReadOnlyKVStore) Has(key []byte) bool {
+	return s.r.Has(key)
+}
+
+// Set always panics with ErrReadOnly
+func (s *ReadOnlyKVStore) Set(_, _ []byte) {
+	panic(ErrReadOnly)
+}
+
+// BatchedWriter returns the writer which ignores Set-s and returns ErrReadOnly on Commit
+func (s *ReadOnlyKVStore) BatchedWriter() KVBatchedWriter {
+	return readOnlyBatchedWriter{}
+}
+
+// PrunePartition always returns ErrReadOnly, so ClearPartition fails without touching the store
+func (s *ReadOnlyKVStore) PrunePartition(_ []byte) error {
+	return ErrReadOnly
+}
+
+// Iterator asserts that the underlying reader is Traversable
+func (s *ReadOnlyKVStore) Iterator(prefix []byte) KVIterator {
+	t, ok := s.r.(Traversable)
+	Assertf(ok, "ReadOnlyKVStore: underlying reader is not Traversable")
+	return t.Iterator(prefix)
+}
+
+func (readOnlyBatchedWriter) Set(_, _ []byte) {}
+
+func (readOnlyBatchedWriter) Commit() error {
+	return ErrReadOnly
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly(t *testing.T) {
+	store := NewInMemoryKVStore()
+	store.Set([]byte("a"), []byte("value"))
+	store.Set([]byte("b"), []byte("value"))
+	ro := ReadOnly(store)
+
+	require.EqualValues(t, "value", string(ro.Get([]byte("a"))))
+	require.True(t, ro.Has([]byte("b")))
+	count := 0
+	ro.Iterator(nil).IterateKeys(func(_ []byte) bool {
+		count++
+		return true
+	})
+	require.EqualValues(t, 2, count)
+
+	err := CatchPanicOrError(func() error {
+		ro.Set([]byte("a"), nil)
+		return nil
+	})
+	require.ErrorIs(t, err, ErrReadOnly)
+
+	b := ro.BatchedWriter()
+	b.Set([]byte("c"), []byte("value"))
+	require.ErrorIs(t, b.Commit(), ErrReadOnly)
+	require.ErrorIs(t, ClearPartition(ro, []byte("a")), ErrReadOnly)
+
+	require.True(t, store.Has([]byte("a")))
+	require.False(t, store.Has([]byte("c")))
+}
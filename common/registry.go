@@ -0,0 +1,127 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Registry of commitment models.
+// Each registered model has 1-byte ModelID. The self-describing serialization of the vector commitment is
+// the ModelID followed by the commitment bytes, so the commitment can be parsed without knowing the model
+// in advance, and commitments of different models cannot be mixed by mistake.
+// Models are identified by their ShortName, so equally configured instances of the model share the ID.
+// Standard configurations of the models in this repository register themselves with IDs below ModelIDUserMin.
+// Applications register other configurations with IDs starting from ModelIDUserMin.
+// The self-describing serialization is optional: the trie itself stores commitments without the prefix
+
+// ModelID is the 1-byte identifier of the registered commitment model
+type ModelID byte
+
+// ModelIDUserMin is the minimal ModelID available for the application-defined models
+const ModelIDUserMin = ModelID(0x80)
+
+var (
+	ErrModelIDTaken             = errors.New("model ID is already registered")
+	ErrModelNotRegistered       = errors.New("commitment model is not registered")
+	ErrUnknownModelID           = errors.New("unknown model ID")
+	ErrCommitmentOfAnotherModel = errors.New("commitment belongs to another model")
+)
+
+var modelRegistry = struct {
+	mutex  sync.RWMutex
+	byID   map[ModelID]CommitmentModel
+	byName map[string]ModelID
+}{
+	byID:   make(map[ModelID]CommitmentModel),
+	byName: make(map[string]ModelID),
+}
+
+// RegisterModel registers the model under the ID. Both the ID and the model (by ShortName) must be new
+func RegisterModel(id ModelID, m CommitmentModel) error {
+	modelRegistry.mutex.Lock()
+	defer modelRegistry.mutex.Unlock()
+
+	if _, already := modelRegistry.byID[id]; already {
+		return fmt.Errorf("%w: 0x%02x", ErrModelIDTaken, byte(id))
+	}
+	if prev, already := modelRegistry.byName[m.ShortName()]; already {
+		return fmt.Errorf("model '%s' is already registered with ID 0x%02x", m.ShortName(), byte(prev))
+	}
+	modelRegistry.byID[id] = m
+	modelRegistry.byName[m.ShortName()] = id
+	return nil
+}
+
+// MustRegisterModel same as RegisterModel, panics on error
+func MustRegisterModel(id ModelID, m CommitmentModel) {
+	AssertNoError(RegisterModel(id, m))
+}
+
+// UnregisterModel removes the model registered under the ID, if any. It is intended for tests which
+// register models temporarily
+func UnregisterModel(id ModelID) {
+	modelRegistry.mutex.Lock()
+	defer modelRegistry.mutex.Unlock()
+
+	if m, ok := modelRegistry.byID[id]; ok {
+		delete(modelRegistry.byName, m.ShortName())
+		delete(modelRegistry.byID, id)
+	}
+}
+
+// ModelByID returns the registered model
+func ModelByID(id ModelID) (CommitmentModel, bool) {
+	modelRegistry.mutex.RLock()
+	defer modelRegistry.mutex.RUnlock()
+
+	ret, ok := modelRegistry.byID[id]
+	return ret, ok
+}
+
+// IDOfModel returns ID of the registered model
+func IDOfModel(m CommitmentModel) (ModelID, bool) {
+	modelRegistry.mutex.RLock()
+	defer modelRegistry.mutex.RUnlock()
+
+	ret, ok := modelRegistry.byName[m.ShortName()]
+	return ret, ok
+}
+
+// SelfDescribingBytes serializes the vector commitment of the registered model with the ModelID prefix
+func SelfDescribingBytes(m CommitmentModel, c VCommitment) ([]byte, error) {
+	id, ok := IDOfModel(m)
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrModelNotRegistered, m.ShortName())
+	}
+	return Concat(byte(id), c.Bytes()), nil
+}
+
+// VectorCommitmentFromSelfDescribingBytes parses the vector commitment with the ModelID prefix.
+// Returns the model of the commitment
+func VectorCommitmentFromSelfDescribingBytes(data []byte) (CommitmentModel, VCommitment, error) {
+	if len(data) == 0 {
+		return nil, nil, ErrUnknownModelID
+	}
+	m, ok := ModelByID(ModelID(data[0]))
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: 0x%02x", ErrUnknownModelID, data[0])
+	}
+	c, err := VectorCommitmentFromBytes(m, data[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, c, nil
+}
+
+// VectorCommitmentOfModel parses self-describing vector commitment and checks if it belongs to the model
+func VectorCommitmentOfModel(m CommitmentModel, data []byte) (VCommitment, error) {
+	cm, c, err := VectorCommitmentFromSelfDescribingBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if cm.ShortName() != m.ShortName() {
+		return nil, fmt.Errorf("%w: expected '%s', got '%s'", ErrCommitmentOfAnotherModel, m.ShortName(), cm.ShortName())
+	}
+	return c, nil
+}
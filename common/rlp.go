@@ -0,0 +1,166 @@
+package common
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Recursive Length Prefix (RLP) encoding, as specified in the Ethereum Yellow Paper, appendix B.
+// The item is either the byte string or the list of items. Integers are byte strings of big-endian
+// representation without leading zeros
+
+var ErrWrongRLP = errors.New("wrong RLP encoding")
+
+// RLPItem is the decoded RLP item
+type RLPItem struct {
+	IsList bool
+	// Bytes is the byte string, if not list
+	Bytes []byte
+	// List contains items of the list
+	List []*RLPItem
+}
+
+// RLPEncodeBytes encodes the byte string
+func RLPEncodeBytes(data []byte) []byte {
+	if len(data) == 1 && data[0] < 0x80 {
+		return []byte{data[0]}
+	}
+	return append(rlpHeader(len(data), 0x80), data...)
+}
+
+// RLPEncodeList encodes the list of already encoded items
+func RLPEncodeList(items ...[]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+	ret := make([]byte, 0, size+9)
+	ret = append(ret, rlpHeader(size, 0xc0)...)
+	for _, item := range items {
+		ret = append(ret, item...)
+	}
+	return ret
+}
+
+// RLPEncodeUint encodes unsigned integer
+func RLPEncodeUint(v uint64) []byte {
+	return RLPEncodeBytes(uintBytes(v))
+}
+
+// rlpHeader encodes size of the payload with the offset of the string (0x80) or of the list (0xc0)
+func rlpHeader(size int, offset byte) []byte {
+	if size <= 55 {
+		return []byte{offset + byte(size)}
+	}
+	sizeBytes := uintBytes(uint64(size))
+	return append([]byte{offset + 55 + byte(len(sizeBytes))}, sizeBytes...)
+}
+
+// uintBytes big-endian without leading zeros
+func uintBytes(v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	i := 0
+	for i < len(buf) && buf[i] == 0 {
+		i++
+	}
+	return Concat(buf[i:])
+}
+
+// RLPDecode decodes one item, which must take the whole data. Only canonical encoding is accepted
+func RLPDecode(data []byte) (*RLPItem, error) {
+	ret, rest, err := rlpDecodeItem(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+func rlpDecodeItem(data []byte) (*RLPItem, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, ErrWrongRLP
+	}
+	b := data[0]
+	switch {
+	case b < 0x80:
+		return &RLPItem{Bytes: data[:1]}, data[1:], nil
+	case b < 0xc0:
+		payload, rest, err := rlpPayload(data, 0x80)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(payload) == 1 && payload[0] < 0x80 {
+			return nil, nil, ErrWrongRLP
+		}
+		return &RLPItem{Bytes: payload}, rest, nil
+	}
+	payload, rest, err := rlpPayload(data, 0xc0)
+	if err != nil {
+		return nil, nil, err
+	}
+	ret := &RLPItem{IsList: true, List: make([]*RLPItem, 0)}
+	for len(payload) > 0 {
+		var item *RLPItem
+		if item, payload, err = rlpDecodeItem(payload); err != nil {
+			return nil, nil, err
+		}
+		ret.List = append(ret.List, item)
+	}
+	return ret, rest, nil
+}
+
+// rlpPayload splits data into the payload of the item and the rest
+func rlpPayload(data []byte, offset byte) ([]byte, []byte, error) {
+	short := data[0] - offset
+	data = data[1:]
+	if short <= 55 {
+		if len(data) < int(short) {
+			return nil, nil, ErrWrongRLP
+		}
+		return data[:short], data[short:], nil
+	}
+	sizeLen := int(short - 55)
+	if len(data) < sizeLen || data[0] == 0 {
+		return nil, nil, ErrWrongRLP
+	}
+	size := uint64(0)
+	for _, c := range data[:sizeLen] {
+		size = size<<8 | uint64(c)
+	}
+	data = data[sizeLen:]
+	if size <= 55 || size > uint64(len(data)) {
+		return nil, nil, ErrWrongRLP
+	}
+	return data[:size], data[size:], nil
+}
+
+// Uint decodes the byte string as unsigned integer
+func (it *RLPItem) Uint() (uint64, error) {
+	if it.IsList || len(it.Bytes) > 8 || (len(it.Bytes) > 0 && it.Bytes[0] == 0) {
+		return 0, ErrWrongRLP
+	}
+	ret := uint64(0)
+	for _, c := range it.Bytes {
+		ret = ret<<8 | uint64(c)
+	}
+	return ret, nil
+}
+
+// ListOf returns items of the list, which must be of the expected length
+func (it *RLPItem) ListOf(n int) ([]*RLPItem, error) {
+	if !it.IsList || len(it.List) != n {
+		return nil, ErrWrongRLP
+	}
+	return it.List, nil
+}
+
+// ByteString returns the byte string of the item
+func (it *RLPItem) ByteString() ([]byte, error) {
+	if it.IsList {
+		return nil, ErrWrongRLP
+	}
+	return it.Bytes, nil
+}
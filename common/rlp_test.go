@@ -0,0 +1,65 @@
+package common
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRLP(t *testing.T) {
+	// test vectors of the Ethereum RLP specification
+	require.EqualValues(t, "80", hex.EncodeToString(RLPEncodeBytes(nil)))
+	require.EqualValues(t, "00", hex.EncodeToString(RLPEncodeBytes([]byte{0})))
+	require.EqualValues(t, "83646f67", hex.EncodeToString(RLPEncodeBytes([]byte("dog"))))
+	require.EqualValues(t, "c0", hex.EncodeToString(RLPEncodeList()))
+	require.EqualValues(t, "c88363617483646f67", hex.EncodeToString(RLPEncodeList(RLPEncodeBytes([]byte("cat")), RLPEncodeBytes([]byte("dog")))))
+	require.EqualValues(t, "820400", hex.EncodeToString(RLPEncodeUint(1024)))
+	require.EqualValues(t, "80", hex.EncodeToString(RLPEncodeUint(0)))
+	require.EqualValues(t, "0f", hex.EncodeToString(RLPEncodeUint(15)))
+	// [ [], [[]], [ [], [[]] ] ]
+	empty := RLPEncodeList()
+	require.EqualValues(t, "c7c0c1c0c3c0c1c0", hex.EncodeToString(RLPEncodeList(empty, RLPEncodeList(empty), RLPEncodeList(empty, RLPEncodeList(empty)))))
+
+	long := "Lorem ipsum dolor sit amet, consectetur adipisicing elit"
+	require.EqualValues(t, "b838"+hex.EncodeToString([]byte(long)), hex.EncodeToString(RLPEncodeBytes([]byte(long))))
+	require.EqualValues(t, "b90400", hex.EncodeToString(RLPEncodeBytes([]byte(strings.Repeat("x", 1024))))[:6])
+}
+
+func TestRLPDecode(t *testing.T) {
+	data := RLPEncodeList(
+		RLPEncodeUint(1024),
+		RLPEncodeBytes([]byte(strings.Repeat("x", 100))),
+		RLPEncodeList(RLPEncodeBytes([]byte{0x7f}), RLPEncodeBytes(nil)),
+	)
+	item, err := RLPDecode(data)
+	require.NoError(t, err)
+	fields, err := item.ListOf(3)
+	require.NoError(t, err)
+	v, err := fields[0].Uint()
+	require.NoError(t, err)
+	require.EqualValues(t, 1024, v)
+	require.EqualValues(t, strings.Repeat("x", 100), string(fields[1].Bytes))
+	inner, err := fields[2].ListOf(2)
+	require.NoError(t, err)
+	require.EqualValues(t, []byte{0x7f}, inner[0].Bytes)
+	require.EqualValues(t, 0, len(inner[1].Bytes))
+
+	for _, wrong := range []string{
+		"",
+		"8100",     // single byte below 0x80 must not be prefixed
+		"b800",     // short string with long size
+		"b9000100", // leading zero in size
+		"83646f",   // truncated
+		"c88363617483646f",
+		"820400ff", // extra bytes
+	} {
+		data, err := hex.DecodeString(wrong)
+		require.NoError(t, err)
+		_, err = RLPDecode(data)
+		require.Error(t, err, wrong)
+	}
+	_, err = (&RLPItem{Bytes: []byte{0, 1}}).Uint()
+	require.Error(t, err)
+}
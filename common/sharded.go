@@ -0,0 +1,154 @@
+package common
+
+// ----------------------------------------------------------------------------
+// ShardedInMemoryKVStore is a thread-safe in-memory KVStore partitioned into shards by the hash of the key.
+// Each shard is the InMemoryKVStore with its own lock, so parallel readers and writers of different keys
+// do not contend on the single lock. It is intended for high-concurrency benchmarks and services.
+// The batch is applied atomically: all shards touched by the batch are locked for the time of the commit.
+// Iteration visits shards one after another, so it is not consistent across shards if the store
+// is written concurrently. The order of iteration is unspecified
+var (
+	_ KVStore          = &ShardedInMemoryKVStore{}
+	_ KVZeroCopyReader = &ShardedInMemoryKVStore{}
+	_ BatchedUpdatable = &ShardedInMemoryKVStore{}
+	_ Traversable      = &ShardedInMemoryKVStore{}
+)
+
+// DefaultNumShards default number of shards of the ShardedInMemoryKVStore
+const DefaultNumShards = 64
+
+type (
+	ShardedInMemoryKVStore struct {
+		shards []*InMemoryKVStore
+	}
+
+	shardedBatchedWriter struct {
+		store     *ShardedInMemoryKVStore
+		mutations *Mutations
+	}
+
+	shardedIterator struct {
+		store  *ShardedInMemoryKVStore
+		prefix []byte
+	}
+)
+
+// NewShardedInMemoryKVStore creates the store with the number of shards. Default is DefaultNumShards
+func NewShardedInMemoryKVStore(numShards ...int) *ShardedInMemoryKVStore {
+	n := DefaultNumShards
+	if len(numShards) > 0 {
+		n = numShards[0]
+	}
+	Assertf(n > 0, "NewShardedInMemoryKVStore: number of shards must be positive")
+	ret := &ShardedInMemoryKVStore{
+		shards: make([]*InMemoryKVStore, n),
+	}
+	for i := range ret.shards {
+		ret.shards[i] = NewInMemoryKVStore()
+	}
+	return ret
+}
+
+func (s *ShardedInMemoryKVStore) NumShards() int {
+	return len(s.shards)
+}
+
+func (s *ShardedInMemoryKVStore) Get(k []byte) []byte {
+	return s.shard(k).Get(k)
+}
+
+func (s *ShardedInMemoryKVStore) GetFunc(k []byte, f func(value []byte)) bool {
+	return s.shard(k).GetFunc(k, f)
+}
+
+func (s *ShardedInMemoryKVStore) Has(k []byte) bool {
+	return s.shard(k).Has(k)
+}
+
+func (s *ShardedInMemoryKVStore) Set(k, v []byte) {
+	s.shard(k).Set(k, v)
+}
+
+func (s *ShardedInMemoryKVStore) Len() int {
+	ret := 0
+	for _, sh := range s.shards {
+		ret += sh.Len()
+	}
+	return ret
+}
+
+func (s *ShardedInMemoryKVStore) BatchedWriter() KVBatchedWriter {
+	return &shardedBatchedWriter{
+		store:     s,
+		mutations: NewMutations(),
+	}
+}
+
+func (s *ShardedInMemoryKVStore) Iterator(prefix []byte) KVIterator {
+	return &shardedIterator{
+		store:  s,
+		prefix: prefix,
+	}
+}
+
+func (s *ShardedInMemoryKVStore) shard(k []byte) *InMemoryKVStore {
+	return s.shards[s.shardIndex(k)]
+}
+
+// shardIndex FNV-1a hash of the key modulo number of shards
+func (s *ShardedInMemoryKVStore) shardIndex(k []byte) int {
+	h := uint32(2166136261)
+	for _, b := range k {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return int(h % uint32(len(s.shards)))
+}
+
+func (bw *shardedBatchedWriter) Set(key, value []byte) {
+	bw.mutations.Set(key, value)
+}
+
+// Commit locks shards touched by the batch in the order of their indices, so concurrent commits do not deadlock
+func (bw *shardedBatchedWriter) Commit() error {
+	touched := make([]bool, len(bw.store.shards))
+	bw.mutations.Iterate(func(k []byte, _ []byte, _ bool) bool {
+		touched[bw.store.shardIndex(k)] = true
+		return true
+	})
+	for i, t := range touched {
+		if t {
+			bw.store.shards[i].mutex.Lock()
+		}
+	}
+	bw.mutations.Iterate(func(k []byte, v []byte, _ bool) bool {
+		bw.store.shard(k).set(k, v)
+		return true
+	})
+	for i, t := range touched {
+		if t {
+			bw.store.shards[i].mutex.Unlock()
+		}
+	}
+	bw.mutations = nil // invalidate
+	return nil
+}
+
+func (si *shardedIterator) Iterate(f func(k []byte, v []byte) bool) {
+	for _, sh := range si.store.shards {
+		stop := false
+		sh.Iterator(si.prefix).Iterate(func(k []byte, v []byte) bool {
+			stop = !f(k, v)
+			return !stop
+		})
+		if stop {
+			return
+		}
+	}
+}
+
+func (si *shardedIterator) IterateKeys(f func(k []byte) bool) {
+	si.Iterate(func(k []byte, _ []byte) bool {
+		return f(k)
+	})
+}
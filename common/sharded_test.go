@@ -0,0 +1,55 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedInMemoryKVStore(t *testing.T) {
+	store := NewShardedInMemoryKVStore(8)
+	require.EqualValues(t, 8, store.NumShards())
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				k := []byte(fmt.Sprintf("k%d-%d", w, i))
+				store.Set(k, []byte("value"))
+				require.True(t, store.Has(k))
+			}
+		}(w)
+	}
+	wg.Wait()
+	require.EqualValues(t, 800, store.Len())
+
+	b := store.BatchedWriter()
+	for i := 0; i < 100; i++ {
+		b.Set([]byte(fmt.Sprintf("k0-%d", i)), nil)
+		b.Set([]byte(fmt.Sprintf("b%d", i)), []byte("batch"))
+	}
+	require.NoError(t, b.Commit())
+	require.EqualValues(t, 800, store.Len())
+	require.False(t, store.Has([]byte("k0-5")))
+	require.EqualValues(t, "batch", string(store.Get([]byte("b5"))))
+
+	count := 0
+	store.Iterator([]byte("b")).Iterate(func(k, v []byte) bool {
+		require.EqualValues(t, 'b', k[0])
+		require.EqualValues(t, "batch", string(v))
+		count++
+		return true
+	})
+	require.EqualValues(t, 100, count)
+
+	count = 0
+	store.Iterator(nil).IterateKeys(func(_ []byte) bool {
+		count++
+		return count < 10
+	})
+	require.EqualValues(t, 10, count)
+}
@@ -0,0 +1,102 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// SnapshotHeader identifies the trie of the snapshot, so the importer can check the snapshot against
+// the expected commitment model before processing the data. See SnapshotHeader in proto/unitrie.proto
+type SnapshotHeader struct {
+	// Model is the short name of the commitment model
+	Model     string
+	PathArity PathArity
+	// HashSize is the size of the vector commitment in bytes
+	HashSize int
+	// Root is the serialized root commitment
+	Root []byte
+}
+
+var ErrSnapshotModelMismatch = errors.New("snapshot is of another commitment model")
+
+// NewSnapshotHeader creates header of the snapshot of the root
+func NewSnapshotHeader(m CommitmentModel, root VCommitment) *SnapshotHeader {
+	rootBytes := root.Bytes()
+	return &SnapshotHeader{
+		Model:     m.ShortName(),
+		PathArity: m.PathArity(),
+		HashSize:  len(rootBytes),
+		Root:      rootBytes,
+	}
+}
+
+// Protobuf encodes the header as SnapshotHeader protobuf message
+func (h *SnapshotHeader) Protobuf() []byte {
+	ret := ProtobufAppendBytes(nil, 1, []byte(h.Model))
+	ret = ProtobufAppendUint(ret, 2, uint64(h.PathArity))
+	ret = ProtobufAppendUint(ret, 3, uint64(h.HashSize))
+	return ProtobufAppendBytes(ret, 4, h.Root)
+}
+
+// SnapshotHeaderFromProtobuf decodes SnapshotHeader protobuf message
+func SnapshotHeaderFromProtobuf(data []byte) (*SnapshotHeader, error) {
+	fields, err := ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := &SnapshotHeader{}
+	for _, f := range fields {
+		var v uint64
+		switch f.Num {
+		case 1:
+			var model []byte
+			if model, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+			ret.Model = string(model)
+		case 2:
+			if v, err = f.Unsigned(); err != nil {
+				return nil, err
+			}
+			if v > 0xFF {
+				return nil, ErrWrongProtobuf
+			}
+			ret.PathArity = PathArity(v)
+		case 3:
+			if v, err = f.Unsigned(); err != nil {
+				return nil, err
+			}
+			if v > 0xFFFF {
+				return nil, ErrWrongProtobuf
+			}
+			ret.HashSize = int(v)
+		case 4:
+			if ret.Root, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ret, nil
+}
+
+// Matches checks if the snapshot is of the trie with the model and the root
+func (h *SnapshotHeader) Matches(m CommitmentModel, root VCommitment) bool {
+	return h.Model == m.ShortName() && h.PathArity == m.PathArity() && !IsNil(root) && bytes.Equal(h.Root, root.Bytes())
+}
+
+// CheckModel checks if the snapshot is of the trie with the model and returns the root commitment of the snapshot
+func (h *SnapshotHeader) CheckModel(m CommitmentModel) (VCommitment, error) {
+	if h.Model != m.ShortName() || h.PathArity != m.PathArity() {
+		return nil, fmt.Errorf("%w: snapshot is '%s' arity %d, expected '%s' arity %d",
+			ErrSnapshotModelMismatch, h.Model, h.PathArity, m.ShortName(), m.PathArity())
+	}
+	if len(h.Root) != h.HashSize {
+		return nil, fmt.Errorf("%w: wrong size of the root", ErrSnapshotModelMismatch)
+	}
+	root, err := VectorCommitmentFromBytes(m, h.Root)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSnapshotModelMismatch, err)
+	}
+	return root, nil
+}
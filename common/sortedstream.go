@@ -0,0 +1,249 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// ----------------------------------------------------------------------------
+// SortedStreamWriter is a KVStreamWriter which emits pairs to the destination writer in the lexicographic
+// order of keys, regardless of the order they were written. Pairs are buffered in memory. When the buffer
+// exceeds the limit, it is sorted and spilled to the temporary file. Close merges the spilled runs and the buffer
+// into the destination and removes temporary files. If the same key is written more than once,
+// only the last value is emitted
+var _ KVStreamWriter = &SortedStreamWriter{}
+
+type (
+	SortedStreamWriter struct {
+		dest     KVStreamWriter
+		maxBytes int
+		tempDir  string
+		buf      []sortedStreamPair
+		bufBytes int
+		runs     []string
+		kvCount  int
+		bytes    int
+		closed   bool
+	}
+
+	sortedStreamPair struct {
+		key   []byte
+		value []byte
+	}
+
+	// sortedStreamRun is the source of the merge: spilled run or the in-memory buffer
+	sortedStreamRun struct {
+		// index of the source. Sources with bigger index are newer
+		index int
+		cur   sortedStreamPair
+		next  func() (sortedStreamPair, bool, error)
+	}
+
+	sortedStreamHeap []*sortedStreamRun
+)
+
+// NewSortedStreamWriter creates the writer with the in-memory buffer of maxBytes of keys and values.
+// Temporary files are created in the tempDir, by default in the default directory of os.CreateTemp
+func NewSortedStreamWriter(dest KVStreamWriter, maxBytes int, tempDir ...string) *SortedStreamWriter {
+	Assertf(maxBytes > 0, "NewSortedStreamWriter: maxBytes must be positive")
+	ret := &SortedStreamWriter{
+		dest:     dest,
+		maxBytes: maxBytes,
+		buf:      make([]sortedStreamPair, 0),
+		runs:     make([]string, 0),
+	}
+	if len(tempDir) > 0 {
+		ret.tempDir = tempDir[0]
+	}
+	return ret
+}
+
+func (w *SortedStreamWriter) Write(key, value []byte) error {
+	Assertf(!w.closed, "SortedStreamWriter: closed")
+	w.buf = append(w.buf, sortedStreamPair{key: Concat(key), value: Concat(value)})
+	w.bufBytes += len(key) + len(value)
+	w.kvCount++
+	w.bytes += len(key) + len(value) + 6
+	if w.bufBytes > w.maxBytes {
+		return w.spill()
+	}
+	return nil
+}
+
+// Stats returns number of pairs and bytes written to the writer, not emitted to the destination
+func (w *SortedStreamWriter) Stats() (int, int) {
+	return w.kvCount, w.bytes
+}
+
+// Close emits all pairs in the order of keys to the destination and removes temporary files
+func (w *SortedStreamWriter) Close() error {
+	Assertf(!w.closed, "SortedStreamWriter: closed")
+	w.closed = true
+	defer w.removeRuns()
+
+	h := make(sortedStreamHeap, 0, len(w.runs)+1)
+	for i, fname := range w.runs {
+		file, err := os.Open(fname)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err = h.pushRun(&sortedStreamRun{index: i, next: readSortedRun(bufio.NewReader(file))}); err != nil {
+			return err
+		}
+	}
+	buf := w.sortBuffer()
+	w.buf = nil
+	if err := h.pushRun(&sortedStreamRun{index: len(w.runs), next: sliceRun(buf)}); err != nil {
+		return err
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		// among equal keys the pair of the newest source wins
+		latest := h[0].cur
+		latestIndex := h[0].index
+		key := latest.key
+		for h.Len() > 0 && bytes.Equal(h[0].cur.key, key) {
+			if h[0].index > latestIndex {
+				latest, latestIndex = h[0].cur, h[0].index
+			}
+			if err := h.advance(); err != nil {
+				return err
+			}
+		}
+		if err := w.dest.Write(latest.key, latest.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortBuffer sorts the buffer and removes older duplicates
+func (w *SortedStreamWriter) sortBuffer() []sortedStreamPair {
+	sort.SliceStable(w.buf, func(i, j int) bool {
+		return bytes.Compare(w.buf[i].key, w.buf[j].key) < 0
+	})
+	ret := w.buf[:0]
+	for i := range w.buf {
+		if len(ret) > 0 && bytes.Equal(ret[len(ret)-1].key, w.buf[i].key) {
+			ret[len(ret)-1] = w.buf[i]
+		} else {
+			ret = append(ret, w.buf[i])
+		}
+	}
+	return ret
+}
+
+func (w *SortedStreamWriter) spill() error {
+	file, err := os.CreateTemp(w.tempDir, "unitrie-sort-*")
+	if err != nil {
+		return err
+	}
+	w.runs = append(w.runs, file.Name())
+	bw := bufio.NewWriter(file)
+	sw := NewBinaryStreamWriter(bw)
+	for _, p := range w.sortBuffer() {
+		if err = sw.Write(p.key, p.value); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	w.buf = w.buf[:0]
+	w.bufBytes = 0
+	return err
+}
+
+func (w *SortedStreamWriter) removeRuns() {
+	for _, fname := range w.runs {
+		_ = os.Remove(fname)
+	}
+	w.runs = nil
+}
+
+func readSortedRun(r io.Reader) func() (sortedStreamPair, bool, error) {
+	return func() (sortedStreamPair, bool, error) {
+		k, err := ReadBytes16(r)
+		if errors.Is(err, io.EOF) {
+			return sortedStreamPair{}, false, nil
+		}
+		if err != nil {
+			return sortedStreamPair{}, false, err
+		}
+		v, err := ReadBytes32(r)
+		if err != nil {
+			return sortedStreamPair{}, false, err
+		}
+		return sortedStreamPair{key: k, value: v}, true, nil
+	}
+}
+
+func sliceRun(pairs []sortedStreamPair) func() (sortedStreamPair, bool, error) {
+	return func() (sortedStreamPair, bool, error) {
+		if len(pairs) == 0 {
+			return sortedStreamPair{}, false, nil
+		}
+		ret := pairs[0]
+		pairs = pairs[1:]
+		return ret, true, nil
+	}
+}
+
+// pushRun reads the first pair of the run and appends it to the heap, if the run is not empty.
+// The heap must be initialized after
+func (h *sortedStreamHeap) pushRun(r *sortedStreamRun) error {
+	p, ok, err := r.next()
+	if err != nil || !ok {
+		return err
+	}
+	r.cur = p
+	*h = append(*h, r)
+	return nil
+}
+
+// advance moves the top run to its next pair or removes it from the heap if it is exhausted
+func (h *sortedStreamHeap) advance() error {
+	p, ok, err := (*h)[0].next()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		heap.Pop(h)
+		return nil
+	}
+	(*h)[0].cur = p
+	heap.Fix(h, 0)
+	return nil
+}
+
+func (h sortedStreamHeap) Len() int {
+	return len(h)
+}
+
+func (h sortedStreamHeap) Less(i, j int) bool {
+	return bytes.Compare(h[i].cur.key, h[j].cur.key) < 0
+}
+
+func (h sortedStreamHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *sortedStreamHeap) Push(x interface{}) {
+	*h = append(*h, x.(*sortedStreamRun))
+}
+
+func (h *sortedStreamHeap) Pop() interface{} {
+	old := *h
+	ret := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return ret
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortedStreamWriter(t *testing.T) {
+	for _, maxBytes := range []int{100, 1000, 1 << 20} {
+		t.Run(fmt.Sprintf("%d", maxBytes), func(t *testing.T) {
+			tempDir := t.TempDir()
+			var buf bytes.Buffer
+			w := NewSortedStreamWriter(NewBinaryStreamWriter(&buf), maxBytes, tempDir)
+			expected := make(map[string]string)
+			rnd := rand.New(rand.NewSource(1))
+			for i := 0; i < 2000; i++ {
+				k := fmt.Sprintf("key%d", rnd.Intn(1000))
+				v := fmt.Sprintf("value%d", i)
+				require.NoError(t, w.Write([]byte(k), []byte(v)))
+				expected[k] = v
+			}
+			n, _ := w.Stats()
+			require.EqualValues(t, 2000, n)
+			require.NoError(t, w.Close())
+
+			files, err := os.ReadDir(tempDir)
+			require.NoError(t, err)
+			require.EqualValues(t, 0, len(files))
+
+			expectedKeys := make([]string, 0, len(expected))
+			for k := range expected {
+				expectedKeys = append(expectedKeys, k)
+			}
+			sort.Strings(expectedKeys)
+			keys := make([]string, 0)
+			err = NewBinaryStreamIterator(&buf).Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, expected[string(k)], string(v))
+				keys = append(keys, string(k))
+				return true
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, expectedKeys, keys)
+		})
+	}
+}
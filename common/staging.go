@@ -0,0 +1,89 @@
+package common
+
+// ----------------------------------------------------------------------------
+// StagingStore is a KVStore which accumulates writes in Mutations on top of the base reader, until they are
+// flushed to the database with Flush or discarded with Discard. Reads and iterations see the base with the
+// staged changes applied (see OverlayReader). The base is never written.
+// It is a building block for transactions: for example, several trie commits can be staged and then
+// written atomically in one batch. Not thread-safe. The store must not be written during the iteration
+var (
+	_ KVStore          = &StagingStore{}
+	_ BatchedUpdatable = &StagingStore{}
+	_ Traversable      = &StagingStore{}
+)
+
+type (
+	StagingStore struct {
+		base    KVReader
+		m       *Mutations
+		overlay *OverlayReader
+	}
+
+	stagingBatchedWriter struct {
+		store     *StagingStore
+		mutations *Mutations
+	}
+)
+
+func NewStagingStore(base KVReader) *StagingStore {
+	ret := &StagingStore{base: base}
+	ret.Discard()
+	return ret
+}
+
+func (s *StagingStore) Get(key []byte) []byte {
+	return s.overlay.Get(key)
+}
+
+func (s *StagingStore) Has(key []byte) bool {
+	return s.overlay.Has(key)
+}
+
+// Set stages the write. Empty value stages deletion
+func (s *StagingStore) Set(key, value []byte) {
+	s.m.Set(Concat(key), Concat(value))
+}
+
+// Iterator requires the base to be Traversable. See OverlayReader for the order of iteration
+func (s *StagingStore) Iterator(prefix []byte) KVIterator {
+	return s.overlay.Iterator(prefix)
+}
+
+// BatchedWriter returns the writer which stages the batch on Commit
+func (s *StagingStore) BatchedWriter() KVBatchedWriter {
+	return &stagingBatchedWriter{
+		store:     s,
+		mutations: NewMutations(),
+	}
+}
+
+// Mutations returns the staged mutations. They must not be modified
+func (s *StagingStore) Mutations() *Mutations {
+	return s.m
+}
+
+// Flush writes the staged mutations to the batched writer and commits it. The staged mutations are discarded
+// if the commit succeeds, otherwise they are kept
+func (s *StagingStore) Flush(w KVBatchedWriter) error {
+	s.m.WriteTo(w)
+	if err := w.Commit(); err != nil {
+		return err
+	}
+	s.Discard()
+	return nil
+}
+
+// Discard discards the staged mutations
+func (s *StagingStore) Discard() {
+	s.m = NewMutations()
+	s.overlay = NewOverlayReader(s.base, s.m)
+}
+
+func (w *stagingBatchedWriter) Set(key, value []byte) {
+	w.mutations.Set(Concat(key), Concat(value))
+}
+
+func (w *stagingBatchedWriter) Commit() error {
+	w.mutations.WriteTo(w.store)
+	return nil
+}
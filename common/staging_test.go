@@ -0,0 +1,54 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagingStore(t *testing.T) {
+	base := NewInMemoryKVStore()
+	for i := 0; i < 5; i++ {
+		base.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	s := NewStagingStore(base)
+	s.Set([]byte("key0"), []byte("changed"))
+	s.Set([]byte("key1"), nil)
+	b := s.BatchedWriter()
+	b.Set([]byte("key5"), []byte("new"))
+	require.False(t, s.Has([]byte("key5")))
+	require.NoError(t, b.Commit())
+
+	require.EqualValues(t, "changed", string(s.Get([]byte("key0"))))
+	require.False(t, s.Has([]byte("key1")))
+	require.EqualValues(t, "new", string(s.Get([]byte("key5"))))
+	require.EqualValues(t, "value1", string(base.Get([]byte("key1"))))
+	require.False(t, base.Has([]byte("key5")))
+
+	iterated := make(map[string]string)
+	s.Iterator([]byte("key")).Iterate(func(k, v []byte) bool {
+		iterated[string(k)] = string(v)
+		return true
+	})
+	require.EqualValues(t, map[string]string{
+		"key0": "changed", "key2": "value2", "key3": "value3", "key4": "value4", "key5": "new",
+	}, iterated)
+
+	// failed flush keeps the staged changes
+	failing := NewFaultyKVStore(NewInMemoryKVStore(), FaultParams{Unavailable: 1})
+	require.True(t, errors.Is(s.Flush(failing.BatchedWriter()), ErrDBUnavailable))
+	require.EqualValues(t, 3, s.Mutations().LenSet()+s.Mutations().LenDel())
+
+	require.NoError(t, s.Flush(base.BatchedWriter()))
+	require.EqualValues(t, 0, s.Mutations().LenSet()+s.Mutations().LenDel())
+	require.EqualValues(t, "changed", string(base.Get([]byte("key0"))))
+	require.False(t, base.Has([]byte("key1")))
+	require.EqualValues(t, "new", string(base.Get([]byte("key5"))))
+
+	s.Set([]byte("key0"), nil)
+	require.False(t, s.Has([]byte("key0")))
+	s.Discard()
+	require.True(t, s.Has([]byte("key0")))
+}
@@ -0,0 +1,64 @@
+package common
+
+// ----------------------------------------------------------------------------
+// Composable adapters of KVStreamIterator. Each adapter wraps the source iterator and transforms pairs
+// on the fly, so pipelines like "strip the prefix, drop empty values" are built without intermediate stores:
+//   FilterStream(MapStream(src, stripPrefix), nonEmpty)
+
+type (
+	filterStream struct {
+		src  KVStreamIterator
+		pred func(k, v []byte) bool
+	}
+
+	mapStream struct {
+		src KVStreamIterator
+		fn  func(k, v []byte) ([]byte, []byte)
+	}
+
+	dedupStream struct {
+		src KVStreamIterator
+	}
+)
+
+// FilterStream passes only pairs for which pred returns true
+func FilterStream(src KVStreamIterator, pred func(k, v []byte) bool) KVStreamIterator {
+	return &filterStream{src: src, pred: pred}
+}
+
+// MapStream replaces each pair with the pair returned by fn. Slices passed to fn must not be retained
+func MapStream(src KVStreamIterator, fn func(k, v []byte) ([]byte, []byte)) KVStreamIterator {
+	return &mapStream{src: src, fn: fn}
+}
+
+// DedupStream passes only the first pair of each key. Keys seen are kept in memory, so memory is
+// proportional to the number of distinct keys
+func DedupStream(src KVStreamIterator) KVStreamIterator {
+	return &dedupStream{src: src}
+}
+
+func (s *filterStream) Iterate(fun func(k, v []byte) bool) error {
+	return s.src.Iterate(func(k, v []byte) bool {
+		if !s.pred(k, v) {
+			return true
+		}
+		return fun(k, v)
+	})
+}
+
+func (s *mapStream) Iterate(fun func(k, v []byte) bool) error {
+	return s.src.Iterate(func(k, v []byte) bool {
+		return fun(s.fn(k, v))
+	})
+}
+
+func (s *dedupStream) Iterate(fun func(k, v []byte) bool) error {
+	seen := make(map[string]struct{})
+	return s.src.Iterate(func(k, v []byte) bool {
+		if _, ok := seen[string(k)]; ok {
+			return true
+		}
+		seen[string(k)] = struct{}{}
+		return fun(k, v)
+	})
+}
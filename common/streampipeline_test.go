@@ -0,0 +1,52 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamPipeline(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBinaryStreamWriter(&buf)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, w.Write([]byte(fmt.Sprintf("a/%d", i)), []byte(fmt.Sprintf("value%d", i))))
+		require.NoError(t, w.Write([]byte(fmt.Sprintf("b/%d", i)), []byte("other")))
+	}
+	require.NoError(t, w.Write([]byte("a/1"), []byte("duplicate")))
+	require.NoError(t, w.Write([]byte("a/empty"), nil))
+
+	stream := FilterStream(NewBinaryStreamIterator(&buf), func(k, v []byte) bool {
+		return bytes.HasPrefix(k, []byte("a/")) && len(v) > 0
+	})
+	stream = MapStream(stream, func(k, v []byte) ([]byte, []byte) {
+		return k[2:], v
+	})
+	stream = DedupStream(stream)
+
+	result := make(map[string]string)
+	err := stream.Iterate(func(k, v []byte) bool {
+		_, already := result[string(k)]
+		require.False(t, already)
+		result[string(k)] = string(v)
+		return true
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 10, len(result))
+	for i := 0; i < 10; i++ {
+		require.EqualValues(t, fmt.Sprintf("value%d", i), result[fmt.Sprintf("%d", i)])
+	}
+
+	// early stop is propagated to the source
+	count := 0
+	err = MapStream(NewRandStreamIterator(RandStreamParams{Seed: 1, MaxKey: 10, MaxValue: 10}), func(k, v []byte) ([]byte, []byte) {
+		return k, v
+	}).Iterate(func(_, _ []byte) bool {
+		count++
+		return count < 5
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 5, count)
+}
@@ -147,7 +147,7 @@ func ReadBytes8(r io.Reader) ([]byte, error) {
 		return []byte{}, nil
 	}
 	ret := make([]byte, length)
-	_, err = r.Read(ret)
+	_, err = io.ReadFull(r, ret)
 	if err != nil {
 		return nil, err
 	}
@@ -178,7 +178,7 @@ func ReadBytes16(r io.Reader) ([]byte, error) {
 		return []byte{}, nil
 	}
 	ret := make([]byte, length)
-	_, err = r.Read(ret)
+	_, err = io.ReadFull(r, ret)
 	if err != nil {
 		return nil, err
 	}
@@ -201,7 +201,7 @@ func WriteBytes16(w io.Writer, data []byte) error {
 
 func ReadUint16(r io.Reader, pval *uint16) error {
 	var tmp2 [2]byte
-	_, err := r.Read(tmp2[:])
+	_, err := io.ReadFull(r, tmp2[:])
 	if err != nil {
 		return err
 	}
@@ -229,7 +229,7 @@ func Uint16From2Bytes(b []byte) (uint16, error) {
 
 func ReadByte(r io.Reader) (byte, error) {
 	var b [1]byte
-	_, err := r.Read(b[:])
+	_, err := io.ReadFull(r, b[:])
 	if err != nil {
 		return 0, err
 	}
@@ -251,8 +251,12 @@ func ReadBytes32(r io.Reader) ([]byte, error) {
 	if length == 0 {
 		return []byte{}, nil
 	}
+	// do not trust the length before allocating, if the size of the remaining data is known
+	if rl, ok := r.(interface{ Len() int }); ok && int64(length) > int64(rl.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
 	ret := make([]byte, length)
-	_, err = r.Read(ret)
+	_, err = io.ReadFull(r, ret)
 	if err != nil {
 		return nil, err
 	}
@@ -294,7 +298,7 @@ func MustUint32From4Bytes(b []byte) uint32 {
 
 func ReadUint32(r io.Reader, pval *uint32) error {
 	var tmp4 [4]byte
-	_, err := r.Read(tmp4[:])
+	_, err := io.ReadFull(r, tmp4[:])
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,256 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// ----------------------------------------------------------------------------
+// WALKVStore is a write-ahead-log wrapper of the KVStore. Each Set is appended to the log and the log is
+// synced before the Set is forwarded to the underlying store. After the crash, ReplayWAL applies the log
+// to the underlying store on startup, so no acknowledged Set is lost even if the store itself does not persist
+// it atomically (like plain Set on badger outside batches). Checkpoint truncates the log when the
+// underlying store is known to be durable.
+// Record of the log is the atomic batch of key/value pairs: number of pairs (uint32, big-endian), pairs as
+// key (WriteBytes16) and value (WriteBytes32, empty means deletion), CRC-32 (IEEE, big-endian) of all the preceding
+// bytes of the record. Set is the batch of one pair. The torn record at the end of the log is ignored by ReplayWAL
+// as a whole, so the batch is either replayed completely or not at all. The log must be truncated to the last complete
+// record with TruncateWAL before new records are appended, otherwise the torn record ends up in the middle of the log
+var (
+	_ KVStore          = &WALKVStore{}
+	_ BatchedUpdatable = &WALKVStore{}
+)
+
+var ErrWALCorrupted = errors.New("write-ahead log is corrupted")
+
+type (
+	// WALLog is the append-only log file. *os.File implements it
+	WALLog interface {
+		io.Writer
+		io.Seeker
+		Sync() error
+		Truncate(size int64) error
+	}
+
+	WALKVStore struct {
+		mutex sync.Mutex
+		store KVStore
+		log   WALLog
+		buf   bytes.Buffer
+	}
+
+	walBatchedWriter struct {
+		store     *WALKVStore
+		mutations *Mutations
+	}
+
+	// walCountingReader counts bytes read
+	walCountingReader struct {
+		r io.Reader
+		n int64
+	}
+)
+
+// NewWALKVStore wraps the store with the log. The log must be replayed with ReplayWAL and truncated
+// with TruncateWAL to the size returned by ReplayWAL before the wrapper is created.
+// Records are appended at the current position of the log
+func NewWALKVStore(store KVStore, log WALLog) *WALKVStore {
+	return &WALKVStore{
+		store: store,
+		log:   log,
+	}
+}
+
+func (s *WALKVStore) Get(key []byte) []byte {
+	return s.store.Get(key)
+}
+
+func (s *WALKVStore) Has(key []byte) bool {
+	return s.store.Has(key)
+}
+
+// Set appends the record to the log, syncs it and writes to the store. Panics if the log can't be written
+func (s *WALKVStore) Set(key, value []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.buf.Reset()
+	writeWALRecord(&s.buf, 1, func(w io.Writer) {
+		writeWALPair(w, key, value)
+	})
+	s.mustAppend()
+	s.store.Set(key, value)
+}
+
+// BatchedWriter returns the writer which appends the batch to the log as one record with one sync on Commit
+func (s *WALKVStore) BatchedWriter() KVBatchedWriter {
+	return &walBatchedWriter{
+		store:     s,
+		mutations: NewMutations(),
+	}
+}
+
+// Checkpoint truncates the log. It must only be called when all writes to the underlying store are durable
+func (s *WALKVStore) Checkpoint() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return TruncateWAL(s.log, 0)
+}
+
+// TruncateWAL truncates the log to the size and moves the position of the log to its end
+func TruncateWAL(log WALLog, size int64) error {
+	if err := log.Truncate(size); err != nil {
+		return err
+	}
+	if _, err := log.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	return log.Sync()
+}
+
+func (s *WALKVStore) mustAppend() {
+	_, err := s.log.Write(s.buf.Bytes())
+	AssertNoError(err)
+	AssertNoError(s.log.Sync())
+}
+
+func (w *walBatchedWriter) Set(key, value []byte) {
+	w.mutations.Set(key, value)
+}
+
+func (w *walBatchedWriter) Commit() error {
+	w.store.mutex.Lock()
+	defer w.store.mutex.Unlock()
+
+	numPairs := 0
+	w.mutations.Iterate(func(_ []byte, _ []byte, _ bool) bool {
+		numPairs++
+		return true
+	})
+	if numPairs == 0 {
+		return nil
+	}
+	w.store.buf.Reset()
+	writeWALRecord(&w.store.buf, numPairs, func(wr io.Writer) {
+		w.mutations.Iterate(func(k []byte, v []byte, _ bool) bool {
+			writeWALPair(wr, k, v)
+			return true
+		})
+	})
+	if err := CatchPanicOrError(func() error {
+		w.store.mustAppend()
+		return nil
+	}); err != nil {
+		return err
+	}
+	w.mutations.Iterate(func(k []byte, v []byte, _ bool) bool {
+		w.store.store.Set(k, v)
+		return true
+	})
+	return nil
+}
+
+// writeWALRecord writes the record of numPairs pairs written by writePairs
+func writeWALRecord(buf *bytes.Buffer, numPairs int, writePairs func(w io.Writer)) {
+	h := crc32.NewIEEE()
+	w := io.MultiWriter(buf, h)
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(numPairs))
+	_, _ = w.Write(n[:])
+	writePairs(w)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], h.Sum32())
+	buf.Write(crc[:])
+}
+
+func writeWALPair(w io.Writer, key, value []byte) {
+	_ = WriteBytes16(w, key)
+	_ = WriteBytes32(w, value)
+}
+
+// ReplayWAL applies records of the log to the store in the order they were written. Returns number of
+// applied key/value pairs and size of the log up to the end of the last complete record. The incomplete or broken
+// last record is the trace of the crash during the write and is ignored as a whole, because the Set or the batch
+// was not forwarded to the store. The log must be truncated to the returned size with TruncateWAL before
+// appending to it. The broken record followed by other records returns ErrWALCorrupted
+func ReplayWAL(r io.Reader, store KVWriter) (int, int64, error) {
+	rdr := bufio.NewReader(r)
+	cr := &walCountingReader{r: rdr}
+	ret := 0
+	var size int64
+	for {
+		pairs, err := readWALRecord(cr)
+		if err == io.EOF {
+			return ret, size, nil
+		}
+		if err != nil {
+			if _, errPeek := rdr.Peek(1); errPeek == io.EOF {
+				// torn tail
+				return ret, size, nil
+			}
+			return ret, size, err
+		}
+		for _, p := range pairs {
+			if len(p[1]) == 0 {
+				p[1] = nil
+			}
+			store.Set(p[0], p[1])
+		}
+		ret += len(pairs)
+		size = cr.n
+	}
+}
+
+func (c *walCountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// readWALRecord reads the record and returns its key/value pairs. Returns io.EOF if there are no more records
+func readWALRecord(r io.Reader) ([][2][]byte, error) {
+	h := crc32.NewIEEE()
+	tr := io.TeeReader(r, h)
+	var n [4]byte
+	if _, err := io.ReadFull(tr, n[:]); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, wrongWALRecord(err)
+	}
+	numPairs := binary.BigEndian.Uint32(n[:])
+	ret := make([][2][]byte, 0)
+	for i := uint32(0); i < numPairs; i++ {
+		key, err := ReadBytes16(tr)
+		if err != nil {
+			return nil, wrongWALRecord(err)
+		}
+		value, err := ReadBytes32(tr)
+		if err != nil {
+			return nil, wrongWALRecord(err)
+		}
+		ret = append(ret, [2][]byte{key, value})
+	}
+	sum := h.Sum32()
+	var crc [4]byte
+	if _, err := io.ReadFull(r, crc[:]); err != nil {
+		return nil, wrongWALRecord(err)
+	}
+	if sum != binary.BigEndian.Uint32(crc[:]) {
+		return nil, ErrWALCorrupted
+	}
+	return ret, nil
+}
+
+func wrongWALRecord(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrWALCorrupted
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALKVStore(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "wal")
+	log, err := os.OpenFile(fname, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	defer log.Close()
+
+	store := NewInMemoryKVStore()
+	wal := NewWALKVStore(store, log)
+	for i := 0; i < 100; i++ {
+		wal.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	wal.Set([]byte("key0"), nil)
+	stat, err := log.Stat()
+	require.NoError(t, err)
+	sizeBeforeBatch := int(stat.Size())
+	batch := wal.BatchedWriter()
+	for i := 100; i < 150; i++ {
+		batch.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	batch.Set([]byte("key1"), nil)
+	require.NoError(t, batch.Commit())
+	require.False(t, wal.Has([]byte("key1")))
+	require.EqualValues(t, "value120", string(wal.Get([]byte("key120"))))
+
+	// crash: the store is lost, the log is replayed
+	data, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	recovered := NewInMemoryKVStore()
+	n, size, err := ReplayWAL(bytes.NewReader(data), recovered)
+	require.NoError(t, err)
+	require.EqualValues(t, 152, n)
+	require.EqualValues(t, len(data), size)
+	store.Iterate(func(k, v []byte) bool {
+		require.EqualValues(t, v, recovered.Get(k))
+		return true
+	})
+	require.EqualValues(t, 148, recovered.Len())
+
+	// torn tail is ignored: the torn batch is not applied at all
+	for _, size := range []int{len(data) - 3, sizeBeforeBatch + (len(data)-sizeBeforeBatch)/2, sizeBeforeBatch + 2} {
+		recovered = NewInMemoryKVStore()
+		n, validSize, err := ReplayWAL(bytes.NewReader(data[:size]), recovered)
+		require.NoError(t, err)
+		require.EqualValues(t, 101, n)
+		require.EqualValues(t, sizeBeforeBatch, validSize)
+		require.EqualValues(t, 99, recovered.Len())
+		require.EqualValues(t, "value1", string(recovered.Get([]byte("key1"))))
+		require.False(t, recovered.Has([]byte("key100")))
+	}
+
+	// corruption in the middle
+	corrupted := append([]byte{}, data...)
+	corrupted[10]++
+	_, _, err = ReplayWAL(bytes.NewReader(corrupted), NewInMemoryKVStore())
+	require.True(t, errors.Is(err, ErrWALCorrupted))
+
+	// after the checkpoint the log starts from scratch
+	require.NoError(t, wal.Checkpoint())
+	wal.Set([]byte("after"), []byte("checkpoint"))
+	data, err = os.ReadFile(fname)
+	require.NoError(t, err)
+	recovered = NewInMemoryKVStore()
+	n, _, err = ReplayWAL(bytes.NewReader(data), recovered)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+	require.EqualValues(t, "checkpoint", string(recovered.Get([]byte("after"))))
+
+	// the torn tail is cut off before new writes, so the log can be replayed after the next crash
+	t.Run("torn tail truncated", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "wal2")
+		log, err := os.OpenFile(fname, os.O_CREATE|os.O_RDWR, 0o644)
+		require.NoError(t, err)
+		defer log.Close()
+
+		wal := NewWALKVStore(NewInMemoryKVStore(), log)
+		for i := 0; i < 10; i++ {
+			wal.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+		}
+		// crash in the middle of the batch
+		stat, err := log.Stat()
+		require.NoError(t, err)
+		batch := wal.BatchedWriter()
+		batch.Set([]byte("torn"), []byte("batch"))
+		require.NoError(t, batch.Commit())
+		require.NoError(t, log.Truncate(stat.Size()+5))
+
+		replay := func() (*InMemoryKVStore, int64) {
+			_, err := log.Seek(0, io.SeekStart)
+			require.NoError(t, err)
+			recovered := NewInMemoryKVStore()
+			_, size, err := ReplayWAL(log, recovered)
+			require.NoError(t, err)
+			return recovered, size
+		}
+		recovered, size := replay()
+		require.EqualValues(t, stat.Size(), size)
+		require.EqualValues(t, 10, recovered.Len())
+		require.NoError(t, TruncateWAL(log, size))
+
+		// new writes after the recovery
+		wal = NewWALKVStore(recovered, log)
+		wal.Set([]byte("key100"), []byte("value100"))
+		batch = wal.BatchedWriter()
+		batch.Set([]byte("key101"), []byte("value101"))
+		batch.Set([]byte("key0"), nil)
+		require.NoError(t, batch.Commit())
+
+		// crash again: all acknowledged writes are replayed
+		recovered, _ = replay()
+		require.EqualValues(t, 11, recovered.Len())
+		require.EqualValues(t, "value100", string(recovered.Get([]byte("key100"))))
+		require.EqualValues(t, "value101", string(recovered.Get([]byte("key101"))))
+		require.False(t, recovered.Has([]byte("key0")))
+		require.False(t, recovered.Has([]byte("torn")))
+	})
+}
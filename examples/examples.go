@@ -0,0 +1,96 @@
+// Package examples provides a tiny fixed dataset and helpers to build tries with known roots for every
+// commitment model and path arity. The roots are stable and can be used as reference commitments in tests
+// of downstream systems. Changing the dataset or the identity changes all the roots
+package examples
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_kzg_bn256"
+)
+
+// Identity of the root of all example tries
+const Identity = "unitrie example"
+
+// Dataset is the fixed key/value dataset of example tries. It contains keys with common prefixes
+// and values both shorter and longer than a hash
+var Dataset = []struct {
+	Key   string
+	Value string
+}{
+	{"a", "1"},
+	{"ab", "2"},
+	{"abc", "3"},
+	{"abd", "4"},
+	{"b", "5"},
+	{"ba", strings.Repeat("long value ", 10)},
+	{"c", "six"},
+	{"cccccccc", "seven"},
+	{"\x00", "zero key"},
+	{"\xff\xff", "ff key"},
+}
+
+// Models returns all commitment models in the fixed order: blake2b models for each arity and hash size, then KZG
+func Models() []common.CommitmentModel {
+	ret := make([]common.CommitmentModel, 0)
+	for _, arity := range common.AllPathArity {
+		for _, hashSize := range trie_blake2b.AllHashSize {
+			ret = append(ret, trie_blake2b.New(arity, hashSize))
+		}
+	}
+	return append(ret, trie_kzg_bn256.New())
+}
+
+// NewStore creates in-memory store with the example trie of the model. Returns the store and the root
+func NewStore(m common.CommitmentModel) (*common.InMemoryKVStore, common.VCommitment) {
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte(Identity))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	common.AssertNoError(err)
+	for _, kv := range Dataset {
+		tr.Update([]byte(kv.Key), []byte(kv.Value))
+	}
+	return store, tr.Commit(store)
+}
+
+// NewTrieReader creates the example trie of the model and returns reader of it
+func NewTrieReader(m common.CommitmentModel) *immutable.TrieReader {
+	store, root := NewStore(m)
+	ret, err := immutable.NewTrieReader(m, store, root)
+	common.AssertNoError(err)
+	return ret
+}
+
+// KnownRoot returns the known root of the example trie of the model, as hex string
+func KnownRoot(m common.CommitmentModel) (string, error) {
+	ret, ok := knownRoots[m.ShortName()]
+	if !ok {
+		return "", fmt.Errorf("no known root for the model %s", m.ShortName())
+	}
+	return ret, nil
+}
+
+// knownRoots pinned roots of the example tries by model short name
+var knownRoots = map[string]string{
+	"b2b_PathArity256_HashSize(160)": "b2066216b7c129e328ce415dbd5deed04fc5a3ce",
+	"b2b_PathArity256_HashSize(192)": "f1ff112a88057f2b41d4ab808bfe013068b126f182d80779",
+	"b2b_PathArity256_HashSize(224)": "67c68bc868fcdb87b91b35f1cbed64987211e00cf0478929082e1ffe",
+	"b2b_PathArity256_HashSize(256)": "1fc972edce7586d03405b558bca456e8633cd67c40f0094aa37bc142a59f7edd",
+	"b2b_PathArity16_HashSize(160)":  "f592560e5a2b471f8abf59589ff3c76ddd72db8e",
+	"b2b_PathArity16_HashSize(192)":  "6ce01b13d5c0a011c477f5433c84c37c6b84d8190ddae5b2",
+	"b2b_PathArity16_HashSize(224)":  "f86548798dbbea10ad67c0c3508233786b43f0c80be8cabc02188e0a",
+	"b2b_PathArity16_HashSize(256)":  "28cef4f19cf16ee8cfabf9cb66df268380361572736a3a718d5448bc8f3214e5",
+	"b2b_PathArity4_HashSize(160)":   "0bd34ba6ecae0b214a4c7b9fc024e45cbbba09c2",
+	"b2b_PathArity4_HashSize(192)":   "bbcf3e61b7a30757f89fa30c904d882ca33fec176bc41f25",
+	"b2b_PathArity4_HashSize(224)":   "6bc4f64f1e544deddf713c767f7645bf66db9db9663860662164208b",
+	"b2b_PathArity4_HashSize(256)":   "f11dcfb66806393202dc4614bf66d2d4db8382b1996fb233930b8a2ae7a66915",
+	"b2b_PathArity2_HashSize(160)":   "7c3be095b86c4ab30e5cee6d1b3b3c9d14b66096",
+	"b2b_PathArity2_HashSize(192)":   "e674137560a59540e7933d4e8bfa76c238da833f096a87e6",
+	"b2b_PathArity2_HashSize(224)":   "8762ecb2dd555564fb020b99b90d87e9f75758dff14a34c136bc6655",
+	"b2b_PathArity2_HashSize(256)":   "313e5e332f48064c92dfcce470a89f2d4087f3978515d1c012aa1aff03d63b6e",
+	"kzg-bn256":                      "39c2bc1c3053b79eeaaa3118e7f1a959dcd402672a344d37077b10706c9e755366b39dda6fa714978b40bb0f80f0f50ed832f7a426ad61c52f9b4510d571f553",
+}
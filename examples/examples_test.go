@@ -0,0 +1,22 @@
+package examples
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKnownRoots(t *testing.T) {
+	for _, m := range Models() {
+		t.Run(m.ShortName(), func(t *testing.T) {
+			expected, err := KnownRoot(m)
+			require.NoError(t, err)
+			tr := NewTrieReader(m)
+			require.EqualValues(t, expected, hex.EncodeToString(tr.Root().Bytes()))
+			for _, kv := range Dataset {
+				require.EqualValues(t, kv.Value, tr.GetStr(kv.Key))
+			}
+		})
+	}
+}
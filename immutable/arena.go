@@ -0,0 +1,82 @@
+package immutable
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// nodeArena allocates buffered nodes and their node data in chunks instead of one by one.
+// The arena lives as long as the TrieUpdatable. All buffered nodes become garbage on commit or rollback,
+// so the arena is reset and its chunks are reused by the next batch of updates.
+// The mutated root is never allocated in the arena because its node data survives CommitAndContinue
+type nodeArena struct {
+	nodes        [][]bufferedNode
+	nodeData     [][]common.NodeData
+	nodesUsed    int
+	nodeDataUsed int
+}
+
+const (
+	nodeArenaChunkSize = 256
+	// chunks above this number are released to the GC on reset
+	nodeArenaMaxRetainedChunks = 256
+)
+
+// newBufferedNode allocates the node in the arena. Falls back to heap allocation on nil arena
+func (a *nodeArena) newBufferedNode(n *common.NodeData, triePath []byte) *bufferedNode {
+	if a == nil {
+		return newBufferedNode(n, triePath)
+	}
+	if n == nil {
+		n = a.newNodeData()
+	}
+	chunk, idx := a.nodesUsed/nodeArenaChunkSize, a.nodesUsed%nodeArenaChunkSize
+	if chunk == len(a.nodes) {
+		a.nodes = append(a.nodes, make([]bufferedNode, nodeArenaChunkSize))
+	}
+	a.nodesUsed++
+	ret := &a.nodes[chunk][idx]
+	ret.nodeData = n
+	ret.terminal = n.Terminal
+	ret.pathFragment = n.PathFragment
+	ret.triePath = triePath
+	ret.arena = a
+	return ret
+}
+
+func (a *nodeArena) newNodeData() *common.NodeData {
+	chunk, idx := a.nodeDataUsed/nodeArenaChunkSize, a.nodeDataUsed%nodeArenaChunkSize
+	if chunk == len(a.nodeData) {
+		a.nodeData = append(a.nodeData, make([]common.NodeData, nodeArenaChunkSize))
+	}
+	a.nodeDataUsed++
+	ret := &a.nodeData[chunk][idx]
+	ret.ChildCommitments = make(map[byte]common.VCommitment)
+	return ret
+}
+
+// reset makes all allocated nodes invalid. Used part of chunks is zeroed, so it does not keep references
+func (a *nodeArena) reset() {
+	if a == nil {
+		return
+	}
+	for i := 0; i < a.nodesUsed; i++ {
+		a.nodes[i/nodeArenaChunkSize][i%nodeArenaChunkSize] = bufferedNode{}
+	}
+	for i := 0; i < a.nodeDataUsed; i++ {
+		a.nodeData[i/nodeArenaChunkSize][i%nodeArenaChunkSize] = common.NodeData{}
+	}
+	if len(a.nodes) > nodeArenaMaxRetainedChunks {
+		a.nodes = a.nodes[:nodeArenaMaxRetainedChunks]
+	}
+	if len(a.nodeData) > nodeArenaMaxRetainedChunks {
+		a.nodeData = a.nodeData[:nodeArenaMaxRetainedChunks]
+	}
+	a.nodesUsed, a.nodeDataUsed = 0, 0
+}
+
+// newMutatedRoot creates the root buffered node. Its children are allocated in the arena
+func (tr *TrieUpdatable) newMutatedRoot(n *common.NodeData) *bufferedNode {
+	ret := newBufferedNode(n, nil)
+	ret.arena = tr.arena
+	return ret
+}
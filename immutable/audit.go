@@ -0,0 +1,76 @@
+package immutable
+
+import (
+	"bytes"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Audit compares the state committed in the trie with the plain reference key/value store, for example with
+// the raw state partition maintained by the application alongside the trie.
+// For each key which differs, the callback is called:
+// - trieValue != nil, refValue == nil: the key is in the trie only
+// - trieValue == nil, refValue != nil: the key is in the reference store only
+// - trieValue != nil, refValue != nil: the values differ
+// Keys of the trie are reported first, in lexicographic order, then keys of the reference store, in the order
+// of its iterator. The identity of the state (empty key) is ignored. The keys of the secure trie are hashed,
+// so the reference store must contain hashed keys too. Iteration stops when callback returns false
+func Audit(tr *TrieReader, ref common.KVTraversableReader, fun func(key, trieValue, refValue []byte) bool) {
+	stopped := false
+	tr.Iterate(func(k, v []byte) bool {
+		if len(k) == 0 {
+			return true
+		}
+		refValue := ref.Get(k)
+		if bytes.Equal(v, refValue) {
+			return true
+		}
+		stopped = !fun(k, v, refValue)
+		return !stopped
+	})
+	if stopped {
+		return
+	}
+	ref.Iterator(nil).Iterate(func(k, v []byte) bool {
+		if len(k) == 0 || tr.Has(k) {
+			return true
+		}
+		return fun(k, nil, v)
+	})
+}
+
+// AuditReport is the result of AuditState
+type AuditReport struct {
+	// OnlyInTrie are keys committed in the trie and absent in the reference store
+	OnlyInTrie [][]byte
+	// OnlyInReference are keys present in the reference store and absent in the trie
+	OnlyInReference [][]byte
+	// Different are keys with different values in the trie and in the reference store
+	Different [][]byte
+}
+
+// AuditState collects all discrepancies between the trie and the reference store. See Audit
+func AuditState(tr *TrieReader, ref common.KVTraversableReader) *AuditReport {
+	ret := &AuditReport{
+		OnlyInTrie:      make([][]byte, 0),
+		OnlyInReference: make([][]byte, 0),
+		Different:       make([][]byte, 0),
+	}
+	Audit(tr, ref, func(key, trieValue, refValue []byte) bool {
+		switch {
+		case refValue == nil:
+			ret.OnlyInTrie = append(ret.OnlyInTrie, key)
+		case trieValue == nil:
+			ret.OnlyInReference = append(ret.OnlyInReference, key)
+		default:
+			ret.Different = append(ret.Different, key)
+		}
+		return true
+	})
+	return ret
+}
+
+// Consistent returns true if no discrepancies were found
+func (r *AuditReport) Consistent() bool {
+	return len(r.OnlyInTrie) == 0 && len(r.OnlyInReference) == 0 && len(r.Different) == 0
+}
@@ -0,0 +1,94 @@
+package immutable
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Transparent compression of values.
+// When enabled, values are compressed on commit and, if compression makes them smaller, they are written into
+// the partition PartitionCompressedValues instead of PartitionValues. The compressed value is prefixed with
+// 1 byte of the compression algorithm, so reading does not need any configuration: the value is looked up in
+// both partitions and decompressed if needed.
+// Commitments are always calculated over the uncompressed bytes. Snapshots contain uncompressed values.
+// Values in the generational partitions (see EnableValueGenerations) are never compressed
+
+// ValueCompression is the compression algorithm of values
+type ValueCompression byte
+
+const (
+	ValueCompressionNone = ValueCompression(iota)
+	ValueCompressionSnappy
+	ValueCompressionZstd
+)
+
+var errUnknownValueCompression = errors.New("unknown value compression")
+
+func (c ValueCompression) String() string {
+	switch c {
+	case ValueCompressionNone:
+		return "none"
+	case ValueCompressionSnappy:
+		return "snappy"
+	case ValueCompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("ValueCompression(%d)", byte(c))
+	}
+}
+
+// algorithms are the same as common.Compression
+func (c ValueCompression) compress(data []byte) []byte {
+	if c == ValueCompressionNone {
+		panic(errUnknownValueCompression)
+	}
+	return common.Compression(c).Compress(data)
+}
+
+func (c ValueCompression) decompress(data []byte) ([]byte, error) {
+	if c == ValueCompressionNone {
+		return nil, errUnknownValueCompression
+	}
+	return common.Compression(c).Decompress(data)
+}
+
+// EnableValueCompression makes Commit to compress values with the algorithm.
+// ValueCompressionNone disables compression of new values. Values already stored remain readable
+func (tr *TrieUpdatable) EnableValueCompression(c ValueCompression) {
+	common.Assertf(c <= ValueCompressionZstd, "EnableValueCompression: %s", c)
+	tr.valueCompression = c
+}
+
+// compressingWriter writes the value compressed, if it makes value smaller, otherwise uncompressed
+type compressingWriter struct {
+	values     common.KVWriter
+	compressed common.KVWriter
+	c          ValueCompression
+}
+
+func (w *compressingWriter) Set(key, value []byte) {
+	if len(value) == 0 {
+		w.values.Set(key, nil)
+		w.compressed.Set(key, nil)
+		return
+	}
+	data := w.c.compress(value)
+	if len(data)+1 >= len(value) {
+		w.values.Set(key, value)
+		return
+	}
+	w.compressed.Set(key, common.Concat(byte(w.c), data))
+}
+
+// getCompressedValue looks for the value in the compressed partition and decompresses it
+func (ns *NodeStore) getCompressedValue(key []byte) []byte {
+	data := ns.compressedValueStore.Get(key)
+	if len(data) == 0 {
+		return nil
+	}
+	ret, err := ValueCompression(data[0]).decompress(data[1:])
+	common.AssertNoError(err, "getCompressedValue")
+	return ret
+}
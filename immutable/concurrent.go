@@ -0,0 +1,137 @@
+package immutable
+
+import (
+	"sync"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+type (
+	// ConcurrentTrieUpdatable is the updatable trie which accepts updates from many goroutines in parallel.
+	// Pending updates are sharded by the top-level child index of the key, i.e. by the first element of the
+	// unpacked key, and each shard has its own lock: goroutines which update disjoint key ranges do not contend.
+	// Pending updates are applied to the trie and committed by Commit, which waits for the running updates
+	// and blocks new ones until it is finished. Get and Has see pending updates.
+	// The secure trie is not supported: keys are sharded before hashing
+	ConcurrentTrieUpdatable struct {
+		// Update, Get and Has hold the read lock, Commit holds the write lock
+		commitMutex sync.RWMutex
+		tr          *TrieUpdatable
+		shards      []concurrentTrieShard
+	}
+
+	concurrentTrieShard struct {
+		mutex   sync.Mutex
+		pending *common.Mutations
+	}
+)
+
+func NewConcurrentTrieUpdatable(m common.CommitmentModel, store common.KVReader, root common.VCommitment, cacheSize ...int) (*ConcurrentTrieUpdatable, error) {
+	tr, err := NewTrieUpdatable(m, store, root, cacheSize...)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ConcurrentTrieUpdatable{
+		tr:     tr,
+		shards: make([]concurrentTrieShard, int(m.PathArity())+1),
+	}
+	for i := range ret.shards {
+		ret.shards[i].pending = common.NewMutations()
+	}
+	return ret, nil
+}
+
+func (c *ConcurrentTrieUpdatable) shard(key []byte) *concurrentTrieShard {
+	common.Assertf(len(key) > 0, "identity of the state can't be changed")
+	return &c.shards[common.UnpackBytes(key[:1], c.tr.PathArity())[0]]
+}
+
+// Update buffers the update of the key. Empty value deletes the key. Thread-safe
+func (c *ConcurrentTrieUpdatable) Update(key []byte, value []byte) {
+	c.commitMutex.RLock()
+	defer c.commitMutex.RUnlock()
+
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pending.Set(common.Concat(key), common.Concat(value))
+}
+
+func (c *ConcurrentTrieUpdatable) Delete(key []byte) {
+	c.Update(key, nil)
+}
+
+// Get returns the pending value of the key, if it was updated since the last commit,
+// otherwise the value in the committed trie. Thread-safe
+func (c *ConcurrentTrieUpdatable) Get(key []byte) []byte {
+	c.commitMutex.RLock()
+	defer c.commitMutex.RUnlock()
+
+	if len(key) > 0 {
+		s := c.shard(key)
+		s.mutex.Lock()
+		v, pending := s.pending.Lookup(key)
+		s.mutex.Unlock()
+		if pending {
+			return common.Concat(v)
+		}
+	}
+	return c.tr.TrieReader.Get(key)
+}
+
+func (c *ConcurrentTrieUpdatable) Has(key []byte) bool {
+	return len(c.Get(key)) > 0
+}
+
+// Root returns the root of the last commit
+func (c *ConcurrentTrieUpdatable) Root() common.VCommitment {
+	c.commitMutex.RLock()
+	defer c.commitMutex.RUnlock()
+
+	return c.tr.Root()
+}
+
+// Pending returns number of keys updated since the last commit
+func (c *ConcurrentTrieUpdatable) Pending() int {
+	c.commitMutex.RLock()
+	defer c.commitMutex.RUnlock()
+
+	ret := 0
+	for i := range c.shards {
+		c.shards[i].mutex.Lock()
+		c.shards[i].pending.Iterate(func(_ []byte, _ []byte, _ bool) bool {
+			ret++
+			return true
+		})
+		c.shards[i].mutex.Unlock()
+	}
+	return ret
+}
+
+// Commit applies pending updates of all shards to the trie and commits it to the store like
+// TrieUpdatable.CommitAndContinue. The committed nodes must be readable from the store the trie was created with.
+// Returns the new root
+func (c *ConcurrentTrieUpdatable) Commit(store common.KVWriter) common.VCommitment {
+	c.commitMutex.Lock()
+	defer c.commitMutex.Unlock()
+
+	for i := range c.shards {
+		c.shards[i].pending.Iterate(func(k []byte, v []byte, _ bool) bool {
+			c.tr.Update(k, v)
+			return true
+		})
+		c.shards[i].pending = common.NewMutations()
+	}
+	return c.tr.CommitAndContinue(store)
+}
+
+// Rollback discards all pending updates
+func (c *ConcurrentTrieUpdatable) Rollback() {
+	c.commitMutex.Lock()
+	defer c.commitMutex.Unlock()
+
+	for i := range c.shards {
+		c.shards[i].pending = common.NewMutations()
+	}
+}
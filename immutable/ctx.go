@@ -0,0 +1,52 @@
+package immutable
+
+import (
+	"context"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Context-aware variants of long-running scans. The context is checked periodically while visiting trie nodes,
+// so the scan is cancelled even if the visited part of the trie contains no keys.
+// All of them return the error of the context if the scan was cancelled, nil otherwise
+
+// IterateCtx iterates all the key/value pairs in the trie until callback returns false or context is cancelled
+func (tr *TrieReader) IterateCtx(ctx context.Context, f func(k []byte, v []byte) bool) error {
+	c := common.NewContextChecker(ctx)
+	tr.iteratePrefix(f, nil, true, c)
+	return c.Err()
+}
+
+// IterateKeysCtx iterates all the keys in the trie until callback returns false or context is cancelled
+func (tr *TrieReader) IterateKeysCtx(ctx context.Context, f func(k []byte) bool) error {
+	c := common.NewContextChecker(ctx)
+	tr.iteratePrefix(func(k []byte, _ []byte) bool { return f(k) }, nil, false, c)
+	return c.Err()
+}
+
+func (ti *TrieIterator) IterateCtx(ctx context.Context, fun func(k []byte, v []byte) bool) error {
+	c := common.NewContextChecker(ctx)
+	ti.tr.iteratePrefix(fun, ti.prefix, true, c)
+	return c.Err()
+}
+
+func (ti *TrieIterator) IterateKeysCtx(ctx context.Context, fun func(k []byte) bool) error {
+	c := common.NewContextChecker(ctx)
+	ti.tr.iteratePrefix(func(k []byte, _ []byte) bool { return fun(k) }, ti.prefix, false, c)
+	return c.Err()
+}
+
+// SnapshotCtx is Snapshot which can be cancelled. The destination store contains partial snapshot if cancelled
+func (tr *TrieReader) SnapshotCtx(ctx context.Context, destStore common.KVWriter) error {
+	c := common.NewContextChecker(ctx)
+	tr.snapshot(destStore, c)
+	return c.Err()
+}
+
+// SnapshotDataCtx is SnapshotData which can be cancelled
+func (tr *TrieReader) SnapshotDataCtx(ctx context.Context, dest common.KVWriter) error {
+	return tr.IterateCtx(ctx, func(k []byte, v []byte) bool {
+		dest.Set(k, v)
+		return true
+	})
+}
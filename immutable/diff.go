@@ -0,0 +1,194 @@
+package immutable
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Diff is a structural diff engine. It walks two tries in parallel and compares nodes at the same positions.
+// Subtrees with equal commitments are skipped without traversing them, so the cost of the diff is
+// proportional to the size of the difference, not to the size of the tries. If commitments of the model
+// do not depend on positions of nodes (see common.CommitmentsDependOnPosition), only subtrees at the same position are skipped.
+// For each key which differs, the callback is called in lexicographic order of keys:
+// - valueA == nil, valueB != nil: the key was added in B
+// - valueA != nil, valueB == nil: the key was removed in B
+// - valueA != nil, valueB != nil: the value of the key was changed
+// Both tries must use the same commitment model. Iteration stops when callback returns false
+func Diff(trA, trB *TrieReader, fun func(key, valueA, valueB []byte) bool) {
+	DiffPrefix(trA, trB, nil, fun)
+}
+
+// DiffPrefix is Diff restricted to the keys with the prefix
+func DiffPrefix(trA, trB *TrieReader, prefix []byte, fun func(key, valueA, valueB []byte) bool) {
+	common.Assertf(trA.PathArity() == trB.PathArity(), "Diff: tries must have the same path arity")
+	d := &differ{
+		trA:    trA,
+		trB:    trB,
+		prefix: common.UnpackBytes(prefix, trA.PathArity()),
+		fun:    fun,
+
+		commitmentsDependOnPosition: common.CommitmentsDependOnPosition(trA.Model()),
+	}
+	a := &diffCursor{n: trA.nodeStore.MustFetchNodeData(trA.persistentRoot)}
+	b := &diffCursor{n: trB.nodeStore.MustFetchNodeData(trB.persistentRoot)}
+	d.diff(a, b)
+}
+
+type (
+	differ struct {
+		trA, trB *TrieReader
+		prefix   []byte
+		fun      func(key, valueA, valueB []byte) bool
+		// if false, equal commitments mean equal subtrees only at the same position
+		commitmentsDependOnPosition bool
+	}
+
+	// diffCursor is a node together with its position in the trie
+	diffCursor struct {
+		n       *common.NodeData
+		nodeKey []byte
+	}
+)
+
+func (c *diffCursor) fullPath() []byte {
+	return common.Concat(c.nodeKey, c.n.PathFragment)
+}
+
+func (c *diffCursor) child(tr *TrieReader, childIndex byte) *diffCursor {
+	n, childKey := tr.nodeStore.FetchChild(c.n, childIndex, c.nodeKey)
+	if n == nil {
+		return nil
+	}
+	return &diffCursor{n: n, nodeKey: childKey}
+}
+
+func (d *differ) compatibleWithPrefix(fullPath []byte) bool {
+	return bytes.HasPrefix(fullPath, d.prefix) || bytes.HasPrefix(d.prefix, fullPath)
+}
+
+// emit returns false if iteration must stop
+func (d *differ) emit(unpackedKey []byte, terminalA, terminalB common.TCommitment) bool {
+	if !bytes.HasPrefix(unpackedKey, d.prefix) {
+		return true
+	}
+	if common.IsNil(terminalA) && common.IsNil(terminalB) {
+		return true
+	}
+	if d.trA.Model().EqualCommitments(terminalA, terminalB) {
+		return true
+	}
+	key, err := common.PackUnpackedBytes(unpackedKey, d.trA.PathArity())
+	common.AssertNoError(err)
+	return d.fun(key, d.trA.terminalValue(terminalA, key), d.trB.terminalValue(terminalB, key))
+}
+
+// diff returns false if iteration must stop
+func (d *differ) diff(a, b *diffCursor) bool {
+	switch {
+	case a == nil && b == nil:
+		return true
+	case a == nil:
+		return d.emitAll(d.trB, b, false)
+	case b == nil:
+		return d.emitAll(d.trA, a, true)
+	}
+	if d.sameSubtree(a, b) {
+		return true
+	}
+	fpA, fpB := a.fullPath(), b.fullPath()
+	if !d.compatibleWithPrefix(fpA) && !d.compatibleWithPrefix(fpB) {
+		return true
+	}
+	switch {
+	case bytes.Equal(fpA, fpB):
+		if !d.emit(fpA, a.n.Terminal, b.n.Terminal) {
+			return false
+		}
+		for i := 0; i < d.trA.PathArity().NumChildren(); i++ {
+			if !d.diff(a.child(d.trA, byte(i)), b.child(d.trB, byte(i))) {
+				return false
+			}
+		}
+		return true
+
+	case bytes.HasPrefix(fpB, fpA):
+		// node A branches earlier than B. All keys in B has prefix fpB, so B corresponds to one of A's children
+		if !d.emit(fpA, a.n.Terminal, nil) {
+			return false
+		}
+		idx := fpB[len(fpA)]
+		for i := 0; i < d.trA.PathArity().NumChildren(); i++ {
+			if byte(i) == idx {
+				if !d.diff(a.child(d.trA, byte(i)), b) {
+					return false
+				}
+			} else if !d.diff(a.child(d.trA, byte(i)), nil) {
+				return false
+			}
+		}
+		return true
+
+	case bytes.HasPrefix(fpA, fpB):
+		if !d.emit(fpB, nil, b.n.Terminal) {
+			return false
+		}
+		idx := fpA[len(fpB)]
+		for i := 0; i < d.trB.PathArity().NumChildren(); i++ {
+			if byte(i) == idx {
+				if !d.diff(a, b.child(d.trB, byte(i))) {
+					return false
+				}
+			} else if !d.diff(nil, b.child(d.trB, byte(i))) {
+				return false
+			}
+		}
+		return true
+	}
+	// paths diverge: no common keys
+	if bytes.Compare(fpA, fpB) < 0 {
+		return d.emitAll(d.trA, a, true) && d.emitAll(d.trB, b, false)
+	}
+	return d.emitAll(d.trB, b, false) && d.emitAll(d.trA, a, true)
+}
+
+// sameSubtree returns true if the nodes are roots of subtrees with the same keys and values.
+// In models like MPT equal subtrees at different positions have the same commitment, so positions are compared too
+func (d *differ) sameSubtree(a, b *diffCursor) bool {
+	if !d.trA.Model().EqualCommitments(a.n.Commitment, b.n.Commitment) {
+		return false
+	}
+	return d.commitmentsDependOnPosition || bytes.Equal(a.nodeKey, b.nodeKey)
+}
+
+// emitAll emits all keys of the subtree as removed (if inA) or added
+func (d *differ) emitAll(tr *TrieReader, c *diffCursor, inA bool) bool {
+	if !d.compatibleWithPrefix(c.fullPath()) {
+		return true
+	}
+	return tr.iterateNodes(c.n.Commitment, c.nodeKey, func(nodeKey []byte, n *common.NodeData) bool {
+		if common.IsNil(n.Terminal) {
+			return true
+		}
+		if inA {
+			return d.emit(common.Concat(nodeKey, n.PathFragment), n.Terminal, nil)
+		}
+		return d.emit(common.Concat(nodeKey, n.PathFragment), nil, n.Terminal)
+	})
+}
+
+// terminalValue returns value committed by the terminal commitment
+func (tr *TrieReader) terminalValue(terminal common.TCommitment, key []byte) []byte {
+	if common.IsNil(terminal) {
+		return nil
+	}
+	value, inTheCommitment := terminal.ExtractValue()
+	if inTheCommitment {
+		return value
+	}
+	value = tr.nodeStore.getValue(common.AsKey(terminal))
+	common.Assertf(len(value) > 0, "can't fetch value. key: '%s', data commitment: %s",
+		func() string { return hex.EncodeToString(key) }, terminal)
+	return value
+}
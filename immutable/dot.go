@@ -0,0 +1,71 @@
+package immutable
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+const dotCommitmentPrefixLen = 4
+
+// WriteDOT renders the node structure of the trie in Graphviz DOT format. Intended for debugging of small tries.
+// Each node is labeled with its path fragment (unpacked, hex), truncated commitment and terminal flag:
+// 'T' if the node has terminal, 'T*' if the value is in the terminal commitment.
+// Edges are labeled with the child index.
+// If maxNodes > 0, rendering stops after maxNodes nodes
+func (tr *TrieReader) WriteDOT(w io.Writer, maxNodes ...int) error {
+	limit := 0
+	if len(maxNodes) > 0 {
+		limit = maxNodes[0]
+	}
+	if _, err := fmt.Fprintf(w, "digraph trie {\n\tnode [shape=record, fontname=\"monospace\"];\n"); err != nil {
+		return err
+	}
+	var err error
+	count := 0
+	tr.iterateNodes(tr.persistentRoot, nil, func(_ []byte, n *common.NodeData) bool {
+		if limit > 0 && count >= limit {
+			return false
+		}
+		count++
+		id := dotNodeID(n.Commitment)
+		if _, err = fmt.Fprintf(w, "\t%s [label=\"{%s|pf: %s|%s}\"];\n",
+			id, truncatedCommitment(n.Commitment), hex.EncodeToString(n.PathFragment), dotTerminalFlag(n.Terminal)); err != nil {
+			return false
+		}
+		n.IterateChildren(func(childIndex byte, childCommitment common.VCommitment) bool {
+			_, err = fmt.Fprintf(w, "\t%s -> %s [label=\"%d\"];\n", id, dotNodeID(childCommitment), childIndex)
+			return err == nil
+		})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "}\n")
+	return err
+}
+
+func dotNodeID(c common.VCommitment) string {
+	return "n" + hex.EncodeToString(common.AsKey(c))
+}
+
+func truncatedCommitment(c common.VCommitment) string {
+	data := common.AsKey(c)
+	if len(data) > dotCommitmentPrefixLen {
+		data = data[:dotCommitmentPrefixLen]
+	}
+	return hex.EncodeToString(data) + ".."
+}
+
+func dotTerminalFlag(t common.TCommitment) string {
+	if common.IsNil(t) {
+		return "-"
+	}
+	if _, inTheCommitment := t.ExtractValue(); inTheCommitment {
+		return "T*"
+	}
+	return "T"
+}
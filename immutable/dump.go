@@ -0,0 +1,56 @@
+package immutable
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// DumpTrie writes deterministic human-readable dump of all nodes and terminal values under the root of the reader.
+// Nodes are written in the depth-first lexicographical order, indented by depth. Each node is written as:
+//
+//	node <commitment> key: <unpacked trie key of the node, hex> pf: <path fragment, hex>
+//	  children: <child indices>
+//	  terminal: <terminal commitment> key: <quoted key> value: <quoted value>
+//
+// The dump is suitable for diffing two states in tests
+func DumpTrie(tr *TrieReader, w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "root %s model %s\n", tr.Root(), tr.Model().ShortName()); err != nil {
+		return err
+	}
+	var err error
+	depth := make(map[string]int)
+	tr.iterateNodes(tr.persistentRoot, nil, func(nodeKey []byte, n *common.NodeData) bool {
+		d := depth[string(nodeKey)]
+		indent := strings.Repeat("  ", d)
+		if _, err = fmt.Fprintf(w, "%snode %s key: %s pf: %s\n", indent, n.Commitment,
+			hex.EncodeToString(nodeKey), hex.EncodeToString(n.PathFragment)); err != nil {
+			return false
+		}
+		children := make([]string, 0)
+		n.IterateChildren(func(childIndex byte, _ common.VCommitment) bool {
+			children = append(children, fmt.Sprintf("%d", childIndex))
+			depth[string(common.Concat(nodeKey, n.PathFragment, childIndex))] = d + 1
+			return true
+		})
+		if len(children) > 0 {
+			if _, err = fmt.Fprintf(w, "%s  children: %s\n", indent, strings.Join(children, " ")); err != nil {
+				return false
+			}
+		}
+		if common.IsNil(n.Terminal) {
+			return true
+		}
+		var key []byte
+		key, err = common.PackUnpackedBytes(common.Concat(nodeKey, n.PathFragment), tr.PathArity())
+		if err != nil {
+			return false
+		}
+		_, err = fmt.Fprintf(w, "%s  terminal: %s key: %q value: %q\n", indent, n.Terminal, key, tr.terminalValue(n.Terminal, key))
+		return err == nil
+	})
+	return err
+}
@@ -0,0 +1,46 @@
+package immutable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// The trie stream is the KV stream of all key/value pairs committed in the root, in the deterministic order of
+// the trie traversal, preceded by the header. The header is the first pair of the stream: StreamHeaderKey
+// and common.SnapshotHeader protobuf, which identifies the root, the model, the arity and the hash size.
+// The header is recognized by its position, so the key can't collide with keys of the trie.
+// The identity of the state (value of the empty key) is exported as the first pair after the header
+
+var ErrStreamHeader = errors.New("wrong or missing header of the trie stream")
+
+// StreamHeaderKey key of the header of the trie stream
+var StreamHeaderKey = []byte("unitrie:header")
+
+// ExportStream writes the header and all key/value pairs of the trie to w
+func (tr *TrieReader) ExportStream(w common.KVStreamWriter) error {
+	header := common.NewSnapshotHeader(tr.Model(), tr.Root())
+	if err := w.Write(StreamHeaderKey, header.Protobuf()); err != nil {
+		return err
+	}
+	var err error
+	tr.Iterate(func(k []byte, v []byte) bool {
+		err = w.Write(k, v)
+		return err == nil
+	})
+	return err
+}
+
+// ParseStreamHeader parses the first pair of the trie stream
+func ParseStreamHeader(key, value []byte) (*common.SnapshotHeader, error) {
+	if !bytes.Equal(key, StreamHeaderKey) {
+		return nil, ErrStreamHeader
+	}
+	ret, err := common.SnapshotHeaderFromProtobuf(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStreamHeader, err)
+	}
+	return ret, nil
+}
@@ -0,0 +1,82 @@
+package immutable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+var ErrStreamRootMismatch = errors.New("imported trie stream doesn't match the header or the trie")
+
+// ImportStream applies the KV stream to the trie and commits it every commitEvery pairs (0 means only at the end),
+// so the buffered mutations never grow beyond commitEvery pairs. Empty value deletes the key.
+// Returns the chain of roots of the commits: the last one is the root of the trie after the whole stream.
+// If the stream starts with the header (see ExportStream), the model of the header is checked before any pair
+// is applied. If the trie contains only the identity before the import, the final root is also checked
+// against the root of the header. The pair with the empty key (the identity) is not applied: it must be equal
+// to the identity of the trie.
+// In case of error the uncommitted pairs are rolled back: the trie remains at the last returned root
+func ImportStream(tr *TrieChained, iter common.KVStreamIterator, commitEvery int) ([]common.VCommitment, error) {
+	identity, startsEmpty := trieIdentity(tr.TrieReader)
+	roots := make([]common.VCommitment, 0)
+	var header *common.SnapshotHeader
+	var headerRoot common.VCommitment
+	first := true
+	pending := 0
+	var err error
+	errIter := iter.Iterate(func(k, v []byte) bool {
+		if first {
+			first = false
+			if bytes.Equal(k, StreamHeaderKey) {
+				if header, err = ParseStreamHeader(k, v); err == nil {
+					headerRoot, err = header.CheckModel(tr.Model())
+				}
+				return err == nil
+			}
+		}
+		if len(k) == 0 {
+			if !bytes.Equal(v, identity) {
+				err = fmt.Errorf("%w: identity of the stream differs from the identity of the trie", ErrStreamRootMismatch)
+				return false
+			}
+			return true
+		}
+		tr.Update(common.Concat(k), common.Concat(v))
+		pending++
+		if commitEvery > 0 && pending >= commitEvery {
+			roots = append(roots, tr.CommitChained().Root().Clone())
+			pending = 0
+		}
+		return true
+	})
+	if err == nil {
+		err = errIter
+	}
+	if err != nil {
+		tr.Rollback()
+		return roots, err
+	}
+	if pending > 0 {
+		roots = append(roots, tr.CommitChained().Root().Clone())
+	}
+	if header != nil && startsEmpty && !tr.Model().EqualCommitments(tr.Root(), headerRoot) {
+		return roots, fmt.Errorf("%w: root of the imported trie is %s, expected %s", ErrStreamRootMismatch, tr.Root(), headerRoot)
+	}
+	return roots, nil
+}
+
+// trieIdentity returns the identity (value of the empty key) and true if it is the only key of the trie
+func trieIdentity(tr *TrieReader) ([]byte, bool) {
+	var identity []byte
+	keys := 0
+	tr.Iterate(func(k []byte, v []byte) bool {
+		if len(k) == 0 {
+			identity = v
+		}
+		keys++
+		return keys < 2
+	})
+	return identity, keys == 1 && identity != nil
+}
@@ -0,0 +1,74 @@
+package immutable
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+var ErrIntegrityViolated = errors.New("trie integrity violated")
+
+// VerifyIntegrity walks the whole trie committed in the root, recomputes the commitment of each node from its
+// serialized data and checks each value stored outside the node against its terminal commitment.
+// Nodes are visited in the depth-first lexicographical order, the first mismatch is returned as
+// ErrIntegrityViolated. Intended for detection of silent corruption of the database
+func VerifyIntegrity(store common.KVReader, m common.CommitmentModel, root common.VCommitment) error {
+	ns := openImmutableNodeStore(store, m, 0)
+	stack := []expectedNode{{commitment: root}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		nodeBin := ns.trieStore.Get(common.AsKey(e.commitment))
+		if len(nodeBin) == 0 {
+			return fmt.Errorf("%w: missing node %s, trie path '%x'", ErrIntegrityViolated, e.commitment, e.nodePath)
+		}
+		n, err := common.NodeDataFromBytes(m, nodeBin, m.PathArity(), func(_ []byte) ([]byte, error) {
+			return nil, errors.New("terminal commitment must be stored in the trie node")
+		})
+		if err != nil {
+			return fmt.Errorf("%w: can't parse node %s, trie path '%x': %v", ErrIntegrityViolated, e.commitment, e.nodePath, err)
+		}
+		if c := m.CalcNodeCommitment(n, e.nodePath); common.IsNil(c) || !m.EqualCommitments(c, e.commitment) {
+			return fmt.Errorf("%w: wrong data of the node %s, trie path '%x'", ErrIntegrityViolated, e.commitment, e.nodePath)
+		}
+		if err = verifyTerminalValue(ns, m, n.Terminal); err != nil {
+			return fmt.Errorf("%w: node %s, trie path '%x': %v", ErrIntegrityViolated, e.commitment, e.nodePath, err)
+		}
+		// children are pushed in the reverse order to be visited in the ascending order
+		for i := int(m.PathArity()); i >= 0; i-- {
+			if c, ok := n.ChildCommitments[byte(i)]; ok {
+				stack = append(stack, expectedNode{
+					commitment: c,
+					nodePath:   common.Concat(e.nodePath, n.PathFragment, byte(i)),
+				})
+			}
+		}
+	}
+	return nil
+}
+
+func verifyTerminalValue(ns *NodeStore, m common.CommitmentModel, terminal common.TCommitment) error {
+	if common.IsNil(terminal) {
+		return nil
+	}
+	if _, inTheCommitment := terminal.ExtractValue(); inTheCommitment {
+		return nil
+	}
+	var value []byte
+	err := common.CatchPanicOrError(func() error {
+		value = ns.getValue(common.AsKey(terminal))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't read value of the terminal %s: %v", terminal, err)
+	}
+	if len(value) == 0 {
+		return fmt.Errorf("missing value of the terminal %s", terminal)
+	}
+	if !m.EqualCommitments(m.CommitToData(value), terminal) {
+		return fmt.Errorf("wrong value of the terminal %s", terminal)
+	}
+	return nil
+}
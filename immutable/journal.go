@@ -0,0 +1,247 @@
+package immutable
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Journal of the trie mutations. The journal is the sequence of records, each one is an Update, Delete or
+// Commit with the timestamp. The workload captured by the Recorder can be replayed with Replay on another trie,
+// for example for benchmarking or for regression analysis.
+// Record is serialized as: 1 byte operation, 8 bytes timestamp (Unix nanoseconds, big-endian), then
+// for Update: key (WriteBytes16) and value (WriteBytes32), for Delete: key (WriteBytes16),
+// for Commit: the committed root (WriteBytes16)
+
+// JournalOp is the operation of the journal record
+type JournalOp byte
+
+const (
+	JournalOpUpdate = JournalOp(iota)
+	JournalOpDelete
+	JournalOpCommit
+)
+
+var (
+	ErrJournalWrongRecord  = errors.New("wrong journal record")
+	ErrReplayRootMismatch  = errors.New("replayed root does not match the recorded one")
+	errRecorderInvalidated = errors.New("recorder has no trie, use SetTrie after Commit")
+)
+
+func (op JournalOp) String() string {
+	switch op {
+	case JournalOpUpdate:
+		return "update"
+	case JournalOpDelete:
+		return "delete"
+	case JournalOpCommit:
+		return "commit"
+	default:
+		return fmt.Sprintf("JournalOp(%d)", byte(op))
+	}
+}
+
+// JournalRecord is one record of the journal
+type JournalRecord struct {
+	Op   JournalOp
+	Time time.Time
+	// Key of Update and Delete
+	Key []byte
+	// Value of Update
+	Value []byte
+	// Root serialized root of Commit
+	Root []byte
+}
+
+func (rec *JournalRecord) Write(w io.Writer) error {
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(rec.Time.UnixNano()))
+	if err := common.WriteByte(w, byte(rec.Op)); err != nil {
+		return err
+	}
+	if _, err := w.Write(ts[:]); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case JournalOpUpdate:
+		if err := common.WriteBytes16(w, rec.Key); err != nil {
+			return err
+		}
+		return common.WriteBytes32(w, rec.Value)
+	case JournalOpDelete:
+		return common.WriteBytes16(w, rec.Key)
+	case JournalOpCommit:
+		return common.WriteBytes16(w, rec.Root)
+	}
+	return fmt.Errorf("%w: unknown operation %s", ErrJournalWrongRecord, rec.Op)
+}
+
+// Read reads the record. Returns io.EOF if there are no more records
+func (rec *JournalRecord) Read(r io.Reader) error {
+	op, err := common.ReadByte(r)
+	if err != nil {
+		return err
+	}
+	var ts [8]byte
+	if _, err = io.ReadFull(r, ts[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	*rec = JournalRecord{
+		Op:   JournalOp(op),
+		Time: time.Unix(0, int64(binary.BigEndian.Uint64(ts[:]))),
+	}
+	switch rec.Op {
+	case JournalOpUpdate:
+		if rec.Key, err = common.ReadBytes16(r); err != nil {
+			return err
+		}
+		rec.Value, err = common.ReadBytes32(r)
+	case JournalOpDelete:
+		rec.Key, err = common.ReadBytes16(r)
+	case JournalOpCommit:
+		rec.Root, err = common.ReadBytes16(r)
+	default:
+		return fmt.Errorf("%w: unknown operation %s", ErrJournalWrongRecord, rec.Op)
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err == nil && rec.Op != JournalOpCommit && len(rec.Key) == 0 {
+		return fmt.Errorf("%w: empty key", ErrJournalWrongRecord)
+	}
+	return err
+}
+
+// Recorder wraps the TrieUpdatable and writes all its mutations and commits to the journal.
+// The first error of writing to the journal is kept and returned by Err, the trie is updated anyway
+type Recorder struct {
+	tr  *TrieUpdatable
+	w   io.Writer
+	err error
+}
+
+// NewRecorder creates the recorder of the trie mutations to the journal w
+func NewRecorder(tr *TrieUpdatable, w io.Writer) *Recorder {
+	return &Recorder{tr: tr, w: w}
+}
+
+// Trie returns the wrapped trie. Mutations of the trie, not made through the recorder, are not recorded
+func (r *Recorder) Trie() *TrieUpdatable {
+	return r.tr
+}
+
+// SetTrie sets the trie to continue recording with, normally the trie created from the root after Commit
+func (r *Recorder) SetTrie(tr *TrieUpdatable) {
+	r.tr = tr
+}
+
+// Err returns the first error of writing to the journal
+func (r *Recorder) Err() error {
+	return r.err
+}
+
+func (r *Recorder) record(rec *JournalRecord) {
+	if r.err != nil {
+		return
+	}
+	r.err = rec.Write(r.w)
+}
+
+// Update same as TrieUpdatable.Update. Empty value is recorded as Delete
+func (r *Recorder) Update(key, value []byte) bool {
+	common.Assertf(r.tr != nil, "%v", errRecorderInvalidated)
+	ret := r.tr.Update(key, value)
+	if len(value) == 0 {
+		r.record(&JournalRecord{Op: JournalOpDelete, Time: time.Now(), Key: key})
+	} else {
+		r.record(&JournalRecord{Op: JournalOpUpdate, Time: time.Now(), Key: key, Value: value})
+	}
+	return ret
+}
+
+// Delete same as TrieUpdatable.Delete
+func (r *Recorder) Delete(key []byte) bool {
+	common.Assertf(r.tr != nil, "%v", errRecorderInvalidated)
+	ret := r.tr.Delete(key)
+	r.record(&JournalRecord{Op: JournalOpDelete, Time: time.Now(), Key: key})
+	return ret
+}
+
+// Commit same as TrieUpdatable.Commit. The trie is invalidated, use SetTrie to continue recording
+func (r *Recorder) Commit(store common.KVWriter) common.VCommitment {
+	common.Assertf(r.tr != nil, "%v", errRecorderInvalidated)
+	ret := r.tr.Commit(store)
+	r.tr = nil
+	r.record(&JournalRecord{Op: JournalOpCommit, Time: time.Now(), Root: ret.Bytes()})
+	return ret
+}
+
+// CommitAndContinue same as TrieUpdatable.CommitAndContinue
+func (r *Recorder) CommitAndContinue(store common.KVWriter) common.VCommitment {
+	common.Assertf(r.tr != nil, "%v", errRecorderInvalidated)
+	ret := r.tr.CommitAndContinue(store)
+	r.record(&JournalRecord{Op: JournalOpCommit, Time: time.Now(), Root: ret.Bytes()})
+	return ret
+}
+
+// ReplayStats is the result of Replay
+type ReplayStats struct {
+	NumUpdates int
+	NumDeletes int
+	NumCommits int
+	// Recorded is the time between the first and the last record of the journal
+	Recorded time.Duration
+	// Replayed is the time it took to replay the journal
+	Replayed time.Duration
+	// Root is the last committed root, nil if there were no commits
+	Root common.VCommitment
+}
+
+// Replay reads the journal and applies it to the trie. Commit records are replayed with CommitAndContinue to
+// the store, so the store must be the one the trie reads from. If verifyRoots is true, each committed root is
+// compared with the recorded one and ErrReplayRootMismatch is returned on the first difference.
+// Mutations after the last commit record remain uncommitted in the trie
+func Replay(r io.Reader, tr *TrieUpdatable, store common.KVWriter, verifyRoots bool) (*ReplayStats, error) {
+	ret := &ReplayStats{}
+	rdr := bufio.NewReader(r)
+	start := time.Now()
+	var first, last time.Time
+	for num := 0; ; num++ {
+		var rec JournalRecord
+		if err := rec.Read(rdr); err == io.EOF {
+			break
+		} else if err != nil {
+			return ret, fmt.Errorf("%w #%d: %v", ErrJournalWrongRecord, num, err)
+		}
+		if num == 0 {
+			first = rec.Time
+		}
+		last = rec.Time
+		switch rec.Op {
+		case JournalOpUpdate:
+			tr.Update(rec.Key, rec.Value)
+			ret.NumUpdates++
+		case JournalOpDelete:
+			tr.Delete(rec.Key)
+			ret.NumDeletes++
+		case JournalOpCommit:
+			ret.Root = tr.CommitAndContinue(store)
+			ret.NumCommits++
+			if verifyRoots && !bytes.Equal(ret.Root.Bytes(), rec.Root) {
+				return ret, fmt.Errorf("%w: commit #%d, expected %x, got %s", ErrReplayRootMismatch, ret.NumCommits, rec.Root, ret.Root)
+			}
+		}
+	}
+	ret.Recorded = last.Sub(first)
+	ret.Replayed = time.Since(start)
+	return ret, nil
+}
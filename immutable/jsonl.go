@@ -0,0 +1,65 @@
+package immutable
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JSONL is the plain text form of the state: one JSON object {"key":"<hex>","value":"<hex>"} per line,
+// in the lexicographical order of keys. The identity of the state (value of the empty key) is not exported.
+// The keys of the secure trie are exported as they are in the trie, i.e. hashed
+
+var ErrJSONLWrongRecord = errors.New("wrong JSONL record")
+
+type jsonlRecord struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ExportJSONL writes all key/value pairs of the state to w as JSON lines
+func ExportJSONL(tr *TrieReader, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	var err error
+	tr.Iterate(func(k []byte, v []byte) bool {
+		if len(k) == 0 {
+			return true
+		}
+		err = enc.Encode(&jsonlRecord{Key: hex.EncodeToString(k), Value: hex.EncodeToString(v)})
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportJSONL reads JSON lines, as written by ExportJSONL, and updates the trie with them.
+// Empty value deletes the key. The trie is not committed. Returns number of imported records
+func ImportJSONL(r io.Reader, tr *TrieUpdatable) (int, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.DisallowUnknownFields()
+	num := 0
+	for {
+		var rec jsonlRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			return num, nil
+		} else if err != nil {
+			return num, fmt.Errorf("%w #%d: %v", ErrJSONLWrongRecord, num, err)
+		}
+		key, err := hex.DecodeString(rec.Key)
+		if err != nil || len(key) == 0 {
+			return num, fmt.Errorf("%w #%d: wrong key '%s'", ErrJSONLWrongRecord, num, rec.Key)
+		}
+		value, err := hex.DecodeString(rec.Value)
+		if err != nil {
+			return num, fmt.Errorf("%w #%d: wrong value of the key '%s'", ErrJSONLWrongRecord, num, rec.Key)
+		}
+		tr.Update(key, value)
+		num++
+	}
+}
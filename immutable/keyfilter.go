@@ -0,0 +1,21 @@
+package immutable
+
+import "github.com/lunfardo314/unitrie/common"
+
+// KeyFilter builds a Bloom filter over all keys committed in the root of the trie reader.
+// Light services may use the filter for fast local checks whether a key might exist
+// before requesting the proof remotely.
+// The filter is sized for the actual number of keys, so the trie is traversed twice. Values are not fetched
+func (tr *TrieReader) KeyFilter(falsePositiveRate float64) *common.BloomFilter {
+	numKeys := 0
+	tr.IterateKeys(func(_ []byte) bool {
+		numKeys++
+		return true
+	})
+	ret := common.NewBloomFilter(numKeys, falsePositiveRate)
+	tr.IterateKeys(func(k []byte) bool {
+		ret.Add(k)
+		return true
+	})
+	return ret
+}
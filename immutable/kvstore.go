@@ -9,52 +9,68 @@ import (
 )
 
 // Update updates TrieUpdatable with the unpackedKey/value. Reorganizes and re-calculates trie, keeps cache consistent
-func (tr *TrieUpdatable) Update(key []byte, value []byte) bool {
+func (tr *TrieUpdatable) Update(key []byte, value []byte) (existed bool) {
+	if tr.tracer != nil {
+		op := TraceOpUpdate
+		if len(value) == 0 {
+			op = TraceOpDelete
+		}
+		defer tr.trace(op, key, func(ev *TraceEvent) { ev.Found = existed })()
+	}
 	common.Assertf(!common.IsNil(tr.persistentRoot), "Update:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "Update:: commit of the trie is prepared")
 	common.Assertf(len(key) > 0, "identity of the state can't be changed")
-	unpackedTriePath := common.UnpackBytes(key, tr.PathArity())
+	tr.countLogicalBytes(len(key) + len(value))
 	if len(value) == 0 {
-		return tr.delete(unpackedTriePath)
+		deleted := tr.delete(common.UnpackBytes(tr.deletedTrieKey(key), tr.PathArity()))
+		tr.countDeletion(deleted, false)
+		return deleted
 	}
-	return tr.update(unpackedTriePath, value)
+	return tr.update(common.UnpackBytes(tr.updatableTrieKey(key), tr.PathArity()), value)
 }
 
 // Delete deletes Key/value from the TrieUpdatable
 // Returns true if key existed, false otherwise
-func (tr *TrieUpdatable) Delete(key []byte) bool {
+func (tr *TrieUpdatable) Delete(key []byte) (existed bool) {
+	if tr.tracer != nil {
+		defer tr.trace(TraceOpDelete, key, func(ev *TraceEvent) { ev.Found = existed })()
+	}
 	common.Assertf(!common.IsNil(tr.persistentRoot), "Delete:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "Delete:: commit of the trie is prepared")
 	common.Assertf(len(key) > 0, "can't delete root")
-	return tr.delete(common.UnpackBytes(key, tr.PathArity()))
+	tr.countLogicalBytes(len(key))
+	deleted := tr.delete(common.UnpackBytes(tr.deletedTrieKey(key), tr.PathArity()))
+	tr.countDeletion(deleted, false)
+	return deleted
 }
 
 // DeletePrefix deletes all kv pairs with the prefix. It is a very fast operation, it modifies only one node
 // and all children (any number) disappears from the next root
 func (tr *TrieUpdatable) DeletePrefix(pathPrefix []byte) bool {
 	common.Assertf(!common.IsNil(tr.persistentRoot), "DeletePrefix:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "DeletePrefix:: commit of the trie is prepared")
+	common.Assertf(!tr.secureKeys, "DeletePrefix:: not supported in the secure trie")
 	if len(pathPrefix) == 0 {
 		// we do not want to delete root, or do we?
 		return false
 	}
+	tr.countLogicalBytes(len(pathPrefix))
 	unpackedPrefix := common.UnpackBytes(pathPrefix, tr.Model().PathArity())
-	return tr.deletePrefix(unpackedPrefix)
+	deleted := tr.deletePrefix(unpackedPrefix)
+	tr.countDeletion(deleted, true)
+	return deleted
 }
 
 // Get reads the trie with the key
-func (tr *TrieReader) Get(key []byte) []byte {
-	unpackedTriePath := common.UnpackBytes(key, tr.PathArity())
+func (tr *TrieReader) Get(key []byte) (ret []byte) {
+	if tr.tracer != nil {
+		defer tr.trace(TraceOpGet, key, func(ev *TraceEvent) { ev.Found = len(ret) > 0 })()
+	}
+	unpackedTriePath := common.UnpackBytes(tr.trieKey(key), tr.PathArity())
 	//defer common.DisposeSmallBuf(unpackedTriePath)
 
-	found := false
-	var terminal common.TCommitment
-	tr.traverseImmutablePath(unpackedTriePath, func(n *common.NodeData, _ []byte, ending common.PathEndingCode) {
-		if ending == common.EndingTerminal {
-			if !common.IsNil(n.Terminal) {
-				found = true
-				terminal = n.Terminal
-			}
-		}
-	})
-	if !found {
+	terminal := tr.findTerminal(unpackedTriePath)
+	if common.IsNil(terminal) {
 		return nil
 	}
 	value, valueInCommitment := common.ExtractValue(terminal)
@@ -63,15 +79,48 @@ func (tr *TrieReader) Get(key []byte) []byte {
 			func() string { return hex.EncodeToString(unpackedTriePath) })
 		return value
 	}
-	value = tr.nodeStore.valueStore.Get(common.AsKey(terminal))
+	value = tr.nodeStore.getValue(common.AsKey(terminal))
 	common.Assertf(len(value) > 0, "value in the value store must be not nil. Unpacked key: '%s'",
 		func() string { return hex.EncodeToString(unpackedTriePath) })
 	return value
 }
 
+// GetFunc calls f with the value of the key and returns true. Returns false if the key is absent.
+// If the store implements common.KVZeroCopyReader, the value is passed to f without copying, so it is valid
+// only during the call and must not be modified or retained by f
+func (tr *TrieReader) GetFunc(key []byte, f func(value []byte)) (found bool) {
+	if tr.tracer != nil {
+		defer tr.trace(TraceOpGet, key, func(ev *TraceEvent) { ev.Found = found })()
+	}
+	unpackedTriePath := common.UnpackBytes(tr.trieKey(key), tr.PathArity())
+
+	terminal := tr.findTerminal(unpackedTriePath)
+	if common.IsNil(terminal) {
+		return false
+	}
+	if value, valueInCommitment := common.ExtractValue(terminal); valueInCommitment {
+		f(value)
+		return true
+	}
+	found = tr.nodeStore.getValueFunc(common.AsKey(terminal), f)
+	common.Assertf(found, "value in the value store must be not nil. Unpacked key: '%s'",
+		func() string { return hex.EncodeToString(unpackedTriePath) })
+	return true
+}
+
+// findTerminal returns terminal commitment of the key or nil if the key is absent
+func (tr *TrieReader) findTerminal(unpackedTriePath []byte) (ret common.TCommitment) {
+	tr.traverseImmutablePath(unpackedTriePath, func(n *common.NodeData, _ []byte, ending common.PathEndingCode) {
+		if ending == common.EndingTerminal && !common.IsNil(n.Terminal) {
+			ret = n.Terminal
+		}
+	})
+	return
+}
+
 // Has check existence of the key in the trie
 func (tr *TrieReader) Has(key []byte) bool {
-	unpackedTriePath := common.UnpackBytes(key, tr.PathArity())
+	unpackedTriePath := common.UnpackBytes(tr.trieKey(key), tr.PathArity())
 	//defer common.DisposeSmallBuf(unpackedTriePath)
 
 	found := false
@@ -93,12 +142,14 @@ func (tr *TrieReader) HasWithPrefix(prefix []byte) bool {
 
 // Iterate iterates all the key/value pairs in the trie
 func (tr *TrieReader) Iterate(f func(k []byte, v []byte) bool) {
-	tr.iteratePrefix(f, nil, true)
+	tr.iteratePrefix(f, nil, true, nil)
 }
 
-// IterateKeys iterates all the keys in the trie
+// IterateKeys iterates all the keys in the trie. It is the fast path for the scans which do not need values:
+// only trie nodes are read, the presence of the key is decided by the terminal commitment in the node.
+// The value partitions are never accessed. Same applies to IterateKeys of the iterator returned by Iterator
 func (tr *TrieReader) IterateKeys(f func(k []byte) bool) {
-	tr.iteratePrefix(func(k []byte, _ []byte) bool { return f(k) }, nil, false)
+	tr.iteratePrefix(func(k []byte, _ []byte) bool { return f(k) }, nil, false, nil)
 }
 
 // TrieIterator implements common.KVIterator interface for keys in the trie with given prefix
@@ -108,13 +159,14 @@ type TrieIterator struct {
 }
 
 func (ti *TrieIterator) Iterate(fun func(k []byte, v []byte) bool) {
-	ti.tr.iteratePrefix(fun, ti.prefix, true)
+	ti.tr.iteratePrefix(fun, ti.prefix, true, nil)
 }
 
+// IterateKeys iterates keys with the prefix without reading values. See TrieReader.IterateKeys
 func (ti *TrieIterator) IterateKeys(fun func(k []byte) bool) {
 	ti.tr.iteratePrefix(func(k []byte, v []byte) bool {
 		return fun(k)
-	}, ti.prefix, false)
+	}, ti.prefix, false, nil)
 }
 
 // Iterator returns iterator for the sub-trie
@@ -135,10 +187,17 @@ func (tr *TrieReader) SnapshotData(dest common.KVWriter) {
 
 // Snapshot writes the whole trie (including values) from specific root to another store
 func (tr *TrieReader) Snapshot(destStore common.KVWriter) {
+	tr.snapshot(destStore, nil)
+}
+
+func (tr *TrieReader) snapshot(destStore common.KVWriter, c *common.ContextChecker) {
 	triePartition := common.MakeWriterPartition(destStore, PartitionTrieNodes)
 	valuePartition := common.MakeWriterPartition(destStore, PartitionValues)
 
 	tr.iterateNodes(tr.persistentRoot, nil, func(nodeKey []byte, n *common.NodeData) bool {
+		if c != nil && c.Cancelled() {
+			return false
+		}
 		// write trie node
 		var buf bytes.Buffer
 		err := n.Write(&buf, tr.Model().PathArity(), false)
@@ -153,7 +212,7 @@ func (tr *TrieReader) Snapshot(destStore common.KVWriter) {
 			return true
 		}
 		valueKey := common.AsKey(n.Terminal)
-		value := tr.nodeStore.valueStore.Get(valueKey)
+		value := tr.nodeStore.getValue(valueKey)
 		common.Assertf(len(value) > 0, "can't find value for nodeKey '%s'", func() string { return hex.EncodeToString(valueKey) })
 		valuePartition.Set(valueKey, value)
 		return true
@@ -179,7 +238,7 @@ func (tr *TrieUpdatable) update(triePath []byte, value []byte) bool {
 	switch ends {
 	case common.EndingTerminal:
 		// reached the end just for the terminal
-		lastNode.setValue(value, tr.Model())
+		lastNode.setValue(value, tr.dataCommitter())
 		keyExisted = true
 
 	case common.EndingExtend:
@@ -212,13 +271,13 @@ func (tr *TrieUpdatable) update(triePath []byte, value []byte) bool {
 		lastNode.setPathFragment(pathFragmentContinue)
 		lastNode.setTriePath(trieKeyToContinue)
 
-		forkingNode := newBufferedNode(nil, trieKey) // will be at path of the old node
+		forkingNode := tr.arena.newBufferedNode(nil, trieKey) // will be at path of the old node
 		forkingNode.setPathFragment(prefix)
 		forkingNode.setModifiedChild(lastNode)
 		prevNode.setModifiedChild(forkingNode)
 
 		if len(triePathTail) == 0 {
-			forkingNode.setValue(value, tr.Model())
+			forkingNode.setValue(value, tr.dataCommitter())
 		} else {
 			childIndexToBranch := triePathTail[0]
 			branchPathFragment := triePathTail[1:]
@@ -280,8 +339,9 @@ func (tr *TrieUpdatable) mergeNodeIfNeeded(node *bufferedNode) *bufferedNode {
 }
 
 // iteratePrefix iterates the key/value with keys with prefix.
-// The order of the iteration will be deterministic
-func (tr *TrieReader) iteratePrefix(f func(k []byte, v []byte) bool, prefix []byte, extractValue bool) {
+// The order of the iteration will be deterministic. If extractValue == false, values are not read and nil is
+// passed to the callback instead. If context checker is not nil, the iteration stops when context is cancelled
+func (tr *TrieReader) iteratePrefix(f func(k []byte, v []byte) bool, prefix []byte, extractValue bool, c *common.ContextChecker) {
 	var root common.VCommitment
 	var triePath []byte
 	unpackedPrefix := common.UnpackBytes(prefix, tr.Model().PathArity())
@@ -296,11 +356,14 @@ func (tr *TrieReader) iteratePrefix(f func(k []byte, v []byte) bool, prefix []by
 			return f(k, v)
 		}
 		return true
-	}, extractValue)
+	}, extractValue, c)
 }
 
-func (tr *TrieReader) iterate(root common.VCommitment, triePath []byte, fun func(k []byte, v []byte) bool, extractValue bool) bool {
+func (tr *TrieReader) iterate(root common.VCommitment, triePath []byte, fun func(k []byte, v []byte) bool, extractValue bool, c *common.ContextChecker) bool {
 	return tr.iterateNodes(root, triePath, func(nodeKey []byte, n *common.NodeData) bool {
+		if c != nil && c.Cancelled() {
+			return false
+		}
 		if !common.IsNil(n.Terminal) {
 			key, err := common.PackUnpackedBytes(common.Concat(nodeKey, n.PathFragment), tr.Model().PathArity())
 			common.AssertNoError(err)
@@ -309,7 +372,7 @@ func (tr *TrieReader) iterate(root common.VCommitment, triePath []byte, fun func
 				var inTheCommitment bool
 				value, inTheCommitment = n.Terminal.ExtractValue()
 				if !inTheCommitment {
-					value = tr.nodeStore.valueStore.Get(common.AsKey(n.Terminal))
+					value = tr.nodeStore.getValue(common.AsKey(n.Terminal))
 					common.Assertf(len(value) > 0, "can't fetch value. triePath: '%s', data commitment: %s",
 						func() string { return hex.EncodeToString(key) }, n.Terminal)
 				}
@@ -327,12 +390,27 @@ func (tr *TrieReader) iterateNodes(root common.VCommitment, rootKey []byte, fun
 	n, found := tr.nodeStore.FetchNodeData(root)
 	common.Assertf(found, "can't fetch node. triePath: '%s', node commitment: %s", func() string { return hex.EncodeToString(rootKey) }, root)
 
-	if !fun(rootKey, n) {
+	return tr.iterateNodesFrom(n, rootKey, fun)
+}
+
+// iterateNodesFrom iterates the fetched node and its subtree. If the store supports batched reads,
+// all children of the node are fetched in one round trip
+func (tr *TrieReader) iterateNodesFrom(n *common.NodeData, nodeKey []byte, fun func(nodeKey []byte, n *common.NodeData) bool) bool {
+	if !fun(nodeKey, n) {
 		return false
 	}
-	return n.IterateChildren(func(childIndex byte, childCommitment common.VCommitment) bool {
-		return tr.iterateNodes(childCommitment, common.Concat(rootKey, n.PathFragment, childIndex), fun)
-	})
+	if !tr.nodeStore.batchedReads {
+		return n.IterateChildren(func(childIndex byte, childCommitment common.VCommitment) bool {
+			return tr.iterateNodes(childCommitment, common.Concat(nodeKey, n.PathFragment, childIndex), fun)
+		})
+	}
+	indices, children := tr.nodeStore.FetchChildren(n)
+	for i, child := range children {
+		if !tr.iterateNodesFrom(child, common.Concat(nodeKey, n.PathFragment, indices[i]), fun) {
+			return false
+		}
+	}
+	return true
 }
 
 // deletePrefix deletes all k/v pairs from the trie with the specified prefix
@@ -359,11 +437,11 @@ func (tr *TrieUpdatable) deletePrefix(pathPrefix []byte) bool {
 	lastNode.setValue(nil, tr.Model())
 	for i := 0; i < 256; i++ {
 		if _, isModified := lastNode.uncommittedChildren[byte(i)]; isModified {
-			lastNode.uncommittedChildren[byte(i)] = nil
+			lastNode.removeChild(nil, byte(i))
 			continue
 		}
 		if _, wasCommitted := lastNode.nodeData.ChildCommitments[byte(i)]; wasCommitted {
-			lastNode.uncommittedChildren[byte(i)] = nil
+			lastNode.removeChild(nil, byte(i))
 		}
 	}
 	for i := len(nodes) - 1; i >= 1; i-- {
@@ -435,6 +513,8 @@ func (tr *TrieUpdatable) DeleteStr(key interface{}) {
 // TODO optimization of mass prefix update. Needed for UTXO ledger state updates
 func (tr *TrieUpdatable) AddWithPrefix(prefix []byte, suffixValues map[string][]byte) error {
 	common.Assertf(!common.IsNil(tr.persistentRoot), "AddWithPrefix:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "AddWithPrefix:: commit of the trie is prepared")
+	common.Assertf(!tr.secureKeys, "AddWithPrefix:: not supported in the secure trie")
 	if len(suffixValues) == 0 {
 		tr.DeletePrefix(prefix)
 		return nil
@@ -0,0 +1,85 @@
+package immutable
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// The latest committed root with its sequence number is stored under the reserved key in the PartitionOther
+// of the trie store, in the same batch as the commit of the trie. At startup the application recovers the
+// root with ReadLatestRoot instead of keeping its own bookkeeping of roots.
+// The record is: 8 bytes (big-endian) of the sequence number followed by the bytes of the root
+
+// latestRootKey is the key of the latest root record
+var latestRootKey = []byte{PartitionOther, 'l', 'a', 't', 'e', 's', 't'}
+
+// LatestRoot is the latest committed root with the sequence number of the commit
+type LatestRoot struct {
+	Root common.VCommitment
+	Seq  uint64
+}
+
+func (lr *LatestRoot) Bytes() []byte {
+	ret := make([]byte, 8, 8+len(lr.Root.Bytes()))
+	binary.BigEndian.PutUint64(ret, lr.Seq)
+	return append(ret, lr.Root.Bytes()...)
+}
+
+func (lr *LatestRoot) String() string {
+	return fmt.Sprintf("#%d %s", lr.Seq, lr.Root)
+}
+
+// WriteLatestRoot writes the latest root record. Normally the writer is the batch the trie is committed to
+func WriteLatestRoot(w common.KVWriter, root common.VCommitment, seq uint64) {
+	w.Set(latestRootKey, (&LatestRoot{Root: root, Seq: seq}).Bytes())
+}
+
+// ReadLatestRoot reads the latest root record. Returns nil if the record does not exist
+func ReadLatestRoot(m common.CommitmentModel, store common.KVReader) (*LatestRoot, error) {
+	data := store.Get(latestRootKey)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("ReadLatestRoot: wrong data length %d", len(data))
+	}
+	root, err := common.VectorCommitmentFromBytes(m, data[8:])
+	if err != nil {
+		return nil, fmt.Errorf("ReadLatestRoot: %v", err)
+	}
+	return &LatestRoot{
+		Root: root,
+		Seq:  binary.BigEndian.Uint64(data[:8]),
+	}, nil
+}
+
+// CommitLatestRoot commits the trie with CommitAndContinue together with the latest root record, which sequence
+// number is the one of the previous record plus 1 (1 for the first record). If the store is common.BatchedUpdatable,
+// the commit and the record are written in one batch, so the record always points to the fully written root.
+// The trie must have been created on the same store. If the batch can't be committed, the trie must be discarded
+func CommitLatestRoot(tr *TrieUpdatable, store common.KVStore) (*LatestRoot, error) {
+	prev, err := ReadLatestRoot(tr.Model(), store)
+	if err != nil {
+		return nil, err
+	}
+	ret := &LatestRoot{Seq: 1}
+	if prev != nil {
+		ret.Seq = prev.Seq + 1
+	}
+	var w common.KVWriter = store
+	var batch common.KVBatchedWriter
+	if b, ok := store.(common.BatchedUpdatable); ok {
+		batch = b.BatchedWriter()
+		w = batch
+	}
+	ret.Root = tr.CommitAndContinue(w)
+	WriteLatestRoot(w, ret.Root, ret.Seq)
+	if batch != nil {
+		if err = batch.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
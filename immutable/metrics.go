@@ -0,0 +1,33 @@
+package immutable
+
+import (
+	"time"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// SetMetrics sets the sink of metrics of the trie: node and value gets, node cache hits and, for the
+// updatable trie, commit duration and number of nodes written. nil disables metrics
+func (tr *TrieReader) SetMetrics(m common.Metrics) {
+	if m == nil {
+		m = common.NoMetrics{}
+	}
+	tr.nodeStore.metrics = m
+}
+
+func (tr *TrieUpdatable) observeCommitDuration(start time.Time) {
+	tr.nodeStore.metrics.Observe(common.MetricCommitDuration, time.Since(start).Seconds())
+}
+
+// nodeCountingWriter counts nodes written to the trie partition
+type nodeCountingWriter struct {
+	w     common.KVWriter
+	count uint64
+}
+
+func (w *nodeCountingWriter) Set(key, value []byte) {
+	if len(value) > 0 {
+		w.count++
+	}
+	w.w.Set(key, value)
+}
@@ -0,0 +1,203 @@
+package immutable
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Migration of the trie from one commitment model (or path arity, or hash size) to another.
+// All key/value pairs committed in the source root are streamed into the trie under the destination model
+// and committed in batches. After each batch the progress record is written into the PartitionOther
+// of the destination store, together with the batch when the store is common.BatchedUpdatable.
+// If the migration is interrupted, next call to Migrate with the same source root and the same destination
+// store continues from the last committed batch. The progress record is deleted when migration is completed
+
+var (
+	ErrMigrationWrongBatchSize   = errors.New("migration batch size must be positive")
+	ErrMigrationSourceMismatch   = errors.New("migration in progress in the destination store is from another source root")
+	ErrMigrationResumeMismatch   = errors.New("can't resume migration: source keys do not match the progress record")
+	ErrMigrationNoSourceIdentity = errors.New("source trie has no identity value in the root")
+)
+
+// migrationProgressKey is the key of the progress record in the destination store
+var migrationProgressKey = []byte{PartitionOther, 'm', 'i', 'g', 'r', 'a', 't', 'e'}
+
+// MigrationProgress is the state of the migration after the last committed batch
+type MigrationProgress struct {
+	// SourceRoot is the root being migrated
+	SourceRoot common.VCommitment
+	// Root is the root in the destination store, committed with the last batch
+	Root common.VCommitment
+	// Keys is number of keys migrated so far, in the order of the source trie iteration
+	Keys uint32
+	// LastKey is the last key migrated
+	LastKey []byte
+}
+
+func (p *MigrationProgress) Bytes() []byte {
+	var buf bytes.Buffer
+	common.AssertNoError(common.WriteBytes8(&buf, common.AsKey(p.SourceRoot)))
+	common.AssertNoError(common.WriteBytes8(&buf, common.AsKey(p.Root)))
+	common.AssertNoError(common.WriteUint32(&buf, p.Keys))
+	common.AssertNoError(common.WriteBytes16(&buf, p.LastKey))
+	return buf.Bytes()
+}
+
+func migrationProgressFromBytes(srcModel, dstModel common.CommitmentModel, data []byte) (*MigrationProgress, error) {
+	rdr := bytes.NewReader(data)
+	srcRootBin, err := common.ReadBytes8(rdr)
+	if err != nil {
+		return nil, err
+	}
+	dstRootBin, err := common.ReadBytes8(rdr)
+	if err != nil {
+		return nil, err
+	}
+	ret := &MigrationProgress{}
+	if err = common.ReadUint32(rdr, &ret.Keys); err != nil {
+		return nil, err
+	}
+	if ret.LastKey, err = common.ReadBytes16(rdr); err != nil {
+		return nil, err
+	}
+	if rdr.Len() != 0 {
+		return nil, fmt.Errorf("migrationProgressFromBytes: %d unexpected bytes", rdr.Len())
+	}
+	if ret.SourceRoot, err = common.VectorCommitmentFromBytes(srcModel, srcRootBin); err != nil {
+		return nil, err
+	}
+	if ret.Root, err = common.VectorCommitmentFromBytes(dstModel, dstRootBin); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// MigrationOptions optional parameters of Migrate
+type MigrationOptions struct {
+	// OnProgress, if not nil, is called after each committed batch
+	OnProgress func(p *MigrationProgress)
+}
+
+// Migrate rebuilds the trie, committed in the root of the source reader, under the destination commitment model
+// in the destination store. Returns the root of the migrated trie in the destination store.
+// The trie is committed every batchSize keys. If the destination store contains progress record of the interrupted
+// migration of the same source root, the migration continues from the last committed batch
+func Migrate(src *TrieReader, dstStore common.KVStore, dstModel common.CommitmentModel, batchSize int, opts ...MigrationOptions) (common.VCommitment, error) {
+	if batchSize <= 0 {
+		return nil, ErrMigrationWrongBatchSize
+	}
+	var opt MigrationOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	progress, err := ReadMigrationProgress(src.Model(), dstModel, dstStore)
+	if err != nil {
+		return nil, err
+	}
+	if progress != nil {
+		if !src.Model().EqualCommitments(progress.SourceRoot, src.Root()) {
+			return nil, ErrMigrationSourceMismatch
+		}
+	} else {
+		// the identity is the value of the empty key, the first one in the iteration
+		var identity []byte
+		src.Iterate(func(k []byte, v []byte) bool {
+			if len(k) == 0 {
+				identity = v
+			}
+			return false
+		})
+		if len(identity) == 0 {
+			return nil, ErrMigrationNoSourceIdentity
+		}
+		progress = &MigrationProgress{
+			SourceRoot: src.Root().Clone(),
+			Root:       MustInitRoot(dstStore, dstModel, identity),
+		}
+	}
+
+	var ret common.VCommitment
+	err = common.CatchPanicOrError(func() error {
+		ret, err = migrate(src, dstStore, dstModel, batchSize, progress, opt.OnProgress)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ReadMigrationProgress reads the progress record of the interrupted migration from the destination store.
+// Returns nil if there's no migration in progress
+func ReadMigrationProgress(srcModel, dstModel common.CommitmentModel, dstStore common.KVReader) (*MigrationProgress, error) {
+	data := dstStore.Get(migrationProgressKey)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return migrationProgressFromBytes(srcModel, dstModel, data)
+}
+
+func migrate(src *TrieReader, dstStore common.KVStore, dstModel common.CommitmentModel, batchSize int, progress *MigrationProgress, onProgress func(p *MigrationProgress)) (common.VCommitment, error) {
+	dst, err := NewTrieUpdatable(dstModel, dstStore, progress.Root)
+	if err != nil {
+		return nil, err
+	}
+	commitBatch := func(last bool) {
+		var w common.KVWriter = dstStore
+		var batch common.KVBatchedWriter
+		if b, ok := dstStore.(common.BatchedUpdatable); ok {
+			batch = b.BatchedWriter()
+			w = batch
+		}
+		progress.Root = dst.CommitAndContinue(w)
+		if last {
+			w.Set(migrationProgressKey, nil)
+		} else {
+			w.Set(migrationProgressKey, progress.Bytes())
+		}
+		if batch != nil {
+			common.AssertNoError(batch.Commit())
+		}
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+
+	// keys migrated before the interruption are skipped. The order of iteration is deterministic
+	skip := progress.Keys
+	inBatch := 0
+	src.Iterate(func(k []byte, v []byte) bool {
+		if len(k) == 0 {
+			// identity of the root is already in the destination
+			return true
+		}
+		if skip > 0 {
+			skip--
+			if skip == 0 && !bytes.Equal(k, progress.LastKey) {
+				err = ErrMigrationResumeMismatch
+				return false
+			}
+			return true
+		}
+		dst.Update(k, v)
+		progress.Keys++
+		progress.LastKey = k
+		inBatch++
+		if inBatch >= batchSize {
+			commitBatch(false)
+			inBatch = 0
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if skip > 0 {
+		return nil, ErrMigrationResumeMismatch
+	}
+	commitBatch(true)
+	return progress.Root, nil
+}
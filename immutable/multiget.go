@@ -0,0 +1,118 @@
+package immutable
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// GetMany reads values of many keys. Returns slice of the same length as keys, nil means absence of the key.
+// Paths of all keys are traversed together level by level: nodes shared by paths are fetched only once and
+// all nodes of the same level, as well as all values, are fetched in one round trip if the store
+// implements common.KVBatchedReader
+func (tr *TrieReader) GetMany(keys [][]byte) [][]byte {
+	terminals := tr.terminalsMany(keys)
+	ret := make([][]byte, len(keys))
+	valueKeys := make([][]byte, 0)
+	indices := make([]int, 0)
+	for i, terminal := range terminals {
+		if common.IsNil(terminal) {
+			continue
+		}
+		if value, inTheCommitment := common.ExtractValue(terminal); inTheCommitment {
+			ret[i] = value
+			continue
+		}
+		valueKeys = append(valueKeys, common.AsKey(terminal))
+		indices = append(indices, i)
+	}
+	tr.nodeStore.metrics.AddCounter(common.MetricValueGets, uint64(len(valueKeys)))
+	for i, value := range common.GetMany(tr.nodeStore.valueStore, valueKeys) {
+		if len(value) == 0 {
+			// compressed or in generations
+			value = tr.nodeStore.getValue(valueKeys[i])
+		}
+		common.Assertf(len(value) > 0, "value in the value store must be not nil. Key: '%s'",
+			func() string { return hex.EncodeToString(keys[indices[i]]) })
+		ret[indices[i]] = value
+	}
+	return ret
+}
+
+// HasMany checks existence of many keys. Values are not read. See GetMany
+func (tr *TrieReader) HasMany(keys [][]byte) []bool {
+	ret := make([]bool, len(keys))
+	for i, terminal := range tr.terminalsMany(keys) {
+		ret[i] = !common.IsNil(terminal)
+	}
+	return ret
+}
+
+// multiGetCursor is a position of one key in the level-by-level traversal
+type multiGetCursor struct {
+	triePath []byte
+	trieKey  []byte
+	n        *common.NodeData
+}
+
+// terminalsMany returns terminal commitments of keys, nil for absent keys
+func (tr *TrieReader) terminalsMany(keys [][]byte) []common.TCommitment {
+	ret := make([]common.TCommitment, len(keys))
+	rootNode, found := tr.nodeStore.FetchNodeData(tr.persistentRoot)
+	if !found {
+		return ret
+	}
+	active := make(map[int]*multiGetCursor)
+	for i, k := range keys {
+		active[i] = &multiGetCursor{
+			triePath: common.UnpackBytes(tr.trieKey(k), tr.PathArity()),
+			n:        rootNode,
+		}
+	}
+	for len(active) > 0 {
+		// commitments of the next level, deduplicated
+		next := make([]common.VCommitment, 0)
+		nextIdx := make(map[string]int)
+		waiting := make(map[int]int)
+		for i, c := range active {
+			keyPlusPathFragment := common.Concat(c.trieKey, c.n.PathFragment)
+			if len(c.triePath) <= len(keyPlusPathFragment) {
+				if bytes.Equal(keyPlusPathFragment, c.triePath) && !common.IsNil(c.n.Terminal) {
+					ret[i] = c.n.Terminal
+				}
+				delete(active, i)
+				continue
+			}
+			if !bytes.HasPrefix(c.triePath, keyPlusPathFragment) {
+				delete(active, i)
+				continue
+			}
+			childIndex := c.triePath[len(keyPlusPathFragment)]
+			childCommitment, ok := c.n.ChildCommitments[childIndex]
+			if !ok {
+				delete(active, i)
+				continue
+			}
+			c.trieKey = common.Concat(keyPlusPathFragment, childIndex)
+			dbKey := string(common.AsKey(childCommitment))
+			idx, already := nextIdx[dbKey]
+			if !already {
+				idx = len(next)
+				nextIdx[dbKey] = idx
+				next = append(next, childCommitment)
+			}
+			waiting[i] = idx
+		}
+		if len(next) == 0 {
+			break
+		}
+		nodes := tr.nodeStore.fetchNodesMany(next)
+		for i, idx := range waiting {
+			common.Assertf(nodes[idx] != nil, "TrieReader::GetMany: failed to fetch node. trieKey: '%s'",
+				func() string { return hex.EncodeToString(active[i].trieKey) })
+			active[i].n = nodes[idx]
+		}
+	}
+	return ret
+}
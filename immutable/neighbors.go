@@ -0,0 +1,117 @@
+package immutable
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Neighbors returns the greatest key committed in the trie which is less than the key and the smallest key
+// which is greater than the key, in the lexicographic order of keys. Nil means there is no such key.
+// The key itself may or may not be committed in the trie. The identity of the state is the smallest key:
+// it is returned as the empty, not nil, left neighbor.
+// Neighbors prove absence of the key in commitment schemes like ICS-23, where the absence is proven by
+// the proofs of two adjacent keys
+func (tr *TrieReader) Neighbors(key []byte) (left, right []byte) {
+	common.Assertf(!tr.secureKeys, "Neighbors:: not supported in the secure trie")
+	unpackedKey := common.UnpackBytes(key, tr.PathArity())
+	var leftPath, rightPath []byte
+	var hasLeft, hasRight bool
+	n, found := tr.nodeStore.FetchNodeData(tr.persistentRoot)
+	var trieKey []byte
+	for found {
+		keyPlusPathFragment := common.Concat(trieKey, n.PathFragment)
+		prefix, _, _ := commonPrefix(keyPlusPathFragment, unpackedKey)
+		if len(prefix) < len(keyPlusPathFragment) {
+			// the key diverges from the path of the node: all keys of the subtree are either greater or less than the key
+			if len(prefix) == len(unpackedKey) || unpackedKey[len(prefix)] < keyPlusPathFragment[len(prefix)] {
+				rightPath, hasRight = tr.minKeyOfSubtree(n, trieKey), true
+			} else {
+				leftPath, hasLeft = tr.maxKeyOfSubtree(n, trieKey), true
+			}
+			break
+		}
+		isLast := len(keyPlusPathFragment) == len(unpackedKey)
+		var nextChildIdx byte
+		if !isLast {
+			nextChildIdx = unpackedKey[len(keyPlusPathFragment)]
+			if !common.IsNil(n.Terminal) {
+				leftPath, hasLeft = keyPlusPathFragment, true
+			}
+		}
+		// deeper neighbors are closer to the key than those found on upper levels
+		leftChildIdx, rightChildIdx := -1, -1
+		n.IterateChildren(func(i byte, _ common.VCommitment) bool {
+			switch {
+			case !isLast && i < nextChildIdx:
+				leftChildIdx = int(i)
+			case isLast || i > nextChildIdx:
+				rightChildIdx = int(i)
+				return false
+			}
+			return true
+		})
+		if leftChildIdx >= 0 {
+			leftPath, hasLeft = tr.maxKeyOfSubtree(tr.nodeStore.FetchChild(n, byte(leftChildIdx), trieKey)), true
+		}
+		if rightChildIdx >= 0 {
+			rightPath, hasRight = tr.minKeyOfSubtree(tr.nodeStore.FetchChild(n, byte(rightChildIdx), trieKey)), true
+		}
+		if isLast {
+			break
+		}
+		n, trieKey = tr.nodeStore.FetchChild(n, nextChildIdx, trieKey)
+		found = n != nil
+	}
+	if hasLeft {
+		left = tr.packNeighbor(leftPath)
+	}
+	if hasRight {
+		right = tr.packNeighbor(rightPath)
+	}
+	return left, right
+}
+
+// minKeyOfSubtree returns the smallest unpacked key committed in the subtree of the node
+func (tr *TrieReader) minKeyOfSubtree(n *common.NodeData, trieKey []byte) []byte {
+	for {
+		if !common.IsNil(n.Terminal) {
+			return common.Concat(trieKey, n.PathFragment)
+		}
+		var child *common.NodeData
+		var childKey []byte
+		n.IterateChildren(func(i byte, _ common.VCommitment) bool {
+			child, childKey = tr.nodeStore.FetchChild(n, i, trieKey)
+			return false
+		})
+		common.Assertf(child != nil, "minKeyOfSubtree: node without terminal and children")
+		n, trieKey = child, childKey
+	}
+}
+
+// maxKeyOfSubtree returns the greatest unpacked key committed in the subtree of the node
+func (tr *TrieReader) maxKeyOfSubtree(n *common.NodeData, trieKey []byte) []byte {
+	for {
+		var child *common.NodeData
+		var childKey []byte
+		for i := tr.PathArity().NumChildren() - 1; i >= 0; i-- {
+			if _, ok := n.ChildCommitments[byte(i)]; ok {
+				child, childKey = tr.nodeStore.FetchChild(n, byte(i), trieKey)
+				break
+			}
+		}
+		if child == nil {
+			common.Assertf(!common.IsNil(n.Terminal), "maxKeyOfSubtree: node without terminal and children")
+			return common.Concat(trieKey, n.PathFragment)
+		}
+		n, trieKey = child, childKey
+	}
+}
+
+// packNeighbor packs the unpacked key. The identity is packed into the empty, not nil, key
+func (tr *TrieReader) packNeighbor(unpackedKey []byte) []byte {
+	ret, err := common.PackUnpackedBytes(unpackedKey, tr.PathArity())
+	common.AssertNoError(err)
+	if ret == nil {
+		return []byte{}
+	}
+	return ret
+}
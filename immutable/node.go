@@ -14,8 +14,10 @@ type bufferedNode struct {
 	value               []byte // will be persisted in value store if not nil
 	terminal            common.TCommitment
 	pathFragment        []byte
-	uncommittedChildren map[byte]*bufferedNode // children which has been modified
+	uncommittedChildren map[byte]*bufferedNode // children which has been modified. Allocated on first modification
 	triePath            []byte
+	// arena of the children. Nil if nodes are allocated on the heap
+	arena *nodeArena
 }
 
 func newBufferedNode(n *common.NodeData, triePath []byte) *bufferedNode {
@@ -23,25 +25,25 @@ func newBufferedNode(n *common.NodeData, triePath []byte) *bufferedNode {
 		n = common.NewNodeData()
 	}
 	ret := &bufferedNode{
-		nodeData:            n,
-		terminal:            n.Terminal,
-		pathFragment:        n.PathFragment,
-		uncommittedChildren: make(map[byte]*bufferedNode),
-		triePath:            triePath,
+		nodeData:     n,
+		terminal:     n.Terminal,
+		pathFragment: n.PathFragment,
+		triePath:     triePath,
 	}
 	return ret
 }
 
 // commitNode re-calculates node commitment and, recursively, its children commitments
 // Normally, the commitNode is called on the root, then
-func (n *bufferedNode) commitNode(triePartition, valuePartition common.KVWriter, m common.CommitmentModel) {
+// If refs is not nil, references to the values from the persisted nodes are counted
+func (n *bufferedNode) commitNode(triePartition, valuePartition common.KVWriter, m common.CommitmentModel, refs *valueRefCounts) {
 	childUpdates := make(map[byte]common.VCommitment)
 	// looping in non-deterministic order but that must not matter
 	for idx, child := range n.uncommittedChildren {
 		if child == nil {
 			childUpdates[idx] = nil
 		} else {
-			child.commitNode(triePartition, valuePartition, m)
+			child.commitNode(triePartition, valuePartition, m, refs)
 			childUpdates[idx] = child.nodeData.Commitment
 		}
 	}
@@ -52,6 +54,7 @@ func (n *bufferedNode) commitNode(triePartition, valuePartition common.KVWriter,
 	m.UpdateNodeCommitment(n.nodeData, childUpdates, n.terminal, n.pathFragment, n.triePath, !common.IsNil(n.nodeData.Commitment))
 
 	if !m.EqualCommitments(cSave, n.nodeData.Commitment) {
+		refs.nodePersisted(n.nodeData)
 		n.mustPersist(triePartition, m)
 	}
 	if len(n.value) > 0 {
@@ -103,7 +106,7 @@ func (n *bufferedNode) setModifiedChild(child *bufferedNode, idx ...byte) {
 		common.Assertf(len(idx) > 0, "setModifiedChild: index of the child must be specified if the child is nil")
 		index = idx[0]
 	}
-	n.uncommittedChildren[index] = child
+	n.modifiedChildren()[index] = child
 }
 
 func (n *bufferedNode) removeChild(child *bufferedNode, idx ...byte) {
@@ -114,14 +117,21 @@ func (n *bufferedNode) removeChild(child *bufferedNode, idx ...byte) {
 	} else {
 		index = child.indexAsChild()
 	}
-	n.uncommittedChildren[index] = nil
+	n.modifiedChildren()[index] = nil
+}
+
+func (n *bufferedNode) modifiedChildren() map[byte]*bufferedNode {
+	if n.uncommittedChildren == nil {
+		n.uncommittedChildren = make(map[byte]*bufferedNode)
+	}
+	return n.uncommittedChildren
 }
 
 func (n *bufferedNode) setPathFragment(pf []byte) {
 	n.pathFragment = pf
 }
 
-func (n *bufferedNode) setValue(value []byte, m common.CommitmentModel) {
+func (n *bufferedNode) setValue(value []byte, m dataCommitter) {
 	if len(value) == 0 {
 		n.terminal = nil
 		n.value = nil
@@ -155,7 +165,7 @@ func (n *bufferedNode) getChild(childIndex byte, db *NodeStore) *bufferedNode {
 	common.Assertf(ok, "TrieUpdatable::getChild: can't fetch node. triePath: '%s', dbKey: '%s",
 		func() string { return hex.EncodeToString(childCommitment.AsKey()) }, func() string { return hex.EncodeToString(childTriePath) })
 
-	return newBufferedNode(nodeFetched, childTriePath)
+	return n.arena.newBufferedNode(nodeFetched, childTriePath)
 }
 
 // node is in the trie if at least one of the two is true:
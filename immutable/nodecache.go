@@ -0,0 +1,121 @@
+package immutable
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// nodeCache is the LRU cache of trie nodes, bounded by number of nodes and/or by the size of the serialized nodes.
+// Nodes are immutable in the store (keyed by commitment), so cached nodes never need invalidation.
+// The node store mutates fetched nodes when committing, so the cache keeps its own copies.
+// The cache is thread-safe: one TrieReader serves concurrent readers
+type nodeCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	lru        *list.List
+	entries    map[string]*list.Element
+}
+
+type nodeCacheEntry struct {
+	key  string
+	n    *common.NodeData
+	size int
+}
+
+// newNodeCache returns nil if both limits are 0, i.e. the cache is not used. Limit 0 means unbounded
+func newNodeCache(maxEntries, maxBytes int) *nodeCache {
+	if maxEntries <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	return &nodeCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *nodeCache) get(key []byte) (*common.NodeData, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[string(key)]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*nodeCacheEntry).n.Clone(), true
+}
+
+// put caches the node. Size is the size of the serialized node
+func (c *nodeCache) put(key []byte, n *common.NodeData, size int) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.entries[string(key)]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	size += len(key)
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+	entry := &nodeCacheEntry{key: string(key), n: n.Clone(), size: size}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.bytes += size
+	for c.overLimit() {
+		c.evictOldest()
+	}
+}
+
+func (c *nodeCache) overLimit() bool {
+	return (c.maxEntries > 0 && c.lru.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+func (c *nodeCache) evictOldest() {
+	e := c.lru.Back()
+	entry := e.Value.(*nodeCacheEntry)
+	c.lru.Remove(e)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *nodeCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+// NodeCacheStats is the state of the node cache
+type NodeCacheStats struct {
+	Nodes int
+	Bytes int
+}
+
+// NodeCacheStats returns number of cached nodes and their size. Zero if cache is not used
+func (tr *TrieReader) NodeCacheStats() NodeCacheStats {
+	c := tr.nodeStore.cache
+	if c == nil {
+		return NodeCacheStats{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return NodeCacheStats{Nodes: c.lru.Len(), Bytes: c.bytes}
+}
@@ -8,19 +8,32 @@ import (
 
 // NodeStore immutable node store
 type NodeStore struct {
-	m                common.CommitmentModel
-	trieStore        common.KVReader
-	valueStore       common.KVReader
-	cache            map[string]*common.NodeData
-	clearCacheAtSize int
+	m             common.CommitmentModel
+	trieStore     common.KVReader
+	valueStore    common.KVReader
+	valueGenStore common.KVReader
+	preimageStore common.KVReader
+	valueRefStore common.KVReader
+	// values compressed on commit. See EnableValueCompression
+	compressedValueStore common.KVReader
+	// nil if nodes are not cached
+	cache   *nodeCache
+	metrics common.Metrics
+	// batchedReads is true if the underlying store reads many keys in one round trip
+	batchedReads bool
 }
 
-const defaultClearCacheEveryGets = 1000
+// DefaultNodeCacheSize default maximum number of nodes in the LRU node cache
+const DefaultNodeCacheSize = 1000
 
 const (
 	PartitionTrieNodes = byte(iota)
 	PartitionValues
 	PartitionOther
+	PartitionValueGenerations
+	PartitionKeyPreimages
+	PartitionValueRefCounts
+	PartitionCompressedValues
 )
 
 // MustInitRoot initializes new empty root with the given identity
@@ -35,41 +48,97 @@ func MustInitRoot(store common.KVWriter, m common.CommitmentModel, identity []by
 
 	trieStore := common.MakeWriterPartition(store, PartitionTrieNodes)
 	valueStore := common.MakeWriterPartition(store, PartitionValues)
-	n.commitNode(trieStore, valueStore, m)
+	n.commitNode(trieStore, valueStore, m, nil)
 
 	return n.nodeData.Commitment.Clone()
 }
 
-func openImmutableNodeStore(store common.KVReader, model common.CommitmentModel, clearCacheAtSize ...int) *NodeStore {
-	ret := &NodeStore{
-		m:                model,
-		trieStore:        common.MakeReaderPartition(store, PartitionTrieNodes),
-		valueStore:       common.MakeReaderPartition(store, PartitionValues),
-		cache:            make(map[string]*common.NodeData),
-		clearCacheAtSize: defaultClearCacheEveryGets,
+// openImmutableNodeStore opens node store with the LRU node cache. Optional cacheSize[0] is maximum number of cached
+// nodes, cacheSize[1] is maximum size of cached nodes in bytes. Limit 0 means unbounded. If both are 0, nodes are
+// not cached. Default is DefaultNodeCacheSize nodes, not bounded by bytes
+func openImmutableNodeStore(store common.KVReader, model common.CommitmentModel, cacheSize ...int) *NodeStore {
+	maxEntries, maxBytes := DefaultNodeCacheSize, 0
+	if len(cacheSize) > 0 {
+		maxEntries = cacheSize[0]
+	}
+	if len(cacheSize) > 1 {
+		maxBytes = cacheSize[1]
 	}
-	if len(clearCacheAtSize) > 0 {
-		ret.clearCacheAtSize = clearCacheAtSize[0]
+	ret := &NodeStore{
+		m:                    model,
+		trieStore:            common.MakeReaderPartition(store, PartitionTrieNodes),
+		valueStore:           common.MakeReaderPartition(store, PartitionValues),
+		valueGenStore:        common.MakeReaderPartition(store, PartitionValueGenerations),
+		preimageStore:        common.MakeReaderPartition(store, PartitionKeyPreimages),
+		valueRefStore:        common.MakeReaderPartition(store, PartitionValueRefCounts),
+		compressedValueStore: common.MakeReaderPartition(store, PartitionCompressedValues),
+		cache:                newNodeCache(maxEntries, maxBytes),
+		metrics:              common.NoMetrics{},
 	}
+	_, ret.batchedReads = store.(common.KVBatchedReader)
 	return ret
 }
 
 func (ns *NodeStore) FetchNodeData(nodeCommitment common.VCommitment) (*common.NodeData, bool) {
 	dbKey := common.AsKey(nodeCommitment)
-	if ns.clearCacheAtSize > 0 {
-		// if caching is used at all
-		if ret, inCache := ns.cache[string(dbKey)]; inCache {
-			return ret, true
-		}
-		if len(ns.cache) > ns.clearCacheAtSize {
-			// GC the whole cache when cache reaches specified size
-			ns.cache = make(map[string]*common.NodeData)
-		}
+	ns.metrics.AddCounter(common.MetricNodeGets, 1)
+	if ret, inCache := ns.cache.get(dbKey); inCache {
+		ns.metrics.AddCounter(common.MetricNodeCacheHits, 1)
+		return ret, true
 	}
 	nodeBin := ns.trieStore.Get(dbKey)
 	if len(nodeBin) == 0 {
 		return nil, false
 	}
+	ret := ns.nodeDataFromBytes(nodeCommitment, nodeBin)
+	ns.cache.put(dbKey, ret, len(nodeBin))
+	return ret, true
+}
+
+// FetchChildren fetches all children of the node in one round trip to the store, if the store supports it.
+// Returns child indices and children in the order of indices
+func (ns *NodeStore) FetchChildren(n *common.NodeData) ([]byte, []*common.NodeData) {
+	indices := make([]byte, 0)
+	commitments := make([]common.VCommitment, 0)
+	n.IterateChildren(func(i byte, c common.VCommitment) bool {
+		indices = append(indices, i)
+		commitments = append(commitments, c)
+		return true
+	})
+	children := ns.fetchNodesMany(commitments)
+	for i, child := range children {
+		common.Assertf(child != nil, "can't fetch child node %d, node commitment: %s", indices[i], commitments[i])
+	}
+	return indices, children
+}
+
+// fetchNodesMany fetches many nodes in one round trip to the store, if the store supports it.
+// Returns nil for absent nodes
+func (ns *NodeStore) fetchNodesMany(nodeCommitments []common.VCommitment) []*common.NodeData {
+	ns.metrics.AddCounter(common.MetricNodeGets, uint64(len(nodeCommitments)))
+	ret := make([]*common.NodeData, len(nodeCommitments))
+	keys := make([][]byte, 0, len(nodeCommitments))
+	indices := make([]int, 0, len(nodeCommitments))
+	for i, c := range nodeCommitments {
+		dbKey := common.AsKey(c)
+		if n, inCache := ns.cache.get(dbKey); inCache {
+			ns.metrics.AddCounter(common.MetricNodeCacheHits, 1)
+			ret[i] = n
+			continue
+		}
+		keys = append(keys, dbKey)
+		indices = append(indices, i)
+	}
+	for i, nodeBin := range common.GetMany(ns.trieStore, keys) {
+		if len(nodeBin) > 0 {
+			ret[indices[i]] = ns.nodeDataFromBytes(nodeCommitments[indices[i]], nodeBin)
+			ns.cache.put(keys[i], ret[indices[i]], len(nodeBin))
+		}
+	}
+	return ret
+}
+
+func (ns *NodeStore) nodeDataFromBytes(nodeCommitment common.VCommitment, nodeBin []byte) *common.NodeData {
 	noValueStore := func(_ []byte) ([]byte, error) {
 		panic("internal inconsistency: all terminal commitments must be stored in the trie node")
 	}
@@ -77,7 +146,7 @@ func (ns *NodeStore) FetchNodeData(nodeCommitment common.VCommitment) (*common.N
 	common.Assertf(err == nil, "NodeStore::FetchNodeData err: '%v' nodeBin: '%s', commitment: %s, arity: %s",
 		err, func() string { return hex.EncodeToString(nodeBin) }, nodeCommitment, ns.m.PathArity())
 	ret.Commitment = nodeCommitment
-	return ret, true
+	return ret
 }
 
 func (ns *NodeStore) MustFetchNodeData(nodeCommitment common.VCommitment) *common.NodeData {
@@ -101,5 +170,5 @@ func (ns *NodeStore) FetchChild(n *common.NodeData, childIdx byte, trieKey []byt
 }
 
 func (ns *NodeStore) clearCache() {
-	ns.cache = make(map[string]*common.NodeData)
+	ns.cache.clear()
 }
@@ -0,0 +1,187 @@
+package immutable
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// OrphanReport classifies the nodes of the trie node partition into reachable from the set of roots and
+// orphaned, i.e. not reachable from any of the roots. Nodes become orphaned when the roots referencing them
+// are abandoned, for example after the fork is discarded or after the old versions are dropped.
+// The report also contains nodes which are reachable from the roots but are missing in the store
+type OrphanReport struct {
+	// NumNodes is the number of nodes in the trie node partition
+	NumNodes int
+	// NumReachable is the number of nodes in the partition reachable from the roots
+	NumReachable int
+	// Orphans are keys of the orphaned nodes in the trie node partition, in the order of the store iterator
+	Orphans [][]byte
+	// Missing are commitments of the nodes which are reachable from the roots but are not in the store
+	Missing []common.VCommitment
+}
+
+// ScanOrphans walks all tries committed in the roots and scans the trie node partition of the store.
+// Keys of all reachable nodes are kept in memory during the scan
+func ScanOrphans(store common.KVTraversableReader, m common.CommitmentModel, roots ...common.VCommitment) (*OrphanReport, error) {
+	trieStore := common.MakeReaderPartition(store, PartitionTrieNodes)
+	ret := &OrphanReport{
+		Orphans: make([][]byte, 0),
+		Missing: make([]common.VCommitment, 0),
+	}
+	reachable := make(map[string]struct{})
+	missing := make(map[string]struct{})
+	stack := make([]common.VCommitment, 0, len(roots))
+	for _, root := range roots {
+		stack = append(stack, root)
+	}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		key := common.AsKey(c)
+		if _, already := reachable[string(key)]; already {
+			continue
+		}
+		if _, already := missing[string(key)]; already {
+			continue
+		}
+		nodeBin := trieStore.Get(key)
+		if len(nodeBin) == 0 {
+			missing[string(key)] = struct{}{}
+			ret.Missing = append(ret.Missing, c)
+			continue
+		}
+		reachable[string(key)] = struct{}{}
+		n, err := common.NodeDataFromBytes(m, nodeBin, m.PathArity(), func(_ []byte) ([]byte, error) {
+			return nil, errors.New("terminal commitment must be stored in the trie node")
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ScanOrphans: can't parse node %s: %v", c, err)
+		}
+		n.IterateChildren(func(_ byte, child common.VCommitment) bool {
+			stack = append(stack, child)
+			return true
+		})
+	}
+	ret.NumReachable = len(reachable)
+
+	store.Iterator([]byte{PartitionTrieNodes}).IterateKeys(func(k []byte) bool {
+		ret.NumNodes++
+		if _, isReachable := reachable[string(k[1:])]; !isReachable {
+			ret.Orphans = append(ret.Orphans, common.Concat(k[1:]))
+		}
+		return true
+	})
+	return ret, nil
+}
+
+// RepairPlan returns mutations which delete all orphaned nodes from the store. Missing nodes can't be repaired
+// from the store itself, they must be restored from the snapshot or from another replica
+func (r *OrphanReport) RepairPlan() *common.Mutations {
+	ret := common.NewMutations()
+	for _, k := range r.Orphans {
+		ret.Set(common.Concat(PartitionTrieNodes, k), nil)
+	}
+	return ret
+}
+
+// Write writes the human-readable report: the summary line, one line 'delete <key>' for each orphaned node and
+// one line 'missing <commitment>' for each missing node
+func (r *OrphanReport) Write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "nodes: %d, reachable: %d, orphaned: %d, missing: %d\n",
+		r.NumNodes, r.NumReachable, len(r.Orphans), len(r.Missing)); err != nil {
+		return err
+	}
+	for _, k := range r.Orphans {
+		if _, err := fmt.Fprintf(w, "delete %s\n", hex.EncodeToString(k)); err != nil {
+			return err
+		}
+	}
+	for _, c := range r.Missing {
+		if _, err := fmt.Fprintf(w, "missing %s\n", c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrunePlan returns mutations which delete the nodes of the trie committed in the root together with the values stored
+// outside the nodes, except those which are reachable from any of the retained roots. It is used to drop the root
+// when the retained roots are all the roots which must remain readable. Nodes missing in the store are skipped.
+// Keys of all nodes and values reachable from the retained roots are kept in memory
+func PrunePlan(store common.KVReader, m common.CommitmentModel, root common.VCommitment, retained ...common.VCommitment) (*common.Mutations, error) {
+	trieStore := common.MakeReaderPartition(store, PartitionTrieNodes)
+	retainedNodes := make(map[string]struct{})
+	retainedValues := make(map[string]struct{})
+	err := walkStoredNodes(trieStore, m, retained, retainedNodes, nil, func(_ []byte, n *common.NodeData) {
+		if key, ok := valueKeyOutsideNode(n); ok {
+			retainedValues[string(key)] = struct{}{}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	ret := common.NewMutations()
+	err = walkStoredNodes(trieStore, m, []common.VCommitment{root}, make(map[string]struct{}), retainedNodes, func(nodeKey []byte, n *common.NodeData) {
+		ret.Set(common.Concat(PartitionTrieNodes, nodeKey), nil)
+		if key, ok := valueKeyOutsideNode(n); ok {
+			if _, isRetained := retainedValues[string(key)]; !isRetained {
+				ret.Set(common.Concat(PartitionValues, key), nil)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// walkStoredNodes visits each node reachable from the roots once, skipping subtrees of the nodes in the skip set.
+// Keys of visited nodes are added to the visited set
+func walkStoredNodes(trieStore common.KVReader, m common.CommitmentModel, roots []common.VCommitment, visited, skip map[string]struct{}, fun func(nodeKey []byte, n *common.NodeData)) error {
+	stack := make([]common.VCommitment, 0, len(roots))
+	stack = append(stack, roots...)
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		key := common.AsKey(c)
+		if _, already := visited[string(key)]; already {
+			continue
+		}
+		if _, skipped := skip[string(key)]; skipped {
+			continue
+		}
+		nodeBin := trieStore.Get(key)
+		if len(nodeBin) == 0 {
+			continue
+		}
+		visited[string(key)] = struct{}{}
+		n, err := common.NodeDataFromBytes(m, nodeBin, m.PathArity(), func(_ []byte) ([]byte, error) {
+			return nil, errors.New("terminal commitment must be stored in the trie node")
+		})
+		if err != nil {
+			return fmt.Errorf("can't parse node %s: %v", c, err)
+		}
+		fun(key, n)
+		n.IterateChildren(func(_ byte, child common.VCommitment) bool {
+			stack = append(stack, child)
+			return true
+		})
+	}
+	return nil
+}
+
+func valueKeyOutsideNode(n *common.NodeData) ([]byte, bool) {
+	if common.IsNil(n.Terminal) {
+		return nil, false
+	}
+	if _, inTheCommitment := n.Terminal.ExtractValue(); inTheCommitment {
+		return nil, false
+	}
+	return common.AsKey(n.Terminal), true
+}
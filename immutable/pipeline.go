@@ -0,0 +1,180 @@
+package immutable
+
+import (
+	"sync"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+type (
+	// PipelinedTrie is the updatable trie which commits in the background. Commit hands the batch of updates over
+	// to the background goroutine, which applies it to the trie, calculates commitments and writes the nodes into
+	// the store, while the caller begins accumulating the next batch immediately. Batches are committed
+	// in the order of Commit calls, each on top of the previous one.
+	// Get and Has see the current batch and batches which are being committed, so the next batch is, logically,
+	// accumulated on top of the fork of the trie at the uncommitted root.
+	// If the commit of the batch fails (panics), all subsequent commits fail with the same error and the
+	// PipelinedTrie must be discarded.
+	// The PipelinedTrie is not thread-safe: it is intended to be used by one ingest loop
+	PipelinedTrie struct {
+		tr      *TrieUpdatable
+		store   common.KVWriter
+		current *common.Mutations
+
+		mutex     sync.RWMutex
+		committed *TrieReader
+		// batches being committed, in the order of Commit calls
+		inFlight []*PipelinedCommit
+	}
+
+	// PipelinedCommit is the handle of the batch committed in the background
+	PipelinedCommit struct {
+		batch *common.Mutations
+		done  chan struct{}
+		root  common.VCommitment
+		err   error
+	}
+)
+
+// NewPipelinedTrie creates the pipelined trie at the root. The store must be thread-safe:
+// it is written by the background commits while the trie is read
+func NewPipelinedTrie(m common.CommitmentModel, store common.KVStore, root common.VCommitment, cacheSize ...int) (*PipelinedTrie, error) {
+	tr, err := NewTrieUpdatable(m, store, root, cacheSize...)
+	if err != nil {
+		return nil, err
+	}
+	return &PipelinedTrie{
+		tr:        tr,
+		store:     store,
+		current:   common.NewMutations(),
+		committed: &TrieReader{nodeStore: tr.nodeStore, persistentRoot: root.Clone()},
+		inFlight:  make([]*PipelinedCommit, 0),
+	}, nil
+}
+
+// Update buffers the update in the current batch. Empty value deletes the key
+func (p *PipelinedTrie) Update(key []byte, value []byte) {
+	common.Assertf(len(key) > 0, "identity of the state can't be changed")
+	p.current.Set(common.Concat(key), common.Concat(value))
+}
+
+func (p *PipelinedTrie) Delete(key []byte) {
+	p.Update(key, nil)
+}
+
+// Get returns the latest value of the key: from the current batch, from batches being committed
+// or from the last committed root
+func (p *PipelinedTrie) Get(key []byte) []byte {
+	if v, ok := p.current.Lookup(key); ok {
+		return common.Concat(v)
+	}
+	p.mutex.RLock()
+	committed := p.committed
+	inFlight := p.inFlight
+	p.mutex.RUnlock()
+
+	for i := len(inFlight) - 1; i >= 0; i-- {
+		if v, ok := inFlight[i].batch.Lookup(key); ok {
+			return common.Concat(v)
+		}
+	}
+	return committed.Get(key)
+}
+
+func (p *PipelinedTrie) Has(key []byte) bool {
+	return len(p.Get(key)) > 0
+}
+
+// Pending returns number of batches being committed
+func (p *PipelinedTrie) Pending() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return len(p.inFlight)
+}
+
+// CommittedRoot returns the root of the last completed commit
+func (p *PipelinedTrie) CommittedRoot() common.VCommitment {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.committed.Root()
+}
+
+// Commit starts the commit of the current batch in the background and begins the new batch.
+// Returns the handle to wait for the root of the commit
+func (p *PipelinedTrie) Commit() *PipelinedCommit {
+	ret := &PipelinedCommit{
+		batch: p.current,
+		done:  make(chan struct{}),
+	}
+	p.current = common.NewMutations()
+
+	p.mutex.Lock()
+	var prev *PipelinedCommit
+	if len(p.inFlight) > 0 {
+		prev = p.inFlight[len(p.inFlight)-1]
+	}
+	p.inFlight = append(p.inFlight, ret)
+	p.mutex.Unlock()
+
+	go p.runCommit(ret, prev)
+	return ret
+}
+
+// runCommit commits the batch after the previous one is completed
+func (p *PipelinedTrie) runCommit(pc, prev *PipelinedCommit) {
+	defer close(pc.done)
+
+	if prev != nil {
+		<-prev.done
+		if prev.err != nil {
+			pc.err = prev.err
+			return
+		}
+	}
+	pc.err = common.CatchPanicOrError(func() error {
+		pc.batch.Iterate(func(k []byte, v []byte, _ bool) bool {
+			p.tr.Update(k, v)
+			return true
+		})
+		pc.root = p.tr.CommitAndContinue(p.store)
+		return nil
+	})
+	if pc.err != nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.committed = &TrieReader{nodeStore: p.tr.nodeStore, persistentRoot: pc.root.Clone()}
+	common.Assertf(p.inFlight[0] == pc, "PipelinedTrie: inconsistent order of commits")
+	p.inFlight = p.inFlight[1:]
+}
+
+// Wait waits until all batches committed so far are completed. Returns the root of the last commit
+// or the error of the first failed commit
+func (p *PipelinedTrie) Wait() (common.VCommitment, error) {
+	p.mutex.RLock()
+	var last *PipelinedCommit
+	if len(p.inFlight) > 0 {
+		last = p.inFlight[len(p.inFlight)-1]
+	}
+	p.mutex.RUnlock()
+
+	if last == nil {
+		return p.CommittedRoot(), nil
+	}
+	return last.Wait()
+}
+
+// Wait waits until the commit is completed. Returns the root of the commit
+func (pc *PipelinedCommit) Wait() (common.VCommitment, error) {
+	<-pc.done
+	return pc.root, pc.err
+}
+
+// Done is closed when the commit is completed
+func (pc *PipelinedCommit) Done() <-chan struct{} {
+	return pc.done
+}
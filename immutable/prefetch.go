@@ -0,0 +1,118 @@
+package immutable
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// DefaultPrefetchWorkers is the default number of goroutines which fetch nodes in Prefetch and PrefetchPrefix
+const DefaultPrefetchWorkers = 8
+
+// Prefetch fetches nodes on the paths of the keys into the node cache concurrently, so the subsequent reads
+// of the keys do not pay the latency of the cold store. Keys are split among workers, each of them
+// traverses its keys level by level like GetMany. Values are not fetched.
+// Does nothing if the node cache is not used. Returns the error (or panic) of the store, if any
+func (tr *TrieReader) Prefetch(keys [][]byte, workers ...int) error {
+	if tr.nodeStore.cache == nil || len(keys) == 0 {
+		return nil
+	}
+	chunks := splitForWorkers(len(keys), workers...)
+	return runPrefetchWorkers(len(chunks), func(i int) {
+		tr.terminalsMany(keys[chunks[i][0]:chunks[i][1]])
+	})
+}
+
+// PrefetchPrefix fetches nodes of the subtree of keys with the prefix into the node cache concurrently,
+// level by level from the top. Nodes of each level are split among workers. The prefetch stops when
+// the number of fetched nodes reaches the limit of nodes in the cache, because more nodes would only
+// evict the prefetched ones. Values are not fetched.
+// Does nothing if the node cache is not used. Returns the error (or panic) of the store, if any
+func (tr *TrieReader) PrefetchPrefix(prefix []byte, workers ...int) error {
+	common.Assertf(!tr.secureKeys, "PrefetchPrefix:: not supported in the secure trie")
+	if tr.nodeStore.cache == nil {
+		return nil
+	}
+	return common.CatchPanicOrError(func() error {
+		unpackedPrefix := common.UnpackBytes(prefix, tr.PathArity())
+		var top *common.NodeData
+		var topKey []byte
+		tr.traverseImmutablePath(unpackedPrefix, func(n *common.NodeData, trieKey []byte, _ common.PathEndingCode) {
+			top, topKey = n, trieKey
+		})
+		if top == nil || !bytes.HasPrefix(common.Concat(topKey, top.PathFragment), unpackedPrefix) {
+			// no keys with the prefix
+			return nil
+		}
+		budget := tr.nodeStore.cache.maxEntries - 1
+		level := []*common.NodeData{top}
+		for len(level) > 0 && (tr.nodeStore.cache.maxEntries <= 0 || budget > 0) {
+			next := make([]common.VCommitment, 0)
+			for _, n := range level {
+				n.IterateChildren(func(_ byte, c common.VCommitment) bool {
+					next = append(next, c)
+					return true
+				})
+			}
+			if tr.nodeStore.cache.maxEntries > 0 && len(next) > budget {
+				next = next[:budget]
+			}
+			budget -= len(next)
+			level = make([]*common.NodeData, len(next))
+			chunks := splitForWorkers(len(next), workers...)
+			err := runPrefetchWorkers(len(chunks), func(i int) {
+				nodes := tr.nodeStore.fetchNodesMany(next[chunks[i][0]:chunks[i][1]])
+				for j, n := range nodes {
+					common.Assertf(n != nil, "PrefetchPrefix: can't fetch node %s", next[chunks[i][0]+j])
+				}
+				copy(level[chunks[i][0]:chunks[i][1]], nodes)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// splitForWorkers splits n items into at most the number of workers of contiguous [from, to) ranges
+func splitForWorkers(n int, workers ...int) [][2]int {
+	w := DefaultPrefetchWorkers
+	if len(workers) > 0 && workers[0] > 0 {
+		w = workers[0]
+	}
+	chunk := (n + w - 1) / w
+	ret := make([][2]int, 0, w)
+	for from := 0; from < n; from += chunk {
+		to := from + chunk
+		if to > n {
+			to = n
+		}
+		ret = append(ret, [2]int{from, to})
+	}
+	return ret
+}
+
+// runPrefetchWorkers runs fun(0)...fun(n-1) in parallel and returns the first error or panic
+func runPrefetchWorkers(n int, fun func(i int)) error {
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = common.CatchPanicOrError(func() error {
+				fun(i)
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package immutable
+
+import (
+	"sync"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// RootStatus is the finality status of the root, reported to the ReaderCache by the application
+type RootStatus byte
+
+const (
+	// RootStatusPending the root may still be finalized or orphaned. Default status of any root.
+	// Only a limited number of the latest pending roots are kept in the cache
+	RootStatusPending = RootStatus(iota)
+	// RootStatusFinalized the root is final. Only a limited number of the latest finalized roots are kept in the cache
+	RootStatusFinalized
+	// RootStatusOrphaned the root will never be queried again. It is evicted from the cache immediately
+	RootStatusOrphaned
+)
+
+func (s RootStatus) String() string {
+	switch s {
+	case RootStatusPending:
+		return "pending"
+	case RootStatusFinalized:
+		return "finalized"
+	case RootStatusOrphaned:
+		return "orphaned"
+	default:
+		return "RootStatus(wrong)"
+	}
+}
+
+type (
+	// ReaderCache caches trie readers and arbitrary artifacts derived from the root, such as proofs and witnesses.
+	// The application tells the cache which roots are finalized and which are orphaned,
+	// and the cache evicts everything related to the roots which will never be queried again.
+	// ReaderCache is thread-safe, and so is the cached TrieReader
+	ReaderCache struct {
+		mutex     sync.Mutex
+		model     common.CommitmentModel
+		store     common.KVReader
+		params    ReaderCacheParams
+		entries   map[string]*readerCacheEntry
+		finalized []string // in the order of finalization
+		pending   []string // in the order of addition to the cache
+	}
+
+	ReaderCacheParams struct {
+		// KeepFinalized maximum number of finalized roots kept in the cache. The oldest finalized roots are evicted first
+		// 0 means no limit
+		KeepFinalized int
+		// KeepPending maximum number of pending roots kept in the cache. It bounds the cache if the application
+		// never reports the status of some roots, for example of the abandoned forks. The roots added to the cache
+		// first are evicted first. 0 means no limit
+		KeepPending int
+		// OnEvict is called (if not nil) when the root is evicted from the cache. It is called with the cache locked
+		OnEvict func(root common.VCommitment, status RootStatus)
+	}
+
+	readerCacheEntry struct {
+		root      common.VCommitment
+		status    RootStatus
+		reader    *TrieReader
+		artifacts map[string]interface{}
+	}
+)
+
+func NewReaderCache(model common.CommitmentModel, store common.KVReader, params ...ReaderCacheParams) *ReaderCache {
+	ret := &ReaderCache{
+		model:     model,
+		store:     store,
+		entries:   make(map[string]*readerCacheEntry),
+		finalized: make([]string, 0),
+		pending:   make([]string, 0),
+	}
+	if len(params) > 0 {
+		ret.params = params[0]
+	}
+	return ret
+}
+
+func (c *ReaderCache) getEntry(root common.VCommitment) *readerCacheEntry {
+	key := string(root.Bytes())
+	ret, ok := c.entries[key]
+	if !ok {
+		ret = &readerCacheEntry{
+			root:      root.Clone(),
+			status:    RootStatusPending,
+			artifacts: make(map[string]interface{}),
+		}
+		c.entries[key] = ret
+		c.pending = append(c.pending, key)
+	}
+	return ret
+}
+
+// getPendingEntry same as getEntry, only the oldest pending roots are evicted if there are too many of them
+func (c *ReaderCache) getPendingEntry(root common.VCommitment) *readerCacheEntry {
+	ret := c.getEntry(root)
+	for c.params.KeepPending > 0 && len(c.pending) > c.params.KeepPending {
+		c.evict(c.pending[0], RootStatusPending)
+	}
+	return ret
+}
+
+// Reader returns cached trie reader for the root or creates a new one
+func (c *ReaderCache) Reader(root common.VCommitment) (*TrieReader, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.entries[string(root.Bytes())]; ok && e.reader != nil {
+		return e.reader, nil
+	}
+	tr, err := NewTrieReader(c.model, c.store, root)
+	if err != nil {
+		return nil, err
+	}
+	c.getPendingEntry(root).reader = tr
+	return tr, nil
+}
+
+// PutArtifact caches an artifact, such as proof or witness, under the key for the root
+func (c *ReaderCache) PutArtifact(root common.VCommitment, key string, artifact interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.getPendingEntry(root).artifacts[key] = artifact
+}
+
+// GetArtifact returns the artifact cached under the key for the root
+func (c *ReaderCache) GetArtifact(root common.VCommitment, key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[string(root.Bytes())]
+	if !ok {
+		return nil, false
+	}
+	ret, ok := e.artifacts[key]
+	return ret, ok
+}
+
+// SetRootStatus is the finality policy hook. Orphaned roots are evicted immediately. When the number of
+// finalized roots in the cache exceeds the limit, the oldest finalized roots are evicted.
+// Setting the pending status has no effect
+func (c *ReaderCache) SetRootStatus(root common.VCommitment, status RootStatus) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := string(root.Bytes())
+	switch status {
+	case RootStatusOrphaned:
+		c.evict(key, status)
+	case RootStatusFinalized:
+		e := c.getEntry(root)
+		if e.status == RootStatusFinalized {
+			return
+		}
+		e.status = RootStatusFinalized
+		c.pending = removeKey(c.pending, key)
+		c.finalized = append(c.finalized, key)
+		for c.params.KeepFinalized > 0 && len(c.finalized) > c.params.KeepFinalized {
+			c.evict(c.finalized[0], RootStatusFinalized)
+		}
+	}
+}
+
+// Evict evicts everything cached for the root
+func (c *ReaderCache) Evict(root common.VCommitment) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := string(root.Bytes())
+	if e, ok := c.entries[key]; ok {
+		c.evict(key, e.status)
+	}
+}
+
+func (c *ReaderCache) evict(key string, status RootStatus) {
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	delete(c.entries, key)
+	switch e.status {
+	case RootStatusFinalized:
+		c.finalized = removeKey(c.finalized, key)
+	case RootStatusPending:
+		c.pending = removeKey(c.pending, key)
+	}
+	if c.params.OnEvict != nil {
+		c.params.OnEvict(e.root, status)
+	}
+}
+
+// Len number of roots in the cache
+func (c *ReaderCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return len(c.entries)
+}
+
+func removeKey(keys []string, key string) []string {
+	for i, k := range keys {
+		if k == key {
+			return append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
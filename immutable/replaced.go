@@ -0,0 +1,92 @@
+package immutable
+
+import (
+	"bytes"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// committedCursor is a position in the trie after commit of buffered nodes: either buffered node or,
+// for the unchanged subtrees, the node fetched from the store
+type committedCursor struct {
+	nodeData *common.NodeData
+	buffered *bufferedNode
+	nodeKey  []byte
+}
+
+func (c *committedCursor) fullPath() []byte {
+	return common.Concat(c.nodeKey, c.nodeData.PathFragment)
+}
+
+func (c *committedCursor) child(ns *NodeStore, childIndex byte) *committedCursor {
+	if c.buffered != nil {
+		if child, isModified := c.buffered.uncommittedChildren[childIndex]; isModified {
+			if child == nil {
+				return nil
+			}
+			return &committedCursor{nodeData: child.nodeData, buffered: child, nodeKey: child.triePath}
+		}
+	}
+	n, childKey := ns.FetchChild(c.nodeData, childIndex, c.nodeKey)
+	if n == nil {
+		return nil
+	}
+	return &committedCursor{nodeData: n, nodeKey: childKey}
+}
+
+// iterateReplacedNodes calls the function for each node, reachable from the persistent root and not reachable
+// from the mutated root. Must be called after commitBuffered and before finalizeCommit.
+// The commitment of the node must commit to the position of the node in the trie (see
+// common.CommitmentsDependOnPosition), so the nodes with the same commitment can only be found at the same
+// position in both tries.
+// Subtrees with equal commitments are skipped
+func (tr *TrieUpdatable) iterateReplacedNodes(fun func(n *common.NodeData)) {
+	common.Assertf(common.CommitmentsDependOnPosition(tr.Model()), "iterateReplacedNodes: commitments of the model do not depend on positions")
+	oldRoot := &diffCursor{n: tr.nodeStore.MustFetchNodeData(tr.persistentRoot)}
+	newRoot := &committedCursor{nodeData: tr.mutatedRoot.nodeData, buffered: tr.mutatedRoot}
+	tr.replacedNodes(oldRoot, newRoot, fun)
+}
+
+func (tr *TrieUpdatable) replacedNodes(o *diffCursor, n *committedCursor, fun func(n *common.NodeData)) {
+	if o == nil {
+		return
+	}
+	if n == nil {
+		tr.allNodes(o, fun)
+		return
+	}
+	if tr.Model().EqualCommitments(o.n.Commitment, n.nodeData.Commitment) {
+		return
+	}
+	fpOld, fpNew := o.fullPath(), n.fullPath()
+	numChildren := tr.PathArity().NumChildren()
+	switch {
+	case bytes.Equal(fpOld, fpNew):
+		fun(o.n)
+		for i := 0; i < numChildren; i++ {
+			tr.replacedNodes(o.child(tr.TrieReader, byte(i)), n.child(tr.nodeStore, byte(i)), fun)
+		}
+	case bytes.HasPrefix(fpOld, fpNew):
+		// the new node branches earlier, the old node corresponds to one of its children
+		tr.replacedNodes(o, n.child(tr.nodeStore, fpOld[len(fpNew)]), fun)
+	case bytes.HasPrefix(fpNew, fpOld):
+		fun(o.n)
+		idx := fpNew[len(fpOld)]
+		for i := 0; i < numChildren; i++ {
+			if byte(i) == idx {
+				tr.replacedNodes(o.child(tr.TrieReader, byte(i)), n, fun)
+			} else {
+				tr.replacedNodes(o.child(tr.TrieReader, byte(i)), nil, fun)
+			}
+		}
+	default:
+		tr.allNodes(o, fun)
+	}
+}
+
+func (tr *TrieUpdatable) allNodes(o *diffCursor, fun func(n *common.NodeData)) {
+	tr.iterateNodes(o.n.Commitment, o.nodeKey, func(_ []byte, n *common.NodeData) bool {
+		fun(n)
+		return true
+	})
+}
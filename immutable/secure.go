@@ -0,0 +1,93 @@
+package immutable
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Secure trie mode. User keys are hashed with blake2b-160 before accessing the trie, like in Ethereum's secure trie.
+// It bounds the length of trie paths for adversarial keys and balances the trie.
+// The keys in the trie (as seen by iterators, proofs and snapshots) are hashes of user keys. Optionally,
+// preimages of hashed keys are stored in the separate partition, so the user keys can be recovered with Preimage
+
+// NewSecureTrieReader creates reader of the trie in the secure mode
+func NewSecureTrieReader(m common.CommitmentModel, store common.KVReader, root common.VCommitment, cacheSize ...int) (*TrieReader, error) {
+	ret, err := NewTrieReader(m, store, root, cacheSize...)
+	if err != nil {
+		return nil, err
+	}
+	ret.secureKeys = true
+	return ret, nil
+}
+
+// NewSecureTrieUpdatable creates updatable trie in the secure mode. If storePreimages == true, the preimages
+// of hashed keys are written to the store on commit
+func NewSecureTrieUpdatable(m common.CommitmentModel, store common.KVReader, root common.VCommitment, storePreimages bool, cacheSize ...int) (*TrieUpdatable, error) {
+	ret, err := NewTrieUpdatable(m, store, root, cacheSize...)
+	if err != nil {
+		return nil, err
+	}
+	ret.secureKeys = true
+	if storePreimages {
+		ret.preimages = make(map[string][]byte)
+	}
+	return ret, nil
+}
+
+// IsSecure returns true if user keys are hashed
+func (tr *TrieReader) IsSecure() bool {
+	return tr.secureKeys
+}
+
+// HashKey returns key as it is stored in the secure trie
+func HashKey(key []byte) []byte {
+	ret := common.Blake2b160(key)
+	return ret[:]
+}
+
+// Preimage returns user key of the hashed key, if preimage was stored
+func (tr *TrieReader) Preimage(hashedKey []byte) []byte {
+	return tr.nodeStore.preimageStore.Get(hashedKey)
+}
+
+// trieKey returns the key in the trie for the user key
+func (tr *TrieReader) trieKey(key []byte) []byte {
+	if !tr.secureKeys {
+		return key
+	}
+	return HashKey(key)
+}
+
+// updatableTrieKey returns the key in the trie for the user key and collects its preimage if needed
+func (tr *TrieUpdatable) updatableTrieKey(key []byte) []byte {
+	if !tr.secureKeys {
+		return key
+	}
+	ret := HashKey(key)
+	if tr.preimages != nil {
+		tr.preimages[string(ret)] = common.Concat(key)
+	}
+	return ret
+}
+
+// deletedTrieKey returns the key in the trie for the deleted user key. The preimage collected
+// in the same batch is not needed anymore. Preimages already in the store are never deleted
+func (tr *TrieUpdatable) deletedTrieKey(key []byte) []byte {
+	ret := tr.trieKey(key)
+	if tr.preimages != nil {
+		delete(tr.preimages, string(ret))
+	}
+	return ret
+}
+
+func (tr *TrieUpdatable) writePreimages(store common.KVWriter) {
+	if len(tr.preimages) == 0 {
+		return
+	}
+	w := common.MakeWriterPartition(store, PartitionKeyPreimages)
+	defer w.Dispose()
+
+	for k, v := range tr.preimages {
+		w.Set([]byte(k), v)
+	}
+	tr.preimages = make(map[string][]byte)
+}
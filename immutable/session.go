@@ -0,0 +1,130 @@
+package immutable
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// ErrReadBudgetExceeded is returned by the ReadSession when the logical request exceeds limits of the session
+var ErrReadBudgetExceeded = errors.New("read session budget exceeded")
+
+type (
+	// ReadSession is a trie reader which enforces limits on the store reads of one logical request,
+	// such as a query or a proof. It protects public endpoints from resource-exhaustion queries: for example,
+	// adversarial key patterns may lead to long paths in the trie.
+	// When the limit is exceeded, the session is aborted: the current and all subsequent operations of the
+	// session return ErrReadBudgetExceeded.
+	// The session is not thread-safe and is intended to be short-lived
+	ReadSession struct {
+		tr     *TrieReader
+		budget *readBudget
+	}
+
+	// ReadSessionLimits limits of the ReadSession. 0 means no limit
+	ReadSessionLimits struct {
+		// MaxNodes maximum number of trie nodes fetched from the store
+		MaxNodes int
+		// MaxBytes maximum number of bytes read from the store, including nodes and values
+		MaxBytes int
+	}
+
+	// readBudget is the KVReader which counts reads and panics with ErrReadBudgetExceeded when limits are exceeded
+	readBudget struct {
+		store        common.KVReader
+		limits       ReadSessionLimits
+		nodesFetched int
+		bytesRead    int
+		exceeded     error
+	}
+)
+
+// NewReadSession creates a new read session for the root. Fetching of the root node is counted too.
+// The session does not use the node cache, so each session is accounted independently
+func NewReadSession(m common.CommitmentModel, store common.KVReader, root common.VCommitment, limits ReadSessionLimits) (*ReadSession, error) {
+	budget := &readBudget{
+		store:  store,
+		limits: limits,
+	}
+	var tr *TrieReader
+	err := common.CatchPanicOrError(func() error {
+		var err error
+		tr, err = NewTrieReader(m, budget, root, 0)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ReadSession{
+		tr:     tr,
+		budget: budget,
+	}, nil
+}
+
+// Run runs the function with the trie reader of the session. Returns ErrReadBudgetExceeded (wrapped) if the
+// limits of the session were exceeded. Any other panic in the function is returned as an error as well.
+// The reader must not be used outside the function
+func (s *ReadSession) Run(fun func(tr *TrieReader)) error {
+	if s.budget.exceeded != nil {
+		return s.budget.exceeded
+	}
+	return common.CatchPanicOrError(func() error {
+		fun(s.tr)
+		return nil
+	})
+}
+
+func (s *ReadSession) Get(key []byte) ([]byte, error) {
+	var ret []byte
+	err := s.Run(func(tr *TrieReader) {
+		ret = tr.Get(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *ReadSession) Has(key []byte) (bool, error) {
+	var ret bool
+	err := s.Run(func(tr *TrieReader) {
+		ret = tr.Has(key)
+	})
+	return ret, err
+}
+
+// NodesFetched number of trie nodes fetched by the session so far
+func (s *ReadSession) NodesFetched() int {
+	return s.budget.nodesFetched
+}
+
+// BytesRead number of bytes read from the store by the session so far
+func (s *ReadSession) BytesRead() int {
+	return s.budget.bytesRead
+}
+
+func (b *readBudget) Get(key []byte) []byte {
+	if b.exceeded != nil {
+		panic(b.exceeded)
+	}
+	if len(key) > 0 && key[0] == PartitionTrieNodes {
+		b.nodesFetched++
+		if b.limits.MaxNodes > 0 && b.nodesFetched > b.limits.MaxNodes {
+			b.exceeded = fmt.Errorf("%w: more than %d nodes fetched", ErrReadBudgetExceeded, b.limits.MaxNodes)
+			panic(b.exceeded)
+		}
+	}
+	ret := b.store.Get(key)
+	b.bytesRead += len(ret)
+	if b.limits.MaxBytes > 0 && b.bytesRead > b.limits.MaxBytes {
+		b.exceeded = fmt.Errorf("%w: more than %d bytes read", ErrReadBudgetExceeded, b.limits.MaxBytes)
+		panic(b.exceeded)
+	}
+	return ret
+}
+
+// Has is counted as Get, because it costs the same to the store
+func (b *readBudget) Has(key []byte) bool {
+	return len(b.Get(key)) > 0
+}
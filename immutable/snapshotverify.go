@@ -0,0 +1,199 @@
+package immutable
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+var (
+	ErrSnapshotTampered       = errors.New("snapshot data does not match the root")
+	ErrSnapshotTooManyPending = errors.New("too many unverified records in the snapshot stream")
+	ErrSnapshotIncomplete     = errors.New("snapshot is incomplete")
+)
+
+const defaultMaxPendingRecords = 100_000
+
+// SnapshotVerifier verifies the snapshot stream (as written by Snapshot) against the trusted root while it is
+// being received, for example, downloaded chunk by chunk.
+// Each node is checked against the commitment of the already verified parent as soon as both are received,
+// so tampered data is detected early and the download can be aborted.
+// Records which cannot be verified yet (the parent was not received) are kept pending, up to the limit.
+// Verified records are forwarded to the destination writer, if provided.
+// SnapshotVerifier implements common.KVStreamWriter
+type SnapshotVerifier struct {
+	m          common.CommitmentModel
+	dest       common.KVWriter
+	maxPending int
+	// commitments of nodes referenced by verified parents but not received yet, with node paths
+	expectedNodes map[string]expectedNode
+	// terminals of verified nodes, which values are stored in the value partition and are not received yet
+	expectedValues map[string]common.TCommitment
+	// terminals of verified values. The same value can be referenced by many terminals
+	verifiedValues map[string]common.TCommitment
+	pendingNodes   map[string][]byte
+	pendingValues  map[string][]byte
+	kvCount        int
+	byteCount      int
+}
+
+type expectedNode struct {
+	commitment common.VCommitment
+	nodePath   []byte
+}
+
+var _ common.KVStreamWriter = &SnapshotVerifier{}
+
+// NewSnapshotVerifier creates the verifier of the snapshot of the root. Parameter dest may be nil.
+// Optional maxPending limits number of records which cannot be verified yet
+func NewSnapshotVerifier(m common.CommitmentModel, root common.VCommitment, dest common.KVWriter, maxPending ...int) *SnapshotVerifier {
+	ret := &SnapshotVerifier{
+		m:              m,
+		dest:           dest,
+		maxPending:     defaultMaxPendingRecords,
+		expectedNodes:  make(map[string]expectedNode),
+		expectedValues: make(map[string]common.TCommitment),
+		verifiedValues: make(map[string]common.TCommitment),
+		pendingNodes:   make(map[string][]byte),
+		pendingValues:  make(map[string][]byte),
+	}
+	if len(maxPending) > 0 {
+		ret.maxPending = maxPending[0]
+	}
+	ret.expectedNodes[string(common.AsKey(root))] = expectedNode{commitment: root.Clone()}
+	return ret
+}
+
+// Write receives one record of the snapshot stream
+func (v *SnapshotVerifier) Write(key, value []byte) error {
+	if len(key) < 2 {
+		return fmt.Errorf("%w: wrong key '%s'", ErrSnapshotTampered, hex.EncodeToString(key))
+	}
+	v.kvCount++
+	v.byteCount += len(key) + len(value)
+	switch key[0] {
+	case PartitionTrieNodes:
+		return v.receiveNode(key[1:], value)
+	case PartitionValues:
+		return v.receiveValue(key[1:], value)
+	}
+	return fmt.Errorf("%w: unexpected partition %d", ErrSnapshotTampered, key[0])
+}
+
+// Stats returns number of records and bytes received
+func (v *SnapshotVerifier) Stats() (int, int) {
+	return v.kvCount, v.byteCount
+}
+
+// Finish checks if all the snapshot has been received and verified
+func (v *SnapshotVerifier) Finish() error {
+	if len(v.expectedNodes) > 0 || len(v.expectedValues) > 0 {
+		return fmt.Errorf("%w: %d nodes and %d values are missing", ErrSnapshotIncomplete, len(v.expectedNodes), len(v.expectedValues))
+	}
+	if len(v.pendingNodes) > 0 || len(v.pendingValues) > 0 {
+		return fmt.Errorf("%w: %d nodes and %d values are not reachable from the root",
+			ErrSnapshotTampered, len(v.pendingNodes), len(v.pendingValues))
+	}
+	return nil
+}
+
+// ReceiveChunk verifies records of the chunk i of the snapshot stream, written by common.ChunkedStreamWriter.
+// The chunk is checked against the manifest and its records against the root, so the tampered chunk is
+// detected as soon as it is received. Chunks may be received in any order: records which cannot be verified
+// yet remain pending until the chunks with their parents are received. Finish must be called after the last chunk
+func (v *SnapshotVerifier) ReceiveChunk(chunks *common.ChunkedStreamIterator, i int) error {
+	var err error
+	errChunk := chunks.IterateChunk(i, func(k, val []byte) bool {
+		err = v.Write(k, val)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return errChunk
+}
+
+func (v *SnapshotVerifier) receiveNode(nodeKey, data []byte) error {
+	e, isExpected := v.expectedNodes[string(nodeKey)]
+	if !isExpected {
+		return v.addPending(v.pendingNodes, nodeKey, data)
+	}
+	delete(v.expectedNodes, string(nodeKey))
+
+	n, err := common.NodeDataFromBytes(v.m, data, v.m.PathArity(), func(_ []byte) ([]byte, error) {
+		return nil, errors.New("terminal commitment must be stored in the trie node")
+	})
+	if err != nil {
+		return fmt.Errorf("%w: node %s: %v", ErrSnapshotTampered, e.commitment, err)
+	}
+	c := v.m.CalcNodeCommitment(n, e.nodePath)
+	if common.IsNil(c) || !bytes.Equal(common.AsKey(c), nodeKey) {
+		return fmt.Errorf("%w: wrong data of the node %s", ErrSnapshotTampered, e.commitment)
+	}
+	if v.dest != nil {
+		v.dest.Set(common.Concat(PartitionTrieNodes, nodeKey), data)
+	}
+	if !common.IsNil(n.Terminal) {
+		if _, inTheCommitment := n.Terminal.ExtractValue(); !inTheCommitment {
+			valueKey := string(common.AsKey(n.Terminal))
+			if _, already := v.verifiedValues[valueKey]; !already {
+				v.expectedValues[valueKey] = n.Terminal
+				if value, isPending := v.pendingValues[valueKey]; isPending {
+					delete(v.pendingValues, valueKey)
+					if err = v.receiveValue([]byte(valueKey), value); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	var childData []byte
+	n.IterateChildren(func(childIndex byte, childCommitment common.VCommitment) bool {
+		childKey := string(common.AsKey(childCommitment))
+		v.expectedNodes[childKey] = expectedNode{
+			commitment: childCommitment,
+			nodePath:   common.Concat(e.nodePath, n.PathFragment, childIndex),
+		}
+		var isPending bool
+		if childData, isPending = v.pendingNodes[childKey]; isPending {
+			delete(v.pendingNodes, childKey)
+			err = v.receiveNode([]byte(childKey), childData)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func (v *SnapshotVerifier) receiveValue(valueKey, value []byte) error {
+	terminal, already := v.verifiedValues[string(valueKey)]
+	if !already {
+		var isExpected bool
+		if terminal, isExpected = v.expectedValues[string(valueKey)]; !isExpected {
+			return v.addPending(v.pendingValues, valueKey, value)
+		}
+	}
+	if !v.m.EqualCommitments(v.m.CommitToData(value), terminal) {
+		return fmt.Errorf("%w: wrong value of the terminal %s", ErrSnapshotTampered, terminal)
+	}
+	if already {
+		// value shared by several terminals
+		return nil
+	}
+	delete(v.expectedValues, string(valueKey))
+	v.verifiedValues[string(valueKey)] = terminal
+	if v.dest != nil {
+		v.dest.Set(common.Concat(PartitionValues, valueKey), value)
+	}
+	return nil
+}
+
+func (v *SnapshotVerifier) addPending(pending map[string][]byte, key, data []byte) error {
+	if len(v.pendingNodes)+len(v.pendingValues) >= v.maxPending {
+		return ErrSnapshotTooManyPending
+	}
+	pending[string(key)] = common.Concat(data)
+	return nil
+}
@@ -0,0 +1,138 @@
+package immutable
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// CommitStats statistics of the last commit. Collected only if enabled with EnableCommitStats
+type CommitStats struct {
+	// NewTrieNodes number of trie nodes written to the store
+	NewTrieNodes int
+	// BytesWritten number of bytes (keys and values) written to each partition
+	BytesWritten map[byte]int
+	// DeletedKeys number of keys deleted from the trie by Delete or Update with empty value
+	DeletedKeys int
+	// DeletedPrefixes number of successful DeletePrefix calls
+	DeletedPrefixes int
+	// MaxDepth maximum depth (in nodes, root has depth 0) of the modified node
+	MaxDepth int
+	// LogicalBytes number of bytes of keys and values updated by the user. Deletions count key (prefix) bytes only
+	LogicalBytes int
+	// TerminalCacheHits number of terminal commitments taken from the cache. See EnableTerminalCache
+	TerminalCacheHits int
+}
+
+// WriteAmplification running totals of logical and physical bytes of all commits since statistics were enabled
+type WriteAmplification struct {
+	LogicalBytes  int
+	PhysicalBytes int
+	Commits       int
+}
+
+// statsWriter counts writes to the store by partition
+type statsWriter struct {
+	w     common.KVWriter
+	stats *CommitStats
+}
+
+// EnableCommitStats enables or disables collecting of commit statistics. Enabling resets running totals
+func (tr *TrieUpdatable) EnableCommitStats(enable bool) {
+	if enable {
+		tr.stats = newCommitStats()
+	} else {
+		tr.stats = nil
+	}
+	tr.amplification = WriteAmplification{}
+}
+
+// WriteAmplification returns running totals of the commits since statistics were enabled
+func (tr *TrieUpdatable) WriteAmplification() WriteAmplification {
+	return tr.amplification
+}
+
+// LastCommitStats returns statistics of the last commit or nil if statistics are not enabled
+func (tr *TrieUpdatable) LastCommitStats() *CommitStats {
+	return tr.lastStats
+}
+
+func newCommitStats() *CommitStats {
+	return &CommitStats{
+		BytesWritten: make(map[byte]int),
+	}
+}
+
+// TotalBytesWritten bytes written to all partitions
+func (s *CommitStats) TotalBytesWritten() int {
+	ret := 0
+	for _, n := range s.BytesWritten {
+		ret += n
+	}
+	return ret
+}
+
+// Amplification ratio of physical bytes written to the store to the logical bytes updated in the commit.
+// Returns 0 if nothing was updated
+func (s *CommitStats) Amplification() float64 {
+	if s.LogicalBytes == 0 {
+		return 0
+	}
+	return float64(s.TotalBytesWritten()) / float64(s.LogicalBytes)
+}
+
+// Factor running write amplification factor. Returns 0 if nothing was updated
+func (a WriteAmplification) Factor() float64 {
+	if a.LogicalBytes == 0 {
+		return 0
+	}
+	return float64(a.PhysicalBytes) / float64(a.LogicalBytes)
+}
+
+func (w *statsWriter) Set(key, value []byte) {
+	w.w.Set(key, value)
+	if len(key) == 0 {
+		return
+	}
+	w.stats.BytesWritten[key[0]] += len(key) + len(value)
+	if key[0] == PartitionTrieNodes && len(value) > 0 {
+		w.stats.NewTrieNodes++
+	}
+}
+
+// maxDepth maximum depth of the modified node in the buffered subtree
+func (n *bufferedNode) maxDepth() int {
+	ret := 0
+	for _, child := range n.uncommittedChildren {
+		if child == nil {
+			continue
+		}
+		if d := child.maxDepth() + 1; d > ret {
+			ret = d
+		}
+	}
+	return ret
+}
+
+// countDeletion counts deletions for statistics, if enabled
+func (tr *TrieUpdatable) countDeletion(deleted, isPrefix bool) {
+	if tr.stats == nil || !deleted {
+		return
+	}
+	if isPrefix {
+		tr.stats.DeletedPrefixes++
+	} else {
+		tr.stats.DeletedKeys++
+	}
+}
+
+func (tr *TrieUpdatable) countLogicalBytes(n int) {
+	if tr.stats != nil {
+		tr.stats.LogicalBytes += n
+	}
+}
+
+// accumulateStats adds statistics of the finished commit to the running totals
+func (tr *TrieUpdatable) accumulateStats(s *CommitStats) {
+	tr.amplification.LogicalBytes += s.LogicalBytes
+	tr.amplification.PhysicalBytes += s.TotalBytesWritten()
+	tr.amplification.Commits++
+}
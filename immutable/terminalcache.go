@@ -0,0 +1,72 @@
+package immutable
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Cache of terminal commitments of the values updated within one commit.
+// Workloads with many equal values (flags, empty structures, etc.) commit to the same bytes over and over again.
+// With the cache, the terminal commitment to each distinct value is calculated only once per commit.
+// Terminal commitments are never modified in place, so the same commitment is shared by all nodes with the value.
+// The cache is reset on commit and on rollback
+
+// MaxTerminalCacheValueSize values longer than that are not cached: repeated long values are not typical,
+// and the cache would retain too much memory
+const MaxTerminalCacheValueSize = 256
+
+// dataCommitter calculates terminal commitments. It is either the commitment model or the cache in front of it
+type dataCommitter interface {
+	CommitToData([]byte) common.TCommitment
+}
+
+type terminalCache struct {
+	m     common.CommitmentModel
+	cache map[string]common.TCommitment
+	hits  int
+}
+
+// EnableTerminalCache enables or disables caching of terminal commitments to repeated values within the commit.
+// Commitments do not depend on it
+func (tr *TrieUpdatable) EnableTerminalCache(enable bool) {
+	if enable {
+		tr.terminalCache = newTerminalCache(tr.Model())
+	} else {
+		tr.terminalCache = nil
+	}
+}
+
+func newTerminalCache(m common.CommitmentModel) *terminalCache {
+	return &terminalCache{
+		m:     m,
+		cache: make(map[string]common.TCommitment),
+	}
+}
+
+// dataCommitter returns the cache, if enabled, otherwise the model
+func (tr *TrieUpdatable) dataCommitter() dataCommitter {
+	if tr.terminalCache != nil {
+		return tr.terminalCache
+	}
+	return tr.Model()
+}
+
+func (c *terminalCache) CommitToData(data []byte) common.TCommitment {
+	if len(data) == 0 || len(data) > MaxTerminalCacheValueSize {
+		return c.m.CommitToData(data)
+	}
+	if ret, ok := c.cache[string(data)]; ok {
+		c.hits++
+		return ret
+	}
+	ret := c.m.CommitToData(data)
+	c.cache[string(data)] = ret
+	return ret
+}
+
+// reset clears the cache. Returns number of hits since the last reset
+func (c *terminalCache) reset() int {
+	ret := c.hits
+	c.cache = make(map[string]common.TCommitment)
+	c.hits = 0
+	return ret
+}
@@ -0,0 +1,46 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditState(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	// plain state, maintained alongside the trie
+	state := common.NewInMemoryKVStore()
+	for i := 0; i < 100; i++ {
+		k, v := fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)
+		tr.UpdateStr(k, v)
+		state.Set([]byte(k), []byte(v))
+	}
+	root = tr.Commit(store)
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	require.True(t, immutable.AuditState(trr, state).Consistent())
+
+	state.Set([]byte("key1"), nil)
+	state.Set([]byte("key2"), []byte("other"))
+	state.Set([]byte("extra"), []byte("extra"))
+	report := immutable.AuditState(trr, state)
+	require.False(t, report.Consistent())
+	require.EqualValues(t, [][]byte{[]byte("key1")}, report.OnlyInTrie)
+	require.EqualValues(t, [][]byte{[]byte("extra")}, report.OnlyInReference)
+	require.EqualValues(t, [][]byte{[]byte("key2")}, report.Different)
+
+	num := 0
+	immutable.Audit(trr, state, func(_, _, _ []byte) bool {
+		num++
+		return false
+	})
+	require.EqualValues(t, 1, num)
+}
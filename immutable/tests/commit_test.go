@@ -0,0 +1,290 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func countKeys(store common.Traversable, prefix byte) int {
+	ret := 0
+	store.Iterator([]byte{prefix}).IterateKeys(func(_ []byte) bool {
+		ret++
+		return true
+	})
+	return ret
+}
+
+func TestCommitMutations(t *testing.T) {
+	runTest := func(m common.CommitmentModel) {
+		t.Run(m.ShortName(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(2))
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			checklist := make(map[string]string)
+			for round := 0; round < 10; round++ {
+				tr, err := immutable.NewTrieUpdatable(m, store, root)
+				require.NoError(t, err)
+				for i := 0; i < 50; i++ {
+					k := fmt.Sprintf("%x", rnd.Intn(500))
+					switch {
+					case rnd.Intn(4) == 0:
+						tr.DeleteStr(k)
+						delete(checklist, k)
+					case round == 5 && i == 0:
+						tr.DeletePrefix([]byte("1"))
+						for key := range checklist {
+							if key[0] == '1' {
+								delete(checklist, key)
+							}
+						}
+					default:
+						v := fmt.Sprintf("v%d", rnd.Intn(5))
+						tr.UpdateStr(k, v)
+						checklist[k] = v
+					}
+				}
+				var mut *common.Mutations
+				root, mut = tr.CommitMutations()
+				require.True(t, mut.LenDel() > 0)
+				mut.WriteTo(store)
+
+				trr, err := immutable.NewTrieReader(m, store, root)
+				require.NoError(t, err)
+				for k, v := range checklist {
+					require.EqualValues(t, v, trr.GetStr(k))
+				}
+				// only the nodes of the latest root must remain in the store
+				snapshot := common.NewInMemoryKVStore()
+				trr.Snapshot(snapshot)
+				require.EqualValues(t, countKeys(snapshot, immutable.PartitionTrieNodes), countKeys(store, immutable.PartitionTrieNodes))
+			}
+		})
+	}
+	for _, arity := range common.AllPathArity {
+		runTest(trie_blake2b.New(arity, trie_blake2b.HashSize160))
+	}
+}
+
+func TestRollback(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieChained(m, store, root)
+			require.NoError(t, err)
+			tr.UpdateStr("a", "1")
+			tr.UpdateStr("ab", "2")
+			tr = tr.CommitChained()
+			root = tr.Root()
+
+			tr.UpdateStr("a", "3")
+			tr.UpdateStr("abc", "4")
+			tr.DeleteStr("ab")
+			tr.Rollback()
+			tr = tr.CommitChained()
+			require.True(t, m.EqualCommitments(root, tr.Root()))
+
+			tr.UpdateStr("abc", "4")
+			tr.Rollback()
+			tr.UpdateStr("b", "5")
+			tr = tr.CommitChained()
+			require.EqualValues(t, "1", tr.GetStr("a"))
+			require.EqualValues(t, "2", tr.GetStr("ab"))
+			require.EqualValues(t, "5", tr.GetStr("b"))
+			require.False(t, tr.HasStr("abc"))
+		})
+	}
+}
+
+func TestCommitAndContinue(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(3))
+			store1 := common.NewInMemoryKVStore()
+			store2 := common.NewInMemoryKVStore()
+			root1 := immutable.MustInitRoot(store1, m, []byte("identity"))
+			root2 := immutable.MustInitRoot(store2, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store1, root1)
+			require.NoError(t, err)
+			for round := 0; round < 5; round++ {
+				tr2, err := immutable.NewTrieUpdatable(m, store2, root2)
+				require.NoError(t, err)
+				for i := 0; i < 50; i++ {
+					k := fmt.Sprintf("%x", rnd.Intn(200))
+					if rnd.Intn(4) == 0 {
+						tr.DeleteStr(k)
+						tr2.DeleteStr(k)
+					} else {
+						v := fmt.Sprintf("v%d", rnd.Intn(5))
+						tr.UpdateStr(k, v)
+						tr2.UpdateStr(k, v)
+					}
+				}
+				root1 = tr.CommitAndContinue(store1)
+				root2 = tr2.Commit(store2)
+				require.True(t, m.EqualCommitments(root1, root2))
+				require.True(t, m.EqualCommitments(root1, tr.Root()))
+			}
+		})
+	}
+}
+
+func TestCommitStats(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160, 1000)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieChained(m, store, root)
+	require.NoError(t, err)
+	require.Nil(t, tr.LastCommitStats())
+
+	tr.EnableCommitStats(true)
+	for i := 0; i < 100; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), strings.Repeat("v", 100))
+	}
+	before := store.Len()
+	tr = tr.CommitChained()
+	stats := tr.LastCommitStats()
+	require.NotNil(t, stats)
+	require.EqualValues(t, store.Len()-before, stats.NewTrieNodes+1) // one value shared by all keys
+	require.EqualValues(t, countKeys(store, immutable.PartitionTrieNodes)-1, stats.NewTrieNodes)
+	require.True(t, stats.BytesWritten[immutable.PartitionValues] > 100)
+	require.True(t, stats.MaxDepth >= 2)
+	require.EqualValues(t, 0, stats.DeletedKeys)
+
+	tr.DeleteStr("key1")
+	tr.DeleteStr("nonexistent")
+	tr.DeletePrefix([]byte("key2"))
+	tr = tr.CommitChained()
+	stats = tr.LastCommitStats()
+	require.EqualValues(t, 1, stats.DeletedKeys)
+	require.EqualValues(t, 1, stats.DeletedPrefixes)
+	require.EqualValues(t, 0, stats.BytesWritten[immutable.PartitionValues])
+}
+
+func TestWriteAmplification(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieChained(m, store, root)
+		require.NoError(t, err)
+		tr.EnableCommitStats(true)
+		logical := 0
+		for round := 0; round < 5; round++ {
+			for i := 0; i < 100; i++ {
+				k, v := fmt.Sprintf("key%d-%d", round, i), "value"
+				tr.UpdateStr(k, v)
+				logical += len(k) + len(v)
+			}
+			tr = tr.CommitChained()
+			stats := tr.LastCommitStats()
+			require.True(t, stats.Amplification() > 1)
+			t.Logf("%s: round %d, amplification %.2f", m.ShortName(), round, stats.Amplification())
+		}
+		a := tr.WriteAmplification()
+		require.EqualValues(t, 5, a.Commits)
+		require.EqualValues(t, logical, a.LogicalBytes)
+		require.True(t, a.Factor() > 1)
+	}
+}
+
+// buffered nodes are reused by the TrieUpdatable after each commit and rollback
+func TestReuseBufferedNodes(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(5))
+			store1 := common.NewInMemoryKVStore()
+			store2 := common.NewInMemoryKVStore()
+			root1 := immutable.MustInitRoot(store1, m, []byte("identity"))
+			root2 := immutable.MustInitRoot(store2, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store1, root1)
+			require.NoError(t, err)
+			for round := 0; round < 4; round++ {
+				for i := 0; i < 1000; i++ {
+					tr.UpdateStr(fmt.Sprintf("%x", rnd.Intn(5000)), "garbage")
+				}
+				tr.Rollback()
+				tr2, err := immutable.NewTrieUpdatable(m, store2, root2)
+				require.NoError(t, err)
+				for i := 0; i < 2000; i++ {
+					k := fmt.Sprintf("%x", rnd.Intn(5000))
+					if rnd.Intn(4) == 0 {
+						tr.DeleteStr(k)
+						tr2.DeleteStr(k)
+					} else {
+						v := fmt.Sprintf("v%d", rnd.Intn(5))
+						tr.UpdateStr(k, v)
+						tr2.UpdateStr(k, v)
+					}
+				}
+				root1 = tr.CommitAndContinue(store1)
+				root2 = tr2.Commit(store2)
+				require.True(t, m.EqualCommitments(root1, root2))
+			}
+		})
+	}
+}
+
+func BenchmarkUpdateAndCommit(b *testing.B) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(b, err)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, k := range keys {
+			tr.UpdateStr(k, fmt.Sprintf("%s-%d", k, i))
+		}
+		tr.CommitAndContinue(store)
+	}
+}
+
+// BenchmarkParallelReaders reads the trie from parallel readers from the store with the single lock and the sharded store
+func BenchmarkParallelReaders(b *testing.B) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	stores := map[string]common.KVStore{
+		"single":  common.NewInMemoryKVStore(),
+		"sharded": common.NewShardedInMemoryKVStore(),
+	}
+	for name, store := range stores {
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(b, err)
+		for _, k := range keys {
+			tr.UpdateStr(k, k)
+		}
+		root = tr.Commit(store)
+
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				r, err := immutable.NewTrieReader(m, store, root, 0)
+				require.NoError(b, err)
+				i := 0
+				for pb.Next() {
+					r.GetStr(keys[i%len(keys)])
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueCompression(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	values := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		values[fmt.Sprintf("json%d", i)] = []byte(fmt.Sprintf(`{"id":%d,"items":[%s]}`, i, strings.Repeat(`{"name":"item","amount":100},`, 20)))
+	}
+	incompressible := make([]byte, 200)
+	rand.New(rand.NewSource(1)).Read(incompressible)
+	values["random"] = incompressible
+
+	commit := func(c immutable.ValueCompression) (*common.InMemoryKVStore, common.VCommitment) {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		tr.EnableValueCompression(c)
+		for k, v := range values {
+			tr.Update([]byte(k), v)
+		}
+		return store, tr.Commit(store)
+	}
+	storeNone, rootNone := commit(immutable.ValueCompressionNone)
+	for _, c := range []immutable.ValueCompression{immutable.ValueCompressionSnappy, immutable.ValueCompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			store, root := commit(c)
+			// commitments are over uncompressed bytes
+			require.True(t, m.EqualCommitments(rootNone, root))
+
+			tr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			for k, v := range values {
+				require.EqualValues(t, v, tr.Get([]byte(k)))
+
+				valueKey := common.AsKey(m.CommitToData(v))
+				compressed := store.Has(common.Concat(immutable.PartitionCompressedValues, valueKey))
+				raw := store.Has(common.Concat(immutable.PartitionValues, valueKey))
+				require.True(t, compressed != raw)
+				require.EqualValues(t, k != "random", compressed)
+			}
+			require.True(t, sizeOfPartitions(store) < sizeOfPartitions(storeNone))
+
+			// snapshot contains uncompressed values
+			snapshot := common.NewInMemoryKVStore()
+			tr.Snapshot(snapshot)
+			snapshot.Iterator([]byte{immutable.PartitionCompressedValues}).IterateKeys(func(_ []byte) bool {
+				t.Fatalf("snapshot must not contain compressed values")
+				return false
+			})
+			trSnapshot, err := immutable.NewTrieReader(m, snapshot, root)
+			require.NoError(t, err)
+			for k, v := range values {
+				require.EqualValues(t, v, trSnapshot.Get([]byte(k)))
+			}
+		})
+	}
+}
+
+func sizeOfPartitions(store common.KVTraversableReader) int {
+	ret := 0
+	store.Iterator(nil).Iterate(func(k, v []byte) bool {
+		ret += len(k) + len(v)
+		return true
+	})
+	return ret
+}
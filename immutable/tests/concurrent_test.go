@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentTrieUpdatable(t *testing.T) {
+	for _, arity := range []common.PathArity{common.PathArity256, common.PathArity16, common.PathArity2} {
+		t.Run(arity.String(), func(t *testing.T) {
+			m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+
+			ctr, err := immutable.NewConcurrentTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 200; i++ {
+						key := fmt.Sprintf("%d/key%d", g, i)
+						ctr.Update([]byte(key), []byte("value"+key))
+						require.EqualValues(t, "value"+key, string(ctr.Get([]byte(key))))
+					}
+					ctr.Delete([]byte(fmt.Sprintf("%d/key0", g)))
+				}(g)
+			}
+			wg.Wait()
+			require.EqualValues(t, 8*200, ctr.Pending())
+			require.False(t, ctr.Has([]byte("0/key0")))
+			require.True(t, m.EqualCommitments(root, ctr.Root()))
+			root1 := ctr.Commit(store)
+			require.EqualValues(t, 0, ctr.Pending())
+			require.True(t, m.EqualCommitments(root1, ctr.Root()))
+
+			// the same updates applied sequentially
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			for g := 0; g < 8; g++ {
+				for i := 1; i < 200; i++ {
+					key := fmt.Sprintf("%d/key%d", g, i)
+					tr.UpdateStr(key, "value"+key)
+				}
+			}
+			require.True(t, m.EqualCommitments(root1, tr.Commit(store)))
+
+			ctr.Update([]byte("0/key1"), []byte("changed"))
+			require.EqualValues(t, "changed", string(ctr.Get([]byte("0/key1"))))
+			ctr.Rollback()
+			require.EqualValues(t, "value0/key1", string(ctr.Get([]byte("0/key1"))))
+			require.True(t, m.EqualCommitments(root1, ctr.Commit(store)))
+		})
+	}
+}
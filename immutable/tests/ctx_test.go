@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterateCtx(t *testing.T) {
+	const numKeys = 1000
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < numKeys; i++ {
+		tr.UpdateStr(fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i))
+	}
+	root = tr.Commit(store)
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+
+	count := 0
+	err = trr.IterateCtx(context.Background(), func(_, _ []byte) bool {
+		count++
+		return true
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, numKeys+1, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	count = 0
+	err = trr.IterateKeysCtx(ctx, func(_ []byte) bool {
+		count++
+		if count == 10 {
+			cancel()
+		}
+		return true
+	})
+	require.True(t, errors.Is(err, context.Canceled))
+	require.True(t, count >= 10 && count < numKeys)
+
+	// cancelled before start
+	err = trr.Iterator([]byte("k1")).(*immutable.TrieIterator).IterateCtx(ctx, func(_, _ []byte) bool {
+		t.Fatalf("must not be called")
+		return true
+	})
+	require.True(t, errors.Is(err, context.Canceled))
+
+	dest := common.NewInMemoryKVStore()
+	err = trr.SnapshotCtx(ctx, dest)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.EqualValues(t, 0, dest.Len())
+
+	err = trr.SnapshotCtx(context.Background(), dest)
+	require.NoError(t, err)
+	trDest, err := immutable.NewTrieReader(m, dest, root)
+	require.NoError(t, err)
+	require.EqualValues(t, "v42", trDest.GetStr("k42"))
+
+	count = 0
+	err = common.IterateCtx(ctx, store.Iterator(nil), func(_, _ []byte) bool {
+		count++
+		return true
+	})
+	require.True(t, errors.Is(err, context.Canceled))
+	require.EqualValues(t, 0, count)
+}
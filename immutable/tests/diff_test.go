@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_mpt"
+	"github.com/stretchr/testify/require"
+)
+
+func naiveDiff(trA, trB *immutable.TrieReader, prefix []byte) map[string][2]string {
+	ret := make(map[string][2]string)
+	trA.Iterator(prefix).Iterate(func(k, v []byte) bool {
+		vB := trB.Get(k)
+		if !bytes.Equal(v, vB) {
+			ret[string(k)] = [2]string{string(v), string(vB)}
+		}
+		return true
+	})
+	trB.Iterator(prefix).Iterate(func(k, v []byte) bool {
+		if !trA.Has(k) {
+			ret[string(k)] = [2]string{"", string(v)}
+		}
+		return true
+	})
+	return ret
+}
+
+func TestDiff(t *testing.T) {
+	runTest := func(m common.CommitmentModel, prefix []byte) {
+		t.Run(m.ShortName()+"-"+string(prefix), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieChained(m, store, root)
+			require.NoError(t, err)
+			for i := 0; i < 300; i++ {
+				tr.UpdateStr(fmt.Sprintf("%x", rnd.Intn(1000)), fmt.Sprintf("v%d", rnd.Intn(5)))
+			}
+			tr = tr.CommitChained()
+			rootA := tr.Root()
+			for i := 0; i < 100; i++ {
+				k := fmt.Sprintf("%x", rnd.Intn(1000))
+				if rnd.Intn(3) == 0 {
+					tr.DeleteStr(k)
+				} else {
+					tr.UpdateStr(k, fmt.Sprintf("v%d", rnd.Intn(5)))
+				}
+			}
+			tr = tr.CommitChained()
+			rootB := tr.Root()
+
+			trA, err := immutable.NewTrieReader(m, store, rootA)
+			require.NoError(t, err)
+			trB, err := immutable.NewTrieReader(m, store, rootB)
+			require.NoError(t, err)
+
+			expected := naiveDiff(trA, trB, prefix)
+			var prevKey []byte
+			count := 0
+			immutable.DiffPrefix(trA, trB, prefix, func(key, valueA, valueB []byte) bool {
+				require.True(t, prevKey == nil || bytes.Compare(prevKey, key) < 0)
+				prevKey = key
+				e, ok := expected[string(key)]
+				require.True(t, ok)
+				require.EqualValues(t, e[0], string(valueA))
+				require.EqualValues(t, e[1], string(valueB))
+				count++
+				return true
+			})
+			require.EqualValues(t, len(expected), count)
+			require.True(t, count > 0)
+
+			immutable.Diff(trA, trA, func(_, _, _ []byte) bool {
+				require.Fail(t, "no differences expected")
+				return true
+			})
+		})
+	}
+	for _, arity := range common.AllPathArity {
+		runTest(trie_blake2b.New(arity, trie_blake2b.HashSize160), nil)
+		runTest(trie_blake2b.New(arity, trie_blake2b.HashSize160), []byte("1"))
+	}
+}
+
+// TestDiffMPT compares many small tries built from a few byte values. In MPT equal subtrees at different positions
+// have equal commitments, so the same keys with the prefix repeated are likely to produce such subtrees
+func TestDiffMPT(t *testing.T) {
+	m := trie_mpt.New()
+	rnd := rand.New(rand.NewSource(1))
+	value := strings.Repeat("v", 40)
+	randomKeys := func() []string {
+		ret := make([]string, rnd.Intn(6)+1)
+		for i := range ret {
+			k := make([]byte, rnd.Intn(4)+1)
+			for j := range k {
+				k[j] = []byte{0x12, 0x34}[rnd.Intn(2)]
+			}
+			ret[i] = string(k)
+		}
+		return ret
+	}
+	for i := 0; i < 5000; i++ {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		roots := make([]common.VCommitment, 2)
+		for j := range roots {
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			for _, k := range randomKeys() {
+				tr.UpdateStr(k, value)
+			}
+			roots[j] = tr.Commit(store)
+		}
+		trA, err := immutable.NewTrieReader(m, store, roots[0])
+		require.NoError(t, err)
+		trB, err := immutable.NewTrieReader(m, store, roots[1])
+		require.NoError(t, err)
+
+		expected := naiveDiff(trA, trB, nil)
+		count := 0
+		immutable.Diff(trA, trB, func(key, valueA, valueB []byte) bool {
+			e, ok := expected[string(key)]
+			require.True(t, ok, "iteration %d, key %x", i, key)
+			require.EqualValues(t, e[0], string(valueA))
+			require.EqualValues(t, e[1], string(valueB))
+			count++
+			return true
+		})
+		require.EqualValues(t, len(expected), count, "iteration %d", i)
+	}
+}
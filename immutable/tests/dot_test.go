@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+func TestWriteDOT(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	// "abc" and "abd" share the path fragment below the node of "a", "b" is a sibling of "a"
+	tr.UpdateStr("a", "short")
+	tr.UpdateStr("abc", strings.Repeat("long value ", 10))
+	tr.UpdateStr("abd", "short")
+	tr.UpdateStr("b", "short")
+	root = tr.Commit(store)
+
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, trr.WriteDOT(&buf))
+
+	const golden = "testdata/trie.dot"
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(golden, buf.Bytes(), 0o644))
+	}
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	require.EqualValues(t, string(expected), buf.String())
+
+	buf.Reset()
+	require.NoError(t, trr.WriteDOT(&buf, 1))
+	require.EqualValues(t, 1, strings.Count(buf.String(), "[label=\"{"))
+}
@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDumpTrie(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	dump := func(keys ...string) string {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		for _, k := range keys {
+			tr.UpdateStr(k, strings.Repeat(k, 30))
+		}
+		root = tr.Commit(store)
+		trr, err := immutable.NewTrieReader(m, store, root)
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, immutable.DumpTrie(trr, &buf))
+		return buf.String()
+	}
+	d1 := dump("a", "ab", "abc", "b")
+	t.Logf("\n%s", d1)
+	require.EqualValues(t, d1, dump("b", "abc", "ab", "a"))
+	require.EqualValues(t, 5, strings.Count(d1, "terminal:"))
+	require.True(t, strings.Contains(d1, `key: "abc" value: "`+strings.Repeat("abc", 30)+`"`))
+	require.NotEqualValues(t, d1, dump("a", "ab", "abc"))
+}
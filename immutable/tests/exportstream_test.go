@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportStream(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), strings.Repeat("v", i+1))
+	}
+	root = tr.Commit(store)
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, trr.ExportStream(common.NewBinaryStreamWriter(&buf)))
+	exported := buf.Bytes()
+
+	var header *common.SnapshotHeader
+	pairs := make([][2][]byte, 0)
+	err = common.NewBinaryStreamIterator(bytes.NewReader(exported)).Iterate(func(k, v []byte) bool {
+		if header == nil {
+			header, err = immutable.ParseStreamHeader(k, v)
+			require.NoError(t, err)
+			return true
+		}
+		pairs = append(pairs, [2][]byte{k, v})
+		return true
+	})
+	require.NoError(t, err)
+	require.True(t, header.Matches(m, root))
+	rootBack, err := header.CheckModel(m)
+	require.NoError(t, err)
+	require.True(t, m.EqualCommitments(root, rootBack))
+
+	_, err = header.CheckModel(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160))
+	require.ErrorIs(t, err, common.ErrSnapshotModelMismatch)
+	_, err = header.CheckModel(trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize256))
+	require.ErrorIs(t, err, common.ErrSnapshotModelMismatch)
+
+	// identity is the first pair, then keys in the order of iteration
+	require.EqualValues(t, 101, len(pairs))
+	require.EqualValues(t, 0, len(pairs[0][0]))
+	require.EqualValues(t, "identity", string(pairs[0][1]))
+	i := 0
+	trr.Iterate(func(k, v []byte) bool {
+		require.True(t, bytes.Equal(k, pairs[i][0]))
+		require.EqualValues(t, v, pairs[i][1])
+		i++
+		return true
+	})
+
+	// the trie built from the stream has the root of the header
+	storeBack := common.NewInMemoryKVStore()
+	trBack, err := immutable.NewTrieUpdatable(m, storeBack, immutable.MustInitRoot(storeBack, m, pairs[0][1]))
+	require.NoError(t, err)
+	for _, p := range pairs[1:] {
+		trBack.Update(p[0], p[1])
+	}
+	require.True(t, m.EqualCommitments(rootBack, trBack.Commit(storeBack)))
+
+	// the export is deterministic
+	var buf2 bytes.Buffer
+	require.NoError(t, trr.ExportStream(common.NewBinaryStreamWriter(&buf2)))
+	require.EqualValues(t, exported, buf2.Bytes())
+
+	_, err = immutable.ParseStreamHeader([]byte("key"), nil)
+	require.ErrorIs(t, err, immutable.ErrStreamHeader)
+}
+
+func TestImportStream(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), strings.Repeat("v", i+1))
+	}
+	root = tr.Commit(store)
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, trr.ExportStream(common.NewBinaryStreamWriter(&buf)))
+	exported := buf.Bytes()
+	stream := func() common.KVStreamIterator {
+		return common.NewBinaryStreamIterator(bytes.NewReader(exported))
+	}
+	newTarget := func(m common.CommitmentModel, identity string) (*immutable.TrieChained, common.KVStore) {
+		s := common.NewInMemoryKVStore()
+		ret, err := immutable.NewTrieChained(m, s, immutable.MustInitRoot(s, m, []byte(identity)))
+		require.NoError(t, err)
+		return ret, s
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		trc, s := newTarget(m, "identity")
+		roots, err := immutable.ImportStream(trc, stream(), 30)
+		require.NoError(t, err)
+		require.EqualValues(t, 4, len(roots))
+		require.True(t, m.EqualCommitments(root, roots[3]))
+		require.True(t, m.EqualCommitments(root, trc.Root()))
+		for _, r := range roots {
+			_, err := immutable.NewTrieReader(m, s, r)
+			require.NoError(t, err)
+		}
+	})
+	t.Run("commit at the end", func(t *testing.T) {
+		trc, _ := newTarget(m, "identity")
+		roots, err := immutable.ImportStream(trc, stream(), 0)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, len(roots))
+		require.True(t, m.EqualCommitments(root, roots[0]))
+	})
+	t.Run("model mismatch", func(t *testing.T) {
+		m2 := trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160)
+		trc, _ := newTarget(m2, "identity")
+		rootBefore := trc.Root()
+		roots, err := immutable.ImportStream(trc, stream(), 30)
+		require.ErrorIs(t, err, common.ErrSnapshotModelMismatch)
+		require.EqualValues(t, 0, len(roots))
+		require.True(t, m2.EqualCommitments(rootBefore, trc.Root()))
+	})
+	t.Run("identity mismatch", func(t *testing.T) {
+		trc, _ := newTarget(m, "other")
+		_, err := immutable.ImportStream(trc, stream(), 30)
+		require.ErrorIs(t, err, immutable.ErrStreamRootMismatch)
+	})
+	t.Run("root mismatch", func(t *testing.T) {
+		trc, _ := newTarget(m, "identity")
+		filtered := common.FilterStream(stream(), func(k, _ []byte) bool {
+			return string(k) != "key50"
+		})
+		roots, err := immutable.ImportStream(trc, filtered, 30)
+		require.ErrorIs(t, err, immutable.ErrStreamRootMismatch)
+		require.EqualValues(t, 4, len(roots))
+	})
+	t.Run("broken stream", func(t *testing.T) {
+		trc, _ := newTarget(m, "identity")
+		roots, err := immutable.ImportStream(trc, common.NewBinaryStreamIterator(bytes.NewReader(exported[:len(exported)/2])), 30)
+		require.Error(t, err)
+		require.True(t, len(roots) > 0)
+		require.True(t, m.EqualCommitments(roots[len(roots)-1], trc.Root()))
+	})
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/lunfardo314/unitrie/models/trie_mpt"
+)
+
+// Fuzz targets of the proof and node parsers and of the update/commit path. Run with, for example:
+//
+//	go test ./immutable/tests -run XXX -fuzz FuzzProofDecode
+
+var fuzzModels = []common.CommitmentModel{
+	trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize256),
+	trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160),
+	trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160),
+	trie_mpt.New(),
+}
+
+func fuzzTrie(m common.CommitmentModel) (*common.InMemoryKVStore, *immutable.TrieReader) {
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	common.AssertNoError(err)
+	for i := 0; i < 20; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	tr.UpdateStr("k", string(bytes.Repeat([]byte("v"), 100)))
+	root = tr.Commit(store)
+	trr, err := immutable.NewTrieReader(m, store, root)
+	common.AssertNoError(err)
+	return store, trr
+}
+
+func FuzzProofDecode(f *testing.F) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	_, trr := fuzzTrie(m)
+	root := trr.Root().Bytes()
+	for _, k := range []string{"", "k", "key1", "key19", "none"} {
+		f.Add(m.ProofImmutable([]byte(k), trr).Bytes())
+	}
+	codecs := []trie_blake2b.ProofCodec{
+		trie_blake2b.ProofCodecBinary,
+		trie_blake2b.ProofCodecRLP,
+		trie_blake2b.ProofCodecCBOR,
+		trie_blake2b.ProofCodecProtobuf,
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, codec := range codecs {
+			p, err := codec.DecodeProof(data)
+			if err != nil {
+				continue
+			}
+			_ = trie_blake2b_verify.Validate(p, root)
+			// the decoded proof must survive re-encoding with any codec
+			for _, c := range codecs {
+				encoded, err := c.EncodeProof(p)
+				if err != nil {
+					t.Fatalf("decoded proof can't be encoded: %v", err)
+				}
+				pBack, err := c.DecodeProof(encoded)
+				if err != nil {
+					t.Fatalf("encoded proof can't be decoded: %v", err)
+				}
+				if !bytes.Equal(p.Bytes(), pBack.Bytes()) {
+					t.Fatalf("proof does not survive re-encoding")
+				}
+			}
+		}
+	})
+}
+
+func FuzzNodeDataDecode(f *testing.F) {
+	for i, m := range fuzzModels {
+		store, _ := fuzzTrie(m)
+		store.Iterator([]byte{immutable.PartitionTrieNodes}).Iterate(func(_, v []byte) bool {
+			f.Add(v, byte(i))
+			return true
+		})
+	}
+	codecs := []common.NodeDataCodec{common.NodeDataCodecRLP, common.NodeDataCodecProtobuf}
+	f.Fuzz(func(t *testing.T, data []byte, modelIndex byte) {
+		m := fuzzModels[int(modelIndex)%len(fuzzModels)]
+		arity := m.PathArity()
+		nodes := make([]*common.NodeData, 0)
+		if n, err := common.NodeDataFromBytes(m, data, arity, func(_ []byte) ([]byte, error) {
+			return []byte("value"), nil
+		}); err == nil {
+			nodes = append(nodes, n)
+		}
+		for _, codec := range codecs {
+			if n, err := codec.DecodeNodeData(data, m, arity); err == nil {
+				nodes = append(nodes, n)
+			}
+		}
+		for _, n := range nodes {
+			encoded, err := common.NodeDataCodecBinary.EncodeNodeData(n, arity)
+			if err != nil {
+				t.Fatalf("decoded node can't be encoded: %v", err)
+			}
+			nBack, err := common.NodeDataCodecBinary.DecodeNodeData(encoded, m, arity)
+			if err != nil {
+				t.Fatalf("encoded node can't be decoded: %v", err)
+			}
+			encodedBack, err := common.NodeDataCodecBinary.EncodeNodeData(nBack, arity)
+			if err != nil || !bytes.Equal(encoded, encodedBack) {
+				t.Fatalf("node does not survive re-encoding")
+			}
+		}
+	})
+}
+
+// FuzzUpdateCommit interprets the data as the sequence of updates and checks the committed state against
+// the map. The state committed in one go must be the same as the state committed in one go from the map
+func FuzzUpdateCommit(f *testing.F) {
+	f.Add([]byte("\x00\x03abc\x02xy\x03abd\x01z\x03abc\x00"), byte(0))
+	f.Add([]byte("\x01a\x01b\x02aa\x01c\x01a\x00\x02ab\x03def"), byte(1))
+	f.Fuzz(func(t *testing.T, data []byte, modelIndex byte) {
+		m := fuzzModels[int(modelIndex)%len(fuzzModels)]
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := make(map[string][]byte)
+		rdr := bytes.NewReader(data)
+		for i := 0; i < 100; i++ {
+			key, err := common.ReadBytes8(rdr)
+			if err != nil {
+				break
+			}
+			value, err := common.ReadBytes8(rdr)
+			if err != nil {
+				break
+			}
+			if len(key) == 0 {
+				continue
+			}
+			tr.Update(key, value)
+			if len(value) == 0 {
+				delete(state, string(key))
+			} else {
+				state[string(key)] = value
+			}
+			if i%10 == 9 {
+				root = tr.Commit(store)
+				if tr, err = immutable.NewTrieUpdatable(m, store, root); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		root = tr.Commit(store)
+		trr, err := immutable.NewTrieReader(m, store, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		num := 0
+		trr.Iterate(func(k, v []byte) bool {
+			if len(k) > 0 {
+				if !bytes.Equal(state[string(k)], v) {
+					t.Fatalf("wrong value of the key '%x'", k)
+				}
+				num++
+			}
+			return true
+		})
+		if num != len(state) {
+			t.Fatalf("expected %d keys, got %d", len(state), num)
+		}
+
+		storeExpected := common.NewInMemoryKVStore()
+		rootExpected := immutable.MustInitRoot(storeExpected, m, []byte("identity"))
+		trExpected, err := immutable.NewTrieUpdatable(m, storeExpected, rootExpected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range state {
+			trExpected.Update([]byte(k), v)
+		}
+		rootExpected = trExpected.Commit(storeExpected)
+		if !m.EqualCommitments(root, rootExpected) {
+			t.Fatalf("root depends on the history of updates")
+		}
+	})
+}
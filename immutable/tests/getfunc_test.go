@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+// copyingReader hides the zero-copy interface of the store
+type copyingReader struct {
+	common.KVReader
+}
+
+func TestGetFunc(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	for _, compression := range []immutable.ValueCompression{immutable.ValueCompressionNone, immutable.ValueCompressionSnappy} {
+		t.Run(compression.String(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			tr.EnableValueCompression(compression)
+			for i := 0; i < 100; i++ {
+				tr.UpdateStr(fmt.Sprintf("k%d", i), strings.Repeat(fmt.Sprintf("v%d", i), i))
+			}
+			root = tr.Commit(store)
+
+			for _, r := range []common.KVReader{store, copyingReader{store}} {
+				trr, err := immutable.NewTrieReader(m, r, root)
+				require.NoError(t, err)
+				for i := 0; i < 100; i++ {
+					key := []byte(fmt.Sprintf("k%d", i))
+					expected := trr.Get(key)
+					found := trr.GetFunc(key, func(value []byte) {
+						require.EqualValues(t, expected, value)
+					})
+					require.EqualValues(t, i > 0, found)
+				}
+				require.False(t, trr.GetFunc([]byte("absent"), func(_ []byte) {
+					t.FailNow()
+				}))
+			}
+		})
+	}
+}
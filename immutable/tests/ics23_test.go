@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestProofICS23(t *testing.T) {
+	const identity = "idididididid"
+	spec := trie_blake2b.ICS23Spec()
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.NewKeccak256(arity)
+		m.SetVectorScheme(trie_blake2b.VectorSchemeICS23)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte(identity))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			values := map[string]string{
+				"a":   "1",
+				"ab":  strings.Repeat("2", 10),
+				"abc": strings.Repeat("3", 100),
+				"b":   strings.Repeat("4", trie_blake2b.MaxInlinedValueSizeDefault),
+			}
+			for i := 0; i < 100; i++ {
+				values[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+			}
+			// the root node with many children
+			for i := 0x80; i < 0x100; i += 3 {
+				values[string([]byte{byte(i)})] = fmt.Sprintf("dense%d", i)
+			}
+			for k, v := range values {
+				tr.UpdateStr(k, v)
+			}
+			root = tr.Commit(store)
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+
+			for k, v := range values {
+				p, err := m.ProofICS23([]byte(k), trr)
+				require.NoError(t, err)
+				require.NoError(t, trie_blake2b_verify.VerifyICS23Membership(spec, root.Bytes(), p, []byte(k), []byte(v)))
+				require.Error(t, trie_blake2b_verify.VerifyICS23Membership(spec, root.Bytes(), p, []byte(k), []byte("wrong")))
+				require.Error(t, trie_blake2b_verify.VerifyICS23NonMembership(spec, root.Bytes(), p, []byte(k)))
+
+				pBack, err := trie_blake2b.ICS23CommitmentProofFromBytes(p.Bytes())
+				require.NoError(t, err)
+				require.EqualValues(t, p.Bytes(), pBack.Bytes())
+				require.NoError(t, trie_blake2b_verify.VerifyICS23Membership(spec, root.Bytes(), pBack, []byte(k), []byte(v)))
+				pBack.Exist.Path[0].Prefix[len(pBack.Exist.Path[0].Prefix)-1] ^= 0x01
+				require.Error(t, trie_blake2b_verify.VerifyICS23Membership(spec, root.Bytes(), pBack, []byte(k), []byte(v)))
+			}
+			for _, k := range []string{"ac", "aa", "abcd", "key1000", "bz", "c", "\x81", "\xff\xff", "\x00"} {
+				p, err := m.ProofICS23([]byte(k), trr)
+				require.NoError(t, err)
+				require.NotNil(t, p.Nonexist)
+				require.NoError(t, trie_blake2b_verify.VerifyICS23NonMembership(spec, root.Bytes(), p, []byte(k)))
+				require.Error(t, trie_blake2b_verify.VerifyICS23Membership(spec, root.Bytes(), p, []byte(k), []byte("1")))
+
+				pBack, err := trie_blake2b.ICS23CommitmentProofFromBytes(p.Bytes())
+				require.NoError(t, err)
+				require.NoError(t, trie_blake2b_verify.VerifyICS23NonMembership(spec, root.Bytes(), pBack, []byte(k)))
+				require.Error(t, trie_blake2b_verify.VerifyICS23NonMembership(spec, root.Bytes(), pBack, []byte("ab")))
+			}
+			t.Run("neighbors must be adjacent", func(t *testing.T) {
+				p, err := m.ProofICS23([]byte("ac"), trr)
+				require.NoError(t, err)
+				// "a" is less than "ac", but not adjacent to it
+				pa, err := m.ProofICS23([]byte("a"), trr)
+				require.NoError(t, err)
+				p.Nonexist.Left = pa.Exist
+				require.Error(t, trie_blake2b_verify.VerifyICS23NonMembership(spec, root.Bytes(), p, []byte("ac")))
+
+				p, err = m.ProofICS23([]byte("\xff\xff"), trr)
+				require.NoError(t, err)
+				require.Nil(t, p.Nonexist.Right)
+				p.Nonexist.Left = pa.Exist
+				require.Error(t, trie_blake2b_verify.VerifyICS23NonMembership(spec, root.Bytes(), p, []byte("\xff\xff")))
+			})
+			t.Run("identity", func(t *testing.T) {
+				_, err := m.ProofICS23(nil, trr)
+				require.ErrorIs(t, err, trie_blake2b.ErrICS23Identity)
+
+				p, err := m.ProofICS23([]byte("\x00"), trr)
+				require.NoError(t, err)
+				require.Nil(t, p.Nonexist.Left)
+
+				rootEmpty := immutable.MustInitRoot(store, m, []byte(identity))
+				trEmpty, err := immutable.NewTrieReader(m, store, rootEmpty)
+				require.NoError(t, err)
+				_, err = m.ProofICS23([]byte("a"), trEmpty)
+				require.ErrorIs(t, err, trie_blake2b.ErrICS23EmptyTrie)
+			})
+			require.Panics(t, func() {
+				m.ProofImmutable([]byte("a"), trr)
+			})
+		})
+	}
+}
+
+// TestICS23Schema decodes ICS-23 proofs and the spec with the descriptor of the ICS-23 protobuf schema
+func TestICS23Schema(t *testing.T) {
+	fd := parseProtoFile(t, "testdata/ics23/proofs.proto")
+	enumName := func(v protoreflect.Value, fd protoreflect.FieldDescriptor) string {
+		return string(fd.Enum().Values().ByNumber(v.Enum()).Name())
+	}
+	field := func(msg protoreflect.Message, name string) (protoreflect.Value, protoreflect.FieldDescriptor) {
+		return protoField(msg, name), msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+	}
+	checkLeaf := func(msg protoreflect.Message) {
+		require.EqualValues(t, "KECCAK256", enumName(field(msg, "hash")))
+		require.EqualValues(t, "NO_HASH", enumName(field(msg, "prehash_key")))
+		require.EqualValues(t, "KECCAK256", enumName(field(msg, "prehash_value")))
+		require.EqualValues(t, "VAR_PROTO", enumName(field(msg, "length")))
+		require.EqualValues(t, []byte{0}, protoField(msg, "prefix").Bytes())
+	}
+	checkExistence := func(msg protoreflect.Message, p *trie_blake2b.ICS23ExistenceProof) {
+		require.EqualValues(t, p.Key, protoField(msg, "key").Bytes())
+		require.EqualValues(t, p.Value, protoField(msg, "value").Bytes())
+		checkLeaf(protoField(msg, "leaf").Message())
+		path := protoField(msg, "path").List()
+		require.EqualValues(t, len(p.Path), path.Len())
+		for i, op := range p.Path {
+			opMsg := path.Get(i).Message()
+			require.EqualValues(t, "KECCAK256", enumName(field(opMsg, "hash")))
+			require.EqualValues(t, op.Prefix, protoField(opMsg, "prefix").Bytes())
+			require.EqualValues(t, op.Suffix, protoField(opMsg, "suffix").Bytes())
+		}
+	}
+
+	t.Run("ProofSpec", func(t *testing.T) {
+		msg := protoRoundTrip(t, fd.Messages().ByName("ProofSpec"), trie_blake2b.ICS23Spec().Bytes())
+		checkLeaf(protoField(msg, "leaf_spec").Message())
+		inner := protoField(msg, "inner_spec").Message()
+		childOrder := protoField(inner, "child_order").List()
+		require.EqualValues(t, 2, childOrder.Len())
+		require.EqualValues(t, 0, childOrder.Get(0).Int())
+		require.EqualValues(t, 1, childOrder.Get(1).Int())
+		require.EqualValues(t, 32, protoField(inner, "child_size").Int())
+		require.EqualValues(t, 1, protoField(inner, "min_prefix_length").Int())
+		require.EqualValues(t, 32, protoField(inner, "max_prefix_length").Int())
+		require.EqualValues(t, make([]byte, 32), protoField(inner, "empty_child").Bytes())
+		require.EqualValues(t, "KECCAK256", enumName(field(inner, "hash")))
+	})
+
+	md := fd.Messages().ByName("CommitmentProof")
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.NewKeccak256(arity)
+		m.SetVectorScheme(trie_blake2b.VectorSchemeICS23)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			for i := 0; i < 50; i++ {
+				tr.UpdateStr(fmt.Sprintf("key%d", i), strings.Repeat(fmt.Sprintf("value%d", i), i))
+			}
+			root = tr.Commit(store)
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+
+			for _, k := range []string{"key0", "key1", "key49", "a", "key100", "zzz"} {
+				p, err := m.ProofICS23([]byte(k), trr)
+				require.NoError(t, err)
+				msg := protoRoundTrip(t, md, p.Bytes())
+				if p.Exist != nil {
+					checkExistence(protoField(msg, "exist").Message(), p.Exist)
+					continue
+				}
+				nonexist := protoField(msg, "nonexist").Message()
+				require.EqualValues(t, p.Nonexist.Key, protoField(nonexist, "key").Bytes())
+				left, leftFd := field(nonexist, "left")
+				require.EqualValues(t, p.Nonexist.Left != nil, nonexist.Has(leftFd))
+				if p.Nonexist.Left != nil {
+					checkExistence(left.Message(), p.Nonexist.Left)
+				}
+				right, rightFd := field(nonexist, "right")
+				require.EqualValues(t, p.Nonexist.Right != nil, nonexist.Has(rightFd))
+				if p.Nonexist.Right != nil {
+					checkExistence(right.Message(), p.Nonexist.Right)
+				}
+			}
+		})
+	}
+}
@@ -193,6 +193,7 @@ func TestCreateTrie(t *testing.T) {
 	runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256))
 	runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160))
 	runTest(trie_kzg_bn256.New())
+	runTest(trie_kzg_bn256.NewV2())
 }
 
 func TestBaseUpdate(t *testing.T) {
@@ -236,6 +237,7 @@ func TestBaseUpdate(t *testing.T) {
 	runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data)
 	runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data)
 	runTest(trie_kzg_bn256.New(), data)
+	runTest(trie_kzg_bn256.NewV2(), data)
 }
 
 var traceScenarios = false
@@ -358,6 +360,7 @@ func TestBaseScenarios(t *testing.T) {
 	t.Run("9", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data1))
 	t.Run("10", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data1))
 	t.Run("11", tf(trie_kzg_bn256.New(), data1))
+	t.Run("11-v2", tf(trie_kzg_bn256.NewV2(), data1))
 
 	t.Run("12", tf(trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize256), []string{"a", "ab", "-a"}))
 
@@ -374,6 +377,7 @@ func TestBaseScenarios(t *testing.T) {
 	t.Run("19", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data2))
 	t.Run("20", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data2))
 	t.Run("21", tf(trie_kzg_bn256.New(), data2))
+	t.Run("21-v2", tf(trie_kzg_bn256.NewV2(), data2))
 
 	data3 := []string{"a", "ab", "abc", "abcd", "abcde", "-abcde", "-abcd", "-abc", "-ab", "-a"}
 	t.Run("14", tf(trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize256), data3))
@@ -384,6 +388,7 @@ func TestBaseScenarios(t *testing.T) {
 	t.Run("19", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data3))
 	t.Run("20", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data3))
 	t.Run("21", tf(trie_kzg_bn256.New(), data3))
+	t.Run("21-v2", tf(trie_kzg_bn256.NewV2(), data3))
 
 	data4 := genRnd3()
 	name := "update-many-"
@@ -394,6 +399,7 @@ func TestBaseScenarios(t *testing.T) {
 	t.Run(name+"5", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data4))
 	t.Run(name+"6", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data4))
 	t.Run(name+"7", tf(trie_kzg_bn256.New(), data3))
+	t.Run(name+"7-v2", tf(trie_kzg_bn256.NewV2(), data3))
 
 	traceScenarios = true
 	data5 := []string{"0", "1/0", "\x10/0"}
@@ -405,6 +411,7 @@ func TestBaseScenarios(t *testing.T) {
 	t.Run(name+"5", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data5))
 	t.Run(name+"6", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data5))
 	t.Run(name+"7", tf(trie_kzg_bn256.New(), data3))
+	t.Run(name+"7-v2", tf(trie_kzg_bn256.NewV2(), data3))
 }
 
 func TestDeletionLoop(t *testing.T) {
@@ -430,6 +437,7 @@ func TestDeletionLoop(t *testing.T) {
 		traceScenarios = false
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), init, sc)
 		runTest(trie_kzg_bn256.New(), init, sc)
+		runTest(trie_kzg_bn256.NewV2(), init, sc)
 	}
 	runAll([]string{"a"}, []string{"1", "*", "1/"})
 	runAll([]string{"a", "ab", "abc"}, []string{"ac", "*", "ac/"})
@@ -487,6 +495,7 @@ func TestDeterminism(t *testing.T) {
 		t.Run(name+"6", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), s1, s2))
 		t.Run(name+"7", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), s1, s2))
 		t.Run(name+"8", tf(trie_kzg_bn256.New(), s1, s2))
+		t.Run(name+"8-v2", tf(trie_kzg_bn256.NewV2(), s1, s2))
 	}
 	{
 		s1 := genRnd3()[:50]
@@ -500,6 +509,7 @@ func TestDeterminism(t *testing.T) {
 		t.Run(name+"6", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), s1, s2))
 		t.Run(name+"7", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), s1, s2))
 		t.Run(name+"8", tf(trie_kzg_bn256.New(), s1, s2))
+		t.Run(name+"8-v2", tf(trie_kzg_bn256.NewV2(), s1, s2))
 	}
 	{
 		s1 := []string{"a", "ab"}
@@ -513,6 +523,25 @@ func TestDeterminism(t *testing.T) {
 		t.Run(name+"6", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), s1, s2))
 		t.Run(name+"7", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), s1, s2))
 		t.Run(name+"kzg", tf(trie_kzg_bn256.New(), s1, s2)) // failing because of KZG commitment model cryptography bug
+		t.Run(name+"kzg-v2", tf(trie_kzg_bn256.NewV2(), s1, s2))
+	}
+	{
+		// the node is split or merged after it was committed. The original KZG model fails these
+		for i, sc := range [][2][]string{
+			{{"abc", "abd"}, {"abc", "*", "abd"}},
+			{{"abcd", "ab"}, {"abcd", "*", "ab"}},
+			{{"abc", "x"}, {"abc", "abd", "*", "x", "abd/"}},
+		} {
+			s1, s2 := sc[0], sc[1]
+			name := fmt.Sprintf("commit-split-%d-", i)
+			t.Run(name+"1", tf(trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize256), s1, s2))
+			t.Run(name+"2", tf(trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize160), s1, s2))
+			t.Run(name+"3", tf(trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize256), s1, s2))
+			t.Run(name+"4", tf(trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160), s1, s2))
+			t.Run(name+"5", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), s1, s2))
+			t.Run(name+"6", tf(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), s1, s2))
+			t.Run(name+"kzg-v2", tf(trie_kzg_bn256.NewV2(), s1, s2))
+		}
 	}
 }
 
@@ -569,6 +598,7 @@ func TestIterate(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario))
 	}
 	{
 		name := "iterate-"
@@ -580,6 +610,7 @@ func TestIterate(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario))
 	}
 	{
 		name := "iterate-big-"
@@ -591,6 +622,7 @@ func TestIterate(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario))
 	}
 }
 
@@ -644,6 +676,7 @@ func TestIteratePrefix(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario, prefix))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario, prefix))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario, prefix))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario, prefix))
 	}
 	{
 		name := "iterate-a"
@@ -656,6 +689,7 @@ func TestIteratePrefix(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario, prefix))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario, prefix))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario, prefix))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario, prefix))
 	}
 	{
 		name := "iterate-empty"
@@ -668,6 +702,7 @@ func TestIteratePrefix(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario, prefix))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario, prefix))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario, prefix))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario, prefix))
 	}
 	{
 		name := "iterate-none"
@@ -680,6 +715,7 @@ func TestIteratePrefix(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario, prefix))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario, prefix))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario, prefix))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario, prefix))
 	}
 }
 
@@ -725,6 +761,7 @@ func TestDeletePrefix(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario, prefix))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario, prefix))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario, prefix))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario, prefix))
 	}
 	{
 		name := "delete-a"
@@ -737,6 +774,7 @@ func TestDeletePrefix(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario, prefix))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario, prefix))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario, prefix))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario, prefix))
 	}
 	{
 		name := "delete-root"
@@ -749,6 +787,7 @@ func TestDeletePrefix(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario, prefix))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario, prefix))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario, prefix))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario, prefix))
 	}
 	{
 		name := "delete-none"
@@ -761,6 +800,7 @@ func TestDeletePrefix(t *testing.T) {
 		t.Run(name+"5", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), scenario, prefix))
 		t.Run(name+"6", iterTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), scenario, prefix))
 		t.Run(name+"7", iterTest(trie_kzg_bn256.New(), scenario, prefix))
+		t.Run(name+"7-v2", iterTest(trie_kzg_bn256.NewV2(), scenario, prefix))
 	}
 }
 
@@ -800,6 +840,7 @@ func TestHasWithPrefix(t *testing.T) {
 	runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256))
 	runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160))
 	runTest(trie_kzg_bn256.New())
+	runTest(trie_kzg_bn256.NewV2())
 }
 
 const letters = "abcdefghijklmnop"
@@ -870,6 +911,7 @@ func TestSnapshot1(t *testing.T) {
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data)
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data)
 		runTest(trie_kzg_bn256.New(), data)
+		runTest(trie_kzg_bn256.NewV2(), data)
 	}
 	{
 		data := genRnd3()
@@ -880,6 +922,7 @@ func TestSnapshot1(t *testing.T) {
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data)
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data)
 		runTest(trie_kzg_bn256.New(), data)
+		runTest(trie_kzg_bn256.NewV2(), data)
 	}
 }
 
@@ -917,6 +960,7 @@ func TestSnapshot2(t *testing.T) {
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data)
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data)
 		runTest(trie_kzg_bn256.New(), data)
+		runTest(trie_kzg_bn256.NewV2(), data)
 	}
 	{
 		data := genRnd3()
@@ -927,6 +971,7 @@ func TestSnapshot2(t *testing.T) {
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256), data)
 		runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160), data)
 		runTest(trie_kzg_bn256.New(), data)
+		runTest(trie_kzg_bn256.NewV2(), data)
 	}
 }
 
@@ -954,4 +999,77 @@ func TestDontChangeIdentity(t *testing.T) {
 	runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256))
 	runTest(trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160))
 	runTest(trie_kzg_bn256.New())
+	runTest(trie_kzg_bn256.NewV2())
+}
+
+// nodesOnlyReader panics if anything except trie nodes is read from the store
+type nodesOnlyReader struct {
+	common.KVReader
+}
+
+func (r nodesOnlyReader) Get(key []byte) []byte {
+	if len(key) == 0 || key[0] != immutable.PartitionTrieNodes {
+		panic(fmt.Sprintf("unexpected read outside of the node partition: '%x'", key))
+	}
+	return r.KVReader.Get(key)
+}
+
+func (r nodesOnlyReader) Has(key []byte) bool {
+	return len(r.Get(key)) > 0
+}
+
+func TestIterateKeysNoValues(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			tr.EnableValueCompression(immutable.ValueCompressionSnappy)
+			expected := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				k := fmt.Sprintf("k%d", i)
+				tr.UpdateStr(k, strings.Repeat(k, 50))
+				expected[k] = true
+			}
+			root = tr.Commit(store)
+
+			trr, err := immutable.NewTrieReader(m, nodesOnlyReader{store}, root)
+			require.NoError(t, err)
+			keys := make(map[string]bool)
+			trr.IterateKeys(func(k []byte) bool {
+				keys[string(k)] = true
+				return true
+			})
+			require.EqualValues(t, len(expected)+1, len(keys)) // + identity
+			for k := range expected {
+				require.True(t, keys[k])
+			}
+			count := 0
+			trr.Iterator([]byte("k1")).IterateKeys(func(_ []byte) bool {
+				count++
+				return true
+			})
+			require.EqualValues(t, 11, count)
+			require.True(t, trr.Has([]byte("k42")))
+			require.True(t, common.HasWithPrefix(trr, []byte("k9")))
+
+			typed := immutable.NewTypedTrieReader(trr, immutable.Codec[string]{
+				Encode: func(s string) []byte { return []byte(s) },
+				Decode: func(b []byte) (string, error) { return string(b), nil },
+			}, immutable.Codec[string]{})
+			count = 0
+			err = typed.IterateKeysPrefix([]byte("k2"), func(k string) bool {
+				require.True(t, expected[k])
+				count++
+				return true
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, 11, count)
+			require.Panics(t, func() {
+				trr.Get([]byte("k42"))
+			})
+		})
+	}
 }
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_mpt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyIntegrity(t *testing.T) {
+	models := []common.CommitmentModel{
+		trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize256),
+		trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160),
+		trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160),
+		trie_mpt.New(),
+	}
+	for _, m := range models {
+		t.Run(m.ShortName(), func(t *testing.T) {
+			initStore := func() (*common.InMemoryKVStore, common.VCommitment) {
+				store := common.NewInMemoryKVStore()
+				root := immutable.MustInitRoot(store, m, []byte("identity"))
+				tr, err := immutable.NewTrieUpdatable(m, store, root)
+				require.NoError(t, err)
+				for i := 0; i < 100; i++ {
+					tr.UpdateStr(fmt.Sprintf("key%d", i), strings.Repeat(fmt.Sprintf("value%d", i), 10))
+				}
+				return store, tr.Commit(store)
+			}
+			store, root := initStore()
+			require.NoError(t, immutable.VerifyIntegrity(store, m, root))
+
+			// the node with children is modified consistently with the format
+			store, root = initStore()
+			var nodeKey, nodeData []byte
+			store.Iterator([]byte{immutable.PartitionTrieNodes}).Iterate(func(k, v []byte) bool {
+				n, err := common.NodeDataFromBytes(m, v, m.PathArity(), nil)
+				require.NoError(t, err)
+				if len(n.ChildCommitments) == 0 {
+					return true
+				}
+				for i, c := range n.ChildCommitments {
+					delete(n.ChildCommitments, i)
+					n.ChildCommitments[byte((int(i)+1)%m.PathArity().NumChildren())] = c
+					break
+				}
+				nodeKey = common.Concat(k)
+				nodeData, err = common.NodeDataCodecBinary.EncodeNodeData(n, m.PathArity())
+				require.NoError(t, err)
+				return false
+			})
+			require.NotNil(t, nodeKey)
+			store.Set(nodeKey, nodeData)
+			require.True(t, errors.Is(immutable.VerifyIntegrity(store, m, root), immutable.ErrIntegrityViolated))
+
+			// the child of the root is missing
+			store, root = initStore()
+			rootNode, err := common.NodeDataFromBytes(m, store.Get(common.Concat(immutable.PartitionTrieNodes, common.AsKey(root))), m.PathArity(), nil)
+			require.NoError(t, err)
+			rootNode.IterateChildren(func(_ byte, c common.VCommitment) bool {
+				store.Set(common.Concat(immutable.PartitionTrieNodes, common.AsKey(c)), nil)
+				return false
+			})
+			require.True(t, errors.Is(immutable.VerifyIntegrity(store, m, root), immutable.ErrIntegrityViolated))
+
+			// the value is corrupted
+			store, root = initStore()
+			var valueKey, value []byte
+			store.Iterator([]byte{immutable.PartitionValues}).Iterate(func(k, v []byte) bool {
+				valueKey, value = common.Concat(k), common.Concat(v)
+				return false
+			})
+			if valueKey == nil {
+				// the model keeps all values in the nodes
+				return
+			}
+			value[0]++
+			store.Set(valueKey, value)
+			require.True(t, errors.Is(immutable.VerifyIntegrity(store, m, root), immutable.ErrIntegrityViolated))
+		})
+	}
+}
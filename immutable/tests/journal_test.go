@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	newTrie := func() (*common.InMemoryKVStore, *immutable.TrieUpdatable) {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		return store, tr
+	}
+	store, tr := newTrie()
+	var journal bytes.Buffer
+	rec := immutable.NewRecorder(tr, &journal)
+	for i := 0; i < 100; i++ {
+		rec.Update([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	rec.CommitAndContinue(store)
+	for i := 0; i < 10; i++ {
+		rec.Delete([]byte(fmt.Sprintf("key%d", i)))
+		rec.Update([]byte(fmt.Sprintf("key%d", i+10)), nil)
+	}
+	root := rec.Commit(store)
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	rec.SetTrie(tr)
+	rec.Update([]byte("uncommitted"), []byte("value"))
+	require.NoError(t, rec.Err())
+
+	data := journal.Bytes()
+	storeReplay, trReplay := newTrie()
+	stats, err := immutable.Replay(bytes.NewReader(data), trReplay, storeReplay, true)
+	require.NoError(t, err)
+	require.EqualValues(t, 101, stats.NumUpdates)
+	require.EqualValues(t, 20, stats.NumDeletes)
+	require.EqualValues(t, 2, stats.NumCommits)
+	require.True(t, m.EqualCommitments(root, stats.Root))
+	require.True(t, stats.Recorded >= 0)
+
+	// replay on the trie with another state fails on the first commit
+	storeOther, trOther := newTrie()
+	trOther.UpdateStr("other", "other")
+	_, err = immutable.Replay(bytes.NewReader(data), trOther, storeOther, true)
+	require.True(t, errors.Is(err, immutable.ErrReplayRootMismatch))
+
+	// truncated journal
+	storeReplay, trReplay = newTrie()
+	_, err = immutable.Replay(bytes.NewReader(data[:len(data)-1]), trReplay, storeReplay, true)
+	require.True(t, errors.Is(err, immutable.ErrJournalWrongRecord))
+}
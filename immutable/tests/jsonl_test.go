@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONL(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), strings.Repeat("v", i+1))
+	}
+	root = tr.Commit(store)
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, immutable.ExportJSONL(trr, &buf))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.EqualValues(t, 100, len(lines))
+	require.EqualValues(t, `{"key":"6b657930","value":"76"}`, lines[0])
+
+	storeBack := common.NewInMemoryKVStore()
+	rootBack := immutable.MustInitRoot(storeBack, m, []byte("identity"))
+	trBack, err := immutable.NewTrieUpdatable(m, storeBack, rootBack)
+	require.NoError(t, err)
+	num, err := immutable.ImportJSONL(&buf, trBack)
+	require.NoError(t, err)
+	require.EqualValues(t, 100, num)
+	rootBack = trBack.Commit(storeBack)
+	require.True(t, m.EqualCommitments(root, rootBack))
+
+	// empty value deletes
+	trBack, err = immutable.NewTrieUpdatable(m, storeBack, rootBack)
+	require.NoError(t, err)
+	num, err = immutable.ImportJSONL(strings.NewReader(`{"key":"6b657930","value":""}`+"\n"), trBack)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, num)
+	rootBack = trBack.Commit(storeBack)
+	trr, err = immutable.NewTrieReader(m, storeBack, rootBack)
+	require.NoError(t, err)
+	require.False(t, trr.HasStr("key0"))
+	require.True(t, trr.HasStr("key1"))
+
+	trBack, err = immutable.NewTrieUpdatable(m, storeBack, rootBack)
+	require.NoError(t, err)
+
+	for _, wrong := range []string{
+		`{"key":"","value":"00"}`,
+		`{"key":"zz","value":"00"}`,
+		`{"key":"00","value":"0"}`,
+		`{"key":"00","value":"00","other":1}`,
+		`{"key":"00",`,
+	} {
+		_, err = immutable.ImportJSONL(strings.NewReader(wrong), trBack)
+		require.True(t, errors.Is(err, immutable.ErrJSONLWrongRecord), wrong)
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyFilter(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	const numKeys = 2000
+	for i := 0; i < numKeys; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	root = tr.Commit(store)
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+
+	f := trr.KeyFilter(0.01)
+	check := func(t *testing.T, f *common.BloomFilter) {
+		// no false negatives, including the identity under the empty key
+		trr.IterateKeys(func(k []byte) bool {
+			require.True(t, f.MayContain(k))
+			return true
+		})
+		require.True(t, f.MayContain(nil))
+		falsePositives := 0
+		for i := 0; i < numKeys; i++ {
+			if f.MayContain([]byte(fmt.Sprintf("absent%d", i))) {
+				falsePositives++
+			}
+		}
+		require.True(t, falsePositives < numKeys/20)
+	}
+	check(t, f)
+
+	var buf bytes.Buffer
+	require.NoError(t, f.Write(&buf))
+	f1 := &common.BloomFilter{}
+	require.NoError(t, f1.Read(&buf))
+	require.EqualValues(t, f.Bytes(), f1.Bytes())
+	check(t, f1)
+
+	f2, err := common.BloomFilterFromBytes(f.Bytes())
+	require.NoError(t, err)
+	require.EqualValues(t, f.NumBits(), f2.NumBits())
+	require.EqualValues(t, f.NumHashes(), f2.NumHashes())
+	check(t, f2)
+
+	// the trie with only the identity
+	emptyStore := common.NewInMemoryKVStore()
+	trr, err = immutable.NewTrieReader(m, emptyStore, immutable.MustInitRoot(emptyStore, m, []byte("identity")))
+	require.NoError(t, err)
+	f = trr.KeyFilter(0.01)
+	require.True(t, f.MayContain(nil))
+	require.False(t, f.MayContain([]byte("key1")))
+}
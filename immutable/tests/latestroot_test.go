@@ -0,0 +1,52 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestRoot(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	lr, err := immutable.ReadLatestRoot(m, store)
+	require.NoError(t, err)
+	require.Nil(t, lr)
+
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	var last *immutable.LatestRoot
+	for i := 0; i < 5; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		last, err = immutable.CommitLatestRoot(tr, store)
+		require.NoError(t, err)
+		require.EqualValues(t, i+1, last.Seq)
+	}
+
+	// restart
+	lr, err = immutable.ReadLatestRoot(m, store)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, lr.Seq)
+	require.True(t, m.EqualCommitments(last.Root, lr.Root))
+	trr, err := immutable.NewTrieReader(m, store, lr.Root)
+	require.NoError(t, err)
+	require.EqualValues(t, "value4", string(trr.Get([]byte("key4"))))
+
+	// the record is written by the application in its own batch
+	tr, err = immutable.NewTrieUpdatable(m, store, lr.Root)
+	require.NoError(t, err)
+	tr.UpdateStr("key", "value")
+	batch := store.BatchedWriter()
+	newRoot := tr.Commit(batch)
+	immutable.WriteLatestRoot(batch, newRoot, 100)
+	require.NoError(t, batch.Commit())
+	lr, err = immutable.ReadLatestRoot(m, store)
+	require.NoError(t, err)
+	require.EqualValues(t, 100, lr.Seq)
+	require.True(t, m.EqualCommitments(newRoot, lr.Root))
+}
@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160, 1000)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	metrics := common.NewInMemoryMetrics()
+
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	tr.SetMetrics(metrics)
+	tr.EnableCommitStats(true)
+	for i := 0; i < 100; i++ {
+		tr.UpdateStr(fmt.Sprintf("k%d", i), strings.Repeat("v", 100))
+	}
+	root = tr.Commit(store)
+	require.EqualValues(t, tr.LastCommitStats().NewTrieNodes, metrics.Counter(common.MetricNodesWritten))
+	h, ok := metrics.Histogram(common.MetricCommitDuration)
+	require.True(t, ok)
+	require.EqualValues(t, 1, h.Count)
+
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	trr.SetMetrics(metrics)
+	nodeGets := metrics.Counter(common.MetricNodeGets)
+	require.EqualValues(t, strings.Repeat("v", 100), trr.GetStr("k42"))
+	require.True(t, metrics.Counter(common.MetricNodeGets) > nodeGets)
+	require.EqualValues(t, 1, metrics.Counter(common.MetricValueGets))
+
+	trr.SetMetrics(nil)
+	trr.GetStr("k42")
+	require.EqualValues(t, 1, metrics.Counter(common.MetricValueGets))
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func buildTrieForMigration(t *testing.T, m common.CommitmentModel, store common.KVStore, n int) common.VCommitment {
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	return tr.Commit(store)
+}
+
+func TestMigrate(t *testing.T) {
+	const numKeys = 1000
+	srcModel := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	dstModel := trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize256)
+
+	srcStore := common.NewInMemoryKVStore()
+	srcRoot := buildTrieForMigration(t, srcModel, srcStore, numKeys)
+	expectedRoot := buildTrieForMigration(t, dstModel, common.NewInMemoryKVStore(), numKeys)
+
+	src, err := immutable.NewTrieReader(srcModel, srcStore, srcRoot)
+	require.NoError(t, err)
+
+	t.Run("complete", func(t *testing.T) {
+		dstStore := common.NewInMemoryKVStore()
+		batches := 0
+		root, err := immutable.Migrate(src, dstStore, dstModel, 100, immutable.MigrationOptions{
+			OnProgress: func(p *immutable.MigrationProgress) {
+				batches++
+			},
+		})
+		require.NoError(t, err)
+		require.True(t, dstModel.EqualCommitments(expectedRoot, root))
+		require.EqualValues(t, numKeys/100+1, batches)
+
+		p, err := immutable.ReadMigrationProgress(srcModel, dstModel, dstStore)
+		require.NoError(t, err)
+		require.Nil(t, p)
+
+		tr, err := immutable.NewTrieReader(dstModel, dstStore, root)
+		require.NoError(t, err)
+		require.EqualValues(t, "identity", tr.GetStr(""))
+		require.EqualValues(t, "value42", tr.GetStr("key42"))
+	})
+	t.Run("resume", func(t *testing.T) {
+		dstStore := common.NewInMemoryKVStore()
+		errInterrupted := errors.New("interrupted")
+		_, err := immutable.Migrate(src, dstStore, dstModel, 100, immutable.MigrationOptions{
+			OnProgress: func(p *immutable.MigrationProgress) {
+				if p.Keys >= 300 {
+					panic(errInterrupted)
+				}
+			},
+		})
+		require.ErrorIs(t, err, errInterrupted)
+
+		p, err := immutable.ReadMigrationProgress(srcModel, dstModel, dstStore)
+		require.NoError(t, err)
+		require.NotNil(t, p)
+		require.EqualValues(t, 300, p.Keys)
+
+		var resumedFrom uint32
+		root, err := immutable.Migrate(src, dstStore, dstModel, 100, immutable.MigrationOptions{
+			OnProgress: func(p *immutable.MigrationProgress) {
+				if resumedFrom == 0 {
+					resumedFrom = p.Keys
+				}
+			},
+		})
+		require.NoError(t, err)
+		require.EqualValues(t, 400, resumedFrom)
+		require.True(t, dstModel.EqualCommitments(expectedRoot, root))
+	})
+	t.Run("source mismatch", func(t *testing.T) {
+		dstStore := common.NewInMemoryKVStore()
+		_, err := immutable.Migrate(src, dstStore, dstModel, 100, immutable.MigrationOptions{
+			OnProgress: func(p *immutable.MigrationProgress) {
+				panic("interrupted")
+			},
+		})
+		require.Error(t, err)
+
+		otherStore := common.NewInMemoryKVStore()
+		otherRoot := buildTrieForMigration(t, srcModel, otherStore, 10)
+		other, err := immutable.NewTrieReader(srcModel, otherStore, otherRoot)
+		require.NoError(t, err)
+		_, err = immutable.Migrate(other, dstStore, dstModel, 100)
+		require.ErrorIs(t, err, immutable.ErrMigrationSourceMismatch)
+	})
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_mpt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMPTKnownRoots(t *testing.T) {
+	// roots of the Ethereum MPT, from the Ethereum tests and the go-ethereum trie tests
+	tests := []struct {
+		name string
+		kvs  [][2]string
+		root string
+	}{
+		{"empty", nil, "56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"},
+		{"single", [][2]string{{"A", strings.Repeat("a", 50)}}, "d23786fb4a010da3ce639d66d5e904a11dbc02746d1ce25029e53290cabf28ab"},
+		{"puppy", [][2]string{{"do", "verb"}, {"horse", "stallion"}, {"doge", "coin"}, {"dog", "puppy"}}, "5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84"},
+		{"insert", [][2]string{{"doe", "reindeer"}, {"dog", "puppy"}, {"dogglesworth", "cat"}}, "8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3"},
+	}
+	m := trie_mpt.New()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			for _, kv := range tc.kvs {
+				tr.UpdateStr(kv[0], kv[1])
+			}
+			root = tr.Commit(store)
+			require.EqualValues(t, tc.root, hex.EncodeToString(trie_mpt.RootHash(root)))
+			require.EqualValues(t, tc.root, root.String())
+
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			for _, kv := range tc.kvs {
+				require.EqualValues(t, kv[1], string(trr.Get([]byte(kv[0]))))
+			}
+		})
+	}
+}
+
+func TestMPTUpdateAndDelete(t *testing.T) {
+	const numAccounts = 300
+	m := trie_mpt.New()
+	key := func(i int) []byte {
+		return trie_mpt.HashKey([]byte(fmt.Sprintf("address%d", i)))
+	}
+	value := func(i int) []byte {
+		return trie_mpt.EncodeAccount(uint64(i), big.NewInt(int64(i)*1000), nil, nil)
+	}
+	commitAll := func(order []int, deleteFrom int) common.VCommitment {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		for _, i := range order {
+			tr.Update(key(i), value(i))
+		}
+		root = tr.CommitAndContinue(store)
+		for _, i := range order {
+			if i >= deleteFrom {
+				tr.Delete(key(i))
+			}
+		}
+		return tr.Commit(store)
+	}
+	order := rand.Perm(numAccounts)
+	// commitment does not depend on the order of updates
+	root1 := commitAll(order, numAccounts)
+	root2 := commitAll(rand.Perm(numAccounts), numAccounts)
+	require.True(t, m.EqualCommitments(root1, root2))
+
+	// deleting keys results in the root of the trie without them, down to the empty and single key trie
+	for _, n := range []int{numAccounts / 2, 1, 0} {
+		rootDeleted := commitAll(order, n)
+		rootFresh := commitAll(rand.Perm(n), n)
+		require.EqualValues(t, hex.EncodeToString(trie_mpt.RootHash(rootFresh)), hex.EncodeToString(trie_mpt.RootHash(rootDeleted)))
+	}
+	require.EqualValues(t, trie_mpt.EmptyRootHash, trie_mpt.RootHash(commitAll(order, 0)))
+
+	// roots of different identities are different commitments with the same MPT root
+	store := common.NewInMemoryKVStore()
+	rootA := immutable.MustInitRoot(store, m, []byte("A"))
+	rootB := immutable.MustInitRoot(store, m, []byte("B"))
+	require.False(t, m.EqualCommitments(rootA, rootB))
+	require.EqualValues(t, trie_mpt.RootHash(rootA), trie_mpt.RootHash(rootB))
+}
+
+func TestMPTStorageValue(t *testing.T) {
+	require.Nil(t, trie_mpt.EncodeStorageValue(make([]byte, 32)))
+	word := make([]byte, 32)
+	word[31] = 0x01
+	require.EqualValues(t, []byte{0x01}, trie_mpt.EncodeStorageValue(word))
+	word[30] = 0x80
+	require.EqualValues(t, []byte{0x82, 0x80, 0x01}, trie_mpt.EncodeStorageValue(word))
+}
+
+func TestMPTCommitMutationsSharedNodes(t *testing.T) {
+	m := trie_mpt.New()
+	require.False(t, common.CommitmentsDependOnPosition(m))
+	k1, k2 := []byte{0x11, 0x22}, []byte{0x12, 0x22}
+	for _, tc := range []struct {
+		name  string
+		value []byte
+	}{
+		{"inline refs", []byte("v")},
+		{"hashed refs", []byte(strings.Repeat("long value ", 10))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			// leaves of both keys have the same remaining path and value, i.e. the same commitment
+			tr.Update(k1, tc.value)
+			tr.Update(k2, tc.value)
+			root = tr.Commit(store)
+
+			tr, err = immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			tr.Update(k1, []byte("changed"))
+			root1, mut := tr.CommitMutations()
+			mut.WriteTo(store)
+
+			trr, err := immutable.NewTrieReader(m, store, root1)
+			require.NoError(t, err)
+			require.EqualValues(t, "changed", string(trr.Get(k1)))
+			require.EqualValues(t, tc.value, trr.Get(k2))
+			// nodes are not deleted, so the previous root remains readable
+			trr, err = immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			require.EqualValues(t, tc.value, trr.Get(k1))
+			require.EqualValues(t, tc.value, trr.Get(k2))
+		})
+	}
+}
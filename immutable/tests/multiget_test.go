@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+// multiGetStore counts round trips to the store
+type multiGetStore struct {
+	common.KVReader
+	gets, multiGets int
+}
+
+func (s *multiGetStore) Get(key []byte) []byte {
+	s.gets++
+	return s.KVReader.Get(key)
+}
+
+func (s *multiGetStore) GetMany(keys [][]byte) [][]byte {
+	s.multiGets++
+	ret := make([][]byte, len(keys))
+	for i, k := range keys {
+		ret[i] = s.KVReader.Get(k)
+	}
+	return ret
+}
+
+func TestGetMany(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160, 1000)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			for i := 0; i < 500; i++ {
+				k := fmt.Sprintf("%x", rnd.Intn(10000))
+				if i%2 == 0 {
+					tr.UpdateStr(k, strings.Repeat(k, 30))
+				} else {
+					tr.UpdateStr(k, k)
+				}
+			}
+			root = tr.Commit(store)
+
+			keys := make([][]byte, 0)
+			for i := 0; i < 300; i++ {
+				keys = append(keys, []byte(fmt.Sprintf("%x", rnd.Intn(10000))))
+			}
+			keys = append(keys, keys[0], nil, []byte("a"))
+
+			s := &multiGetStore{KVReader: store}
+			trr, err := immutable.NewTrieReader(m, s, root, 0)
+			require.NoError(t, err)
+			values := trr.GetMany(keys)
+			has := trr.HasMany(keys)
+			require.EqualValues(t, len(keys), len(values))
+			require.EqualValues(t, len(keys), len(has))
+			// only roots are read with Get, the rest by levels
+			require.EqualValues(t, 3, s.gets)
+			require.True(t, s.multiGets < 2*len(keys)/10)
+			for i, k := range keys {
+				require.EqualValues(t, trr.Get(k), values[i])
+				require.EqualValues(t, trr.Has(k), has[i])
+			}
+			require.EqualValues(t, "identity", string(values[len(keys)-2]))
+		})
+	}
+}
@@ -104,3 +104,157 @@ func TestMutations(t *testing.T) {
 	})
 
 }
+
+func TestMutationsInverse(t *testing.T) {
+	s := common.NewInMemoryKVStore()
+	s.Set([]byte("a"), []byte("1"))
+	s.Set([]byte("b"), []byte("2"))
+	s.Set([]byte("c"), []byte("3"))
+	before := common.NewInMemoryKVStore()
+	s.Iterate(func(k, v []byte) bool {
+		before.Set(k, v)
+		return true
+	})
+
+	mut := common.NewMutations()
+	mut.Set([]byte("a"), []byte("changed"))
+	mut.Set([]byte("b"), nil)
+	mut.Set([]byte("c"), []byte("3"))
+	mut.Set([]byte("new"), []byte("4"))
+	mut.Set([]byte("absent"), nil)
+
+	inv := mut.Inverse(s)
+	require.EqualValues(t, 2, inv.LenSet())
+	require.EqualValues(t, 1, inv.LenDel())
+
+	mut.WriteTo(s)
+	require.False(t, s.Has([]byte("b")))
+	require.True(t, s.Has([]byte("new")))
+
+	inv.WriteTo(s)
+	require.EqualValues(t, before.Len(), s.Len())
+	before.Iterate(func(k, v []byte) bool {
+		require.EqualValues(t, v, s.Get(k))
+		return true
+	})
+}
+
+func TestMutationsSize(t *testing.T) {
+	mut := common.NewMutations()
+	mut.Set([]byte("ab"), []byte("123"))
+	require.EqualValues(t, 5, mut.Size())
+	mut.Set([]byte("ab"), []byte("1"))
+	require.EqualValues(t, 3, mut.Size())
+	mut.Set([]byte("ab"), nil)
+	require.EqualValues(t, 2, mut.Size())
+	mut.Set([]byte("c"), nil)
+	require.EqualValues(t, 3, mut.Size())
+	mut.Set([]byte("c"), []byte("45"))
+	require.EqualValues(t, 5, mut.Size())
+
+	exceeded := make([]error, 0)
+	mut.SetMaxSize(10, func(err error) {
+		exceeded = append(exceeded, err)
+	})
+	mut.Set([]byte("d"), []byte("1234"))
+	require.EqualValues(t, 0, len(exceeded))
+	mut.Set([]byte("e"), []byte("1"))
+	require.EqualValues(t, 1, len(exceeded))
+	require.ErrorIs(t, exceeded[0], common.ErrMutationsTooLarge)
+	mut.Set([]byte("f"), []byte("1"))
+	require.EqualValues(t, 1, len(exceeded))
+	mut.Set([]byte("d"), nil)
+	mut.Set([]byte("d"), []byte("1234"))
+	require.EqualValues(t, 2, len(exceeded))
+
+	mut = common.NewMutations()
+	mut.SetMaxSize(3)
+	err := common.CatchPanicOrError(func() error {
+		mut.Set([]byte("key"), []byte("value"))
+		return nil
+	})
+	require.ErrorIs(t, err, common.ErrMutationsTooLarge)
+	v, ok := mut.Lookup([]byte("key"))
+	require.True(t, ok)
+	require.EqualValues(t, "value", string(v))
+}
+
+func TestMutationsFiltered(t *testing.T) {
+	mut := common.NewMutations()
+	mut.Set([]byte("a1"), []byte("1"))
+	mut.Set([]byte("a2"), []byte("2"))
+	mut.Set([]byte("a2"), nil)
+	mut.Set([]byte("a3"), nil)
+	mut.Set([]byte("b1"), []byte("3"))
+	mut.Set([]byte("c"), nil)
+
+	f := mut.Filtered([]byte("a"))
+	require.EqualValues(t, 2, f.LenSet())
+	require.EqualValues(t, 2, f.LenDel())
+	require.EqualValues(t, 3+2+2, f.Size())
+	f.Iterate(func(k []byte, v []byte, wasSet bool) bool {
+		require.EqualValues(t, 'a', k[0])
+		if len(v) == 0 {
+			require.EqualValues(t, string(k) == "a2", wasSet)
+		}
+		return true
+	})
+	require.EqualValues(t, 0, mut.Filtered([]byte("x")).Size())
+
+	p := mut.Partitioned()
+	require.EqualValues(t, 3, len(p))
+	require.EqualValues(t, f.Size(), p['a'].Size())
+	require.EqualValues(t, f.LenSet(), p['a'].LenSet())
+	require.EqualValues(t, f.LenDel(), p['a'].LenDel())
+	v, ok := p['b'].Lookup([]byte("b1"))
+	require.True(t, ok)
+	require.EqualValues(t, "3", string(v))
+	require.EqualValues(t, 1, p['c'].LenDel())
+	total := 0
+	for _, pm := range p {
+		total += pm.Size()
+	}
+	require.EqualValues(t, mut.Size(), total)
+}
+
+func TestMutationsOverwrite(t *testing.T) {
+	mut := common.NewMutationsOverwrite()
+	prev, staged := mut.Swap([]byte("a"), []byte("1"))
+	require.False(t, staged)
+	require.Nil(t, prev)
+	_, ok := mut.Previous([]byte("a"))
+	require.False(t, ok)
+
+	prev, staged = mut.Swap([]byte("a"), []byte("2"))
+	require.True(t, staged)
+	require.EqualValues(t, "1", string(prev))
+	prev, ok = mut.Previous([]byte("a"))
+	require.True(t, ok)
+	require.EqualValues(t, "1", string(prev))
+
+	mut.Set([]byte("a"), nil)
+	prev, ok = mut.Previous([]byte("a"))
+	require.True(t, ok)
+	require.EqualValues(t, "2", string(prev))
+
+	prev, staged = mut.Swap([]byte("a"), []byte("3"))
+	require.True(t, staged)
+	require.Nil(t, prev)
+	prev, ok = mut.Previous([]byte("a"))
+	require.True(t, ok)
+	require.Nil(t, prev)
+
+	require.EqualValues(t, 1, mut.LenSet())
+	require.EqualValues(t, 0, mut.LenDel())
+	v, _ := mut.Lookup([]byte("a"))
+	require.EqualValues(t, "3", string(v))
+
+	// not in overwrite mode previous values are not recorded
+	mut = common.NewMutations()
+	mut.Set([]byte("a"), []byte("1"))
+	prev, staged = mut.Swap([]byte("a"), []byte("2"))
+	require.True(t, staged)
+	require.EqualValues(t, "1", string(prev))
+	_, ok = mut.Previous([]byte("a"))
+	require.False(t, ok)
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeighbors(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			keySet := make(map[string]struct{})
+			for i := 0; i < 300; i++ {
+				k := make([]byte, rnd.Intn(4)+1)
+				rnd.Read(k)
+				// small alphabet makes shared prefixes and keys which are prefixes of other keys
+				for j := range k {
+					k[j] %= 8
+				}
+				tr.Update(k, []byte("v"))
+				keySet[string(k)] = struct{}{}
+			}
+			keys := make([][]byte, 0, len(keySet))
+			for k := range keySet {
+				keys = append(keys, []byte(k))
+			}
+			root = tr.Commit(store)
+			sort.Slice(keys, func(i, j int) bool {
+				return bytes.Compare(keys[i], keys[j]) < 0
+			})
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+
+			// the identity (empty key) is the smallest
+			expectedNeighbors := func(k []byte) ([]byte, []byte) {
+				i := sort.Search(len(keys), func(i int) bool {
+					return bytes.Compare(keys[i], k) >= 0
+				})
+				left := []byte{}
+				if i > 0 {
+					left = keys[i-1]
+				}
+				if i < len(keys) && bytes.Equal(keys[i], k) {
+					i++
+				}
+				var right []byte
+				if i < len(keys) {
+					right = keys[i]
+				}
+				return left, right
+			}
+			check := func(k []byte) {
+				left, right := trr.Neighbors(k)
+				expectedLeft, expectedRight := expectedNeighbors(k)
+				require.EqualValues(t, expectedLeft, left, "key %x", k)
+				require.EqualValues(t, expectedRight, right, "key %x", k)
+			}
+			for _, k := range keys {
+				check(k)
+			}
+			for i := 0; i < 300; i++ {
+				k := make([]byte, rnd.Intn(5)+1)
+				rnd.Read(k)
+				for j := range k {
+					k[j] %= 9
+				}
+				check(k)
+			}
+			left, right := trr.Neighbors([]byte{0xff, 0xff})
+			require.EqualValues(t, keys[len(keys)-1], left)
+			require.Nil(t, right)
+			left, right = trr.Neighbors(nil)
+			require.Nil(t, left)
+			require.EqualValues(t, keys[0], right)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeCacheLRU(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	root = tr.Commit(store)
+
+	t.Run("bounded by nodes", func(t *testing.T) {
+		trr, err := immutable.NewTrieReader(m, store, root, 50)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			require.EqualValues(t, fmt.Sprintf("value%d", i), trr.GetStr(fmt.Sprintf("key%d", i)))
+		}
+		require.EqualValues(t, 50, trr.NodeCacheStats().Nodes)
+		trr.ClearCache()
+		require.EqualValues(t, immutable.NodeCacheStats{}, trr.NodeCacheStats())
+	})
+	t.Run("bounded by bytes", func(t *testing.T) {
+		trr, err := immutable.NewTrieReader(m, store, root, 0, 2000)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			require.EqualValues(t, fmt.Sprintf("value%d", i), trr.GetStr(fmt.Sprintf("key%d", i)))
+		}
+		stats := trr.NodeCacheStats()
+		require.True(t, stats.Bytes <= 2000)
+		require.True(t, stats.Nodes > 0)
+	})
+	t.Run("no cache", func(t *testing.T) {
+		trr, err := immutable.NewTrieReader(m, store, root, 0)
+		require.NoError(t, err)
+		trr.GetStr("key1")
+		require.EqualValues(t, immutable.NodeCacheStats{}, trr.NodeCacheStats())
+	})
+	t.Run("hot nodes stay cached", func(t *testing.T) {
+		metrics := common.NewInMemoryMetrics()
+		trr, err := immutable.NewTrieReader(m, store, root, 20)
+		require.NoError(t, err)
+		trr.SetMetrics(metrics)
+		for i := 0; i < 1000; i++ {
+			trr.GetStr("key1")
+			trr.GetStr(fmt.Sprintf("key%d", i))
+		}
+		// the path to key1 is always recently used, only the first fetch misses
+		hits := metrics.Counter(common.MetricNodeCacheHits)
+		require.True(t, hits > metrics.Counter(common.MetricNodeGets)/2)
+	})
+	t.Run("cached nodes are not mutated by updates", func(t *testing.T) {
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		tr.UpdateStr("key1", "changed")
+		require.EqualValues(t, "value1", tr.GetStr("key1"))
+		root1 := tr.CommitAndContinue(store)
+		tr.UpdateStr("key2", "changed")
+		root2 := tr.Commit(store)
+		require.False(t, m.EqualCommitments(root1, root2))
+
+		trr, err := immutable.NewTrieReader(m, store, root)
+		require.NoError(t, err)
+		require.EqualValues(t, "value1", trr.GetStr("key1"))
+		require.EqualValues(t, "value2", trr.GetStr("key2"))
+		trr, err = immutable.NewTrieReader(m, store, root2)
+		require.NoError(t, err)
+		require.EqualValues(t, "changed", trr.GetStr("key1"))
+		require.EqualValues(t, "changed", trr.GetStr("key2"))
+	})
+	t.Run("concurrent readers", func(t *testing.T) {
+		trr, err := immutable.NewTrieReader(m, store, root, 50)
+		require.NoError(t, err)
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := g; i < 1000; i += 3 {
+					require.EqualValues(t, fmt.Sprintf("value%d", i), trr.GetStr(fmt.Sprintf("key%d", i)))
+				}
+				trr.Iterate(func(_, _ []byte) bool { return true })
+				trr.NodeCacheStats()
+			}(g)
+		}
+		wg.Wait()
+		require.EqualValues(t, 50, trr.NodeCacheStats().Nodes)
+	})
+}
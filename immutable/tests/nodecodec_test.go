@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_mpt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeDataCodecs(t *testing.T) {
+	models := []common.CommitmentModel{
+		trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize256),
+		trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160),
+		trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160),
+		trie_mpt.New(),
+	}
+	codecs := map[string]common.NodeDataCodec{
+		"binary":   common.NodeDataCodecBinary,
+		"rlp":      common.NodeDataCodecRLP,
+		"protobuf": common.NodeDataCodecProtobuf,
+	}
+	for _, m := range models {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		}
+		tr.UpdateStr("k", "long value long value long value long value long value long value long value")
+		tr.Commit(store)
+
+		for name, codec := range codecs {
+			t.Run(fmt.Sprintf("%s/%s", m.ShortName(), name), func(t *testing.T) {
+				num := 0
+				store.Iterator([]byte{immutable.PartitionTrieNodes}).Iterate(func(k, v []byte) bool {
+					n, err := common.NodeDataFromBytes(m, v, m.PathArity(), nil)
+					require.NoError(t, err)
+					data, err := codec.EncodeNodeData(n, m.PathArity())
+					require.NoError(t, err)
+					nBack, err := codec.DecodeNodeData(data, m, m.PathArity())
+					require.NoError(t, err)
+					binBack, err := common.NodeDataCodecBinary.EncodeNodeData(nBack, m.PathArity())
+					require.NoError(t, err)
+					require.EqualValues(t, v, binBack)
+
+					_, err = codec.DecodeNodeData(data[:len(data)-1], m, m.PathArity())
+					require.Error(t, err)
+					num++
+					return true
+				})
+				require.True(t, num > 10)
+			})
+		}
+	}
+}
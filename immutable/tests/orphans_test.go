@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanOrphans(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root0 := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root0)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	root1 := tr.Commit(store)
+	tr, err = immutable.NewTrieUpdatable(m, store, root1)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("new value%d", i))
+	}
+	root2 := tr.Commit(store)
+
+	report, err := immutable.ScanOrphans(store, m, root0, root1, root2)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, len(report.Orphans))
+	require.EqualValues(t, 0, len(report.Missing))
+	require.EqualValues(t, report.NumNodes, report.NumReachable)
+
+	report, err = immutable.ScanOrphans(store, m, root2)
+	require.NoError(t, err)
+	require.True(t, len(report.Orphans) > 0)
+	require.EqualValues(t, 0, len(report.Missing))
+	require.EqualValues(t, report.NumNodes, report.NumReachable+len(report.Orphans))
+
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.EqualValues(t, 1+len(report.Orphans), len(lines))
+	require.True(t, strings.HasPrefix(lines[1], "delete "))
+
+	plan := report.RepairPlan()
+	require.EqualValues(t, len(report.Orphans), plan.LenDel())
+	plan.WriteTo(store)
+	require.NoError(t, immutable.VerifyIntegrity(store, m, root2))
+
+	report, err = immutable.ScanOrphans(store, m, root2)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, len(report.Orphans))
+
+	// the root of the discarded state and some of its nodes are missing now
+	report, err = immutable.ScanOrphans(store, m, root1, root2)
+	require.NoError(t, err)
+	require.True(t, len(report.Missing) > 0)
+	require.True(t, m.EqualCommitments(root1, report.Missing[0]))
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelinedTrie(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	t.Run("same roots as sequential", func(t *testing.T) {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		pt, err := immutable.NewPipelinedTrie(m, store, root)
+		require.NoError(t, err)
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+
+		handles := make([]*immutable.PipelinedCommit, 0)
+		roots := make([]common.VCommitment, 0)
+		for b := 0; b < 10; b++ {
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("key%d", b*50+i)
+				pt.Update([]byte(key), []byte(fmt.Sprintf("value%d", b)))
+				tr.UpdateStr(key, fmt.Sprintf("value%d", b))
+			}
+			pt.Delete([]byte(fmt.Sprintf("key%d", b*50)))
+			tr.DeleteStr(fmt.Sprintf("key%d", b*50))
+			// the previous batches are visible, committed or not
+			if b > 0 {
+				require.EqualValues(t, fmt.Sprintf("value%d", b-1), string(pt.Get([]byte(fmt.Sprintf("key%d", b*50-1)))))
+				require.False(t, pt.Has([]byte(fmt.Sprintf("key%d", (b-1)*50))))
+			}
+			handles = append(handles, pt.Commit())
+			roots = append(roots, tr.CommitAndContinue(store))
+		}
+		last, err := pt.Wait()
+		require.NoError(t, err)
+		require.EqualValues(t, 0, pt.Pending())
+		require.True(t, m.EqualCommitments(roots[len(roots)-1], last))
+		require.True(t, m.EqualCommitments(last, pt.CommittedRoot()))
+		for i, h := range handles {
+			r, err := h.Wait()
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(roots[i], r))
+		}
+	})
+	t.Run("failed commit", func(t *testing.T) {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		pt, err := immutable.NewPipelinedTrie(m, common.ReadOnly(store), root)
+		require.NoError(t, err)
+		pt.Update([]byte("a"), []byte("1"))
+		h1 := pt.Commit()
+		pt.Update([]byte("b"), []byte("2"))
+		h2 := pt.Commit()
+		_, err = h1.Wait()
+		require.True(t, errors.Is(err, common.ErrReadOnly))
+		_, err = h2.Wait()
+		require.True(t, errors.Is(err, common.ErrReadOnly))
+		_, err = pt.Wait()
+		require.True(t, errors.Is(err, common.ErrReadOnly))
+		require.True(t, m.EqualCommitments(root, pt.CommittedRoot()))
+	})
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetch(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	keys := make([][]byte, 0)
+	for i := 0; i < 500; i++ {
+		tr.UpdateStr(fmt.Sprintf("a/key%d", i), fmt.Sprintf("value%d", i))
+		tr.UpdateStr(fmt.Sprintf("b/key%d", i), fmt.Sprintf("value%d", i))
+		keys = append(keys, []byte(fmt.Sprintf("a/key%d", i)))
+	}
+	root = tr.Commit(store)
+
+	allHits := func(t *testing.T, trr *immutable.TrieReader, prefix string) {
+		metrics := common.NewInMemoryMetrics()
+		trr.SetMetrics(metrics)
+		for i := 0; i < 500; i++ {
+			require.EqualValues(t, fmt.Sprintf("value%d", i), trr.GetStr(fmt.Sprintf("%skey%d", prefix, i)))
+		}
+		require.EqualValues(t, metrics.Counter(common.MetricNodeGets), metrics.Counter(common.MetricNodeCacheHits))
+	}
+
+	t.Run("keys", func(t *testing.T) {
+		trr, err := immutable.NewTrieReader(m, store, root, 100_000)
+		require.NoError(t, err)
+		require.NoError(t, trr.Prefetch(keys))
+		allHits(t, trr, "a/")
+		require.NoError(t, trr.Prefetch(append(keys, []byte("absent"))))
+	})
+	t.Run("prefix", func(t *testing.T) {
+		trr, err := immutable.NewTrieReader(m, store, root, 100_000)
+		require.NoError(t, err)
+		require.NoError(t, trr.PrefetchPrefix([]byte("b/"), 3))
+		allHits(t, trr, "b/")
+		require.NoError(t, trr.PrefetchPrefix([]byte("absent")))
+		require.NoError(t, trr.PrefetchPrefix(nil))
+	})
+	t.Run("prefix bounded by cache", func(t *testing.T) {
+		trr, err := immutable.NewTrieReader(m, store, root, 50)
+		require.NoError(t, err)
+		require.NoError(t, trr.PrefetchPrefix(nil))
+		require.EqualValues(t, 50, trr.NodeCacheStats().Nodes)
+	})
+	t.Run("no cache", func(t *testing.T) {
+		trr, err := immutable.NewTrieReader(m, store, root, 0)
+		require.NoError(t, err)
+		require.NoError(t, trr.Prefetch(keys))
+		require.NoError(t, trr.PrefetchPrefix(nil))
+		require.EqualValues(t, immutable.NodeCacheStats{}, trr.NodeCacheStats())
+	})
+	t.Run("store error", func(t *testing.T) {
+		faulty := common.NewFaultyKVStore(store, common.FaultParams{})
+		trr, err := immutable.NewTrieReader(m, faulty, root, 100_000)
+		require.NoError(t, err)
+		faulty.SetParams(common.FaultParams{Unavailable: 1})
+		err = trr.Prefetch(keys)
+		require.True(t, errors.Is(err, common.ErrDBUnavailable))
+		err = trr.PrefetchPrefix([]byte("b/"))
+		require.True(t, errors.Is(err, common.ErrDBUnavailable))
+	})
+}
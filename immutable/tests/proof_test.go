@@ -1,6 +1,8 @@
 package tests
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -33,6 +35,8 @@ func TestProofIdentityBlake2b(t *testing.T) {
 	runTest(common.PathArity16, trie_blake2b.HashSize160)
 	runTest(common.PathArity2, trie_blake2b.HashSize256)
 	runTest(common.PathArity2, trie_blake2b.HashSize160)
+	runTest(common.PathArity16, trie_blake2b.HashSize192)
+	runTest(common.PathArity16, trie_blake2b.HashSize224)
 }
 
 func TestProofScenariosBlake2b(t *testing.T) {
@@ -76,6 +80,8 @@ func TestProofScenariosBlake2b(t *testing.T) {
 		runTest(common.PathArity16, trie_blake2b.HashSize160, scenario)
 		runTest(common.PathArity2, trie_blake2b.HashSize256, scenario)
 		runTest(common.PathArity2, trie_blake2b.HashSize160, scenario)
+		runTest(common.PathArity16, trie_blake2b.HashSize192, scenario)
+		runTest(common.PathArity16, trie_blake2b.HashSize224, scenario)
 	}
 	//runScenario([]string{"a"})
 	//runScenario([]string{"a", "ab"})
@@ -90,3 +96,255 @@ func TestProofScenariosBlake2b(t *testing.T) {
 	}
 	//runScenario(longData)
 }
+
+func TestProofMaxInlinedValueSize(t *testing.T) {
+	const identity = "idididididid"
+	for _, inl := range []int{0, 10, trie_blake2b.MaxInlinedValueSizeDefault} {
+		m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160, 0, inl)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			initRoot := immutable.MustInitRoot(store, m, []byte(identity))
+			tr, err := immutable.NewTrieUpdatable(m, store, initRoot)
+			require.NoError(t, err)
+			values := map[string]string{
+				"a":   "1",
+				"ab":  strings.Repeat("2", 10),
+				"abc": strings.Repeat("3", 11),
+				"b":   strings.Repeat("4", 100),
+			}
+			for k, v := range values {
+				tr.UpdateStr(k, v)
+			}
+			root := tr.Commit(store)
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			for k, v := range values {
+				require.EqualValues(t, v, string(trr.Get([]byte(k))))
+				_, inlined := m.CommitToData([]byte(v)).ExtractValue()
+				require.EqualValues(t, len(v) <= inl, inlined)
+				p := m.ProofImmutable([]byte(k), trr)
+				err = trie_blake2b_verify.ValidateWithTerminal(p, root.Bytes(), m.CommitToData([]byte(v)).Bytes())
+				require.NoError(t, err)
+			}
+		})
+	}
+	require.Panics(t, func() {
+		trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160, 0, trie_blake2b.MaxInlinedValueSizeDefault+1)
+	})
+}
+
+func TestProofKeccak256(t *testing.T) {
+	const identity = "idididididid"
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.NewKeccak256(arity)
+		mb := trie_blake2b.New(arity, trie_blake2b.HashSize256)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			storeB := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte(identity))
+			rootB := immutable.MustInitRoot(storeB, mb, []byte(identity))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			trB, err := immutable.NewTrieUpdatable(mb, storeB, rootB)
+			require.NoError(t, err)
+			values := map[string]string{
+				"a":   "1",
+				"ab":  strings.Repeat("2", 10),
+				"abc": strings.Repeat("3", 100),
+			}
+			for k, v := range values {
+				tr.UpdateStr(k, v)
+				trB.UpdateStr(k, v)
+			}
+			root = tr.Commit(store)
+			rootB = trB.Commit(storeB)
+			require.False(t, bytes.Equal(root.Bytes(), rootB.Bytes()))
+
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			for k, v := range values {
+				p := m.ProofImmutable([]byte(k), trr)
+				require.EqualValues(t, trie_blake2b.HashFunctionKeccak256, p.Hash)
+				err = trie_blake2b_verify.ValidateWithTerminal(p, root.Bytes(), m.CommitToData([]byte(v)).Bytes())
+				require.NoError(t, err)
+
+				pBack, err := trie_blake2b.ProofFromBytes(p.Bytes())
+				require.NoError(t, err)
+				require.EqualValues(t, trie_blake2b.HashFunctionKeccak256, pBack.Hash)
+				require.NoError(t, trie_blake2b_verify.Validate(pBack, root.Bytes()))
+
+				// the same proof is not valid if interpreted as blake2b
+				pBack.Hash = trie_blake2b.HashFunctionBlake2b
+				require.Error(t, trie_blake2b_verify.Validate(pBack, root.Bytes()))
+			}
+		})
+	}
+}
+
+func TestProofKeyed(t *testing.T) {
+	const identity = "idididididid"
+	key := []byte("network A")
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.NewKeyed(arity, trie_blake2b.HashSize160, key)
+		mb := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			storeB := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte(identity))
+			rootB := immutable.MustInitRoot(storeB, mb, []byte(identity))
+			require.False(t, bytes.Equal(root.Bytes(), rootB.Bytes()))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			values := map[string]string{
+				"a":   "1",
+				"ab":  strings.Repeat("2", 10),
+				"abc": strings.Repeat("3", 100),
+			}
+			for k, v := range values {
+				tr.UpdateStr(k, v)
+			}
+			root = tr.Commit(store)
+
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			for k, v := range values {
+				p := m.ProofImmutable([]byte(k), trr)
+				require.EqualValues(t, trie_blake2b.HashFunctionBlake2bKeyed, p.Hash)
+				err = trie_blake2b_verify.ValidateWithTerminalKeyed(p, root.Bytes(), m.CommitToData([]byte(v)).Bytes(), key)
+				require.NoError(t, err)
+
+				pBack, err := trie_blake2b.ProofFromBytes(p.Bytes())
+				require.NoError(t, err)
+				require.EqualValues(t, trie_blake2b.HashFunctionBlake2bKeyed, pBack.Hash)
+				require.NoError(t, trie_blake2b_verify.ValidateKeyed(pBack, root.Bytes(), key))
+
+				require.Error(t, trie_blake2b_verify.Validate(pBack, root.Bytes()))
+				require.Error(t, trie_blake2b_verify.ValidateKeyed(pBack, root.Bytes(), []byte("network B")))
+				pBack.Hash = trie_blake2b.HashFunctionBlake2b
+				require.Error(t, trie_blake2b_verify.Validate(pBack, root.Bytes()))
+			}
+		})
+	}
+}
+
+func TestProofMerkleVectorScheme(t *testing.T) {
+	const identity = "idididididid"
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		m.SetVectorScheme(trie_blake2b.VectorSchemeMerkle)
+		mFlat := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			storeFlat := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte(identity))
+			rootFlat := immutable.MustInitRoot(storeFlat, mFlat, []byte(identity))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			trFlat, err := immutable.NewTrieUpdatable(mFlat, storeFlat, rootFlat)
+			require.NoError(t, err)
+			values := map[string]string{
+				"a":   "1",
+				"ab":  strings.Repeat("2", 10),
+				"abc": strings.Repeat("3", 100),
+			}
+			for i := 0; i < 100; i++ {
+				values[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+			}
+			// the root node with all children
+			for i := 0; i < 256; i++ {
+				values[string([]byte{byte(i)})] = fmt.Sprintf("dense%d", i)
+			}
+			for k, v := range values {
+				tr.UpdateStr(k, v)
+				trFlat.UpdateStr(k, v)
+			}
+			root = tr.Commit(store)
+			rootFlat = trFlat.Commit(storeFlat)
+			require.False(t, bytes.Equal(root.Bytes(), rootFlat.Bytes()))
+
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			trrFlat, err := immutable.NewTrieReader(mFlat, storeFlat, rootFlat)
+			require.NoError(t, err)
+			for k, v := range values {
+				p := m.ProofImmutable([]byte(k), trr)
+				require.EqualValues(t, trie_blake2b.VectorSchemeMerkle, p.Scheme)
+				err = trie_blake2b_verify.ValidateWithTerminal(p, root.Bytes(), m.CommitToData([]byte(v)).Bytes())
+				require.NoError(t, err)
+
+				pBack, err := trie_blake2b.ProofFromBytes(p.Bytes())
+				require.NoError(t, err)
+				require.EqualValues(t, trie_blake2b.VectorSchemeMerkle, pBack.Scheme)
+				require.NoError(t, trie_blake2b_verify.Validate(pBack, root.Bytes()))
+				require.Error(t, trie_blake2b_verify.ValidateWithTerminal(pBack, root.Bytes(), m.CommitToData([]byte("wrong")).Bytes()))
+				pBack.Path[0].Siblings[0][0] ^= 0x01
+				require.Error(t, trie_blake2b_verify.Validate(pBack, root.Bytes()))
+				pBack.Path[0].Siblings[0][0] ^= 0x01
+				pBack.Scheme = trie_blake2b.VectorSchemeFlat
+				require.Error(t, trie_blake2b_verify.Validate(pBack, root.Bytes()))
+
+				if arity == common.PathArity256 && len(k) == 1 {
+					pFlat := mFlat.ProofImmutable([]byte(k), trrFlat)
+					require.Less(t, len(p.Bytes()), len(pFlat.Bytes()))
+				}
+			}
+			for _, k := range []string{"ac", "key1000", "bz"} {
+				p := m.ProofImmutable([]byte(k), trr)
+				require.NoError(t, trie_blake2b_verify.Validate(p, root.Bytes()))
+				require.True(t, trie_blake2b_verify.IsProofOfAbsence(p))
+			}
+		})
+	}
+}
+
+func TestProofCodecs(t *testing.T) {
+	const identity = "idididididid"
+	codecs := map[string]trie_blake2b.ProofCodec{
+		"binary":   trie_blake2b.ProofCodecBinary,
+		"rlp":      trie_blake2b.ProofCodecRLP,
+		"cbor":     trie_blake2b.ProofCodecCBOR,
+		"protobuf": trie_blake2b.ProofCodecProtobuf,
+	}
+	for _, scheme := range []trie_blake2b.VectorScheme{trie_blake2b.VectorSchemeFlat, trie_blake2b.VectorSchemeMerkle} {
+		for _, arity := range common.AllPathArity {
+			m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+			m.SetVectorScheme(scheme)
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte(identity))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			values := map[string]string{
+				"a":   "1",
+				"ab":  strings.Repeat("2", 10),
+				"abc": strings.Repeat("3", 100),
+			}
+			for i := 0; i < 50; i++ {
+				values[fmt.Sprintf("key%d", i)] = fmt.Sprintf("value%d", i)
+			}
+			for k, v := range values {
+				tr.UpdateStr(k, v)
+			}
+			root = tr.Commit(store)
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+
+			for name, codec := range codecs {
+				t.Run(fmt.Sprintf("%s/%s", m.ShortName(), name), func(t *testing.T) {
+					for _, k := range []string{"", "a", "ab", "abc", "key10", "key1000", "bz"} {
+						p := m.ProofImmutable([]byte(k), trr)
+						data, err := codec.EncodeProof(p)
+						require.NoError(t, err)
+						pBack, err := codec.DecodeProof(data)
+						require.NoError(t, err)
+						require.EqualValues(t, scheme, pBack.Scheme)
+						require.EqualValues(t, p.Bytes(), pBack.Bytes())
+						require.NoError(t, trie_blake2b_verify.Validate(pBack, root.Bytes()))
+
+						_, err = codec.DecodeProof(data[:len(data)-1])
+						require.Error(t, err)
+					}
+				})
+			}
+		}
+	}
+}
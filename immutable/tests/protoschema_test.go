@@ -0,0 +1,447 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_mpt"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Codecs of unitrie.proto and ICS-23 messages are implemented with protowire by hand. The tests below build
+// descriptors from the .proto files and check the encoded messages against them with dynamicpb.
+// protoc is not needed: the minimal parser supports the subset of proto3 used by the schemas, i.e. top-level
+// enums and messages with scalar, enum, message, repeated, optional and oneof fields
+
+var protoScalarTypes = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+}
+
+type protoParser struct {
+	tokens []string
+	pos    int
+	fd     *descriptorpb.FileDescriptorProto
+}
+
+func tokenizeProto(src string) []string {
+	ret := make([]string, 0)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				panic("unterminated comment")
+			}
+			i += end + 4
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				j++
+			}
+			ret = append(ret, src[i:j+1])
+			i = j + 1
+		case c == '_' || c == '.' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || c == '-':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '.' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j])) || src[j] == '-') {
+				j++
+			}
+			ret = append(ret, src[i:j])
+			i = j
+		default:
+			ret = append(ret, string(c))
+			i++
+		}
+	}
+	return ret
+}
+
+func (p *protoParser) next() string {
+	if p.pos >= len(p.tokens) {
+		panic("unexpected end of the .proto file")
+	}
+	p.pos++
+	return p.tokens[p.pos-1]
+}
+
+func (p *protoParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *protoParser) expect(tok string) {
+	if got := p.next(); got != tok {
+		panic(fmt.Sprintf("expected '%s', got '%s'", tok, got))
+	}
+}
+
+// skipStatement skips tokens up to and including ';', together with the blocks in braces
+func (p *protoParser) skipStatement() {
+	depth := 0
+	for {
+		switch p.next() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		case ";":
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (p *protoParser) parseFile() {
+	for p.peek() != "" {
+		switch tok := p.next(); tok {
+		case "syntax":
+			p.expect("=")
+			p.fd.Syntax = proto.String(strings.Trim(p.next(), `"'`))
+			p.expect(";")
+		case "package":
+			p.fd.Package = proto.String(p.next())
+			p.expect(";")
+		case "option", "import":
+			p.skipStatement()
+		case "enum":
+			p.fd.EnumType = append(p.fd.EnumType, p.parseEnum())
+		case "message":
+			p.fd.MessageType = append(p.fd.MessageType, p.parseMessage())
+		default:
+			panic(fmt.Sprintf("unexpected '%s'", tok))
+		}
+	}
+}
+
+func (p *protoParser) parseEnum() *descriptorpb.EnumDescriptorProto {
+	ret := &descriptorpb.EnumDescriptorProto{Name: proto.String(p.next())}
+	p.expect("{")
+	for p.peek() != "}" {
+		if p.peek() == "option" || p.peek() == "reserved" {
+			p.skipStatement()
+			continue
+		}
+		name := p.next()
+		p.expect("=")
+		ret.Value = append(ret.Value, &descriptorpb.EnumValueDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(p.parseNumber()),
+		})
+		p.skipStatement()
+	}
+	p.expect("}")
+	return ret
+}
+
+func (p *protoParser) parseNumber() int32 {
+	n, err := strconv.ParseInt(p.next(), 0, 32)
+	if err != nil {
+		panic(err)
+	}
+	return int32(n)
+}
+
+func (p *protoParser) parseMessage() *descriptorpb.DescriptorProto {
+	ret := &descriptorpb.DescriptorProto{Name: proto.String(p.next())}
+	p.expect("{")
+	optional := make([]*descriptorpb.FieldDescriptorProto, 0)
+	for p.peek() != "}" {
+		switch p.peek() {
+		case "option", "reserved":
+			p.skipStatement()
+		case "oneof":
+			p.next()
+			ret.OneofDecl = append(ret.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(p.next())})
+			p.expect("{")
+			for p.peek() != "}" {
+				f := p.parseField()
+				f.OneofIndex = proto.Int32(int32(len(ret.OneofDecl) - 1))
+				ret.Field = append(ret.Field, f)
+			}
+			p.expect("}")
+		default:
+			f := p.parseField()
+			if f.GetProto3Optional() {
+				optional = append(optional, f)
+			}
+			ret.Field = append(ret.Field, f)
+		}
+	}
+	p.expect("}")
+	// synthetic oneofs of proto3 optional fields follow the real ones
+	for _, f := range optional {
+		f.OneofIndex = proto.Int32(int32(len(ret.OneofDecl)))
+		ret.OneofDecl = append(ret.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String("_" + f.GetName())})
+	}
+	return ret
+}
+
+func (p *protoParser) parseField() *descriptorpb.FieldDescriptorProto {
+	ret := &descriptorpb.FieldDescriptorProto{Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()}
+	switch p.peek() {
+	case "repeated":
+		p.next()
+		ret.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	case "optional":
+		p.next()
+		ret.Proto3Optional = proto.Bool(true)
+	}
+	typ := p.next()
+	if t, isScalar := protoScalarTypes[typ]; isScalar {
+		ret.Type = t.Enum()
+	} else {
+		// resolved when the whole file is parsed
+		ret.TypeName = proto.String(typ)
+	}
+	ret.Name = proto.String(p.next())
+	ret.JsonName = proto.String(protoJSONName(ret.GetName()))
+	p.expect("=")
+	ret.Number = proto.Int32(p.parseNumber())
+	p.skipStatement()
+	return ret
+}
+
+func protoJSONName(name string) string {
+	var ret strings.Builder
+	upper := false
+	for _, c := range name {
+		switch {
+		case c == '_':
+			upper = true
+		case upper:
+			ret.WriteRune(unicode.ToUpper(c))
+			upper = false
+		default:
+			ret.WriteRune(c)
+		}
+	}
+	return ret.String()
+}
+
+// resolveTypes resolves names of the enum and message types of fields. Only types of the same file are supported
+func (p *protoParser) resolveTypes() {
+	enums := make(map[string]bool)
+	for _, e := range p.fd.EnumType {
+		enums[e.GetName()] = true
+	}
+	for _, m := range p.fd.MessageType {
+		for _, f := range m.Field {
+			if f.TypeName == nil {
+				continue
+			}
+			name := f.GetTypeName()
+			if enums[name] {
+				f.Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+			} else {
+				f.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			}
+			f.TypeName = proto.String("." + p.fd.GetPackage() + "." + name)
+		}
+	}
+}
+
+// parseProtoFile builds the descriptor of the .proto file
+func parseProtoFile(t *testing.T, fname string) protoreflect.FileDescriptor {
+	src, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	p := &protoParser{
+		tokens: tokenizeProto(string(src)),
+		fd:     &descriptorpb.FileDescriptorProto{Name: proto.String(fname)},
+	}
+	err = common.CatchPanicOrError(func() error {
+		p.parseFile()
+		return nil
+	})
+	require.NoError(t, err)
+	p.resolveTypes()
+	ret, err := protodesc.NewFile(p.fd, nil)
+	require.NoError(t, err)
+	return ret
+}
+
+// protoRoundTrip decodes data as the message of the descriptor, checks that all fields are known to the descriptor
+// and that the message is encoded back into the same bytes
+func protoRoundTrip(t *testing.T, md protoreflect.MessageDescriptor, data []byte) *dynamicpb.Message {
+	msg := dynamicpb.NewMessage(md)
+	require.NoError(t, proto.Unmarshal(data, msg))
+	requireNoUnknownFields(t, msg)
+	back, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	require.NoError(t, err)
+	require.EqualValues(t, data, back)
+	return msg
+}
+
+func requireNoUnknownFields(t *testing.T, msg protoreflect.Message) {
+	require.Empty(t, msg.GetUnknown(), "unknown fields in %s", msg.Descriptor().FullName())
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind {
+			return true
+		}
+		if fd.IsList() {
+			for i := 0; i < v.List().Len(); i++ {
+				requireNoUnknownFields(t, v.List().Get(i).Message())
+			}
+			return true
+		}
+		requireNoUnknownFields(t, v.Message())
+		return true
+	})
+}
+
+func protoField(msg protoreflect.Message, name string) protoreflect.Value {
+	fd := msg.Descriptor().Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		panic(fmt.Sprintf("no field '%s' in %s", name, msg.Descriptor().FullName()))
+	}
+	return msg.Get(fd)
+}
+
+func TestProtobufSchema(t *testing.T) {
+	fd := parseProtoFile(t, "../../proto/unitrie.proto")
+	messages := fd.Messages()
+
+	t.Run("NodeData", func(t *testing.T) {
+		md := messages.ByName("NodeData")
+		require.NotNil(t, md)
+		for _, m := range []common.CommitmentModel{
+			trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize256),
+			trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160),
+			trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160),
+			trie_mpt.New(),
+		} {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+			}
+			tr.UpdateStr("k", strings.Repeat("long value ", 10))
+			tr.Commit(store)
+
+			num := 0
+			store.Iterator([]byte{immutable.PartitionTrieNodes}).Iterate(func(_, v []byte) bool {
+				n, err := common.NodeDataFromBytes(m, v, m.PathArity(), nil)
+				require.NoError(t, err)
+				data, err := common.NodeDataCodecProtobuf.EncodeNodeData(n, m.PathArity())
+				require.NoError(t, err)
+				msg := protoRoundTrip(t, md, data)
+
+				pathFragment, err := common.EncodeUnpackedBytes(n.PathFragment, m.PathArity())
+				require.NoError(t, err)
+				require.EqualValues(t, pathFragment, protoField(msg, "path_fragment").Bytes())
+				terminal := msg.Descriptor().Fields().ByName("terminal")
+				require.EqualValues(t, !common.IsNil(n.Terminal), msg.Has(terminal))
+				if !common.IsNil(n.Terminal) {
+					require.EqualValues(t, n.Terminal.Bytes(), msg.Get(terminal).Bytes())
+				}
+				children := protoField(msg, "children").List()
+				require.EqualValues(t, len(n.ChildCommitments), children.Len())
+				for i := 0; i < children.Len(); i++ {
+					child := children.Get(i).Message()
+					c, ok := n.ChildCommitments[byte(protoField(child, "index").Uint())]
+					require.True(t, ok)
+					require.EqualValues(t, c.Bytes(), protoField(child, "commitment").Bytes())
+				}
+				num++
+				return true
+			})
+			require.True(t, num > 10)
+		}
+	})
+	t.Run("MerkleProof", func(t *testing.T) {
+		md := messages.ByName("MerkleProof")
+		require.NotNil(t, md)
+		for _, scheme := range []trie_blake2b.VectorScheme{trie_blake2b.VectorSchemeFlat, trie_blake2b.VectorSchemeMerkle} {
+			for _, arity := range common.AllPathArity {
+				m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+				m.SetVectorScheme(scheme)
+				store := common.NewInMemoryKVStore()
+				root := immutable.MustInitRoot(store, m, []byte("identity"))
+				tr, err := immutable.NewTrieUpdatable(m, store, root)
+				require.NoError(t, err)
+				for i := 0; i < 50; i++ {
+					tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+				}
+				tr.UpdateStr("k", strings.Repeat("long value ", 10))
+				root = tr.Commit(store)
+				trr, err := immutable.NewTrieReader(m, store, root)
+				require.NoError(t, err)
+
+				for _, k := range []string{"", "k", "key1", "key49", "absent"} {
+					p := m.ProofImmutable([]byte(k), trr)
+					data, err := trie_blake2b.ProofCodecProtobuf.EncodeProof(p)
+					require.NoError(t, err)
+					msg := protoRoundTrip(t, md, data)
+
+					require.EqualValues(t, arity, protoField(msg, "path_arity").Uint())
+					require.EqualValues(t, p.HashSize, protoField(msg, "hash_size").Uint())
+					require.EqualValues(t, p.Hash, protoField(msg, "hash_function").Uint())
+					key, err := common.EncodeUnpackedBytes(p.Key, arity)
+					require.NoError(t, err)
+					require.EqualValues(t, key, protoField(msg, "key").Bytes())
+					path := protoField(msg, "path").List()
+					require.EqualValues(t, len(p.Path), path.Len())
+					for i, e := range p.Path {
+						el := path.Get(i).Message()
+						require.EqualValues(t, e.ChildIndex, protoField(el, "child_index").Uint())
+						require.EqualValues(t, e.Terminal != nil, el.Has(el.Descriptor().Fields().ByName("terminal")))
+						require.EqualValues(t, len(e.Children), protoField(el, "children").List().Len())
+						siblings := protoField(el, "siblings").List()
+						require.EqualValues(t, len(e.Siblings), siblings.Len())
+						for j, s := range e.Siblings {
+							require.EqualValues(t, s, siblings.Get(j).Bytes())
+						}
+					}
+				}
+			}
+		}
+	})
+	t.Run("SnapshotHeader", func(t *testing.T) {
+		md := messages.ByName("SnapshotHeader")
+		require.NotNil(t, md)
+		m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize192)
+		root := immutable.MustInitRoot(common.NewInMemoryKVStore(), m, []byte("identity"))
+		h := common.NewSnapshotHeader(m, root)
+		msg := protoRoundTrip(t, md, h.Protobuf())
+		require.EqualValues(t, h.Model, protoField(msg, "model").String())
+		require.EqualValues(t, h.PathArity, protoField(msg, "path_arity").Uint())
+		require.EqualValues(t, h.HashSize, protoField(msg, "hash_size").Uint())
+		require.EqualValues(t, h.Root, protoField(msg, "root").Bytes())
+	})
+}
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReaderCache(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	roots := make([]common.VCommitment, 0)
+	for i := 0; i < 4; i++ {
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		tr.UpdateStr(fmt.Sprintf("key%d", i), "value")
+		root = tr.Commit(store)
+		roots = append(roots, root)
+	}
+
+	type evicted struct {
+		root   common.VCommitment
+		status immutable.RootStatus
+	}
+	var evictions []evicted
+	c := immutable.NewReaderCache(m, store, immutable.ReaderCacheParams{
+		KeepFinalized: 2,
+		OnEvict: func(root common.VCommitment, status immutable.RootStatus) {
+			evictions = append(evictions, evicted{root, status})
+		},
+	})
+	for i, r := range roots {
+		trr, err := c.Reader(r)
+		require.NoError(t, err)
+		require.EqualValues(t, "value", trr.GetStr(fmt.Sprintf("key%d", i)))
+		trr1, err := c.Reader(r)
+		require.NoError(t, err)
+		require.True(t, trr == trr1)
+		c.PutArtifact(r, "proof", i)
+	}
+	require.EqualValues(t, 4, c.Len())
+	a, ok := c.GetArtifact(roots[1], "proof")
+	require.True(t, ok)
+	require.EqualValues(t, 1, a)
+	_, ok = c.GetArtifact(roots[1], "witness")
+	require.False(t, ok)
+
+	t.Run("orphaned evicted immediately", func(t *testing.T) {
+		c.SetRootStatus(roots[3], immutable.RootStatusOrphaned)
+		require.EqualValues(t, 3, c.Len())
+		require.EqualValues(t, 1, len(evictions))
+		require.True(t, m.EqualCommitments(roots[3], evictions[0].root))
+		require.EqualValues(t, immutable.RootStatusOrphaned, evictions[0].status)
+		_, ok := c.GetArtifact(roots[3], "proof")
+		require.False(t, ok)
+	})
+	t.Run("finalized twice", func(t *testing.T) {
+		c.SetRootStatus(roots[0], immutable.RootStatusFinalized)
+		c.SetRootStatus(roots[0], immutable.RootStatusFinalized)
+		c.SetRootStatus(roots[1], immutable.RootStatusFinalized)
+		// root 0 is counted once, so the limit of 2 is not exceeded
+		require.EqualValues(t, 3, c.Len())
+		require.EqualValues(t, 1, len(evictions))
+	})
+	t.Run("oldest finalized evicted", func(t *testing.T) {
+		c.SetRootStatus(roots[2], immutable.RootStatusFinalized)
+		require.EqualValues(t, 2, c.Len())
+		require.EqualValues(t, 2, len(evictions))
+		require.True(t, m.EqualCommitments(roots[0], evictions[1].root))
+		require.EqualValues(t, immutable.RootStatusFinalized, evictions[1].status)
+		_, ok := c.GetArtifact(roots[0], "proof")
+		require.False(t, ok)
+		a, ok := c.GetArtifact(roots[2], "proof")
+		require.True(t, ok)
+		require.EqualValues(t, 2, a)
+	})
+	t.Run("explicit eviction", func(t *testing.T) {
+		c.Evict(roots[1])
+		require.EqualValues(t, 1, c.Len())
+		require.EqualValues(t, 3, len(evictions))
+		require.True(t, m.EqualCommitments(roots[1], evictions[2].root))
+		require.EqualValues(t, immutable.RootStatusFinalized, evictions[2].status)
+		_, ok := c.GetArtifact(roots[1], "proof")
+		require.False(t, ok)
+		// the evicted root can be queried again
+		trr, err := c.Reader(roots[1])
+		require.NoError(t, err)
+		require.EqualValues(t, "value", trr.GetStr("key1"))
+		require.EqualValues(t, 2, c.Len())
+	})
+}
+
+func TestReaderCacheKeepPending(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	roots := make([]common.VCommitment, 0)
+	for i := 0; i < 6; i++ {
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		tr.UpdateStr(fmt.Sprintf("key%d", i), "value")
+		root = tr.Commit(store)
+		roots = append(roots, root)
+	}
+	evicted := make([]common.VCommitment, 0)
+	c := immutable.NewReaderCache(m, store, immutable.ReaderCacheParams{
+		KeepFinalized: 2,
+		KeepPending:   2,
+		OnEvict: func(root common.VCommitment, status immutable.RootStatus) {
+			require.EqualValues(t, immutable.RootStatusPending, status)
+			evicted = append(evicted, root)
+		},
+	})
+	_, err := c.Reader(roots[0])
+	require.NoError(t, err)
+	c.PutArtifact(roots[1], "proof", 1)
+	c.SetRootStatus(roots[2], immutable.RootStatusFinalized)
+	// finalized roots are not counted as pending
+	require.EqualValues(t, 3, c.Len())
+	require.EqualValues(t, 0, len(evicted))
+
+	// the oldest pending root is evicted
+	_, err = c.Reader(roots[3])
+	require.NoError(t, err)
+	require.EqualValues(t, 3, c.Len())
+	require.EqualValues(t, 1, len(evicted))
+	require.True(t, m.EqualCommitments(roots[0], evicted[0]))
+
+	// the pending root becomes finalized and is not evicted as pending
+	c.SetRootStatus(roots[1], immutable.RootStatusFinalized)
+	c.PutArtifact(roots[4], "proof", 4)
+	require.EqualValues(t, 4, c.Len())
+	require.EqualValues(t, 1, len(evicted))
+	a, ok := c.GetArtifact(roots[1], "proof")
+	require.True(t, ok)
+	require.EqualValues(t, 1, a)
+
+	c.PutArtifact(roots[5], "proof", 5)
+	require.EqualValues(t, 4, c.Len())
+	require.EqualValues(t, 2, len(evicted))
+	require.True(t, m.EqualCommitments(roots[3], evicted[1]))
+	_, ok = c.GetArtifact(roots[3], "proof")
+	require.False(t, ok)
+
+	// an explicitly evicted pending root is not evicted again
+	c.Evict(roots[4])
+	require.EqualValues(t, 3, len(evicted))
+	_, err = c.Reader(roots[0])
+	require.NoError(t, err)
+	require.EqualValues(t, 3, len(evicted))
+	require.EqualValues(t, 4, c.Len())
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRegistry(t *testing.T) {
+	m16 := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	m2 := trie_blake2b.New(common.PathArity2, trie_blake2b.HashSize160)
+	root := immutable.MustInitRoot(common.NewInMemoryKVStore(), m16, []byte("identity"))
+
+	id, ok := common.IDOfModel(m16)
+	require.True(t, ok)
+	require.EqualValues(t, trie_blake2b.ModelIDBlake2bArity16Hash160, id)
+
+	data, err := common.SelfDescribingBytes(m16, root)
+	require.NoError(t, err)
+	require.EqualValues(t, byte(id), data[0])
+
+	m, c, err := common.VectorCommitmentFromSelfDescribingBytes(data)
+	require.NoError(t, err)
+	require.EqualValues(t, m16.ShortName(), m.ShortName())
+	require.True(t, m16.EqualCommitments(root, c))
+
+	c, err = common.VectorCommitmentFromBytes(nil, data)
+	require.NoError(t, err)
+	require.True(t, m16.EqualCommitments(root, c))
+
+	_, err = common.VectorCommitmentOfModel(m16, data)
+	require.NoError(t, err)
+	_, err = common.VectorCommitmentOfModel(m2, data)
+	require.True(t, errors.Is(err, common.ErrCommitmentOfAnotherModel))
+
+	_, _, err = common.VectorCommitmentFromSelfDescribingBytes([]byte{0xff, 1, 2})
+	require.True(t, errors.Is(err, common.ErrUnknownModelID))
+
+	mInl := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160, 0, 10)
+	_, err = common.SelfDescribingBytes(mInl, root)
+	require.True(t, errors.Is(err, common.ErrModelNotRegistered))
+	err = common.RegisterModel(trie_blake2b.ModelIDKeccakArity2, mInl)
+	require.True(t, errors.Is(err, common.ErrModelIDTaken))
+	require.NoError(t, common.RegisterModel(common.ModelIDUserMin, mInl))
+	t.Cleanup(func() { common.UnregisterModel(common.ModelIDUserMin) })
+	require.Error(t, common.RegisterModel(common.ModelIDUserMin+1, mInl))
+	m, ok = common.ModelByID(common.ModelIDUserMin)
+	require.True(t, ok)
+	require.EqualValues(t, mInl.ShortName(), m.ShortName())
+
+	common.UnregisterModel(common.ModelIDUserMin)
+	_, ok = common.ModelByID(common.ModelIDUserMin)
+	require.False(t, ok)
+	_, ok = common.IDOfModel(mInl)
+	require.False(t, ok)
+}
+
+func TestStandardModelsRegistered(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		for _, hs := range trie_blake2b.AllHashSize {
+			m := trie_blake2b.New(arity, hs)
+			root := immutable.MustInitRoot(common.NewInMemoryKVStore(), m, []byte("identity"))
+			data, err := common.SelfDescribingBytes(m, root)
+			require.NoError(t, err, m.ShortName())
+			c, err := common.VectorCommitmentFromBytes(nil, data)
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(root, c))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureTrie(t *testing.T) {
+	runTest := func(m common.CommitmentModel, storePreimages bool) {
+		t.Run(fmt.Sprintf("%s-%v", m.ShortName(), storePreimages), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewSecureTrieUpdatable(m, store, root, storePreimages)
+			require.NoError(t, err)
+			require.True(t, tr.IsSecure())
+			keys := []string{"a", "ab", "abc", strings.Repeat("x", 1000)}
+			for _, k := range keys {
+				tr.UpdateStr(k, "v"+k)
+			}
+			tr.UpdateStr("deleted", "1")
+			tr.DeleteStr("deleted")
+			root = tr.Commit(store)
+
+			trs, err := immutable.NewSecureTrieReader(m, store, root)
+			require.NoError(t, err)
+			trPlain, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			for _, k := range keys {
+				require.EqualValues(t, "v"+k, trs.GetStr(k))
+				require.False(t, trPlain.HasStr(k))
+				require.EqualValues(t, "v"+k, string(trPlain.Get(immutable.HashKey([]byte(k)))))
+			}
+			require.False(t, trs.HasStr("deleted"))
+
+			count := 0
+			trs.IterateKeys(func(k []byte) bool {
+				count++
+				if len(k) == 0 {
+					// identity of the root
+					return true
+				}
+				require.EqualValues(t, 20, len(k))
+				preimage := trs.Preimage(k)
+				if storePreimages {
+					require.EqualValues(t, "v"+string(preimage), trs.GetStr(string(preimage)))
+				} else {
+					require.Nil(t, preimage)
+				}
+				return true
+			})
+			// identity is at the empty key
+			require.EqualValues(t, len(keys)+1, count)
+			require.EqualValues(t, "", string(trs.Preimage(immutable.HashKey([]byte("deleted")))))
+		})
+	}
+	for _, arity := range common.AllPathArity {
+		runTest(trie_blake2b.New(arity, trie_blake2b.HashSize160), true)
+		runTest(trie_blake2b.New(arity, trie_blake2b.HashSize160), false)
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSession(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+			}
+			root = tr.Commit(store)
+
+			s, err := immutable.NewReadSession(m, store, root, immutable.ReadSessionLimits{})
+			require.NoError(t, err)
+			v, err := s.Get([]byte("key42"))
+			require.NoError(t, err)
+			require.EqualValues(t, "value42", string(v))
+			nodes, bytesRead := s.NodesFetched(), s.BytesRead()
+			require.True(t, nodes > 1)
+			require.True(t, bytesRead > 0)
+
+			var p *trie_blake2b.MerkleProof
+			err = s.Run(func(tr *immutable.TrieReader) {
+				p = m.ProofImmutable([]byte("key42"), tr)
+			})
+			require.NoError(t, err)
+			require.NoError(t, trie_blake2b_verify.ValidateWithTerminal(p, root.Bytes(), m.CommitToData(v).Bytes()))
+
+			// fits exactly
+			s, err = immutable.NewReadSession(m, store, root, immutable.ReadSessionLimits{MaxNodes: nodes, MaxBytes: bytesRead})
+			require.NoError(t, err)
+			_, err = s.Get([]byte("key42"))
+			require.NoError(t, err)
+
+			s, err = immutable.NewReadSession(m, store, root, immutable.ReadSessionLimits{MaxNodes: nodes - 1})
+			require.NoError(t, err)
+			_, err = s.Get([]byte("key42"))
+			require.True(t, errors.Is(err, immutable.ErrReadBudgetExceeded))
+			// session remains aborted
+			_, err = s.Has([]byte("key1"))
+			require.True(t, errors.Is(err, immutable.ErrReadBudgetExceeded))
+
+			s, err = immutable.NewReadSession(m, store, root, immutable.ReadSessionLimits{MaxBytes: bytesRead - 1})
+			require.NoError(t, err)
+			_, err = s.Get([]byte("key42"))
+			require.True(t, errors.Is(err, immutable.ErrReadBudgetExceeded))
+
+			_, err = immutable.NewReadSession(m, store, root, immutable.ReadSessionLimits{MaxBytes: 1})
+			require.True(t, errors.Is(err, immutable.ErrReadBudgetExceeded))
+		})
+	}
+}
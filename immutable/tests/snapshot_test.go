@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingWriter [][2][]byte
+
+func (r *recordingWriter) Set(key, value []byte) {
+	*r = append(*r, [2][]byte{common.Concat(key), common.Concat(value)})
+}
+
+func TestSnapshotVerifier(t *testing.T) {
+	for _, arity := range common.AllPathArity {
+		m := trie_blake2b.New(arity, trie_blake2b.HashSize160, 100)
+		t.Run(m.ShortName(), func(t *testing.T) {
+			rnd := rand.New(rand.NewSource(1))
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieUpdatable(m, store, root)
+			require.NoError(t, err)
+			for i := 0; i < 200; i++ {
+				tr.UpdateStr(fmt.Sprintf("%x", rnd.Intn(1000)), fmt.Sprintf("%070d", rnd.Intn(10)))
+			}
+			root = tr.Commit(store)
+			trr, err := immutable.NewTrieReader(m, store, root)
+			require.NoError(t, err)
+			var records recordingWriter
+			trr.Snapshot(&records)
+
+			verifyAll := func(records recordingWriter, maxPending ...int) (*common.InMemoryKVStore, error) {
+				dest := common.NewInMemoryKVStore()
+				v := immutable.NewSnapshotVerifier(m, root, dest, maxPending...)
+				for _, r := range records {
+					if err := v.Write(r[0], r[1]); err != nil {
+						return nil, err
+					}
+				}
+				return dest, v.Finish()
+			}
+			// in the snapshot order
+			dest, err := verifyAll(records, 0)
+			require.NoError(t, err)
+			trDest, err := immutable.NewTrieReader(m, dest, root)
+			require.NoError(t, err)
+			trr.Iterate(func(k, v []byte) bool {
+				require.EqualValues(t, v, trDest.Get(k))
+				return true
+			})
+			// in random order
+			shuffled := append(recordingWriter{}, records...)
+			rnd.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			_, err = verifyAll(shuffled)
+			require.NoError(t, err)
+			_, err = verifyAll(shuffled, 1)
+			require.True(t, errors.Is(err, immutable.ErrSnapshotTooManyPending))
+			// incomplete
+			_, err = verifyAll(records[1:])
+			require.True(t, errors.Is(err, immutable.ErrSnapshotIncomplete))
+			// tampered
+			for _, idx := range []int{0, len(records) / 2, len(records) - 1} {
+				tampered := append(recordingWriter{}, records...)
+				value := common.Concat(tampered[idx][1])
+				value[len(value)-1] ^= 0x01
+				tampered[idx] = [2][]byte{tampered[idx][0], value}
+				_, err = verifyAll(tampered)
+				require.True(t, errors.Is(err, immutable.ErrSnapshotTampered))
+			}
+		})
+	}
+}
+
+func TestSnapshotVerifierChunked(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160, 100)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < 300; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("%0150d", i%7))
+	}
+	root = tr.Commit(store)
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	var records recordingWriter
+	trr.Snapshot(&records)
+
+	dir := t.TempDir()
+	w, err := common.NewChunkedStreamWriter(dir, "snapshot", 2000)
+	require.NoError(t, err)
+	for _, r := range records {
+		require.NoError(t, w.Write(r[0], r[1]))
+	}
+	manifest, err := w.Close()
+	require.NoError(t, err)
+	require.True(t, len(manifest.Chunks) > 3)
+
+	chunks, err := common.OpenChunkedStream(dir, "snapshot")
+	require.NoError(t, err)
+	t.Run("any order", func(t *testing.T) {
+		dest := common.NewInMemoryKVStore()
+		v := immutable.NewSnapshotVerifier(m, root, dest)
+		for i := len(manifest.Chunks) - 1; i >= 0; i-- {
+			require.NoError(t, v.ReceiveChunk(chunks, i))
+		}
+		require.NoError(t, v.Finish())
+		trDest, err := immutable.NewTrieReader(m, dest, root)
+		require.NoError(t, err)
+		require.EqualValues(t, trr.GetStr("key5"), trDest.GetStr("key5"))
+	})
+	t.Run("incomplete", func(t *testing.T) {
+		v := immutable.NewSnapshotVerifier(m, root, nil)
+		for i := 0; i < len(manifest.Chunks)-1; i++ {
+			require.NoError(t, v.ReceiveChunk(chunks, i))
+		}
+		require.True(t, errors.Is(v.Finish(), immutable.ErrSnapshotIncomplete))
+	})
+	t.Run("tampered chunk", func(t *testing.T) {
+		// the first chunk starts with the root node: tampering is detected before other chunks are received
+		fname := filepath.Join(dir, manifest.Chunks[0].File)
+		data, err := os.ReadFile(fname)
+		require.NoError(t, err)
+		data[len(data)-1] ^= 0x01
+		require.NoError(t, os.WriteFile(fname, data, 0o644))
+		v := immutable.NewSnapshotVerifier(m, root, nil)
+		err = v.ReceiveChunk(chunks, 0)
+		require.True(t, errors.Is(err, immutable.ErrSnapshotTampered) || errors.Is(err, common.ErrChunkCorrupted))
+	})
+}
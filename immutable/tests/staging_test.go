@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagingStoreCommits(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	base := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(base, m, []byte("identity"))
+	staging := common.NewStagingStore(base)
+
+	// two commits staged and flushed atomically
+	tr, err := immutable.NewTrieChained(m, staging, root)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 50; j++ {
+			tr.UpdateStr(fmt.Sprintf("key%d-%d", i, j), fmt.Sprintf("value%d", i))
+		}
+		tr.CommitChained()
+	}
+	root2 := tr.Root()
+	_, err = immutable.NewTrieReader(m, base, root2)
+	require.Error(t, err)
+
+	require.NoError(t, staging.Flush(base.BatchedWriter()))
+	trr, err := immutable.NewTrieReader(m, base, root2)
+	require.NoError(t, err)
+	require.EqualValues(t, "value1", string(trr.GetStr("key1-10")))
+	require.EqualValues(t, "value0", string(trr.GetStr("key0-10")))
+}
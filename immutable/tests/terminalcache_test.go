@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_kzg_bn256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminalCache(t *testing.T) {
+	const numKeys = 500
+	value := func(i int) string {
+		switch i % 3 {
+		case 0:
+			return "1"
+		case 1:
+			return strings.Repeat("x", 100)
+		}
+		// longer than cached
+		return strings.Repeat("y", immutable.MaxTerminalCacheValueSize+1)
+	}
+	for _, m := range []common.CommitmentModel{
+		trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160),
+		trie_kzg_bn256.New(),
+	} {
+		t.Run(m.ShortName(), func(t *testing.T) {
+			commit := func(cache bool) (common.VCommitment, *immutable.CommitStats) {
+				store := common.NewInMemoryKVStore()
+				root := immutable.MustInitRoot(store, m, []byte("identity"))
+				tr, err := immutable.NewTrieUpdatable(m, store, root)
+				require.NoError(t, err)
+				tr.EnableTerminalCache(cache)
+				tr.EnableCommitStats(true)
+				for i := 0; i < numKeys; i++ {
+					tr.UpdateStr(fmt.Sprintf("key%d", i), value(i))
+				}
+				// rolled back updates do not count
+				tr.UpdateStr("rolled back", "1")
+				tr.Rollback()
+				for i := 0; i < numKeys; i++ {
+					tr.UpdateStr(fmt.Sprintf("key%d", i), value(i))
+				}
+				root = tr.CommitAndContinue(store)
+				stats := tr.LastCommitStats()
+
+				// the cache is reset by commit
+				tr.UpdateStr("other", "1")
+				tr.UpdateStr("other1", "1")
+				root = tr.CommitAndContinue(store)
+				if cache {
+					require.EqualValues(t, 1, tr.LastCommitStats().TerminalCacheHits)
+				}
+
+				trr, err := immutable.NewTrieReader(m, store, root)
+				require.NoError(t, err)
+				for i := 0; i < numKeys; i++ {
+					require.EqualValues(t, value(i), trr.GetStr(fmt.Sprintf("key%d", i)))
+				}
+				return root, stats
+			}
+			root, stats := commit(false)
+			require.EqualValues(t, 0, stats.TerminalCacheHits)
+			rootCached, statsCached := commit(true)
+			require.True(t, m.EqualCommitments(root, rootCached))
+			// two distinct cacheable values, each committed once
+			require.EqualValues(t, 2*(numKeys/3+1)-2, statsCached.TerminalCacheHits)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+type testTracer struct {
+	events []immutable.TraceEvent
+}
+
+func (t *testTracer) TraceOp(ev *immutable.TraceEvent) {
+	e := *ev
+	e.Key = append([]byte{}, ev.Key...)
+	t.events = append(t.events, e)
+}
+
+func TestTracer(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	tracer := &testTracer{}
+	tr.SetTracer(tracer)
+	tr.Update([]byte("a"), []byte("1"))
+	tr.Update([]byte("a"), []byte("2"))
+	tr.Delete([]byte("b"))
+	tr.Update([]byte("a"), nil)
+	tr.Update([]byte("c"), []byte("3"))
+	root = tr.Commit(store)
+
+	require.EqualValues(t, 6, len(tracer.events))
+	require.EqualValues(t, immutable.TraceOpCommit, tracer.events[5].Op)
+	expected := []struct {
+		op    immutable.TraceOp
+		key   string
+		found bool
+	}{
+		{immutable.TraceOpUpdate, "a", false},
+		{immutable.TraceOpUpdate, "a", true},
+		{immutable.TraceOpDelete, "b", false},
+		{immutable.TraceOpDelete, "a", true},
+		{immutable.TraceOpUpdate, "c", false},
+	}
+	for i, e := range expected {
+		require.EqualValues(t, e.op, tracer.events[i].Op)
+		require.EqualValues(t, e.key, string(tracer.events[i].Key))
+		require.EqualValues(t, e.found, tracer.events[i].Found)
+		require.NoError(t, tracer.events[i].Err)
+	}
+
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	tracer = &testTracer{}
+	trr.SetTracer(tracer)
+	require.EqualValues(t, "3", string(trr.Get([]byte("c"))))
+	require.Nil(t, trr.Get([]byte("a")))
+	require.EqualValues(t, 2, len(tracer.events))
+	require.EqualValues(t, immutable.TraceOpGet, tracer.events[0].Op)
+	require.True(t, tracer.events[0].Found)
+	require.False(t, tracer.events[1].Found)
+
+	trr.SetTracer(nil)
+	trr.Get([]byte("c"))
+	require.EqualValues(t, 2, len(tracer.events))
+}
+
+func TestTracerCommitAndPanic(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	tracer := &testTracer{}
+	tr.SetTracer(tracer)
+	tr.Update([]byte("a"), []byte("1"))
+	root = tr.Commit(store)
+	require.EqualValues(t, 2, len(tracer.events))
+	ev := tracer.events[1]
+	require.EqualValues(t, immutable.TraceOpCommit, ev.Op)
+	require.True(t, m.EqualCommitments(root, ev.Root))
+	require.False(t, ev.Start.IsZero())
+
+	// the trie is invalidated after Commit, the panic is traced and propagated
+	require.Panics(t, func() {
+		tr.Update([]byte("b"), []byte("2"))
+	})
+	require.EqualValues(t, 3, len(tracer.events))
+	require.Error(t, tracer.events[2].Err)
+	require.EqualValues(t, immutable.TraceOpUpdate, tracer.events[2].Op)
+}
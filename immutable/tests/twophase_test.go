@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoPhaseCommit(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	newTrie := func() (*common.InMemoryKVStore, *immutable.TrieUpdatable) {
+		store := common.NewInMemoryKVStore()
+		root := immutable.MustInitRoot(store, m, []byte("identity"))
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		}
+		return store, tr
+	}
+	storeExpected, tr := newTrie()
+	rootExpected := tr.Commit(storeExpected)
+
+	t.Run("commit", func(t *testing.T) {
+		store, tr := newTrie()
+		numKeys := store.Len()
+		pc := tr.PrepareCommit()
+		require.True(t, m.EqualCommitments(rootExpected, pc.Root()))
+		require.EqualValues(t, numKeys, store.Len())
+		require.Panics(t, func() { tr.UpdateStr("a", "b") })
+		require.Panics(t, func() { tr.Commit(store) })
+
+		root := pc.Commit(store)
+		require.True(t, m.EqualCommitments(rootExpected, root))
+		require.EqualValues(t, storeExpected.Len(), store.Len())
+		require.Panics(t, func() { pc.Abort() })
+
+		trr, err := immutable.NewTrieReader(m, store, root)
+		require.NoError(t, err)
+		require.EqualValues(t, "value5", string(trr.Get([]byte("key5"))))
+	})
+	t.Run("application writes the batch", func(t *testing.T) {
+		store, tr := newTrie()
+		pc := tr.PrepareCommit()
+		pc.Mutations().WriteTo(store)
+		root := pc.Commit(nil)
+		require.True(t, m.EqualCommitments(rootExpected, root))
+		require.NoError(t, immutable.VerifyIntegrity(store, m, root))
+	})
+	t.Run("abort", func(t *testing.T) {
+		store, tr := newTrie()
+		numKeys := store.Len()
+		initRoot := tr.Root()
+		pc := tr.PrepareCommit()
+		pc.Abort()
+		require.EqualValues(t, numKeys, store.Len())
+		require.True(t, m.EqualCommitments(initRoot, tr.Root()))
+		require.Nil(t, tr.Get([]byte("key5")))
+
+		tr.UpdateStr("key", "value")
+		root := tr.Commit(store)
+		require.False(t, m.EqualCommitments(rootExpected, root))
+		trr, err := immutable.NewTrieReader(m, store, root)
+		require.NoError(t, err)
+		require.EqualValues(t, "value", string(trr.Get([]byte("key"))))
+		require.Nil(t, trr.Get([]byte("key5")))
+	})
+}
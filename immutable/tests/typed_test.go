@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedTrie(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+
+	tt := immutable.NewTypedTrie(tr, immutable.Uint64Codec, immutable.StringCodec)
+	numbers := []uint64{1000, 1, 256, 65536, 2, 1 << 40}
+	for _, n := range numbers {
+		require.False(t, tt.Update(n, "value"))
+	}
+	require.True(t, tt.Update(2, "two"))
+	require.True(t, tt.Delete(1000))
+	require.False(t, tt.Delete(1000))
+	root = tt.Commit(store)
+
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	tr2 := immutable.NewTypedTrieReader(trr, immutable.Uint64Codec, immutable.StringCodec)
+
+	v, found, err := tr2.Get(2)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.EqualValues(t, "two", v)
+	_, found, err = tr2.Get(1000)
+	require.NoError(t, err)
+	require.False(t, found)
+	require.True(t, tr2.Has(256))
+	require.False(t, tr2.Has(1000))
+
+	// big-endian encoding: iteration is in the numeric order, the identity is skipped
+	expected := []uint64{1, 2, 256, 65536, 1 << 40}
+	keys := make([]uint64, 0)
+	err = tr2.Iterate(func(k uint64, v string) bool {
+		keys = append(keys, k)
+		return true
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, expected, keys)
+
+	keys = keys[:0]
+	err = tr2.IterateKeys(func(k uint64) bool {
+		keys = append(keys, k)
+		return true
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, expected, keys)
+
+	keys = keys[:0]
+	err = tr2.IterateKeys(func(k uint64) bool {
+		keys = append(keys, k)
+		return len(keys) < 2
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, expected[:2], keys)
+
+	// keys which are not 8 bytes can't be decoded
+	tr, err = immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	tr.UpdateStr("short", "value")
+	root = tr.Commit(store)
+	trr, err = immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	tr2 = immutable.NewTypedTrieReader(trr, immutable.Uint64Codec, immutable.StringCodec)
+	err = tr2.Iterate(func(uint64, string) bool { return true })
+	require.Error(t, err)
+	err = tr2.IterateKeys(func(uint64) bool { return true })
+	require.Error(t, err)
+
+	// value decode error propagates from Get and Iterate
+	errWrongValue := errors.New("wrong value")
+	failing := immutable.Codec[string]{
+		Encode: func(s string) []byte { return []byte(s) },
+		Decode: func([]byte) (string, error) { return "", errWrongValue },
+	}
+	tr3 := immutable.NewTypedTrieReader(trr, immutable.Uint64Codec, failing)
+	_, _, err = tr3.Get(2)
+	require.True(t, errors.Is(err, errWrongValue))
+	err = tr3.IteratePrefix(immutable.Uint64Codec.Encode(2), func(uint64, string) bool { return true })
+	require.True(t, errors.Is(err, errWrongValue))
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueBackReferences(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160, 10)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	long := strings.Repeat("long value ", 10)
+	tr.UpdateStr("a", long)
+	tr.UpdateStr("b", long)
+	tr.UpdateStr("c", "short")
+	tr.UpdateStr("d", long+"d")
+	root = tr.Commit(store)
+	tr, err = immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	tr.DeleteStr("d")
+	root = tr.Commit(store)
+
+	trr, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	refCount := make(map[string]int)
+	complete := trr.ValueBackReferences(store, 0, func(_, value []byte, refs [][]byte) bool {
+		refCount[string(value)] = len(refs)
+		return true
+	})
+	require.True(t, complete)
+	require.EqualValues(t, 2, refCount[long])
+	require.EqualValues(t, 0, refCount[long+"d"])
+	_, found := refCount["short"]
+	require.False(t, found)
+
+	complete = trr.ValueBackReferences(store, 1, func(_, _ []byte, _ [][]byte) bool {
+		return true
+	})
+	require.False(t, complete)
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueGenerations(t *testing.T) {
+	longValue := func(k string, i int) string {
+		return fmt.Sprintf("%s-%d-%s", k, i, strings.Repeat("v", 100))
+	}
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize256)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieChained(m, store, root)
+	require.NoError(t, err)
+	tr.EnableValueGenerations(2)
+
+	const numCommits = 7
+	keys := []string{"a", "ab", "abc", "klmn", "xyz"}
+	for i := 0; i < numCommits; i++ {
+		// the key 'a' is updated only in the first commit
+		for _, k := range keys {
+			if k == "a" && i > 0 {
+				continue
+			}
+			tr.UpdateStr(k, longValue(k, i))
+		}
+		tr = tr.CommitChained()
+	}
+	info, ok := immutable.ReadValueGenerationInfo(store)
+	require.True(t, ok)
+	require.EqualValues(t, 0, info.Oldest)
+	require.EqualValues(t, numCommits/2, info.Current)
+	require.EqualValues(t, 1, info.CommitsInCurrent)
+
+	checkLatest := func() {
+		tr1, err := immutable.NewTrieReader(m, store, tr.Root())
+		require.NoError(t, err)
+		for _, k := range keys {
+			if k == "a" {
+				require.EqualValues(t, longValue(k, 0), tr1.GetStr(k))
+			} else {
+				require.EqualValues(t, longValue(k, numCommits-1), tr1.GetStr(k))
+			}
+		}
+	}
+	checkLatest()
+
+	n := immutable.CarryForwardValues(tr.TrieReader, store, info.Current)
+	require.EqualValues(t, 1, n) // only 'a'
+	countOld := func() int {
+		ret := 0
+		for gen := uint32(0); gen < info.Current; gen++ {
+			store.Iterator(immutable.ValueGenerationPrefix(gen)).IterateKeys(func(_ []byte) bool {
+				ret++
+				return true
+			})
+		}
+		return ret
+	}
+	require.EqualValues(t, 5+4*5, countOld()) // all values of the first 6 commits
+	dropped, err := immutable.DropValueGenerations(store, info.Current)
+	require.NoError(t, err)
+	require.EqualValues(t, info.Current, dropped)
+	require.EqualValues(t, 0, countOld())
+
+	info, ok = immutable.ReadValueGenerationInfo(store)
+	require.True(t, ok)
+	require.EqualValues(t, info.Current, info.Oldest)
+	checkLatest()
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueRefCounts(t *testing.T) {
+	value1 := strings.Repeat("1", 100)
+	value2 := strings.Repeat("2", 100)
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize256)
+	valueKey1 := common.AsKey(m.CommitToData([]byte(value1)))
+	valueKey2 := common.AsKey(m.CommitToData([]byte(value2)))
+	hasValue := func(store common.KVReader, valueKey []byte) bool {
+		return store.Has(common.Concat(immutable.PartitionValues, valueKey))
+	}
+
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	commit := func(fun func(tr *immutable.TrieUpdatable)) *immutable.TrieReader {
+		tr, err := immutable.NewTrieUpdatable(m, store, root)
+		require.NoError(t, err)
+		tr.EnableValueRefCounts(true)
+		fun(tr)
+		var mut *common.Mutations
+		root, mut = tr.CommitMutations()
+		mut.WriteTo(store)
+		trr, err := immutable.NewTrieReader(m, store, root)
+		require.NoError(t, err)
+		return trr
+	}
+
+	// the same value under 3 keys is stored once
+	trr := commit(func(tr *immutable.TrieUpdatable) {
+		tr.UpdateStr("a", value1)
+		tr.UpdateStr("b", value1)
+		tr.UpdateStr("c", value1)
+	})
+	require.EqualValues(t, 3, trr.ValueRefCount(valueKey1))
+	require.True(t, hasValue(store, valueKey1))
+
+	// node 'a' is re-written because of the new child. The old node is pruned
+	trr = commit(func(tr *immutable.TrieUpdatable) {
+		tr.UpdateStr("ab", value2)
+	})
+	require.EqualValues(t, 3, trr.ValueRefCount(valueKey1))
+	require.EqualValues(t, 1, trr.ValueRefCount(valueKey2))
+
+	trr = commit(func(tr *immutable.TrieUpdatable) {
+		tr.UpdateStr("a", value2)
+		tr.DeleteStr("b")
+	})
+	require.EqualValues(t, 1, trr.ValueRefCount(valueKey1))
+	require.EqualValues(t, 2, trr.ValueRefCount(valueKey2))
+	require.True(t, hasValue(store, valueKey1))
+
+	trr = commit(func(tr *immutable.TrieUpdatable) {
+		tr.DeleteStr("c")
+	})
+	require.EqualValues(t, 0, trr.ValueRefCount(valueKey1))
+	require.False(t, hasValue(store, valueKey1))
+	require.True(t, hasValue(store, valueKey2))
+	require.EqualValues(t, value2, trr.GetStr("a"))
+	require.EqualValues(t, value2, trr.GetStr("ab"))
+
+	trr = commit(func(tr *immutable.TrieUpdatable) {
+		tr.DeleteStr("a")
+		tr.DeleteStr("ab")
+	})
+	require.EqualValues(t, 0, trr.ValueRefCount(valueKey2))
+	require.False(t, hasValue(store, valueKey2))
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_mpt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWitness(t *testing.T) {
+	runTest := func(m common.CommitmentModel) {
+		t.Run("stateless update "+m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieChained(m, store, root)
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+			}
+			tr = tr.CommitChained()
+			root = tr.Root()
+
+			mut := common.NewMutations()
+			mut.Set([]byte("key5"), []byte("new value"))
+			mut.Set([]byte("key17"), nil)
+			mut.Set([]byte("newkey"), []byte("newkey"))
+
+			// record witness while updating the full state
+			recorder := immutable.NewWitnessRecorder(store)
+			trRec, err := immutable.NewTrieUpdatable(m, recorder, root)
+			require.NoError(t, err)
+			mut.Iterate(func(k []byte, v []byte, _ bool) bool {
+				trRec.Update(k, v)
+				return true
+			})
+			expectedRoot := trRec.Commit(common.NewInMemoryKVStore())
+
+			var buf bytes.Buffer
+			err = recorder.Witness().Write(&buf)
+			require.NoError(t, err)
+			witness, err := immutable.ReadWitness(&buf)
+			require.NoError(t, err)
+			require.EqualValues(t, recorder.Witness().Len(), witness.Len())
+
+			newRoot, err := immutable.UpdateWithWitness(m, witness, root, mut)
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(expectedRoot, newRoot))
+
+			// the witness does not cover other keys
+			mut1 := common.NewMutations()
+			mut1.Set([]byte("key33"), []byte("zzz"))
+			_, err = immutable.UpdateWithWitness(m, witness, root, mut1)
+			require.True(t, errors.Is(err, immutable.ErrWitnessIncomplete))
+
+			// empty witness
+			_, err = immutable.UpdateWithWitness(m, immutable.NewWitness(), root, mut)
+			require.True(t, errors.Is(err, immutable.ErrWitnessIncomplete))
+		})
+	}
+	for _, arity := range common.AllPathArity {
+		for _, hs := range trie_blake2b.AllHashSize {
+			runTest(trie_blake2b.New(arity, hs))
+		}
+	}
+}
+
+func TestWitnessTampered(t *testing.T) {
+	runTest := func(m common.CommitmentModel) {
+		t.Run(m.ShortName(), func(t *testing.T) {
+			store := common.NewInMemoryKVStore()
+			root := immutable.MustInitRoot(store, m, []byte("identity"))
+			tr, err := immutable.NewTrieChained(m, store, root)
+			require.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				tr.UpdateStr(fmt.Sprintf("key%d", i), strings.Repeat(fmt.Sprintf("value%d", i), i%10))
+			}
+			tr = tr.CommitChained()
+			root = tr.Root()
+
+			mut := common.NewMutations()
+			mut.Set([]byte("key5"), []byte("new value"))
+			mut.Set([]byte("key17"), nil)
+			mut.Set([]byte("key49"), []byte("new value"))
+			recorder := immutable.NewWitnessRecorder(store)
+			trRec, err := immutable.NewTrieUpdatable(m, recorder, root)
+			require.NoError(t, err)
+			// the value stored outside the node
+			require.EqualValues(t, strings.Repeat("value39", 9), trRec.GetStr("key39"))
+			mut.Iterate(func(k []byte, v []byte, _ bool) bool {
+				trRec.Update(k, v)
+				return true
+			})
+			expectedRoot := trRec.Commit(common.NewInMemoryKVStore())
+			witnessBin := recorder.Witness().Bytes()
+
+			newRoot, err := immutable.UpdateWithWitness(m, recorder.Witness(), root, mut)
+			require.NoError(t, err)
+			require.True(t, m.EqualCommitments(expectedRoot, newRoot))
+
+			records := make([][2][]byte, 0)
+			err = common.NewBinaryStreamIterator(bytes.NewReader(witnessBin)).Iterate(func(k, v []byte) bool {
+				records = append(records, [2][]byte{k, v})
+				return true
+			})
+			require.NoError(t, err)
+			// tamper each record of the witness in turn
+			for i := range records {
+				var buf bytes.Buffer
+				w := common.NewBinaryStreamWriter(&buf)
+				for j, r := range records {
+					v := r[1]
+					if j == i {
+						v = common.Concat(v)
+						v[len(v)-1] ^= 0x01
+					}
+					require.NoError(t, w.Write(r[0], v))
+				}
+				witness, err := immutable.ReadWitness(&buf)
+				require.NoError(t, err)
+
+				_, err = immutable.UpdateWithWitness(m, witness, root, mut)
+				require.ErrorIs(t, err, immutable.ErrWitnessInvalid, "record %x", records[i][0])
+				_, err = immutable.NewTrieUpdatableFromWitness(m, witness, root)
+				require.ErrorIs(t, err, immutable.ErrWitnessInvalid, "record %x", records[i][0])
+			}
+		})
+	}
+	for _, arity := range common.AllPathArity {
+		runTest(trie_blake2b.New(arity, trie_blake2b.HashSize160))
+	}
+	runTest(trie_mpt.New())
+}
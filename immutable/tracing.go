@@ -0,0 +1,87 @@
+package immutable
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// TraceOp is the traced operation of the trie
+type TraceOp byte
+
+const (
+	TraceOpGet = TraceOp(iota)
+	TraceOpUpdate
+	TraceOpDelete
+	TraceOpCommit
+)
+
+func (op TraceOp) String() string {
+	switch op {
+	case TraceOpGet:
+		return "get"
+	case TraceOpUpdate:
+		return "update"
+	case TraceOpDelete:
+		return "delete"
+	case TraceOpCommit:
+		return "commit"
+	default:
+		return fmt.Sprintf("TraceOp(%d)", byte(op))
+	}
+}
+
+type (
+	// Tracer is invoked after each Get, Update, Delete and commit of the trie. It allows plugging structured
+	// logging or tracing spans (with explicit start timestamp) without changing the package.
+	// The event and its key must not be retained after the call
+	Tracer interface {
+		TraceOp(ev *TraceEvent)
+	}
+
+	// TraceEvent describes the traced operation
+	TraceEvent struct {
+		Op TraceOp
+		// Key user key of Get, Update and Delete. Nil for commits
+		Key      []byte
+		Start    time.Time
+		Duration time.Duration
+		// Found for Get: the key is present. For Update and Delete: the key existed before
+		Found bool
+		// Root the new root committed. Nil for other operations
+		Root common.VCommitment
+		// Err is not nil if the operation panicked. The panic is propagated after the tracer returns
+		Err error
+	}
+)
+
+// SetTracer sets the tracer of the trie operations. nil disables tracing
+func (tr *TrieReader) SetTracer(t Tracer) {
+	tr.tracer = t
+}
+
+// trace returns the function to be deferred by the traced operation. Function outcome fills in the result
+// of the operation and is not called if the operation panicked
+func (tr *TrieReader) trace(op TraceOp, key []byte, outcome func(ev *TraceEvent)) func() {
+	ev := &TraceEvent{
+		Op:    op,
+		Key:   key,
+		Start: time.Now(),
+	}
+	return func() {
+		ev.Duration = time.Since(ev.Start)
+		r := recover()
+		if r == nil {
+			outcome(ev)
+			tr.tracer.TraceOp(ev)
+			return
+		}
+		var ok bool
+		if ev.Err, ok = r.(error); !ok {
+			ev.Err = fmt.Errorf("%v", r)
+		}
+		tr.tracer.TraceOp(ev)
+		panic(r)
+	}
+}
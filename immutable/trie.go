@@ -2,15 +2,23 @@ package immutable
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/lunfardo314/unitrie/common"
 )
 
 type (
-	// TrieReader direct read-only access to trie
+	// TrieReader direct read-only access to trie.
+	// TrieReader is thread-safe for reading if the underlying store is: one reader can serve many goroutines.
+	// Configuration, such as SetMetrics and SetTracer, must be done before the reader is shared,
+	// and the metrics sink and the tracer must be thread-safe themselves
 	TrieReader struct {
 		nodeStore      *NodeStore
 		persistentRoot common.VCommitment
+		// if true, user keys are hashed before accessing the trie. See NewSecureTrieReader
+		secureKeys bool
+		// tracer of operations. Nil if not traced. See SetTracer
+		tracer Tracer
 	}
 
 	// TrieUpdatable is an updatable trie implemented on top of the unpackedKey/value store. It is virtualized and optimized by caching of the
@@ -18,6 +26,23 @@ type (
 	TrieUpdatable struct {
 		*TrieReader
 		mutatedRoot *bufferedNode
+		// buffered nodes are allocated in the arena, which is reset on commit and rollback
+		arena *nodeArena
+		// if > 0, values are written into the generational partition. See EnableValueGenerations
+		commitsPerGeneration int
+		// statistics of the current and of the last commit. See EnableCommitStats
+		stats, lastStats *CommitStats
+		amplification    WriteAmplification
+		// preimages of hashed keys, to be written on commit. Nil if preimages are not stored
+		preimages map[string][]byte
+		// if true, references to the values are counted. See EnableValueRefCounts
+		countValueRefs bool
+		// compression of values on commit. See EnableValueCompression
+		valueCompression ValueCompression
+		// cache of terminal commitments within the commit. Nil if disabled. See EnableTerminalCache
+		terminalCache *terminalCache
+		// true between PrepareCommit and the end of the prepared commit
+		prepared bool
 	}
 
 	// TrieChained always commits back to the same store
@@ -27,24 +52,29 @@ type (
 	}
 )
 
-func NewTrieUpdatable(m common.CommitmentModel, store common.KVReader, root common.VCommitment, clearCacheAtSize ...int) (*TrieUpdatable, error) {
-	trieReader, rootNodeData, err := newTrieReader(m, store, root, clearCacheAtSize...)
+func NewTrieUpdatable(m common.CommitmentModel, store common.KVReader, root common.VCommitment, cacheSize ...int) (*TrieUpdatable, error) {
+	trieReader, rootNodeData, err := newTrieReader(m, store, root, cacheSize...)
 	if err != nil {
 		return nil, err
 	}
-	return &TrieUpdatable{
-		TrieReader:  trieReader,
-		mutatedRoot: newBufferedNode(rootNodeData, nil),
-	}, nil
+	ret := &TrieUpdatable{
+		TrieReader: trieReader,
+		arena:      &nodeArena{},
+	}
+	ret.mutatedRoot = ret.newMutatedRoot(rootNodeData)
+	return ret, nil
 }
 
-func NewTrieReader(m common.CommitmentModel, store common.KVReader, root common.VCommitment, clearCacheAtSize ...int) (*TrieReader, error) {
-	ret, _, err := newTrieReader(m, store, root, clearCacheAtSize...)
+// NewTrieReader creates reader of the trie with the root. Optional cacheSize bounds the LRU cache of trie nodes:
+// cacheSize[0] is maximum number of nodes, cacheSize[1] is maximum size of cached nodes in bytes (0 means unbounded).
+// Nodes are not cached if both limits are 0. By default, DefaultNodeCacheSize nodes are cached
+func NewTrieReader(m common.CommitmentModel, store common.KVReader, root common.VCommitment, cacheSize ...int) (*TrieReader, error) {
+	ret, _, err := newTrieReader(m, store, root, cacheSize...)
 	return ret, err
 }
 
-func NewTrieChained(m common.CommitmentModel, store common.KVStore, root common.VCommitment, clearCacheAtSize ...int) (*TrieChained, error) {
-	trie, err := NewTrieUpdatable(m, store, root, clearCacheAtSize...)
+func NewTrieChained(m common.CommitmentModel, store common.KVStore, root common.VCommitment, cacheSize ...int) (*TrieChained, error) {
+	trie, err := NewTrieUpdatable(m, store, root, cacheSize...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,8 +84,8 @@ func NewTrieChained(m common.CommitmentModel, store common.KVStore, root common.
 	}, nil
 }
 
-func newTrieReader(m common.CommitmentModel, store common.KVReader, root common.VCommitment, clearCacheAtSize ...int) (*TrieReader, *common.NodeData, error) {
-	s := openImmutableNodeStore(store, m, clearCacheAtSize...)
+func newTrieReader(m common.CommitmentModel, store common.KVReader, root common.VCommitment, cacheSize ...int) (*TrieReader, *common.NodeData, error) {
+	s := openImmutableNodeStore(store, m, cacheSize...)
 	rootNodeData, ok := s.FetchNodeData(root)
 	if !ok {
 		return nil, nil, fmt.Errorf("root commitment '%s' does not exist", root)
@@ -86,32 +116,150 @@ func (tr *TrieReader) ClearCache() {
 // and writes it into the store.
 // The nodes and values are written into separate partitions
 // The buffered nodes are garbage collected, except the mutated ones
-// The object is invalidated, to access the trie new object must be created (or use TrieChained)
-func (tr *TrieUpdatable) Commit(store common.KVWriter) common.VCommitment {
+// The object is invalidated, to access the trie new object must be created (or use CommitAndContinue)
+func (tr *TrieUpdatable) Commit(store common.KVWriter) (ret common.VCommitment) {
+	if tr.tracer != nil {
+		defer tr.trace(TraceOpCommit, nil, func(ev *TraceEvent) { ev.Root = ret })()
+	}
 	common.Assertf(!common.IsNil(tr.persistentRoot), "Commit:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "Commit:: commit of the trie is prepared")
+
+	defer tr.observeCommitDuration(time.Now())
+	tr.commitBuffered(store).write(store)
+	return tr.finalizeCommit()
+}
+
+// CommitAndContinue commits the trie like Commit, however the object is not invalidated: the persistent root
+// is updated in place and the trie can be updated further. The node cache is preserved.
+// The committed nodes must be readable from the store the trie was created with, i.e. normally
+// the store parameter is the same store (or a batch which is flushed to it before the next read)
+func (tr *TrieUpdatable) CommitAndContinue(store common.KVWriter) (ret common.VCommitment) {
+	if tr.tracer != nil {
+		defer tr.trace(TraceOpCommit, nil, func(ev *TraceEvent) { ev.Root = ret })()
+	}
+	common.Assertf(!common.IsNil(tr.persistentRoot), "CommitAndContinue:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "CommitAndContinue:: commit of the trie is prepared")
 
-	triePartition := common.MakeWriterPartition(store, PartitionTrieNodes)
-	valuePartition := common.MakeWriterPartition(store, PartitionValues)
+	defer tr.observeCommitDuration(time.Now())
+	tr.commitBuffered(store).write(store)
+	ret = tr.finalizeCommit()
+	tr.persistentRoot = ret.Clone()
+	tr.mutatedRoot = tr.newMutatedRoot(tr.mutatedRoot.nodeData)
+	return ret
+}
+
+// CommitMutations commits the trie like Commit, but instead of writing into the store, it returns all
+// the changes as a Mutations. It allows the application to bundle trie changes atomically
+// with its own writes in one DB batch.
+// In addition to new nodes and values, the mutations contain deletions of all trie nodes of the previous root
+// which are not reachable from the new root. After the mutations are applied, the previous
+// root cannot be read anymore. Values are not deleted because the same value can be shared by many keys,
+// unless references to values are counted (see EnableValueRefCounts): then values, which are not
+// referenced anymore, are deleted too.
+// If commitments of the model do not depend on positions of nodes (see common.CommitmentsDependOnPosition),
+// the node of the previous root may be shared with another position in the new root, so nodes are not deleted
+// and the previous root remains readable
+// The object is invalidated
+func (tr *TrieUpdatable) CommitMutations() (root common.VCommitment, mut *common.Mutations) {
+	if tr.tracer != nil {
+		defer tr.trace(TraceOpCommit, nil, func(ev *TraceEvent) { ev.Root = root })()
+	}
+	common.Assertf(!common.IsNil(tr.persistentRoot), "CommitMutations:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "CommitMutations:: commit of the trie is prepared")
 
-	tr.mutatedRoot.commitNode(triePartition, valuePartition, tr.Model())
+	defer tr.observeCommitDuration(time.Now())
+	ret := common.NewMutations()
+	refs := tr.commitBuffered(ret)
+
+	if common.CommitmentsDependOnPosition(tr.Model()) {
+		triePartition := common.MakeWriterPartition(ret, PartitionTrieNodes)
+		tr.iterateReplacedNodes(func(n *common.NodeData) {
+			triePartition.Set(common.AsKey(n.Commitment), nil)
+			refs.nodeDeleted(n)
+		})
+		triePartition.Dispose()
+	}
+	refs.write(ret)
+	return tr.finalizeCommit(), ret
+}
+
+// commitBuffered calculates commitments of the buffered nodes and writes changed nodes and new values into the store.
+// Returns changes of value reference counters to be written by the caller, nil if references are not counted
+func (tr *TrieUpdatable) commitBuffered(store common.KVWriter) *valueRefCounts {
+	if tr.stats != nil {
+		tr.stats.MaxDepth = tr.mutatedRoot.maxDepth()
+		store = &statsWriter{w: store, stats: tr.stats}
+	}
+	triePartition := &nodeCountingWriter{w: common.MakeWriterPartition(store, PartitionTrieNodes)}
+	var valuePartition common.KVWriter
+	if tr.commitsPerGeneration > 0 {
+		valuePartition = tr.valueGenerationWriter(store)
+	} else if tr.valueCompression != ValueCompressionNone {
+		valuePartition = &compressingWriter{
+			values:     common.MakeWriterPartition(store, PartitionValues),
+			compressed: common.MakeWriterPartition(store, PartitionCompressedValues),
+			c:          tr.valueCompression,
+		}
+	} else {
+		valuePartition = common.MakeWriterPartition(store, PartitionValues)
+	}
+	refs := tr.newValueRefCounts()
+	tr.mutatedRoot.commitNode(triePartition, valuePartition, tr.Model(), refs)
+	tr.nodeStore.metrics.AddCounter(common.MetricNodesWritten, triePartition.count)
+	tr.writePreimages(store)
+	return refs
+}
+
+// finalizeCommit invalidates the object and returns the new root
+func (tr *TrieUpdatable) finalizeCommit() common.VCommitment {
 	// set uncommitted children in the root to empty -> the GC will collect the whole tree of buffered nodes
-	tr.mutatedRoot.uncommittedChildren = make(map[byte]*bufferedNode)
+	// or the arena will reuse them
+	tr.mutatedRoot.uncommittedChildren = nil
+	tr.arena.reset()
+	if tr.terminalCache != nil {
+		hits := tr.terminalCache.reset()
+		if tr.stats != nil {
+			tr.stats.TerminalCacheHits = hits
+		}
+	}
 
+	if tr.stats != nil {
+		tr.lastStats = tr.stats
+		tr.accumulateStats(tr.lastStats)
+		tr.stats = newCommitStats()
+	}
 	ret := tr.mutatedRoot.nodeData.Commitment.Clone()
 	tr.persistentRoot = nil // invalidate
 	return ret
 }
 
+// Rollback discards all buffered, uncommitted mutations. The trie returns to the state of the persistent root.
+// The node cache is preserved
+func (tr *TrieUpdatable) Rollback() {
+	common.Assertf(!common.IsNil(tr.persistentRoot), "Rollback:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "Rollback:: commit of the trie is prepared")
+	tr.arena.reset()
+	tr.mutatedRoot = tr.newMutatedRoot(tr.nodeStore.MustFetchNodeData(tr.persistentRoot))
+	if tr.terminalCache != nil {
+		tr.terminalCache.reset()
+	}
+	if tr.preimages != nil {
+		tr.preimages = make(map[string][]byte)
+	}
+	if tr.stats != nil {
+		tr.stats = newCommitStats()
+	}
+}
+
+// CommitChained commits to the store of the chained trie and continues with the same object
 func (trc *TrieChained) CommitChained() *TrieChained {
-	newRoot := trc.Commit(trc.store)
-	ret, err := NewTrieChained(trc.Model(), trc.store, newRoot, trc.nodeStore.clearCacheAtSize)
-	common.Assertf(err == nil, "TrieChained.Commit:: can create new chained trie object: %v", err)
-	return ret
+	trc.CommitAndContinue(trc.store)
+	return trc
 }
 
 func (tr *TrieUpdatable) newTerminalNode(triePath, pathFragment, value []byte) *bufferedNode {
-	ret := newBufferedNode(nil, triePath)
+	ret := tr.arena.newBufferedNode(nil, triePath)
 	ret.setPathFragment(pathFragment)
-	ret.setValue(value, tr.Model())
+	ret.setValue(value, tr.dataCommitter())
 	return ret
 }
@@ -0,0 +1,69 @@
+package immutable
+
+import (
+	"time"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// PreparedCommit is the first phase of the two-phase commit of the trie. The new root and all the writes
+// of the commit are calculated, but nothing is written to the store yet. The commit is completed with
+// Commit or discarded with Abort, so the trie commit can participate in the application-level transaction
+// spanning other databases. The trie can't be updated while the commit is prepared
+type PreparedCommit struct {
+	tr    *TrieUpdatable
+	root  common.VCommitment
+	batch *common.Mutations
+	done  bool
+}
+
+// PrepareCommit calculates the new root and the batch of writes of the commit
+func (tr *TrieUpdatable) PrepareCommit() *PreparedCommit {
+	common.Assertf(!common.IsNil(tr.persistentRoot), "PrepareCommit:: updatable trie is invalidated")
+	common.Assertf(!tr.prepared, "PrepareCommit:: commit of the trie is prepared")
+
+	defer tr.observeCommitDuration(time.Now())
+	batch := common.NewMutations()
+	tr.commitBuffered(batch).write(batch)
+	tr.prepared = true
+	return &PreparedCommit{
+		tr:    tr,
+		root:  tr.mutatedRoot.nodeData.Commitment.Clone(),
+		batch: batch,
+	}
+}
+
+// Root returns the root the trie will be committed to
+func (pc *PreparedCommit) Root() common.VCommitment {
+	return pc.root
+}
+
+// Mutations returns the batch of writes of the commit. The application may write it into the store
+// within its own transaction instead of calling Commit with the store
+func (pc *PreparedCommit) Mutations() *common.Mutations {
+	return pc.batch
+}
+
+// Commit writes the batch into the store and completes the commit. If store is nil, the batch is assumed to
+// be already written by the application. Like TrieUpdatable.Commit, the trie is invalidated
+func (pc *PreparedCommit) Commit(store common.KVWriter) (ret common.VCommitment) {
+	common.Assertf(!pc.done, "PreparedCommit.Commit:: prepared commit is already completed")
+	if pc.tr.tracer != nil {
+		defer pc.tr.trace(TraceOpCommit, nil, func(ev *TraceEvent) { ev.Root = ret })()
+	}
+	if store != nil {
+		pc.batch.WriteTo(store)
+	}
+	pc.done = true
+	pc.tr.prepared = false
+	return pc.tr.finalizeCommit()
+}
+
+// Abort discards the batch. The trie returns to the state of the persistent root, like after Rollback
+func (pc *PreparedCommit) Abort() {
+	common.Assertf(!pc.done, "PreparedCommit.Abort:: prepared commit is already completed")
+	pc.done = true
+	pc.batch = nil
+	pc.tr.prepared = false
+	pc.tr.Rollback()
+}
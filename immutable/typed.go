@@ -0,0 +1,183 @@
+package immutable
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+type (
+	// Codec converts typed keys or values to bytes and back
+	Codec[T any] struct {
+		Encode func(T) []byte
+		Decode func([]byte) (T, error)
+	}
+
+	// TypedTrieReader is a typed read-only facade of the TrieReader
+	TypedTrieReader[K, V any] struct {
+		tr         *TrieReader
+		keyCodec   Codec[K]
+		valueCodec Codec[V]
+	}
+
+	// TypedTrie is a typed facade of the TrieUpdatable
+	TypedTrie[K, V any] struct {
+		TypedTrieReader[K, V]
+		tr *TrieUpdatable
+	}
+)
+
+func NewTypedTrieReader[K, V any](tr *TrieReader, keyCodec Codec[K], valueCodec Codec[V]) *TypedTrieReader[K, V] {
+	return &TypedTrieReader[K, V]{
+		tr:         tr,
+		keyCodec:   keyCodec,
+		valueCodec: valueCodec,
+	}
+}
+
+func NewTypedTrie[K, V any](tr *TrieUpdatable, keyCodec Codec[K], valueCodec Codec[V]) *TypedTrie[K, V] {
+	return &TypedTrie[K, V]{
+		TypedTrieReader: TypedTrieReader[K, V]{
+			tr:         tr.TrieReader,
+			keyCodec:   keyCodec,
+			valueCodec: valueCodec,
+		},
+		tr: tr,
+	}
+}
+
+// Reader returns the underlying untyped trie reader
+func (t *TypedTrieReader[K, V]) Reader() *TrieReader {
+	return t.tr
+}
+
+// Get returns value by key. Returns false if key is absent
+func (t *TypedTrieReader[K, V]) Get(key K) (V, bool, error) {
+	var ret V
+	data := t.tr.Get(t.keyCodec.Encode(key))
+	if len(data) == 0 {
+		return ret, false, nil
+	}
+	ret, err := t.valueCodec.Decode(data)
+	if err != nil {
+		return ret, false, err
+	}
+	return ret, true, nil
+}
+
+func (t *TypedTrieReader[K, V]) Has(key K) bool {
+	return t.tr.Has(t.keyCodec.Encode(key))
+}
+
+// Iterate iterates all typed key/value pairs in the deterministic order of the trie. The identity is skipped.
+// Stops and returns error if key or value can't be decoded
+func (t *TypedTrieReader[K, V]) Iterate(fun func(key K, value V) bool) error {
+	return t.iterate(t.tr.Iterator(nil), fun)
+}
+
+// IteratePrefix iterates all typed key/value pairs with the keys which have the encoded prefix
+func (t *TypedTrieReader[K, V]) IteratePrefix(prefix []byte, fun func(key K, value V) bool) error {
+	return t.iterate(t.tr.Iterator(prefix), fun)
+}
+
+// IterateKeys iterates all typed keys in the deterministic order of the trie without reading values.
+// The identity is skipped.
+// Stops and returns error if key can't be decoded
+func (t *TypedTrieReader[K, V]) IterateKeys(fun func(key K) bool) error {
+	return t.iterateKeys(t.tr.Iterator(nil), fun)
+}
+
+// IterateKeysPrefix iterates all typed keys which have the encoded prefix without reading values
+func (t *TypedTrieReader[K, V]) IterateKeysPrefix(prefix []byte, fun func(key K) bool) error {
+	return t.iterateKeys(t.tr.Iterator(prefix), fun)
+}
+
+func (t *TypedTrieReader[K, V]) iterateKeys(it common.KVIterator, fun func(key K) bool) error {
+	var err error
+	it.IterateKeys(func(k []byte) bool {
+		if len(k) == 0 {
+			// the identity of the trie is not a typed key
+			return true
+		}
+		var key K
+		if key, err = t.keyCodec.Decode(k); err != nil {
+			err = fmt.Errorf("TypedTrie: can't decode key: %w", err)
+			return false
+		}
+		return fun(key)
+	})
+	return err
+}
+
+func (t *TypedTrieReader[K, V]) iterate(it common.KVIterator, fun func(key K, value V) bool) error {
+	var err error
+	it.Iterate(func(k []byte, v []byte) bool {
+		if len(k) == 0 {
+			// the identity of the trie is not a typed key
+			return true
+		}
+		var key K
+		var value V
+		if key, err = t.keyCodec.Decode(k); err != nil {
+			err = fmt.Errorf("TypedTrie: can't decode key: %w", err)
+			return false
+		}
+		if value, err = t.valueCodec.Decode(v); err != nil {
+			err = fmt.Errorf("TypedTrie: can't decode value: %w", err)
+			return false
+		}
+		return fun(key, value)
+	})
+	return err
+}
+
+// Trie returns the underlying untyped updatable trie
+func (t *TypedTrie[K, V]) Trie() *TrieUpdatable {
+	return t.tr
+}
+
+// Update updates the key with the value. Returns true if the key existed before.
+// Value encoded to empty slice means deletion of the key
+func (t *TypedTrie[K, V]) Update(key K, value V) bool {
+	return t.tr.Update(t.keyCodec.Encode(key), t.valueCodec.Encode(value))
+}
+
+// Delete deletes the key. Returns true if the key existed before
+func (t *TypedTrie[K, V]) Delete(key K) bool {
+	return t.tr.Delete(t.keyCodec.Encode(key))
+}
+
+// Commit commits the underlying trie. See TrieUpdatable.Commit
+func (t *TypedTrie[K, V]) Commit(store common.KVWriter) common.VCommitment {
+	return t.tr.Commit(store)
+}
+
+// ---------------------------------------------------------------------------
+// predefined codecs
+
+// BytesCodec is an identity codec
+var BytesCodec = Codec[[]byte]{
+	Encode: func(b []byte) []byte { return b },
+	Decode: func(b []byte) ([]byte, error) { return b, nil },
+}
+
+var StringCodec = Codec[string]{
+	Encode: func(s string) []byte { return []byte(s) },
+	Decode: func(b []byte) (string, error) { return string(b), nil },
+}
+
+// Uint64Codec encodes uint64 as 8 bytes big-endian, so the order of iteration is the numeric order
+var Uint64Codec = Codec[uint64]{
+	Encode: func(n uint64) []byte {
+		var ret [8]byte
+		binary.BigEndian.PutUint64(ret[:], n)
+		return ret[:]
+	},
+	Decode: func(b []byte) (uint64, error) {
+		if len(b) != 8 {
+			return 0, fmt.Errorf("Uint64Codec: expected 8 bytes, got %d", len(b))
+		}
+		return binary.BigEndian.Uint64(b), nil
+	},
+}
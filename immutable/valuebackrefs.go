@@ -0,0 +1,40 @@
+package immutable
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// ValueBackReferences is a forensic tool for investigating storage growth of the value partition.
+// It iterates all blobs stored in the value partition of the store and, for each blob, reports keys of the trie,
+// which terminals reference the blob.
+// The search of references is bounded: at most maxNodes nodes of the trie are visited (maxNodes <= 0 means no limit).
+// Returns true if the whole trie was visited, i.e. blobs without references are not referenced from the root.
+// If result is false, references are only reported for the visited part of the trie.
+// Values in the generational partitions are not enumerated. Iteration stops when callback returns false
+func (tr *TrieReader) ValueBackReferences(store common.KVTraversableReader, maxNodes int, fun func(valueKey, value []byte, refs [][]byte) bool) bool {
+	refs := make(map[string][][]byte)
+	count := 0
+	complete := tr.iterateNodes(tr.persistentRoot, nil, func(nodeKey []byte, n *common.NodeData) bool {
+		if maxNodes > 0 && count >= maxNodes {
+			return false
+		}
+		count++
+		if common.IsNil(n.Terminal) {
+			return true
+		}
+		if _, inTheCommitment := n.Terminal.ExtractValue(); inTheCommitment {
+			return true
+		}
+		key, err := common.PackUnpackedBytes(common.Concat(nodeKey, n.PathFragment), tr.PathArity())
+		common.AssertNoError(err)
+		valueKey := string(common.AsKey(n.Terminal))
+		refs[valueKey] = append(refs[valueKey], key)
+		return true
+	})
+
+	store.Iterator([]byte{PartitionValues}).Iterate(func(k, v []byte) bool {
+		valueKey := k[1:] // skip partition prefix
+		return fun(valueKey, v, refs[string(valueKey)])
+	})
+	return complete
+}
@@ -0,0 +1,217 @@
+package immutable
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Generational value partition.
+// When enabled, values are written into the partition PartitionValueGenerations, into sub-partitions
+// prefixed with 4 bytes (big-endian) of the generation number. The generation is rotated every N commits.
+// Pruning of the old history can drop whole generation with one range deletion, instead of deleting
+// values key by key. Values, still referenced from the retained roots, must be carried forward
+// into the current generation with CarryForwardValues before the generation is dropped.
+// The ValueGenerationInfo record is stored under the empty key in the PartitionValueGenerations
+
+// ValueGenerationInfo is the persistent state of generations
+type ValueGenerationInfo struct {
+	// Oldest is the oldest generation which has not been dropped yet
+	Oldest uint32
+	// Current is the generation the values are written to
+	Current uint32
+	// CommitsInCurrent number of commits written into the current generation
+	CommitsInCurrent uint32
+}
+
+func (g *ValueGenerationInfo) Bytes() []byte {
+	ret := make([]byte, 12)
+	binary.BigEndian.PutUint32(ret[0:4], g.Oldest)
+	binary.BigEndian.PutUint32(ret[4:8], g.Current)
+	binary.BigEndian.PutUint32(ret[8:12], g.CommitsInCurrent)
+	return ret
+}
+
+func ValueGenerationInfoFromBytes(data []byte) (*ValueGenerationInfo, error) {
+	if len(data) != 12 {
+		return nil, fmt.Errorf("ValueGenerationInfoFromBytes: wrong data length %d", len(data))
+	}
+	return &ValueGenerationInfo{
+		Oldest:           binary.BigEndian.Uint32(data[0:4]),
+		Current:          binary.BigEndian.Uint32(data[4:8]),
+		CommitsInCurrent: binary.BigEndian.Uint32(data[8:12]),
+	}, nil
+}
+
+// ReadValueGenerationInfo reads the state of generations from the store. Returns false if generations were never used
+func ReadValueGenerationInfo(store common.KVReader) (*ValueGenerationInfo, bool) {
+	data := store.Get([]byte{PartitionValueGenerations})
+	if len(data) == 0 {
+		return nil, false
+	}
+	ret, err := ValueGenerationInfoFromBytes(data)
+	common.AssertNoError(err, "ReadValueGenerationInfo")
+	return ret, true
+}
+
+// ValueGenerationPrefix return the store key prefix of the generation sub-partition
+func ValueGenerationPrefix(gen uint32) []byte {
+	ret := make([]byte, 5)
+	ret[0] = PartitionValueGenerations
+	binary.BigEndian.PutUint32(ret[1:], gen)
+	return ret
+}
+
+func generationBytes(gen uint32) []byte {
+	var ret [4]byte
+	binary.BigEndian.PutUint32(ret[:], gen)
+	return ret[:]
+}
+
+// EnableValueGenerations makes Commit to write values into the generational partition.
+// The generation is rotated after every commitsPerGeneration commits. 0 disables generations
+func (tr *TrieUpdatable) EnableValueGenerations(commitsPerGeneration int) {
+	common.Assertf(commitsPerGeneration >= 0, "EnableValueGenerations: commitsPerGeneration must be non-negative")
+	tr.commitsPerGeneration = commitsPerGeneration
+}
+
+// valueGenerationWriter rotates generation if needed, writes the updated info into the store and
+// returns writer to the current generation
+func (tr *TrieUpdatable) valueGenerationWriter(store common.KVWriter) common.KVWriter {
+	info, ok := tr.nodeStore.readValueGenerationInfo()
+	if !ok {
+		info = &ValueGenerationInfo{}
+	}
+	if int(info.CommitsInCurrent) >= tr.commitsPerGeneration {
+		info.Current++
+		info.CommitsInCurrent = 0
+	}
+	info.CommitsInCurrent++
+	genPartition := common.MakeWriterPartition(store, PartitionValueGenerations)
+	genPartition.Set(nil, info.Bytes())
+	return &generationWriter{
+		w:   genPartition,
+		gen: generationBytes(info.Current),
+	}
+}
+
+type generationWriter struct {
+	w   common.KVWriter
+	gen []byte
+}
+
+func (g *generationWriter) Set(key, value []byte) {
+	g.w.Set(common.Concat(g.gen, key), value)
+}
+
+func (ns *NodeStore) readValueGenerationInfo() (*ValueGenerationInfo, bool) {
+	data := ns.valueGenStore.Get(nil)
+	if len(data) == 0 {
+		return nil, false
+	}
+	ret, err := ValueGenerationInfoFromBytes(data)
+	common.AssertNoError(err, "readValueGenerationInfo")
+	return ret, true
+}
+
+// fetchValue looks for the value in the value partition and in the compressed value partition.
+// If not found, it looks in all live generations, starting from the newest. Returns value and generation.
+// The generation is meaningless if value is found in the value partition
+func (ns *NodeStore) fetchValue(key []byte) ([]byte, uint32, bool) {
+	ns.metrics.AddCounter(common.MetricValueGets, 1)
+	if ret := ns.valueStore.Get(key); len(ret) > 0 {
+		return ret, 0, false
+	}
+	if ret := ns.getCompressedValue(key); len(ret) > 0 {
+		return ret, 0, false
+	}
+	info, ok := ns.readValueGenerationInfo()
+	if !ok {
+		return nil, 0, false
+	}
+	for gen := info.Current; ; gen-- {
+		if ret := ns.valueGenStore.Get(common.Concat(generationBytes(gen), key)); len(ret) > 0 {
+			return ret, gen, true
+		}
+		if gen == info.Oldest {
+			break
+		}
+	}
+	return nil, 0, false
+}
+
+func (ns *NodeStore) getValue(key []byte) []byte {
+	ret, _, _ := ns.fetchValue(key)
+	return ret
+}
+
+// getValueFunc same as getValue, only the uncompressed value from the value partition is not copied
+func (ns *NodeStore) getValueFunc(key []byte, f func(value []byte)) bool {
+	if common.GetFunc(ns.valueStore, key, f) {
+		ns.metrics.AddCounter(common.MetricValueGets, 1)
+		return true
+	}
+	ret := ns.getValue(key)
+	if len(ret) == 0 {
+		return false
+	}
+	f(ret)
+	return true
+}
+
+// CarryForwardValues copies values committed in the root of the trie reader and stored in generations older than
+// 'olderThan' into the current generation. It must be called for every root to be retained
+// before DropValueGenerations. Returns number of values copied
+func CarryForwardValues(tr *TrieReader, store common.KVWriter, olderThan uint32) int {
+	info, ok := tr.nodeStore.readValueGenerationInfo()
+	if !ok {
+		return 0
+	}
+	genPartition := common.MakeWriterPartition(store, PartitionValueGenerations)
+	defer genPartition.Dispose()
+
+	current := generationBytes(info.Current)
+	count := 0
+	tr.iterateNodes(tr.persistentRoot, nil, func(_ []byte, n *common.NodeData) bool {
+		if common.IsNil(n.Terminal) {
+			return true
+		}
+		if _, valueInCommitment := common.ExtractValue(n.Terminal); valueInCommitment {
+			return true
+		}
+		valueKey := common.AsKey(n.Terminal)
+		value, gen, inGeneration := tr.nodeStore.fetchValue(valueKey)
+		if inGeneration && gen < olderThan && gen != info.Current {
+			genPartition.Set(common.Concat(current, valueKey), value)
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// DropValueGenerations deletes all generations older than 'olderThan', except the current one.
+// Each generation is a sub-partition, so it is deleted with common.ClearPartition, which is almost instant
+// on stores implementing common.KVPartitionPruner (badger). Returns number of dropped generations
+func DropValueGenerations(store common.KVTraversableStore, olderThan uint32) (int, error) {
+	info, ok := ReadValueGenerationInfo(store)
+	if !ok {
+		return 0, nil
+	}
+	if olderThan > info.Current {
+		olderThan = info.Current
+	}
+	count := 0
+	for gen := info.Oldest; gen < olderThan; gen++ {
+		if err := common.ClearPartition(store, ValueGenerationPrefix(gen)); err != nil {
+			return count, err
+		}
+		count++
+		// the oldest generation is moved forward after each dropped generation, so the info remains consistent
+		// if the next one fails
+		info.Oldest = gen + 1
+		store.Set([]byte{PartitionValueGenerations}, info.Bytes())
+	}
+	return count, nil
+}
@@ -0,0 +1,122 @@
+package immutable
+
+import (
+	"encoding/binary"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Reference counting of values.
+// Values in the value partition are keyed by the terminal commitment, so identical values, committed under
+// many keys or in many roots, are stored only once. When reference counting is enabled, the number of stored
+// trie nodes, which terminals reference the value, is kept in the partition PartitionValueRefCounts under the
+// same key as the value (8 bytes big-endian).
+// The counter is incremented when the new node is persisted and decremented when the node is pruned by
+// CommitMutations. The value is deleted together with its counter when the counter drops to zero.
+// Values, which were committed while reference counting was disabled, have no counter and are never deleted.
+// If commitments of the model do not depend on positions of nodes, CommitMutations does not prune nodes,
+// so counters are never decremented
+
+// EnableValueRefCounts enables or disables counting of references to the values.
+// Reference counting cannot be used together with value generations
+func (tr *TrieUpdatable) EnableValueRefCounts(enable bool) {
+	tr.countValueRefs = enable
+}
+
+// ValueRefCount returns number of trie nodes referencing the value stored under the valueKey.
+// Returns 0 if the value has no reference counter
+func (tr *TrieReader) ValueRefCount(valueKey []byte) int {
+	return tr.nodeStore.valueRefCount(valueKey)
+}
+
+func (ns *NodeStore) valueRefCount(valueKey []byte) int {
+	data := ns.valueRefStore.Get(valueKey)
+	if len(data) == 0 {
+		return 0
+	}
+	common.Assertf(len(data) == 8, "valueRefCount: wrong data length %d", len(data))
+	return int(binary.BigEndian.Uint64(data))
+}
+
+// valueRefCounts collects changes of the reference counters during one commit
+type valueRefCounts struct {
+	nodeStore *NodeStore
+	delta     map[string]int
+}
+
+func (tr *TrieUpdatable) newValueRefCounts() *valueRefCounts {
+	if !tr.countValueRefs {
+		return nil
+	}
+	common.Assertf(tr.commitsPerGeneration == 0, "value reference counting cannot be used with value generations")
+	return &valueRefCounts{
+		nodeStore: tr.nodeStore,
+		delta:     make(map[string]int),
+	}
+}
+
+// storedValueKey returns key of the value referenced by the node, or nil if the value is not in the value partition
+func storedValueKey(n *common.NodeData) []byte {
+	if common.IsNil(n.Terminal) {
+		return nil
+	}
+	if _, inTheCommitment := n.Terminal.ExtractValue(); inTheCommitment {
+		return nil
+	}
+	return common.AsKey(n.Terminal)
+}
+
+// nodePersisted must be called before the node is written to the store. The node, which already exists
+// in the store, is not counted again
+func (r *valueRefCounts) nodePersisted(n *common.NodeData) {
+	if r == nil {
+		return
+	}
+	valueKey := storedValueKey(n)
+	if valueKey == nil {
+		return
+	}
+	if r.nodeStore.trieStore.Has(common.AsKey(n.Commitment)) {
+		return
+	}
+	r.delta[string(valueKey)]++
+}
+
+func (r *valueRefCounts) nodeDeleted(n *common.NodeData) {
+	if r == nil {
+		return
+	}
+	if valueKey := storedValueKey(n); valueKey != nil {
+		r.delta[string(valueKey)]--
+	}
+}
+
+// write writes updated counters to the store and deletes values which are not referenced anymore
+func (r *valueRefCounts) write(store common.KVWriter) {
+	if r == nil || len(r.delta) == 0 {
+		return
+	}
+	refPartition := common.MakeWriterPartition(store, PartitionValueRefCounts)
+	defer refPartition.Dispose()
+	valuePartition := common.MakeWriterPartition(store, PartitionValues)
+	defer valuePartition.Dispose()
+	compressedPartition := common.MakeWriterPartition(store, PartitionCompressedValues)
+	defer compressedPartition.Dispose()
+
+	for k, d := range r.delta {
+		if d == 0 {
+			continue
+		}
+		current := r.nodeStore.valueRefCount([]byte(k))
+		switch {
+		case current+d > 0:
+			var data [8]byte
+			binary.BigEndian.PutUint64(data[:], uint64(current+d))
+			refPartition.Set([]byte(k), data[:])
+		case current > 0:
+			refPartition.Set([]byte(k), nil)
+			valuePartition.Set([]byte(k), nil)
+			compressedPartition.Set([]byte(k), nil)
+		}
+	}
+}
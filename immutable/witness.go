@@ -0,0 +1,216 @@
+package immutable
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+var (
+	// ErrWitnessIncomplete is returned when the witness does not contain the trie node or value needed
+	// to perform the operation
+	ErrWitnessIncomplete = errors.New("witness is incomplete")
+	// ErrWitnessInvalid is returned when the node or value in the witness does not match its commitment
+	ErrWitnessInvalid = errors.New("witness is invalid")
+)
+
+type (
+	// Witness is a self-contained bundle of trie nodes and values. It contains all the data needed to read
+	// and update the trie along the recorded key paths, without access to the full store
+	Witness struct {
+		store *common.InMemoryKVStore
+	}
+
+	// WitnessRecorder is a common.KVReader which forwards all reads to the underlying store
+	// and records every key/value pair it returns into the Witness
+	WitnessRecorder struct {
+		store   common.KVReader
+		witness *Witness
+	}
+
+	// witnessReader is a KVReader on top of the witness. It panics with ErrWitnessIncomplete
+	// if the key is not in the witness
+	witnessReader struct {
+		w *Witness
+	}
+
+	nullWriter struct{}
+)
+
+var (
+	_ common.KVReader = &WitnessRecorder{}
+	_ common.KVReader = witnessReader{}
+	_ common.KVWriter = nullWriter{}
+)
+
+func NewWitness() *Witness {
+	return &Witness{store: common.NewInMemoryKVStore()}
+}
+
+// NewWitnessRecorder creates a recorder on top of the store.
+// The trie, created with the recorder as a store, will record into the witness all nodes and values it touches
+func NewWitnessRecorder(store common.KVReader) *WitnessRecorder {
+	return &WitnessRecorder{
+		store:   store,
+		witness: NewWitness(),
+	}
+}
+
+func (r *WitnessRecorder) Get(key []byte) []byte {
+	ret := r.store.Get(key)
+	if len(ret) > 0 {
+		r.witness.store.Set(key, ret)
+	}
+	return ret
+}
+
+func (r *WitnessRecorder) Has(key []byte) bool {
+	return len(r.Get(key)) > 0
+}
+
+// Witness returns witness recorded so far
+func (r *WitnessRecorder) Witness() *Witness {
+	return r.witness
+}
+
+// Len number of records in the witness
+func (w *Witness) Len() int {
+	return w.store.Len()
+}
+
+// Write serializes witness as a binary key/value stream. The order of records is non-deterministic
+func (w *Witness) Write(wr io.Writer) error {
+	sw := common.NewBinaryStreamWriter(wr)
+	var err error
+	w.store.Iterate(func(k, v []byte) bool {
+		err = sw.Write(k, v)
+		return err == nil
+	})
+	return err
+}
+
+func (w *Witness) Bytes() []byte {
+	return common.MustBytes(w)
+}
+
+// ReadWitness deserializes witness from the binary key/value stream
+func ReadWitness(r io.Reader) (*Witness, error) {
+	ret := NewWitness()
+	err := common.NewBinaryStreamIterator(r).Iterate(func(k, v []byte) bool {
+		ret.store.Set(k, v)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (wr witnessReader) Get(key []byte) []byte {
+	ret := wr.w.store.Get(key)
+	if len(ret) == 0 {
+		panic(fmt.Errorf("%w: missing key '%s'", ErrWitnessIncomplete, hex.EncodeToString(key)))
+	}
+	return ret
+}
+
+func (wr witnessReader) Has(key []byte) bool {
+	return wr.w.store.Has(key)
+}
+
+func (nullWriter) Set(_, _ []byte) {}
+
+// verified returns the witness with nodes and values reachable from the root. Each node is checked against the
+// commitment it is referenced by, each value stored outside the node is checked against the terminal commitment.
+// Returns error wrapping ErrWitnessInvalid on the first mismatch. Nodes and values missing in the witness are skipped
+func (w *Witness) verified(m common.CommitmentModel, root common.VCommitment) (*Witness, error) {
+	ret := NewWitness()
+	ns := openImmutableNodeStore(w.store, m, 0)
+	nodes := common.MakeWriterPartition(ret.store, PartitionTrieNodes)
+	values := common.MakeWriterPartition(ret.store, PartitionValues)
+	defer nodes.Dispose()
+	defer values.Dispose()
+
+	stack := []expectedNode{{commitment: root}}
+	for len(stack) > 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		nodeKey := common.AsKey(e.commitment)
+		nodeBin := ns.trieStore.Get(nodeKey)
+		if len(nodeBin) == 0 {
+			continue
+		}
+		n, err := common.NodeDataFromBytes(m, nodeBin, m.PathArity(), func(_ []byte) ([]byte, error) {
+			return nil, errors.New("terminal commitment must be stored in the trie node")
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%w: can't parse node %s, trie path '%x': %v", ErrWitnessInvalid, e.commitment, e.nodePath, err)
+		}
+		if c := m.CalcNodeCommitment(n, e.nodePath); common.IsNil(c) || !m.EqualCommitments(c, e.commitment) {
+			return nil, fmt.Errorf("%w: wrong data of the node %s, trie path '%x'", ErrWitnessInvalid, e.commitment, e.nodePath)
+		}
+		nodes.Set(nodeKey, nodeBin)
+
+		if !common.IsNil(n.Terminal) {
+			if _, inTheCommitment := n.Terminal.ExtractValue(); !inTheCommitment {
+				valueKey := common.AsKey(n.Terminal)
+				if value := ns.getValue(valueKey); len(value) > 0 {
+					if !m.EqualCommitments(m.CommitToData(value), n.Terminal) {
+						return nil, fmt.Errorf("%w: wrong value of the terminal %s, trie path '%x'", ErrWitnessInvalid, n.Terminal, e.nodePath)
+					}
+					values.Set(valueKey, value)
+				}
+			}
+		}
+		for i, c := range n.ChildCommitments {
+			stack = append(stack, expectedNode{
+				commitment: c,
+				nodePath:   common.Concat(e.nodePath, n.PathFragment, i),
+			})
+		}
+	}
+	return ret, nil
+}
+
+// NewTrieUpdatableFromWitness creates updatable trie on top of the witness instead of the full store.
+// The witness is verified against the root first, the error wraps ErrWitnessInvalid if it does not match.
+// Any access to the node or value not present in the witness panics with ErrWitnessIncomplete.
+// Use UpdateWithWitness to catch it as an error
+func NewTrieUpdatableFromWitness(m common.CommitmentModel, w *Witness, root common.VCommitment) (ret *TrieUpdatable, err error) {
+	if w, err = w.verified(m, root); err != nil {
+		return nil, err
+	}
+	err = common.CatchPanicOrError(func() error {
+		var err1 error
+		ret, err1 = NewTrieUpdatable(m, witnessReader{w: w}, root, 0)
+		return err1
+	})
+	return
+}
+
+// UpdateWithWitness applies mutations to the trie with the root, using only data contained in the witness.
+// Returns the new root commitment without writing anything. It is used by stateless validators.
+// Returns error wrapping ErrWitnessInvalid if nodes or values of the witness do not match the root and
+// error wrapping ErrWitnessIncomplete if the witness does not contain a node needed for the update
+func UpdateWithWitness(m common.CommitmentModel, w *Witness, root common.VCommitment, mut *common.Mutations) (ret common.VCommitment, err error) {
+	if w, err = w.verified(m, root); err != nil {
+		return nil, err
+	}
+	err = common.CatchPanicOrError(func() error {
+		tr, err1 := NewTrieUpdatable(m, witnessReader{w: w}, root, 0)
+		if err1 != nil {
+			return err1
+		}
+		mut.Iterate(func(k []byte, v []byte, _ bool) bool {
+			tr.Update(k, v)
+			return true
+		})
+		ret = tr.Commit(nullWriter{})
+		return nil
+	})
+	return
+}
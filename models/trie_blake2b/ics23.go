@@ -0,0 +1,199 @@
+package trie_blake2b
+
+import (
+	"errors"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ICS-23 vector scheme. The node of the flat and Merkle schemes commits to the terminal before the path,
+// while the ICS-23 leaf commits to the key before the value, moreover the ICS-23 verifier of non-existence
+// requires adjacent keys to be in adjacent children of the inner node. So the node of the ICS-23 scheme
+// is the binary inner node in terms of ICS-23:
+//
+//	node = keccak256(P || L || C)
+//
+// - P is the path commitment keccak256(nodePath || '+' || pathFragment) with the first byte replaced by the tag 0x02
+// - L is the ICS-23 leaf of the terminal keccak256(0x00 || varint(len(key)) || key || varint(32) || keccak256(value)),
+// where the key is the packed nodePath || pathFragment. All zero if the node has no terminal
+// - C is the root of the binary Merkle tree over child commitments. The parent is keccak256(0x01 || left || right),
+// the parent of two empty (all zero) elements is empty. All zero if the node has no children
+//
+// The identity of the state (the terminal of the empty key) is not the ICS-23 leaf: the empty key is not valid
+// in ICS-23. It is committed by the path commitment of the root, keccak256('+' || identity terminal commitment).
+// The terminal is the left child of the node and the children are the right one, so keys are ordered in the same way
+// by the trie and by ICS-23. The path commitment is the prefix of the inner node. Tags separate leaves,
+// nodes and levels of the Merkle tree of children
+
+const (
+	ics23LeafTag  = 0x00
+	ics23InnerTag = 0x01
+	ics23NodeTag  = 0x02
+)
+
+var (
+	ErrICS23Identity  = errors.New("identity of the state can't be proven with ICS-23")
+	ErrICS23EmptyTrie = errors.New("absence of the key can't be proven with ICS-23 in the trie without keys")
+)
+
+// ICS23Spec returns ICS-23 ProofSpec of the ICS-23 vector scheme. It does not depend on the arity
+func ICS23Spec() *ICS23ProofSpec {
+	return &ICS23ProofSpec{
+		LeafSpec: ics23LeafOp(),
+		InnerSpec: &ICS23InnerSpec{
+			ChildOrder:      []int32{0, 1},
+			ChildSize:       int32(HashSize256),
+			MinPrefixLength: 1,
+			MaxPrefixLength: int32(HashSize256),
+			EmptyChild:      make([]byte, HashSize256),
+			Hash:            ICS23Keccak256,
+		},
+	}
+}
+
+func ics23LeafOp() *ICS23LeafOp {
+	return &ICS23LeafOp{
+		Hash:         ICS23Keccak256,
+		PrehashKey:   ICS23NoHash,
+		PrehashValue: ICS23Keccak256,
+		Length:       ICS23VarProto,
+		Prefix:       []byte{ics23LeafTag},
+	}
+}
+
+// hashNodeICS23 same as hashNodeInBuffer in the ICS-23 vector scheme
+func (m *CommitmentModel) hashNodeICS23(buf []byte, n *common.NodeData, nodePath []byte) vectorCommitment {
+	sz := int(m.hashSize)
+	children := buf[2*sz : (2+m.arity.NumChildren())*sz]
+	for i, c := range n.ChildCommitments {
+		copy(children[int(i)*sz:(int(i)+1)*sz], c.(vectorCommitment))
+	}
+	// the root is placed into the first element of children
+	merkleRootInPlace(children, sz, m.hashICS23Inner)
+	p, leaf := m.ics23PathAndLeaf(n, nodePath)
+	copy(buf[:sz], p)
+	copy(buf[sz:2*sz], leaf)
+	return m.hashIt(buf[:3*sz])
+}
+
+func (m *CommitmentModel) hashICS23Inner(pair []byte) []byte {
+	return m.hashIt(common.Concat(byte(ics23InnerTag), pair))
+}
+
+// ics23PathAndLeaf returns the path commitment and the leaf of the node. The leaf is all zero if the node
+// has no terminal or the terminal is the identity of the state
+func (m *CommitmentModel) ics23PathAndLeaf(n *common.NodeData, nodePath []byte) ([]byte, []byte) {
+	pathToCommit := common.Concat(nodePath, byte('+'), n.PathFragment)
+	leaf := make([]byte, m.hashSize)
+	if !common.IsNil(n.Terminal) {
+		if len(pathToCommit) == 1 {
+			pathToCommit = common.Concat(pathToCommit, n.Terminal.Bytes())
+		} else {
+			leaf = m.ics23Leaf(common.Concat(nodePath, n.PathFragment), n.Terminal.(*terminalCommitment))
+		}
+	}
+	p := m.hashIt(pathToCommit)
+	p[0] = ics23NodeTag
+	return p, leaf
+}
+
+// ics23Leaf same as ICS23LeafOp.Apply of the spec. The terminal commitment contains either the value itself
+// or the whole hash of it, see commitToData
+func (m *CommitmentModel) ics23Leaf(unpackedKey []byte, t *terminalCommitment) []byte {
+	key, err := common.PackUnpackedBytes(unpackedKey, m.arity)
+	common.AssertNoError(err)
+	valueHash := t.bytes
+	if t.isValueInCommitment {
+		valueHash = m.hashIt(t.bytes)
+	}
+	data := protowire.AppendVarint([]byte{ics23LeafTag}, uint64(len(key)))
+	data = append(data, key...)
+	data = protowire.AppendVarint(data, uint64(len(valueHash)))
+	return m.hashIt(append(data, valueHash...))
+}
+
+// ics23InnerOps returns ICS-23 inner ops from the child or the terminal of the node to the commitment of the node
+func (m *CommitmentModel) ics23InnerOps(n *common.NodeData, nodePath []byte, childIndex int) []*ICS23InnerOp {
+	sz := int(m.hashSize)
+	p, leaf := m.ics23PathAndLeaf(n, nodePath)
+	children := make([]byte, m.arity.NumChildren()*sz)
+	for i, c := range n.ChildCommitments {
+		copy(children[int(i)*sz:(int(i)+1)*sz], c.(vectorCommitment))
+	}
+	levels := merkleLevels(children, sz, m.hashICS23Inner)
+	if childIndex == m.arity.TerminalCommitmentIndex() {
+		return []*ICS23InnerOp{{Hash: ICS23Keccak256, Prefix: p, Suffix: levels[len(levels)-1]}}
+	}
+	ret := make([]*ICS23InnerOp, 0, len(levels))
+	pos := childIndex
+	for _, level := range levels[:len(levels)-1] {
+		sibling := level[(pos^1)*sz : (pos^1+1)*sz]
+		op := &ICS23InnerOp{Hash: ICS23Keccak256}
+		if pos%2 == 0 {
+			op.Prefix, op.Suffix = []byte{ics23InnerTag}, common.Concat(sibling)
+		} else {
+			op.Prefix = common.Concat(byte(ics23InnerTag), sibling)
+		}
+		ret = append(ret, op)
+		pos /= 2
+	}
+	return append(ret, &ICS23InnerOp{Hash: ICS23Keccak256, Prefix: common.Concat(p, leaf)})
+}
+
+// ProofICS23 returns ICS-23 proof of existence of the key or, if the key is absent, proof of non-existence.
+// The model must be of the ICS-23 vector scheme. The proof is verified against the root with ICS23Spec.
+// The identity of the state (empty key) can't be proven
+func (m *CommitmentModel) ProofICS23(key []byte, tr *immutable.TrieReader) (*ICS23CommitmentProof, error) {
+	common.Assertf(m.vectorScheme == VectorSchemeICS23, "ProofICS23: requires %s vector scheme", VectorSchemeICS23)
+	common.Assertf(!tr.IsSecure(), "ProofICS23: not supported in the secure trie")
+	if len(key) == 0 {
+		return nil, ErrICS23Identity
+	}
+	if value := tr.Get(key); len(value) > 0 {
+		return &ICS23CommitmentProof{Exist: m.ics23ExistenceProof(key, value, tr)}, nil
+	}
+	left, right := tr.Neighbors(key)
+	if len(left) == 0 {
+		// the identity is not the ICS-23 leaf
+		left = nil
+	}
+	if left == nil && right == nil {
+		return nil, ErrICS23EmptyTrie
+	}
+	ret := &ICS23NonExistenceProof{Key: common.Concat(key)}
+	if left != nil {
+		ret.Left = m.ics23ExistenceProof(left, tr.Get(left), tr)
+	}
+	if right != nil {
+		ret.Right = m.ics23ExistenceProof(right, tr.Get(right), tr)
+	}
+	return &ICS23CommitmentProof{Nonexist: ret}, nil
+}
+
+func (m *CommitmentModel) ics23ExistenceProof(key, value []byte, tr *immutable.TrieReader) *ICS23ExistenceProof {
+	nodePath, ending := tr.NodePath(common.UnpackBytes(key, tr.PathArity()))
+	common.Assertf(ending == common.EndingTerminal, "ics23ExistenceProof: key not found")
+	ops := make([][]*ICS23InnerOp, len(nodePath))
+	var triePath []byte
+	for i, e := range nodePath {
+		childIndex := int(e.ChildIndex)
+		if i == len(nodePath)-1 {
+			childIndex = m.arity.TerminalCommitmentIndex()
+		}
+		ops[i] = m.ics23InnerOps(e.NodeData, triePath, childIndex)
+		triePath = common.Concat(triePath, e.NodeData.PathFragment, e.ChildIndex)
+	}
+	ret := &ICS23ExistenceProof{
+		Key:   common.Concat(key),
+		Value: common.Concat(value),
+		Leaf:  ics23LeafOp(),
+		Path:  make([]*ICS23InnerOp, 0),
+	}
+	// from the leaf to the root
+	for i := len(ops) - 1; i >= 0; i-- {
+		ret.Path = append(ret.Path, ops[i]...)
+	}
+	return ret
+}
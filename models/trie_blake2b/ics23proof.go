@@ -0,0 +1,386 @@
+package trie_blake2b
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+	"golang.org/x/crypto/sha3"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Subset of ICS-23 (cosmos/ics23) proof messages, needed to express proofs of the ICS-23 vector scheme.
+// Messages are encoded in the protobuf wire format of cosmos/ics23 proofs.proto, so encoded proofs are accepted
+// by IBC light clients. Batch and compressed proofs are not supported
+
+// ICS23HashOp is the HashOp enum of ICS-23. Only operations used by the ICS-23 vector scheme are implemented
+type ICS23HashOp int32
+
+const (
+	ICS23NoHash    = ICS23HashOp(0)
+	ICS23Keccak256 = ICS23HashOp(3)
+)
+
+// ICS23LengthOp is the LengthOp enum of ICS-23. Only operations used by the ICS-23 vector scheme are implemented
+type ICS23LengthOp int32
+
+const (
+	ICS23NoPrefix = ICS23LengthOp(0)
+	ICS23VarProto = ICS23LengthOp(1)
+)
+
+type (
+	// ICS23CommitmentProof is either the proof of existence or the proof of non-existence of the key
+	ICS23CommitmentProof struct {
+		Exist    *ICS23ExistenceProof
+		Nonexist *ICS23NonExistenceProof
+	}
+
+	// ICS23ExistenceProof proves the key with the value. Path is from the leaf to the root
+	ICS23ExistenceProof struct {
+		Key   []byte
+		Value []byte
+		Leaf  *ICS23LeafOp
+		Path  []*ICS23InnerOp
+	}
+
+	// ICS23NonExistenceProof proves absence of the key by existence of adjacent keys. Left or right is nil
+	// if there are no keys less or greater than the key
+	ICS23NonExistenceProof struct {
+		Key   []byte
+		Left  *ICS23ExistenceProof
+		Right *ICS23ExistenceProof
+	}
+
+	// ICS23LeafOp leaf is Hash(Prefix || Length(PrehashKey(key)) || Length(PrehashValue(value)))
+	ICS23LeafOp struct {
+		Hash         ICS23HashOp
+		PrehashKey   ICS23HashOp
+		PrehashValue ICS23HashOp
+		Length       ICS23LengthOp
+		Prefix       []byte
+	}
+
+	// ICS23InnerOp inner node is Hash(Prefix || child || Suffix)
+	ICS23InnerOp struct {
+		Hash   ICS23HashOp
+		Prefix []byte
+		Suffix []byte
+	}
+
+	// ICS23ProofSpec defines the layout of the tree for the ICS-23 verifier
+	ICS23ProofSpec struct {
+		LeafSpec  *ICS23LeafOp
+		InnerSpec *ICS23InnerSpec
+		MaxDepth  int32
+		MinDepth  int32
+	}
+
+	// ICS23InnerSpec defines inner nodes of the tree: positions of children in the Prefix and Suffix of the ICS23InnerOp
+	ICS23InnerSpec struct {
+		ChildOrder      []int32
+		ChildSize       int32
+		MinPrefixLength int32
+		MaxPrefixLength int32
+		EmptyChild      []byte
+		Hash            ICS23HashOp
+	}
+)
+
+var (
+	ErrICS23UnsupportedOp = errors.New("unsupported ICS-23 operation")
+	errWrongICS23Proof    = errors.New("wrong ICS-23 proof")
+)
+
+func (op ICS23HashOp) apply(data []byte) ([]byte, error) {
+	switch op {
+	case ICS23NoHash:
+		return data, nil
+	case ICS23Keccak256:
+		h := sha3.NewLegacyKeccak256()
+		_, _ = h.Write(data)
+		return h.Sum(nil), nil
+	}
+	return nil, fmt.Errorf("%w: hash op %d", ErrICS23UnsupportedOp, op)
+}
+
+func (op ICS23LengthOp) apply(data []byte) ([]byte, error) {
+	switch op {
+	case ICS23NoPrefix:
+		return data, nil
+	case ICS23VarProto:
+		return append(protowire.AppendVarint(nil, uint64(len(data))), data...), nil
+	}
+	return nil, fmt.Errorf("%w: length op %d", ErrICS23UnsupportedOp, op)
+}
+
+// Apply calculates the leaf of the key and the value
+func (op *ICS23LeafOp) Apply(key, value []byte) ([]byte, error) {
+	if len(key) == 0 || len(value) == 0 {
+		return nil, errWrongICS23Proof
+	}
+	data := common.Concat(op.Prefix)
+	for _, e := range []struct {
+		prehash ICS23HashOp
+		data    []byte
+	}{{op.PrehashKey, key}, {op.PrehashValue, value}} {
+		prehashed, err := e.prehash.apply(e.data)
+		if err != nil {
+			return nil, err
+		}
+		if prehashed, err = op.Length.apply(prehashed); err != nil {
+			return nil, err
+		}
+		data = append(data, prehashed...)
+	}
+	return op.Hash.apply(data)
+}
+
+// Apply calculates the inner node from the child
+func (op *ICS23InnerOp) Apply(child []byte) ([]byte, error) {
+	if len(child) == 0 {
+		return nil, errWrongICS23Proof
+	}
+	return op.Hash.apply(common.Concat(op.Prefix, child, op.Suffix))
+}
+
+// CalculateRoot calculates the root from the key and the value of the proof
+func (p *ICS23ExistenceProof) CalculateRoot() ([]byte, error) {
+	if p.Leaf == nil {
+		return nil, errWrongICS23Proof
+	}
+	ret, err := p.Leaf.Apply(p.Key, p.Value)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range p.Path {
+		if ret, err = op.Apply(ret); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// Bytes encodes the proof as ICS-23 CommitmentProof protobuf message
+func (p *ICS23CommitmentProof) Bytes() []byte {
+	if p.Exist != nil {
+		return common.ProtobufAppendField(nil, 1, p.Exist.bytes())
+	}
+	if p.Nonexist != nil {
+		return common.ProtobufAppendField(nil, 2, p.Nonexist.bytes())
+	}
+	return nil
+}
+
+func (p *ICS23ExistenceProof) bytes() []byte {
+	ret := common.ProtobufAppendBytes(nil, 1, p.Key)
+	ret = common.ProtobufAppendBytes(ret, 2, p.Value)
+	if p.Leaf != nil {
+		ret = common.ProtobufAppendField(ret, 3, p.Leaf.bytes())
+	}
+	for _, op := range p.Path {
+		ret = common.ProtobufAppendField(ret, 4, op.bytes())
+	}
+	return ret
+}
+
+func (p *ICS23NonExistenceProof) bytes() []byte {
+	ret := common.ProtobufAppendBytes(nil, 1, p.Key)
+	if p.Left != nil {
+		ret = common.ProtobufAppendField(ret, 2, p.Left.bytes())
+	}
+	if p.Right != nil {
+		ret = common.ProtobufAppendField(ret, 3, p.Right.bytes())
+	}
+	return ret
+}
+
+func (op *ICS23LeafOp) bytes() []byte {
+	ret := common.ProtobufAppendUint(nil, 1, uint64(op.Hash))
+	ret = common.ProtobufAppendUint(ret, 2, uint64(op.PrehashKey))
+	ret = common.ProtobufAppendUint(ret, 3, uint64(op.PrehashValue))
+	ret = common.ProtobufAppendUint(ret, 4, uint64(op.Length))
+	return common.ProtobufAppendBytes(ret, 5, op.Prefix)
+}
+
+func (op *ICS23InnerOp) bytes() []byte {
+	ret := common.ProtobufAppendUint(nil, 1, uint64(op.Hash))
+	ret = common.ProtobufAppendBytes(ret, 2, op.Prefix)
+	return common.ProtobufAppendBytes(ret, 3, op.Suffix)
+}
+
+// Bytes encodes the spec as ICS-23 ProofSpec protobuf message
+func (s *ICS23ProofSpec) Bytes() []byte {
+	var ret []byte
+	if s.LeafSpec != nil {
+		ret = common.ProtobufAppendField(ret, 1, s.LeafSpec.bytes())
+	}
+	if s.InnerSpec != nil {
+		ret = common.ProtobufAppendField(ret, 2, s.InnerSpec.bytes())
+	}
+	ret = common.ProtobufAppendUint(ret, 3, uint64(s.MaxDepth))
+	return common.ProtobufAppendUint(ret, 4, uint64(s.MinDepth))
+}
+
+func (s *ICS23InnerSpec) bytes() []byte {
+	var ret []byte
+	if len(s.ChildOrder) > 0 {
+		// packed repeated field
+		var packed []byte
+		for _, c := range s.ChildOrder {
+			packed = protowire.AppendVarint(packed, uint64(c))
+		}
+		ret = common.ProtobufAppendField(ret, 1, packed)
+	}
+	ret = common.ProtobufAppendUint(ret, 2, uint64(s.ChildSize))
+	ret = common.ProtobufAppendUint(ret, 3, uint64(s.MinPrefixLength))
+	ret = common.ProtobufAppendUint(ret, 4, uint64(s.MaxPrefixLength))
+	ret = common.ProtobufAppendBytes(ret, 5, s.EmptyChild)
+	return common.ProtobufAppendUint(ret, 6, uint64(s.Hash))
+}
+
+// ICS23CommitmentProofFromBytes decodes ICS-23 CommitmentProof protobuf message with existence or non-existence proof
+func ICS23CommitmentProofFromBytes(data []byte) (*ICS23CommitmentProof, error) {
+	fields, err := common.ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ICS23CommitmentProof{}
+	for _, f := range fields {
+		var msg []byte
+		if msg, err = f.ByteString(); err != nil {
+			return nil, err
+		}
+		switch f.Num {
+		case 1:
+			ret.Exist, err = ics23ExistenceProofFromBytes(msg)
+		case 2:
+			ret.Nonexist, err = ics23NonExistenceProofFromBytes(msg)
+		default:
+			return nil, fmt.Errorf("%w: CommitmentProof field %d", ErrICS23UnsupportedOp, f.Num)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if (ret.Exist == nil) == (ret.Nonexist == nil) {
+		return nil, errWrongICS23Proof
+	}
+	return ret, nil
+}
+
+func ics23ExistenceProofFromBytes(data []byte) (*ICS23ExistenceProof, error) {
+	fields, err := common.ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ICS23ExistenceProof{Path: make([]*ICS23InnerOp, 0)}
+	for _, f := range fields {
+		var b []byte
+		if b, err = f.ByteString(); err != nil {
+			return nil, err
+		}
+		switch f.Num {
+		case 1:
+			ret.Key = b
+		case 2:
+			ret.Value = b
+		case 3:
+			if ret.Leaf, err = ics23LeafOpFromBytes(b); err != nil {
+				return nil, err
+			}
+		case 4:
+			var op *ICS23InnerOp
+			if op, err = ics23InnerOpFromBytes(b); err != nil {
+				return nil, err
+			}
+			ret.Path = append(ret.Path, op)
+		}
+	}
+	return ret, nil
+}
+
+func ics23NonExistenceProofFromBytes(data []byte) (*ICS23NonExistenceProof, error) {
+	fields, err := common.ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ICS23NonExistenceProof{}
+	for _, f := range fields {
+		var b []byte
+		if b, err = f.ByteString(); err != nil {
+			return nil, err
+		}
+		switch f.Num {
+		case 1:
+			ret.Key = b
+		case 2:
+			ret.Left, err = ics23ExistenceProofFromBytes(b)
+		case 3:
+			ret.Right, err = ics23ExistenceProofFromBytes(b)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func ics23LeafOpFromBytes(data []byte) (*ICS23LeafOp, error) {
+	fields, err := common.ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ICS23LeafOp{}
+	for _, f := range fields {
+		var v uint64
+		switch f.Num {
+		case 1, 2, 3, 4:
+			if v, err = f.Unsigned(); err != nil {
+				return nil, err
+			}
+		case 5:
+			if ret.Prefix, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+		}
+		switch f.Num {
+		case 1:
+			ret.Hash = ICS23HashOp(v)
+		case 2:
+			ret.PrehashKey = ICS23HashOp(v)
+		case 3:
+			ret.PrehashValue = ICS23HashOp(v)
+		case 4:
+			ret.Length = ICS23LengthOp(v)
+		}
+	}
+	return ret, nil
+}
+
+func ics23InnerOpFromBytes(data []byte) (*ICS23InnerOp, error) {
+	fields, err := common.ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := &ICS23InnerOp{}
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			var v uint64
+			if v, err = f.Unsigned(); err != nil {
+				return nil, err
+			}
+			ret.Hash = ICS23HashOp(v)
+		case 2:
+			if ret.Prefix, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+		case 3:
+			if ret.Suffix, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,72 @@
+package trie_blake2b
+
+import (
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+	"golang.org/x/crypto/sha3"
+)
+
+// HashFunction is the hash function of the commitment model. By default, the model is based on blake2b.
+// Keccak-256 (the original Keccak, as used by Ethereum) is the alternative for interoperability with EVM:
+// proofs of the Keccak model can be cheaply verified by the smart contract with the native keccak256.
+// Otherwise, the Keccak model is identical to the blake2b model with HashSize256
+type HashFunction byte
+
+const (
+	HashFunctionBlake2b = HashFunction(iota)
+	HashFunctionKeccak256
+	// HashFunctionBlake2bKeyed is blake2b in the keyed mode. See NewKeyed
+	HashFunctionBlake2bKeyed
+)
+
+func (hf HashFunction) String() string {
+	switch hf {
+	case HashFunctionBlake2b:
+		return "blake2b"
+	case HashFunctionKeccak256:
+		return "keccak256"
+	case HashFunctionBlake2bKeyed:
+		return "blake2b-keyed"
+	default:
+		return fmt.Sprintf("HashFunction(%d)", byte(hf))
+	}
+}
+
+// NewKeccak256 creates the commitment model based on Keccak-256 hashing. Hash size is always HashSize256.
+// Optional parameters are the same as in New
+func NewKeccak256(arity common.PathArity, opt ...int) *CommitmentModel {
+	ret := New(arity, HashSize256, opt...)
+	ret.hashFunction = HashFunctionKeccak256
+	return ret
+}
+
+func (m *CommitmentModel) HashFunction() HashFunction {
+	return m.hashFunction
+}
+
+// hashIt hashes data with the hash function. Keccak-256 is only defined for HashSize256.
+// The key is only used (and required) by the keyed blake2b
+func hashIt(data []byte, sz HashSize, hf HashFunction, key ...[]byte) []byte {
+	switch hf {
+	case HashFunctionBlake2b:
+		return blakeIt(data, sz)
+	case HashFunctionBlake2bKeyed:
+		common.Assertf(len(key) > 0 && len(key[0]) > 0, "key is required by %s", hf)
+		return blakeItKeyed(data, sz, key[0])
+	case HashFunctionKeccak256:
+		common.Assertf(sz == HashSize256, "keccak256 is only implemented for %s", HashSize256)
+		h := sha3.NewLegacyKeccak256()
+		_, _ = h.Write(data)
+		return h.Sum(nil)
+	}
+	panic("wrong hash function")
+}
+
+// optHashFunction returns optional hash function parameter, blake2b by default
+func optHashFunction(hf []HashFunction) HashFunction {
+	if len(hf) > 0 {
+		return hf[0]
+	}
+	return HashFunctionBlake2b
+}
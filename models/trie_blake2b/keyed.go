@@ -0,0 +1,56 @@
+package trie_blake2b
+
+import (
+	"encoding/hex"
+	"hash"
+
+	"github.com/lunfardo314/unitrie/common"
+	"golang.org/x/crypto/blake2b"
+)
+
+// Keyed (domain separated) model.
+// All hashes of the model are calculated with blake2b in the keyed mode, so commitments of different
+// applications or networks, each with its own key, never collide, even for identical data. The key is a domain
+// tag, not a secret: it is reflected in each commitment and in the root. Proofs of the keyed model
+// are verified with the same key, see ValidateKeyed in trie_blake2b_verify
+
+// MaxKeySize maximum size of the key of the keyed model
+const MaxKeySize = blake2b.Size
+
+// NewKeyed creates the model with blake2b hashing in the keyed mode. The key must be from 1 to MaxKeySize bytes long.
+// Optional parameters are the same as in New
+func NewKeyed(arity common.PathArity, hashSize HashSize, key []byte, opt ...int) *CommitmentModel {
+	common.Assertf(len(key) > 0 && len(key) <= MaxKeySize, "key must be from 1 to %d bytes long", MaxKeySize)
+	ret := New(arity, hashSize, opt...)
+	ret.hashFunction = HashFunctionBlake2bKeyed
+	ret.key = common.Concat(key)
+	ret.keyedHasherPool = newHasherPool(func() hash.Hash { return mustBlake2b(hashSize, ret.key) })
+	return ret
+}
+
+// Key returns key of the keyed model or nil
+func (m *CommitmentModel) Key() []byte {
+	return m.key
+}
+
+// keyTag is a short identification of the key, used in the name of the model
+func (m *CommitmentModel) keyTag() string {
+	h := blake2b.Sum256(m.key)
+	return hex.EncodeToString(h[:4])
+}
+
+func blakeItKeyed(data []byte, sz HashSize, key []byte) []byte {
+	h := mustBlake2b(sz, key)
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+// CompressToHashSizeKeyed same as CompressToHashSize, with the keyed blake2b
+func CompressToHashSizeKeyed(data []byte, sz HashSize, key []byte) ([]byte, bool) {
+	return compressToHashSize(data, sz, HashFunctionBlake2bKeyed, key)
+}
+
+// HashTheVectorKeyed same as HashTheVector, with the keyed blake2b
+func HashTheVectorKeyed(hashes [][]byte, arity common.PathArity, sz HashSize, key []byte) []byte {
+	return hashTheVector(hashes, arity, sz, HashFunctionBlake2bKeyed, key)
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/lunfardo314/unitrie/common"
 	"golang.org/x/crypto/blake2b"
@@ -30,32 +31,63 @@ type HashSize byte
 const (
 	HashSize160 = HashSize(20)
 	HashSize192 = HashSize(24)
+	HashSize224 = HashSize(28)
 	HashSize256 = HashSize(32)
 )
 
-var AllHashSize = []HashSize{HashSize160, HashSize256}
+var AllHashSize = []HashSize{HashSize160, HashSize192, HashSize224, HashSize256}
 
 func (hs HashSize) String() string {
 	switch hs {
 	case HashSize256:
 		return "HashSize(256)"
+	case HashSize224:
+		return "HashSize(224)"
+	case HashSize192:
+		return "HashSize(192)"
 	case HashSize160:
 		return "HashSize(160)"
 	}
 	panic("wrong hash size")
 }
 
-const terminalCommitmentSizeMaxDefault = 63 // must fit into 6 bits
+// IsValid checks if hash size is one of AllHashSize
+func (hs HashSize) IsValid() bool {
+	for _, sz := range AllHashSize {
+		if hs == sz {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	terminalCommitmentSizeMaxDefault = 63 // must fit into 6 bits
+	// MaxInlinedValueSizeDefault values up to this size are inlined into the terminal commitment. Longer values are hashed
+	MaxInlinedValueSizeDefault = terminalCommitmentSizeMaxDefault - 1
+)
 
 // CommitmentModel provides commitment common implementation for the 256+ trie
 type CommitmentModel struct {
 	hashSize                       HashSize
 	arity                          common.PathArity
 	terminalCommitmentSizeMax      int
+	maxInlinedValueSize            int
 	valueSizeOptimizationThreshold int
+	// reuse hashers and buffers. See EnablePooling
+	pooling bool
+	// blake2b by default. See NewKeccak256
+	hashFunction HashFunction
+	// key of the keyed blake2b and the pool of keyed hashers. See NewKeyed
+	key             []byte
+	keyedHasherPool *sync.Pool
+	// flat by default. See SetVectorScheme
+	vectorScheme VectorScheme
 }
 
 // New creates new CommitmentModel.
+// Optional parameters are: opt[0] valueSizeOptimizationThreshold and opt[1] maxInlinedValueSize
+//
 // Parameter valueSizeOptimizationThreshold means that for terminal commitments to values
 // longer than threshold, the terminal commitments will always be stored with the trie node,
 // i.e. ForceStoreTerminalWithNode will return true. For terminal commitments
@@ -65,16 +97,29 @@ type CommitmentModel struct {
 // If valueSizeOptimizationThreshold > 0 valueStore must be specified in the trie parameters
 // Reasonable value of valueSizeOptimizationThreshold, allows significantly optimize trie storage without
 // requiring hashing big data each time
-func New(arity common.PathArity, hashSize HashSize, valueSizeOptimizationThreshold ...int) *CommitmentModel {
+//
+// Parameter maxInlinedValueSize is the threshold at which values are committed by hash rather than inlined into
+// the terminal commitment of the node. Must be from 0 to MaxInlinedValueSizeDefault (the default).
+// Smaller threshold makes nodes smaller, bigger threshold makes proofs of medium-sized values self-contained.
+// Changing it changes commitments of the trie
+func New(arity common.PathArity, hashSize HashSize, opt ...int) *CommitmentModel {
 	t := 0
-	if len(valueSizeOptimizationThreshold) > 0 {
-		t = valueSizeOptimizationThreshold[0]
+	if len(opt) > 0 {
+		t = opt[0]
 	}
+	inl := MaxInlinedValueSizeDefault
+	if len(opt) > 1 {
+		inl = opt[1]
+	}
+	common.Assertf(inl >= 0 && inl <= MaxInlinedValueSizeDefault, "maxInlinedValueSize must be from 0 to %d", MaxInlinedValueSizeDefault)
+	common.Assertf(hashSize.IsValid(), "wrong hash size %d", hashSize)
 	ret := &CommitmentModel{
 		hashSize:                       hashSize,
 		arity:                          arity,
 		terminalCommitmentSizeMax:      terminalCommitmentSizeMaxDefault,
+		maxInlinedValueSize:            inl,
 		valueSizeOptimizationThreshold: t,
+		pooling:                        true,
 	}
 	common.Assertf(ret.terminalCommitmentSizeMax <= 0x3F, "ret.terminalCommitmentSizeMax <= 0x3F")
 	return ret
@@ -87,6 +132,11 @@ func (m *CommitmentModel) PathArity() common.PathArity {
 func (m *CommitmentModel) HashSize() HashSize {
 	return m.hashSize
 }
+
+// MaxInlinedValueSize values longer than that are committed by hash
+func (m *CommitmentModel) MaxInlinedValueSize() int {
+	return m.maxInlinedValueSize
+}
 func (m *CommitmentModel) EqualCommitments(c1, c2 common.Serializable) bool {
 	return equalCommitments(c1, c2)
 }
@@ -128,7 +178,7 @@ func (m *CommitmentModel) UpdateNodeCommitment(mutate *common.NodeData, childUpd
 	if len(mutate.ChildCommitments) == 0 && mutate.Terminal == nil {
 		return
 	}
-	mutate.Commitment = (vectorCommitment)(HashTheVector(m.makeHashVector(mutate, nodePath), m.arity, m.hashSize))
+	mutate.Commitment = m.hashNode(mutate, nodePath)
 }
 
 // CalcNodeCommitment computes commitment of the node. It is suboptimal in KZG trie.
@@ -137,7 +187,7 @@ func (m *CommitmentModel) CalcNodeCommitment(par *common.NodeData, nodePath []by
 	if len(par.ChildCommitments) == 0 && par.Terminal == nil {
 		return nil
 	}
-	return vectorCommitment(HashTheVector(m.makeHashVector(par, nodePath), m.arity, m.hashSize))
+	return m.hashNode(par, nodePath)
 }
 
 func (m *CommitmentModel) CommitToData(data []byte) common.TCommitment {
@@ -149,12 +199,28 @@ func (m *CommitmentModel) CommitToData(data []byte) common.TCommitment {
 }
 
 func (m *CommitmentModel) Description() string {
-	return fmt.Sprintf("trie commitment common implementation based on blake2b %s, arity: %s, terminal optimization threshold: %d",
-		m.hashSize, m.arity, m.valueSizeOptimizationThreshold)
+	return fmt.Sprintf("trie commitment common implementation based on %s %s, arity: %s, vector scheme: %s, terminal optimization threshold: %d, max inlined value size: %d",
+		m.hashFunction, m.hashSize, m.arity, m.vectorScheme, m.valueSizeOptimizationThreshold, m.maxInlinedValueSize)
 }
 
 func (m *CommitmentModel) ShortName() string {
-	return fmt.Sprintf("b2b_%s_%s", m.PathArity(), m.hashSize)
+	prefix := "b2b"
+	switch m.hashFunction {
+	case HashFunctionKeccak256:
+		prefix = "keccak"
+	case HashFunctionBlake2bKeyed:
+		prefix = fmt.Sprintf("b2bk%s", m.keyTag())
+	}
+	switch m.vectorScheme {
+	case VectorSchemeMerkle:
+		prefix += "m"
+	case VectorSchemeICS23:
+		prefix += "ics"
+	}
+	if m.maxInlinedValueSize != MaxInlinedValueSizeDefault {
+		return fmt.Sprintf("%s_%s_%s_inl%d", prefix, m.PathArity(), m.hashSize, m.maxInlinedValueSize)
+	}
+	return fmt.Sprintf("%s_%s_%s", prefix, m.PathArity(), m.hashSize)
 }
 
 // NewTerminalCommitment creates empty terminal commitment
@@ -175,8 +241,13 @@ func (m *CommitmentModel) ForceStoreTerminalWithNode(c common.TCommitment) bool
 	return m.AlwaysStoreTerminalWithNode() || c.(*terminalCommitment).isCostlyCommitment
 }
 
-// CompressToHashSize hashes data if longer than hash size, otherwise copies it
-func CompressToHashSize(data []byte, sz HashSize) ([]byte, bool) {
+// CompressToHashSize hashes data if longer than hash size, otherwise copies it.
+// Optional hf is the hash function, blake2b by default
+func CompressToHashSize(data []byte, sz HashSize, hf ...HashFunction) ([]byte, bool) {
+	return compressToHashSize(data, sz, optHashFunction(hf))
+}
+
+func compressToHashSize(data []byte, sz HashSize, hf HashFunction, key ...[]byte) ([]byte, bool) {
 	var ret []byte
 	valueInCommitment := false
 	if len(data) <= int(sz) {
@@ -184,22 +255,32 @@ func CompressToHashSize(data []byte, sz HashSize) ([]byte, bool) {
 		valueInCommitment = true
 		copy(ret, data)
 	} else {
-		ret = blakeIt(data, sz)
+		ret = hashIt(data, sz, hf, key...)
 	}
 	return ret, valueInCommitment
 }
 
+// compressToHashSize same as CompressToHashSize with the hash function of the model
+func (m *CommitmentModel) compressToHashSize(data []byte) ([]byte, bool) {
+	return compressToHashSize(data, m.hashSize, m.hashFunction, m.key)
+}
+
 func (m *CommitmentModel) commitToData(data []byte) *terminalCommitment {
 	var commitmentBytes []byte
 	var isValueInCommitment bool
 
-	if len(data) > m.terminalCommitmentSizeMax-1 {
+	switch {
+	case len(data) > m.maxInlinedValueSize && m.vectorScheme == VectorSchemeICS23:
+		// the ICS-23 leaf commits to the whole hash of the value, see ics23Leaf
+		commitmentBytes = m.hashIt(data)
+		isValueInCommitment = false
+	case len(data) > m.maxInlinedValueSize:
 		// taking hash as commitment data for long values, except the first byte is lost from the hash
 		// by skipping first byte, we have commitment bytes no more than hash size and therefore
 		// no need for one more compression upon node commitment. Otherwise, it would be hashed once more
-		commitmentBytes = blakeIt(data, m.hashSize)[1:]
+		commitmentBytes = m.hashIt(data)[1:]
 		isValueInCommitment = false
-	} else {
+	default:
 		// just cloning bytes. Data always is a commitment to itself
 		commitmentBytes = common.Concat(data)
 		isValueInCommitment = true
@@ -218,16 +299,19 @@ func blakeIt(data []byte, sz HashSize) []byte {
 	case HashSize160:
 		ret := common.Blake2b160(data)
 		return ret[:]
-	case HashSize192:
-		panic("24-byte hashing not implemented")
+	case HashSize192, HashSize224:
+		h := mustBlake2b(sz)
+		_, _ = h.Write(data)
+		return h.Sum(nil)
 	case HashSize256:
 		ret := blake2b.Sum256(data)
 		return ret[:]
 	}
-	panic("must be 160 of 256")
+	panic("must be 160, 192, 224 or 256")
 }
 
-// makeHashVector makes the node vector to be hashed. Missing children are nil
+// makeHashVector makes the node vector to be hashed. Missing children are nil.
+// It is a generic reference implementation of the hashNode
 func (m *CommitmentModel) makeHashVector(nodeData *common.NodeData, nodePath []byte) [][]byte {
 	hashes := make([][]byte, m.arity.VectorLength())
 	for i, c := range nodeData.ChildCommitments {
@@ -236,16 +320,26 @@ func (m *CommitmentModel) makeHashVector(nodeData *common.NodeData, nodePath []b
 	}
 	if !common.IsNil(nodeData.Terminal) {
 		// squeeze terminal it into the hash size, if longer than hash size
-		hashes[m.arity.TerminalCommitmentIndex()], _ = CompressToHashSize(nodeData.Terminal.Bytes(), m.hashSize)
+		hashes[m.arity.TerminalCommitmentIndex()], _ = m.compressToHashSize(nodeData.Terminal.Bytes())
 	}
 	// we concatenate with '+' in between in order to distinguish between for example 'a'+'bc' and 'ab'+'c'
 	pathToCommit := common.Concat(nodePath, byte('+'), nodeData.PathFragment)
-	pathFragmentCommitmentBytes, _ := CompressToHashSize(pathToCommit, m.hashSize)
+	pathFragmentCommitmentBytes, _ := m.compressToHashSize(pathToCommit)
 	hashes[m.arity.PathCommitmentIndex()] = pathFragmentCommitmentBytes
 	return hashes
 }
 
-func HashTheVector(hashes [][]byte, arity common.PathArity, sz HashSize) []byte {
+// HashTheVector hashes the vector of commitments. Optional hf is the hash function, blake2b by default
+func HashTheVector(hashes [][]byte, arity common.PathArity, sz HashSize, hf ...HashFunction) []byte {
+	return hashTheVector(hashes, arity, sz, optHashFunction(hf))
+}
+
+func hashTheVector(hashes [][]byte, arity common.PathArity, sz HashSize, hf HashFunction, key ...[]byte) []byte {
+	return hashIt(vectorBuffer(hashes, arity, sz), sz, hf, key...)
+}
+
+// vectorBuffer places elements of the vector into the buffer, each padded to the hash size
+func vectorBuffer(hashes [][]byte, arity common.PathArity, sz HashSize) []byte {
 	buf := make([]byte, arity.VectorLength()*int(sz))
 	for i, h := range hashes {
 		common.Assertf(len(h) <= int(sz), "len(h)<=int(sz)")
@@ -255,7 +349,7 @@ func HashTheVector(hashes [][]byte, arity common.PathArity, sz HashSize) []byte
 		pos := i * int(sz)
 		copy(buf[pos:pos+int(sz)], h)
 	}
-	return blakeIt(buf, sz)
+	return buf
 }
 
 // *vectorCommitment implements trie_go.VCommitment
@@ -270,7 +364,7 @@ func (v vectorCommitment) Bytes() []byte {
 }
 
 func (v vectorCommitment) Read(r io.Reader) error {
-	_, err := r.Read(v)
+	_, err := io.ReadFull(r, v)
 	return err
 }
 
@@ -322,7 +416,8 @@ const (
 	valueInCommitmentMask = uint8(0x80)
 )
 
-func (t *terminalCommitment) Write(w io.Writer) error {
+// header is the first byte of the serialized terminal commitment: size and flags
+func (t *terminalCommitment) header() byte {
 	l := byte(len(t.bytes))
 	common.Assertf(l <= l&sizeMask, "l <= l & sizeMask")
 	if t.isCostlyCommitment {
@@ -331,7 +426,11 @@ func (t *terminalCommitment) Write(w io.Writer) error {
 	if t.isValueInCommitment {
 		l |= valueInCommitmentMask
 	}
-	if err := common.WriteByte(w, l); err != nil {
+	return l
+}
+
+func (t *terminalCommitment) Write(w io.Writer) error {
+	if err := common.WriteByte(w, t.header()); err != nil {
 		return err
 	}
 	_, err := w.Write(t.bytes)
@@ -350,7 +449,7 @@ func (t *terminalCommitment) Read(r io.Reader) error {
 	if l > 0 {
 		t.bytes = make([]byte, l)
 
-		n, err := r.Read(t.bytes)
+		n, err := io.ReadFull(r, t.bytes)
 		if err != nil {
 			return err
 		}
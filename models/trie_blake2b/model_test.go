@@ -0,0 +1,246 @@
+package trie_blake2b
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+func randomNodeData(m *CommitmentModel, rnd *rand.Rand, numChildren int, valueSize int) (*common.NodeData, []byte) {
+	ret := common.NewNodeData()
+	for i := 0; i < numChildren; i++ {
+		c := newVectorCommitment(m.hashSize)
+		rnd.Read(c)
+		ret.ChildCommitments[byte(rnd.Intn(m.arity.NumChildren()))] = c
+	}
+	if valueSize > 0 {
+		value := make([]byte, valueSize)
+		rnd.Read(value)
+		ret.Terminal = m.CommitToData(value)
+	}
+	ret.PathFragment = make([]byte, rnd.Intn(5))
+	rnd.Read(ret.PathFragment)
+	nodePath := make([]byte, rnd.Intn(50))
+	rnd.Read(nodePath)
+	return ret, nodePath
+}
+
+func TestHashNode(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, arity := range common.AllPathArity {
+		for _, sz := range AllHashSize {
+			m := New(arity, sz)
+			if sz == HashSize256 && arity == common.PathArity16 {
+				m = NewKeccak256(arity)
+			}
+			for i := 0; i < 1000; i++ {
+				n, nodePath := randomNodeData(m, rnd, rnd.Intn(5), rnd.Intn(70))
+				if len(n.ChildCommitments) == 0 && common.IsNil(n.Terminal) {
+					continue
+				}
+				expected := HashTheVector(m.makeHashVector(n, nodePath), arity, sz, m.hashFunction)
+				require.True(t, bytes.Equal(expected, m.hashNode(n, nodePath)))
+				m.EnablePooling(false)
+				require.True(t, bytes.Equal(expected, m.hashNode(n, nodePath)))
+				m.EnablePooling(true)
+			}
+		}
+	}
+}
+
+func BenchmarkNodeCommitment(b *testing.B) {
+	for _, arity := range common.AllPathArity {
+		m := New(arity, HashSize160)
+		n, nodePath := randomNodeData(m, rand.New(rand.NewSource(1)), arity.NumChildren(), 100)
+		b.Run(fmt.Sprintf("generic-%s", arity), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				HashTheVector(m.makeHashVector(n, nodePath), m.arity, m.hashSize)
+			}
+		})
+		b.Run(fmt.Sprintf("specialized-%s", arity), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m.hashNode(n, nodePath)
+			}
+		})
+	}
+}
+
+func BenchmarkNodeCommitmentPooling(b *testing.B) {
+	for _, arity := range common.AllPathArity {
+		for _, pooling := range []bool{false, true} {
+			m := New(arity, HashSize160)
+			m.EnablePooling(pooling)
+			n, nodePath := randomNodeData(m, rand.New(rand.NewSource(1)), arity.NumChildren(), 100)
+			b.Run(fmt.Sprintf("pooling=%v-%s", pooling, arity), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					m.hashNode(n, nodePath)
+				}
+			})
+		}
+	}
+}
+
+func TestKeccak256(t *testing.T) {
+	// well known keccak256 of the empty string, as in Ethereum
+	require.EqualValues(t, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		hex.EncodeToString(hashIt(nil, HashSize256, HashFunctionKeccak256)))
+	m := NewKeccak256(common.PathArity16)
+	require.EqualValues(t, hashIt([]byte("abc"), HashSize256, HashFunctionKeccak256), m.hashIt([]byte("abc")))
+	require.EqualValues(t, "keccak_PathArity16_HashSize(256)", m.ShortName())
+	require.Panics(t, func() {
+		hashIt(nil, HashSize160, HashFunctionKeccak256)
+	})
+}
+
+func TestKeyed(t *testing.T) {
+	key := []byte("network A")
+	require.EqualValues(t, blakeItKeyed([]byte("abc"), HashSize160, key), hashIt([]byte("abc"), HashSize160, HashFunctionBlake2bKeyed, key))
+	require.NotEqualValues(t, blakeIt([]byte("abc"), HashSize160), blakeItKeyed([]byte("abc"), HashSize160, key))
+	require.NotEqualValues(t, blakeItKeyed([]byte("abc"), HashSize160, []byte("network B")), blakeItKeyed([]byte("abc"), HashSize160, key))
+	require.Panics(t, func() {
+		hashIt(nil, HashSize160, HashFunctionBlake2bKeyed)
+	})
+	require.Panics(t, func() {
+		NewKeyed(common.PathArity16, HashSize160, nil)
+	})
+	require.Panics(t, func() {
+		NewKeyed(common.PathArity16, HashSize160, make([]byte, MaxKeySize+1))
+	})
+
+	rnd := rand.New(rand.NewSource(1))
+	for _, arity := range common.AllPathArity {
+		for _, sz := range AllHashSize {
+			m := NewKeyed(arity, sz, key)
+			mOther := NewKeyed(arity, sz, []byte("network B"))
+			mPlain := New(arity, sz)
+			require.NotEqualValues(t, mPlain.ShortName(), m.ShortName())
+			require.NotEqualValues(t, mOther.ShortName(), m.ShortName())
+			for i := 0; i < 100; i++ {
+				n, nodePath := randomNodeData(m, rnd, rnd.Intn(5)+1, rnd.Intn(70))
+				expected := HashTheVectorKeyed(m.makeHashVector(n, nodePath), arity, sz, key)
+				require.True(t, bytes.Equal(expected, m.hashNode(n, nodePath)))
+				m.EnablePooling(false)
+				require.True(t, bytes.Equal(expected, m.hashNode(n, nodePath)))
+				m.EnablePooling(true)
+				require.False(t, bytes.Equal(expected, mOther.hashNode(n, nodePath)))
+				require.False(t, bytes.Equal(expected, mPlain.hashNode(n, nodePath)))
+			}
+		}
+	}
+}
+
+func TestHashSizes(t *testing.T) {
+	for _, sz := range AllHashSize {
+		h, err := blake2b.New(int(sz), nil)
+		require.NoError(t, err)
+		h.Write([]byte("abc"))
+		require.EqualValues(t, h.Sum(nil), blakeIt([]byte("abc"), sz))
+		require.EqualValues(t, h.Sum(nil), New(common.PathArity16, sz).hashIt([]byte("abc")))
+	}
+	require.EqualValues(t, "b2b_PathArity16_HashSize(192)", New(common.PathArity16, HashSize192).ShortName())
+	require.EqualValues(t, "b2b_PathArity16_HashSize(224)", New(common.PathArity16, HashSize224).ShortName())
+	require.Panics(t, func() {
+		New(common.PathArity16, HashSize(16))
+	})
+}
+
+func TestVectorSchemeMerkle(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, arity := range common.AllPathArity {
+		for _, sz := range []HashSize{HashSize160, HashSize256} {
+			m := New(arity, sz)
+			m.SetVectorScheme(VectorSchemeMerkle)
+			mFlat := New(arity, sz)
+			require.EqualValues(t, "b2bm_"+arity.String()+"_"+sz.String(), m.ShortName())
+			for i := 0; i < 100; i++ {
+				n, nodePath := randomNodeData(m, rnd, rnd.Intn(5)+1, rnd.Intn(70))
+				buf := vectorBuffer(m.makeHashVector(n, nodePath), arity, sz)
+				levels := merkleLevels(buf, int(sz), m.hashIt)
+				expected := levels[len(levels)-1]
+				require.EqualValues(t, sz, len(expected))
+				require.True(t, bytes.Equal(expected, m.hashNode(n, nodePath)))
+				m.EnablePooling(false)
+				require.True(t, bytes.Equal(expected, m.hashNode(n, nodePath)))
+				m.EnablePooling(true)
+				require.False(t, bytes.Equal(expected, mFlat.hashNode(n, nodePath)))
+
+				indices := []int{arity.PathCommitmentIndex(), rnd.Intn(arity.VectorLength())}
+				elements := make(map[int][]byte)
+				for _, idx := range indices {
+					elements[idx] = buf[idx*int(sz) : (idx+1)*int(sz)]
+				}
+				siblings := m.vectorProof(buf, indices)
+				root, err := VectorRootFromProof(elements, siblings, arity, sz, HashFunctionBlake2b)
+				require.NoError(t, err)
+				require.EqualValues(t, expected, root)
+
+				_, err = VectorRootFromProof(elements, siblings[1:], arity, sz, HashFunctionBlake2b)
+				require.Error(t, err)
+				_, err = VectorRootFromProof(elements, append(siblings, siblings[0]), arity, sz, HashFunctionBlake2b)
+				require.Error(t, err)
+			}
+		}
+	}
+}
+
+func TestVectorSchemeICS23(t *testing.T) {
+	require.Panics(t, func() {
+		New(common.PathArity16, HashSize256).SetVectorScheme(VectorSchemeICS23)
+	})
+	rnd := rand.New(rand.NewSource(1))
+	for _, arity := range common.AllPathArity {
+		m := NewKeccak256(arity)
+		m.SetVectorScheme(VectorSchemeICS23)
+		mFlat := NewKeccak256(arity)
+		require.EqualValues(t, "keccakics_"+arity.String()+"_"+HashSize256.String(), m.ShortName())
+		for i := 0; i < 100; i++ {
+			n, _ := randomNodeData(m, rnd, rnd.Intn(5), rnd.Intn(70)+1)
+			// the key of the terminal must be valid for the arity
+			key := make([]byte, rnd.Intn(10)+1)
+			rnd.Read(key)
+			unpackedKey := common.UnpackBytes(key, arity)
+			split := rnd.Intn(len(unpackedKey))
+			nodePath := unpackedKey[:split]
+			n.PathFragment = unpackedKey[split:]
+
+			expected := m.hashNode(n, nodePath)
+			m.EnablePooling(false)
+			require.True(t, bytes.Equal(expected, m.hashNode(n, nodePath)))
+			m.EnablePooling(true)
+			require.False(t, bytes.Equal(expected, mFlat.hashNode(n, nodePath)))
+
+			// inner ops from each element of the node lead to the commitment of the node
+			apply := func(c []byte, ops []*ICS23InnerOp) []byte {
+				var err error
+				for _, op := range ops {
+					c, err = op.Apply(c)
+					require.NoError(t, err)
+				}
+				return c
+			}
+			value, ok := n.Terminal.(*terminalCommitment).ExtractValue()
+			if !ok {
+				value = nil
+			}
+			leaf := m.ics23Leaf(common.Concat(nodePath, n.PathFragment), n.Terminal.(*terminalCommitment))
+			if value != nil {
+				leafFromSpec, err := ICS23Spec().LeafSpec.Apply(key, value)
+				require.NoError(t, err)
+				require.EqualValues(t, leafFromSpec, leaf)
+			}
+			require.EqualValues(t, expected, apply(leaf, m.ics23InnerOps(n, nodePath, arity.TerminalCommitmentIndex())))
+			for idx, c := range n.ChildCommitments {
+				require.EqualValues(t, expected, apply(c.(vectorCommitment), m.ics23InnerOps(n, nodePath, int(idx))))
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package trie_blake2b
+
+import (
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Hot path of the commit. hashNode is equivalent to HashTheVector(m.makeHashVector(nodeData, nodePath), ...),
+// however it assembles the vector directly in the buffer of fixed size for each arity, without
+// intermediate slices and without serializing commitments through io.Writer
+
+const (
+	vectorBufferSize256 = 258 * int(HashSize256)
+	vectorBufferSize16  = 18 * int(HashSize256)
+	vectorBufferSize4   = 6 * int(HashSize256)
+	vectorBufferSize2   = 4 * int(HashSize256)
+)
+
+func (m *CommitmentModel) hashNode(n *common.NodeData, nodePath []byte) vectorCommitment {
+	if m.pooling {
+		return m.hashNodePooled(n, nodePath)
+	}
+	switch m.arity {
+	case common.PathArity256:
+		var buf [vectorBufferSize256]byte
+		return m.hashNodeInBuffer(buf[:258*int(m.hashSize)], n, nodePath)
+	case common.PathArity16:
+		var buf [vectorBufferSize16]byte
+		return m.hashNodeInBuffer(buf[:18*int(m.hashSize)], n, nodePath)
+	case common.PathArity4:
+		var buf [vectorBufferSize4]byte
+		return m.hashNodeInBuffer(buf[:6*int(m.hashSize)], n, nodePath)
+	case common.PathArity2:
+		var buf [vectorBufferSize2]byte
+		return m.hashNodeInBuffer(buf[:4*int(m.hashSize)], n, nodePath)
+	}
+	panic("wrong path arity")
+}
+
+func (m *CommitmentModel) hashNodeInBuffer(buf []byte, n *common.NodeData, nodePath []byte) vectorCommitment {
+	if m.vectorScheme == VectorSchemeICS23 {
+		return m.hashNodeICS23(buf, n, nodePath)
+	}
+	sz := int(m.hashSize)
+	terminalIndex := m.arity.TerminalCommitmentIndex()
+	for i, c := range n.ChildCommitments {
+		common.Assertf(int(i) < terminalIndex, "child index out of range")
+		pos := int(i) * sz
+		copy(buf[pos:pos+sz], c.(vectorCommitment))
+	}
+	if !common.IsNil(n.Terminal) {
+		t := n.Terminal.(*terminalCommitment)
+		// same as serialized terminal commitment, squeezed into the hash size
+		var tbuf [terminalCommitmentSizeMaxDefault + 1]byte
+		tbuf[0] = t.header()
+		tlen := 1 + copy(tbuf[1:], t.bytes)
+		m.putCompressed(buf[terminalIndex*sz:(terminalIndex+1)*sz], tbuf[:tlen])
+	}
+	pathBuf := buf[(terminalIndex+1)*sz : (terminalIndex+2)*sz]
+	if pathLen := len(nodePath) + 1 + len(n.PathFragment); pathLen <= sz {
+		// we concatenate with '+' in between in order to distinguish between for example 'a'+'bc' and 'ab'+'c'
+		copy(pathBuf, nodePath)
+		pathBuf[len(nodePath)] = '+'
+		copy(pathBuf[len(nodePath)+1:], n.PathFragment)
+	} else {
+		copy(pathBuf, m.hashIt(common.Concat(nodePath, byte('+'), n.PathFragment)))
+	}
+	return m.hashVectorBuffer(buf)
+}
+
+// putCompressed same as CompressToHashSize, only puts result into the buffer
+func (m *CommitmentModel) putCompressed(buf []byte, data []byte) {
+	if len(data) <= int(m.hashSize) {
+		copy(buf, data)
+		return
+	}
+	copy(buf, m.hashIt(data))
+}
@@ -0,0 +1,97 @@
+package trie_blake2b
+
+import (
+	"hash"
+	"sync"
+
+	"github.com/lunfardo314/unitrie/common"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/sha3"
+)
+
+// Pooling of blake2b hashers and node vector buffers.
+// Without pooling, each node commitment allocates the vector buffer (up to 258*32 bytes for arity 256) and,
+// for HashSize160, the blake2b hasher. During large commits it creates noticeable GC pressure.
+// With pooling (default), hashers and buffers are reused through sync.Pool, so the model remains safe
+// for concurrent use
+
+type hasherKind struct {
+	hf HashFunction
+	sz HashSize
+}
+
+var hasherPools = map[hasherKind]*sync.Pool{
+	{HashFunctionBlake2b, HashSize160}:   newHasherPool(func() hash.Hash { return mustBlake2b(HashSize160) }),
+	{HashFunctionBlake2b, HashSize192}:   newHasherPool(func() hash.Hash { return mustBlake2b(HashSize192) }),
+	{HashFunctionBlake2b, HashSize224}:   newHasherPool(func() hash.Hash { return mustBlake2b(HashSize224) }),
+	{HashFunctionBlake2b, HashSize256}:   newHasherPool(func() hash.Hash { return mustBlake2b(HashSize256) }),
+	{HashFunctionKeccak256, HashSize256}: newHasherPool(sha3.NewLegacyKeccak256),
+}
+
+func newHasherPool(newHasher func() hash.Hash) *sync.Pool {
+	return &sync.Pool{New: func() any {
+		return newHasher()
+	}}
+}
+
+func mustBlake2b(sz HashSize, key ...[]byte) hash.Hash {
+	var k []byte
+	if len(key) > 0 {
+		k = key[0]
+	}
+	h, err := blake2b.New(int(sz), k)
+	common.AssertNoError(err)
+	return h
+}
+
+var vectorBufferPools = map[common.PathArity]*sync.Pool{
+	common.PathArity256: newVectorBufferPool(vectorBufferSize256),
+	common.PathArity16:  newVectorBufferPool(vectorBufferSize16),
+	common.PathArity4:   newVectorBufferPool(vectorBufferSize4),
+	common.PathArity2:   newVectorBufferPool(vectorBufferSize2),
+}
+
+func newVectorBufferPool(size int) *sync.Pool {
+	return &sync.Pool{New: func() any {
+		buf := make([]byte, size)
+		return &buf
+	}}
+}
+
+// EnablePooling enables or disables reuse of hashers and buffers when calculating commitments. Enabled by default.
+// Commitments do not depend on it. Must be called before the model is used
+func (m *CommitmentModel) EnablePooling(enable bool) {
+	m.pooling = enable
+}
+
+// hashIt hashes data with the hash function of the model, with the pooled hasher if pooling is enabled
+func (m *CommitmentModel) hashIt(data []byte) []byte {
+	if !m.pooling {
+		return hashIt(data, m.hashSize, m.hashFunction, m.key)
+	}
+	pool := m.keyedHasherPool
+	if pool == nil {
+		var ok bool
+		pool, ok = hasherPools[hasherKind{m.hashFunction, m.hashSize}]
+		common.Assertf(ok, "%s with hash size %s not implemented", m.hashFunction, m.hashSize)
+	}
+	h := pool.Get().(hash.Hash)
+	h.Reset()
+	_, _ = h.Write(data)
+	ret := h.Sum(make([]byte, 0, m.hashSize))
+	pool.Put(h)
+	return ret
+}
+
+// hashNodePooled same as hashNode, with the vector buffer taken from the pool
+func (m *CommitmentModel) hashNodePooled(n *common.NodeData, nodePath []byte) vectorCommitment {
+	pool := vectorBufferPools[m.arity]
+	bufPtr := pool.Get().(*[]byte)
+	buf := (*bufPtr)[:m.arity.VectorLength()*int(m.hashSize)]
+	for i := range buf {
+		buf[i] = 0
+	}
+	ret := m.hashNodeInBuffer(buf, n, nodePath)
+	pool.Put(bufPtr)
+	return ret
+}
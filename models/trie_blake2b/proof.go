@@ -13,8 +13,14 @@ import (
 type MerkleProof struct {
 	PathArity common.PathArity
 	HashSize  HashSize
-	Key       []byte
-	Path      []*MerkleProofElement
+	// Hash is the hash function of the model. It is serialized in the 2 highest bits of the hash size byte,
+	// so serialized proofs of the blake2b models are not affected
+	Hash HashFunction
+	// Scheme is the vector scheme of the model. It is not serialized explicitly: elements of the Merkle scheme
+	// proof contain siblings instead of children, so serialized proofs of the flat scheme are not affected
+	Scheme VectorScheme
+	Key    []byte
+	Path   []*MerkleProofElement
 }
 
 type MerkleProofElement struct {
@@ -22,6 +28,9 @@ type MerkleProofElement struct {
 	Children     map[byte][]byte
 	Terminal     []byte
 	ChildIndex   int
+	// Siblings is the proof of the path and child commitments in the Merkle tree of the vector.
+	// Only used in the Merkle scheme. See VectorScheme
+	Siblings [][]byte
 }
 
 func ProofFromBytes(data []byte) (*MerkleProof, error) {
@@ -45,7 +54,7 @@ func (p *MerkleProof) Write(w io.Writer) error {
 	if err = common.WriteByte(w, byte(p.PathArity)); err != nil {
 		return err
 	}
-	if err = common.WriteByte(w, byte(p.HashSize)); err != nil {
+	if err = common.WriteByte(w, byte(p.HashSize)|byte(p.Hash)<<hashFunctionShift); err != nil {
 		return err
 	}
 	encodedKey, err := common.EncodeUnpackedBytes(p.Key, p.PathArity)
@@ -59,6 +68,9 @@ func (p *MerkleProof) Write(w io.Writer) error {
 		return err
 	}
 	for _, e := range p.Path {
+		if (len(e.Siblings) > 0) != (p.Scheme == VectorSchemeMerkle) {
+			return fmt.Errorf("proof element inconsistent with the vector scheme %s", p.Scheme)
+		}
 		if err = e.Write(w, p.PathArity, p.HashSize); err != nil {
 			return err
 		}
@@ -72,15 +84,22 @@ func (p *MerkleProof) Read(r io.Reader) error {
 		return err
 	}
 	p.PathArity = common.PathArity(b)
+	if !p.PathArity.IsValid() {
+		return common.ErrWrongArity
+	}
 
 	b, err = common.ReadByte(r)
 	if err != nil {
 		return err
 	}
-	p.HashSize = HashSize(b)
-	if p.HashSize != HashSize256 && p.HashSize != HashSize160 {
+	p.HashSize = HashSize(b & hashSizeMask)
+	p.Hash = HashFunction(b >> hashFunctionShift)
+	if !p.HashSize.IsValid() {
 		return errors.New("wrong hash size")
 	}
+	if p.Hash > HashFunctionBlake2bKeyed || (p.Hash == HashFunctionKeccak256 && p.HashSize != HashSize256) {
+		return errors.New("wrong hash function")
+	}
 
 	var encodedKey []byte
 	if encodedKey, err = common.ReadBytes16(r); err != nil {
@@ -94,18 +113,31 @@ func (p *MerkleProof) Read(r io.Reader) error {
 		return err
 	}
 	p.Path = make([]*MerkleProofElement, size)
+	p.Scheme = VectorSchemeFlat
 	for i := range p.Path {
 		p.Path[i] = &MerkleProofElement{}
 		if err = p.Path[i].Read(r, p.PathArity, p.HashSize); err != nil {
 			return err
 		}
+		if i == 0 && len(p.Path[i].Siblings) > 0 {
+			p.Scheme = VectorSchemeMerkle
+		}
+		if (len(p.Path[i].Siblings) > 0) != (p.Scheme == VectorSchemeMerkle) {
+			return errors.New("proof elements of different vector schemes")
+		}
 	}
 	return nil
 }
 
+const (
+	hashFunctionShift = 6
+	hashSizeMask      = 0x3F
+)
+
 const (
 	hasTerminalValueFlag = 0x01
 	hasChildrenFlag      = 0x02
+	hasSiblingsFlag      = 0x04
 )
 
 func (e *MerkleProofElement) Write(w io.Writer, arity common.PathArity, sz HashSize) error {
@@ -129,6 +161,9 @@ func (e *MerkleProofElement) Write(w io.Writer, arity common.PathArity, sz HashS
 		flags[i/8] |= 0x1 << (i % 8)
 		smallFlags |= hasChildrenFlag
 	}
+	if len(e.Siblings) > 0 {
+		smallFlags |= hasSiblingsFlag
+	}
 	if err := common.WriteByte(w, smallFlags); err != nil {
 		return err
 	}
@@ -156,6 +191,36 @@ func (e *MerkleProofElement) Write(w io.Writer, arity common.PathArity, sz HashS
 			}
 		}
 	}
+	// write siblings if any
+	if smallFlags&hasSiblingsFlag != 0 {
+		if len(e.Siblings) > 0xFF {
+			return fmt.Errorf("too many siblings: %d", len(e.Siblings))
+		}
+		if err = common.WriteByte(w, byte(len(e.Siblings))); err != nil {
+			return err
+		}
+		// empty subtrees are frequent in sparse nodes. Only non-empty siblings are written, flagged in the bitmap
+		nonEmpty := make([]byte, (len(e.Siblings)+7)/8)
+		for i, sibling := range e.Siblings {
+			if len(sibling) != int(sz) {
+				return fmt.Errorf("wrong data size. Expected %s, got %d", sz.String(), len(sibling))
+			}
+			if !isZero(sibling) {
+				nonEmpty[i/8] |= 0x1 << (i % 8)
+			}
+		}
+		if _, err = w.Write(nonEmpty); err != nil {
+			return err
+		}
+		for i, sibling := range e.Siblings {
+			if nonEmpty[i/8]&(0x1<<(i%8)) == 0 {
+				continue
+			}
+			if _, err = w.Write(sibling); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -187,18 +252,45 @@ func (e *MerkleProofElement) Read(r io.Reader, arity common.PathArity, sz HashSi
 	e.Children = make(map[byte][]byte)
 	if smallFlags&hasChildrenFlag != 0 {
 		var flags [32]byte
-		if _, err = r.Read(flags[:]); err != nil {
+		if _, err = io.ReadFull(r, flags[:]); err != nil {
 			return err
 		}
 		for i := 0; i < arity.NumChildren(); i++ {
 			ib := uint8(i)
 			if flags[i/8]&(0x1<<(i%8)) != 0 {
 				e.Children[ib] = make([]byte, sz)
-				if _, err = r.Read(e.Children[ib]); err != nil {
+				if _, err = io.ReadFull(r, e.Children[ib]); err != nil {
 					return err
 				}
 			}
 		}
 	}
+	e.Siblings = nil
+	if smallFlags&hasSiblingsFlag != 0 {
+		var n byte
+		if n, err = common.ReadByte(r); err != nil {
+			return err
+		}
+		if n == 0 {
+			return errors.New("wrong number of siblings")
+		}
+		nonEmpty := make([]byte, (int(n)+7)/8)
+		if _, err = io.ReadFull(r, nonEmpty); err != nil {
+			return err
+		}
+		e.Siblings = make([][]byte, n)
+		for i := range e.Siblings {
+			e.Siblings[i] = make([]byte, sz)
+			if nonEmpty[i/8]&(0x1<<(i%8)) == 0 {
+				continue
+			}
+			if _, err = io.ReadFull(r, e.Siblings[i]); err != nil {
+				return err
+			}
+			if isZero(e.Siblings[i]) {
+				return errors.New("empty sibling flagged as non-empty")
+			}
+		}
+	}
 	return nil
 }
@@ -6,12 +6,16 @@ import (
 )
 
 // ProofImmutable converts generic proof path of the immutable trie implementation to the Merkle proof path
+// The ICS-23 vector scheme has its own proof format, see ProofICS23
 func (m *CommitmentModel) ProofImmutable(key []byte, tr *immutable.TrieReader) *MerkleProof {
+	common.Assertf(m.vectorScheme != VectorSchemeICS23, "ProofImmutable: not supported in the %s vector scheme", m.vectorScheme)
 	unpackedKey := common.UnpackBytes(key, tr.PathArity())
 	nodePath, ending := tr.NodePath(unpackedKey)
 	ret := &MerkleProof{
 		PathArity: tr.PathArity(),
 		HashSize:  m.hashSize,
+		Hash:      m.hashFunction,
+		Scheme:    m.vectorScheme,
 		Key:       unpackedKey,
 		Path:      make([]*MerkleProofElement, len(nodePath)),
 	}
@@ -23,7 +27,7 @@ func (m *CommitmentModel) ProofImmutable(key []byte, tr *immutable.TrieReader) *
 			ChildIndex:   int(e.ChildIndex),
 		}
 		if !common.IsNil(e.NodeData.Terminal) {
-			elem.Terminal, _ = CompressToHashSize(e.NodeData.Terminal.Bytes(), m.hashSize)
+			elem.Terminal, _ = m.compressToHashSize(e.NodeData.Terminal.Bytes())
 		}
 		isLast := i == len(nodePath)-1
 		for childIndex, childCommitment := range e.NodeData.ChildCommitments {
@@ -45,5 +49,29 @@ func (m *CommitmentModel) ProofImmutable(key []byte, tr *immutable.TrieReader) *
 	default:
 		panic("wrong ending code")
 	}
+	if m.vectorScheme == VectorSchemeMerkle {
+		m.toMerkleScheme(ret, nodePath)
+	}
 	return ret
 }
+
+// toMerkleScheme replaces children and terminal in each element of the proof with siblings of the Merkle tree
+// of the vector. The path commitment and the commitment at the child index are left to be calculated by the verifier.
+// The terminal is only kept if the proof is about it
+func (m *CommitmentModel) toMerkleScheme(p *MerkleProof, nodePath []*immutable.PathElement) {
+	var triePath []byte
+	for i, e := range nodePath {
+		elem := p.Path[i]
+		indices := []int{m.arity.PathCommitmentIndex()}
+		if elem.ChildIndex != m.arity.PathCommitmentIndex() {
+			indices = append(indices, elem.ChildIndex)
+		}
+		buf := vectorBuffer(m.makeHashVector(e.NodeData, triePath), m.arity, m.hashSize)
+		elem.Siblings = m.vectorProof(buf, indices)
+		triePath = common.Concat(triePath, e.NodeData.PathFragment, byte(elem.ChildIndex))
+		elem.Children = make(map[byte][]byte)
+		if elem.ChildIndex != m.arity.TerminalCommitmentIndex() {
+			elem.Terminal = nil
+		}
+	}
+}
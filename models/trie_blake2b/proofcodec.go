@@ -0,0 +1,532 @@
+package trie_blake2b
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// ProofCodec is the serialization of the proof. The native binary serialization (see MerkleProof.Write)
+// is the most compact, alternative codecs are for interoperability with other tooling
+type ProofCodec interface {
+	EncodeProof(p *MerkleProof) ([]byte, error)
+	DecodeProof(data []byte) (*MerkleProof, error)
+}
+
+var (
+	ProofCodecBinary   ProofCodec = proofCodecBinary{}
+	ProofCodecRLP      ProofCodec = proofCodecRLP{}
+	ProofCodecCBOR     ProofCodec = proofCodecCBOR{}
+	ProofCodecProtobuf ProofCodec = proofCodecProtobuf{}
+)
+
+var errWrongProofFormat = errors.New("wrong proof format")
+
+type (
+	proofCodecBinary   struct{}
+	proofCodecRLP      struct{}
+	proofCodecCBOR     struct{}
+	proofCodecProtobuf struct{}
+)
+
+func (proofCodecBinary) EncodeProof(p *MerkleProof) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (proofCodecBinary) DecodeProof(data []byte) (*MerkleProof, error) {
+	return ProofFromBytes(data)
+}
+
+// EncodeProof encodes proof as RLP list of the path arity, hash size, hash function, encoded key and the list
+// of elements. Each element is the list of the encoded path fragment, child index, the list of zero or one
+// terminal, the list of children and the list of siblings. Each child is the list of the child index and the hash
+func (proofCodecRLP) EncodeProof(p *MerkleProof) ([]byte, error) {
+	if err := p.checkFormat(); err != nil {
+		return nil, err
+	}
+	key, err := common.EncodeUnpackedBytes(p.Key, p.PathArity)
+	if err != nil {
+		return nil, err
+	}
+	elements := make([][]byte, len(p.Path))
+	for i, e := range p.Path {
+		pathFragment, err := common.EncodeUnpackedBytes(e.PathFragment, p.PathArity)
+		if err != nil {
+			return nil, err
+		}
+		terminal := make([][]byte, 0, 1)
+		if e.Terminal != nil {
+			terminal = append(terminal, common.RLPEncodeBytes(e.Terminal))
+		}
+		children := make([][]byte, 0, len(e.Children))
+		for j := 0; j < p.PathArity.NumChildren(); j++ {
+			if c, ok := e.Children[byte(j)]; ok {
+				children = append(children, common.RLPEncodeList(common.RLPEncodeUint(uint64(j)), common.RLPEncodeBytes(c)))
+			}
+		}
+		siblings := make([][]byte, len(e.Siblings))
+		for j, s := range e.Siblings {
+			siblings[j] = common.RLPEncodeBytes(s)
+		}
+		elements[i] = common.RLPEncodeList(
+			common.RLPEncodeBytes(pathFragment),
+			common.RLPEncodeUint(uint64(e.ChildIndex)),
+			common.RLPEncodeList(terminal...),
+			common.RLPEncodeList(children...),
+			common.RLPEncodeList(siblings...),
+		)
+	}
+	return common.RLPEncodeList(
+		common.RLPEncodeUint(uint64(p.PathArity)),
+		common.RLPEncodeUint(uint64(p.HashSize)),
+		common.RLPEncodeUint(uint64(p.Hash)),
+		common.RLPEncodeBytes(key),
+		common.RLPEncodeList(elements...),
+	), nil
+}
+
+func (proofCodecRLP) DecodeProof(data []byte) (*MerkleProof, error) {
+	item, err := common.RLPDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := item.ListOf(5)
+	if err != nil {
+		return nil, err
+	}
+	var n [3]uint64
+	for i := range n {
+		if n[i], err = fields[i].Uint(); err != nil {
+			return nil, err
+		}
+		if n[i] > 0xFF {
+			return nil, errWrongProofFormat
+		}
+	}
+	ret := &MerkleProof{
+		PathArity: common.PathArity(n[0]),
+		HashSize:  HashSize(n[1]),
+		Hash:      HashFunction(n[2]),
+	}
+	key, err := fields[3].ByteString()
+	if err != nil {
+		return nil, err
+	}
+	if ret.Key, err = common.DecodeToUnpackedBytes(key, ret.PathArity); err != nil {
+		return nil, err
+	}
+	if !fields[4].IsList {
+		return nil, errWrongProofFormat
+	}
+	ret.Path = make([]*MerkleProofElement, len(fields[4].List))
+	for i, elItem := range fields[4].List {
+		if ret.Path[i], err = decodeProofElementRLP(elItem, ret.PathArity); err != nil {
+			return nil, err
+		}
+	}
+	if len(ret.Path) > 0 && len(ret.Path[0].Siblings) > 0 {
+		ret.Scheme = VectorSchemeMerkle
+	}
+	if err = ret.checkFormat(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func decodeProofElementRLP(item *common.RLPItem, arity common.PathArity) (*MerkleProofElement, error) {
+	fields, err := item.ListOf(5)
+	if err != nil {
+		return nil, err
+	}
+	ret := &MerkleProofElement{Children: make(map[byte][]byte)}
+	pathFragment, err := fields[0].ByteString()
+	if err != nil {
+		return nil, err
+	}
+	if ret.PathFragment, err = common.DecodeToUnpackedBytes(pathFragment, arity); err != nil {
+		return nil, err
+	}
+	idx, err := fields[1].Uint()
+	if err != nil {
+		return nil, err
+	}
+	if idx > 0xFFFF {
+		return nil, errWrongProofFormat
+	}
+	ret.ChildIndex = int(idx)
+	if !fields[2].IsList || len(fields[2].List) > 1 {
+		return nil, errWrongProofFormat
+	}
+	if len(fields[2].List) == 1 {
+		if ret.Terminal, err = fields[2].List[0].ByteString(); err != nil {
+			return nil, err
+		}
+	}
+	if !fields[3].IsList || !fields[4].IsList {
+		return nil, errWrongProofFormat
+	}
+	for _, childItem := range fields[3].List {
+		pair, err := childItem.ListOf(2)
+		if err != nil {
+			return nil, err
+		}
+		i, err := pair[0].Uint()
+		if err != nil {
+			return nil, err
+		}
+		if i >= uint64(arity.NumChildren()) {
+			return nil, errWrongProofFormat
+		}
+		if _, already := ret.Children[byte(i)]; already {
+			return nil, errWrongProofFormat
+		}
+		if ret.Children[byte(i)], err = pair[1].ByteString(); err != nil {
+			return nil, err
+		}
+	}
+	for _, siblingItem := range fields[4].List {
+		sibling, err := siblingItem.ByteString()
+		if err != nil {
+			return nil, err
+		}
+		ret.Siblings = append(ret.Siblings, sibling)
+	}
+	return ret, nil
+}
+
+// EncodeProof encodes proof as deterministic CBOR array of the path arity, hash size, hash function, encoded key
+// and the array of elements. Each element is the array of the encoded path fragment, child index, terminal
+// or null, the map of children and the array of siblings. The map of children is keyed by the child index
+func (proofCodecCBOR) EncodeProof(p *MerkleProof) ([]byte, error) {
+	if err := p.checkFormat(); err != nil {
+		return nil, err
+	}
+	key, err := common.EncodeUnpackedBytes(p.Key, p.PathArity)
+	if err != nil {
+		return nil, err
+	}
+	elements := make([][]byte, len(p.Path))
+	for i, e := range p.Path {
+		pathFragment, err := common.EncodeUnpackedBytes(e.PathFragment, p.PathArity)
+		if err != nil {
+			return nil, err
+		}
+		terminal := common.CBOREncodeNull()
+		if e.Terminal != nil {
+			terminal = common.CBOREncodeBytes(e.Terminal)
+		}
+		children := make([][2][]byte, 0, len(e.Children))
+		for idx, c := range e.Children {
+			children = append(children, [2][]byte{common.CBOREncodeUint(uint64(idx)), common.CBOREncodeBytes(c)})
+		}
+		siblings := make([][]byte, len(e.Siblings))
+		for j, s := range e.Siblings {
+			siblings[j] = common.CBOREncodeBytes(s)
+		}
+		elements[i] = common.CBOREncodeArray(
+			common.CBOREncodeBytes(pathFragment),
+			common.CBOREncodeUint(uint64(e.ChildIndex)),
+			terminal,
+			common.CBOREncodeMap(children...),
+			common.CBOREncodeArray(siblings...),
+		)
+	}
+	return common.CBOREncodeArray(
+		common.CBOREncodeUint(uint64(p.PathArity)),
+		common.CBOREncodeUint(uint64(p.HashSize)),
+		common.CBOREncodeUint(uint64(p.Hash)),
+		common.CBOREncodeBytes(key),
+		common.CBOREncodeArray(elements...),
+	), nil
+}
+
+func (proofCodecCBOR) DecodeProof(data []byte) (*MerkleProof, error) {
+	item, err := common.CBORDecode(data)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := item.ArrayOf(5)
+	if err != nil {
+		return nil, err
+	}
+	var n [3]uint64
+	for i := range n {
+		if n[i], err = fields[i].Unsigned(); err != nil {
+			return nil, err
+		}
+		if n[i] > 0xFF {
+			return nil, errWrongProofFormat
+		}
+	}
+	ret := &MerkleProof{
+		PathArity: common.PathArity(n[0]),
+		HashSize:  HashSize(n[1]),
+		Hash:      HashFunction(n[2]),
+	}
+	key, err := fields[3].ByteString()
+	if err != nil {
+		return nil, err
+	}
+	if ret.Key, err = common.DecodeToUnpackedBytes(key, ret.PathArity); err != nil {
+		return nil, err
+	}
+	if fields[4].Kind != common.CBORArray {
+		return nil, errWrongProofFormat
+	}
+	ret.Path = make([]*MerkleProofElement, len(fields[4].Items))
+	for i, elItem := range fields[4].Items {
+		if ret.Path[i], err = decodeProofElementCBOR(elItem, ret.PathArity); err != nil {
+			return nil, err
+		}
+	}
+	if len(ret.Path) > 0 && len(ret.Path[0].Siblings) > 0 {
+		ret.Scheme = VectorSchemeMerkle
+	}
+	if err = ret.checkFormat(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func decodeProofElementCBOR(item *common.CBORItem, arity common.PathArity) (*MerkleProofElement, error) {
+	fields, err := item.ArrayOf(5)
+	if err != nil {
+		return nil, err
+	}
+	ret := &MerkleProofElement{Children: make(map[byte][]byte)}
+	pathFragment, err := fields[0].ByteString()
+	if err != nil {
+		return nil, err
+	}
+	if ret.PathFragment, err = common.DecodeToUnpackedBytes(pathFragment, arity); err != nil {
+		return nil, err
+	}
+	idx, err := fields[1].Unsigned()
+	if err != nil {
+		return nil, err
+	}
+	if idx > 0xFFFF {
+		return nil, errWrongProofFormat
+	}
+	ret.ChildIndex = int(idx)
+	if fields[2].Kind != common.CBORNull {
+		if ret.Terminal, err = fields[2].ByteString(); err != nil {
+			return nil, err
+		}
+	}
+	if fields[3].Kind != common.CBORMap || fields[4].Kind != common.CBORArray {
+		return nil, errWrongProofFormat
+	}
+	// keys of the map are unique and sorted by the decoder
+	for j := 0; j < len(fields[3].Items); j += 2 {
+		i, err := fields[3].Items[j].Unsigned()
+		if err != nil {
+			return nil, err
+		}
+		if i >= uint64(arity.NumChildren()) {
+			return nil, errWrongProofFormat
+		}
+		if ret.Children[byte(i)], err = fields[3].Items[j+1].ByteString(); err != nil {
+			return nil, err
+		}
+	}
+	for _, siblingItem := range fields[4].Items {
+		sibling, err := siblingItem.ByteString()
+		if err != nil {
+			return nil, err
+		}
+		ret.Siblings = append(ret.Siblings, sibling)
+	}
+	return ret, nil
+}
+
+// EncodeProof encodes proof as MerkleProof protobuf message, see proto/unitrie.proto
+func (proofCodecProtobuf) EncodeProof(p *MerkleProof) ([]byte, error) {
+	if err := p.checkFormat(); err != nil {
+		return nil, err
+	}
+	key, err := common.EncodeUnpackedBytes(p.Key, p.PathArity)
+	if err != nil {
+		return nil, err
+	}
+	ret := common.ProtobufAppendUint(nil, 1, uint64(p.PathArity))
+	ret = common.ProtobufAppendUint(ret, 2, uint64(p.HashSize))
+	ret = common.ProtobufAppendUint(ret, 3, uint64(p.Hash))
+	ret = common.ProtobufAppendBytes(ret, 4, key)
+	for _, e := range p.Path {
+		pathFragment, err := common.EncodeUnpackedBytes(e.PathFragment, p.PathArity)
+		if err != nil {
+			return nil, err
+		}
+		el := common.ProtobufAppendBytes(nil, 1, pathFragment)
+		el = common.ProtobufAppendUint(el, 2, uint64(e.ChildIndex))
+		if e.Terminal != nil {
+			el = common.ProtobufAppendField(el, 3, e.Terminal)
+		}
+		for j := 0; j < p.PathArity.NumChildren(); j++ {
+			if c, ok := e.Children[byte(j)]; ok {
+				el = common.ProtobufAppendField(el, 4, common.ProtobufEncodeChild(byte(j), c))
+			}
+		}
+		for _, s := range e.Siblings {
+			el = common.ProtobufAppendField(el, 5, s)
+		}
+		ret = common.ProtobufAppendField(ret, 5, el)
+	}
+	return ret, nil
+}
+
+func (proofCodecProtobuf) DecodeProof(data []byte) (*MerkleProof, error) {
+	fields, err := common.ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := &MerkleProof{Path: make([]*MerkleProofElement, 0)}
+	var key []byte
+	elements := make([][]byte, 0)
+	for _, f := range fields {
+		var v uint64
+		switch f.Num {
+		case 1, 2, 3:
+			if v, err = f.Unsigned(); err != nil {
+				return nil, err
+			}
+			if v > 0xFF {
+				return nil, errWrongProofFormat
+			}
+			switch f.Num {
+			case 1:
+				ret.PathArity = common.PathArity(v)
+			case 2:
+				ret.HashSize = HashSize(v)
+			case 3:
+				ret.Hash = HashFunction(v)
+			}
+		case 4:
+			if key, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+		case 5:
+			el, err := f.ByteString()
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, el)
+		}
+	}
+	// elements are decoded after all fields, because the path arity may come after them
+	if ret.Key, err = common.DecodeToUnpackedBytes(key, ret.PathArity); err != nil {
+		return nil, err
+	}
+	for _, el := range elements {
+		e, err := decodeProofElementProtobuf(el, ret.PathArity)
+		if err != nil {
+			return nil, err
+		}
+		ret.Path = append(ret.Path, e)
+	}
+	if len(ret.Path) > 0 && len(ret.Path[0].Siblings) > 0 {
+		ret.Scheme = VectorSchemeMerkle
+	}
+	if err = ret.checkFormat(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func decodeProofElementProtobuf(data []byte, arity common.PathArity) (*MerkleProofElement, error) {
+	fields, err := common.ProtobufDecodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := &MerkleProofElement{Children: make(map[byte][]byte)}
+	var pathFragment []byte
+	for _, f := range fields {
+		switch f.Num {
+		case 1:
+			if pathFragment, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+		case 2:
+			idx, err := f.Unsigned()
+			if err != nil {
+				return nil, err
+			}
+			if idx > 0xFFFF {
+				return nil, errWrongProofFormat
+			}
+			ret.ChildIndex = int(idx)
+		case 3:
+			if ret.Terminal, err = f.ByteString(); err != nil {
+				return nil, err
+			}
+		case 4:
+			child, err := f.ByteString()
+			if err != nil {
+				return nil, err
+			}
+			i, c, err := common.ProtobufDecodeChild(child)
+			if err != nil {
+				return nil, err
+			}
+			if int(i) >= arity.NumChildren() {
+				return nil, errWrongProofFormat
+			}
+			if _, already := ret.Children[i]; already {
+				return nil, errWrongProofFormat
+			}
+			ret.Children[i] = c
+		case 5:
+			sibling, err := f.ByteString()
+			if err != nil {
+				return nil, err
+			}
+			ret.Siblings = append(ret.Siblings, sibling)
+		}
+	}
+	if ret.PathFragment, err = common.DecodeToUnpackedBytes(pathFragment, arity); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// checkFormat checks consistency of the proof with the restrictions of the native binary serialization,
+// so the proof can be converted between codecs
+func (p *MerkleProof) checkFormat() error {
+	if !p.PathArity.IsValid() {
+		return common.ErrWrongArity
+	}
+	if !p.HashSize.IsValid() {
+		return errors.New("wrong hash size")
+	}
+	if p.Hash > HashFunctionBlake2bKeyed || (p.Hash == HashFunctionKeccak256 && p.HashSize != HashSize256) {
+		return errors.New("wrong hash function")
+	}
+	if len(p.Path) > 0xFFFF {
+		return errWrongProofFormat
+	}
+	for _, e := range p.Path {
+		if (len(e.Siblings) > 0) != (p.Scheme == VectorSchemeMerkle) {
+			return errors.New("proof elements of different vector schemes")
+		}
+		if len(e.Terminal) > 0xFF || len(e.Siblings) > 0xFF || e.ChildIndex > 0xFFFF {
+			return errWrongProofFormat
+		}
+		for _, c := range e.Children {
+			if len(c) != int(p.HashSize) {
+				return errWrongProofFormat
+			}
+		}
+		for _, s := range e.Siblings {
+			if len(s) != int(p.HashSize) {
+				return errWrongProofFormat
+			}
+		}
+	}
+	return nil
+}
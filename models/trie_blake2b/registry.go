@@ -0,0 +1,51 @@
+package trie_blake2b
+
+import "github.com/lunfardo314/unitrie/common"
+
+// IDs of the standard configurations of the model in the common model registry. Models with non-default
+// optional parameters are not registered
+const (
+	ModelIDBlake2bArity256Hash160 = common.ModelID(0x01) + iota
+	ModelIDBlake2bArity256Hash256
+	ModelIDBlake2bArity16Hash160
+	ModelIDBlake2bArity16Hash256
+	ModelIDBlake2bArity2Hash160
+	ModelIDBlake2bArity2Hash256
+	ModelIDKeccakArity256
+	ModelIDKeccakArity16
+	ModelIDKeccakArity2
+	ModelIDBlake2bArity4Hash160
+	ModelIDBlake2bArity4Hash256
+	ModelIDKeccakArity4
+	ModelIDBlake2bArity256Hash192
+	ModelIDBlake2bArity256Hash224
+	ModelIDBlake2bArity16Hash192
+	ModelIDBlake2bArity16Hash224
+	ModelIDBlake2bArity4Hash192
+	ModelIDBlake2bArity4Hash224
+	ModelIDBlake2bArity2Hash192
+	ModelIDBlake2bArity2Hash224
+)
+
+func init() {
+	common.MustRegisterModel(ModelIDBlake2bArity256Hash160, New(common.PathArity256, HashSize160))
+	common.MustRegisterModel(ModelIDBlake2bArity256Hash256, New(common.PathArity256, HashSize256))
+	common.MustRegisterModel(ModelIDBlake2bArity16Hash160, New(common.PathArity16, HashSize160))
+	common.MustRegisterModel(ModelIDBlake2bArity16Hash256, New(common.PathArity16, HashSize256))
+	common.MustRegisterModel(ModelIDBlake2bArity2Hash160, New(common.PathArity2, HashSize160))
+	common.MustRegisterModel(ModelIDBlake2bArity2Hash256, New(common.PathArity2, HashSize256))
+	common.MustRegisterModel(ModelIDKeccakArity256, NewKeccak256(common.PathArity256))
+	common.MustRegisterModel(ModelIDKeccakArity16, NewKeccak256(common.PathArity16))
+	common.MustRegisterModel(ModelIDKeccakArity2, NewKeccak256(common.PathArity2))
+	common.MustRegisterModel(ModelIDBlake2bArity4Hash160, New(common.PathArity4, HashSize160))
+	common.MustRegisterModel(ModelIDBlake2bArity4Hash256, New(common.PathArity4, HashSize256))
+	common.MustRegisterModel(ModelIDKeccakArity4, NewKeccak256(common.PathArity4))
+	common.MustRegisterModel(ModelIDBlake2bArity256Hash192, New(common.PathArity256, HashSize192))
+	common.MustRegisterModel(ModelIDBlake2bArity256Hash224, New(common.PathArity256, HashSize224))
+	common.MustRegisterModel(ModelIDBlake2bArity16Hash192, New(common.PathArity16, HashSize192))
+	common.MustRegisterModel(ModelIDBlake2bArity16Hash224, New(common.PathArity16, HashSize224))
+	common.MustRegisterModel(ModelIDBlake2bArity4Hash192, New(common.PathArity4, HashSize192))
+	common.MustRegisterModel(ModelIDBlake2bArity4Hash224, New(common.PathArity4, HashSize224))
+	common.MustRegisterModel(ModelIDBlake2bArity2Hash192, New(common.PathArity2, HashSize192))
+	common.MustRegisterModel(ModelIDBlake2bArity2Hash224, New(common.PathArity2, HashSize224))
+}
@@ -0,0 +1,228 @@
+package trie_blake2b_verify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+)
+
+// Verification of ICS-23 proofs of the ICS-23 vector scheme, see trie_blake2b.ProofICS23.
+// It follows the verification algorithm of the ICS-23 reference implementation (cosmos/ics23), restricted
+// to existence and non-existence proofs and to operations of trie_blake2b.ICS23Spec. IBC light clients verify
+// the same proofs with the ICS-23 library
+
+// VerifyICS23Membership checks that the proof proves the key with the value against the root
+func VerifyICS23Membership(spec *trie_blake2b.ICS23ProofSpec, root []byte, p *trie_blake2b.ICS23CommitmentProof, key, value []byte) error {
+	if p.Exist == nil {
+		return errors.New("ICS-23 proof of existence expected")
+	}
+	if !bytes.Equal(p.Exist.Key, key) || !bytes.Equal(p.Exist.Value, value) {
+		return errors.New("ICS-23 proof is not about the key and the value")
+	}
+	return verifyICS23Existence(spec, root, p.Exist)
+}
+
+// VerifyICS23NonMembership checks that the proof proves absence of the key against the root
+func VerifyICS23NonMembership(spec *trie_blake2b.ICS23ProofSpec, root []byte, p *trie_blake2b.ICS23CommitmentProof, key []byte) error {
+	ne := p.Nonexist
+	if ne == nil {
+		return errors.New("ICS-23 proof of non-existence expected")
+	}
+	if !bytes.Equal(ne.Key, key) {
+		return errors.New("ICS-23 proof is not about the key")
+	}
+	if ne.Left == nil && ne.Right == nil {
+		return errors.New("ICS-23 proof of non-existence: both neighbors are missing")
+	}
+	if ne.Left != nil {
+		if err := verifyICS23Existence(spec, root, ne.Left); err != nil {
+			return fmt.Errorf("left neighbor: %w", err)
+		}
+		if bytes.Compare(ne.Left.Key, key) >= 0 {
+			return errors.New("left neighbor is not less than the key")
+		}
+	}
+	if ne.Right != nil {
+		if err := verifyICS23Existence(spec, root, ne.Right); err != nil {
+			return fmt.Errorf("right neighbor: %w", err)
+		}
+		if bytes.Compare(key, ne.Right.Key) >= 0 {
+			return errors.New("right neighbor is not greater than the key")
+		}
+	}
+	switch {
+	case ne.Left == nil:
+		if !isICS23LeftMost(spec.InnerSpec, ne.Right.Path) {
+			return errors.New("right neighbor is not the leftmost")
+		}
+	case ne.Right == nil:
+		if !isICS23RightMost(spec.InnerSpec, ne.Left.Path) {
+			return errors.New("left neighbor is not the rightmost")
+		}
+	default:
+		if !isICS23LeftNeighbor(spec.InnerSpec, ne.Left.Path, ne.Right.Path) {
+			return errors.New("neighbors are not adjacent")
+		}
+	}
+	return nil
+}
+
+func verifyICS23Existence(spec *trie_blake2b.ICS23ProofSpec, root []byte, p *trie_blake2b.ICS23ExistenceProof) error {
+	if err := checkICS23AgainstSpec(spec, p); err != nil {
+		return err
+	}
+	c, err := p.CalculateRoot()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(c, root) {
+		return errors.New("invalid ICS-23 proof: calculated root not equal to the root")
+	}
+	return nil
+}
+
+func checkICS23AgainstSpec(spec *trie_blake2b.ICS23ProofSpec, p *trie_blake2b.ICS23ExistenceProof) error {
+	leaf, ls := p.Leaf, spec.LeafSpec
+	if leaf == nil {
+		return errors.New("ICS-23 proof without leaf")
+	}
+	if leaf.Hash != ls.Hash || leaf.PrehashKey != ls.PrehashKey || leaf.PrehashValue != ls.PrehashValue || leaf.Length != ls.Length {
+		return errors.New("ICS-23 leaf does not match the spec")
+	}
+	if !bytes.HasPrefix(leaf.Prefix, ls.Prefix) {
+		return errors.New("ICS-23 leaf prefix does not match the spec")
+	}
+	if spec.MinDepth > 0 && len(p.Path) < int(spec.MinDepth) {
+		return errors.New("ICS-23 proof is too short")
+	}
+	if spec.MaxDepth > 0 && len(p.Path) > int(spec.MaxDepth) {
+		return errors.New("ICS-23 proof is too long")
+	}
+	is := spec.InnerSpec
+	maxPrefixLength := int(is.MaxPrefixLength) + (len(is.ChildOrder)-1)*int(is.ChildSize)
+	for i, op := range p.Path {
+		if op.Hash != is.Hash {
+			return fmt.Errorf("ICS-23 inner op %d: hash does not match the spec", i)
+		}
+		if bytes.HasPrefix(op.Prefix, ls.Prefix) {
+			return fmt.Errorf("ICS-23 inner op %d: prefix of the leaf", i)
+		}
+		if len(op.Prefix) < int(is.MinPrefixLength) || len(op.Prefix) > maxPrefixLength {
+			return fmt.Errorf("ICS-23 inner op %d: wrong prefix length", i)
+		}
+		if len(op.Suffix)%int(is.ChildSize) != 0 {
+			return fmt.Errorf("ICS-23 inner op %d: wrong suffix length", i)
+		}
+	}
+	return nil
+}
+
+// isICS23LeftNeighbor checks if left and right paths lead to adjacent leaves: they share the top of the path,
+// diverge in adjacent children and the rest is the rightmost and the leftmost path, respectively
+func isICS23LeftNeighbor(spec *trie_blake2b.ICS23InnerSpec, left, right []*trie_blake2b.ICS23InnerOp) bool {
+	l, r := len(left)-1, len(right)-1
+	for l >= 0 && r >= 0 && bytes.Equal(left[l].Prefix, right[r].Prefix) && bytes.Equal(left[l].Suffix, right[r].Suffix) {
+		l--
+		r--
+	}
+	if l < 0 || r < 0 {
+		return false
+	}
+	leftIdx, ok1 := ics23OrderFromPadding(spec, left[l])
+	rightIdx, ok2 := ics23OrderFromPadding(spec, right[r])
+	if !ok1 || !ok2 || rightIdx != leftIdx+1 {
+		return false
+	}
+	return isICS23RightMost(spec, left[:l]) && isICS23LeftMost(spec, right[:r])
+}
+
+func isICS23LeftMost(spec *trie_blake2b.ICS23InnerSpec, path []*trie_blake2b.ICS23InnerOp) bool {
+	minPrefix, maxPrefix, suffix := ics23Padding(spec, 0)
+	for _, op := range path {
+		if !ics23HasPadding(op, minPrefix, maxPrefix, suffix) && !ics23LeftBranchesAreEmpty(spec, op) {
+			return false
+		}
+	}
+	return true
+}
+
+func isICS23RightMost(spec *trie_blake2b.ICS23InnerSpec, path []*trie_blake2b.ICS23InnerOp) bool {
+	minPrefix, maxPrefix, suffix := ics23Padding(spec, len(spec.ChildOrder)-1)
+	for _, op := range path {
+		if !ics23HasPadding(op, minPrefix, maxPrefix, suffix) && !ics23RightBranchesAreEmpty(spec, op) {
+			return false
+		}
+	}
+	return true
+}
+
+func ics23LeftBranchesAreEmpty(spec *trie_blake2b.ICS23InnerSpec, op *trie_blake2b.ICS23InnerOp) bool {
+	idx, ok := ics23OrderFromPadding(spec, op)
+	if !ok || idx == 0 {
+		return false
+	}
+	sz := int(spec.ChildSize)
+	actualPrefix := len(op.Prefix) - idx*sz
+	if actualPrefix < 0 {
+		return false
+	}
+	for i := 0; i < idx; i++ {
+		from := actualPrefix + ics23Position(spec, i)*sz
+		if !bytes.Equal(spec.EmptyChild, op.Prefix[from:from+sz]) {
+			return false
+		}
+	}
+	return true
+}
+
+func ics23RightBranchesAreEmpty(spec *trie_blake2b.ICS23InnerSpec, op *trie_blake2b.ICS23InnerOp) bool {
+	idx, ok := ics23OrderFromPadding(spec, op)
+	if !ok {
+		return false
+	}
+	rightBranches := len(spec.ChildOrder) - 1 - idx
+	sz := int(spec.ChildSize)
+	if rightBranches == 0 || len(op.Suffix) != rightBranches*sz {
+		return false
+	}
+	for i := 0; i < rightBranches; i++ {
+		from := (ics23Position(spec, idx+1+i) - idx - 1) * sz
+		if !bytes.Equal(spec.EmptyChild, op.Suffix[from:from+sz]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ics23OrderFromPadding returns the branch of the child in the inner op, determined by lengths of the prefix and the suffix
+func ics23OrderFromPadding(spec *trie_blake2b.ICS23InnerSpec, op *trie_blake2b.ICS23InnerOp) (int, bool) {
+	for branch := range spec.ChildOrder {
+		minPrefix, maxPrefix, suffix := ics23Padding(spec, branch)
+		if ics23HasPadding(op, minPrefix, maxPrefix, suffix) {
+			return branch, true
+		}
+	}
+	return 0, false
+}
+
+func ics23Padding(spec *trie_blake2b.ICS23InnerSpec, branch int) (minPrefix, maxPrefix, suffix int) {
+	idx := ics23Position(spec, branch)
+	prefix := idx * int(spec.ChildSize)
+	return prefix + int(spec.MinPrefixLength), prefix + int(spec.MaxPrefixLength), (len(spec.ChildOrder) - 1 - idx) * int(spec.ChildSize)
+}
+
+func ics23HasPadding(op *trie_blake2b.ICS23InnerOp, minPrefix, maxPrefix, suffix int) bool {
+	return len(op.Prefix) >= minPrefix && len(op.Prefix) <= maxPrefix && len(op.Suffix) == suffix
+}
+
+// ics23Position returns position of the branch in the ChildOrder
+func ics23Position(spec *trie_blake2b.ICS23InnerSpec, branch int) int {
+	for i, b := range spec.ChildOrder {
+		if int(b) == branch {
+			return i
+		}
+	}
+	panic("branch not in the child order")
+}
@@ -56,13 +56,32 @@ func IsProofOfAbsence(p *trie_blake2b.MerkleProof) bool {
 
 // Validate check the proof against the provided root commitments
 func Validate(p *trie_blake2b.MerkleProof, rootBytes []byte) error {
+	return validate(p, rootBytes, nil)
+}
+
+// ValidateKeyed checks the proof of the keyed model (see trie_blake2b.NewKeyed) against the provided root commitment.
+// The key must be the same as the key of the model the proof was created with
+func ValidateKeyed(p *trie_blake2b.MerkleProof, rootBytes, key []byte) error {
+	if len(key) == 0 {
+		return xerrors.New("key is required")
+	}
+	return validate(p, rootBytes, key)
+}
+
+func validate(p *trie_blake2b.MerkleProof, rootBytes, key []byte) error {
+	if (p.Hash == trie_blake2b.HashFunctionBlake2bKeyed) != (len(key) > 0) {
+		if len(key) == 0 {
+			return xerrors.New("key is required to validate the proof of the keyed model")
+		}
+		return xerrors.New("proof is not of the keyed model")
+	}
 	if len(p.Path) == 0 {
 		if len(rootBytes) != 0 {
 			return xerrors.New("proof is empty")
 		}
 		return nil
 	}
-	c, err := verify(p, nil, 0, 0)
+	c, err := verify(p, key, nil, 0, 0)
 	if err != nil {
 		return err
 	}
@@ -75,18 +94,30 @@ func Validate(p *trie_blake2b.MerkleProof, rootBytes []byte) error {
 // ValidateWithTerminal checks the proof and checks if the proof commits to the specific value
 // The check is dependent on the commitment model because of valueOptimisationThreshold
 func ValidateWithTerminal(p *trie_blake2b.MerkleProof, rootBytes, terminalBytes []byte) error {
-	if err := Validate(p, rootBytes); err != nil {
+	return validateWithTerminal(p, rootBytes, terminalBytes, nil)
+}
+
+// ValidateWithTerminalKeyed same as ValidateWithTerminal for the proof of the keyed model
+func ValidateWithTerminalKeyed(p *trie_blake2b.MerkleProof, rootBytes, terminalBytes, key []byte) error {
+	if len(key) == 0 {
+		return xerrors.New("key is required")
+	}
+	return validateWithTerminal(p, rootBytes, terminalBytes, key)
+}
+
+func validateWithTerminal(p *trie_blake2b.MerkleProof, rootBytes, terminalBytes, key []byte) error {
+	if err := validate(p, rootBytes, key); err != nil {
 		return err
 	}
 	_, terminalBytesInProof := MustKeyWithTerminal(p)
-	compressedTerm, _ := trie_blake2b.CompressToHashSize(terminalBytes, p.HashSize)
+	compressedTerm := compress(terminalBytes, p.HashSize, p.Hash, key)
 	if !bytes.Equal(compressedTerm, terminalBytesInProof) {
 		return errors.New("key does not correspond to the given value commitment")
 	}
 	return nil
 }
 
-func verify(p *trie_blake2b.MerkleProof, triePath []byte, pathIdx, keyIdx int) ([]byte, error) {
+func verify(p *trie_blake2b.MerkleProof, key, triePath []byte, pathIdx, keyIdx int) ([]byte, error) {
 	common.Assertf(pathIdx < len(p.Path), "assertion: pathIdx < lenPlus1(p.Path)")
 	common.Assertf(keyIdx <= len(p.Key), "assertion: keyIdx <= lenPlus1(p.Key)")
 
@@ -110,11 +141,11 @@ func verify(p *trie_blake2b.MerkleProof, triePath []byte, pathIdx, keyIdx int) (
 			return nil, fmt.Errorf("wrong proof: proof path out of key bounds. Path position: %d, key position %d", pathIdx, keyIdx)
 		}
 		nextTriePath := common.Concat(triePath, elem.PathFragment, p.Key[nextKeyIdx-1])
-		c, err := verify(p, nextTriePath, pathIdx+1, nextKeyIdx)
+		c, err := verify(p, key, nextTriePath, pathIdx+1, nextKeyIdx)
 		if err != nil {
 			return nil, err
 		}
-		return hashProofElement(elem, triePath, c, p.PathArity, p.HashSize)
+		return hashProofElement(elem, triePath, c, p, key)
 	}
 	// it is the last in the path
 	if p.PathArity.IsValidChildIndex(elem.ChildIndex) {
@@ -122,18 +153,18 @@ func verify(p *trie_blake2b.MerkleProof, triePath []byte, pathIdx, keyIdx int) (
 		if c != nil {
 			return nil, fmt.Errorf("wrong proof: child commitment of the last element expected to be nil. Path position: %d, key position %d", pathIdx, keyIdx)
 		}
-		return hashProofElement(elem, triePath, nil, p.PathArity, p.HashSize)
+		return hashProofElement(elem, triePath, nil, p, key)
 	}
 	if elem.ChildIndex != p.PathArity.TerminalCommitmentIndex() && elem.ChildIndex != p.PathArity.PathCommitmentIndex() {
 		return nil, fmt.Errorf("wrong proof: child index expected to be %d or %d. Path position: %d, key position %d",
 			p.PathArity.TerminalCommitmentIndex(), p.PathArity.PathCommitmentIndex(), pathIdx, keyIdx)
 	}
-	return hashProofElement(elem, triePath, nil, p.PathArity, p.HashSize)
+	return hashProofElement(elem, triePath, nil, p, key)
 }
 
 const errTooLongCommitment = "too long commitment at position %d. Can't be longer than %d bytes"
 
-func makeHashVector(e *trie_blake2b.MerkleProofElement, nodePath []byte, missingCommitment []byte, arity common.PathArity, sz trie_blake2b.HashSize) ([][]byte, error) {
+func makeHashVector(e *trie_blake2b.MerkleProofElement, nodePath []byte, missingCommitment []byte, arity common.PathArity, sz trie_blake2b.HashSize, hf trie_blake2b.HashFunction, key []byte) ([][]byte, error) {
 	hashes := make([][]byte, arity.VectorLength())
 	for idx, c := range e.Children {
 		if !arity.IsValidChildIndex(int(idx)) {
@@ -152,7 +183,7 @@ func makeHashVector(e *trie_blake2b.MerkleProofElement, nodePath []byte, missing
 	}
 
 	pathToCommit := common.Concat(nodePath, byte('+'), e.PathFragment)
-	rawBytes, _ := trie_blake2b.CompressToHashSize(pathToCommit, sz)
+	rawBytes := compress(pathToCommit, sz, hf, key)
 	hashes[arity.PathCommitmentIndex()] = rawBytes
 	if arity.IsValidChildIndex(e.ChildIndex) {
 		if len(missingCommitment) > int(sz) {
@@ -163,10 +194,54 @@ func makeHashVector(e *trie_blake2b.MerkleProofElement, nodePath []byte, missing
 	return hashes, nil
 }
 
-func hashProofElement(e *trie_blake2b.MerkleProofElement, nodePath []byte, missingCommitment []byte, arity common.PathArity, sz trie_blake2b.HashSize) ([]byte, error) {
-	hashVector, err := makeHashVector(e, nodePath, missingCommitment, arity, sz)
+func hashProofElement(e *trie_blake2b.MerkleProofElement, nodePath []byte, missingCommitment []byte, p *trie_blake2b.MerkleProof, key []byte) ([]byte, error) {
+	if p.Scheme == trie_blake2b.VectorSchemeMerkle {
+		return hashProofElementMerkle(e, nodePath, missingCommitment, p, key)
+	}
+	hashVector, err := makeHashVector(e, nodePath, missingCommitment, p.PathArity, p.HashSize, p.Hash, key)
 	if err != nil {
 		return nil, err
 	}
-	return trie_blake2b.HashTheVector(hashVector, arity, sz), nil
+	if p.Hash == trie_blake2b.HashFunctionBlake2bKeyed {
+		return trie_blake2b.HashTheVectorKeyed(hashVector, p.PathArity, p.HashSize, key), nil
+	}
+	return trie_blake2b.HashTheVector(hashVector, p.PathArity, p.HashSize, p.Hash), nil
+}
+
+func compress(data []byte, sz trie_blake2b.HashSize, hf trie_blake2b.HashFunction, key []byte) []byte {
+	var ret []byte
+	if hf == trie_blake2b.HashFunctionBlake2bKeyed {
+		ret, _ = trie_blake2b.CompressToHashSizeKeyed(data, sz, key)
+	} else {
+		ret, _ = trie_blake2b.CompressToHashSize(data, sz, hf)
+	}
+	return ret
+}
+
+// hashProofElementMerkle calculates commitment of the node from the path commitment, commitment at the child index
+// and siblings in the Merkle tree of the vector
+func hashProofElementMerkle(e *trie_blake2b.MerkleProofElement, nodePath []byte, missingCommitment []byte, p *trie_blake2b.MerkleProof, key []byte) ([]byte, error) {
+	if len(e.Children) > 0 {
+		return nil, errors.New("wrong proof: unexpected children in the element of the Merkle vector scheme")
+	}
+	arity := p.PathArity
+	elements := map[int][]byte{
+		arity.PathCommitmentIndex(): compress(common.Concat(nodePath, byte('+'), e.PathFragment), p.HashSize, p.Hash, key),
+	}
+	switch {
+	case arity.IsValidChildIndex(e.ChildIndex):
+		if len(missingCommitment) > int(p.HashSize) {
+			return nil, fmt.Errorf(errTooLongCommitment+" (skipped commitment)", e.ChildIndex, int(p.HashSize))
+		}
+		elements[e.ChildIndex] = missingCommitment
+	case e.ChildIndex == arity.TerminalCommitmentIndex():
+		if len(e.Terminal) > int(p.HashSize) {
+			return nil, fmt.Errorf(errTooLongCommitment+" (terminal)", e.ChildIndex, int(p.HashSize))
+		}
+		elements[e.ChildIndex] = e.Terminal
+	}
+	if len(e.Terminal) > 0 && e.ChildIndex != arity.TerminalCommitmentIndex() {
+		return nil, errors.New("wrong proof: unexpected terminal in the element of the Merkle vector scheme")
+	}
+	return trie_blake2b.VectorRootFromProof(elements, e.Siblings, arity, p.HashSize, p.Hash, key)
 }
@@ -0,0 +1,231 @@
+package trie_blake2b
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// VectorScheme is the way the model commits to the vector of the node: children, terminal and path commitments.
+// With the flat scheme (default) the commitment is the hash of the concatenation of all elements, so the proof
+// contains the whole vector of each node in the path. With the Merkle scheme the commitment is the root of the binary
+// Merkle tree over the elements of the vector, so the proof contains only siblings along the path in the tree:
+// logarithmic in the arity. It makes proofs of the arity-256 trie an order of magnitude smaller.
+//
+// The tree is of fixed depth, each leaf is the element padded with zeros to the hash size. The vector is padded with
+// empty elements to the power of 2. The parent of two empty (all zero) elements is empty, so empty subtrees
+// are not hashed. Otherwise, the parent is the hash of the concatenation of two elements
+//
+// The ICS-23 scheme is the dedicated layout of the node for IBC light clients: proofs of the trie can be converted
+// into ICS-23 CommitmentProof, see ProofICS23. It is only defined for the Keccak model
+type VectorScheme byte
+
+const (
+	VectorSchemeFlat = VectorScheme(iota)
+	VectorSchemeMerkle
+	VectorSchemeICS23
+)
+
+var errWrongVectorProof = errors.New("wrong Merkle proof of the vector")
+
+func (s VectorScheme) String() string {
+	switch s {
+	case VectorSchemeFlat:
+		return "flat"
+	case VectorSchemeMerkle:
+		return "merkle"
+	case VectorSchemeICS23:
+		return "ics23"
+	default:
+		return fmt.Sprintf("VectorScheme(%d)", byte(s))
+	}
+}
+
+// SetVectorScheme sets the commitment scheme of the node vector. Flat by default.
+// It changes commitments of the trie, so it must be called before the model is used
+func (m *CommitmentModel) SetVectorScheme(s VectorScheme) {
+	common.Assertf(s == VectorSchemeFlat || s == VectorSchemeMerkle || s == VectorSchemeICS23, "wrong vector scheme %s", s)
+	common.Assertf(s != VectorSchemeICS23 || m.hashFunction == HashFunctionKeccak256, "%s vector scheme requires %s", s, HashFunctionKeccak256)
+	m.vectorScheme = s
+}
+
+func (m *CommitmentModel) VectorScheme() VectorScheme {
+	return m.vectorScheme
+}
+
+// hashVectorBuffer hashes the vector, assembled in the buffer, according to the vector scheme.
+// The Merkle scheme overwrites the buffer
+func (m *CommitmentModel) hashVectorBuffer(buf []byte) []byte {
+	if m.vectorScheme == VectorSchemeMerkle {
+		return merkleRootInPlace(buf, int(m.hashSize), m.hashIt)
+	}
+	return m.hashIt(buf)
+}
+
+// merkleRootInPlace calculates root of the Merkle tree over elements of the buffer. Each level overwrites the previous one
+func merkleRootInPlace(buf []byte, sz int, h func([]byte) []byte) []byte {
+	var pair [2 * HashSize256]byte
+	for n := len(buf) / sz; n > 1; n = (n + 1) / 2 {
+		for i := 0; i < (n+1)/2; i++ {
+			left := buf[2*i*sz : (2*i+1)*sz]
+			var right []byte
+			if 2*i+1 < n {
+				right = buf[(2*i+1)*sz : (2*i+2)*sz]
+			}
+			merkleParent(buf[i*sz:(i+1)*sz], left, right, pair[:2*sz], h)
+		}
+	}
+	return common.Concat(buf[:sz])
+}
+
+// merkleParent puts parent of two elements into dst. Nil right element is empty
+func merkleParent(dst, left, right, pair []byte, h func([]byte) []byte) {
+	if isZero(left) && isZero(right) {
+		for i := range dst {
+			dst[i] = 0
+		}
+		return
+	}
+	sz := len(left)
+	copy(pair[:sz], left)
+	for i := sz; i < len(pair); i++ {
+		pair[i] = 0
+	}
+	copy(pair[sz:], right)
+	copy(dst, h(pair))
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// merkleLevels returns all levels of the Merkle tree over elements of the buffer. The last level is the root
+func merkleLevels(buf []byte, sz int, h func([]byte) []byte) [][]byte {
+	ret := [][]byte{common.Concat(buf)}
+	pair := make([]byte, 2*sz)
+	for n := len(buf) / sz; n > 1; n = (n + 1) / 2 {
+		prev := ret[len(ret)-1]
+		next := make([]byte, (n+1)/2*sz)
+		for i := 0; i < (n+1)/2; i++ {
+			var right []byte
+			if 2*i+1 < n {
+				right = prev[(2*i+1)*sz : (2*i+2)*sz]
+			}
+			merkleParent(next[i*sz:(i+1)*sz], prev[2*i*sz:(2*i+1)*sz], right, pair, h)
+		}
+		ret = append(ret, next)
+	}
+	return ret
+}
+
+// walkMerkleProof walks the Merkle tree from known leaves to the root level by level, in the canonical order
+// of the multi-proof. The callback is called for each position known at the level and its sibling.
+// The sibling is needed (not known and not outside the level) if needSibling is true
+func walkMerkleProof(indices []int, vectorLength int, fun func(level, pos, sibling int, needSibling bool) error) error {
+	known := make([]int, len(indices))
+	copy(known, indices)
+	sort.Ints(known)
+	level := 0
+	for n := vectorLength; n > 1; n = (n + 1) / 2 {
+		next := make([]int, 0, len(known))
+		for j := 0; j < len(known); j++ {
+			pos := known[j]
+			if j > 0 && known[j-1] == pos {
+				continue
+			}
+			sibling := pos ^ 1
+			needSibling := sibling < n
+			if j+1 < len(known) && known[j+1] == sibling {
+				needSibling = false
+				j++
+			}
+			if err := fun(level, pos, sibling, needSibling); err != nil {
+				return err
+			}
+			next = append(next, pos/2)
+		}
+		known = next
+		level++
+	}
+	return nil
+}
+
+// vectorProof returns siblings needed to calculate the root of the Merkle tree over the vector from elements at indices
+func (m *CommitmentModel) vectorProof(buf []byte, indices []int) [][]byte {
+	sz := int(m.hashSize)
+	levels := merkleLevels(buf, sz, m.hashIt)
+	ret := make([][]byte, 0)
+	err := walkMerkleProof(indices, len(buf)/sz, func(level, _, sibling int, needSibling bool) error {
+		if needSibling {
+			ret = append(ret, common.Concat(levels[level][sibling*sz:(sibling+1)*sz]))
+		}
+		return nil
+	})
+	common.AssertNoError(err)
+	return ret
+}
+
+// VectorRootFromProof calculates commitment to the vector of the Merkle scheme from known elements and siblings
+// of the proof. Elements are indexed by the position in the vector, missing elements are nil.
+// Optional key is the key of the keyed model
+func VectorRootFromProof(elements map[int][]byte, siblings [][]byte, arity common.PathArity, sz HashSize, hf HashFunction, key ...[]byte) ([]byte, error) {
+	if len(elements) == 0 {
+		return nil, errWrongVectorProof
+	}
+	h := func(data []byte) []byte {
+		return hashIt(data, sz, hf, key...)
+	}
+	values := make(map[int][]byte)
+	indices := make([]int, 0, len(elements))
+	for idx, e := range elements {
+		if idx < 0 || idx >= arity.VectorLength() || len(e) > int(sz) {
+			return nil, errWrongVectorProof
+		}
+		values[idx] = make([]byte, sz)
+		copy(values[idx], e)
+		indices = append(indices, idx)
+	}
+	zero := make([]byte, sz)
+	pair := make([]byte, 2*sz)
+	nextValues := make(map[int][]byte)
+	curLevel := 0
+	err := walkMerkleProof(indices, arity.VectorLength(), func(level, pos, sibling int, needSibling bool) error {
+		if level != curLevel {
+			values, nextValues = nextValues, make(map[int][]byte)
+			curLevel = level
+		}
+		sibValue, known := values[sibling]
+		switch {
+		case needSibling:
+			if len(siblings) == 0 || len(siblings[0]) != int(sz) {
+				return errWrongVectorProof
+			}
+			sibValue = siblings[0]
+			siblings = siblings[1:]
+		case !known:
+			sibValue = zero
+		}
+		left, right := values[pos], sibValue
+		if pos%2 == 1 {
+			left, right = right, left
+		}
+		parent := make([]byte, sz)
+		merkleParent(parent, left, right, pair, h)
+		nextValues[pos/2] = parent
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(siblings) != 0 {
+		return nil, errWrongVectorProof
+	}
+	return nextValues[0], nil
+}
@@ -1,34 +1,92 @@
 package trie_kzg_bn256
 
-import "go.dedis.ch/kyber/v3"
+import (
+	"runtime"
+	"sync"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/random"
+)
 
 // commit commits to vector vect[0], ...., vect[D-1]
 // it is [f(s)]1 where f is polynomial  in evaluation (Lagrange) form,
 // i.e. with f(rou[i]) = vect[i], i = 0..D-1
 // vect[k] == nil equivalent to 0
 func (sd *TrustedSetup) commit(vect []kyber.Scalar) kyber.Point {
-	ret := sd.Suite.G1().Point().Null()
-	elem := sd.Suite.G1().Point()
-	for i, e := range vect {
-		if e == nil {
-			continue
+	return sd.sumParallel(len(vect), sd.maxGoroutines(), func(i int, elem kyber.Point, _ kyber.Scalar) bool {
+		if vect[i] == nil {
+			return false
 		}
-		elem.Mul(e, sd.LagrangeBasis[i])
-		ret.Add(ret, elem)
-	}
-	return ret
+		elem.Mul(vect[i], sd.LagrangeBasis[i])
+		return true
+	})
 }
 
 // prove returns pi = [(f(s)-vect<index>)/(s-rou<index>)]1
 // This is the proof sent to verifier
 func (sd *TrustedSetup) prove(vect []kyber.Scalar, i int) kyber.Point {
-	ret := sd.Suite.G1().Point().Null()
-	e := sd.Suite.G1().Point()
-	qij := sd.Suite.G1().Scalar()
-	for j := range sd.Domain {
+	return sd.proveParallel(vect, i, sd.maxGoroutines())
+}
+
+func (sd *TrustedSetup) proveParallel(vect []kyber.Scalar, i int, maxGoroutines int) kyber.Point {
+	return sd.sumParallel(len(sd.Domain), maxGoroutines, func(j int, elem kyber.Point, qij kyber.Scalar) bool {
 		sd.qPoly(vect, i, j, vect[i], qij)
-		e.Mul(qij, sd.LagrangeBasis[j])
-		ret.Add(ret, e)
+		elem.Mul(qij, sd.LagrangeBasis[j])
+		return true
+	})
+}
+
+// minTermsPerGoroutine is the minimum number of terms of the sum calculated by one goroutine
+const minTermsPerGoroutine = 16
+
+// SetParallelism sets maximum number of goroutines used to calculate commitments and proofs.
+// 0 means runtime.GOMAXPROCS, 1 means calculations are sequential. Default is 0
+func (sd *TrustedSetup) SetParallelism(n int) {
+	sd.parallelism = n
+}
+
+func (sd *TrustedSetup) maxGoroutines() int {
+	if sd.parallelism <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return sd.parallelism
+}
+
+// sumParallel returns sum of n points. Function term sets elem to the i-th term and returns true,
+// or returns false if the term is 0. Scalar s is a temporary variable for the term function.
+// The sum is split into chunks, calculated in parallel by up to maxGoroutines goroutines
+func (sd *TrustedSetup) sumParallel(n int, maxGoroutines int, term func(i int, elem kyber.Point, s kyber.Scalar) bool) kyber.Point {
+	numChunks := maxGoroutines
+	if maxChunks := n / minTermsPerGoroutine; numChunks > maxChunks {
+		numChunks = maxChunks
+	}
+	sumChunk := func(from, to int) kyber.Point {
+		ret := sd.Suite.G1().Point().Null()
+		elem := sd.Suite.G1().Point()
+		s := sd.Suite.G1().Scalar()
+		for i := from; i < to; i++ {
+			if term(i, elem, s) {
+				ret.Add(ret, elem)
+			}
+		}
+		return ret
+	}
+	if numChunks <= 1 {
+		return sumChunk(0, n)
+	}
+	partial := make([]kyber.Point, numChunks)
+	var wg sync.WaitGroup
+	wg.Add(numChunks)
+	for c := 0; c < numChunks; c++ {
+		go func(c int) {
+			defer wg.Done()
+			partial[c] = sumChunk(c*n/numChunks, (c+1)*n/numChunks)
+		}(c)
+	}
+	wg.Wait()
+	ret := partial[0]
+	for _, p := range partial[1:] {
+		ret.Add(ret, p)
 	}
 	return ret
 }
@@ -89,6 +147,55 @@ func (sd *TrustedSetup) verify(c, pi kyber.Point, v kyber.Scalar, atIndex int) b
 	return p1.Equal(p2)
 }
 
+// ProofTuple is a claim that the polynomial committed with Commitment has Value at the domain element with Index.
+// Proof is the KZG proof of the claim
+type ProofTuple struct {
+	Commitment kyber.Point
+	Proof      kyber.Point
+	Value      kyber.Scalar // nil means 0
+	Index      int
+}
+
+// VerifyBatch verifies all tuples at once with 2 pairings instead of 2 pairings per tuple.
+// Each of the equations e(pi, [s-d<i>]2) == e(c-[v]1, [1]2) is multiplied by the random scalar r, then
+// e(pi, [s-d<i>]2) is split into e(pi, [s]2) * e(-d<i>*pi, [1]2) and equations are summed up:
+// e(sum(r*pi), [s]2) == e(sum(r*(c-[v]1+d<i>*pi)), [1]2)
+// Random scalars make it impossible to craft invalid tuples which cancel each other in the sum.
+// Returns false if any tuple is invalid
+func (sd *TrustedSetup) VerifyBatch(tuples []ProofTuple) bool {
+	if len(tuples) == 0 {
+		return true
+	}
+	// [s]2 = [s-d<0>]2 + [d<0>]2
+	s2 := sd.Suite.G2().Point().Mul(sd.Domain[0], nil)
+	s2.Add(s2, sd.Diff2[0])
+
+	left := sd.Suite.G1().Point().Null()
+	right := sd.Suite.G1().Point().Null()
+	r := sd.Suite.G1().Scalar()
+	t := sd.Suite.G1().Scalar()
+	elem := sd.Suite.G1().Point()
+	rnd := random.New()
+	for i := range tuples {
+		tp := &tuples[i]
+		if tp.Index < 0 || tp.Index >= int(sd.D) || tp.Commitment == nil || tp.Proof == nil {
+			return false
+		}
+		r.Pick(rnd)
+		left.Add(left, elem.Mul(r, tp.Proof))
+		right.Add(right, elem.Mul(r, tp.Commitment))
+		if tp.Value != nil {
+			t.Mul(r, tp.Value)
+			right.Sub(right, elem.Mul(t, nil))
+		}
+		t.Mul(r, sd.Domain[tp.Index])
+		right.Add(right, elem.Mul(t, tp.Proof))
+	}
+	p1 := sd.Suite.Pair(left, s2)
+	p2 := sd.Suite.Pair(right, sd.Suite.G2().Point().Base())
+	return p1.Equal(p2)
+}
+
 // verifyVector calculates proofs and verifies all elements in the vector against commitment C
 func (sd *TrustedSetup) verifyVector(vect []kyber.Scalar, c kyber.Point) bool {
 	pi := make([]kyber.Point, sd.D)
@@ -109,15 +216,28 @@ func (sd *TrustedSetup) verifyVector(vect []kyber.Scalar, c kyber.Point) bool {
 
 // commitAll return commit to the whole vector and to each of values of it
 // Generate commitment to the vector and proofs to all values.
+// Proofs are calculated in parallel, each of them by one goroutine.
 // Expensive. Usually used only in tests
 func (sd *TrustedSetup) commitAll(vect []kyber.Scalar) (kyber.Point, []kyber.Point) {
 	retC := sd.commit(vect)
 	retPi := make([]kyber.Point, sd.D)
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < sd.maxGoroutines(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				retPi[i] = sd.proveParallel(vect, i, 1)
+			}
+		}()
+	}
 	for i := range vect {
-		if vect[i] == nil {
-			continue
+		if vect[i] != nil {
+			indices <- i
 		}
-		retPi[i] = sd.prove(vect, i)
 	}
+	close(indices)
+	wg.Wait()
 	return retC, retPi
 }
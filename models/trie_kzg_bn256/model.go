@@ -3,6 +3,7 @@ package trie_kzg_bn256
 import (
 	"bytes"
 	"io"
+	"sync/atomic"
 
 	"github.com/lunfardo314/unitrie/common"
 	"go.dedis.ch/kyber/v3"
@@ -94,22 +95,72 @@ func (t *terminalCommitment) ExtractValue() ([]byte, bool) {
 	return nil, false
 }
 
+// vectorLength is the length of the node vector: 256 children, terminal and path
+const vectorLength = 258
+
 // CommitmentModel implements 256+ trie based on blake2b hashing
 type CommitmentModel struct {
-	TrustedSetup
+	setup atomic.Value // *TrustedSetup
+	v2    bool
 }
 
 // Model is a singleton
 var Model = New()
 
+// ModelV2 is a singleton of the corrected model
+var ModelV2 = NewV2()
+
+const (
+	// ModelID is the ID of the model in the common model registry
+	ModelID = common.ModelID(0x20)
+	// ModelIDV2 is the ID of the corrected model in the common model registry
+	ModelIDV2 = common.ModelID(0x21)
+)
+
+func init() {
+	common.MustRegisterModel(ModelID, Model)
+	common.MustRegisterModel(ModelIDV2, ModelV2)
+}
+
+// New creates the original KZG model. Its incremental update of the node commitment does not take into account
+// the change of the node path and path fragment when nodes are split or merged, so the root may depend on
+// the order of updates and commits. The model is kept for compatibility with the existing tries. Use NewV2 for new ones
 func New() *CommitmentModel {
-	ret, err := TrustedSetupFromBytes(bn256.NewSuite(), GetTrustedSetupBin())
+	ts, err := TrustedSetupFromBytes(bn256.NewSuite(), GetTrustedSetupBin())
 	if err != nil {
 		panic(err)
 	}
-	return &CommitmentModel{
-		TrustedSetup: *ret,
+	ret := &CommitmentModel{}
+	ret.setup.Store(ts)
+	return ret
+}
+
+// NewV2 creates KZG model with corrected incremental update of the node commitment. Commitments are calculated with
+// the same algebra as in the original model, so the root does not depend on the order of updates and commits
+func NewV2() *CommitmentModel {
+	ret := New()
+	ret.v2 = true
+	return ret
+}
+
+// TrustedSetup returns the trusted setup currently used by the model
+func (m *CommitmentModel) TrustedSetup() *TrustedSetup {
+	return m.setup.Load().(*TrustedSetup)
+}
+
+// SwapTrustedSetup verifies the trusted setup and atomically replaces the current one with it.
+// Returns the previous trusted setup. It is safe to call while the model is used by readers and writers:
+// each commitment and proof is calculated with one trusted setup, either the old or the new one.
+// Note, that commitments calculated with different trusted setups are not compatible: tries committed with the
+// previous trusted setup must be re-committed to be used with the new one
+func (m *CommitmentModel) SwapTrustedSetup(ts *TrustedSetup) (*TrustedSetup, error) {
+	if ts == nil || ts.D != vectorLength {
+		return nil, errWrongVectorLength
+	}
+	if err := ts.Verify(); err != nil {
+		return nil, err
 	}
+	return m.setup.Swap(ts).(*TrustedSetup), nil
 }
 
 func (m *CommitmentModel) PathArity() common.PathArity {
@@ -129,10 +180,16 @@ func equalCommitments(c1, c2 common.Serializable) bool {
 }
 
 func (m *CommitmentModel) Description() string {
+	if m.v2 {
+		return "trie commitment common implementation based on KZG (Kate) polynomial commitments and bn256 curve frm Dedis.Kyber library, v2 with corrected commitment update. 256-ary keys"
+	}
 	return "trie commitment common implementation based on KZG (Kate) polynomial commitments and bn256 curve frm Dedis.Kyber library. 256-ary keys"
 }
 
 func (m *CommitmentModel) ShortName() string {
+	if m.v2 {
+		return "kzg-bn256-v2"
+	}
 	return "kzg-bn256"
 }
 
@@ -154,7 +211,7 @@ func (m *CommitmentModel) ExtractDataFromTCommitment(c common.TCommitment) ([]by
 
 func (m *CommitmentModel) newVectorCommitment(p ...kyber.Point) *vectorCommitment {
 	if len(p) == 0 {
-		return &vectorCommitment{Point: m.Suite.G1().Point()}
+		return &vectorCommitment{Point: m.TrustedSetup().Suite.G1().Point()}
 	}
 	return &vectorCommitment{Point: p[0]}
 }
@@ -164,11 +221,11 @@ func (m *CommitmentModel) NewTerminalCommitment() common.TCommitment {
 }
 
 func (m *CommitmentModel) newTerminalCommitment() *terminalCommitment {
-	return &terminalCommitment{Scalar: m.Suite.G1().Scalar()}
+	return &terminalCommitment{Scalar: m.TrustedSetup().Suite.G1().Scalar()}
 }
 
 func (m *CommitmentModel) CommitToData(data []byte) common.TCommitment {
-	return commitToData(data, m.Suite)
+	return commitToData(data, m.TrustedSetup().Suite)
 }
 
 func (m *CommitmentModel) UpdateVCommitment(c *common.VCommitment, delta common.VCommitment) {
@@ -181,7 +238,12 @@ func (m *CommitmentModel) UpdateVCommitment(c *common.VCommitment, delta common.
 
 // UpdateNodeCommitment updates mutated part of node's data and, optionaly, upper
 func (m *CommitmentModel) UpdateNodeCommitment(mutate *common.NodeData, childUpdates map[byte]common.VCommitment, terminal common.TCommitment, pathFragment, nodePath []byte, calcDelta bool) {
+	if m.v2 {
+		m.updateNodeCommitmentV2(mutate, childUpdates, terminal, pathFragment, nodePath, calcDelta)
+		return
+	}
 	var deltas map[int]kyber.Scalar
+	ts := m.TrustedSetup()
 
 	if calcDelta {
 		deltas = make(map[int]kyber.Scalar)
@@ -194,17 +256,17 @@ func (m *CommitmentModel) UpdateNodeCommitment(mutate *common.NodeData, childUpd
 				// child didn't exist, no need to delete it
 				continue
 			}
-			delta := m.TrustedSetup.Suite.G1().Scalar().Zero()
+			delta := ts.Suite.G1().Scalar().Zero()
 			if childUpd == nil {
 				// deleting child
 				common.Assertf(prevC != nil, "prevC != nil")
 				common.Assertf(existsPrevC, "par.ChildCommitments[i] != nil")
-				delta = scalarFromPoint(m.TrustedSetup.Suite.G1().Scalar(), prevC.(*vectorCommitment).Point)
+				delta = scalarFromPoint(ts.Suite.G1().Scalar(), prevC.(*vectorCommitment).Point)
 				delta.Neg(delta)
 			} else {
-				delta = scalarFromPoint(m.TrustedSetup.Suite.G1().Scalar(), childUpd.(*vectorCommitment).Point)
+				delta = scalarFromPoint(ts.Suite.G1().Scalar(), childUpd.(*vectorCommitment).Point)
 				if prevC != nil {
-					prevS := scalarFromPoint(m.TrustedSetup.Suite.G1().Scalar(), prevC.(*vectorCommitment).Point)
+					prevS := scalarFromPoint(ts.Suite.G1().Scalar(), prevC.(*vectorCommitment).Point)
 					delta.Sub(delta, prevS)
 				}
 			}
@@ -218,7 +280,7 @@ func (m *CommitmentModel) UpdateNodeCommitment(mutate *common.NodeData, childUpd
 		}
 	}
 	if calcDelta && !equalCommitments(mutate.Terminal, terminal) {
-		delta := m.TrustedSetup.Suite.G1().Scalar().Zero()
+		delta := ts.Suite.G1().Scalar().Zero()
 		if terminal == nil {
 			if mutate.Terminal != nil {
 				delta = mutate.Terminal.(*terminalCommitment).Scalar
@@ -241,11 +303,11 @@ func (m *CommitmentModel) UpdateNodeCommitment(mutate *common.NodeData, childUpd
 		if !common.IsNil(mutate.Commitment) {
 			prevP = mutate.Commitment.(*vectorCommitment).Point.Clone()
 		} else {
-			prevP = m.TrustedSetup.Suite.G1().Point().Null()
+			prevP = ts.Suite.G1().Point().Null()
 		}
-		elem := m.TrustedSetup.Suite.G1().Point()
+		elem := ts.Suite.G1().Point()
 		for i, deltaS := range deltas {
-			elem.Mul(deltaS, m.TrustedSetup.LagrangeBasis[i])
+			elem.Mul(deltaS, ts.LagrangeBasis[i])
 			prevP.Add(prevP, elem)
 		}
 		mutate.Commitment = m.newVectorCommitment(prevP)
@@ -259,19 +321,21 @@ func (m *CommitmentModel) CalcNodeCommitment(data *common.NodeData, nodePath []b
 }
 
 func (m *CommitmentModel) calcNodeCommitment(data *common.NodeData, nodePath []byte) *vectorCommitment {
-	var vect [258]kyber.Scalar
-	makeVector(data, nodePath, &m.TrustedSetup, &vect)
-	return &vectorCommitment{Point: m.TrustedSetup.commit(vect[:])}
+	var vect [vectorLength]kyber.Scalar
+	ts := m.TrustedSetup()
+	makeVector(data, nodePath, ts, &vect)
+	return &vectorCommitment{Point: ts.commit(vect[:])}
 }
 
 func (m *CommitmentModel) calcProof(data *common.NodeData, nodePath []byte, index int) kyber.Point {
-	var vect [258]kyber.Scalar
-	makeVector(data, nodePath, &m.TrustedSetup, &vect)
-	return m.TrustedSetup.prove(vect[:], index)
+	var vect [vectorLength]kyber.Scalar
+	ts := m.TrustedSetup()
+	makeVector(data, nodePath, ts, &vect)
+	return ts.prove(vect[:], index)
 }
 
 // Vector extracts vector from the node
-func makeVector(n *common.NodeData, nodePath []byte, ts *TrustedSetup, ret *[258]kyber.Scalar) {
+func makeVector(n *common.NodeData, nodePath []byte, ts *TrustedSetup, ret *[vectorLength]kyber.Scalar) {
 	for i, p := range n.ChildCommitments {
 		if p == nil {
 			continue
@@ -0,0 +1,62 @@
+package trie_kzg_bn256
+
+import (
+	"bytes"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// updateNodeCommitmentV2 is the corrected incremental update of the node commitment.
+// The last element of the vector commits to the node path and path fragment. The node path of the node changes
+// only together with the path fragment, when nodes are split or merged, so in this case the commitment is
+// calculated from scratch. Otherwise, deltas of children and terminal are added to the previous commitment.
+// Commitments of the previous state are never modified in place
+func (m *CommitmentModel) updateNodeCommitmentV2(mutate *common.NodeData, childUpdates map[byte]common.VCommitment, terminal common.TCommitment, pathFragment, nodePath []byte, calcDelta bool) {
+	if calcDelta && !bytes.Equal(mutate.PathFragment, pathFragment) {
+		calcDelta = false
+	}
+	if !calcDelta {
+		for i, childUpd := range childUpdates {
+			if common.IsNil(childUpd) {
+				delete(mutate.ChildCommitments, i)
+			} else {
+				mutate.ChildCommitments[i] = childUpd
+			}
+		}
+		mutate.Terminal = terminal
+		mutate.PathFragment = pathFragment
+		mutate.Commitment = m.CalcNodeCommitment(mutate, nodePath)
+		return
+	}
+	ts := m.TrustedSetup()
+	ret := mutate.Commitment.(*vectorCommitment).Point.Clone()
+	delta := ts.Suite.G1().Scalar()
+	s := ts.Suite.G1().Scalar()
+	elem := ts.Suite.G1().Point()
+
+	for i, childUpd := range childUpdates {
+		delta.Zero()
+		if prevC, exists := mutate.ChildCommitments[i]; exists && !common.IsNil(prevC) {
+			delta.Sub(delta, scalarFromPoint(s, prevC.(*vectorCommitment).Point))
+		}
+		if common.IsNil(childUpd) {
+			delete(mutate.ChildCommitments, i)
+		} else {
+			delta.Add(delta, scalarFromPoint(s, childUpd.(*vectorCommitment).Point))
+			mutate.ChildCommitments[i] = childUpd
+		}
+		ret.Add(ret, elem.Mul(delta, ts.LagrangeBasis[i]))
+	}
+	if !equalCommitments(mutate.Terminal, terminal) {
+		delta.Zero()
+		if !common.IsNil(mutate.Terminal) {
+			delta.Sub(delta, mutate.Terminal.(*terminalCommitment).Scalar)
+		}
+		if !common.IsNil(terminal) {
+			delta.Add(delta, terminal.(*terminalCommitment).Scalar)
+		}
+		ret.Add(ret, elem.Mul(delta, ts.LagrangeBasis[256]))
+	}
+	mutate.Terminal = terminal
+	mutate.Commitment = m.newVectorCommitment(ret)
+}
@@ -0,0 +1,316 @@
+package trie_kzg_bn256
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"os"
+
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"golang.org/x/xerrors"
+)
+
+// Import of the trusted setup from the powers of tau ceremony.
+// The ceremony produces [tau^i]1 and [tau^i]2 without anybody knowing the secret tau. The Lagrange basis
+// of the natural domain 0, 1, ..., D-1 and [tau-i]2 are linear combinations of the powers, so the TrustedSetup
+// can be derived from the ceremony output without the secret.
+//
+// The ceremony file is read in the snarkjs .ptau format, which is also the format the perpetual powers
+// of tau ceremony is distributed in. The format is not bound to the curve: the prime of the base field is in
+// the header. Note that the bn128 ceremonies (Ethereum alt_bn128) are on the different curve than the
+// bn256 curve of kyber, used by this package. Such files are rejected with the curve mismatch error
+
+var (
+	errPtauFormat        = xerrors.New("wrong .ptau file format")
+	errPtauCurveMismatch = xerrors.New(".ptau file is for another curve than kyber bn256")
+	errPtauTooFewPowers  = xerrors.New("not enough powers of tau in the ceremony for the degree of the trusted setup")
+	errPtauGenerator     = xerrors.New("generator in the ceremony does not match the generator of kyber bn256")
+)
+
+// fieldPrime is the prime of the base field of kyber bn256 curve: 36u⁴+36u³+24u²+6u+1. It is not exported by kyber
+var fieldPrime, _ = new(big.Int).SetString("65000549695646603732796438742359905742825358107623003571877145026864184071783", 10)
+
+const (
+	ptauSectionHeader = 1
+	ptauSectionTauG1  = 2
+	ptauSectionTauG2  = 3
+)
+
+// TrustedSetupFromPowersOfTau derives trusted setup of degree d from powers of the secret:
+// tauG1[i] = [tau^i]1 for i = 0..d-1 and tauG2 = [tau]2. The tauG1[0] must be the generator of G1.
+// If omega is provided, the domain is powers of omega, otherwise it is natural domain 0, 1, ..., d-1
+func TrustedSetupFromPowersOfTau(suite *bn256.Suite, d uint16, tauG1 []kyber.Point, tauG2 kyber.Point, omega ...kyber.Scalar) (*TrustedSetup, error) {
+	if len(tauG1) < int(d) {
+		return nil, errPtauTooFewPowers
+	}
+	if !tauG1[0].Equal(suite.G1().Point().Base()) {
+		return nil, errPtauGenerator
+	}
+	ret := newTrustedSetup(suite)
+	ret.init(d)
+	if len(omega) > 0 && !omega[0].Equal(ret.ZeroG1) {
+		ret.Omega.Set(omega[0])
+		for i := range ret.Domain {
+			powerSimple(suite, ret.Omega, i, ret.Domain[i])
+			if i > 0 && ret.Domain[i].Equal(ret.OneG1) {
+				return nil, errWrongROU
+			}
+		}
+	} else {
+		ret.Omega.Zero()
+		for i := range ret.Domain {
+			ret.Domain[i].SetInt64(int64(i))
+		}
+	}
+	for i := range ret.AprimeDomainI {
+		ret.aprime(i, ret.AprimeDomainI[i])
+	}
+	// coefficients of A(X) = prod<j=0,D-1>(X-domain<j>), from the lowest degree
+	a := make([]kyber.Scalar, int(d)+1)
+	a[0] = suite.G1().Scalar().One()
+	for i := 1; i < len(a); i++ {
+		a[i] = suite.G1().Scalar().Zero()
+	}
+	t := suite.G1().Scalar()
+	for j := 0; j < int(d); j++ {
+		for k := j + 1; k > 0; k-- {
+			t.Mul(a[k], ret.Domain[j])
+			a[k].Sub(a[k-1], t)
+		}
+		a[0].Mul(a[0], ret.Domain[j])
+		a[0].Neg(a[0])
+	}
+	// l_i(X) = A(X)/(X-domain<i>)/A'(domain<i>). Coefficients of A(X)/(X-domain<i>) are found by the synthetic division
+	q := make([]kyber.Scalar, d)
+	for i := range q {
+		q[i] = suite.G1().Scalar()
+	}
+	inv := suite.G1().Scalar()
+	elem := suite.G1().Point()
+	for i := range ret.LagrangeBasis {
+		q[d-1].Set(a[d])
+		for k := int(d) - 1; k > 0; k-- {
+			t.Mul(q[k], ret.Domain[i])
+			q[k-1].Add(a[k], t)
+		}
+		inv.Inv(ret.AprimeDomainI[i])
+		ret.LagrangeBasis[i].Null()
+		for k := range q {
+			t.Mul(q[k], inv)
+			elem.Mul(t, tauG1[k])
+			ret.LagrangeBasis[i].Add(ret.LagrangeBasis[i], elem)
+		}
+	}
+	// [tau-domain<i>]2 = [tau]2 - domain<i>*[1]2
+	for i := range ret.Diff2 {
+		ret.Diff2[i].Mul(ret.Domain[i], nil)
+		ret.Diff2[i].Sub(tauG2, ret.Diff2[i])
+	}
+	if ret.Omega.Equal(ret.ZeroG1) {
+		ret.precalculate()
+	}
+	if err := ret.Verify(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// TrustedSetupFromPtau derives trusted setup of degree d from the powers of tau ceremony file in the snarkjs .ptau format
+func TrustedSetupFromPtau(suite *bn256.Suite, r io.ReadSeeker, d uint16) (*TrustedSetup, error) {
+	sections, err := readPtauSections(r)
+	if err != nil {
+		return nil, err
+	}
+	hdr, ok := sections[ptauSectionHeader]
+	if !ok {
+		return nil, errPtauFormat
+	}
+	if _, err = r.Seek(hdr.pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var n8 uint32
+	if err = binary.Read(r, binary.LittleEndian, &n8); err != nil {
+		return nil, err
+	}
+	if n8 != 32 {
+		return nil, errPtauCurveMismatch
+	}
+	var prime [32]byte
+	if _, err = io.ReadFull(r, prime[:]); err != nil {
+		return nil, err
+	}
+	if leToBig(prime[:]).Cmp(fieldPrime) != 0 {
+		return nil, errPtauCurveMismatch
+	}
+	var power uint32
+	if err = binary.Read(r, binary.LittleEndian, &power); err != nil {
+		return nil, err
+	}
+	if power > 30 || (uint64(1)<<power)*2-1 < uint64(d) {
+		return nil, errPtauTooFewPowers
+	}
+	dec := newPtauDecoder()
+
+	g1, ok := sections[ptauSectionTauG1]
+	if !ok {
+		return nil, errPtauFormat
+	}
+	if _, err = r.Seek(g1.pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	tauG1 := make([]kyber.Point, d)
+	buf := make([]byte, 128)
+	for i := range tauG1 {
+		if _, err = io.ReadFull(r, buf[:64]); err != nil {
+			return nil, err
+		}
+		if tauG1[i], err = dec.g1(suite, buf[:64]); err != nil {
+			return nil, err
+		}
+	}
+	g2, ok := sections[ptauSectionTauG2]
+	if !ok {
+		return nil, errPtauFormat
+	}
+	if _, err = r.Seek(g2.pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	// [1]2 and [tau]2
+	var tauG2 [2]kyber.Point
+	for i := range tauG2 {
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if tauG2[i], err = dec.g2(suite, buf); err != nil {
+			return nil, err
+		}
+	}
+	if !tauG2[0].Equal(suite.G2().Point().Base()) {
+		return nil, errPtauGenerator
+	}
+	return TrustedSetupFromPowersOfTau(suite, d, tauG1, tauG2[1])
+}
+
+// TrustedSetupFromPtauFile derives trusted setup of degree d from the .ptau file
+func TrustedSetupFromPtauFile(suite *bn256.Suite, fname string, d uint16) (*TrustedSetup, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return TrustedSetupFromPtau(suite, f, d)
+}
+
+type ptauSection struct {
+	pos  int64
+	size uint64
+}
+
+// readPtauSections reads the section table of the .ptau file: "ptau", version, number of sections,
+// then each section is type (uint32), size (uint64) and data. All integers are little-endian
+func readPtauSections(r io.ReadSeeker) (map[uint32]ptauSection, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic[:], []byte("ptau")) {
+		return nil, errPtauFormat
+	}
+	var version, numSections uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, &numSections); err != nil {
+		return nil, err
+	}
+	ret := make(map[uint32]ptauSection)
+	pos := int64(12)
+	for i := uint32(0); i < numSections; i++ {
+		var sectionType uint32
+		var s ptauSection
+		if err := binary.Read(r, binary.LittleEndian, &sectionType); err != nil {
+			return nil, err
+		}
+		if err := binary.Read(r, binary.LittleEndian, &s.size); err != nil {
+			return nil, err
+		}
+		s.pos = pos + 12
+		if _, dup := ret[sectionType]; dup {
+			return nil, errPtauFormat
+		}
+		ret[sectionType] = s
+		pos = s.pos + int64(s.size)
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// ptauDecoder converts field elements of the .ptau file (little-endian, in Montgomery form) into the big-endian
+// normal form used by kyber marshaling
+type ptauDecoder struct {
+	rInv *big.Int
+	t    *big.Int
+}
+
+func newPtauDecoder() *ptauDecoder {
+	r := new(big.Int).Lsh(big1, 256)
+	r.Mod(r, fieldPrime)
+	return &ptauDecoder{
+		rInv: r.ModInverse(r, fieldPrime),
+		t:    new(big.Int),
+	}
+}
+
+// element decodes the field element from src into 32 bytes of dst
+func (dec *ptauDecoder) element(dst, src []byte) error {
+	dec.t.Set(leToBig(src[:32]))
+	if dec.t.Cmp(fieldPrime) >= 0 {
+		return errPtauFormat
+	}
+	dec.t.Mul(dec.t, dec.rInv)
+	dec.t.Mod(dec.t, fieldPrime)
+	dec.t.FillBytes(dst[:32])
+	return nil
+}
+
+// g1 decodes x, y
+func (dec *ptauDecoder) g1(suite *bn256.Suite, src []byte) (kyber.Point, error) {
+	var buf [64]byte
+	for i := 0; i < 2; i++ {
+		if err := dec.element(buf[i*32:], src[i*32:]); err != nil {
+			return nil, err
+		}
+	}
+	ret := suite.G1().Point()
+	if err := ret.UnmarshalBinary(buf[:]); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// g2 decodes x.c0, x.c1, y.c0, y.c1. Kyber marshals the imaginary part first
+func (dec *ptauDecoder) g2(suite *bn256.Suite, src []byte) (kyber.Point, error) {
+	var buf [128]byte
+	for i, pos := range []int{1, 0, 3, 2} {
+		if err := dec.element(buf[pos*32:], src[i*32:]); err != nil {
+			return nil, err
+		}
+	}
+	ret := suite.G2().Point()
+	if err := ret.UnmarshalBinary(buf[:]); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func leToBig(data []byte) *big.Int {
+	be := make([]byte, len(data))
+	for i := range data {
+		be[len(data)-1-i] = data[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
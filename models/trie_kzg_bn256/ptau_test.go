@@ -0,0 +1,98 @@
+package trie_kzg_bn256
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"golang.org/x/crypto/blake2b"
+)
+
+// ptau elements are little-endian in Montgomery form
+func ptauElement(buf *bytes.Buffer, be []byte) {
+	r := new(big.Int).Lsh(big1, 256)
+	t := new(big.Int).SetBytes(be)
+	t.Mul(t, r)
+	t.Mod(t, fieldPrime)
+	var le [32]byte
+	t.FillBytes(le[:])
+	for i, j := 0, 31; i < j; i, j = i+1, j-1 {
+		le[i], le[j] = le[j], le[i]
+	}
+	buf.Write(le[:])
+}
+
+func ptauSectionBytes(buf *bytes.Buffer, sectionType uint32, data []byte) {
+	_ = binary.Write(buf, binary.LittleEndian, sectionType)
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(data)))
+	buf.Write(data)
+}
+
+// makePtau creates the .ptau file of the ceremony with the secret, as snarkjs would do it on the kyber bn256 curve
+func makePtau(t *testing.T, suite *bn256.Suite, secret kyber.Scalar, power uint32, prime *big.Int) []byte {
+	var hdr bytes.Buffer
+	_ = binary.Write(&hdr, binary.LittleEndian, uint32(32))
+	var primeLE [32]byte
+	prime.FillBytes(primeLE[:])
+	for i, j := 0, 31; i < j; i, j = i+1, j-1 {
+		primeLE[i], primeLE[j] = primeLE[j], primeLE[i]
+	}
+	hdr.Write(primeLE[:])
+	_ = binary.Write(&hdr, binary.LittleEndian, power)
+	_ = binary.Write(&hdr, binary.LittleEndian, power)
+
+	var g1, g2 bytes.Buffer
+	s := suite.G1().Scalar().One()
+	n := 1 << power
+	for i := 0; i < 2*n-1; i++ {
+		p, err := suite.G1().Point().Mul(s, nil).MarshalBinary()
+		require.NoError(t, err)
+		ptauElement(&g1, p[:32])
+		ptauElement(&g1, p[32:])
+		if i < n {
+			p, err = suite.G2().Point().Mul(s, nil).MarshalBinary()
+			require.NoError(t, err)
+			for _, pos := range []int{1, 0, 3, 2} {
+				ptauElement(&g2, p[pos*32:(pos+1)*32])
+			}
+		}
+		s.Mul(s, secret)
+	}
+	var ret bytes.Buffer
+	ret.WriteString("ptau")
+	_ = binary.Write(&ret, binary.LittleEndian, uint32(1))
+	_ = binary.Write(&ret, binary.LittleEndian, uint32(3))
+	ptauSectionBytes(&ret, ptauSectionHeader, hdr.Bytes())
+	ptauSectionBytes(&ret, ptauSectionTauG1, g1.Bytes())
+	ptauSectionBytes(&ret, ptauSectionTauG2, g2.Bytes())
+	return ret.Bytes()
+}
+
+func TestTrustedSetupFromPtau(t *testing.T) {
+	const d = 17
+	suite := bn256.NewSuite()
+	h := blake2b.Sum256([]byte("ceremony"))
+	secret := suite.G1().Scalar().SetBytes(h[:])
+	expected, err := TrustedSetupFromSecretNaturalDomain(suite, d, secret)
+	require.NoError(t, err)
+
+	ptau := makePtau(t, suite, secret, 4, fieldPrime)
+	ts, err := TrustedSetupFromPtau(suite, bytes.NewReader(ptau), d)
+	require.NoError(t, err)
+	require.EqualValues(t, expected.Bytes(), ts.Bytes())
+
+	_, err = TrustedSetupFromPtau(suite, bytes.NewReader(ptau), 32)
+	require.ErrorIs(t, err, errPtauTooFewPowers)
+
+	// the prime of alt_bn128, the curve of the Ethereum ceremonies
+	bn128Prime, _ := new(big.Int).SetString("30644e72e131a029b85045b68181585d97816a916871ca8d3c208c16d87cfd47", 16)
+	_, err = TrustedSetupFromPtau(suite, bytes.NewReader(makePtau(t, suite, secret, 2, bn128Prime)), d)
+	require.ErrorIs(t, err, errPtauCurveMismatch)
+
+	_, err = TrustedSetupFromPtau(suite, bytes.NewReader([]byte("not a ptau file")), d)
+	require.ErrorIs(t, err, errPtauFormat)
+}
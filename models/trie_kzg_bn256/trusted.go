@@ -5,10 +5,12 @@ import (
 	"encoding/binary"
 	"io"
 	"io/ioutil"
+	"sync"
 
 	"github.com/lunfardo314/unitrie/common"
 	"go.dedis.ch/kyber/v3"
 	"go.dedis.ch/kyber/v3/pairing/bn256"
+	"go.dedis.ch/kyber/v3/util/random"
 	"golang.org/x/crypto/blake2b"
 	"golang.org/x/xerrors"
 )
@@ -33,6 +35,9 @@ type TrustedSetup struct {
 	precalc       *precalculated // only not nil if omega == nil (onl for natural domain)
 	ZeroG1        kyber.Scalar   // aux
 	OneG1         kyber.Scalar   // aux
+	parallelism   int            // maximum number of goroutines. 0 means GOMAXPROCS
+	digestOnce    sync.Once
+	digest        SetupDigest
 }
 
 // used if omega == 0, i.e. for the natural domain
@@ -47,6 +52,9 @@ var (
 	errWrongSecret = xerrors.New("wrong secret")
 	errNotROU      = xerrors.New("not a root of unity")
 	errWrongROU    = xerrors.New("wrong root of unity")
+
+	errWrongVectorLength = xerrors.New("degree of the trusted setup does not match the vector length of the model")
+	errWrongSetup        = xerrors.New("inconsistent trusted setup")
 )
 
 func newTrustedSetup(suite *bn256.Suite) *TrustedSetup {
@@ -96,6 +104,18 @@ func TrustedSetupFromSecretNaturalDomain(suite *bn256.Suite, d uint16, secret ky
 	return ret, nil
 }
 
+// GenerateTrustedSetup generates trusted setup of degree d from the random secret. The secret is destroyed after
+// generation. If natural == true, domain is 0, 1, ..., d-1, otherwise it is powers of the random root of unity
+func GenerateTrustedSetup(suite *bn256.Suite, d uint16, natural bool) (*TrustedSetup, error) {
+	secret := suite.G1().Scalar().Pick(random.New())
+	defer secret.Zero()
+	if natural {
+		return TrustedSetupFromSecretNaturalDomain(suite, d, secret)
+	}
+	omega, _ := GenRootOfUnityQuasiPrimitive(suite, d)
+	return TrustedSetupFromSecretPowers(suite, d, omega, secret)
+}
+
 // TrustedSetupFromSeed for testing only
 func TrustedSetupFromSeed(suite *bn256.Suite, d uint16, seed []byte) (*TrustedSetup, error) {
 	h := blake2b.Sum256(seed)
@@ -149,6 +169,26 @@ func TrustedSetupFromFile(suite *bn256.Suite, fname string) (*TrustedSetup, erro
 	return ret, nil
 }
 
+// Verify checks consistency of the trusted setup: it commits to the test vector and verifies proofs
+// of some of its elements. Returns error if Lagrange basis is inconsistent with the G2 part of the setup
+func (sd *TrustedSetup) Verify() error {
+	if sd.Suite == nil || sd.D < 2 || len(sd.LagrangeBasis) != int(sd.D) || len(sd.Diff2) != int(sd.D) ||
+		len(sd.Domain) != int(sd.D) || len(sd.AprimeDomainI) != int(sd.D) {
+		return errWrongSetup
+	}
+	vect := make([]kyber.Scalar, sd.D)
+	for i := range vect {
+		vect[i] = sd.Suite.G1().Scalar().SetInt64(int64(i + 1))
+	}
+	c := sd.commit(vect)
+	for _, i := range []int{0, int(sd.D) / 2, int(sd.D) - 1} {
+		if !sd.verify(c, sd.prove(vect, i), vect[i], i) {
+			return errWrongSetup
+		}
+	}
+	return nil
+}
+
 // Bytes marshals the trusted setup
 func (sd *TrustedSetup) Bytes() []byte {
 	var buf bytes.Buffer
@@ -275,7 +315,7 @@ func (sd *TrustedSetup) write(w io.Writer) error {
 // read unmarshal
 func (sd *TrustedSetup) read(r io.Reader) error {
 	var tmp2 [2]byte
-	if _, err := r.Read(tmp2[:]); err != nil {
+	if _, err := io.ReadFull(r, tmp2[:]); err != nil {
 		return err
 	}
 
@@ -284,7 +324,8 @@ func (sd *TrustedSetup) read(r io.Reader) error {
 	if _, err := sd.Omega.UnmarshalFrom(r); err != nil {
 		return err
 	}
-	if !isRootOfUnity(sd.Suite, sd.Omega) {
+	// zero omega means natural domain
+	if !sd.Omega.Equal(sd.ZeroG1) && !isRootOfUnity(sd.Suite, sd.Omega) {
 		return errNotROU
 	}
 	for i := range sd.LagrangeBasis {
@@ -2,6 +2,7 @@ package trie_kzg_bn256
 
 import (
 	"encoding/hex"
+	"fmt"
 	"math/big"
 	"math/rand"
 	"runtime"
@@ -227,3 +228,178 @@ func TestValidate2Load(t *testing.T) {
 		}
 	}
 }
+
+func TestSwapTrustedSetup(t *testing.T) {
+	m := New()
+	suite := bn256.NewSuite()
+	vect := make([]kyber.Scalar, D)
+	vect[0] = suite.G1().Scalar().SetInt64(42)
+
+	orig := m.TrustedSetup()
+	require.NoError(t, orig.Verify())
+	cOrig := orig.commit(vect)
+
+	_, err := m.SwapTrustedSetup(nil)
+	require.Error(t, err)
+	small, err := TrustedSetupFromSeed(suite, 16, []byte("seed"))
+	require.NoError(t, err)
+	_, err = m.SwapTrustedSetup(small)
+	require.Error(t, err)
+
+	ts, err := TrustedSetupFromSeed(suite, D, []byte("seed"))
+	require.NoError(t, err)
+	tampered, err := TrustedSetupFromSeed(suite, D, []byte("seed"))
+	require.NoError(t, err)
+	tampered.LagrangeBasis[0].Add(tampered.LagrangeBasis[0], suite.G1().Point().Base())
+	_, err = m.SwapTrustedSetup(tampered)
+	require.Error(t, err)
+	require.True(t, m.TrustedSetup() == orig)
+
+	prev, err := m.SwapTrustedSetup(ts)
+	require.NoError(t, err)
+	require.True(t, prev == orig)
+	require.True(t, m.TrustedSetup() == ts)
+	require.False(t, cOrig.Equal(m.TrustedSetup().commit(vect)))
+
+	prev, err = m.SwapTrustedSetup(orig)
+	require.NoError(t, err)
+	require.True(t, prev == ts)
+	require.True(t, cOrig.Equal(m.TrustedSetup().commit(vect)))
+}
+
+func TestVerifyBatch(t *testing.T) {
+	const d = 33
+	suite := bn256.NewSuite()
+	rou, _ := GenRootOfUnityQuasiPrimitive(suite, d)
+	secret := suite.G1().Scalar().Pick(random.New())
+	trPowers, err := TrustedSetupFromSecretPowers(suite, d, rou, secret)
+	require.NoError(t, err)
+	trNatural, err := TrustedSetupFromSeed(suite, d, []byte("seed"))
+	require.NoError(t, err)
+
+	for _, tr := range []*TrustedSetup{trPowers, trNatural} {
+		var tuples []ProofTuple
+		for v := 0; v < 3; v++ {
+			vect := make([]kyber.Scalar, d)
+			for i := range vect {
+				if i%5 != 0 {
+					vect[i] = tr.Suite.G1().Scalar().SetInt64(int64(v*100 + i))
+				}
+			}
+			c := tr.commit(vect)
+			for i := 0; i < d; i += 3 {
+				tuples = append(tuples, ProofTuple{
+					Commitment: c,
+					Proof:      tr.prove(vect, i),
+					Value:      vect[i],
+					Index:      i,
+				})
+			}
+		}
+		require.True(t, tr.VerifyBatch(tuples))
+		require.True(t, tr.VerifyBatch(nil))
+
+		wrongValue := make([]ProofTuple, len(tuples))
+		copy(wrongValue, tuples)
+		wrongValue[4].Value = tr.Suite.G1().Scalar().SetInt64(12345)
+		require.False(t, tr.VerifyBatch(wrongValue))
+
+		wrongProof := make([]ProofTuple, len(tuples))
+		copy(wrongProof, tuples)
+		wrongProof[1].Proof, wrongProof[2].Proof = wrongProof[2].Proof, wrongProof[1].Proof
+		require.False(t, tr.VerifyBatch(wrongProof))
+
+		wrongIndex := make([]ProofTuple, len(tuples))
+		copy(wrongIndex, tuples)
+		wrongIndex[0].Index = d
+		require.False(t, tr.VerifyBatch(wrongIndex))
+	}
+}
+
+func TestUpdateTrustedSetup(t *testing.T) {
+	const d = 17
+	suite := bn256.NewSuite()
+	h1 := blake2b.Sum256([]byte("first participant"))
+	s1 := suite.G1().Scalar().SetBytes(h1[:])
+	h2 := blake2b.Sum256([]byte("second participant"))
+	s2 := suite.G1().Scalar().SetBytes(h2[:])
+	s12 := suite.G1().Scalar().Mul(s1, s2)
+
+	rou, _ := GenRootOfUnityQuasiPrimitive(suite, d)
+	trPowers, err := TrustedSetupFromSecretPowers(suite, d, rou, s1)
+	require.NoError(t, err)
+	trNatural, err := TrustedSetupFromSecretNaturalDomain(suite, d, s1)
+	require.NoError(t, err)
+
+	for _, tr := range []*TrustedSetup{trPowers, trNatural} {
+		var expected *TrustedSetup
+		if tr.Omega.Equal(tr.ZeroG1) {
+			expected, err = TrustedSetupFromSecretNaturalDomain(suite, d, s12)
+		} else {
+			expected, err = TrustedSetupFromSecretPowers(suite, d, rou, s12)
+		}
+		require.NoError(t, err)
+
+		tauG1, tauG2 := tr.PowersOfTau()
+		require.True(t, tauG1[1].Equal(suite.G1().Point().Mul(s1, nil)))
+		require.True(t, tauG2.Equal(suite.G2().Point().Mul(s1, nil)))
+
+		updated, err := UpdateTrustedSetup(tr, s2)
+		require.NoError(t, err)
+		require.EqualValues(t, expected.Bytes(), updated.Bytes())
+
+		back, err := TrustedSetupFromBytes(suite, updated.Bytes())
+		require.NoError(t, err)
+		require.NoError(t, back.Verify())
+	}
+}
+
+func TestParallelism(t *testing.T) {
+	suite := bn256.NewSuite()
+	tr, err := TrustedSetupFromSeed(suite, 65, []byte("seed"))
+	require.NoError(t, err)
+	vect := make([]kyber.Scalar, tr.D)
+	for i := range vect {
+		if i%7 != 0 {
+			vect[i] = tr.Suite.G1().Scalar().SetInt64(int64(i))
+		}
+	}
+	tr.SetParallelism(1)
+	c1, pi1 := tr.commitAll(vect)
+	for _, n := range []int{0, 2, 3, 100} {
+		tr.SetParallelism(n)
+		c, pi := tr.commitAll(vect)
+		require.True(t, c1.Equal(c))
+		for i := range pi {
+			if pi1[i] == nil {
+				require.Nil(t, pi[i])
+				continue
+			}
+			require.True(t, pi1[i].Equal(pi[i]))
+			require.True(t, pi1[i].Equal(tr.prove(vect, i)))
+		}
+	}
+}
+
+func BenchmarkCommit(b *testing.B) {
+	suite := bn256.NewSuite()
+	tr, err := TrustedSetupFromBytes(suite, GetTrustedSetupBin())
+	require.NoError(b, err)
+	vect := make([]kyber.Scalar, tr.D)
+	for i := range vect {
+		vect[i] = tr.Suite.G1().Scalar().SetInt64(int64(i + 1))
+	}
+	for _, n := range []int{1, 0} {
+		tr.SetParallelism(n)
+		b.Run(fmt.Sprintf("commit-parallelism=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tr.commit(vect)
+			}
+		})
+		b.Run(fmt.Sprintf("prove-parallelism=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tr.prove(vect, i%int(tr.D))
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package trie_kzg_bn256
+
+import (
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/util/random"
+)
+
+// Multi-party update of the trusted setup.
+// Each participant takes the setup produced by the previous one and multiplies the secret by its own secret t:
+// the new secret is s*t. The secret of the result is unknown to anybody unless all participants collude.
+// The update works on powers of the secret: [s^k]1 are restored from the Lagrange basis, because
+// X^k = sum<i>(domain<i>^k * l_i(X)) for k < D. Then [(s*t)^k]1 = t^k * [s^k]1 and the Lagrange basis
+// is derived from the new powers with TrustedSetupFromPowersOfTau. The domain is preserved
+
+// PowersOfTau returns [s^k]1 for k = 0..D-1 and [s]2, where s is the secret of the trusted setup
+func (sd *TrustedSetup) PowersOfTau() ([]kyber.Point, kyber.Point) {
+	tauG1 := make([]kyber.Point, sd.D)
+	pow := make([]kyber.Scalar, sd.D)
+	for i := range pow {
+		pow[i] = sd.Suite.G1().Scalar().One()
+	}
+	elem := sd.Suite.G1().Point()
+	for k := range tauG1 {
+		tauG1[k] = sd.Suite.G1().Point().Null()
+		for i := range sd.LagrangeBasis {
+			tauG1[k].Add(tauG1[k], elem.Mul(pow[i], sd.LagrangeBasis[i]))
+			pow[i].Mul(pow[i], sd.Domain[i])
+		}
+	}
+	// [s]2 = [s-domain<0>]2 + [domain<0>]2
+	tauG2 := sd.Suite.G2().Point().Mul(sd.Domain[0], nil)
+	tauG2.Add(tauG2, sd.Diff2[0])
+	return tauG1, tauG2
+}
+
+// UpdateTrustedSetup adds the secret to the trusted setup. Returns the setup with the secret s*secret,
+// where s is the secret of the original setup. The secret must be destroyed immediately after the update
+func UpdateTrustedSetup(sd *TrustedSetup, secret kyber.Scalar) (*TrustedSetup, error) {
+	if len(secret.String()) < 50 {
+		return nil, errWrongSecret
+	}
+	tauG1, tauG2 := sd.PowersOfTau()
+	t := sd.Suite.G1().Scalar().One()
+	for k := range tauG1 {
+		tauG1[k].Mul(t, tauG1[k])
+		t.Mul(t, secret)
+	}
+	tauG2.Mul(secret, tauG2)
+	return TrustedSetupFromPowersOfTau(sd.Suite, sd.D, tauG1, tauG2, sd.Omega)
+}
+
+// UpdateTrustedSetupRandom adds the random secret to the trusted setup. The secret is destroyed after the update
+func UpdateTrustedSetupRandom(sd *TrustedSetup) (*TrustedSetup, error) {
+	secret := sd.Suite.G1().Scalar().Pick(random.New())
+	defer secret.Zero()
+	return UpdateTrustedSetup(sd, secret)
+}
@@ -0,0 +1,202 @@
+package trie_kzg_bn256
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/lunfardo314/unitrie/common"
+	"go.dedis.ch/kyber/v3"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/xerrors"
+)
+
+// Wire formats of KZG objects, transmitted between nodes and stored outside the trie.
+// Each serialized object starts with the version of the format and the kind of the object.
+// Commitments and proofs are bound to the trusted setup: they contain the digest of the trusted setup
+// they were calculated with, and are rejected if deserialized with another one.
+// Note, that the trie stores commitments in the raw form, without version and digest
+
+// WireVersion is the current version of wire formats
+const WireVersion = byte(1)
+
+const (
+	wireKindVectorCommitment = byte(iota + 1)
+	wireKindTerminalCommitment
+	wireKindProof
+	wireKindSetupDigest
+)
+
+var (
+	errWireVersion      = xerrors.New("unsupported version of the wire format")
+	errWireKind         = xerrors.New("wrong kind of the object in the wire format")
+	errWireSetupDigest  = xerrors.New("object was created with another trusted setup")
+	errWireWrongIndex   = xerrors.New("index of the proof is out of the domain of the trusted setup")
+	errWireNilComponent = xerrors.New("can't serialize object with nil component")
+)
+
+// SetupDigest identifies the trusted setup. It is blake2b-256 hash of the serialized trusted setup
+type SetupDigest [32]byte
+
+// Digest returns the digest of the trusted setup
+func (sd *TrustedSetup) Digest() SetupDigest {
+	sd.digestOnce.Do(func() {
+		sd.digest = blake2b.Sum256(sd.Bytes())
+	})
+	return sd.digest
+}
+
+// Bytes serializes the digest in the wire format
+func (d SetupDigest) Bytes() []byte {
+	return common.Concat(WireVersion, wireKindSetupDigest, d[:])
+}
+
+// SetupDigestFromBytes deserializes the digest from the wire format
+func SetupDigestFromBytes(data []byte) (ret SetupDigest, err error) {
+	rdr := bytes.NewReader(data)
+	if err = readWireHeader(rdr, wireKindSetupDigest); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(rdr, ret[:]); err != nil {
+		return
+	}
+	if rdr.Len() != 0 {
+		err = common.ErrNotAllBytesConsumed
+	}
+	return
+}
+
+// VectorCommitmentBytes serializes the vector commitment in the wire format
+func (m *CommitmentModel) VectorCommitmentBytes(c common.VCommitment) []byte {
+	common.Assertf(!common.IsNil(c), "VectorCommitmentBytes: %v", errWireNilComponent)
+	return m.wireBytes(wireKindVectorCommitment, c)
+}
+
+// VectorCommitmentFromBytes deserializes the vector commitment from the wire format
+func (m *CommitmentModel) VectorCommitmentFromBytes(data []byte) (common.VCommitment, error) {
+	ret := m.newVectorCommitment()
+	if err := m.fromWireBytes(wireKindVectorCommitment, data, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// TerminalCommitmentBytes serializes the terminal commitment in the wire format
+func (m *CommitmentModel) TerminalCommitmentBytes(c common.TCommitment) []byte {
+	common.Assertf(!common.IsNil(c), "TerminalCommitmentBytes: %v", errWireNilComponent)
+	return m.wireBytes(wireKindTerminalCommitment, c)
+}
+
+// TerminalCommitmentFromBytes deserializes the terminal commitment from the wire format
+func (m *CommitmentModel) TerminalCommitmentFromBytes(data []byte) (common.TCommitment, error) {
+	ret := m.newTerminalCommitment()
+	if err := m.fromWireBytes(wireKindTerminalCommitment, data, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (m *CommitmentModel) wireBytes(kind byte, c common.Serializable) []byte {
+	var buf bytes.Buffer
+	writeWireHeader(&buf, kind, m.TrustedSetup().Digest())
+	common.AssertNoError(c.Write(&buf))
+	return buf.Bytes()
+}
+
+func (m *CommitmentModel) fromWireBytes(kind byte, data []byte, c common.Serializable) error {
+	rdr := bytes.NewReader(data)
+	if err := readWireHeader(rdr, kind, m.TrustedSetup().Digest()); err != nil {
+		return err
+	}
+	if err := c.Read(rdr); err != nil {
+		return err
+	}
+	if rdr.Len() != 0 {
+		return common.ErrNotAllBytesConsumed
+	}
+	return nil
+}
+
+// ProofBytes serializes the opening proof in the wire format:
+// header, index (uint16, little-endian), commitment, proof and value. Nil value is serialized as 0
+func (sd *TrustedSetup) ProofBytes(p *ProofTuple) []byte {
+	common.Assertf(p.Commitment != nil && p.Proof != nil, "ProofBytes: %v", errWireNilComponent)
+	common.Assertf(p.Index >= 0 && p.Index < int(sd.D), "ProofBytes: %v", errWireWrongIndex)
+	var buf bytes.Buffer
+	writeWireHeader(&buf, wireKindProof, sd.Digest())
+	var tmp2 [2]byte
+	binary.LittleEndian.PutUint16(tmp2[:], uint16(p.Index))
+	buf.Write(tmp2[:])
+	_, err := p.Commitment.MarshalTo(&buf)
+	common.AssertNoError(err)
+	_, err = p.Proof.MarshalTo(&buf)
+	common.AssertNoError(err)
+	value := p.Value
+	if value == nil {
+		value = sd.ZeroG1
+	}
+	_, err = value.MarshalTo(&buf)
+	common.AssertNoError(err)
+	return buf.Bytes()
+}
+
+// ProofFromBytes deserializes the opening proof from the wire format. The proof must be created with the same trusted setup
+func (sd *TrustedSetup) ProofFromBytes(data []byte) (*ProofTuple, error) {
+	rdr := bytes.NewReader(data)
+	if err := readWireHeader(rdr, wireKindProof, sd.Digest()); err != nil {
+		return nil, err
+	}
+	var tmp2 [2]byte
+	if _, err := io.ReadFull(rdr, tmp2[:]); err != nil {
+		return nil, err
+	}
+	ret := &ProofTuple{
+		Commitment: sd.Suite.G1().Point(),
+		Proof:      sd.Suite.G1().Point(),
+		Value:      sd.Suite.G1().Scalar(),
+		Index:      int(binary.LittleEndian.Uint16(tmp2[:])),
+	}
+	if ret.Index >= int(sd.D) {
+		return nil, errWireWrongIndex
+	}
+	for _, m := range []kyber.Marshaling{ret.Commitment, ret.Proof, ret.Value} {
+		if _, err := m.UnmarshalFrom(rdr); err != nil {
+			return nil, err
+		}
+	}
+	if rdr.Len() != 0 {
+		return nil, common.ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
+
+func writeWireHeader(w *bytes.Buffer, kind byte, digest SetupDigest) {
+	w.WriteByte(WireVersion)
+	w.WriteByte(kind)
+	w.Write(digest[:])
+}
+
+// readWireHeader reads and checks version and kind. If digest is provided, reads and checks digest of the trusted setup
+func readWireHeader(r io.Reader, kind byte, digest ...SetupDigest) error {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return err
+	}
+	if hdr[0] != WireVersion {
+		return errWireVersion
+	}
+	if hdr[1] != kind {
+		return errWireKind
+	}
+	if len(digest) == 0 {
+		return nil
+	}
+	var d SetupDigest
+	if _, err := io.ReadFull(r, d[:]); err != nil {
+		return err
+	}
+	if d != digest[0] {
+		return errWireSetupDigest
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package trie_kzg_bn256
+
+import (
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/kyber/v3"
+	"go.dedis.ch/kyber/v3/pairing/bn256"
+)
+
+func TestWireFormat(t *testing.T) {
+	m := NewV2()
+	ts := m.TrustedSetup()
+	other, err := TrustedSetupFromSeed(bn256.NewSuite(), vectorLength, []byte("other"))
+	require.NoError(t, err)
+	require.NotEqual(t, ts.Digest(), other.Digest())
+
+	t.Run("digest", func(t *testing.T) {
+		d := ts.Digest()
+		back, err := SetupDigestFromBytes(d.Bytes())
+		require.NoError(t, err)
+		require.EqualValues(t, d, back)
+
+		data := d.Bytes()
+		data[0] = WireVersion + 1
+		_, err = SetupDigestFromBytes(data)
+		require.ErrorIs(t, err, errWireVersion)
+		_, err = SetupDigestFromBytes(append(d.Bytes(), 0))
+		require.ErrorIs(t, err, common.ErrNotAllBytesConsumed)
+	})
+	t.Run("commitments", func(t *testing.T) {
+		n := common.NewNodeData()
+		n.Terminal = m.CommitToData([]byte("value"))
+		c := m.CalcNodeCommitment(n, []byte("path"))
+
+		data := m.VectorCommitmentBytes(c)
+		back, err := m.VectorCommitmentFromBytes(data)
+		require.NoError(t, err)
+		require.True(t, m.EqualCommitments(c, back))
+
+		tdata := m.TerminalCommitmentBytes(n.Terminal)
+		tback, err := m.TerminalCommitmentFromBytes(tdata)
+		require.NoError(t, err)
+		require.True(t, m.EqualCommitments(n.Terminal, tback))
+
+		_, err = m.TerminalCommitmentFromBytes(data)
+		require.ErrorIs(t, err, errWireKind)
+
+		mOther := NewV2()
+		_, err = mOther.SwapTrustedSetup(other)
+		require.NoError(t, err)
+		_, err = mOther.VectorCommitmentFromBytes(data)
+		require.ErrorIs(t, err, errWireSetupDigest)
+	})
+	t.Run("proof", func(t *testing.T) {
+		vect := make([]kyber.Scalar, ts.D)
+		for i := 1; i < len(vect); i += 2 {
+			vect[i] = ts.Suite.G1().Scalar().SetInt64(int64(i))
+		}
+		c := ts.commit(vect)
+		for _, i := range []int{0, 1, int(ts.D) - 1} {
+			p := ProofTuple{Commitment: c, Proof: ts.prove(vect, i), Value: vect[i], Index: i}
+			back, err := ts.ProofFromBytes(ts.ProofBytes(&p))
+			require.NoError(t, err)
+			require.EqualValues(t, i, back.Index)
+			require.True(t, ts.VerifyBatch([]ProofTuple{*back}))
+
+			_, err = other.ProofFromBytes(ts.ProofBytes(&p))
+			require.ErrorIs(t, err, errWireSetupDigest)
+		}
+	})
+}
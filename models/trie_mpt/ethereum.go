@@ -0,0 +1,48 @@
+package trie_mpt
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Encoding of keys and values of the Ethereum state and storage tries. Both are secure tries: the key is
+// the Keccak-256 hash of the account address or of the 32-byte storage slot.
+// The value of the account is the RLP list of nonce, balance, storage root and code hash.
+// The value of the storage slot is the RLP string of the 32-byte word without leading zeros. Zero words are
+// not stored in the trie
+
+// EmptyCodeHash is the code hash of the account without code: Keccak-256 of the empty data
+var EmptyCodeHash = keccak(nil)
+
+// HashKey returns key as it is stored in the secure trie
+func HashKey(key []byte) []byte {
+	return keccak(key)
+}
+
+// EncodeAccount encodes the value of the account in the state trie.
+// Nil storage root and code hash mean empty storage and no code
+func EncodeAccount(nonce uint64, balance *big.Int, storageRoot, codeHash []byte) []byte {
+	if storageRoot == nil {
+		storageRoot = EmptyRootHash
+	}
+	if codeHash == nil {
+		codeHash = EmptyCodeHash
+	}
+	var balanceBytes []byte
+	if balance != nil {
+		balanceBytes = balance.Bytes()
+	}
+	return common.RLPEncodeList(common.RLPEncodeUint(nonce), common.RLPEncodeBytes(balanceBytes), common.RLPEncodeBytes(storageRoot), common.RLPEncodeBytes(codeHash))
+}
+
+// EncodeStorageValue encodes the value of the storage slot. Returns nil for the zero word, i.e. the slot
+// must be deleted from the trie
+func EncodeStorageValue(word []byte) []byte {
+	word = bytes.TrimLeft(word, "\x00")
+	if len(word) == 0 {
+		return nil
+	}
+	return common.RLPEncodeBytes(word)
+}
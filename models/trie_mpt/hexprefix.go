@@ -0,0 +1,20 @@
+package trie_mpt
+
+// hexPrefix is the compact encoding of the nibble path with the leaf flag
+func hexPrefix(nibbles []byte, leaf bool) []byte {
+	var flags byte
+	if leaf {
+		flags = 0x20
+	}
+	ret := make([]byte, 0, len(nibbles)/2+1)
+	if len(nibbles)%2 == 1 {
+		ret = append(ret, flags|0x10|nibbles[0])
+		nibbles = nibbles[1:]
+	} else {
+		ret = append(ret, flags)
+	}
+	for i := 0; i < len(nibbles); i += 2 {
+		ret = append(ret, nibbles[i]<<4|nibbles[i+1])
+	}
+	return ret
+}
@@ -0,0 +1,17 @@
+package trie_mpt
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHexPrefix(t *testing.T) {
+	require.EqualValues(t, "00", hex.EncodeToString(hexPrefix(nil, false)))
+	require.EqualValues(t, "20", hex.EncodeToString(hexPrefix(nil, true)))
+	require.EqualValues(t, "112345", hex.EncodeToString(hexPrefix([]byte{1, 2, 3, 4, 5}, false)))
+	require.EqualValues(t, "00012345", hex.EncodeToString(hexPrefix([]byte{0, 1, 2, 3, 4, 5}, false)))
+	require.EqualValues(t, "200f1cb8", hex.EncodeToString(hexPrefix([]byte{0, 0xf, 1, 0xc, 0xb, 8}, true)))
+	require.EqualValues(t, "3f1cb8", hex.EncodeToString(hexPrefix([]byte{0xf, 1, 0xc, 0xb, 8}, true)))
+}
@@ -0,0 +1,313 @@
+// Package trie_mpt implements common.CommitmentModel which reproduces roots of the Ethereum hexary
+// Merkle Patricia Trie: Keccak-256 hashing and RLP-encoded nodes. Nodes of the unitrie with arity 16
+// map one-to-one to leaf, extension and branch nodes of the MPT, so the root of the trie is equal to the root
+// of the MPT with the same key/value pairs. It makes possible to recompute and cross-check state and storage
+// roots of geth from the exported data. See also HashKey, EncodeAccount and EncodeStorageValue
+package trie_mpt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"github.com/lunfardo314/unitrie/common"
+	"golang.org/x/crypto/sha3"
+)
+
+// terminalCommitment is the value itself: leaf and branch nodes of the MPT contain the value
+type terminalCommitment struct {
+	value []byte
+}
+
+// vectorCommitment is the reference to the node as it is encoded in the parent MPT node: the RLP encoding
+// of the node if shorter than 32 bytes, otherwise its Keccak-256 hash.
+// The extra hash is only present in the root and the nodes at depth 1. The root node of the trie always commits
+// to the identity of the state, which is not part of the MPT, so the extra hash of the root is the hash of the identity.
+// It distinguishes roots of different identities in the store. In the MPT, the only child of the root is collapsed
+// into the root with the child index prepended to its path. The extra hash of the node at depth 1 is the hash
+// of such collapsed node
+type vectorCommitment struct {
+	ref   []byte
+	extra []byte
+}
+
+// CommitmentModel reproduces roots of the Ethereum MPT. The path arity is always 16
+type CommitmentModel struct{}
+
+// ModelID is the ID of the model in the common model registry
+const ModelID = common.ModelID(0x30)
+
+// hashSize of the Keccak-256
+const hashSize = 32
+
+// EmptyRootHash is the root of the empty MPT: Keccak-256 of the RLP encoded empty string
+var EmptyRootHash = keccak([]byte{0x80})
+
+var errWrongCommitment = errors.New("wrong MPT node commitment")
+
+func init() {
+	common.MustRegisterModel(ModelID, New())
+}
+
+func New() *CommitmentModel {
+	return &CommitmentModel{}
+}
+
+func (m *CommitmentModel) PathArity() common.PathArity {
+	return common.PathArity16
+}
+
+func (m *CommitmentModel) EqualCommitments(c1, c2 common.Serializable) bool {
+	if equals, conclusive := common.CheckNils(c1, c2); conclusive {
+		return equals
+	}
+	if t1, ok1 := c1.(*terminalCommitment); ok1 {
+		if t2, ok2 := c2.(*terminalCommitment); ok2 {
+			return bytes.Equal(t1.value, t2.value)
+		}
+	}
+	if v1, ok1 := c1.(*vectorCommitment); ok1 {
+		if v2, ok2 := c2.(*vectorCommitment); ok2 {
+			return bytes.Equal(v1.ref, v2.ref) && bytes.Equal(v1.extra, v2.extra)
+		}
+	}
+	return false
+}
+
+func (m *CommitmentModel) NewVectorCommitment() common.VCommitment {
+	return &vectorCommitment{}
+}
+
+func (m *CommitmentModel) NewTerminalCommitment() common.TCommitment {
+	return &terminalCommitment{}
+}
+
+func (m *CommitmentModel) CommitToData(data []byte) common.TCommitment {
+	if len(data) == 0 {
+		// empty slice -> no data (deleted)
+		return nil
+	}
+	return &terminalCommitment{value: common.Concat(data)}
+}
+
+func (m *CommitmentModel) CalcNodeCommitment(n *common.NodeData, nodePath []byte) common.VCommitment {
+	if len(n.ChildCommitments) == 0 && n.Terminal == nil {
+		return nil
+	}
+	return commitNode(n, nodePath)
+}
+
+// UpdateNodeCommitment replaces children and terminal and calculates the commitment from scratch
+func (m *CommitmentModel) UpdateNodeCommitment(mutate *common.NodeData, childUpdates map[byte]common.VCommitment, terminal common.TCommitment, pathFragment, nodePath []byte, _ bool) {
+	for i, upd := range childUpdates {
+		if common.IsNil(upd) {
+			delete(mutate.ChildCommitments, i)
+		} else {
+			mutate.ChildCommitments[i] = upd
+		}
+	}
+	mutate.Terminal = terminal
+	mutate.PathFragment = pathFragment
+	if len(mutate.ChildCommitments) == 0 && mutate.Terminal == nil {
+		return
+	}
+	mutate.Commitment = commitNode(mutate, nodePath)
+}
+
+// ForceStoreTerminalWithNode always true: the value is needed to encode the node
+func (m *CommitmentModel) ForceStoreTerminalWithNode(_ common.TCommitment) bool {
+	return true
+}
+
+func (m *CommitmentModel) AlwaysStoreTerminalWithNode() bool {
+	return true
+}
+
+func (m *CommitmentModel) Description() string {
+	return "trie commitment model compatible with the Ethereum hexary Merkle Patricia Trie (Keccak-256, RLP), arity: PathArity16"
+}
+
+func (m *CommitmentModel) ShortName() string {
+	return "mpt_keccak"
+}
+
+// CommitmentsDependOnPosition is false: node references below the top level are hashes (or inline encodings)
+// of the node contents only, so equal subtrees at different positions share records in the store
+func (m *CommitmentModel) CommitmentsDependOnPosition() bool {
+	return false
+}
+
+// RootHash returns the root of the MPT from the root commitment of the trie
+func RootHash(root common.VCommitment) []byte {
+	if common.IsNil(root) {
+		return nil
+	}
+	return common.Concat(root.(*vectorCommitment).ref)
+}
+
+// commitNode calculates commitment of the node with the node path
+func commitNode(n *common.NodeData, nodePath []byte) *vectorCommitment {
+	if len(nodePath) == 0 {
+		common.Assertf(len(n.PathFragment) == 0, "trie_mpt: root node can't have path fragment")
+		identity, _ := common.ExtractValue(n.Terminal)
+		return &vectorCommitment{
+			ref:   rootHash(n),
+			extra: keccak(identity),
+		}
+	}
+	ret := &vectorCommitment{ref: nodeRef(encodeNode(n, n.PathFragment))}
+	if len(nodePath) == 1 {
+		ret.extra = keccak(encodeNode(n, common.Concat(nodePath[0], n.PathFragment)))
+	}
+	return ret
+}
+
+// rootHash calculates the MPT root from children of the root. The terminal of the root is the identity
+// of the state, it is not part of the MPT
+func rootHash(n *common.NodeData) []byte {
+	switch len(n.ChildCommitments) {
+	case 0:
+		return common.Concat(EmptyRootHash)
+	case 1:
+		for _, c := range n.ChildCommitments {
+			extra := c.(*vectorCommitment).extra
+			common.Assertf(len(extra) == hashSize, "trie_mpt: collapsed hash of the child is missing")
+			return common.Concat(extra)
+		}
+	}
+	return keccak(encodeBranch(n.ChildCommitments, nil))
+}
+
+// encodeNode encodes node with the path as leaf, branch or extension with the branch
+func encodeNode(n *common.NodeData, path []byte) []byte {
+	value, _ := common.ExtractValue(n.Terminal)
+	if len(n.ChildCommitments) == 0 {
+		return common.RLPEncodeList(common.RLPEncodeBytes(hexPrefix(path, true)), common.RLPEncodeBytes(value))
+	}
+	branch := encodeBranch(n.ChildCommitments, value)
+	if len(path) == 0 {
+		return branch
+	}
+	return common.RLPEncodeList(common.RLPEncodeBytes(hexPrefix(path, false)), refItem(nodeRef(branch)))
+}
+
+func encodeBranch(children map[byte]common.VCommitment, value []byte) []byte {
+	items := make([][]byte, 17)
+	for i := range items[:16] {
+		if c, ok := children[byte(i)]; ok {
+			items[i] = refItem(c.(*vectorCommitment).ref)
+		} else {
+			items[i] = common.RLPEncodeBytes(nil)
+		}
+	}
+	items[16] = common.RLPEncodeBytes(value)
+	return common.RLPEncodeList(items...)
+}
+
+// nodeRef is the node encoding itself if shorter than 32 bytes, otherwise the hash
+func nodeRef(encoded []byte) []byte {
+	if len(encoded) < hashSize {
+		return encoded
+	}
+	return keccak(encoded)
+}
+
+// refItem is the reference to the node as the item in the parent node. Short nodes are embedded
+func refItem(ref []byte) []byte {
+	if len(ref) < hashSize {
+		return ref
+	}
+	return common.RLPEncodeBytes(ref)
+}
+
+func keccak(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+// *vectorCommitment implements common.VCommitment
+var _ common.VCommitment = &vectorCommitment{}
+
+func (v *vectorCommitment) Bytes() []byte {
+	return common.MustBytes(v)
+}
+
+func (v *vectorCommitment) Read(r io.Reader) error {
+	var err error
+	if v.ref, err = common.ReadBytes8(r); err != nil {
+		return err
+	}
+	if v.extra, err = common.ReadBytes8(r); err != nil {
+		return err
+	}
+	if len(v.ref) == 0 || len(v.ref) > hashSize || (len(v.extra) != 0 && len(v.extra) != hashSize) {
+		return errWrongCommitment
+	}
+	if len(v.extra) == 0 {
+		v.extra = nil
+	}
+	return nil
+}
+
+func (v *vectorCommitment) Write(w io.Writer) error {
+	if err := common.WriteBytes8(w, v.ref); err != nil {
+		return err
+	}
+	return common.WriteBytes8(w, v.extra)
+}
+
+func (v *vectorCommitment) AsKey() []byte {
+	return common.Concat(v.ref, v.extra)
+}
+
+func (v *vectorCommitment) String() string {
+	return hex.EncodeToString(v.ref)
+}
+
+func (v *vectorCommitment) Clone() common.VCommitment {
+	if v == nil {
+		return nil
+	}
+	return &vectorCommitment{
+		ref:   common.Concat(v.ref),
+		extra: common.Concat(v.extra),
+	}
+}
+
+// *terminalCommitment implements common.TCommitment
+var _ common.TCommitment = &terminalCommitment{}
+
+func (t *terminalCommitment) Write(w io.Writer) error {
+	return common.WriteBytes32(w, t.value)
+}
+
+func (t *terminalCommitment) Read(r io.Reader) error {
+	var err error
+	t.value, err = common.ReadBytes32(r)
+	return err
+}
+
+func (t *terminalCommitment) Bytes() []byte {
+	return common.MustBytes(t)
+}
+
+func (t *terminalCommitment) String() string {
+	return hex.EncodeToString(t.value)
+}
+
+func (t *terminalCommitment) Clone() common.TCommitment {
+	if t == nil {
+		return nil
+	}
+	return &terminalCommitment{value: common.Concat(t.value)}
+}
+
+func (t *terminalCommitment) AsKey() []byte {
+	return t.Bytes()
+}
+
+func (t *terminalCommitment) ExtractValue() ([]byte, bool) {
+	return t.value, true
+}
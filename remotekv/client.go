@@ -0,0 +1,201 @@
+package remotekv
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// CacheSizeDefault default maximum number of values in the LRU cache of the client
+const CacheSizeDefault = 10000
+
+// ClientOptions optional parameters of the client
+type ClientOptions struct {
+	// HTTPClient is used for requests. http.DefaultClient if nil
+	HTTPClient *http.Client
+	// CacheSize maximum number of values in the LRU cache. CacheSizeDefault if 0, negative disables the cache
+	CacheSize int
+	// MaxBatchSize maximum number of keys in one request. Must not exceed the limit of the server.
+	// MaxBatchSizeDefault if 0
+	MaxBatchSize int
+}
+
+// Client reads the key/value store from the remote server. Present values are cached in the LRU cache:
+// it assumes that values of present keys never change, which is the case for the trie nodes and values,
+// stored under their commitments. Absence is never cached.
+// The KVReader interface does not return errors, so transport and protocol errors panic.
+// Client is safe for concurrent use
+type Client struct {
+	url          string
+	httpClient   *http.Client
+	maxBatchSize int
+
+	mutex       sync.Mutex
+	cacheSize   int
+	lru         *list.List
+	entries     map[string]*list.Element
+	requests    int
+	cacheHits   int
+	cacheMisses int
+}
+
+type cacheEntry struct {
+	key   string
+	value []byte
+}
+
+var (
+	_ common.KVReader        = &Client{}
+	_ common.KVBatchedReader = &Client{}
+)
+
+// NewClient creates client of the server at the URL
+func NewClient(url string, opts ...ClientOptions) *Client {
+	var opt ClientOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	ret := &Client{
+		url:          strings.TrimSuffix(url, "/"),
+		httpClient:   opt.HTTPClient,
+		maxBatchSize: opt.MaxBatchSize,
+		cacheSize:    opt.CacheSize,
+		lru:          list.New(),
+		entries:      make(map[string]*list.Element),
+	}
+	if ret.httpClient == nil {
+		ret.httpClient = http.DefaultClient
+	}
+	if ret.maxBatchSize <= 0 {
+		ret.maxBatchSize = MaxBatchSizeDefault
+	}
+	if ret.cacheSize == 0 {
+		ret.cacheSize = CacheSizeDefault
+	}
+	return ret
+}
+
+// ClientStats statistics of the client
+type ClientStats struct {
+	Requests    int
+	CacheHits   int
+	CacheMisses int
+}
+
+func (c *Client) Stats() ClientStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return ClientStats{
+		Requests:    c.requests,
+		CacheHits:   c.cacheHits,
+		CacheMisses: c.cacheMisses,
+	}
+}
+
+func (c *Client) Get(key []byte) []byte {
+	return c.GetMany([][]byte{key})[0]
+}
+
+// Has checks presence of the key. The value is not fetched
+func (c *Client) Has(key []byte) bool {
+	if _, ok := c.getCached(key); ok {
+		return true
+	}
+	var req bytes.Buffer
+	common.AssertNoError(writeKeys(&req, [][]byte{key}))
+	resp := c.mustPost(PathHas, req.Bytes())
+	common.Assertf(len(resp) == 1 && resp[0] <= 1, "remotekv: wrong response to %s", PathHas)
+	return resp[0] == 1
+}
+
+// GetMany reads values of the keys, which are not in the cache, in batches of up to MaxBatchSize keys
+func (c *Client) GetMany(keys [][]byte) [][]byte {
+	ret := make([][]byte, len(keys))
+	missing := make([]int, 0)
+	for i, k := range keys {
+		if v, ok := c.getCached(k); ok {
+			ret[i] = v
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > c.maxBatchSize {
+			batch = batch[:c.maxBatchSize]
+		}
+		missing = missing[len(batch):]
+
+		batchKeys := make([][]byte, len(batch))
+		for i, idx := range batch {
+			batchKeys[i] = keys[idx]
+		}
+		var req bytes.Buffer
+		common.AssertNoError(writeKeys(&req, batchKeys))
+		values, err := readValues(c.mustPost(PathGet, req.Bytes()), len(batch))
+		common.AssertNoError(err)
+		for i, idx := range batch {
+			ret[idx] = values[i]
+			if len(values[i]) > 0 {
+				c.putCached(batchKeys[i], values[i])
+			}
+		}
+	}
+	return ret
+}
+
+func (c *Client) mustPost(path string, body []byte) []byte {
+	c.mutex.Lock()
+	c.requests++
+	c.mutex.Unlock()
+
+	resp, err := c.httpClient.Post(c.url+path, "application/octet-stream", bytes.NewReader(body))
+	common.AssertNoError(err)
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	common.AssertNoError(err)
+	if resp.StatusCode != http.StatusOK {
+		panic(fmt.Errorf("remotekv: %s: %s: %s", path, resp.Status, strings.TrimSpace(string(data))))
+	}
+	return data
+}
+
+func (c *Client) getCached(key []byte) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cacheSize < 0 {
+		return nil, false
+	}
+	e, ok := c.entries[string(key)]
+	if !ok {
+		c.cacheMisses++
+		return nil, false
+	}
+	c.cacheHits++
+	c.lru.MoveToFront(e)
+	return common.Concat(e.Value.(*cacheEntry).value), true
+}
+
+func (c *Client) putCached(key, value []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cacheSize < 0 {
+		return
+	}
+	if e, ok := c.entries[string(key)]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[string(key)] = c.lru.PushFront(&cacheEntry{key: string(key), value: value})
+	for c.lru.Len() > c.cacheSize {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.entries, last.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,105 @@
+package remotekv
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	store := common.NewInMemoryKVStore()
+	for i := 0; i < 100; i++ {
+		store.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	srv := httptest.NewServer(NewServer(store, 10))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, ClientOptions{MaxBatchSize: 10, CacheSize: 50})
+	require.EqualValues(t, "value5", string(c.Get([]byte("key5"))))
+	require.Nil(t, c.Get([]byte("absent")))
+	require.True(t, c.Has([]byte("key6")))
+	require.False(t, c.Has([]byte("absent")))
+	require.EqualValues(t, 4, c.Stats().Requests)
+
+	// cached
+	require.EqualValues(t, "value5", string(c.Get([]byte("key5"))))
+	require.EqualValues(t, 4, c.Stats().Requests)
+
+	keys := make([][]byte, 0)
+	for i := 0; i < 30; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("key%d", i)))
+	}
+	keys = append(keys, []byte("absent"))
+	values := common.GetMany(c, keys)
+	for i := 0; i < 30; i++ {
+		require.EqualValues(t, fmt.Sprintf("value%d", i), string(values[i]))
+	}
+	require.Nil(t, values[30])
+	// key5 is cached, 30 keys in batches of 10
+	require.EqualValues(t, 4+3, c.Stats().Requests)
+
+	// the server limits the batch
+	c1 := NewClient(srv.URL, ClientOptions{MaxBatchSize: 11})
+	require.Panics(t, func() {
+		common.GetMany(c1, keys)
+	})
+}
+
+func TestClientCacheEviction(t *testing.T) {
+	store := common.NewInMemoryKVStore()
+	for i := 0; i < 10; i++ {
+		store.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	srv := httptest.NewServer(NewServer(store))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, ClientOptions{CacheSize: 2})
+	c.Get([]byte("key0"))
+	c.Get([]byte("key1"))
+	c.Get([]byte("key0"))
+	c.Get([]byte("key2")) // evicts key1
+	require.EqualValues(t, 3, c.Stats().Requests)
+	c.Get([]byte("key0"))
+	require.EqualValues(t, 3, c.Stats().Requests)
+	c.Get([]byte("key1"))
+	require.EqualValues(t, 4, c.Stats().Requests)
+
+	noCache := NewClient(srv.URL, ClientOptions{CacheSize: -1})
+	noCache.Get([]byte("key0"))
+	noCache.Get([]byte("key0"))
+	require.EqualValues(t, 2, noCache.Stats().Requests)
+}
+
+func TestRemoteTrieReader(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	root = tr.Commit(store)
+
+	srv := httptest.NewServer(NewServer(store))
+	defer srv.Close()
+
+	trr, err := immutable.NewTrieReader(m, NewClient(srv.URL), root)
+	require.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		require.EqualValues(t, fmt.Sprintf("value%d", i), trr.GetStr(fmt.Sprintf("key%d", i)))
+	}
+	require.False(t, trr.HasStr("absent"))
+}
+
+func TestServerMethod(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(common.NewInMemoryKVStore()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, PathGet, nil))
+	require.EqualValues(t, http.StatusMethodNotAllowed, rec.Code)
+}
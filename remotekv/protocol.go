@@ -0,0 +1,104 @@
+// Package remotekv gives access to the key/value store hosted on another machine over HTTP.
+// The server exposes any common.KVReader, the client implements common.KVReader and common.KVBatchedReader,
+// so the trie can be read from the remote store: immutable.NewTrieReader(m, remotekv.NewClient(url), root).
+//
+// Protocol. Both endpoints are POST with the binary body. All integers are little-endian
+//
+//	/get  request: number of keys (uint32), each key (uint16 size + bytes)
+//	      response: for each key, flag of presence (byte), value of the present key (uint32 size + bytes)
+//	/has  request: same as of /get
+//	      response: for each key, flag of presence (byte)
+package remotekv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+const (
+	PathGet = "/get"
+	PathHas = "/has"
+
+	// MaxBatchSizeDefault maximum number of keys in one request
+	MaxBatchSizeDefault = 1000
+)
+
+var (
+	ErrTooManyKeys = errors.New("too many keys in the request")
+	errWrongFlag   = errors.New("wrong presence flag")
+)
+
+func writeKeys(w io.Writer, keys [][]byte) error {
+	if err := common.WriteUint32(w, uint32(len(keys))); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := common.WriteBytes16(w, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readKeys(r io.Reader, maxKeys int) ([][]byte, error) {
+	var n uint32
+	if err := common.ReadUint32(r, &n); err != nil {
+		return nil, err
+	}
+	if int(n) > maxKeys {
+		return nil, ErrTooManyKeys
+	}
+	ret := make([][]byte, n)
+	var err error
+	for i := range ret {
+		if ret[i], err = common.ReadBytes16(r); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func writeValues(w io.Writer, values [][]byte) error {
+	for _, v := range values {
+		if len(v) == 0 {
+			if err := common.WriteByte(w, 0); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := common.WriteByte(w, 1); err != nil {
+			return err
+		}
+		if err := common.WriteBytes32(w, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readValues(data []byte, n int) ([][]byte, error) {
+	rdr := bytes.NewReader(data)
+	ret := make([][]byte, n)
+	for i := range ret {
+		flag, err := common.ReadByte(rdr)
+		if err != nil {
+			return nil, err
+		}
+		switch flag {
+		case 0:
+		case 1:
+			if ret[i], err = common.ReadBytes32(rdr); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errWrongFlag
+		}
+	}
+	if rdr.Len() != 0 {
+		return nil, common.ErrNotAllBytesConsumed
+	}
+	return ret, nil
+}
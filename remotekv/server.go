@@ -0,0 +1,94 @@
+package remotekv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/lunfardo314/unitrie/common"
+)
+
+// Server serves the key/value store to remote clients. The store must be safe for concurrent reads
+type Server struct {
+	store        common.KVReader
+	maxBatchSize int
+	mux          *http.ServeMux
+}
+
+// NewServer creates the server of the store. Optional maxBatchSize is maximum number of keys in one request,
+// MaxBatchSizeDefault by default
+func NewServer(store common.KVReader, maxBatchSize ...int) *Server {
+	ret := &Server{
+		store:        store,
+		maxBatchSize: MaxBatchSizeDefault,
+		mux:          http.NewServeMux(),
+	}
+	if len(maxBatchSize) > 0 && maxBatchSize[0] > 0 {
+		ret.maxBatchSize = maxBatchSize[0]
+	}
+	ret.mux.HandleFunc(PathGet, ret.handleGet)
+	ret.mux.HandleFunc(PathHas, ret.handleHas)
+	return ret
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	keys, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+	var buf bytes.Buffer
+	common.AssertNoError(writeValues(&buf, common.GetMany(s.store, keys)))
+	writeResponse(w, buf.Bytes())
+}
+
+func (s *Server) handleHas(w http.ResponseWriter, r *http.Request) {
+	keys, ok := s.readRequest(w, r)
+	if !ok {
+		return
+	}
+	ret := make([]byte, len(keys))
+	for i, has := range common.HasMany(s.store, keys) {
+		if has {
+			ret[i] = 1
+		}
+	}
+	writeResponse(w, ret)
+}
+
+func (s *Server) readRequest(w http.ResponseWriter, r *http.Request) ([][]byte, bool) {
+	// keys are at most 64K each
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(s.maxBatchSize)*(math.MaxUint16+2)+4))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	rdr := bytes.NewReader(body)
+	keys, err := readKeys(rdr, s.maxBatchSize)
+	if err == nil && rdr.Len() != 0 {
+		err = common.ErrNotAllBytesConsumed
+	}
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrTooManyKeys) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return nil, false
+	}
+	return keys, true
+}
+
+func writeResponse(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+}
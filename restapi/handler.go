@@ -0,0 +1,266 @@
+// Package restapi provides embeddable HTTP handler of the read-only REST API to the committed state of the trie.
+// Endpoints:
+//
+//	GET /root                           root commitment and the commitment model
+//	GET /get?key=<key>                  value of the key
+//	GET /proof?key=<key>                proof of inclusion or absence of the key
+//	GET /iterate?prefix=<p>&limit=<n>   key/value pairs with the prefix, in the order of the trie
+//
+// Keys, prefixes, values, roots and proofs are encoded according to the 'encoding' query parameter:
+// 'hex' (default) or 'base64'. Responses are JSON objects. Errors are returned as {"error": "..."}
+// with the corresponding HTTP status
+package restapi
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+)
+
+const (
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+
+	DefaultIterateLimit    = 100
+	MaxIterateLimitDefault = 10000
+)
+
+var (
+	errWrongEncoding    = errors.New("wrong encoding, must be 'hex' or 'base64'")
+	errWrongLimit       = errors.New("wrong limit")
+	errNoProofs         = errors.New("proofs are not supported for the commitment model")
+	errMethodNotAllowed = errors.New("method not allowed")
+)
+
+// ProofFunc produces serialized proof of the key in the trie
+type ProofFunc func(key []byte, tr *immutable.TrieReader) ([]byte, error)
+
+// Options optional parameters of the handler
+type Options struct {
+	// Prove produces proofs. By default, proofs are produced for the trie_blake2b models only
+	Prove ProofFunc
+	// MaxIterateLimit maximum number of key/value pairs returned by /iterate. MaxIterateLimitDefault if 0
+	MaxIterateLimit int
+}
+
+// Handler serves the REST API of the trie. The trie reader can be replaced with SetTrieReader,
+// for example when the new root is committed. Requests are served one at a time
+type Handler struct {
+	mutex sync.Mutex
+	tr    *immutable.TrieReader
+	opt   Options
+	mux   *http.ServeMux
+}
+
+type (
+	RootResponse struct {
+		Root  string `json:"root"`
+		Model string `json:"model"`
+	}
+
+	GetResponse struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		Found bool   `json:"found"`
+	}
+
+	ProofResponse struct {
+		Root  string `json:"root"`
+		Key   string `json:"key"`
+		Proof string `json:"proof"`
+	}
+
+	KeyValue struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+
+	IterateResponse struct {
+		Items []KeyValue `json:"items"`
+		// More is true if there are more key/value pairs with the prefix than the limit
+		More bool `json:"more"`
+	}
+
+	ErrorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// NewHandler creates the handler, serving the trie reader
+func NewHandler(tr *immutable.TrieReader, opts ...Options) *Handler {
+	ret := &Handler{tr: tr}
+	if len(opts) > 0 {
+		ret.opt = opts[0]
+	}
+	if ret.opt.Prove == nil {
+		ret.opt.Prove = proveBlake2b
+	}
+	if ret.opt.MaxIterateLimit <= 0 {
+		ret.opt.MaxIterateLimit = MaxIterateLimitDefault
+	}
+	ret.mux = http.NewServeMux()
+	ret.mux.HandleFunc("/root", ret.handleRoot)
+	ret.mux.HandleFunc("/get", ret.handleGet)
+	ret.mux.HandleFunc("/proof", ret.handleProof)
+	ret.mux.HandleFunc("/iterate", ret.handleIterate)
+	return ret
+}
+
+// SetTrieReader replaces the trie reader served by the handler
+func (h *Handler) SetTrieReader(tr *immutable.TrieReader) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.tr = tr
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, errMethodNotAllowed)
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) handleRoot(w http.ResponseWriter, r *http.Request) {
+	enc, err := encodingParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, &RootResponse{
+		Root:  encode(enc, h.tr.Root().Bytes()),
+		Model: h.tr.Model().ShortName(),
+	})
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	enc, key, ok := keyParam(w, r, "key")
+	if !ok {
+		return
+	}
+	ret := &GetResponse{Key: encode(enc, key)}
+	h.tr.GetFunc(key, func(value []byte) {
+		ret.Value = encode(enc, value)
+		ret.Found = true
+	})
+	writeJSON(w, ret)
+}
+
+func (h *Handler) handleProof(w http.ResponseWriter, r *http.Request) {
+	enc, key, ok := keyParam(w, r, "key")
+	if !ok {
+		return
+	}
+	proof, err := h.opt.Prove(key, h.tr)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errNoProofs) {
+			status = http.StatusNotImplemented
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, &ProofResponse{
+		Root:  encode(enc, h.tr.Root().Bytes()),
+		Key:   encode(enc, key),
+		Proof: encode(enc, proof),
+	})
+}
+
+func (h *Handler) handleIterate(w http.ResponseWriter, r *http.Request) {
+	enc, prefix, ok := keyParam(w, r, "prefix")
+	if !ok {
+		return
+	}
+	limit := DefaultIterateLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil || limit <= 0 || limit > h.opt.MaxIterateLimit {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%w: must be from 1 to %d", errWrongLimit, h.opt.MaxIterateLimit))
+			return
+		}
+	}
+	ret := &IterateResponse{Items: make([]KeyValue, 0)}
+	h.tr.Iterator(prefix).Iterate(func(k, v []byte) bool {
+		if len(ret.Items) >= limit {
+			ret.More = true
+			return false
+		}
+		ret.Items = append(ret.Items, KeyValue{Key: encode(enc, k), Value: encode(enc, v)})
+		return true
+	})
+	writeJSON(w, ret)
+}
+
+func proveBlake2b(key []byte, tr *immutable.TrieReader) ([]byte, error) {
+	m, ok := tr.Model().(*trie_blake2b.CommitmentModel)
+	if !ok {
+		return nil, errNoProofs
+	}
+	return m.ProofImmutable(key, tr).Bytes(), nil
+}
+
+func encodingParam(r *http.Request) (string, error) {
+	switch enc := r.URL.Query().Get("encoding"); enc {
+	case "", EncodingHex:
+		return EncodingHex, nil
+	case EncodingBase64:
+		return EncodingBase64, nil
+	}
+	return "", errWrongEncoding
+}
+
+// keyParam decodes the key parameter. Writes the error response and returns false if wrong
+func keyParam(w http.ResponseWriter, r *http.Request, name string) (string, []byte, bool) {
+	enc, err := encodingParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return "", nil, false
+	}
+	key, err := decode(enc, r.URL.Query().Get(name))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("wrong '%s': %w", name, err))
+		return "", nil, false
+	}
+	return enc, key, true
+}
+
+func encode(enc string, data []byte) string {
+	if enc == EncodingBase64 {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return hex.EncodeToString(data)
+}
+
+// decode accepts both standard and URL-safe base64, because '+' in the query must be escaped
+func decode(enc string, s string) ([]byte, error) {
+	if enc == EncodingBase64 {
+		if ret, err := base64.StdEncoding.DecodeString(s); err == nil {
+			return ret, nil
+		}
+		return base64.URLEncoding.DecodeString(s)
+	}
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,127 @@
+package restapi
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b/trie_blake2b_verify"
+	"github.com/lunfardo314/unitrie/models/trie_kzg_bn256"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTrie(t *testing.T, m common.CommitmentModel, n int) *immutable.TrieReader {
+	store := common.NewInMemoryKVStore()
+	root := immutable.MustInitRoot(store, m, []byte("identity"))
+	tr, err := immutable.NewTrieUpdatable(m, store, root)
+	require.NoError(t, err)
+	for i := 0; i < n; i++ {
+		tr.UpdateStr(fmt.Sprintf("key%03d", i), fmt.Sprintf("value%d", i))
+	}
+	root = tr.Commit(store)
+	ret, err := immutable.NewTrieReader(m, store, root)
+	require.NoError(t, err)
+	return ret
+}
+
+func get(t *testing.T, h http.Handler, url string, expectedStatus int, resp any) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	require.EqualValues(t, expectedStatus, rec.Code, rec.Body.String())
+	require.EqualValues(t, "application/json", rec.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), resp))
+}
+
+func TestHandler(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	tr := newTestTrie(t, m, 20)
+	h := NewHandler(tr)
+
+	t.Run("root", func(t *testing.T) {
+		var resp RootResponse
+		get(t, h, "/root", http.StatusOK, &resp)
+		require.EqualValues(t, hex.EncodeToString(tr.Root().Bytes()), resp.Root)
+		require.EqualValues(t, m.ShortName(), resp.Model)
+		get(t, h, "/root?encoding=base64", http.StatusOK, &resp)
+		require.EqualValues(t, base64.StdEncoding.EncodeToString(tr.Root().Bytes()), resp.Root)
+	})
+	t.Run("get", func(t *testing.T) {
+		var resp GetResponse
+		get(t, h, "/get?key="+hex.EncodeToString([]byte("key005")), http.StatusOK, &resp)
+		require.True(t, resp.Found)
+		require.EqualValues(t, hex.EncodeToString([]byte("value5")), resp.Value)
+
+		resp = GetResponse{}
+		get(t, h, "/get?encoding=base64&key="+base64.StdEncoding.EncodeToString([]byte("key007")), http.StatusOK, &resp)
+		require.True(t, resp.Found)
+		require.EqualValues(t, base64.StdEncoding.EncodeToString([]byte("value7")), resp.Value)
+
+		// URL-safe base64 is accepted
+		resp = GetResponse{}
+		get(t, h, "/get?encoding=base64&key="+base64.URLEncoding.EncodeToString([]byte("key\xfb\xff")), http.StatusOK, &resp)
+		require.False(t, resp.Found)
+		require.EqualValues(t, base64.StdEncoding.EncodeToString([]byte("key\xfb\xff")), resp.Key)
+
+		resp = GetResponse{}
+		get(t, h, "/get?key="+hex.EncodeToString([]byte("absent")), http.StatusOK, &resp)
+		require.False(t, resp.Found)
+
+		var errResp ErrorResponse
+		get(t, h, "/get?key=zz", http.StatusBadRequest, &errResp)
+		require.Contains(t, errResp.Error, "key")
+		get(t, h, "/get?key=00&encoding=base32", http.StatusBadRequest, &errResp)
+		require.EqualValues(t, errWrongEncoding.Error(), errResp.Error)
+	})
+	t.Run("proof", func(t *testing.T) {
+		var resp ProofResponse
+		get(t, h, "/proof?key="+hex.EncodeToString([]byte("key005")), http.StatusOK, &resp)
+		proofBin, err := hex.DecodeString(resp.Proof)
+		require.NoError(t, err)
+		p, err := trie_blake2b.ProofFromBytes(proofBin)
+		require.NoError(t, err)
+		require.NoError(t, trie_blake2b_verify.ValidateWithTerminal(p, tr.Root().Bytes(), m.CommitToData([]byte("value5")).Bytes()))
+	})
+	t.Run("iterate", func(t *testing.T) {
+		var resp IterateResponse
+		get(t, h, "/iterate?prefix="+hex.EncodeToString([]byte("key01")), http.StatusOK, &resp)
+		require.EqualValues(t, 10, len(resp.Items))
+		require.False(t, resp.More)
+		require.EqualValues(t, hex.EncodeToString([]byte("key010")), resp.Items[0].Key)
+		require.EqualValues(t, hex.EncodeToString([]byte("value10")), resp.Items[0].Value)
+
+		resp = IterateResponse{}
+		get(t, h, "/iterate?limit=5", http.StatusOK, &resp)
+		require.EqualValues(t, 5, len(resp.Items))
+		require.True(t, resp.More)
+
+		var errResp ErrorResponse
+		get(t, h, "/iterate?limit=0", http.StatusBadRequest, &errResp)
+		get(t, h, fmt.Sprintf("/iterate?limit=%d", MaxIterateLimitDefault+1), http.StatusBadRequest, &errResp)
+	})
+	t.Run("method", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/root", nil))
+		require.EqualValues(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+	t.Run("new root", func(t *testing.T) {
+		tr1 := newTestTrie(t, m, 30)
+		h.SetTrieReader(tr1)
+		var resp RootResponse
+		get(t, h, "/root", http.StatusOK, &resp)
+		require.EqualValues(t, hex.EncodeToString(tr1.Root().Bytes()), resp.Root)
+	})
+}
+
+func TestHandlerNoProofs(t *testing.T) {
+	h := NewHandler(newTestTrie(t, trie_kzg_bn256.New(), 3))
+	var errResp ErrorResponse
+	get(t, h, "/proof?key=00", http.StatusNotImplemented, &errResp)
+	require.EqualValues(t, errNoProofs.Error(), errResp.Error)
+}
@@ -0,0 +1,63 @@
+package versioned
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+)
+
+// Registry of roots of saved versions. It is stored in the PartitionOther of the trie store:
+// the root of each version under the registryPrefix followed by 8 bytes (big-endian) of the version number,
+// the latest version (8 bytes, big-endian) under the registryPrefix itself
+
+var registryPrefix = []byte{immutable.PartitionOther, 'v', 'e', 'r'}
+
+func versionKey(version int64) []byte {
+	ret := make([]byte, len(registryPrefix)+8)
+	copy(ret, registryPrefix)
+	binary.BigEndian.PutUint64(ret[len(registryPrefix):], uint64(version))
+	return ret
+}
+
+// readRoot reads root of the version from the registry. Returns nil if version does not exist
+func readRoot(m common.CommitmentModel, store common.KVReader, version int64) (common.VCommitment, error) {
+	data := store.Get(versionKey(version))
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return common.VectorCommitmentFromBytes(m, data)
+}
+
+func writeRoot(w common.KVWriter, version int64, root common.VCommitment) {
+	w.Set(versionKey(version), root.Bytes())
+}
+
+// readLatest reads the latest version from the registry. Returns 0 if no versions were saved
+func readLatest(store common.KVReader) int64 {
+	data := store.Get(registryPrefix)
+	if len(data) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+func writeLatest(w common.KVWriter, version int64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(version))
+	w.Set(registryPrefix, buf[:])
+}
+
+// readVersions returns all versions in the registry in ascending order
+func readVersions(store common.KVTraversableStore) []int64 {
+	ret := make([]int64, 0)
+	store.Iterator(registryPrefix).IterateKeys(func(k []byte) bool {
+		if len(k) == len(registryPrefix)+8 {
+			ret = append(ret, int64(binary.BigEndian.Uint64(k[len(registryPrefix):])))
+		}
+		return true
+	})
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
@@ -0,0 +1,289 @@
+// Package versioned provides the facade of the trie with the versioning semantics of the Cosmos IAVL MutableTree:
+// the working tree is updated with Set and Remove, each SaveVersion commits it as the next version. Any saved version
+// can be loaded back, read with GetImmutable or deleted.
+// Roots of versions are kept in the registry in the same store as the trie. Nodes of the trie are shared among
+// versions, DeleteVersion removes the version from the registry together with the nodes and values which are
+// not reachable from other versions
+package versioned
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+)
+
+var (
+	ErrVersionDoesNotExist = errors.New("version does not exist")
+	ErrVersionExists       = errors.New("version already exists with different root")
+	ErrDeleteLatestVersion = errors.New("can't delete the latest version")
+	ErrDeleteLoadedVersion = errors.New("can't delete the version the working tree is based on")
+	ErrEmptyKey            = errors.New("key can't be empty")
+	ErrNilValue            = errors.New("value can't be nil")
+)
+
+// MutableTree is the working tree on top of the chained trie. It is not safe for concurrent use
+type MutableTree struct {
+	m         common.CommitmentModel
+	store     common.KVTraversableStore
+	cacheSize []int
+	trie      *immutable.TrieChained
+	// version the working tree is based on. 0 if no versions were saved
+	version int64
+	root    common.VCommitment
+	// uncommitted updates of the working tree. Nil value means deletion
+	pending map[string][]byte
+}
+
+// NewMutableTree creates the tree in the store. If versions were saved in the store before, the latest version
+// is loaded, otherwise the tree starts empty with the identity in the root at version 0.
+// Optional cacheSize is the node cache parameters of the trie, see immutable.NewTrieReader
+func NewMutableTree(m common.CommitmentModel, store common.KVTraversableStore, identity []byte, cacheSize ...int) (*MutableTree, error) {
+	ret := &MutableTree{
+		m:         m,
+		store:     store,
+		cacheSize: cacheSize,
+	}
+	if readLatest(store) > 0 {
+		if _, err := ret.LoadVersion(0); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	if err := ret.reset(0, immutable.MustInitRoot(store, m, identity)); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (t *MutableTree) reset(version int64, root common.VCommitment) error {
+	trie, err := immutable.NewTrieChained(t.m, t.store, root, t.cacheSize...)
+	if err != nil {
+		return err
+	}
+	t.trie = trie
+	t.version = version
+	t.root = root
+	t.pending = make(map[string][]byte)
+	return nil
+}
+
+// Version returns the version the working tree is based on: the last saved or loaded
+func (t *MutableTree) Version() int64 {
+	return t.version
+}
+
+// Root returns the root of the version the working tree is based on
+func (t *MutableTree) Root() common.VCommitment {
+	return t.root
+}
+
+// Hash returns serialized root of the version the working tree is based on
+func (t *MutableTree) Hash() []byte {
+	return t.root.Bytes()
+}
+
+// LatestVersion returns the latest saved version. 0 if no versions were saved
+func (t *MutableTree) LatestVersion() int64 {
+	return readLatest(t.store)
+}
+
+// Get returns value of the key in the working tree. Nil if the key is absent
+func (t *MutableTree) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptyKey
+	}
+	if v, ok := t.pending[string(key)]; ok {
+		return v, nil
+	}
+	return t.trie.Get(key), nil
+}
+
+// Has checks presence of the key in the working tree
+func (t *MutableTree) Has(key []byte) (bool, error) {
+	v, err := t.Get(key)
+	return len(v) > 0, err
+}
+
+// Set sets the value of the key in the working tree. Returns true if the key existed
+func (t *MutableTree) Set(key, value []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrEmptyKey
+	}
+	if value == nil {
+		return false, ErrNilValue
+	}
+	existed := t.trie.Update(key, value)
+	t.pending[string(key)] = common.Concat(value)
+	return existed, nil
+}
+
+// Remove removes the key from the working tree. Returns the removed value and true if the key existed
+func (t *MutableTree) Remove(key []byte) ([]byte, bool, error) {
+	value, err := t.Get(key)
+	if err != nil || len(value) == 0 {
+		return nil, false, err
+	}
+	t.trie.Delete(key)
+	t.pending[string(key)] = nil
+	return value, true, nil
+}
+
+// Rollback discards all updates of the working tree since the last saved or loaded version
+func (t *MutableTree) Rollback() {
+	t.trie.Rollback()
+	t.pending = make(map[string][]byte)
+}
+
+// SaveVersion commits the working tree as the next version. Returns the serialized root and the version.
+// If the next version already exists (after an older version was loaded), the committed root must be the same,
+// otherwise ErrVersionExists is returned and the updates of the working tree are discarded
+func (t *MutableTree) SaveVersion() ([]byte, int64, error) {
+	version := t.version + 1
+	existing, err := readRoot(t.m, t.store, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	var w common.KVWriter = t.store
+	var batch common.KVBatchedWriter
+	if bu, ok := t.store.(common.BatchedUpdatable); ok {
+		batch = bu.BatchedWriter()
+		w = batch
+	}
+	root := t.trie.CommitAndContinue(w)
+	if existing != nil && !t.m.EqualCommitments(existing, root) {
+		// the trie continues from the root which is not saved
+		if err = t.reset(t.version, t.root); err != nil {
+			return nil, 0, err
+		}
+		return nil, 0, fmt.Errorf("%w: version %d", ErrVersionExists, version)
+	}
+	writeRoot(w, version, root)
+	if version > readLatest(t.store) {
+		writeLatest(w, version)
+	}
+	if batch != nil {
+		if err = batch.Commit(); err != nil {
+			return nil, 0, err
+		}
+	}
+	t.version = version
+	t.root = root
+	t.pending = make(map[string][]byte)
+	return root.Bytes(), version, nil
+}
+
+// LoadVersion loads the version as the base of the working tree. Uncommitted updates are discarded.
+// Version 0 means the latest version. Returns the loaded version
+func (t *MutableTree) LoadVersion(version int64) (int64, error) {
+	if version == 0 {
+		version = readLatest(t.store)
+	}
+	root, err := readRoot(t.m, t.store, version)
+	if err != nil {
+		return 0, err
+	}
+	if root == nil {
+		return 0, fmt.Errorf("%w: %d", ErrVersionDoesNotExist, version)
+	}
+	if err = t.reset(version, root); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// DeleteVersion removes the version from the registry and prunes the nodes and values of the version
+// which are not shared with other saved versions, in one batch if the store supports it.
+// Pruning walks the tries of all remaining versions. The latest version and the version the working tree
+// is based on can't be deleted. Readers of the deleted version, returned by GetImmutable, must not be used after
+func (t *MutableTree) DeleteVersion(version int64) error {
+	if !t.VersionExists(version) {
+		return fmt.Errorf("%w: %d", ErrVersionDoesNotExist, version)
+	}
+	if version == readLatest(t.store) {
+		return ErrDeleteLatestVersion
+	}
+	if version == t.version {
+		return ErrDeleteLoadedVersion
+	}
+	root, err := readRoot(t.m, t.store, version)
+	if err != nil {
+		return err
+	}
+	retained := make([]common.VCommitment, 0)
+	for _, v := range readVersions(t.store) {
+		if v == version {
+			continue
+		}
+		r, err := readRoot(t.m, t.store, v)
+		if err != nil {
+			return err
+		}
+		retained = append(retained, r)
+	}
+	prune, err := immutable.PrunePlan(t.store, t.m, root, retained...)
+	if err != nil {
+		return err
+	}
+	var w common.KVWriter = t.store
+	var batch common.KVBatchedWriter
+	if bu, ok := t.store.(common.BatchedUpdatable); ok {
+		batch = bu.BatchedWriter()
+		w = batch
+	}
+	prune.WriteTo(w)
+	w.Set(versionKey(version), nil)
+	if batch != nil {
+		return batch.Commit()
+	}
+	return nil
+}
+
+// VersionExists checks if the version is in the registry
+func (t *MutableTree) VersionExists(version int64) bool {
+	return version > 0 && t.store.Has(versionKey(version))
+}
+
+// AvailableVersions returns all saved versions in ascending order
+func (t *MutableTree) AvailableVersions() []int {
+	versions := readVersions(t.store)
+	ret := make([]int, len(versions))
+	for i, v := range versions {
+		ret[i] = int(v)
+	}
+	return ret
+}
+
+// GetImmutable returns reader of the saved version
+func (t *MutableTree) GetImmutable(version int64) (*immutable.TrieReader, error) {
+	root, err := readRoot(t.m, t.store, version)
+	if err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("%w: %d", ErrVersionDoesNotExist, version)
+	}
+	return immutable.NewTrieReader(t.m, t.store, root, t.cacheSize...)
+}
+
+// Iterate iterates key/value pairs of the version the working tree is based on, in the order of the trie.
+// The identity in the root is skipped. Returns true if stopped by the callback
+func (t *MutableTree) Iterate(fun func(key, value []byte) bool) (bool, error) {
+	tr, err := immutable.NewTrieReader(t.m, t.store, t.root, t.cacheSize...)
+	if err != nil {
+		return false, err
+	}
+	stopped := false
+	tr.Iterate(func(k, v []byte) bool {
+		if len(k) == 0 {
+			return true
+		}
+		if !fun(k, v) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	return stopped, nil
+}
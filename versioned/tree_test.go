@@ -0,0 +1,163 @@
+package versioned
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lunfardo314/unitrie/common"
+	"github.com/lunfardo314/unitrie/immutable"
+	"github.com/lunfardo314/unitrie/models/trie_blake2b"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutableTree(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	tree, err := NewMutableTree(m, store, []byte("identity"))
+	require.NoError(t, err)
+	require.EqualValues(t, 0, tree.Version())
+	require.EqualValues(t, 0, len(tree.AvailableVersions()))
+
+	hashes := make([][]byte, 0)
+	for v := 1; v <= 5; v++ {
+		for i := 0; i < 10; i++ {
+			existed, err := tree.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d.%d", i, v)))
+			require.NoError(t, err)
+			require.EqualValues(t, v > 1, existed)
+		}
+		value, err := tree.Get([]byte("key0"))
+		require.NoError(t, err)
+		require.EqualValues(t, fmt.Sprintf("value0.%d", v), string(value))
+
+		hash, version, err := tree.SaveVersion()
+		require.NoError(t, err)
+		require.EqualValues(t, v, version)
+		require.EqualValues(t, tree.Hash(), hash)
+		hashes = append(hashes, hash)
+	}
+	require.EqualValues(t, []int{1, 2, 3, 4, 5}, tree.AvailableVersions())
+
+	// removed and rolled back
+	value, existed, err := tree.Remove([]byte("key1"))
+	require.NoError(t, err)
+	require.True(t, existed)
+	require.EqualValues(t, "value1.5", string(value))
+	has, err := tree.Has([]byte("key1"))
+	require.NoError(t, err)
+	require.False(t, has)
+	tree.Rollback()
+	has, err = tree.Has([]byte("key1"))
+	require.NoError(t, err)
+	require.True(t, has)
+
+	// older versions are readable
+	tr, err := tree.GetImmutable(2)
+	require.NoError(t, err)
+	require.EqualValues(t, "value3.2", tr.GetStr("key3"))
+
+	// reopening loads the latest version
+	tree, err = NewMutableTree(m, store, []byte("identity"))
+	require.NoError(t, err)
+	require.EqualValues(t, 5, tree.Version())
+	require.EqualValues(t, hashes[4], tree.Hash())
+
+	num := 0
+	stopped, err := tree.Iterate(func(key, value []byte) bool {
+		num++
+		return true
+	})
+	require.NoError(t, err)
+	require.False(t, stopped)
+	require.EqualValues(t, 10, num)
+
+	// deletion of versions
+	require.True(t, errors.Is(tree.DeleteVersion(5), ErrDeleteLatestVersion))
+	require.True(t, errors.Is(tree.DeleteVersion(7), ErrVersionDoesNotExist))
+	require.NoError(t, tree.DeleteVersion(1))
+	require.EqualValues(t, []int{2, 3, 4, 5}, tree.AvailableVersions())
+	_, err = tree.LoadVersion(1)
+	require.True(t, errors.Is(err, ErrVersionDoesNotExist))
+
+	// loading older version and saving the same updates again results in the same version
+	loaded, err := tree.LoadVersion(3)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, loaded)
+	require.True(t, errors.Is(tree.DeleteVersion(3), ErrDeleteLoadedVersion))
+	for i := 0; i < 10; i++ {
+		_, err = tree.Set([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d.%d", i, 4)))
+		require.NoError(t, err)
+	}
+	hash, version, err := tree.SaveVersion()
+	require.NoError(t, err)
+	require.EqualValues(t, 4, version)
+	require.EqualValues(t, hashes[3], hash)
+
+	// different updates can't overwrite existing version
+	_, err = tree.Set([]byte("other"), []byte("other"))
+	require.NoError(t, err)
+	_, _, err = tree.SaveVersion()
+	require.True(t, errors.Is(err, ErrVersionExists))
+	require.EqualValues(t, 4, tree.Version())
+	has, err = tree.Has([]byte("other"))
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+func TestMutableTreeWrongKeys(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity256, trie_blake2b.HashSize256)
+	tree, err := NewMutableTree(m, common.NewInMemoryKVStore(), []byte("identity"))
+	require.NoError(t, err)
+	_, err = tree.Set(nil, []byte("a"))
+	require.True(t, errors.Is(err, ErrEmptyKey))
+	_, err = tree.Set([]byte("a"), nil)
+	require.True(t, errors.Is(err, ErrNilValue))
+	_, err = tree.Get(nil)
+	require.True(t, errors.Is(err, ErrEmptyKey))
+}
+
+func TestMutableTreeDeleteVersionPrunes(t *testing.T) {
+	m := trie_blake2b.New(common.PathArity16, trie_blake2b.HashSize160)
+	store := common.NewInMemoryKVStore()
+	tree, err := NewMutableTree(m, store, []byte("identity"))
+	require.NoError(t, err)
+	// long values are stored outside the nodes
+	longValue := func(i, v int) []byte {
+		return []byte(strings.Repeat(fmt.Sprintf("value%d.%d", i, v), 10))
+	}
+	for v := 1; v <= 5; v++ {
+		for i := 0; i < 100; i++ {
+			if i%5 == v-1 {
+				_, err = tree.Set([]byte(fmt.Sprintf("key%d", i)), longValue(i, v))
+				require.NoError(t, err)
+			}
+		}
+		_, _, err = tree.SaveVersion()
+		require.NoError(t, err)
+	}
+	sizes := []int{store.Len()}
+	for v := int64(1); v <= 4; v++ {
+		require.NoError(t, tree.DeleteVersion(v))
+		sizes = append(sizes, store.Len())
+		require.Less(t, sizes[v], sizes[v-1])
+
+		// remaining versions are intact
+		for _, remaining := range tree.AvailableVersions() {
+			tr, err := tree.GetImmutable(int64(remaining))
+			require.NoError(t, err)
+			require.NoError(t, immutable.VerifyIntegrity(store, m, tr.Root()))
+		}
+	}
+	// only the latest version and the initial root are left
+	initRoot := immutable.MustInitRoot(common.NewInMemoryKVStore(), m, []byte("identity"))
+	report, err := immutable.ScanOrphans(store, m, tree.Root(), initRoot)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, len(report.Orphans))
+	numValues := 0
+	store.Iterator([]byte{immutable.PartitionValues}).IterateKeys(func(_ []byte) bool {
+		numValues++
+		return true
+	})
+	require.EqualValues(t, 100, numValues)
+}